@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/config"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/eval"
+	"github.com/waynenilsen/waynebot/internal/llm"
+)
+
+const evalUsage = `usage: waynebot eval [flags] scenario.json|dir ...
+
+Runs personas through scenario files and checks their answers and tool
+calls. With -provider script each scenario's scripted replies stand in for
+the LLM; with -provider fake the fake provider follows -fake-script; with
+-provider openrouter the persona's model answers. Results are
+stored so persona versions can be compared. Exits 1 if any scenario failed.
+`
+
+// evalCommand runs "waynebot eval" and returns the exit status.
+func evalCommand(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), evalUsage)
+		fs.PrintDefaults()
+	}
+	provider := fs.String("provider", "script", "LLM provider: script, fake or openrouter")
+	fakeScript := fs.String("fake-script", "", "rule file for the fake provider (default $WAYNEBOT_FAKE_LLM_SCRIPT)")
+	llmModel := fs.String("model", "", "model to use instead of each persona's")
+	persona := fs.String("persona", "", "persona to evaluate instead of each scenario's")
+	graderModel := fs.String("grader-model", "", "OpenRouter model that grades rubric assertions (skipped when empty)")
+	parallel := fs.Int("parallel", eval.DefaultParallel, "how many scenarios to run at once")
+	format := fs.String("format", "markdown", "report format: markdown or json")
+	out := fs.String("o", "", "write the report to this file instead of stdout")
+	store := fs.Bool("store", true, "store the results in the database")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || (*format != "markdown" && *format != "json") {
+		fs.Usage()
+		return 2
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+	cfg := config.Load()
+
+	var client agent.LLMClient
+	switch *provider {
+	case "script":
+	case "fake":
+		if *fakeScript == "" {
+			*fakeScript = cfg.FakeLLMScript
+		}
+		fake, err := llm.LoadFake(*fakeScript)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load fake script: %v\n", err)
+			return 2
+		}
+		client = fake
+	case "openrouter":
+		if cfg.OpenRouterKey == "" {
+			fmt.Fprintln(os.Stderr, "the openrouter provider needs WAYNEBOT_OPENROUTER_KEY")
+			return 2
+		}
+		client = llm.NewClient(cfg.OpenRouterKey)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown provider %q\n", *provider)
+		return 2
+	}
+
+	scenarios, err := eval.LoadScenarios(fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load scenarios: %v\n", err)
+		return 2
+	}
+
+	database, err := db.Open(cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open database: %v\n", err)
+		return 2
+	}
+	defer database.Close()
+
+	runner := &eval.Runner{DB: database, LLM: client, Model: *llmModel, Persona: *persona, Parallel: *parallel}
+	if *graderModel != "" {
+		if cfg.OpenRouterKey == "" {
+			fmt.Fprintln(os.Stderr, "grading rubrics needs WAYNEBOT_OPENROUTER_KEY")
+			return 2
+		}
+		runner.Grader = &eval.Grader{LLM: llm.NewClient(cfg.OpenRouterKey), Model: *graderModel}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report := eval.NewReport(*provider, *llmModel, runner.Run(ctx, scenarios))
+
+	if *store {
+		run, err := report.Store(database)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "store results: %v\n", err)
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "stored as eval run %d\n", run.ID)
+	}
+
+	var body []byte
+	if *format == "json" {
+		body, err = json.MarshalIndent(report, "", "  ")
+		body = append(body, '\n')
+	} else {
+		body = []byte(report.Markdown())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render report: %v\n", err)
+		return 2
+	}
+	if *out != "" {
+		err = os.WriteFile(*out, body, 0o644)
+	} else {
+		_, err = os.Stdout.Write(body)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write report: %v\n", err)
+		return 2
+	}
+
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
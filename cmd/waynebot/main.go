@@ -16,12 +16,24 @@ import (
 	"github.com/waynenilsen/waynebot/internal/connector"
 	"github.com/waynenilsen/waynebot/internal/db"
 	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/metrics"
 	"github.com/waynenilsen/waynebot/internal/model"
 	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/tracing"
 	"github.com/waynenilsen/waynebot/internal/ws"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replayCommand(os.Args[2:]))
+		case "eval":
+			os.Exit(evalCommand(os.Args[2:]))
+		}
+	}
+
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 
 	cfg := config.Load()
@@ -43,13 +55,60 @@ func main() {
 	hub := ws.NewHub()
 	go hub.Run()
 
-	llmClient := llm.NewClient(cfg.OpenRouterKey)
+	llmClient, err := newLLMClient(cfg)
+	if err != nil {
+		slog.Error("failed to set up LLM provider", "error", err)
+		os.Exit(1)
+	}
 	toolsRegistry := tools.NewRegistry()
 	toolsRegistry.RegisterDefaults(".")
 	toolsRegistry.Register("message_react", tools.MessageReact(database, hub))
-	toolsRegistry.Register("memory_save", tools.MemorySave())
-	toolsRegistry.Register("memory_search", tools.MemorySearchFiles())
+	embedder := newEmbedder(cfg)
+	slog.Info("memory store ready", "embedder", embedder.Name())
+	memories := memory.NewStore(database, embedder)
+	toolsRegistry.Register("memory_save", tools.MemorySave(memories))
+	toolsRegistry.Register("memory_search", tools.MemorySearch(memories))
+	toolsRegistry.Register("memory_list", tools.MemoryList(memories))
+	toolsRegistry.Register("memory_update", tools.MemoryUpdate(memories))
+	toolsRegistry.Register("memory_forget", tools.MemoryForget(memories))
 	supervisor := agent.NewSupervisor(database, hub, llmClient, toolsRegistry)
+	supervisor.Memory = memories
+	supervisor.MaxConcurrentChannels = cfg.MaxConcurrentChannels
+	supervisor.RestartOnNewMessage = cfg.RestartOnNewMessage
+	if cfg.OTelFile != "" || cfg.OTelEndpoint != "" {
+		supervisor.Traces = &tracing.Exporter{File: cfg.OTelFile, Endpoint: cfg.OTelEndpoint}
+		slog.Info("exporting run traces", "file", cfg.OTelFile, "endpoint", cfg.OTelEndpoint)
+	}
+	supervisor.RegisterMetrics()
+	metrics.NewGaugeFunc("waynebot_ws_clients", "Connected WebSocket clients.", nil, func(emit func(float64, ...string)) {
+		emit(float64(hub.ClientCount()))
+	})
+	toolsRegistry.Register("delegate", tools.Delegate(supervisor))
+	toolsRegistry.Register("task_create", tools.TaskCreate(database, hub))
+	toolsRegistry.Register("task_list", tools.TaskList(database))
+	toolsRegistry.Register("task_claim", tools.TaskClaim(database, hub))
+	toolsRegistry.Register("task_update", tools.TaskUpdate(database, hub))
+	toolsRegistry.Register("task_comment", tools.TaskComment(database, hub))
+	if n, err := model.FailRunningDelegations(database); err != nil {
+		slog.Error("failed to close interrupted delegations", "error", err)
+	} else if n > 0 {
+		slog.Info("closed interrupted delegations", "count", n)
+	}
+
+	var worktrees *tools.Worktrees
+	if cfg.WorktreeDir != "" {
+		worktrees = tools.NewWorktrees(cfg.WorktreeDir)
+		supervisor.Worktrees = worktrees
+		slog.Info("per-persona git worktrees enabled", "worktree_dir", cfg.WorktreeDir)
+	}
+	if cfg.StageChanges {
+		supervisor.StageChanges = true
+		slog.Info("agent file changes will be staged for review")
+	}
+	if cfg.TemplateDir != "" {
+		supervisor.TemplateDir = cfg.TemplateDir
+		slog.Info("persona templates will also load from directory", "template_dir", cfg.TemplateDir)
+	}
 
 	if err := supervisor.StartAll(); err != nil {
 		slog.Error("failed to start agent supervisor", "error", err)
@@ -79,7 +138,16 @@ func main() {
 	}
 	connectors.StartAll()
 
-	router := api.NewRouter(database, cfg.CORSOrigins, hub, supervisor)
+	archiver := &agent.Archiver{
+		DB:         database,
+		ArchiveDir: cfg.ArchiveDir,
+		MaxEvents:  cfg.ArchiveMaxEvents,
+		MaxAge:     cfg.ArchiveMaxAge,
+		MaxBytes:   cfg.ArchiveMaxBytes,
+	}
+	supervisor.Archiver = archiver
+
+	router := api.NewRouter(database, cfg.CORSOrigins, cfg.MetricsToken, hub, supervisor)
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Port),
@@ -92,10 +160,18 @@ func main() {
 
 	// Session and ws_ticket cleanup goroutine.
 	go runCleanup(ctx, database)
+	go runReminders(ctx, database, hub)
+
+	workflowsDone := make(chan struct{})
+	go func() {
+		supervisor.Workflows.Run(ctx)
+		close(workflowsDone)
+	}()
+	slog.Info("workflow runner started")
 
-	archiver := &agent.Archiver{DB: database, ArchiveDir: cfg.ArchiveDir}
 	go archiver.Run(ctx)
-	slog.Info("archiver started", "archive_dir", cfg.ArchiveDir)
+	slog.Info("archiver started", "archive_dir", cfg.ArchiveDir, "max_events", cfg.ArchiveMaxEvents,
+		"max_age", cfg.ArchiveMaxAge, "max_bytes", cfg.ArchiveMaxBytes)
 
 	go func() {
 		slog.Info("listening", "port", cfg.Port)
@@ -108,7 +184,7 @@ func main() {
 	<-ctx.Done()
 	slog.Info("shutting down...")
 
-	// Shutdown order: HTTP → connectors → agents → WS hub → DB (via defer).
+	// Shutdown order: HTTP → connectors → workflows → agents → WS hub → DB (via defer).
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
@@ -119,6 +195,9 @@ func main() {
 	connectors.StopAll()
 	slog.Info("connectors stopped")
 
+	<-workflowsDone
+	slog.Info("workflow runner stopped")
+
 	supervisor.StopAll()
 	slog.Info("agent supervisor stopped")
 
@@ -128,7 +207,37 @@ func main() {
 	slog.Info("stopped")
 }
 
-// runCleanup deletes expired sessions and ws_tickets every 15 minutes.
+// newLLMClient returns the LLM provider cfg selects. Personas whose model is
+// "fake" or "fake/..." get the fake provider either way.
+func newLLMClient(cfg config.Config) (agent.LLMClient, error) {
+	fake, err := llm.LoadFake(cfg.FakeLLMScript)
+	if err != nil {
+		return nil, fmt.Errorf("load fake LLM script: %w", err)
+	}
+	switch cfg.LLMProvider {
+	case "fake":
+		slog.Info("using the fake LLM provider", "script", cfg.FakeLLMScript)
+		return fake, nil
+	case "openrouter":
+		if cfg.OpenRouterKey == "" {
+			slog.Warn("WAYNEBOT_OPENROUTER_KEY is not set; only fake models will answer (set WAYNEBOT_LLM_PROVIDER=fake to work offline)")
+		}
+		return &llm.Router{Default: llm.NewClient(cfg.OpenRouterKey), Fake: fake}, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.LLMProvider)
+	}
+}
+
+// newEmbedder returns the configured memory embedder: the OpenAI-compatible
+// endpoint if one is set, otherwise the built-in local one.
+func newEmbedder(cfg config.Config) memory.Embedder {
+	if cfg.EmbeddingsURL != "" {
+		return memory.NewOpenAIEmbedder(cfg.EmbeddingsURL, cfg.EmbeddingsKey, cfg.EmbeddingsModel)
+	}
+	return memory.NewHashEmbedder()
+}
+
+// runCleanup deletes expired sessions, ws_tickets and memories every 15 minutes.
 func runCleanup(ctx context.Context, database *db.DB) {
 	ticker := time.NewTicker(15 * time.Minute)
 	defer ticker.Stop()
@@ -151,6 +260,30 @@ func runCleanup(ctx context.Context, database *db.DB) {
 			} else if tickets > 0 {
 				slog.Info("cleaned expired ws_tickets", "count", tickets)
 			}
+
+			memories, err := model.DeleteExpiredMemories(database)
+			if err != nil {
+				slog.Error("memory cleanup failed", "error", err)
+			} else if memories > 0 {
+				slog.Info("cleaned expired memories", "count", memories)
+			}
+		}
+	}
+}
+
+// runReminders delivers due /remind reminders to connected users.
+func runReminders(ctx context.Context, database *db.DB, hub *ws.Hub) {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := api.DeliverReminders(database, hub, time.Now()); err != nil {
+				slog.Error("reminder delivery failed", "error", err)
+			}
 		}
 	}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/config"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+const replayUsage = `usage: waynebot replay [-persona id [-n count]] [run_id ...]
+
+Replays recorded agent runs against the current code, answering LLM and tool
+calls from the recording, and reports where prompts or tool calls differ.
+Exits 1 if any run diverged.
+`
+
+// replayCommand runs "waynebot replay" and returns the exit status.
+func replayCommand(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), replayUsage)
+		fs.PrintDefaults()
+	}
+	personaID := fs.Int64("persona", 0, "replay this persona's most recent runs")
+	count := fs.Int("n", 20, "how many of the persona's runs to replay")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *personaID == 0 && fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	// Keep the actor's logging out of the report.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	cfg := config.Load()
+	database, err := db.Open(cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open database: %v\n", err)
+		return 2
+	}
+	defer database.Close()
+
+	runIDs := fs.Args()
+	if *personaID != 0 {
+		runs, err := model.ListAgentRuns(database, *personaID, *count, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list runs: %v\n", err)
+			return 2
+		}
+		for _, r := range runs {
+			if r.Trigger == model.RunTriggerMessage {
+				runIDs = append(runIDs, r.ID)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	status := 0
+	opts := agent.ReplayOptions{Embedder: newEmbedder(cfg)}
+	for _, id := range runIDs {
+		report, err := agent.Replay(ctx, database, id, opts)
+		switch {
+		case errors.Is(err, agent.ErrNotReplayable):
+			fmt.Printf("run %s: skipped: %v\n", id, err)
+			continue
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "run %s: %v\n", id, err)
+			return 2
+		}
+		printReplayReport(os.Stdout, report)
+		if report.Diverged() {
+			status = 1
+		}
+	}
+	return status
+}
+
+func printReplayReport(w io.Writer, r *agent.ReplayReport) {
+	if !r.Diverged() {
+		fmt.Fprintf(w, "run %s: ok (%d LLM calls, %d tool calls)\n", r.Run.ID, r.LLMCalls, r.ToolExecutions)
+		return
+	}
+	fmt.Fprintf(w, "run %s: %d divergences\n", r.Run.ID, len(r.Divergences))
+	for _, d := range r.Divergences {
+		step := "LLM call"
+		switch d.Kind {
+		case agent.DivergeTool, agent.DivergeExtraTool, agent.DivergeMissedTool:
+			step = "tool call"
+		}
+		detail := strings.TrimRight(d.Detail, "\n")
+		if strings.Contains(detail, "\n") {
+			detail = "\n    " + strings.ReplaceAll(detail, "\n", "\n    ")
+		}
+		fmt.Fprintf(w, "  %s %d: %s: %s\n", step, d.Step, d.Kind, detail)
+	}
+}
@@ -2,7 +2,9 @@ package agent
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -10,6 +12,7 @@ import (
 	"github.com/openai/openai-go"
 	"github.com/waynenilsen/waynebot/internal/db"
 	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/memory"
 	"github.com/waynenilsen/waynebot/internal/model"
 	"github.com/waynenilsen/waynebot/internal/tools"
 	"github.com/waynenilsen/waynebot/internal/ws"
@@ -37,105 +40,190 @@ type Actor struct {
 	Cursors  *CursorStore
 	Decision *DecisionMaker
 	Budget   *BudgetChecker
+
+	// Worktrees, when set, gives the persona its own git worktree of the
+	// channel's project instead of editing the shared checkout.
+	Worktrees *tools.Worktrees
+
+	// StageChanges routes the run's file writes into a per-run staging
+	// overlay that is proposed as a changeset for human review. Tools
+	// whose changes can't be staged, such as shell_exec, are refused.
+	StageChanges bool
+
+	// Memory, when set, supplies relevant memories for the context.
+	Memory *memory.Store
+
+	// MaxConcurrentChannels bounds how many channels the actor works in at
+	// once; zero means DefaultMaxConcurrentChannels.
+	MaxConcurrentChannels int
+
+	// Runs registers the actor's runs so they can be cancelled.
+	Runs *RunRegistry
+
+	// RestartOnNewMessage cancels a reply in progress when a human posts in
+	// its channel, so the persona starts over with the new messages.
+	RestartOnNewMessage bool
+
+	// MaxJobAttempts is how many times a job is tried before it is left
+	// dead, and JobRetryBackoff the delay before the first retry, doubling
+	// after each. Zero values mean the Default constants.
+	MaxJobAttempts  int
+	JobRetryBackoff time.Duration
+
+	// Traces, when set, is sent the trace of each run once it finishes.
+	Traces TraceExporter
+
+	// taskCursor is the last task event the persona has been woken for,
+	// kept in actor_task_cursors. Only the task worker touches it.
+	taskCursor int64
+
+	// drain, when it yields, makes Run let the runs in progress finish and
+	// return without starting more, so the actor can be replaced.
+	drain <-chan struct{}
+
+	// resume makes Run look for work straight away, picking up messages
+	// that arrived while the actor it replaces was draining.
+	resume bool
 }
 
-// Run starts the actor's processing loop. It blocks until ctx is cancelled.
-func (a *Actor) Run(ctx context.Context) {
+// Run starts the actor's processing loop. Each channel is worked on by its
+// own goroutine so a slow conversation doesn't delay the others. It blocks
+// until ctx is cancelled and the channel workers have finished. A panic in
+// the actor stops it the same way and is returned as a *PanicError.
+// Draining the actor also returns nil, once its runs have finished.
+func (a *Actor) Run(ctx context.Context) error {
+	ctx, crash := context.WithCancelCause(ctx)
+	defer crash(nil)
 	ticker := time.NewTicker(fallbackTicker)
 	defer ticker.Stop()
+	pool := newWorkerPool(a.MaxConcurrentChannels)
+	pool.onPanic = func(err *PanicError) { crash(err) }
 
 	a.Status.Set(a.Persona.ID, StatusIdle)
 
+	// Jobs still marked running were cut short when the actor last stopped.
+	if err := model.RequeueRunningAgentJobs(a.DB, a.Persona.ID); err != nil {
+		slog.Error("actor: requeue interrupted jobs", "persona", a.Persona.Name, "error", err)
+	}
+
+	a.loadTaskCursor()
+
+	if a.resume {
+		pool.protect(func() { a.dispatch(ctx, pool) })
+	}
+
 	for {
+		// Once asked to drain, start no more work even if some is waiting.
+		select {
+		case <-a.drain:
+			return a.finishDrain(ctx, pool)
+		default:
+		}
+
 		select {
 		case <-ctx.Done():
-			a.Status.Set(a.Persona.ID, StatusStopped)
-			return
+			return a.stop(ctx, pool)
+		case <-a.drain:
+			return a.finishDrain(ctx, pool)
 		case <-a.Hub.NotifyChan:
-			a.processChannels(ctx)
+			pool.protect(func() { a.dispatch(ctx, pool) })
 		case <-ticker.C:
-			a.processChannels(ctx)
+			pool.protect(func() { a.dispatch(ctx, pool) })
 		}
 	}
 }
 
-// processChannels iterates all subscribed channels and processes new messages.
-func (a *Actor) processChannels(ctx context.Context) {
-	channels, err := model.GetSubscribedChannels(a.DB, a.Persona.ID)
-	if err != nil {
-		slog.Error("actor: get subscribed channels", "persona", a.Persona.Name, "error", err)
-		return
+// stop waits for the workers to exit after ctx ends, returning the panic
+// that ended it, if any.
+func (a *Actor) stop(ctx context.Context, pool *workerPool) error {
+	pool.wait()
+	var perr *PanicError
+	if errors.As(context.Cause(ctx), &perr) {
+		return perr
 	}
+	a.Status.Set(a.Persona.ID, StatusStopped)
+	return nil
+}
 
-	for _, ch := range channels {
-		if ctx.Err() != nil {
-			return
-		}
-		a.processChannel(ctx, ch)
+// finishDrain stops the workers once their runs in progress finish.
+func (a *Actor) finishDrain(ctx context.Context, pool *workerPool) error {
+	pool.retain(nil)
+	pool.wait()
+	if ctx.Err() != nil {
+		return a.stop(ctx, pool)
 	}
+	return nil
 }
 
-// processChannel checks for new messages in a channel and responds if appropriate.
+// processChannel queues the channel's new messages as a job and works
+// through the persona's jobs there, oldest first.
 func (a *Actor) processChannel(ctx context.Context, ch model.Channel) {
-	cursor, err := a.Cursors.Get(a.Persona.ID, ch.ID)
-	if err != nil {
-		slog.Error("actor: get cursor", "persona", a.Persona.Name, "channel_id", ch.ID, "error", err)
+	if err := model.EnqueueAgentJob(a.DB, a.Persona.ID, ch.ID); err != nil {
+		slog.Error("actor: enqueue job", "persona", a.Persona.Name, "channel_id", ch.ID, "error", err)
 		return
 	}
+	for ctx.Err() == nil {
+		job, ok, err := model.ClaimAgentJob(a.DB, a.Persona.ID, ch.ID, newRunID(), time.Now())
+		if err != nil {
+			slog.Error("actor: claim job", "persona", a.Persona.Name, "channel_id", ch.ID, "error", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		a.runJob(ctx, ch, job)
+	}
+}
 
-	newMessages, err := model.GetMessagesSince(a.DB, ch.ID, cursor)
+// answerJob responds to the job's messages if the persona should.
+func (a *Actor) answerJob(ctx context.Context, ch model.Channel, job model.AgentJob) error {
+	newMessages, err := model.GetMessagesBetween(a.DB, ch.ID, job.FromMessageID+1, job.ToMessageID)
 	if err != nil {
-		slog.Error("actor: get messages since cursor", "persona", a.Persona.Name, "cursor", cursor, "channel_id", ch.ID, "error", err)
-		return
+		return fmt.Errorf("get messages: %w", err)
 	}
-
 	if len(newMessages) == 0 {
-		return
+		return nil
 	}
 
-	// Update cursor to latest message regardless of whether we respond.
-	latestID := newMessages[len(newMessages)-1].ID
-	defer func() {
-		if err := a.Cursors.Set(a.Persona.ID, ch.ID, latestID); err != nil {
-			slog.Error("actor: set cursor", "persona", a.Persona.Name, "error", err)
-		}
-	}()
-
-	if !a.Decision.ShouldRespond(a.Persona, ch.ID, newMessages) {
-		return
+	settings, err := model.ResolvePersonaChannelSettings(a.DB, a.Persona.ID, ch.ID)
+	if err != nil {
+		return fmt.Errorf("get channel settings: %w", err)
+	}
+	if !a.Decision.ShouldRespondWithSettings(a.Persona, settings, newMessages) {
+		return nil
 	}
 
-	ok, err := a.Budget.WithinBudget(a.Persona.ID, a.Persona.MaxTokensPerHour)
+	release, ok, err := a.Budget.Reserve(a.Persona.ID, a.Persona.MaxTokensPerHour, settings.Apply(a.Persona).MaxTokens)
 	if err != nil {
-		slog.Error("actor: budget check", "persona", a.Persona.Name, "error", err)
-		return
+		return fmt.Errorf("budget check: %w", err)
 	}
 	if !ok {
-		a.Status.Set(a.Persona.ID, StatusBudgetExceeded)
+		a.Status.SetChannel(a.Persona.ID, ch.ID, StatusBudgetExceeded)
 		a.broadcastStatus(ch.ID, StatusBudgetExceeded)
-		return
+		return errBudgetExceeded
 	}
+	defer release()
 
-	a.respond(ctx, ch)
+	return a.respond(ctx, ch)
+}
+
+// Respond answers the conversation in ch once, as the actor does for new
+// messages there but without first deciding whether the persona should.
+// It lets a persona be driven outside the supervisor, e.g. by the eval
+// harness.
+func (a *Actor) Respond(ctx context.Context, ch model.Channel) error {
+	return a.respond(ctx, ch)
 }
 
 // respond builds history, calls the LLM (with tool call loop), and posts the final response.
-func (a *Actor) respond(ctx context.Context, ch model.Channel) {
-	a.Status.Set(a.Persona.ID, StatusThinking)
-	a.broadcastStatus(ch.ID, StatusThinking)
-	defer func() {
-		// Don't override terminal states like context_full or error.
-		if s := a.Status.Get(a.Persona.ID); s == StatusThinking || s == StatusToolCall {
-			a.Status.Set(a.Persona.ID, StatusIdle)
-			a.broadcastStatus(ch.ID, StatusIdle)
-		}
-	}()
+func (a *Actor) respond(ctx context.Context, ch model.Channel) error {
+	defer a.beginRun(ch.ID)()
 
 	history, err := model.GetRecentMessages(a.DB, ch.ID, 50)
 	if err != nil {
 		slog.Error("actor: get history", "persona", a.Persona.Name, "error", err)
-		a.Status.Set(a.Persona.ID, StatusError)
-		return
+		a.Status.SetChannel(a.Persona.ID, ch.ID, StatusError)
+		return fmt.Errorf("get history: %w", err)
 	}
 
 	// GetRecentMessages returns newest-first; reverse for chronological order.
@@ -147,12 +235,82 @@ func (a *Actor) respond(ctx context.Context, ch model.Channel) {
 		slog.Error("actor: list channel projects", "persona", a.Persona.Name, "channel_id", ch.ID, "error", err)
 	}
 
+	_, err = a.converse(withRunTrigger(ctx, model.RunTriggerMessage), ch, history, projects, nil)
+	return err
+}
+
+// beginRun marks the persona as thinking in channelID and returns a func that
+// marks it idle there again.
+func (a *Actor) beginRun(channelID int64) func() {
+	a.setStatus(channelID, StatusThinking)
+	return func() {
+		// Don't override terminal states like context_full or error.
+		if s := a.Status.GetChannel(a.Persona.ID, channelID); s == StatusThinking || s == StatusToolCall {
+			a.setStatus(channelID, StatusIdle)
+		}
+	}
+}
+
+// setStatus records and broadcasts the persona's status in channelID. Work
+// outside any channel, such as a task with no channel, has no channel
+// status.
+func (a *Actor) setStatus(channelID int64, status Status) {
+	if channelID == 0 {
+		return
+	}
+	a.Status.SetChannel(a.Persona.ID, channelID, status)
+	a.broadcastStatus(channelID, status)
+}
+
+// converse answers history in ch: it assembles the context, runs the tool
+// call loop and posts the final response with post, returning the posted
+// message. A nil post posts to ch. It returns the zero Message when no
+// response was posted. Tools are scoped to the first of projects.
+//
+// Each call is a run, recorded in agent_runs and cancellable through
+// a.Runs until it returns. The error says why a run failed or was
+// cancelled: the cancellation cause, errContextFull when the context
+// window was full, or the LLM client's error wrapped. A failure after tools
+// ran, or at the tool round limit, wraps errRunNotRetryable.
+func (a *Actor) converse(ctx context.Context, ch model.Channel, history []model.Message, projects []model.Project, post func(content string) model.Message) (_ model.Message, err error) {
+	run := a.startRun(ctx, ch.ID, history)
+	status, reason := model.RunCompleted, ""
+	var cause error
+	defer func() {
+		if v := recover(); v != nil {
+			a.finishRun(run, model.RunFailed, fmt.Sprintf("panic: %v", v))
+			panic(v)
+		}
+		switch {
+		case run.ctx.Err() != nil:
+			err = context.Cause(run.ctx)
+		case cause != nil && err == nil:
+			err = cause
+		case status == model.RunFailed && err == nil:
+			err = errors.New(reason)
+		}
+		a.finishRun(run, status, reason)
+	}()
+	ctx = run.ctx
+
+	if post == nil {
+		post = func(content string) model.Message { return a.postMessage(ch, content) }
+	}
+	post = a.tracePosts(run.ID, post)
+	persona := a.channelPersona(ch.ID)
+	projectDir := a.projectDir(ctx, projects)
+	visibility := model.MemoryVisibility{PersonaID: a.Persona.ID, ChannelID: ch.ID}
+	if len(projects) > 0 {
+		visibility.ProjectID = projects[0].ID
+	}
+
 	assembler := &ContextAssembler{}
 	messages, budget := assembler.AssembleContext(AssembleInput{
-		Persona:   a.Persona,
+		Persona:   persona,
 		ChannelID: ch.ID,
 		Projects:  projects,
 		History:   history,
+		Memories:  RecallMemories(ctx, a.Memory, visibility, projectDir, history),
 	})
 
 	if budget.Exhausted && budget.HistoryMessages == 0 {
@@ -160,11 +318,11 @@ func (a *Actor) respond(ctx context.Context, ch model.Channel) {
 			"persona", a.Persona.Name,
 			"channel_id", ch.ID,
 		)
-		a.Status.Set(a.Persona.ID, StatusContextFull)
-		a.broadcastStatus(ch.ID, StatusContextFull)
-		a.postMessage(ch, "My context window is full. I cannot process new messages until context is reset. Please use `/reset-context` or start a new conversation thread.")
+		a.setStatus(ch.ID, StatusContextFull)
+		post("My context window is full. I cannot process new messages until context is reset. Please use `/reset-context` or start a new conversation thread.")
 		a.broadcastContextBudget(ch.ID, budget)
-		return
+		status, reason = model.RunFailed, errContextFull.Error()
+		return model.Message{}, errContextFull
 	}
 
 	if budget.Exhausted {
@@ -175,44 +333,105 @@ func (a *Actor) respond(ctx context.Context, ch model.Channel) {
 		)
 	}
 
-	toolDefs := llm.ToolsForPersona(a.Persona.ToolsEnabled)
+	toolDefs := llm.ToolsForPersona(persona.ToolsEnabled)
+
+	toolCtx := tools.WithPersonaID(run.toolCtx, a.Persona.ID)
+	toolCtx = tools.WithChannelID(toolCtx, ch.ID)
+	toolCtx = tools.WithDelegationDepth(toolCtx, tools.DelegationDepthFromContext(ctx))
+	if projectDir != "" {
+		toolCtx = tools.WithProjectDir(toolCtx, projectDir)
+		toolCtx = tools.WithProjectID(toolCtx, projects[0].ID)
+		toolCtx = tools.WithJournal(toolCtx, a.journal(ch.ID, projects[0].ID, projectDir, run.ID))
+		if a.StageChanges {
+			staging := tools.NewStaging(projectDir)
+			toolCtx = tools.WithStaging(toolCtx, staging)
+			defer a.proposeChangeset(ch, projects[0].ID, staging)
+		}
+	}
 
 	for round := 0; round < maxToolRounds; round++ {
 		if ctx.Err() != nil {
-			return
+			return model.Message{}, nil
 		}
 
-		resp, err := a.LLM.ChatCompletion(ctx, a.Persona.Model, messages, toolDefs, a.Persona.Temperature, a.Persona.MaxTokens)
+		start := time.Now()
+		resp, err := a.LLM.ChatCompletion(ctx, persona.Model, messages, toolDefs, persona.Temperature, persona.MaxTokens)
+		duration := time.Since(start)
+		observeLLMCall(persona.Name, persona.Model, start, resp, err)
 		if err != nil {
+			if ctx.Err() != nil {
+				return model.Message{}, nil
+			}
 			slog.Error("actor: llm call", "persona", a.Persona.Name, "error", err)
-			a.Status.Set(a.Persona.ID, StatusError)
-			a.broadcastStatus(ch.ID, StatusError)
-			return
+			a.setStatus(ch.ID, StatusError)
+			status, reason = model.RunFailed, err.Error()
+			cause = fmt.Errorf("llm call: %w", err)
+			if round > 0 {
+				cause = fmt.Errorf("%w: %w", errRunNotRetryable, cause)
+			}
+			return model.Message{}, nil
 		}
 
-		a.recordLLMCall(ch.ID, messages, resp)
+		a.recordLLMCall(run.ID, ch.ID, persona.Model, messages, resp, start, duration)
+		if resp.Content != "" {
+			run.output = resp.Content
+		}
 
 		if len(resp.ToolCalls) == 0 {
+			var msg model.Message
 			if resp.Content != "" {
-				a.postMessage(ch, resp.Content)
+				msg = post(resp.Content)
 			}
 			a.Decision.RecordResponse(a.Persona.ID, ch.ID)
 			a.broadcastContextBudget(ch.ID, budget)
-			return
+			return msg, nil
 		}
 
 		// Process tool calls.
-		a.Status.Set(a.Persona.ID, StatusToolCall)
-		a.broadcastStatus(ch.ID, StatusToolCall)
-		messages = a.executeToolCalls(messages, resp, projects)
+		a.setStatus(ch.ID, StatusToolCall)
+		messages = a.executeToolCalls(toolCtx, run.ID, ch.ID, messages, resp)
 	}
 
 	slog.Warn("actor: hit max tool rounds", "persona", a.Persona.Name, "max_rounds", maxToolRounds, "channel_id", ch.ID)
+	status, reason = model.RunFailed, fmt.Sprintf("hit max tool rounds (%d)", maxToolRounds)
+	cause = fmt.Errorf("%w: %s", errRunNotRetryable, reason)
+	return model.Message{}, nil
 }
 
-// executeToolCalls runs each tool call, appends assistant + tool result messages for the
-// next LLM round, and returns the updated messages slice.
-func (a *Actor) executeToolCalls(messages []openai.ChatCompletionMessageParamUnion, resp llm.Response, projects []model.Project) []openai.ChatCompletionMessageParamUnion {
+// channelPersona returns the persona with its overrides for channelID
+// applied.
+func (a *Actor) channelPersona(channelID int64) model.Persona {
+	settings, err := model.ResolvePersonaChannelSettings(a.DB, a.Persona.ID, channelID)
+	if err != nil {
+		slog.Error("actor: get channel settings", "persona", a.Persona.Name, "channel_id", channelID, "error", err)
+		return a.Persona
+	}
+	return settings.Apply(a.Persona)
+}
+
+// projectDir returns the directory tools should operate in for this channel:
+// the persona's worktree in worktree mode, otherwise the first project's path.
+// Returns "" when the channel has no project.
+func (a *Actor) projectDir(ctx context.Context, projects []model.Project) string {
+	if len(projects) == 0 {
+		return ""
+	}
+	if a.Worktrees == nil {
+		return projects[0].Path
+	}
+	dir, err := a.Worktrees.Ensure(ctx, projects[0].ID, projects[0].Path, a.Persona.ID, a.Persona.Name)
+	if err != nil {
+		slog.Warn("actor: worktree unavailable, using project dir", "persona", a.Persona.Name, "project", projects[0].Name, "error", err)
+		return projects[0].Path
+	}
+	return dir
+}
+
+// executeToolCalls runs each tool call of run runID in channelID with
+// toolCtx, appends assistant + tool result messages for the next LLM round,
+// and returns the updated messages slice. It stops early if toolCtx ends,
+// recording the interrupted call as cancelled.
+func (a *Actor) executeToolCalls(toolCtx context.Context, runID string, channelID int64, messages []openai.ChatCompletionMessageParamUnion, resp llm.Response) []openai.ChatCompletionMessageParamUnion {
 	// Build assistant message containing the tool calls.
 	toolCalls := make([]openai.ChatCompletionMessageToolCallParam, len(resp.ToolCalls))
 	for i, tc := range resp.ToolCalls {
@@ -233,10 +452,6 @@ func (a *Actor) executeToolCalls(messages []openai.ChatCompletionMessageParamUni
 	// Execute each tool and append the result.
 	for _, tc := range resp.ToolCalls {
 		start := time.Now()
-		toolCtx := tools.WithPersonaID(context.Background(), a.Persona.ID)
-		if len(projects) > 0 {
-			toolCtx = tools.WithProjectDir(toolCtx, projects[0].Path)
-		}
 		result, err := a.Tools.Call(toolCtx, tc.Name, json.RawMessage(tc.Arguments))
 		duration := time.Since(start)
 
@@ -246,19 +461,37 @@ func (a *Actor) executeToolCalls(messages []openai.ChatCompletionMessageParamUni
 			result = fmt.Sprintf("error: %v", err)
 		}
 
-		a.recordToolExecution(tc.Name, tc.Arguments, result, errText, duration)
-		messages = append(messages, openai.ToolMessage(tc.ID, result))
+		cancelled := toolCtx.Err() != nil
+		a.recordToolExecution(runID, channelID, tc.Name, tc.Arguments, result, errText, start, duration, cancelled)
+		if cancelled {
+			break
+		}
+		messages = append(messages, openai.ToolMessage(result, tc.ID))
 	}
 
 	return messages
 }
 
-// postMessage creates a message in the DB and broadcasts it via the hub.
-func (a *Actor) postMessage(ch model.Channel, content string) {
+// tracePosts wraps post to record the run that posted each message.
+func (a *Actor) tracePosts(runID string, post func(content string) model.Message) func(content string) model.Message {
+	return func(content string) model.Message {
+		msg := post(content)
+		if msg.ID != 0 {
+			if err := model.SetMessageRunID(a.DB, msg.ID, runID); err != nil {
+				slog.Error("actor: record message run", "persona", a.Persona.Name, "run_id", runID, "error", err)
+			}
+		}
+		return msg
+	}
+}
+
+// postMessage creates a message in the DB and broadcasts it via the hub. It
+// returns the zero Message if the message could not be stored.
+func (a *Actor) postMessage(ch model.Channel, content string) model.Message {
 	msg, err := model.CreateMessage(a.DB, ch.ID, a.Persona.ID, "agent", a.Persona.Name, content)
 	if err != nil {
 		slog.Error("actor: post message", "persona", a.Persona.Name, "error", err)
-		return
+		return model.Message{}
 	}
 
 	a.Hub.Broadcast(ws.Event{
@@ -274,10 +507,14 @@ func (a *Actor) postMessage(ch model.Channel, content string) {
 			"reactions":   []any{},
 		},
 	})
+	return msg
 }
 
-// recordLLMCall logs the full request messages and response to the llm_calls table.
-func (a *Actor) recordLLMCall(channelID int64, messages []openai.ChatCompletionMessageParamUnion, resp llm.Response) {
+// recordLLMCall logs the full request messages and response to the llm_calls
+// table. llmModel is the model the call used, which a channel override may
+// have changed from the persona's. runID is the run making the call, or ""
+// outside a run.
+func (a *Actor) recordLLMCall(runID string, channelID int64, llmModel string, messages []openai.ChatCompletionMessageParamUnion, resp llm.Response, start time.Time, duration time.Duration) {
 	messagesJSON, err := json.Marshal(messages)
 	if err != nil {
 		slog.Error("actor: marshal messages", "persona", a.Persona.Name, "error", err)
@@ -291,9 +528,10 @@ func (a *Actor) recordLLMCall(channelID int64, messages []openai.ChatCompletionM
 	}
 
 	res, err := a.DB.WriteExec(
-		`INSERT INTO llm_calls (persona_id, channel_id, model, messages_json, response_json, prompt_tokens, completion_tokens)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		a.Persona.ID, channelID, a.Persona.Model, string(messagesJSON), string(responseJSON), resp.PromptTokens, resp.CompletionTokens,
+		`INSERT INTO llm_calls (persona_id, persona_version, run_id, channel_id, model, messages_json, response_json, prompt_tokens, completion_tokens, started_at, duration_ms)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.Persona.ID, a.Persona.Version, nullRunID(runID), channelID, llmModel, string(messagesJSON), string(responseJSON), resp.PromptTokens, resp.CompletionTokens,
+		start.UTC(), duration.Milliseconds(),
 	)
 	if err != nil {
 		slog.Error("actor: record llm call", "persona", a.Persona.Name, "error", err)
@@ -306,23 +544,28 @@ func (a *Actor) recordLLMCall(channelID int64, messages []openai.ChatCompletionM
 		Data: map[string]any{
 			"id":                id,
 			"persona_id":        a.Persona.ID,
+			"persona_version":   a.Persona.Version,
+			"run_id":            runID,
 			"channel_id":        channelID,
-			"model":             a.Persona.Model,
+			"model":             llmModel,
 			"messages_json":     string(messagesJSON),
 			"response_json":     string(responseJSON),
 			"prompt_tokens":     resp.PromptTokens,
 			"completion_tokens": resp.CompletionTokens,
+			"duration_ms":       duration.Milliseconds(),
 			"created_at":        time.Now().UTC().Format(time.RFC3339),
 		},
 	})
 }
 
 // recordToolExecution logs a tool invocation to the tool_executions table.
-func (a *Actor) recordToolExecution(toolName, argsJSON, output, errText string, duration time.Duration) {
+// cancelled marks a call cut short by its run being cancelled.
+func (a *Actor) recordToolExecution(runID string, channelID int64, toolName, argsJSON, output, errText string, start time.Time, duration time.Duration, cancelled bool) {
+	observeToolExecution(toolName, errText, duration, cancelled)
 	res, err := a.DB.WriteExec(
-		`INSERT INTO tool_executions (persona_id, tool_name, args_json, output_text, error_text, duration_ms)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		a.Persona.ID, toolName, argsJSON, output, errText, duration.Milliseconds(),
+		`INSERT INTO tool_executions (persona_id, persona_version, run_id, channel_id, tool_name, args_json, output_text, error_text, duration_ms, cancelled, started_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.Persona.ID, a.Persona.Version, nullRunID(runID), channelID, toolName, argsJSON, output, errText, duration.Milliseconds(), cancelled, start.UTC(),
 	)
 	if err != nil {
 		slog.Error("actor: record tool execution", "persona", a.Persona.Name, "tool", toolName, "error", err)
@@ -333,27 +576,37 @@ func (a *Actor) recordToolExecution(toolName, argsJSON, output, errText string,
 	a.Hub.Broadcast(ws.Event{
 		Type: "agent_tool_execution",
 		Data: map[string]any{
-			"id":          id,
-			"persona_id":  a.Persona.ID,
-			"tool_name":   toolName,
-			"args_json":   argsJSON,
-			"output_text": output,
-			"error_text":  errText,
-			"duration_ms": duration.Milliseconds(),
-			"created_at":  time.Now().UTC().Format(time.RFC3339),
+			"id":              id,
+			"persona_id":      a.Persona.ID,
+			"persona_version": a.Persona.Version,
+			"run_id":          runID,
+			"channel_id":      channelID,
+			"tool_name":       toolName,
+			"args_json":       argsJSON,
+			"output_text":     output,
+			"error_text":      errText,
+			"duration_ms":     duration.Milliseconds(),
+			"cancelled":       cancelled,
+			"created_at":      time.Now().UTC().Format(time.RFC3339),
 		},
 	})
 }
 
+// nullRunID stores calls made outside a run with a NULL run_id.
+func nullRunID(runID string) sql.NullString {
+	return sql.NullString{String: runID, Valid: runID != ""}
+}
+
 // broadcastStatus sends an agent_status event via the WebSocket hub.
 func (a *Actor) broadcastStatus(channelID int64, status Status) {
 	a.Hub.Broadcast(ws.Event{
 		Type: "agent_status",
 		Data: map[string]any{
-			"persona_id":   a.Persona.ID,
-			"persona_name": a.Persona.Name,
-			"channel_id":   channelID,
-			"status":       status.String(),
+			"persona_id":     a.Persona.ID,
+			"persona_name":   a.Persona.Name,
+			"channel_id":     channelID,
+			"status":         status.String(),
+			"persona_status": a.Status.Get(a.Persona.ID).String(),
 		},
 	})
 }
@@ -368,6 +621,7 @@ func (a *Actor) broadcastContextBudget(channelID int64, budget ContextBudget) {
 			"total_tokens":     budget.TotalTokens,
 			"system_tokens":    budget.SystemTokens,
 			"project_tokens":   budget.ProjectTokens,
+			"memory_tokens":    budget.MemoryTokens,
 			"history_tokens":   budget.HistoryTokens,
 			"history_messages": budget.HistoryMessages,
 			"exhausted":        budget.Exhausted,
@@ -3,6 +3,9 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -102,6 +105,7 @@ func newScenario(t *testing.T) *scenario {
 		Cursors:  NewCursorStore(d),
 		Decision: NewDecisionMaker(),
 		Budget:   NewBudgetChecker(d),
+		Runs:     NewRunRegistry(),
 	}
 
 	t.Cleanup(func() {
@@ -128,9 +132,19 @@ func (s *scenario) postHumanMessage(content string) model.Message {
 	return msg
 }
 
+// runOnce dispatches the actor's channel and task workers as Run does, then
+// lets each finish the run it was woken for and waits for them to exit.
 func (s *scenario) runOnce(ctx context.Context) {
 	s.t.Helper()
-	s.actor.processChannels(ctx)
+	pool := newWorkerPool(s.actor.MaxConcurrentChannels)
+	s.actor.dispatch(ctx, pool)
+	pool.mu.Lock()
+	for key, w := range pool.workers {
+		close(w.wake)
+		delete(pool.workers, key)
+	}
+	pool.mu.Unlock()
+	pool.wait()
 }
 
 func TestActorNormalResponse(t *testing.T) {
@@ -204,6 +218,104 @@ func TestActorToolCallLoop(t *testing.T) {
 	}
 }
 
+// The tool result goes back to the model as the content of a tool message
+// answering the call's ID, not the other way round.
+func TestActorSendsToolResultForCallID(t *testing.T) {
+	s := newScenario(t)
+	s.mock.responses = []llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "shell_exec", Arguments: `{"command":"ls"}`}}},
+		{Content: "Done!"},
+	}
+
+	s.postHumanMessage("Run ls please")
+	s.runOnce(context.Background())
+
+	msgs := s.mock.getLastMessages()
+	tool := msgs[len(msgs)-1].OfTool
+	if tool == nil {
+		t.Fatalf("last message sent is not a tool result: %+v", msgs[len(msgs)-1])
+	}
+	if tool.ToolCallID != "call_1" || tool.Content.OfString.Value == "call_1" {
+		t.Errorf("tool message = %+v, want the result answering call_1", tool)
+	}
+}
+
+func TestActorRecordsPersonaVersion(t *testing.T) {
+	s := newScenario(t)
+	s.mock.responses = []llm.Response{
+		{
+			ToolCalls:    []llm.ToolCall{{ID: "call_1", Name: "shell_exec", Arguments: `{"command":"ls"}`}},
+			PromptTokens: 10, CompletionTokens: 5,
+		},
+		{Content: "Done!", PromptTokens: 15, CompletionTokens: 8},
+	}
+	s.actor.Persona.Version = 4
+
+	s.postHumanMessage("Run ls please")
+	s.runOnce(context.Background())
+
+	calls, err := model.ListLLMCalls(s.actor.DB, s.persona.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("list llm calls: %v", err)
+	}
+	if len(calls) != 2 || calls[0].PersonaVersion != 4 || calls[1].PersonaVersion != 4 {
+		t.Errorf("llm calls = %+v, want 2 at version 4", calls)
+	}
+	execs, err := model.ListToolExecutions(s.actor.DB, s.persona.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("list tool executions: %v", err)
+	}
+	if len(execs) != 1 || execs[0].PersonaVersion != 4 {
+		t.Errorf("tool executions = %+v, want 1 at version 4", execs)
+	}
+}
+
+func TestActorAppliesChannelSettings(t *testing.T) {
+	s := newScenario(t)
+	override := "terse-model"
+	if err := model.SetPersonaChannelSettings(s.actor.DB, model.PersonaChannelSettings{
+		PersonaID:   s.persona.ID,
+		ChannelID:   s.channel.ID,
+		Model:       &override,
+		ExtraPrompt: "Answer in one line.",
+	}); err != nil {
+		t.Fatalf("set channel settings: %v", err)
+	}
+
+	s.postHumanMessage("Hi bot")
+	s.runOnce(context.Background())
+
+	if s.mock.callCount() != 1 {
+		t.Fatalf("expected 1 LLM call, got %d", s.mock.callCount())
+	}
+	sys, _ := json.Marshal(s.mock.getLastMessages()[0])
+	if !strings.Contains(string(sys), "You are a test bot.") || !strings.Contains(string(sys), "Answer in one line.") {
+		t.Errorf("system prompt = %s, want persona prompt plus channel extra prompt", sys)
+	}
+	calls, _ := model.ListLLMCalls(s.actor.DB, s.persona.ID, 10, 0)
+	if len(calls) != 1 || calls[0].Model != "terse-model" {
+		t.Errorf("llm calls = %+v, want one using the channel's model", calls)
+	}
+}
+
+func TestActorReplyModeNeverStaysSilent(t *testing.T) {
+	s := newScenario(t)
+	model.SetPersonaChannelSettings(s.actor.DB, model.PersonaChannelSettings{
+		PersonaID: s.persona.ID, ChannelID: s.channel.ID, ReplyMode: model.ReplyNever,
+	})
+
+	s.postHumanMessage("Hi @testbot")
+	s.runOnce(context.Background())
+
+	if s.mock.callCount() != 0 {
+		t.Errorf("expected no LLM calls, got %d", s.mock.callCount())
+	}
+	cursor, _ := s.actor.Cursors.Get(s.persona.ID, s.channel.ID)
+	if cursor == 0 {
+		t.Error("expected cursor to advance past the ignored message")
+	}
+}
+
 func TestActorBudgetExceeded(t *testing.T) {
 	s := newScenario(t)
 	// Set a budget limit and exhaust it.
@@ -228,6 +340,19 @@ func TestActorBudgetExceeded(t *testing.T) {
 	if s.actor.Status.Get(s.persona.ID) != StatusBudgetExceeded {
 		t.Errorf("expected status budget_exceeded, got %s", s.actor.Status.Get(s.persona.ID))
 	}
+
+	// The job waits for budget without using up its attempts.
+	s.actor.MaxJobAttempts = 1
+	jobs := channelJobs(t, s)
+	if len(jobs) != 1 || jobs[0].Status != model.JobFailed || jobs[0].Attempts != 0 ||
+		jobs[0].NextAttemptAt == nil || time.Until(*jobs[0].NextAttemptAt) < BudgetRetryDelay/2 {
+		t.Fatalf("over-budget job = %+v", jobs)
+	}
+	s.actor.DB.WriteExec("UPDATE agent_jobs SET next_attempt_at = ?", time.Now().Add(-time.Second).UTC())
+	s.runOnce(context.Background())
+	if jobs := channelJobs(t, s); jobs[0].Status != model.JobFailed || jobs[0].Attempts != 0 {
+		t.Errorf("job after a second over-budget pass = %+v", jobs[0])
+	}
 }
 
 func TestActorSkipsSelfMessages(t *testing.T) {
@@ -263,6 +388,9 @@ func TestActorMaxToolRounds(t *testing.T) {
 	if s.mock.callCount() != maxToolRounds {
 		t.Errorf("expected %d LLM calls (max rounds), got %d", maxToolRounds, s.mock.callCount())
 	}
+	if jobs := channelJobs(t, s); len(jobs) != 1 || jobs[0].Status != model.JobDead {
+		t.Errorf("jobs = %+v, want the job dead rather than retried", jobs)
+	}
 }
 
 func TestActorRunStopsOnCancel(t *testing.T) {
@@ -459,3 +587,129 @@ func TestActorContextFullToIdleViaReset(t *testing.T) {
 		t.Errorf("expected status idle after reset, got %s", s.actor.Status.Get(s.persona.ID))
 	}
 }
+
+func TestActorWorktreeModeUsesPersonaWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	s := newScenario(t)
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	proj, err := model.CreateProject(s.actor.DB, "repo", repo, "")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if err := model.SetChannelProject(s.actor.DB, s.channel.ID, proj.ID); err != nil {
+		t.Fatalf("set channel project: %v", err)
+	}
+	s.actor.Worktrees = tools.NewWorktrees(t.TempDir())
+
+	var capturedDir string
+	s.actor.Tools.Register("check_context", func(ctx context.Context, _ json.RawMessage) (string, error) {
+		capturedDir = tools.ProjectDirFromContext(ctx)
+		return "ok", nil
+	})
+	s.mock.responses = []llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "call_ctx", Name: "check_context", Arguments: `{}`}}},
+		{Content: "Done!"},
+	}
+
+	s.postHumanMessage("Check context")
+	s.runOnce(context.Background())
+
+	want, _ := filepath.Abs(s.actor.Worktrees.Path(proj.ID, s.persona.ID))
+	if capturedDir != want {
+		t.Errorf("expected worktree dir %q, got %q", want, capturedDir)
+	}
+}
+
+func TestActorStageChangesProposesChangeset(t *testing.T) {
+	s := newScenario(t)
+
+	projectDir := t.TempDir()
+	proj, err := model.CreateProject(s.actor.DB, "staged", projectDir, "")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if err := model.SetChannelProject(s.actor.DB, s.channel.ID, proj.ID); err != nil {
+		t.Fatalf("set channel project: %v", err)
+	}
+	s.actor.StageChanges = true
+	s.actor.Tools.Register("file_write", tools.FileWrite(""))
+
+	s.mock.responses = []llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "call_w", Name: "file_write", Arguments: `{"path":"notes.txt","content":"hi\n"}`}}},
+		{Content: "Wrote notes."},
+	}
+
+	s.postHumanMessage("Write notes")
+	s.runOnce(context.Background())
+
+	if _, err := os.Stat(filepath.Join(projectDir, "notes.txt")); !os.IsNotExist(err) {
+		t.Fatal("expected staged write to stay off disk")
+	}
+
+	changesets, err := model.ListChangesets(s.actor.DB, s.channel.ID, model.ChangesetPending)
+	if err != nil || len(changesets) != 1 {
+		t.Fatalf("pending changesets = %d, %v", len(changesets), err)
+	}
+	cs, _ := model.GetChangeset(s.actor.DB, changesets[0].ID)
+	if len(cs.Files) != 1 || cs.Files[0].Path != "notes.txt" || cs.Files[0].NewContent != "hi\n" {
+		t.Fatalf("unexpected changeset files: %+v", cs.Files)
+	}
+
+	msgs, _ := model.GetRecentMessages(s.actor.DB, s.channel.ID, 1)
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Content, "+hi") {
+		t.Errorf("expected review message with diff, got %+v", msgs)
+	}
+}
+
+func TestActorJournalsFileWrites(t *testing.T) {
+	s := newScenario(t)
+
+	projectDir := t.TempDir()
+	proj, err := model.CreateProject(s.actor.DB, "journaled", projectDir, "")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if err := model.SetChannelProject(s.actor.DB, s.channel.ID, proj.ID); err != nil {
+		t.Fatalf("set channel project: %v", err)
+	}
+	s.actor.Tools.Register("file_write", tools.FileWrite(""))
+
+	s.mock.responses = []llm.Response{
+		{ToolCalls: []llm.ToolCall{
+			{ID: "call_1", Name: "file_write", Arguments: `{"path":"a.txt","content":"one"}`},
+			{ID: "call_2", Name: "file_write", Arguments: `{"path":"a.txt","content":"two"}`},
+		}},
+		{Content: "Done."},
+	}
+
+	s.postHumanMessage("Write a.txt")
+	s.runOnce(context.Background())
+
+	changes, err := model.ListFileChanges(s.actor.DB, proj.ID, model.FileChangeFilter{})
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("journal entries = %d, %v", len(changes), err)
+	}
+	if changes[0].RunID == "" || changes[0].RunID != changes[1].RunID {
+		t.Errorf("expected both writes in one run, got %q and %q", changes[0].RunID, changes[1].RunID)
+	}
+	first := changes[1]
+	if first.Path != "a.txt" || first.Existed || first.AfterContent != "one" || first.PersonaID != s.persona.ID || first.ChannelID != s.channel.ID {
+		t.Errorf("unexpected first entry: %+v", first)
+	}
+	if changes[0].BeforeContent != "one" || changes[0].AfterContent != "two" {
+		t.Errorf("unexpected second entry: %+v", changes[0])
+	}
+}
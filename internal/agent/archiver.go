@@ -5,29 +5,69 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
 )
 
 const (
-	maxEventsPerAgent = 10_000
-	purgeInterval     = 5 * time.Minute
+	// DefaultMaxEventsPerAgent is how many rows of each archived table a
+	// persona keeps when Archiver.MaxEvents is zero.
+	DefaultMaxEventsPerAgent = 10_000
+	purgeInterval            = 5 * time.Minute
 )
 
+// archivedTables maps each table the archiver purges to the SQL expression
+// for a row's size in bytes, for Archiver.MaxBytes.
+var archivedTables = map[string]string{
+	"llm_calls":       "length(messages_json) + length(response_json)",
+	"tool_executions": "length(args_json) + COALESCE(length(output_text), 0) + COALESCE(length(error_text), 0)",
+}
+
+// IsArchivedTable reports whether the archiver purges table.
+func IsArchivedTable(table string) bool {
+	_, ok := archivedTables[table]
+	return ok
+}
+
 // Archiver purges old llm_calls and tool_executions rows, compressing them to
-// gzip archives on disk before deletion.
+// gzip archives on disk before deletion, and keeps an index of the archives
+// in the archives table. A persona's rows are archived once they are beyond
+// any of the retention limits; rows restored from an archive are exempt.
 type Archiver struct {
 	DB         *db.DB
 	ArchiveDir string
+
+	// MaxEvents is how many of its newest rows in each table a persona
+	// keeps; zero means DefaultMaxEventsPerAgent and a negative value no
+	// limit.
+	MaxEvents int
+	// MaxAge, when positive, archives rows older than this.
+	MaxAge time.Duration
+	// MaxBytes, when positive, bounds the size of the rows a persona keeps
+	// in each table, counting the newest first.
+	MaxBytes int64
 }
 
-// Run starts the purge loop. It blocks until ctx is cancelled.
+// Run indexes archives written before the index existed, then starts the
+// purge loop. It blocks until ctx is cancelled.
 func (a *Archiver) Run(ctx context.Context) {
+	if n, err := a.IndexExisting(); err != nil {
+		slog.Error("archiver: index existing archives", "error", err)
+	} else if n > 0 {
+		slog.Info("archiver: indexed existing archives", "count", n)
+	}
+
 	ticker := time.NewTicker(purgeInterval)
 	defer ticker.Stop()
 
@@ -42,33 +82,23 @@ func (a *Archiver) Run(ctx context.Context) {
 }
 
 func (a *Archiver) purgeAll() {
-	personaIDs, err := a.personaIDsWithExcess("llm_calls")
-	if err != nil {
-		slog.Error("archiver: list personas for llm_calls", "error", err)
-	}
-	for _, pid := range personaIDs {
-		if err := a.purgeTable(pid, "llm_calls"); err != nil {
-			slog.Error("archiver: purge llm_calls", "persona_id", pid, "error", err)
+	for _, table := range []string{"llm_calls", "tool_executions"} {
+		personaIDs, err := a.personaIDs(table)
+		if err != nil {
+			slog.Error("archiver: list personas", "table", table, "error", err)
+			continue
 		}
-	}
-
-	personaIDs, err = a.personaIDsWithExcess("tool_executions")
-	if err != nil {
-		slog.Error("archiver: list personas for tool_executions", "error", err)
-	}
-	for _, pid := range personaIDs {
-		if err := a.purgeTable(pid, "tool_executions"); err != nil {
-			slog.Error("archiver: purge tool_executions", "persona_id", pid, "error", err)
+		for _, pid := range personaIDs {
+			if err := a.purgeTable(pid, table); err != nil {
+				slog.Error("archiver: purge", "table", table, "persona_id", pid, "error", err)
+			}
 		}
 	}
 }
 
-// personaIDsWithExcess returns persona IDs that have more than maxEventsPerAgent rows.
-func (a *Archiver) personaIDsWithExcess(table string) ([]int64, error) {
-	query := fmt.Sprintf(
-		`SELECT persona_id FROM %s GROUP BY persona_id HAVING COUNT(*) > ?`, table,
-	)
-	rows, err := a.DB.SQL.Query(query, maxEventsPerAgent)
+// personaIDs returns the personas with rows in table.
+func (a *Archiver) personaIDs(table string) ([]int64, error) {
+	rows, err := a.DB.SQL.Query(fmt.Sprintf(`SELECT DISTINCT persona_id FROM %s`, table))
 	if err != nil {
 		return nil, err
 	}
@@ -85,31 +115,79 @@ func (a *Archiver) personaIDsWithExcess(table string) ([]int64, error) {
 	return ids, rows.Err()
 }
 
-// purgeTable archives and deletes excess rows for a single persona in a single table.
-func (a *Archiver) purgeTable(personaID int64, table string) error {
-	// Find the cutoff ID: keep the newest maxEventsPerAgent rows.
-	var cutoffID int64
-	query := fmt.Sprintf(
-		`SELECT id FROM %s WHERE persona_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?`, table,
-	)
-	err := a.DB.SQL.QueryRow(query, personaID, maxEventsPerAgent).Scan(&cutoffID)
-	if err == sql.ErrNoRows {
-		return nil
+// cutoff returns the highest row ID of a persona's rows in table that are
+// beyond a retention limit, or 0 when none are. Restored rows neither count
+// towards the limits nor are archived again.
+func (a *Archiver) cutoff(personaID int64, table string) (int64, error) {
+	var cutoff int64
+	raise := func(id int64) {
+		cutoff = max(cutoff, id)
 	}
-	if err != nil {
-		return fmt.Errorf("find cutoff: %w", err)
+
+	maxEvents := a.MaxEvents
+	if maxEvents == 0 {
+		maxEvents = DefaultMaxEventsPerAgent
+	}
+	if maxEvents > 0 {
+		var id int64
+		err := a.DB.SQL.QueryRow(
+			fmt.Sprintf(`SELECT id FROM %s WHERE persona_id = ? AND restored_at IS NULL ORDER BY id DESC LIMIT 1 OFFSET ?`, table),
+			personaID, maxEvents,
+		).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, fmt.Errorf("count cutoff: %w", err)
+		}
+		raise(id)
+	}
+
+	if a.MaxAge > 0 {
+		// created_at defaults to CURRENT_TIMESTAMP, so compare in its format.
+		before := time.Now().UTC().Add(-a.MaxAge).Format(time.DateTime)
+		var id int64
+		err := a.DB.SQL.QueryRow(
+			fmt.Sprintf(`SELECT COALESCE(MAX(id), 0) FROM %s WHERE persona_id = ? AND restored_at IS NULL AND created_at < ?`, table),
+			personaID, before,
+		).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("age cutoff: %w", err)
+		}
+		raise(id)
+	}
+
+	if a.MaxBytes > 0 {
+		var id int64
+		err := a.DB.SQL.QueryRow(
+			fmt.Sprintf(`SELECT COALESCE(MAX(id), 0) FROM (
+				SELECT id, SUM(%s) OVER (ORDER BY id DESC) AS kept FROM %s WHERE persona_id = ? AND restored_at IS NULL
+			) WHERE kept > ?`, archivedTables[table], table),
+			personaID, a.MaxBytes,
+		).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("size cutoff: %w", err)
+		}
+		raise(id)
+	}
+	return cutoff, nil
+}
+
+// purgeTable archives and deletes a single persona's rows in a single table
+// that are beyond the retention limits.
+func (a *Archiver) purgeTable(personaID int64, table string) error {
+	cutoffID, err := a.cutoff(personaID, table)
+	if err != nil || cutoffID == 0 {
+		return err
 	}
 
 	// Read rows to archive.
 	selectQuery := fmt.Sprintf(
-		`SELECT * FROM %s WHERE persona_id = ? AND id <= ? ORDER BY id`, table,
+		`SELECT * FROM %s WHERE persona_id = ? AND id <= ? AND restored_at IS NULL ORDER BY id`, table,
 	)
 	rows, err := a.DB.SQL.Query(selectQuery, personaID, cutoffID)
 	if err != nil {
 		return fmt.Errorf("select rows: %w", err)
 	}
 
-	archivePath, err := a.writeArchive(rows, table, personaID)
+	archive, err := a.writeArchive(rows, table, personaID)
 	rows.Close()
 	if err != nil {
 		return fmt.Errorf("write archive: %w", err)
@@ -117,43 +195,56 @@ func (a *Archiver) purgeTable(personaID int64, table string) error {
 
 	// Delete archived rows inside the write mutex.
 	deleteQuery := fmt.Sprintf(
-		`DELETE FROM %s WHERE persona_id = ? AND id <= ?`, table,
+		`DELETE FROM %s WHERE persona_id = ? AND id <= ? AND restored_at IS NULL`, table,
 	)
 	result, err := a.DB.WriteExec(deleteQuery, personaID, cutoffID)
 	if err != nil {
 		return fmt.Errorf("delete archived rows: %w", err)
 	}
 
+	// An archive left out of the index is picked up by IndexExisting on the
+	// next start.
+	if _, err := model.CreateArchive(a.DB, archive); err != nil {
+		return fmt.Errorf("index archive %s: %w", archive.File, err)
+	}
+
 	deleted, _ := result.RowsAffected()
-	slog.Info("archiver: purged rows", "table", table, "persona_id", personaID, "deleted", deleted, "archive", archivePath)
+	slog.Info("archiver: purged rows", "table", table, "persona_id", personaID, "deleted", deleted, "archive", archive.File)
 	return nil
 }
 
-// writeArchive writes rows as jsonl.gz and returns the archive path.
-func (a *Archiver) writeArchive(rows *sql.Rows, table string, personaID int64) (string, error) {
+// writeArchive writes rows as jsonl.gz and returns its index entry.
+func (a *Archiver) writeArchive(rows *sql.Rows, table string, personaID int64) (model.Archive, error) {
 	if err := os.MkdirAll(a.ArchiveDir, 0o755); err != nil {
-		return "", fmt.Errorf("create archive dir: %w", err)
+		return model.Archive{}, fmt.Errorf("create archive dir: %w", err)
 	}
 
+	// Never overwrite an archive written earlier in the same second.
 	ts := time.Now().UTC().Format("20060102T150405Z")
 	filename := fmt.Sprintf("%s_%d_%s.jsonl.gz", table, personaID, ts)
 	path := filepath.Join(a.ArchiveDir, filename)
-
-	f, err := os.Create(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	for n := 2; errors.Is(err, os.ErrExist); n++ {
+		filename = fmt.Sprintf("%s_%d_%s-%d.jsonl.gz", table, personaID, ts, n)
+		path = filepath.Join(a.ArchiveDir, filename)
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	}
 	if err != nil {
-		return "", fmt.Errorf("create file: %w", err)
+		return model.Archive{}, fmt.Errorf("create file: %w", err)
+	}
+	fail := func(err error) (model.Archive, error) {
+		f.Close()
+		os.Remove(path)
+		return model.Archive{}, err
 	}
-	defer f.Close()
 
 	gz := gzip.NewWriter(f)
-	defer gz.Close()
-
 	enc := json.NewEncoder(gz)
+	archive := model.Archive{PersonaID: personaID, TableName: table, File: filename}
 
 	cols, err := rows.Columns()
 	if err != nil {
-		os.Remove(path)
-		return "", fmt.Errorf("get columns: %w", err)
+		return fail(fmt.Errorf("get columns: %w", err))
 	}
 
 	for rows.Next() {
@@ -164,8 +255,7 @@ func (a *Archiver) writeArchive(rows *sql.Rows, table string, personaID int64) (
 		}
 
 		if err := rows.Scan(ptrs...); err != nil {
-			os.Remove(path)
-			return "", fmt.Errorf("scan row: %w", err)
+			return fail(fmt.Errorf("scan row: %w", err))
 		}
 
 		row := make(map[string]any, len(cols))
@@ -174,15 +264,338 @@ func (a *Archiver) writeArchive(rows *sql.Rows, table string, personaID int64) (
 		}
 
 		if err := enc.Encode(row); err != nil {
-			os.Remove(path)
-			return "", fmt.Errorf("encode row: %w", err)
+			return fail(fmt.Errorf("encode row: %w", err))
 		}
+		indexRow(&archive, row)
 	}
 
 	if err := rows.Err(); err != nil {
+		return fail(fmt.Errorf("rows iteration: %w", err))
+	}
+	if err := gz.Close(); err != nil {
+		return fail(fmt.Errorf("close gzip: %w", err))
+	}
+	if err := f.Close(); err != nil {
 		os.Remove(path)
-		return "", fmt.Errorf("rows iteration: %w", err)
+		return model.Archive{}, fmt.Errorf("close file: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		archive.SizeBytes = info.Size()
+	}
+	return archive, nil
+}
+
+// archiveName matches the files writeArchive creates.
+var archiveName = regexp.MustCompile(`^([a-z_]+)_(\d+)_\d{8}T\d{6}Z(-\d+)?\.jsonl\.gz$`)
+
+// IndexExisting adds archives in ArchiveDir that are not in the index yet,
+// such as those written before the index existed, and returns how many it
+// added.
+func (a *Archiver) IndexExisting() (int, error) {
+	entries, err := os.ReadDir(a.ArchiveDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, e := range entries {
+		m := archiveName.FindStringSubmatch(e.Name())
+		if m == nil || !IsArchivedTable(m[1]) {
+			continue
+		}
+		if _, err := model.GetArchiveByFile(a.DB, e.Name()); err == nil {
+			continue
+		} else if err != sql.ErrNoRows {
+			return added, err
+		}
+
+		personaID, _ := strconv.ParseInt(m[2], 10, 64)
+		archive := model.Archive{PersonaID: personaID, TableName: m[1], File: e.Name()}
+		err := readArchive(filepath.Join(a.ArchiveDir, e.Name()), func(row map[string]any) bool {
+			indexRow(&archive, row)
+			return true
+		})
+		if err != nil {
+			slog.Error("archiver: read archive", "file", e.Name(), "error", err)
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			archive.SizeBytes = info.Size()
+		}
+		if _, err := model.CreateArchive(a.DB, archive); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, nil
+}
+
+// ArchivedRow is one row read back from an archive. Numbers in Row are
+// json.Number and times RFC 3339 strings.
+type ArchivedRow struct {
+	ArchiveID int64
+	TableName string
+	Row       map[string]any
+}
+
+// ArchiveQuery selects rows within archives. Text matches any string value
+// of a row, case-insensitively; Since and Until bound its created_at.
+type ArchiveQuery struct {
+	model.ArchiveFilter
+	Text   string
+	Limit  int
+	Offset int
+}
+
+// Rows returns the rows in archive matching q, in ID order.
+func (a *Archiver) Rows(archive model.Archive, q ArchiveQuery) ([]ArchivedRow, error) {
+	out := []ArchivedRow{}
+	skip := q.Offset
+	err := readArchive(filepath.Join(a.ArchiveDir, archive.File), func(row map[string]any) bool {
+		if !q.matches(row) {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		out = append(out, ArchivedRow{ArchiveID: archive.ID, TableName: archive.TableName, Row: row})
+		return q.Limit <= 0 || len(out) < q.Limit
+	})
+	return out, err
+}
+
+// Search returns the rows matching q across every archive that could hold
+// them, oldest archive first.
+func (a *Archiver) Search(q ArchiveQuery) ([]ArchivedRow, error) {
+	archives, err := model.ListArchives(a.DB, q.ArchiveFilter)
+	if err != nil {
+		return nil, err
+	}
+	out := []ArchivedRow{}
+	for _, archive := range archives {
+		page := q
+		page.Limit = 0
+		if q.Limit > 0 {
+			page.Limit = q.Offset + q.Limit - len(out)
+		}
+		page.Offset = 0
+		rows, err := a.Rows(archive, page)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", archive.File, err)
+		}
+		for _, r := range rows {
+			if q.Offset > 0 {
+				q.Offset--
+				continue
+			}
+			out = append(out, r)
+		}
+		if q.Limit > 0 && len(out) >= q.Limit {
+			return out[:q.Limit], nil
+		}
+	}
+	return out, nil
+}
+
+// Restore re-imports an archive's rows into their table, keeping their IDs,
+// then removes the archive from the index and the disk. Rows whose ID is
+// already taken are skipped. It returns how many rows were restored.
+// Restored rows are marked with restored_at and kept: retention neither
+// counts nor archives them again.
+func (a *Archiver) Restore(archive model.Archive) (int, error) {
+	if !IsArchivedTable(archive.TableName) {
+		return 0, fmt.Errorf("unknown table %q", archive.TableName)
+	}
+	columns, err := a.tableColumns(archive.TableName)
+	if err != nil {
+		return 0, fmt.Errorf("table columns: %w", err)
+	}
+
+	var rows []map[string]any
+	err = readArchive(filepath.Join(a.ArchiveDir, archive.File), func(row map[string]any) bool {
+		rows = append(rows, row)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	now := time.Now().UTC()
+	err = a.DB.WriteTx(func(tx *sql.Tx) error {
+		for _, row := range rows {
+			names, marks, args := []string{"restored_at"}, []string{"?"}, []any{now}
+			for name, typ := range columns {
+				v, ok := row[name]
+				if !ok || name == "restored_at" {
+					continue
+				}
+				names = append(names, name)
+				marks = append(marks, "?")
+				args = append(args, restoreValue(v, typ))
+			}
+			res, err := tx.Exec(fmt.Sprintf(`INSERT OR IGNORE INTO %s (%s) VALUES (%s)`,
+				archive.TableName, strings.Join(names, ", "), strings.Join(marks, ", ")), args...)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			restored += int(n)
+		}
+		_, err := tx.Exec("DELETE FROM archives WHERE id = ?", archive.ID)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("restore rows: %w", err)
+	}
+
+	if err := os.Remove(filepath.Join(a.ArchiveDir, archive.File)); err != nil {
+		slog.Error("archiver: remove restored archive", "file", archive.File, "error", err)
+	}
+	slog.Info("archiver: restored archive", "table", archive.TableName, "persona_id", archive.PersonaID, "restored", restored, "archive", archive.File)
+	return restored, nil
+}
+
+// tableColumns returns table's column names and declared types.
+func (a *Archiver) tableColumns(table string) (map[string]string, error) {
+	rows, err := a.DB.SQL.Query(fmt.Sprintf(`SELECT name, type FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		columns[name] = strings.ToUpper(typ)
 	}
+	return columns, rows.Err()
+}
 
-	return path, nil
+// restoreValue converts a value read back from an archive for a column of
+// type typ.
+func restoreValue(v any, typ string) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case string:
+		if typ == "DATETIME" {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t.UTC()
+			}
+		}
+	}
+	return v
+}
+
+// readArchive calls fn with each row of the archive at path until fn returns
+// false.
+func readArchive(path string, fn func(row map[string]any) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	dec.UseNumber()
+	for {
+		var row map[string]any
+		if err := dec.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !fn(row) {
+			return nil
+		}
+	}
+}
+
+func (q ArchiveQuery) matches(row map[string]any) bool {
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		at := rowTime(row["created_at"])
+		if !q.Since.IsZero() && at.Before(q.Since) {
+			return false
+		}
+		if !q.Until.IsZero() && !at.Before(q.Until) {
+			return false
+		}
+	}
+	if q.Text == "" {
+		return true
+	}
+	text := strings.ToLower(q.Text)
+	for _, v := range row {
+		if s, ok := v.(string); ok && strings.Contains(strings.ToLower(s), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexRow widens an archive's row count, ID range and time range to cover
+// row, as written by writeArchive or read back by readArchive.
+func indexRow(a *model.Archive, row map[string]any) {
+	id := rowID(row["id"])
+	at := rowTime(row["created_at"])
+	if a.RowCount == 0 || id < a.MinRowID {
+		a.MinRowID = id
+	}
+	if id > a.MaxRowID {
+		a.MaxRowID = id
+	}
+	if !at.IsZero() && (a.FirstAt.IsZero() || at.Before(a.FirstAt)) {
+		a.FirstAt = at
+	}
+	if at.After(a.LastAt) {
+		a.LastAt = at
+	}
+	a.RowCount++
+}
+
+// rowID reads an id value, as scanned from the database or read back from
+// an archive.
+func rowID(v any) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	}
+	return 0
+}
+
+// rowTime reads a created_at value, as scanned from the database or read
+// back from an archive.
+func rowTime(v any) time.Time {
+	switch v := v.(type) {
+	case time.Time:
+		return v
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, time.DateTime} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
 }
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func seedLLMCall(t *testing.T, d *db.DB, personaID int64, messages string, at time.Time) {
+	t.Helper()
+	_, err := d.WriteExec(
+		`INSERT INTO llm_calls (persona_id, channel_id, model, messages_json, response_json, created_at)
+		 VALUES (?, 1, 'm', ?, '{}', ?)`,
+		personaID, messages, at.UTC().Format(time.DateTime),
+	)
+	if err != nil {
+		t.Fatalf("seed llm call: %v", err)
+	}
+}
+
+func countRows(t *testing.T, d *db.DB, table string, personaID int64) int {
+	t.Helper()
+	var n int
+	d.SQL.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE persona_id = ?", personaID).Scan(&n)
+	return n
+}
+
+func TestArchiverIndexSearchRestore(t *testing.T) {
+	d := openTestDB(t)
+	a := &Archiver{DB: d, ArchiveDir: t.TempDir(), MaxEvents: 2}
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, msg := range []string{`["deploy the app"]`, `["fix the bug"]`, `["Deploy again"]`, `["lunch?"]`, `["ship it"]`} {
+		seedLLMCall(t, d, 1, msg, start.Add(time.Duration(i)*time.Minute))
+	}
+	seedLLMCall(t, d, 2, `["other persona"]`, start)
+
+	a.purgeAll()
+	if n := countRows(t, d, "llm_calls", 1); n != 2 {
+		t.Fatalf("persona 1 kept %d rows, want 2", n)
+	}
+	if n := countRows(t, d, "llm_calls", 2); n != 1 {
+		t.Errorf("persona 2 kept %d rows, want 1", n)
+	}
+
+	archives, err := model.ListArchives(d, model.ArchiveFilter{PersonaID: 1})
+	if err != nil || len(archives) != 1 {
+		t.Fatalf("ListArchives = %d, %v", len(archives), err)
+	}
+	arc := archives[0]
+	if arc.TableName != "llm_calls" || arc.RowCount != 3 || arc.MinRowID != 1 || arc.MaxRowID != 3 ||
+		!arc.FirstAt.Equal(start) || !arc.LastAt.Equal(start.Add(2*time.Minute)) || arc.SizeBytes == 0 {
+		t.Errorf("archive = %+v", arc)
+	}
+	if got, _ := model.ListArchives(d, model.ArchiveFilter{Since: start.Add(3 * time.Minute)}); len(got) != 0 {
+		t.Errorf("archives after their last row = %+v", got)
+	}
+
+	rows, err := a.Search(ArchiveQuery{Text: "deploy"})
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("Search(deploy) = %d, %v", len(rows), err)
+	}
+	if rows[0].ArchiveID != arc.ID || rows[0].Row["messages_json"] != `["deploy the app"]` || rows[1].Row["id"] != json.Number("3") {
+		t.Errorf("search rows = %+v", rows)
+	}
+	rows, _ = a.Rows(arc, ArchiveQuery{ArchiveFilter: model.ArchiveFilter{Since: start.Add(time.Minute)}, Limit: 1})
+	if len(rows) != 1 || rows[0].Row["id"] != json.Number("2") {
+		t.Errorf("rows since second = %+v", rows)
+	}
+	rows, _ = a.Search(ArchiveQuery{Text: "deploy", Offset: 1, Limit: 5})
+	if len(rows) != 1 || rows[0].Row["id"] != json.Number("3") {
+		t.Errorf("second page = %+v", rows)
+	}
+
+	n, err := a.Restore(arc)
+	if err != nil || n != 3 {
+		t.Fatalf("Restore = %d, %v", n, err)
+	}
+	calls, _ := model.ListLLMCalls(d, 1, 10, 0)
+	if len(calls) != 5 {
+		t.Fatalf("after restore persona 1 has %d calls, want 5", len(calls))
+	}
+	if c := calls[len(calls)-1]; c.ID != 1 || !c.CreatedAt.Equal(start) {
+		t.Errorf("restored call = %+v", c)
+	}
+	if got, _ := model.ListArchives(d, model.ArchiveFilter{}); len(got) != 0 {
+		t.Errorf("archive still indexed: %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(a.ArchiveDir, arc.File)); !os.IsNotExist(err) {
+		t.Errorf("archive file still there: %v", err)
+	}
+
+	// Restored rows are kept; retention only archives the others.
+	seedLLMCall(t, d, 1, `["one more"]`, start.Add(5*time.Minute))
+	a.purgeAll()
+	calls, _ = model.ListLLMCalls(d, 1, 10, 0)
+	ids := make([]int64, len(calls))
+	for i, c := range calls {
+		ids[i] = c.ID
+	}
+	if fmt.Sprint(ids) != "[7 5 3 2 1]" {
+		t.Errorf("after purging again persona 1 has calls %v, want [7 5 3 2 1]", ids)
+	}
+}
+
+func TestArchiverRetentionByAgeAndSize(t *testing.T) {
+	d := openTestDB(t)
+	a := &Archiver{DB: d, ArchiveDir: t.TempDir(), MaxEvents: -1, MaxAge: 24 * time.Hour}
+	now := time.Now()
+	seedLLMCall(t, d, 1, `["old"]`, now.Add(-72*time.Hour))
+	seedLLMCall(t, d, 1, `["older than a day"]`, now.Add(-25*time.Hour))
+	seedLLMCall(t, d, 1, `["recent"]`, now.Add(-time.Hour))
+
+	a.purgeAll()
+	if n := countRows(t, d, "llm_calls", 1); n != 1 {
+		t.Fatalf("age retention kept %d rows, want 1", n)
+	}
+
+	// Each row is 100 bytes of messages plus 2 of response.
+	a = &Archiver{DB: d, ArchiveDir: a.ArchiveDir, MaxEvents: -1, MaxBytes: 250}
+	for range 4 {
+		seedLLMCall(t, d, 2, strings.Repeat("x", 100), now)
+	}
+	a.purgeAll()
+	if n := countRows(t, d, "llm_calls", 2); n != 2 {
+		t.Errorf("size retention kept %d rows, want 2", n)
+	}
+	if got, _ := model.ListArchives(d, model.ArchiveFilter{}); len(got) != 2 {
+		t.Errorf("got %d archives, want 2", len(got))
+	}
+}
+
+func TestArchiverIndexExisting(t *testing.T) {
+	d := openTestDB(t)
+	a := &Archiver{DB: d, ArchiveDir: t.TempDir(), MaxEvents: 1}
+	for range 3 {
+		seedLLMCall(t, d, 7, `["hi"]`, time.Now())
+	}
+	a.purgeAll()
+	a.purgeAll() // nothing more to archive
+	archives, _ := model.ListArchives(d, model.ArchiveFilter{})
+	if len(archives) != 1 {
+		t.Fatalf("got %d archives, want 1", len(archives))
+	}
+	// Forget the archive, as if it was written before the index existed.
+	model.DeleteArchive(d, archives[0].ID)
+	os.WriteFile(filepath.Join(a.ArchiveDir, "notes.txt"), []byte("not an archive"), 0o644)
+
+	n, err := a.IndexExisting()
+	if err != nil || n != 1 {
+		t.Fatalf("IndexExisting = %d, %v", n, err)
+	}
+	got, _ := model.GetArchiveByFile(d, archives[0].File)
+	if got.PersonaID != 7 || got.TableName != "llm_calls" || got.RowCount != 2 || got.MaxRowID != 2 {
+		t.Errorf("reindexed archive = %+v", got)
+	}
+	if n, _ := a.IndexExisting(); n != 0 {
+		t.Errorf("second IndexExisting added %d", n)
+	}
+}
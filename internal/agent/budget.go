@@ -2,13 +2,18 @@ package agent
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/waynenilsen/waynebot/internal/db"
 )
 
 // BudgetChecker checks whether a persona is within its token budget.
+// Goroutine-safe.
 type BudgetChecker struct {
 	DB *db.DB
+
+	mu       sync.Mutex
+	reserved map[int64]int64
 }
 
 // NewBudgetChecker creates a BudgetChecker.
@@ -17,11 +22,51 @@ func NewBudgetChecker(d *db.DB) *BudgetChecker {
 }
 
 // WithinBudget returns true if the persona has used fewer tokens than maxTokensPerHour in the last hour.
+// Tokens held by runs in progress count as used.
 func (bc *BudgetChecker) WithinBudget(personaID int64, maxTokensPerHour int) (bool, error) {
 	if maxTokensPerHour <= 0 {
 		return true, nil
 	}
 
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.withinLocked(personaID, maxTokensPerHour)
+}
+
+// Reserve checks the persona's budget and, if there is room, holds reserve
+// tokens for a run until release is called. Checking and holding happen
+// under one lock, so a persona's concurrent runs can't all pass on the same
+// remaining budget. The hold is conservative: tokens the run records are
+// counted both in llm_calls and in the hold until it is released.
+func (bc *BudgetChecker) Reserve(personaID int64, maxTokensPerHour, reserve int) (release func(), ok bool, err error) {
+	if maxTokensPerHour <= 0 {
+		return func() {}, true, nil
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	ok, err = bc.withinLocked(personaID, maxTokensPerHour)
+	if err != nil || !ok {
+		return func() {}, ok, err
+	}
+
+	if bc.reserved == nil {
+		bc.reserved = make(map[int64]int64)
+	}
+	bc.reserved[personaID] += int64(reserve)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			bc.mu.Lock()
+			defer bc.mu.Unlock()
+			if bc.reserved[personaID] -= int64(reserve); bc.reserved[personaID] <= 0 {
+				delete(bc.reserved, personaID)
+			}
+		})
+	}, true, nil
+}
+
+func (bc *BudgetChecker) withinLocked(personaID int64, maxTokensPerHour int) (bool, error) {
 	var total int64
 	err := bc.DB.SQL.QueryRow(
 		`SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0)
@@ -33,5 +78,5 @@ func (bc *BudgetChecker) WithinBudget(personaID int64, maxTokensPerHour int) (bo
 		return false, fmt.Errorf("query token usage: %w", err)
 	}
 
-	return total < int64(maxTokensPerHour), nil
+	return total+bc.reserved[personaID] < int64(maxTokensPerHour), nil
 }
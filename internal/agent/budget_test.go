@@ -121,3 +121,30 @@ func TestWithinBudgetExcludesOldCalls(t *testing.T) {
 		t.Error("expected within budget, old call should be excluded")
 	}
 }
+
+func TestReserveHoldsBudgetUntilReleased(t *testing.T) {
+	d := openTestDB(t)
+	bc := NewBudgetChecker(d)
+
+	release, ok, err := bc.Reserve(1, 1000, 1000)
+	if err != nil || !ok {
+		t.Fatalf("first Reserve: ok=%v err=%v", ok, err)
+	}
+	if _, ok, _ := bc.Reserve(1, 1000, 100); ok {
+		t.Error("expected a second run to be refused while the whole budget is held")
+	}
+	if ok, _ := bc.WithinBudget(1, 1000); ok {
+		t.Error("expected held tokens to count against the budget")
+	}
+	if ok, _ := bc.WithinBudget(2, 1000); !ok {
+		t.Error("expected another persona's budget to be unaffected")
+	}
+
+	release()
+	release() // releasing twice is harmless
+	second, ok, err := bc.Reserve(1, 1000, 600)
+	if err != nil || !ok {
+		t.Fatalf("Reserve after release: ok=%v err=%v", ok, err)
+	}
+	second()
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// maxChangesetMessageDiff caps how much of a proposed diff is inlined in the
+// channel message; the full diff is available from the changeset API.
+const maxChangesetMessageDiff = 8000
+
+// proposeChangeset stores the files staged during a run as a pending
+// changeset, posts a summary to the channel and broadcasts a
+// changeset_proposed event. It does nothing if nothing was staged.
+func (a *Actor) proposeChangeset(ch model.Channel, projectID int64, staging *tools.Staging) {
+	staged := staging.Files()
+	if len(staged) == 0 {
+		return
+	}
+
+	files := make([]model.ChangesetFile, len(staged))
+	for i, f := range staged {
+		files[i] = model.ChangesetFile{
+			Path:        f.Path,
+			Existed:     f.Existed,
+			BaseContent: f.Base,
+			NewContent:  f.Content,
+		}
+	}
+
+	cs, err := model.CreateChangeset(a.DB, a.Persona.ID, ch.ID, projectID, staging.Dir, files)
+	if err != nil {
+		slog.Error("actor: create changeset", "persona", a.Persona.Name, "channel_id", ch.ID, "error", err)
+		return
+	}
+
+	var diffText strings.Builder
+	fileData := make([]map[string]any, len(cs.Files))
+	for i, f := range cs.Files {
+		d := f.Diff()
+		diffText.WriteString(d)
+		fileData[i] = map[string]any{
+			"id":      f.ID,
+			"path":    f.Path,
+			"existed": f.Existed,
+			"diff":    d,
+		}
+	}
+
+	body := diffText.String()
+	if len(body) > maxChangesetMessageDiff {
+		body = body[:maxChangesetMessageDiff] + "\n... (diff truncated)\n"
+	}
+	a.postMessage(ch, fmt.Sprintf("Proposed changeset #%d (%d file(s)) is awaiting review:\n\n```diff\n%s```", cs.ID, len(cs.Files), body))
+
+	a.Hub.Broadcast(ws.Event{
+		Type: "changeset_proposed",
+		Data: map[string]any{
+			"id":           cs.ID,
+			"persona_id":   a.Persona.ID,
+			"persona_name": a.Persona.Name,
+			"channel_id":   ch.ID,
+			"status":       cs.Status,
+			"files":        fileData,
+			"created_at":   cs.CreatedAt.Format(time.RFC3339),
+		},
+	})
+}
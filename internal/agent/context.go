@@ -20,6 +20,7 @@ type ContextBudget struct {
 	ProjectTokens   int
 	AgentsmdTokens  int
 	DocumentTokens  int
+	MemoryTokens    int
 	HistoryTokens   int
 	HistoryMessages int
 	Exhausted       bool
@@ -34,6 +35,7 @@ type AssembleInput struct {
 	ChannelID  int64
 	Projects   []model.Project
 	History    []model.Message // chronological order
+	Memories   []model.Memory  // recalled memories, most relevant first
 	TokenLimit int             // 0 = DefaultContextWindow
 }
 
@@ -46,7 +48,8 @@ func EstimateTokens(text string) int {
 // 1. System prompt (always)
 // 2. Project context + AGENTS.md (if project associated)
 // 3. Project documents — erd, prd, recent decisions (if they exist)
-// 4. Channel message history (fills remaining budget)
+// 4. Recalled memories (if any)
+// 5. Channel message history (fills remaining budget)
 func (ca *ContextAssembler) AssembleContext(input AssembleInput) ([]openai.ChatCompletionMessageParamUnion, ContextBudget) {
 	budget := ContextBudget{}
 	tokenLimit := input.TokenLimit
@@ -77,13 +80,17 @@ func (ca *ContextAssembler) AssembleContext(input AssembleInput) ([]openai.ChatC
 			budget.DocumentTokens = EstimateTokens(docsBlock)
 		}
 	}
+	if memoriesBlock := formatMemories(input.Memories); memoriesBlock != "" {
+		systemPrompt += memoriesBlock
+		budget.MemoryTokens = EstimateTokens(memoriesBlock)
+	}
 	budget.SystemTokens = EstimateTokens(systemPrompt)
 	remaining -= budget.SystemTokens
 
 	msgs := make([]openai.ChatCompletionMessageParamUnion, 0, len(input.History)+1)
 	msgs = append(msgs, openai.SystemMessage(systemPrompt))
 
-	// 3. Fill remaining budget with history messages (newest have priority).
+	// 5. Fill remaining budget with history messages (newest have priority).
 	// Walk from newest to oldest, accumulating tokens, then reverse.
 	type histEntry struct {
 		msg    openai.ChatCompletionMessageParamUnion
@@ -245,6 +252,33 @@ func readProjectDocuments(projectPath string) string {
 	return sb.String()
 }
 
+// maxMemoryChars is the maximum total character length for recalled memories (~2000 tokens).
+const maxMemoryChars = 8_000
+
+// formatMemories renders recalled memories for the system prompt, most
+// relevant first, stopping before maxMemoryChars is exceeded.
+func formatMemories(memories []model.Memory) string {
+	if len(memories) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n## Relevant Memories\n")
+	sb.WriteString("Saved memories that may be relevant to this conversation. Use memory_update or memory_forget if one is wrong or stale.\n")
+	total := 0
+	for _, m := range memories {
+		entry := fmt.Sprintf("\n### #%d %s (%s)\n%s\n", m.ID, m.Title, m.Scope, strings.TrimSpace(m.Content))
+		if total+len(entry) > maxMemoryChars {
+			break
+		}
+		sb.WriteString(entry)
+		total += len(entry)
+	}
+	if total == 0 {
+		return ""
+	}
+	return sb.String()
+}
+
 // truncateDecisions keeps only the last N entries from a decisions document.
 // Entries are separated by "---" lines or "## " headers.
 func truncateDecisions(content string, maxEntries int) string {
@@ -541,3 +541,27 @@ func TestEstimateTokens(t *testing.T) {
 		t.Errorf("expected 3 tokens, got %d", got)
 	}
 }
+
+func TestAssembleContextWithMemories(t *testing.T) {
+	d := openTestDB(t)
+
+	persona, _ := model.CreatePersona(d, "membot", "Base prompt.", "test-model", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "mem-test", "", 0)
+
+	assembler := &ContextAssembler{}
+	msgs, budget := assembler.AssembleContext(AssembleInput{
+		Persona:   persona,
+		ChannelID: ch.ID,
+		Memories: []model.Memory{
+			{ID: 7, Scope: model.MemoryScopeProject, Title: "deploy-day", Content: "Deploys happen on Tuesdays."},
+		},
+	})
+
+	sysContent := msgs[0].OfSystem.Content.OfString.Value
+	if !strings.Contains(sysContent, "## Relevant Memories") || !strings.Contains(sysContent, "#7 deploy-day (project)") {
+		t.Errorf("system prompt missing memories:\n%s", sysContent)
+	}
+	if budget.MemoryTokens == 0 {
+		t.Error("expected non-zero memory tokens")
+	}
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// Defaults for restarting crashed actors, used when the Supervisor's fields
+// are zero.
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultMaxRestartBackoff = 5 * time.Minute
+	DefaultCrashLimit        = 5
+	DefaultCrashWindow       = 10 * time.Minute
+)
+
+// PanicError is a panic recovered from an actor.
+type PanicError struct {
+	Value any
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("actor panic: %v", e.Value)
+}
+
+// ActorHealth reports how a persona's actor has fared since the supervisor
+// was created.
+type ActorHealth struct {
+	// Restarts counts automatic restarts after a crash; Reloads counts
+	// actors replaced to pick up changes to the persona.
+	Restarts    int
+	Reloads     int
+	Crashes     int
+	LastCrashAt *time.Time
+	LastError   string
+
+	// NextRestartAt is when a crashed actor is due to restart.
+	NextRestartAt *time.Time
+
+	// CircuitOpen means the actor crashed too often to be restarted
+	// automatically; it stays down until it is started again by hand.
+	CircuitOpen bool
+}
+
+type actorHealth struct {
+	ActorHealth
+
+	// recent holds the crash times within the crash window.
+	recent []time.Time
+}
+
+// Health returns the health of a persona's actor.
+func (s *Supervisor) Health(personaID int64) ActorHealth {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if h, ok := s.health[personaID]; ok {
+		return h.ActorHealth
+	}
+	return ActorHealth{}
+}
+
+// updateHealth calls fn with the persona's health record under the lock.
+func (s *Supervisor) updateHealth(personaID int64, fn func(*actorHealth)) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if s.health == nil {
+		s.health = make(map[int64]*actorHealth)
+	}
+	h, ok := s.health[personaID]
+	if !ok {
+		h = &actorHealth{}
+		s.health[personaID] = h
+	}
+	fn(h)
+}
+
+// supervise runs the persona's actor until ctx ends, restarting it with
+// exponential backoff when it crashes. Crashing CrashLimit times within
+// CrashWindow opens the circuit: the actor is left down. A signal on reload
+// drains the actor and replaces it with one for the persona as it is now.
+// Whenever supervise gives up on its own, it drops the actor's handle so
+// that StartActor can start it again.
+func (s *Supervisor) supervise(ctx context.Context, p model.Persona, reload <-chan struct{}) {
+	resume := false
+	for {
+		slog.Info("supervisor: starting actor", "persona", p.Name, "persona_id", p.ID)
+		actor := s.newActor(p)
+		actor.drain = reload
+		actor.resume = resume
+		err := actor.Run(ctx)
+
+		var perr *PanicError
+		if !errors.As(err, &perr) {
+			if ctx.Err() != nil {
+				slog.Info("supervisor: actor stopped", "persona", p.Name, "persona_id", p.ID)
+				return
+			}
+			fresh, err := model.GetPersona(s.DB, p.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				s.Status.Set(p.ID, StatusStopped)
+				s.dropHandle(p.ID, reload)
+				return
+			}
+			if err != nil {
+				slog.Error("supervisor: reload persona", "persona", p.Name, "error", err)
+			} else {
+				p = fresh
+			}
+			slog.Info("supervisor: reloading actor", "persona", p.Name, "persona_id", p.ID)
+			s.updateHealth(p.ID, func(h *actorHealth) { h.Reloads++ })
+			resume = true
+			continue
+		}
+		resume = false
+
+		delay, restart := s.recordCrash(p, perr)
+		s.Status.Set(p.ID, StatusCrashed)
+		actor.broadcastStatus(0, StatusCrashed)
+		if !restart {
+			slog.Error("supervisor: actor keeps crashing, not restarting", "persona", p.Name, "persona_id", p.ID)
+			s.dropHandle(p.ID, reload)
+			return
+		}
+
+		slog.Info("supervisor: restarting actor", "persona", p.Name, "persona_id", p.ID, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.updateHealth(p.ID, func(h *actorHealth) { h.NextRestartAt = nil })
+			s.Status.Set(p.ID, StatusStopped)
+			slog.Info("supervisor: restart cancelled", "persona", p.Name, "persona_id", p.ID)
+			return
+		case <-timer.C:
+		}
+
+		// Pick up changes made to the persona while it was down.
+		fresh, err := model.GetPersona(s.DB, p.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.Status.Set(p.ID, StatusStopped)
+			s.dropHandle(p.ID, reload)
+			return
+		}
+		if err == nil {
+			p = fresh
+		}
+		s.updateHealth(p.ID, func(h *actorHealth) {
+			h.Restarts++
+			h.NextRestartAt = nil
+		})
+	}
+}
+
+// dropHandle forgets the persona's actor handle if it is still the one
+// identified by reload, rather than one started since.
+func (s *Supervisor) dropHandle(personaID int64, reload <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.actors[personaID]; ok && h.reload == reload {
+		delete(s.actors, personaID)
+	}
+}
+
+// recordCrash logs and stores the crash, and returns how long to wait before
+// restarting, or false if the circuit is now open.
+func (s *Supervisor) recordCrash(p model.Persona, perr *PanicError) (time.Duration, bool) {
+	slog.Error("supervisor: actor crashed", "persona", p.Name, "persona_id", p.ID, "error", perr, "stack", perr.Stack)
+	if err := model.CreateActorCrash(s.DB, p.ID, perr.Error(), perr.Stack); err != nil {
+		slog.Error("supervisor: record crash", "persona", p.Name, "error", err)
+	}
+
+	limit, window := s.CrashLimit, s.CrashWindow
+	if limit <= 0 {
+		limit = DefaultCrashLimit
+	}
+	if window <= 0 {
+		window = DefaultCrashWindow
+	}
+
+	var (
+		delay   time.Duration
+		restart bool
+	)
+	now := time.Now()
+	s.updateHealth(p.ID, func(h *actorHealth) {
+		h.Crashes++
+		h.LastCrashAt = &now
+		h.LastError = perr.Error()
+
+		recent := h.recent[:0]
+		for _, t := range h.recent {
+			if now.Sub(t) < window {
+				recent = append(recent, t)
+			}
+		}
+		h.recent = append(recent, now)
+
+		if len(h.recent) >= limit {
+			h.CircuitOpen = true
+			return
+		}
+		delay, restart = s.restartDelay(len(h.recent)), true
+		next := now.Add(delay)
+		h.NextRestartAt = &next
+	})
+	return delay, restart
+}
+
+// restartDelay is the backoff before restarting after the nth recent crash:
+// RestartBackoff doubling with each crash, up to MaxRestartBackoff.
+func (s *Supervisor) restartDelay(n int) time.Duration {
+	delay, ceiling := s.RestartBackoff, s.MaxRestartBackoff
+	if delay <= 0 {
+		delay = DefaultRestartBackoff
+	}
+	if ceiling <= 0 {
+		ceiling = DefaultMaxRestartBackoff
+	}
+	for i := 1; i < n && delay < ceiling; i++ {
+		delay *= 2
+	}
+	return min(delay, ceiling)
+}
+
+// resetCircuit forgets the persona's recent crashes, closing its circuit,
+// when its actor is started by hand.
+func (s *Supervisor) resetCircuit(personaID int64) {
+	s.updateHealth(personaID, func(h *actorHealth) {
+		h.recent = nil
+		h.CircuitOpen = false
+		h.NextRestartAt = nil
+	})
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// panickyLLM panics on its first panics calls, then answers "Recovered!".
+type panickyLLM struct {
+	mu     sync.Mutex
+	panics int
+}
+
+func (m *panickyLLM) ChatCompletion(_ context.Context, _ string, _ []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.panics > 0 {
+		m.panics--
+		panic("boom")
+	}
+	return llm.Response{Content: "Recovered!"}, nil
+}
+
+// crashScenario starts a supervisor whose single persona is subscribed to a
+// channel, with the given LLM and fast restarts and job retries. configure,
+// if set, adjusts the supervisor before it starts.
+func crashScenario(t *testing.T, client LLMClient, configure func(*Supervisor)) (*Supervisor, model.Persona, model.Channel) {
+	t.Helper()
+	sup, _ := newSupervisor(t)
+	sup.LLM = client
+	sup.RestartBackoff = 5 * time.Millisecond
+	sup.JobRetryBackoff = time.Millisecond
+	if configure != nil {
+		configure(sup)
+	}
+	p, _ := model.CreatePersona(sup.DB, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(sup.DB, "general", "", 0)
+	model.SubscribeChannel(sup.DB, p.ID, ch.ID)
+	if err := sup.StartAll(); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	t.Cleanup(sup.StopAll)
+	return sup, p, ch
+}
+
+// poke posts a human message and wakes the actors.
+func poke(sup *Supervisor, ch model.Channel) {
+	model.CreateMessage(sup.DB, ch.ID, 1, "human", "alice", "hello?")
+	sup.Hub.Broadcast(ws.Event{Type: "new_message"})
+}
+
+func TestActorCrashIsRecoveredAndRestarted(t *testing.T) {
+	sup, p, ch := crashScenario(t, &panickyLLM{panics: 1}, nil)
+
+	poke(sup, ch)
+	waitFor(t, func() bool { return sup.Health(p.ID).Restarts == 1 })
+
+	h := sup.Health(p.ID)
+	if h.Crashes != 1 || h.LastError != "actor panic: boom" || h.CircuitOpen || h.LastCrashAt == nil {
+		t.Errorf("health = %+v", h)
+	}
+	crashes, _ := model.ListActorCrashes(sup.DB, p.ID, 10, 0)
+	if len(crashes) != 1 || !strings.Contains(crashes[0].Stack, "panickyLLM") {
+		t.Fatalf("crashes = %+v", crashes)
+	}
+
+	// The restarted actor retries the job that crashed it.
+	waitFor(t, func() bool {
+		msgs, _ := model.GetRecentMessages(sup.DB, ch.ID, 10)
+		return slices.ContainsFunc(msgs, func(m model.Message) bool { return m.Content == "Recovered!" })
+	})
+	runs, _ := model.ListAgentRuns(sup.DB, p.ID, 10, 0)
+	if len(runs) != 2 || runs[1].Status != model.RunFailed || runs[1].Reason != "panic: boom" {
+		t.Errorf("runs = %+v", runs)
+	}
+}
+
+func TestCrashLoopOpensCircuit(t *testing.T) {
+	sup, p, ch := crashScenario(t, &panickyLLM{panics: 100}, func(sup *Supervisor) { sup.CrashLimit = 3 })
+
+	waitFor(t, func() bool {
+		poke(sup, ch)
+		return sup.Health(p.ID).CircuitOpen
+	})
+
+	h := sup.Health(p.ID)
+	if h.Crashes != 3 || h.Restarts != 2 || h.NextRestartAt != nil {
+		t.Errorf("health = %+v", h)
+	}
+	if got := sup.Status.Get(p.ID); got != StatusCrashed {
+		t.Errorf("status = %s, want crashed", got)
+	}
+
+	// Restarting by hand closes the circuit.
+	if err := sup.RestartActor(p.ID); err != nil {
+		t.Fatalf("RestartActor: %v", err)
+	}
+	if sup.Health(p.ID).CircuitOpen {
+		t.Error("circuit still open after manual restart")
+	}
+}
+
+func TestStartActorAfterCircuitOpens(t *testing.T) {
+	sup, p, ch := crashScenario(t, &panickyLLM{panics: 100}, func(sup *Supervisor) { sup.CrashLimit = 3 })
+
+	waitFor(t, func() bool {
+		poke(sup, ch)
+		return sup.Health(p.ID).CircuitOpen && !sup.ActorRunning(p.ID)
+	})
+
+	if err := sup.StartActor(p.ID); err != nil {
+		t.Fatalf("StartActor after the circuit opened: %v", err)
+	}
+	if !sup.ActorRunning(p.ID) || sup.Health(p.ID).CircuitOpen {
+		t.Errorf("running = %v, health = %+v", sup.ActorRunning(p.ID), sup.Health(p.ID))
+	}
+}
+
+func TestStopActorCancelsRestart(t *testing.T) {
+	sup, p, ch := crashScenario(t, &panickyLLM{panics: 1}, func(sup *Supervisor) { sup.RestartBackoff = time.Hour })
+
+	poke(sup, ch)
+	waitFor(t, func() bool { return sup.Health(p.ID).NextRestartAt != nil })
+	if got := sup.Status.Get(p.ID); got != StatusCrashed {
+		t.Errorf("status = %s, want crashed", got)
+	}
+
+	if !sup.StopActor(p.ID) {
+		t.Fatal("StopActor reported the actor wasn't running")
+	}
+	waitFor(t, func() bool { return sup.Status.Get(p.ID) == StatusStopped })
+	if h := sup.Health(p.ID); h.Restarts != 0 || h.NextRestartAt != nil {
+		t.Errorf("health = %+v", h)
+	}
+}
+
+func TestRestartDelay(t *testing.T) {
+	sup := &Supervisor{RestartBackoff: time.Second, MaxRestartBackoff: 5 * time.Second}
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := sup.restartDelay(n); got != want {
+			t.Errorf("restartDelay(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package agent
 
 import (
+	"database/sql"
+	"errors"
+
 	"github.com/waynenilsen/waynebot/internal/db"
 )
 
-// CursorStore manages per-persona per-channel message cursors via the actor_cursors table.
+// CursorStore manages per-persona per-channel message cursors via the
+// actor_cursors table, and each persona's task event cursor via
+// actor_task_cursors.
 type CursorStore struct {
 	DB *db.DB
 }
@@ -22,7 +27,7 @@ func (cs *CursorStore) Get(personaID, channelID int64) (int64, error) {
 		personaID, channelID,
 	).Scan(&msgID)
 	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
+		if errors.Is(err, sql.ErrNoRows) {
 			return 0, nil
 		}
 		return 0, err
@@ -40,3 +45,31 @@ func (cs *CursorStore) Set(personaID, channelID, messageID int64) error {
 	)
 	return err
 }
+
+// TaskCursor returns the last task event a persona has been woken for, and
+// whether the cursor exists.
+func (cs *CursorStore) TaskCursor(personaID int64) (int64, bool, error) {
+	var eventID int64
+	err := cs.DB.SQL.QueryRow(
+		"SELECT last_seen_event_id FROM actor_task_cursors WHERE persona_id = ?",
+		personaID,
+	).Scan(&eventID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return eventID, true, nil
+}
+
+// SetTaskCursor upserts the last task event a persona has been woken for.
+func (cs *CursorStore) SetTaskCursor(personaID, eventID int64) error {
+	_, err := cs.DB.WriteExec(
+		`INSERT INTO actor_task_cursors (persona_id, last_seen_event_id, updated_at)
+		 VALUES (?, ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(persona_id) DO UPDATE SET last_seen_event_id = excluded.last_seen_event_id, updated_at = CURRENT_TIMESTAMP`,
+		personaID, eventID,
+	)
+	return err
+}
@@ -1,14 +1,18 @@
 package agent
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
 )
 
 func openTestDB(t *testing.T) *db.DB {
 	t.Helper()
-	d, err := db.Open(":memory:")
+	// A file rather than :memory:, since actors query from several goroutines
+	// and each pooled connection to :memory: would see its own empty database.
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
 	if err != nil {
 		t.Fatalf("open test db: %v", err)
 	}
@@ -98,3 +102,30 @@ func TestCursorIsolation(t *testing.T) {
 		}
 	}
 }
+
+func TestTaskCursor(t *testing.T) {
+	d := openTestDB(t)
+	cs := NewCursorStore(d)
+	p, _ := model.CreatePersona(d, "coder", "", "m", nil, 0.7, 100, 0, 0)
+
+	if _, ok, err := cs.TaskCursor(p.ID); err != nil || ok {
+		t.Fatalf("TaskCursor before set = %v, %v; want not found", ok, err)
+	}
+	if err := cs.SetTaskCursor(p.ID, 7); err != nil {
+		t.Fatalf("SetTaskCursor: %v", err)
+	}
+	if err := cs.SetTaskCursor(p.ID, 9); err != nil {
+		t.Fatalf("SetTaskCursor update: %v", err)
+	}
+	got, ok, err := cs.TaskCursor(p.ID)
+	if err != nil || !ok || got != 9 {
+		t.Errorf("TaskCursor = %d, %v, %v; want 9", got, ok, err)
+	}
+
+	// The task cursor is kept apart from the message cursors.
+	var n int
+	d.SQL.QueryRow("SELECT COUNT(*) FROM actor_cursors").Scan(&n)
+	if n != 0 {
+		t.Errorf("actor_cursors has %d rows, want 0", n)
+	}
+}
@@ -27,10 +27,24 @@ func NewDecisionMaker() *DecisionMaker {
 // ShouldRespond returns true if the persona should respond to the given messages in the channel.
 // It checks: (1) not all messages are from self, (2) cooldown has elapsed, (3) @mention override.
 func (dm *DecisionMaker) ShouldRespond(persona model.Persona, channelID int64, messages []model.Message) bool {
+	return dm.ShouldRespondWithSettings(persona, model.PersonaChannelSettings{PersonaID: persona.ID, ChannelID: channelID}, messages)
+}
+
+// ShouldRespondWithSettings is ShouldRespond in a channel where the persona
+// has overrides: their cooldown applies, and their reply mode can limit the
+// persona to @mentions or keep it silent.
+func (dm *DecisionMaker) ShouldRespondWithSettings(persona model.Persona, settings model.PersonaChannelSettings, messages []model.Message) bool {
 	if len(messages) == 0 {
 		return false
 	}
 
+	persona = settings.Apply(persona)
+	channelID := settings.ChannelID
+	mode := settings.EffectiveReplyMode()
+	if mode == model.ReplyNever {
+		return false
+	}
+
 	mentioned := isMentioned(persona.Name, messages)
 
 	if allFromSelf(persona.ID, messages) && !mentioned {
@@ -42,6 +56,10 @@ func (dm *DecisionMaker) ShouldRespond(persona model.Persona, channelID int64, m
 		return true
 	}
 
+	if mode == model.ReplyMentionOnly {
+		return false
+	}
+
 	if !dm.cooldownElapsed(persona.ID, channelID, persona.CooldownSecs) {
 		return false
 	}
@@ -154,3 +154,45 @@ func TestRecordResponseStartsCooldown(t *testing.T) {
 		t.Error("expected false after RecordResponse")
 	}
 }
+
+func TestShouldRespondWithSettingsReplyModes(t *testing.T) {
+	p := testPersona(1, "bot", 0)
+	plain := []model.Message{msg(99, "human", "hello")}
+	mention := []model.Message{msg(99, "human", "hey @bot")}
+
+	tests := []struct {
+		mode      string
+		plain     bool
+		mentioned bool
+	}{
+		{"", true, true},
+		{model.ReplyAlways, true, true},
+		{model.ReplyMentionOnly, false, true},
+		{model.ReplyNever, false, false},
+	}
+	for _, tt := range tests {
+		dm := NewDecisionMaker()
+		s := model.PersonaChannelSettings{PersonaID: 1, ChannelID: 1, ReplyMode: tt.mode}
+		if got := dm.ShouldRespondWithSettings(p, s, plain); got != tt.plain {
+			t.Errorf("mode %q, plain message: got %v, want %v", tt.mode, got, tt.plain)
+		}
+		if got := dm.ShouldRespondWithSettings(p, s, mention); got != tt.mentioned {
+			t.Errorf("mode %q, mention: got %v, want %v", tt.mode, got, tt.mentioned)
+		}
+	}
+}
+
+func TestShouldRespondWithSettingsCooldownOverride(t *testing.T) {
+	dm := NewDecisionMaker()
+	p := testPersona(1, "bot", 3600)
+	msgs := []model.Message{msg(99, "human", "hello")}
+
+	dm.RecordResponse(1, 1)
+	if dm.ShouldRespond(p, 1, msgs) {
+		t.Fatal("expected the persona's cooldown to block")
+	}
+	zero := 0
+	if !dm.ShouldRespondWithSettings(p, model.PersonaChannelSettings{PersonaID: 1, ChannelID: 1, CooldownSecs: &zero}, msgs) {
+		t.Error("expected the channel's zero cooldown to allow a reply")
+	}
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// DefaultMaxDelegationDepth allows a delegated persona to delegate once more
+// but no further.
+const DefaultMaxDelegationDepth = 2
+
+// Delegate runs a subtask for another persona and returns its answer. The
+// instructions and answer are posted to a DM thread between the two personas,
+// and the target answers from that exchange alone rather than the thread's
+// earlier history. It implements tools.Delegator.
+func (s *Supervisor) Delegate(ctx context.Context, req tools.DelegateRequest) (string, error) {
+	maxDepth := s.MaxDelegationDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDelegationDepth
+	}
+	if req.Depth >= maxDepth {
+		return "", fmt.Errorf("delegation depth limit (%d) reached; do the work yourself", maxDepth)
+	}
+
+	from, err := model.GetPersona(s.DB, req.FromPersonaID)
+	if err != nil {
+		return "", fmt.Errorf("get delegating persona: %w", err)
+	}
+	to, err := s.lookupPersona(req.Persona)
+	if err != nil {
+		return "", err
+	}
+	if to.ID == from.ID {
+		return "", fmt.Errorf("cannot delegate to yourself")
+	}
+
+	ok, err := s.Budget.WithinBudget(to.ID, to.MaxTokensPerHour)
+	if err != nil {
+		return "", fmt.Errorf("budget check: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is over its hourly token budget", to.Name)
+	}
+
+	var projects []model.Project
+	if req.ProjectID != 0 {
+		p, err := model.GetProject(s.DB, req.ProjectID)
+		if err != nil {
+			return "", fmt.Errorf("project %d not found", req.ProjectID)
+		}
+		projects = []model.Project{p}
+	}
+
+	thread, err := model.FindOrCreatePersonaDM(s.DB, from.ID, to.ID)
+	if err != nil {
+		return "", fmt.Errorf("open delegation thread: %w", err)
+	}
+	delegator, target := s.newActor(from), s.newActor(to)
+	request := delegator.postMessage(thread, req.Instructions)
+	if request.ID == 0 {
+		return "", fmt.Errorf("post delegation instructions")
+	}
+
+	dl, err := model.CreateDelegation(s.DB, model.Delegation{
+		FromPersonaID:    from.ID,
+		ToPersonaID:      to.ID,
+		OriginChannelID:  req.OriginChannelID,
+		ThreadChannelID:  thread.ID,
+		ProjectID:        req.ProjectID,
+		Instructions:     req.Instructions,
+		Depth:            req.Depth + 1,
+		RequestMessageID: request.ID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("record delegation: %w", err)
+	}
+	s.broadcastDelegation("delegation_started", dl)
+
+	if req.Timeout <= 0 {
+		req.Timeout = tools.DefaultDelegateTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, req.Timeout)
+	defer cancel()
+	runCtx = tools.WithDelegationDepth(runCtx, dl.Depth)
+	// The target reads the instructions as a request put to it, like a
+	// human's, rather than as an agent turn of its own.
+	prompt := request
+	prompt.AuthorType = "human"
+	answer, _ := target.converse(withRunTrigger(runCtx, model.RunTriggerDelegation), thread, []model.Message{prompt}, projects, nil)
+
+	status, errText := model.DelegationCompleted, ""
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		status, errText = model.DelegationTimedOut, fmt.Sprintf("%s did not answer within %s", to.Name, req.Timeout)
+	case answer.ID == 0:
+		status, errText = model.DelegationFailed, fmt.Sprintf("%s did not produce an answer", to.Name)
+	}
+	if err := model.FinishDelegation(s.DB, dl.ID, status, answer.Content, errText, answer.ID); err != nil {
+		slog.Error("supervisor: finish delegation", "delegation_id", dl.ID, "error", err)
+	}
+	if finished, err := model.GetDelegation(s.DB, dl.ID); err == nil {
+		dl = finished
+	}
+	s.broadcastDelegation("delegation_finished", dl)
+
+	if errText != "" {
+		return "", errors.New(errText)
+	}
+	return answer.Content, nil
+}
+
+// lookupPersona finds a persona by name, falling back to a numeric ID.
+func (s *Supervisor) lookupPersona(nameOrID string) (model.Persona, error) {
+	p, err := model.GetPersonaByName(s.DB, nameOrID)
+	if err == nil {
+		return p, nil
+	}
+	if id, convErr := strconv.ParseInt(nameOrID, 10, 64); convErr == nil {
+		if p, err := model.GetPersona(s.DB, id); err == nil {
+			return p, nil
+		}
+	}
+	return model.Persona{}, fmt.Errorf("persona %q not found", nameOrID)
+}
+
+func (s *Supervisor) broadcastDelegation(eventType string, dl model.Delegation) {
+	data := map[string]any{
+		"id":                  dl.ID,
+		"from_persona_id":     dl.FromPersonaID,
+		"from_persona_name":   dl.FromPersonaName,
+		"to_persona_id":       dl.ToPersonaID,
+		"to_persona_name":     dl.ToPersonaName,
+		"origin_channel_id":   dl.OriginChannelID,
+		"thread_channel_id":   dl.ThreadChannelID,
+		"project_id":          dl.ProjectID,
+		"status":              dl.Status,
+		"depth":               dl.Depth,
+		"request_message_id":  dl.RequestMessageID,
+		"response_message_id": dl.ResponseMessageID,
+		"created_at":          dl.CreatedAt.Format(time.RFC3339),
+	}
+	if dl.FinishedAt != nil {
+		data["finished_at"] = dl.FinishedAt.Format(time.RFC3339)
+		data["error"] = dl.Error
+	}
+	s.Hub.Broadcast(ws.Event{Type: eventType, Data: data})
+}
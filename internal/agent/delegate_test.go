@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+)
+
+// blockingLLM waits for the call's context to end.
+type blockingLLM struct{}
+
+func (blockingLLM) ChatCompletion(ctx context.Context, _ string, _ []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	<-ctx.Done()
+	return llm.Response{}, ctx.Err()
+}
+
+func newDelegationFixture(t *testing.T) (*Supervisor, model.Persona, model.Persona, model.Channel) {
+	t.Helper()
+	sup, _ := newSupervisor(t)
+	lead, err := model.CreatePersona(sup.DB, "lead", "You coordinate.", "model", nil, 0.7, 100, 0, 0)
+	if err != nil {
+		t.Fatalf("create lead: %v", err)
+	}
+	helper, err := model.CreatePersona(sup.DB, "helper", "You help.", "model", nil, 0.7, 100, 0, 0)
+	if err != nil {
+		t.Fatalf("create helper: %v", err)
+	}
+	ch, err := model.CreateChannel(sup.DB, "general", "", 0)
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	return sup, lead, helper, ch
+}
+
+func TestDelegateReturnsAnswer(t *testing.T) {
+	sup, lead, helper, ch := newDelegationFixture(t)
+	mock := &mockLLM{responses: []llm.Response{{Content: "The answer is 42.", PromptTokens: 10, CompletionTokens: 5}}}
+	sup.LLM = mock
+
+	answer, err := sup.Delegate(context.Background(), tools.DelegateRequest{
+		FromPersonaID:   lead.ID,
+		OriginChannelID: ch.ID,
+		Persona:         "helper",
+		Instructions:    "Work out the answer.",
+		Timeout:         time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("delegate: %v", err)
+	}
+	if answer != "The answer is 42." {
+		t.Errorf("answer = %q", answer)
+	}
+
+	// The helper sees the instructions as coming from the lead, not as its own words.
+	sent, _ := json.Marshal(mock.getLastMessages())
+	if !strings.Contains(string(sent), `"role":"user"`) || !strings.Contains(string(sent), "lead: Work out the answer.") {
+		t.Errorf("instructions not sent as a user message: %s", sent)
+	}
+
+	delegations, err := model.ListDelegations(sup.DB, model.DelegationFilter{PersonaID: helper.ID})
+	if err != nil || len(delegations) != 1 {
+		t.Fatalf("list delegations = %v, %v", delegations, err)
+	}
+	dl := delegations[0]
+	if dl.Status != model.DelegationCompleted || dl.Result != answer || dl.Depth != 1 || dl.OriginChannelID != ch.ID {
+		t.Errorf("delegation = %+v", dl)
+	}
+
+	thread, err := model.GetChannel(sup.DB, dl.ThreadChannelID)
+	if err != nil || !thread.IsDM {
+		t.Fatalf("thread = %+v, %v", thread, err)
+	}
+	msgs, err := model.GetMessagesBetween(sup.DB, thread.ID, dl.RequestMessageID, dl.ResponseMessageID)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("thread messages = %v, %v", msgs, err)
+	}
+	if msgs[0].AuthorID != lead.ID || msgs[1].AuthorID != helper.ID {
+		t.Errorf("thread authors = %d, %d", msgs[0].AuthorID, msgs[1].AuthorID)
+	}
+
+	// Neither persona is subscribed, so their own loops ignore the thread.
+	for _, p := range []model.Persona{lead, helper} {
+		subs, _ := model.GetSubscribedChannels(sup.DB, p.ID)
+		if len(subs) != 0 {
+			t.Errorf("%s subscribed to %v", p.Name, subs)
+		}
+	}
+
+	// A second delegation reuses the thread and sees only its own request.
+	if _, err := sup.Delegate(context.Background(), tools.DelegateRequest{
+		FromPersonaID: lead.ID, Persona: "helper", Instructions: "Again.", Timeout: time.Minute,
+	}); err != nil {
+		t.Fatalf("second delegate: %v", err)
+	}
+	if n := len(mock.getLastMessages()); n != 2 {
+		t.Errorf("second run sent %d messages, want system + request", n)
+	}
+	again, _ := model.ListDelegations(sup.DB, model.DelegationFilter{})
+	if len(again) != 2 || again[0].ThreadChannelID != thread.ID {
+		t.Errorf("delegations = %+v", again)
+	}
+}
+
+func TestDelegateRejections(t *testing.T) {
+	sup, lead, _, _ := newDelegationFixture(t)
+	sup.LLM = &mockLLM{responses: []llm.Response{{Content: "ok"}}}
+
+	for name, req := range map[string]tools.DelegateRequest{
+		"self":    {FromPersonaID: lead.ID, Persona: "lead", Instructions: "x"},
+		"unknown": {FromPersonaID: lead.ID, Persona: "nobody", Instructions: "x"},
+		"depth":   {FromPersonaID: lead.ID, Persona: "helper", Instructions: "x", Depth: DefaultMaxDelegationDepth},
+		"project": {FromPersonaID: lead.ID, Persona: "helper", Instructions: "x", ProjectID: 999},
+	} {
+		if _, err := sup.Delegate(context.Background(), req); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if dls, _ := model.ListDelegations(sup.DB, model.DelegationFilter{}); len(dls) != 0 {
+		t.Errorf("rejected delegations were recorded: %+v", dls)
+	}
+}
+
+func TestDelegateTimeout(t *testing.T) {
+	sup, lead, _, _ := newDelegationFixture(t)
+	sup.LLM = blockingLLM{}
+
+	_, err := sup.Delegate(context.Background(), tools.DelegateRequest{
+		FromPersonaID: lead.ID, Persona: "helper", Instructions: "Take forever.", Timeout: 50 * time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	dls, _ := model.ListDelegations(sup.DB, model.DelegationFilter{})
+	if len(dls) != 1 || dls[0].Status != model.DelegationTimedOut || dls[0].FinishedAt == nil {
+		t.Errorf("delegations = %+v", dls)
+	}
+}
+
+func TestDelegateToolPassesDepth(t *testing.T) {
+	sup, lead, helper, _ := newDelegationFixture(t)
+	mock := &mockLLM{responses: []llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "delegate", Arguments: `{"persona":"lead","instructions":"bounce"}`}}},
+		{Content: "done"},
+	}}
+	sup.LLM = mock
+	sup.MaxDelegationDepth = 1
+	sup.Tools.Register("delegate", tools.Delegate(sup))
+	if err := model.UpdatePersona(sup.DB, helper.ID, helper.Name, helper.SystemPrompt, helper.Model, []string{"delegate"},
+		helper.Temperature, helper.MaxTokens, helper.CooldownSecs, helper.MaxTokensPerHour); err != nil {
+		t.Fatalf("update persona: %v", err)
+	}
+
+	out, err := sup.Tools.Call(tools.WithPersonaID(context.Background(), lead.ID), "delegate",
+		json.RawMessage(`{"persona":"helper","instructions":"delegate back to me"}`))
+	if err != nil || out != "done" {
+		t.Fatalf("delegate = %q, %v", out, err)
+	}
+
+	// The helper's nested delegate call hit the depth limit.
+	sent, _ := json.Marshal(mock.getLastMessages())
+	if !strings.Contains(string(sent), "delegation depth limit (1) reached") {
+		t.Errorf("nested call not refused: %s", sent)
+	}
+	if dls, _ := model.ListDelegations(sup.DB, model.DelegationFilter{}); len(dls) != 1 {
+		t.Errorf("got %d delegations, want 1", len(dls))
+	}
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestActorWithFakeProvider(t *testing.T) {
+	s := newScenario(t)
+	fake, err := llm.NewFake(llm.FakeScript{Rules: []llm.FakeRule{
+		{Match: "list files", ToolCalls: []llm.FakeToolCall{{Name: "shell_exec", Arguments: []byte(`{"command":"ls"}`)}}},
+		{Role: "tool", Regex: `.+`, Content: "The command said $0."},
+	}})
+	if err != nil {
+		t.Fatalf("NewFake: %v", err)
+	}
+	s.actor.LLM = fake
+	s.postHumanMessage("please list files")
+
+	s.runOnce(context.Background())
+
+	msgs, _ := model.GetMessagesSince(s.actor.DB, s.channel.ID, 0)
+	last := msgs[len(msgs)-1]
+	if last.AuthorType != "agent" || last.Content != "The command said ok." {
+		t.Errorf("last message = %+v", last)
+	}
+	execs, _ := model.ListToolExecutions(s.actor.DB, s.persona.ID, 10, 0)
+	if len(execs) != 1 || execs[0].ToolName != "shell_exec" {
+		t.Errorf("tool executions = %+v", execs)
+	}
+	calls, _ := model.ListLLMCalls(s.actor.DB, s.persona.ID, 10, 0)
+	if len(calls) != 2 || calls[0].PromptTokens == 0 {
+		t.Errorf("llm calls = %+v", calls)
+	}
+}
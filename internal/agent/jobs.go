@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// Defaults for retrying failed jobs, used when the Actor's fields are zero.
+const (
+	DefaultMaxJobAttempts     = 5
+	DefaultJobRetryBackoff    = 10 * time.Second
+	DefaultMaxJobRetryBackoff = 10 * time.Minute
+
+	// BudgetRetryDelay is how long a job waits while the persona is over
+	// its token budget.
+	BudgetRetryDelay = time.Minute
+)
+
+var (
+	errContextFull    = errors.New("context window full")
+	errBudgetExceeded = errors.New("token budget exceeded")
+
+	// errRunNotRetryable marks a failed run that retrying would make worse:
+	// it already ran tools, whose side effects a retry would repeat, or hit
+	// the tool round limit, which it would hit again.
+	errRunNotRetryable = errors.New("run not retryable")
+)
+
+// runJob answers a claimed job and records the outcome. A job that
+// succeeds moves the persona's cursor past its messages. One that fails is
+// retried with backoff until MaxJobAttempts, then left dead; one whose run
+// failed after running tools is left dead at once. A job cut off
+// by the actor stopping, or superseded by newer messages, is put back to
+// run again; one cancelled by a user is left dead. A job the persona has no
+// budget for is put off without counting an attempt.
+func (a *Actor) runJob(ctx context.Context, ch model.Channel, job model.AgentJob) {
+	defer func() {
+		// Count a panic against the job before crashing the actor, so a
+		// message that keeps crashing it is eventually given up on.
+		if v := recover(); v != nil {
+			a.failJob(job, fmt.Sprintf("panic: %v", v))
+			panic(v)
+		}
+	}()
+
+	err := a.answerJob(ctx, ch, job)
+	switch {
+	case err == nil, errors.Is(err, errContextFull):
+		// A full context is answered with a notice; retrying won't help.
+		err = model.CompleteAgentJob(a.DB, job)
+	case errors.Is(err, errRunCancelledByUser):
+		err = model.BuryAgentJob(a.DB, job, err.Error())
+	case errors.Is(err, errRunNotRetryable):
+		slog.Error("actor: job failed, not retrying", "persona", a.Persona.Name, "job_id", job.ID, "error", err)
+		err = model.BuryAgentJob(a.DB, job, err.Error())
+	case errors.Is(err, errRunSuperseded):
+		// Take in the newer messages so they aren't answered twice.
+		if err = model.RequeueAgentJob(a.DB, job); err == nil {
+			err = model.EnqueueAgentJob(a.DB, a.Persona.ID, ch.ID)
+		}
+	case errors.Is(err, errBudgetExceeded):
+		err = model.DeferAgentJob(a.DB, job, err.Error(), time.Now().Add(BudgetRetryDelay))
+	case ctx.Err() != nil:
+		err = model.RequeueAgentJob(a.DB, job)
+	default:
+		a.failJob(job, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("actor: record job outcome", "persona", a.Persona.Name, "job_id", job.ID, "error", err)
+	}
+}
+
+// failJob records a failed attempt at job, leaving it dead once it has used
+// up its attempts.
+func (a *Actor) failJob(job model.AgentJob, reason string) {
+	maxAttempts := a.MaxJobAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxJobAttempts
+	}
+
+	var err error
+	if job.Attempts+1 >= maxAttempts {
+		slog.Error("actor: job failed, giving up", "persona", a.Persona.Name, "job_id", job.ID, "attempts", job.Attempts+1, "error", reason)
+		err = model.BuryAgentJob(a.DB, job, reason)
+	} else {
+		delay := a.jobRetryDelay(job.Attempts + 1)
+		slog.Warn("actor: job failed, will retry", "persona", a.Persona.Name, "job_id", job.ID, "attempts", job.Attempts+1, "delay", delay, "error", reason)
+		err = model.FailAgentJob(a.DB, job, reason, time.Now().Add(delay))
+	}
+	if err != nil {
+		slog.Error("actor: record job failure", "persona", a.Persona.Name, "job_id", job.ID, "error", err)
+	}
+}
+
+// jobRetryDelay is the backoff after the nth failed attempt: JobRetryBackoff
+// doubling with each attempt, up to DefaultMaxJobRetryBackoff.
+func (a *Actor) jobRetryDelay(n int) time.Duration {
+	delay := a.JobRetryBackoff
+	if delay <= 0 {
+		delay = DefaultJobRetryBackoff
+	}
+	for i := 1; i < n && delay < DefaultMaxJobRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, DefaultMaxJobRetryBackoff)
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+)
+
+// failingLLM always fails.
+type failingLLM struct{}
+
+func (failingLLM) ChatCompletion(_ context.Context, _ string, _ []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	return llm.Response{}, errors.New("llm down")
+}
+
+func channelJobs(t *testing.T, s *scenario) []model.AgentJob {
+	t.Helper()
+	jobs, err := model.ListAgentJobs(s.actor.DB, model.AgentJobFilter{PersonaID: s.persona.ID, ChannelID: s.channel.ID}, 10, 0)
+	if err != nil {
+		t.Fatalf("list jobs: %v", err)
+	}
+	return jobs
+}
+
+func TestFailedJobIsRetriedThenLeftDead(t *testing.T) {
+	s := newScenario(t)
+	s.actor.LLM = failingLLM{}
+	s.actor.MaxJobAttempts = 2
+	s.actor.JobRetryBackoff = 300 * time.Millisecond
+	s.postHumanMessage("Hi bot")
+
+	s.runOnce(context.Background())
+	jobs := channelJobs(t, s)
+	if len(jobs) != 1 || jobs[0].Status != model.JobFailed || jobs[0].Attempts != 1 || jobs[0].LastError != "llm call: llm down" {
+		t.Fatalf("after first attempt: jobs = %+v", jobs)
+	}
+	if cursor, _ := s.actor.Cursors.Get(s.persona.ID, s.channel.ID); cursor != 0 {
+		t.Errorf("cursor = %d after a failed job, want 0", cursor)
+	}
+
+	time.Sleep(350 * time.Millisecond)
+	s.runOnce(context.Background())
+	if jobs := channelJobs(t, s); jobs[0].Status != model.JobDead || jobs[0].Attempts != 2 {
+		t.Fatalf("after last attempt: job = %+v", jobs[0])
+	}
+
+	// The dead job doesn't hold up newer messages.
+	s.actor.LLM = s.mock
+	msg := s.postHumanMessage("Are you there?")
+	s.runOnce(context.Background())
+	jobs = channelJobs(t, s)
+	if len(jobs) != 2 || jobs[0].Status != model.JobSucceeded {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	if cursor, _ := s.actor.Cursors.Get(s.persona.ID, s.channel.ID); cursor != msg.ID {
+		t.Errorf("cursor = %d, want %d", cursor, msg.ID)
+	}
+}
+
+// toolThenFailLLM asks for a tool call on its first call and fails after.
+type toolThenFailLLM struct {
+	calls atomic.Int32
+}
+
+func (l *toolThenFailLLM) ChatCompletion(_ context.Context, _ string, _ []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	if l.calls.Add(1) == 1 {
+		return llm.Response{ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "shell_exec", Arguments: `{"command":"touch x"}`}}}, nil
+	}
+	return llm.Response{}, errors.New("llm down")
+}
+
+func TestJobFailingAfterToolsIsNotRetried(t *testing.T) {
+	s := newScenario(t)
+	s.actor.LLM = &toolThenFailLLM{}
+	s.actor.JobRetryBackoff = time.Millisecond
+	var toolRuns atomic.Int32
+	s.actor.Tools = tools.NewRegistry()
+	s.actor.Tools.Register("shell_exec", func(context.Context, json.RawMessage) (string, error) {
+		toolRuns.Add(1)
+		return "ok", nil
+	})
+	s.postHumanMessage("Touch x")
+
+	s.runOnce(context.Background())
+	time.Sleep(5 * time.Millisecond)
+	s.runOnce(context.Background())
+
+	if n := toolRuns.Load(); n != 1 {
+		t.Errorf("tool ran %d times, want 1", n)
+	}
+	if jobs := channelJobs(t, s); len(jobs) != 1 || jobs[0].Status != model.JobDead || jobs[0].Attempts != 1 {
+		t.Fatalf("jobs = %+v, want one dead after one attempt", jobs)
+	}
+}
+
+func TestInterruptedJobIsResumed(t *testing.T) {
+	s := newScenario(t)
+	s.actor.LLM = blockingLLM{}
+	s.postHumanMessage("Hi bot")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.runOnce(ctx)
+		close(done)
+	}()
+	waitForActiveRun(t, s)
+	cancel()
+	<-done
+
+	jobs := channelJobs(t, s)
+	if len(jobs) != 1 || jobs[0].Status != model.JobPending || jobs[0].Attempts != 0 {
+		t.Fatalf("interrupted job = %+v", jobs)
+	}
+
+	s.actor.LLM = s.mock
+	s.runOnce(context.Background())
+	if s.mock.callCount() != 1 {
+		t.Errorf("LLM calls = %d, want 1", s.mock.callCount())
+	}
+	if jobs := channelJobs(t, s); jobs[0].Status != model.JobSucceeded {
+		t.Errorf("resumed job = %+v", jobs[0])
+	}
+}
+
+func TestResetContextCancelsQueuedJobs(t *testing.T) {
+	s := newScenario(t)
+	s.actor.LLM = failingLLM{}
+	s.actor.JobRetryBackoff = time.Millisecond
+	s.postHumanMessage("Hi bot")
+	s.runOnce(context.Background())
+	if jobs := channelJobs(t, s); len(jobs) != 1 || jobs[0].Status != model.JobFailed {
+		t.Fatalf("jobs = %+v, want one failed", jobs)
+	}
+
+	sup := &Supervisor{DB: s.actor.DB, Hub: s.hub, Status: s.actor.Status, Cursors: s.actor.Cursors}
+	if _, err := sup.ResetContext(s.persona, s.channel.ID); err != nil {
+		t.Fatalf("ResetContext: %v", err)
+	}
+
+	s.actor.LLM = s.mock
+	time.Sleep(5 * time.Millisecond)
+	s.runOnce(context.Background())
+	if n := s.mock.callCount(); n != 0 {
+		t.Errorf("LLM called %d times after the reset, want 0", n)
+	}
+	if jobs := channelJobs(t, s); jobs[len(jobs)-1].Status != model.JobDead {
+		t.Errorf("jobs = %+v, want the reset job dead", jobs)
+	}
+}
+
+func TestJobRetryDelay(t *testing.T) {
+	a := &Actor{JobRetryBackoff: time.Minute}
+	for n, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 10: DefaultMaxJobRetryBackoff} {
+		if got := a.jobRetryDelay(n); got != want {
+			t.Errorf("jobRetryDelay(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+)
+
+// journal returns a tools.JournalFunc that records the run's file writes in
+// rootDir to the file_changes table so they can be browsed and reverted.
+// A write to one of the project's memory files reindexes its memories in
+// the background.
+func (a *Actor) journal(channelID, projectID int64, rootDir, runID string) tools.JournalFunc {
+	return func(c tools.FileChange) {
+		rel, err := filepath.Rel(rootDir, c.Path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			slog.Warn("actor: file change outside project, not journaled", "persona", a.Persona.Name, "path", c.Path)
+			return
+		}
+		_, err = model.RecordFileChange(a.DB, model.FileChange{
+			ProjectID:     projectID,
+			PersonaID:     a.Persona.ID,
+			ChannelID:     channelID,
+			RunID:         runID,
+			RootDir:       rootDir,
+			Path:          filepath.ToSlash(rel),
+			Existed:       c.Existed,
+			Removed:       c.Removed,
+			BeforeContent: c.Before,
+			AfterContent:  c.After,
+		})
+		if err != nil {
+			slog.Error("actor: record file change", "persona", a.Persona.Name, "path", rel, "error", err)
+		}
+		if a.Memory != nil && filepath.Dir(rel) == memory.Dir && filepath.Ext(rel) == ".md" {
+			a.Memory.IndexInBackground(projectID, rootDir)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+const (
+	// recallLimit is the number of memories injected into the context.
+	recallLimit = 5
+	// recallMinScore is stricter than memory.MinScore so only clearly
+	// relevant memories take up context without being asked for.
+	recallMinScore = 0.25
+	// recallMessages is how many recent human messages form the query.
+	recallMessages = 3
+)
+
+// RecallMemories returns the memories visible to v that best match the
+// latest human messages in history, as already indexed. When projectDir is
+// set and the project's memories/*.md files have not been indexed yet, they
+// are indexed in the background for later recalls. It returns nil if store
+// is nil or nothing relevant is found; errors are logged, not returned, so a
+// failing embedder never blocks a response.
+func RecallMemories(ctx context.Context, store *memory.Store, v model.MemoryVisibility, projectDir string, history []model.Message) []model.Memory {
+	if store == nil {
+		return nil
+	}
+
+	var parts []string
+	for i := len(history) - 1; i >= 0 && len(parts) < recallMessages; i-- {
+		if history[i].AuthorType == "human" {
+			parts = append(parts, history[i].Content)
+		}
+	}
+	query := strings.TrimSpace(strings.Join(parts, "\n"))
+	if query == "" {
+		return nil
+	}
+
+	if projectDir != "" && v.ProjectID != 0 {
+		store.EnsureIndexed(v.ProjectID, projectDir)
+	}
+
+	results, err := store.Search(ctx, query, model.MemoryFilter{VisibleTo: &v}, recallLimit)
+	if err != nil {
+		slog.Warn("memory recall: search", "persona_id", v.PersonaID, "error", err)
+		return nil
+	}
+	var out []model.Memory
+	for _, r := range results {
+		if r.Score >= recallMinScore {
+			out = append(out, r.Memory)
+		}
+	}
+	return out
+}
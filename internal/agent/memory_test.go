@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+)
+
+func TestRecallMemories(t *testing.T) {
+	d := openTestDB(t)
+	store := memory.NewStore(d, memory.NewHashEmbedder())
+	persona, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	other, _ := model.CreatePersona(d, "other", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "dev", "", 0)
+	ctx := context.Background()
+
+	for _, m := range []model.Memory{
+		{PersonaID: persona.ID, Scope: model.MemoryScopePersona, Title: "deploy-schedule", Content: "Production deploys happen on Tuesday afternoons."},
+		{PersonaID: persona.ID, Scope: model.MemoryScopePersona, Title: "coffee", Content: "The team likes oat milk lattes."},
+		{PersonaID: other.ID, Scope: model.MemoryScopePersona, Title: "other-deploys", Content: "Production deploys happen on Tuesday afternoons."},
+	} {
+		if _, err := store.Save(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := []model.Message{
+		{AuthorType: "human", AuthorName: "alice", Content: "When do production deploys happen?"},
+	}
+	got := RecallMemories(ctx, store, model.MemoryVisibility{PersonaID: persona.ID, ChannelID: ch.ID}, "", history)
+	if len(got) != 1 || got[0].Title != "deploy-schedule" {
+		t.Fatalf("recalled %+v, want only deploy-schedule", got)
+	}
+
+	if RecallMemories(ctx, nil, model.MemoryVisibility{}, "", history) != nil {
+		t.Error("expected nil without a store")
+	}
+}
+
+func TestProjectMemoriesIndexedInBackground(t *testing.T) {
+	d := openTestDB(t)
+	store := memory.NewStore(d, memory.NewHashEmbedder())
+	persona, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	dir := t.TempDir()
+	proj, _ := model.CreateProject(d, "proj", dir, "")
+	os.MkdirAll(filepath.Join(dir, memory.Dir), 0o755)
+	os.WriteFile(filepath.Join(dir, memory.Dir, "deploys.md"), []byte("Production deploys happen on Tuesday afternoons."), 0o644)
+
+	ctx := context.Background()
+	v := model.MemoryVisibility{PersonaID: persona.ID, ProjectID: proj.ID}
+	history := []model.Message{{AuthorType: "human", Content: "When do production deploys happen?"}}
+	RecallMemories(ctx, store, v, dir, history)
+	store.Wait()
+	if got := RecallMemories(ctx, store, v, dir, history); len(got) != 1 {
+		t.Fatalf("recalled %+v after indexing, want the deploys note", got)
+	}
+
+	// A journaled write to a memory file reindexes the project.
+	a := &Actor{DB: d, Persona: persona, Memory: store}
+	path := filepath.Join(dir, memory.Dir, "lunch.md")
+	os.WriteFile(path, []byte("Lunch is at noon."), 0o644)
+	a.journal(0, proj.ID, dir, "run")(tools.FileChange{Path: path, After: "Lunch is at noon."})
+	store.Wait()
+	if list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: proj.ID}); len(list) != 2 {
+		t.Errorf("got %d project memories after the write, want 2", len(list))
+	}
+}
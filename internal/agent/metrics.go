@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/metrics"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// observeLLMCall records a chat completion's latency, tokens and cost.
+func observeLLMCall(persona, llmModel string, start time.Time, resp llm.Response, err error) {
+	metrics.LLMCallDuration.Observe(time.Since(start).Seconds(), persona, llmModel, metrics.Outcome(err))
+	if err != nil {
+		return
+	}
+	metrics.LLMTokens.Add(float64(resp.PromptTokens), persona, llmModel, "prompt")
+	metrics.LLMTokens.Add(float64(resp.CompletionTokens), persona, llmModel, "completion")
+	metrics.LLMCost.Add(resp.Cost, persona, llmModel)
+}
+
+// observeToolExecution records a tool call's outcome and duration.
+func observeToolExecution(toolName, errText string, duration time.Duration, cancelled bool) {
+	outcome := "ok"
+	switch {
+	case cancelled:
+		outcome = "cancelled"
+	case errText != "":
+		outcome = "error"
+	}
+	metrics.ToolExecutions.Inc(toolName, outcome)
+	metrics.ToolDuration.Observe(duration.Seconds(), toolName, outcome)
+}
+
+var statuses = []Status{StatusIdle, StatusThinking, StatusToolCall, StatusError, StatusStopped,
+	StatusBudgetExceeded, StatusContextFull, StatusCrashed}
+
+// RegisterMetrics exposes each persona's status as the gauge
+// waynebot_actor_status{persona,status}, which is 1 for the status the
+// persona is in and 0 for the others.
+func (s *Supervisor) RegisterMetrics() {
+	metrics.NewGaugeFunc("waynebot_actor_status", "Current status of each persona's actor.",
+		[]string{"persona", "status"}, func(emit func(float64, ...string)) {
+			personas, err := model.ListPersonas(s.DB)
+			if err != nil {
+				slog.Error("metrics: list personas", "error", err)
+				return
+			}
+			for _, p := range personas {
+				cur := s.Status.Get(p.ID)
+				if !s.ActorRunning(p.ID) && cur != StatusCrashed {
+					cur = StatusStopped
+				}
+				for _, st := range statuses {
+					v := 0.0
+					if st == cur {
+						v = 1
+					}
+					emit(v, p.Name, st.String())
+				}
+			}
+		})
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/metrics"
+)
+
+func TestRunMetrics(t *testing.T) {
+	s := newScenario(t)
+	s.mock.responses = []llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "shell_exec", Arguments: `{"command":"ls"}`}}, PromptTokens: 10, CompletionTokens: 5},
+		{Content: "Done.", PromptTokens: 20, CompletionTokens: 2, Cost: 0.5},
+	}
+	s.postHumanMessage("list files")
+	s.runOnce(context.Background())
+
+	sup := NewSupervisor(s.actor.DB, s.hub, s.mock, s.actor.Tools)
+	sup.RegisterMetrics()
+
+	var b strings.Builder
+	metrics.Default.WriteText(&b)
+	for _, want := range []string{
+		`waynebot_llm_call_duration_seconds_count{persona="testbot",model="test-model",outcome="ok"}`,
+		`waynebot_llm_tokens_total{persona="testbot",model="test-model",kind="prompt"}`,
+		`waynebot_llm_cost_dollars_total{persona="testbot",model="test-model"}`,
+		`waynebot_tool_executions_total{tool="shell_exec",outcome="ok"}`,
+		`waynebot_tool_execution_duration_seconds_count{tool="shell_exec",outcome="ok"}`,
+		`waynebot_actor_status{persona="testbot",status="stopped"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
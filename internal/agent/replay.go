@@ -0,0 +1,320 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/diff"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// Kinds of Divergence found by Replay.
+const (
+	DivergeModel      = "model"       // an LLM call used a different model
+	DivergePrompt     = "prompt"      // an LLM call sent different messages
+	DivergeExtraCall  = "extra_call"  // more LLM calls than were recorded
+	DivergeMissedCall = "missed_call" // a recorded LLM call wasn't made
+	DivergeTool       = "tool"        // a tool was called with a different name or arguments
+	DivergeExtraTool  = "extra_tool"  // more tool calls than were recorded
+	DivergeMissedTool = "missed_tool" // a recorded tool call wasn't made
+	DivergeError      = "error"       // the replayed run failed
+)
+
+// ErrNotReplayable is returned by Replay for a run it can't re-drive: one
+// not started by new messages, or recorded before runs were tracked.
+var ErrNotReplayable = errors.New("run cannot be replayed")
+
+// errReplayExhausted stops a replay that makes more LLM calls than the
+// recording has answers for.
+var errReplayExhausted = errors.New("no more recorded LLM calls")
+
+// Divergence is a point where a replayed run did something other than the
+// recorded one. Step is the 1-based LLM call or tool call it happened at.
+type Divergence struct {
+	Kind   string
+	Step   int
+	Detail string
+}
+
+// ReplayReport is the outcome of replaying a run.
+type ReplayReport struct {
+	Run            model.AgentRun
+	LLMCalls       int
+	ToolExecutions int
+	Divergences    []Divergence
+}
+
+// Diverged reports whether the replay differed from the recording.
+func (r *ReplayReport) Diverged() bool {
+	return len(r.Divergences) > 0
+}
+
+func (r *ReplayReport) diverge(kind string, step int, format string, args ...any) {
+	r.Divergences = append(r.Divergences, Divergence{Kind: kind, Step: step, Detail: fmt.Sprintf(format, args...)})
+}
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Embedder, when set, recalls memories for the replayed prompt as the
+	// live actor does. It should be the embedder the run was made with.
+	Embedder memory.Embedder
+}
+
+// Replay re-drives a recorded run through the persona's response path and
+// reports where it diverges from the recording. The LLM answers with the
+// recorded responses and the tools with the recorded results, so only
+// changes in how the actor builds prompts and handles tool calls show up.
+//
+// The run is replayed against a scratch database holding only what it
+// reads, as it was when the run started (see snapshotForReplay), and the
+// persona as configured at the time; d itself is not written to.
+func Replay(ctx context.Context, d *db.DB, runID string, opts ReplayOptions) (*ReplayReport, error) {
+	run, err := model.GetAgentRun(d, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Trigger != model.RunTriggerMessage || run.LastMessageID == 0 {
+		return nil, fmt.Errorf("%w: run %s was triggered by %q", ErrNotReplayable, runID, run.Trigger)
+	}
+	calls, err := model.ListRunLLMCalls(d, runID)
+	if err != nil {
+		return nil, fmt.Errorf("load llm calls: %w", err)
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("%w: run %s has no recorded LLM calls", ErrNotReplayable, runID)
+	}
+	execs, err := model.ListRunToolExecutions(d, runID)
+	if err != nil {
+		return nil, fmt.Errorf("load tool executions: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "waynebot-replay-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	snap, err := snapshotForReplay(ctx, d, run, filepath.Join(dir, "replay.db"))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot database: %w", err)
+	}
+	defer snap.Close()
+
+	persona, err := replayPersona(snap, run.PersonaID, calls[0].PersonaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("load persona: %w", err)
+	}
+	ch, err := model.GetChannel(snap, run.ChannelID)
+	if err != nil {
+		return nil, fmt.Errorf("load channel: %w", err)
+	}
+
+	report := &ReplayReport{Run: run}
+	hub := ws.NewHub()
+	go hub.Run()
+	defer hub.Stop()
+	a := &Actor{
+		Persona:  persona,
+		DB:       snap,
+		Hub:      hub,
+		LLM:      &replayLLM{calls: calls, report: report},
+		Tools:    replayTools(execs, report),
+		Status:   NewStatusTracker(),
+		Cursors:  NewCursorStore(snap),
+		Decision: NewDecisionMaker(),
+		Budget:   NewBudgetChecker(snap),
+	}
+	if opts.Embedder != nil {
+		a.Memory = memory.NewStore(snap, opts.Embedder)
+	}
+
+	// Running out of recorded calls is already reported as an extra call.
+	if err := a.respond(ctx, ch); err != nil && !errors.Is(err, errReplayExhausted) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.diverge(DivergeError, report.LLMCalls, "%s", err)
+	}
+
+	for i := report.LLMCalls; i < len(calls); i++ {
+		report.diverge(DivergeMissedCall, i+1, "recorded LLM call was not made")
+	}
+	for i := report.ToolExecutions; i < len(execs); i++ {
+		report.diverge(DivergeMissedTool, i+1, "recorded call to %s was not made", execs[i].ToolName)
+	}
+	return report, nil
+}
+
+// replayTables are the tables a replayed run reads, in foreign key order,
+// with the condition picking the rows it could see. args returns the
+// condition's arguments.
+var replayTables = []struct {
+	name  string
+	where string
+	args  func(run model.AgentRun) []any
+}{
+	{"personas", "1 = 1", nil},
+	{"persona_versions", "persona_id = ?", func(run model.AgentRun) []any { return []any{run.PersonaID} }},
+	{"channels", "1 = 1", nil},
+	{"persona_channel_settings", "persona_id = ?", func(run model.AgentRun) []any { return []any{run.PersonaID} }},
+	{"projects", "1 = 1", nil},
+	{"channel_projects", "channel_id = ?", func(run model.AgentRun) []any { return []any{run.ChannelID} }},
+	{"messages", "channel_id = ? AND id <= ?", func(run model.AgentRun) []any { return []any{run.ChannelID, run.LastMessageID} }},
+	{"memories", "created_at <= (SELECT started_at FROM src.agent_runs WHERE id = ?)", func(run model.AgentRun) []any { return []any{run.ID} }},
+}
+
+// snapshotForReplay creates a database at path with the rows of
+// replayTables that run could see when it started: the channel's messages
+// up to the one it answered and the memories that existed then. The rest of
+// d, mostly recorded LLM calls and tool executions, isn't copied, so
+// replaying many runs doesn't copy the whole database for each.
+func snapshotForReplay(ctx context.Context, d *db.DB, run model.AgentRun, path string) (*db.DB, error) {
+	var src string
+	if err := d.SQL.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&src); err != nil {
+		return nil, err
+	}
+	snap, err := db.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyReplayRows(ctx, snap, src, run); err != nil {
+		snap.Close()
+		return nil, err
+	}
+	return snap, nil
+}
+
+// copyReplayRows attaches the database file src to one of snap's
+// connections, since attachments are per connection, and copies
+// replayTables across.
+func copyReplayRows(ctx context.Context, snap *db.DB, src string, run model.AgentRun) error {
+	conn, err := snap.SQL.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS src", src); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE src")
+
+	for _, t := range replayTables {
+		var args []any
+		if t.args != nil {
+			args = t.args(run)
+		}
+		q := fmt.Sprintf("INSERT INTO main.%s SELECT * FROM src.%s WHERE %s", t.name, t.name, t.where)
+		if _, err := conn.ExecContext(ctx, q, args...); err != nil {
+			return fmt.Errorf("copy %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// replayPersona returns the persona as configured at version, or as it is
+// now if the version wasn't recorded.
+func replayPersona(d *db.DB, personaID int64, version int) (model.Persona, error) {
+	p, err := model.GetPersona(d, personaID)
+	if err != nil || version == 0 || version == p.Version {
+		return p, err
+	}
+	v, err := model.GetPersonaVersion(d, personaID, version)
+	if err != nil {
+		return model.Persona{}, fmt.Errorf("version %d: %w", version, err)
+	}
+	p.Name, p.SystemPrompt, p.Model, p.ToolsEnabled = v.Name, v.SystemPrompt, v.Model, v.ToolsEnabled
+	p.Temperature, p.MaxTokens = v.Temperature, v.MaxTokens
+	p.CooldownSecs, p.MaxTokensPerHour = v.CooldownSecs, v.MaxTokensPerHour
+	p.Version = v.Version
+	return p, nil
+}
+
+// replayLLM answers with a run's recorded responses in order, noting where
+// the requests differ from the recorded ones.
+type replayLLM struct {
+	calls  []model.LLMCall
+	report *ReplayReport
+}
+
+func (l *replayLLM) ChatCompletion(_ context.Context, llmModel string, messages []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	step := l.report.LLMCalls + 1
+	if step > len(l.calls) {
+		l.report.diverge(DivergeExtraCall, step, "LLM call beyond the %d recorded", len(l.calls))
+		return llm.Response{}, errReplayExhausted
+	}
+	rec := l.calls[step-1]
+	l.report.LLMCalls = step
+
+	if llmModel != rec.Model {
+		l.report.diverge(DivergeModel, step, "model %q, recorded %q", llmModel, rec.Model)
+	}
+	got, err := json.Marshal(messages)
+	if err != nil {
+		return llm.Response{}, err
+	}
+	if d := diff.Unified("recorded", "replayed", indentJSON(rec.MessagesJSON), indentJSON(string(got))); d != "" {
+		l.report.diverge(DivergePrompt, step, "%s", d)
+	}
+
+	var resp llm.Response
+	if err := json.Unmarshal([]byte(rec.ResponseJSON), &resp); err != nil {
+		return llm.Response{}, fmt.Errorf("decode recorded response %d: %w", rec.ID, err)
+	}
+	return resp, nil
+}
+
+// indentJSON pretty-prints s so a diff of it is readable, returning s
+// as-is if it isn't JSON.
+func indentJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+		return s
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// replayTools returns a registry whose tools answer with a run's recorded
+// results in order, noting calls that differ from the recorded ones.
+func replayTools(execs []model.ToolExecution, report *ReplayReport) *tools.Registry {
+	call := func(name string, args json.RawMessage) (string, error) {
+		step := report.ToolExecutions + 1
+		if step > len(execs) {
+			report.diverge(DivergeExtraTool, step, "call to %s beyond the %d recorded", name, len(execs))
+			return "", fmt.Errorf("no recorded result for %s", name)
+		}
+		rec := execs[step-1]
+		report.ToolExecutions = step
+
+		if name != rec.ToolName || string(args) != rec.ArgsJSON {
+			report.diverge(DivergeTool, step, "called %s(%s), recorded %s(%s)", name, args, rec.ToolName, rec.ArgsJSON)
+		}
+		if rec.ErrorText != "" {
+			return "", errors.New(rec.ErrorText)
+		}
+		return rec.OutputText, nil
+	}
+
+	reg := tools.NewRegistry()
+	names := llm.AllToolNames()
+	for _, e := range execs {
+		names = append(names, e.ToolName)
+	}
+	for _, name := range names {
+		// Register ignores names already taken.
+		reg.Register(name, func(_ context.Context, args json.RawMessage) (string, error) {
+			return call(name, args)
+		})
+	}
+	return reg
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// recordToolRun has the scenario's persona answer with one shell_exec call
+// and returns the recorded run.
+func recordToolRun(t *testing.T, s *scenario) model.AgentRun {
+	t.Helper()
+	s.mock.responses = []llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "shell_exec", Arguments: `{"command":"ls"}`}}},
+		{Content: "Listed."},
+	}
+	s.postHumanMessage("What's in here?")
+	s.runOnce(context.Background())
+
+	runs, err := model.ListAgentRuns(s.actor.DB, s.persona.ID, 1, 0)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("runs = %+v, err = %v", runs, err)
+	}
+	return runs[0]
+}
+
+func TestReplayMatchesRecording(t *testing.T) {
+	s := newScenario(t)
+	run := recordToolRun(t, s)
+
+	// Later messages and persona edits don't change what is replayed.
+	s.postHumanMessage("Thanks")
+	model.UpdatePersona(s.actor.DB, s.persona.ID, "testbot", "You are a different bot.", "other-model",
+		[]string{"shell_exec"}, 0.7, 100, 0, 0)
+
+	report, err := Replay(context.Background(), s.actor.DB, run.ID, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if report.Diverged() {
+		t.Fatalf("divergences = %+v", report.Divergences)
+	}
+	if report.LLMCalls != 2 || report.ToolExecutions != 1 {
+		t.Errorf("replayed %d LLM calls and %d tool calls, want 2 and 1", report.LLMCalls, report.ToolExecutions)
+	}
+
+	// The live database is left alone.
+	if calls, _ := model.ListRunLLMCalls(s.actor.DB, run.ID); len(calls) != 2 {
+		t.Errorf("recorded calls = %d, want 2", len(calls))
+	}
+	if runs, _ := model.ListAgentRuns(s.actor.DB, s.persona.ID, 10, 0); len(runs) != 1 {
+		t.Errorf("runs = %d after replay, want 1", len(runs))
+	}
+}
+
+func TestReplayReportsDivergence(t *testing.T) {
+	s := newScenario(t)
+	run := recordToolRun(t, s)
+	d := s.actor.DB
+
+	// Make the recording disagree with what the actor does now, as if the
+	// prompt assembly and tool handling had changed since.
+	d.WriteExec("UPDATE llm_calls SET messages_json = replace(messages_json, 'You are a test bot.', 'You were a test bot.') WHERE run_id = ?", run.ID)
+	d.WriteExec(`UPDATE tool_executions SET args_json = '{"command":"pwd"}' WHERE run_id = ?`, run.ID)
+
+	report, err := Replay(context.Background(), d, run.ID, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	kinds := map[string]int{}
+	for _, dv := range report.Divergences {
+		kinds[dv.Kind]++
+		if dv.Kind == DivergePrompt && !strings.Contains(dv.Detail, "+") {
+			t.Errorf("prompt divergence without a diff: %q", dv.Detail)
+		}
+	}
+	if kinds[DivergePrompt] != 2 || kinds[DivergeTool] != 1 || len(report.Divergences) != 3 {
+		t.Errorf("divergences = %+v", report.Divergences)
+	}
+
+	// A run that now makes fewer LLM calls than recorded.
+	d.WriteExec(`UPDATE llm_calls SET response_json = '{"Content":"Done."}' WHERE run_id = ? AND id = (SELECT MIN(id) FROM llm_calls WHERE run_id = ?)`, run.ID, run.ID)
+	report, _ = Replay(context.Background(), d, run.ID, ReplayOptions{})
+	var missed []string
+	for _, dv := range report.Divergences {
+		if dv.Kind == DivergeMissedCall || dv.Kind == DivergeMissedTool {
+			missed = append(missed, dv.Kind)
+		}
+	}
+	if len(missed) != 2 {
+		t.Errorf("divergences = %+v, want a missed LLM call and tool call", report.Divergences)
+	}
+}
+
+func TestReplayStopsWhenRecordingRunsOut(t *testing.T) {
+	s := newScenario(t)
+	run := recordToolRun(t, s)
+	d := s.actor.DB
+
+	// The final answer becomes another tool call, so the actor asks for a
+	// third response the recording doesn't have.
+	d.WriteExec(`UPDATE llm_calls SET response_json = (SELECT response_json FROM llm_calls WHERE run_id = ? ORDER BY id LIMIT 1)
+		WHERE run_id = ? AND id = (SELECT MAX(id) FROM llm_calls WHERE run_id = ?)`, run.ID, run.ID, run.ID)
+
+	report, err := Replay(context.Background(), d, run.ID, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	kinds := map[string]int{}
+	for _, dv := range report.Divergences {
+		kinds[dv.Kind]++
+	}
+	if kinds[DivergeExtraCall] != 1 || kinds[DivergeError] != 0 {
+		t.Errorf("divergences = %+v, want one extra call and no error", report.Divergences)
+	}
+}
+
+func TestSnapshotForReplay(t *testing.T) {
+	s := newScenario(t)
+	run := recordToolRun(t, s)
+	s.postHumanMessage("Thanks")
+	other, _ := model.CreateChannel(s.actor.DB, "other", "", 0)
+	model.CreateMessage(s.actor.DB, other.ID, 1, "human", "alice", "elsewhere")
+
+	snap, err := snapshotForReplay(context.Background(), s.actor.DB, run, filepath.Join(t.TempDir(), "replay.db"))
+	if err != nil {
+		t.Fatalf("snapshotForReplay: %v", err)
+	}
+	defer snap.Close()
+
+	var messages, otherMessages, calls int
+	snap.SQL.QueryRow("SELECT COUNT(*) FROM messages WHERE channel_id = ?", run.ChannelID).Scan(&messages)
+	snap.SQL.QueryRow("SELECT COUNT(*) FROM messages WHERE channel_id = ?", other.ID).Scan(&otherMessages)
+	snap.SQL.QueryRow("SELECT COUNT(*) FROM llm_calls").Scan(&calls)
+	if messages != 1 || otherMessages != 0 || calls != 0 {
+		t.Errorf("snapshot has %d run channel messages, %d other messages and %d LLM calls, want 1, 0 and 0", messages, otherMessages, calls)
+	}
+	if _, err := replayPersona(snap, run.PersonaID, 1); err != nil {
+		t.Errorf("persona missing from snapshot: %v", err)
+	}
+}
+
+func TestReplayRejectsOtherRuns(t *testing.T) {
+	s := newScenario(t)
+	if err := model.CreateAgentRun(s.actor.DB, model.AgentRun{ID: "task-run", PersonaID: s.persona.ID, Trigger: model.RunTriggerTask}); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if _, err := Replay(context.Background(), s.actor.DB, "task-run", ReplayOptions{}); !errors.Is(err, ErrNotReplayable) {
+		t.Errorf("err = %v, want ErrNotReplayable", err)
+	}
+}
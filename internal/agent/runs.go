@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+var (
+	errRunCancelledByUser = errors.New("cancelled by user")
+	errRunSuperseded      = errors.New("superseded by a newer message")
+)
+
+// newRunID returns a random identifier for one respond cycle of an actor.
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RunInfo describes a run in progress.
+type RunInfo struct {
+	ID        string
+	PersonaID int64
+	ChannelID int64
+	Trigger   string
+	StartedAt time.Time
+
+	// LastMessageID is the newest message the run was answering.
+	LastMessageID int64
+}
+
+type activeRun struct {
+	info   RunInfo
+	cancel context.CancelCauseFunc
+}
+
+// RunRegistry tracks in-flight runs by ID so they can be cancelled. A nil
+// registry tracks nothing. Goroutine-safe.
+type RunRegistry struct {
+	mu   sync.Mutex
+	runs map[string]activeRun
+}
+
+// NewRunRegistry creates an empty RunRegistry.
+func NewRunRegistry() *RunRegistry {
+	return &RunRegistry{runs: make(map[string]activeRun)}
+}
+
+func (r *RunRegistry) register(info RunInfo, cancel context.CancelCauseFunc) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[info.ID] = activeRun{info: info, cancel: cancel}
+}
+
+func (r *RunRegistry) unregister(id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runs, id)
+}
+
+// Cancel cancels the persona's run with the given ID, reporting whether
+// such a run was in progress.
+func (r *RunRegistry) Cancel(personaID int64, runID string) bool {
+	return r.cancel(personaID, runID, errRunCancelledByUser)
+}
+
+func (r *RunRegistry) cancel(personaID int64, runID string, cause error) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	run, ok := r.runs[runID]
+	r.mu.Unlock()
+	if !ok || run.info.PersonaID != personaID {
+		return false
+	}
+	run.cancel(cause)
+	return true
+}
+
+// List returns the persona's runs in progress, oldest first.
+func (r *RunRegistry) List(personaID int64) []RunInfo {
+	return r.list(func(info RunInfo) bool { return info.PersonaID == personaID })
+}
+
+// InChannel returns the runs in progress in a channel, oldest first.
+func (r *RunRegistry) InChannel(channelID int64) []RunInfo {
+	return r.list(func(info RunInfo) bool { return info.ChannelID == channelID })
+}
+
+func (r *RunRegistry) list(match func(RunInfo) bool) []RunInfo {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []RunInfo
+	for _, run := range r.runs {
+		if match(run.info) {
+			out = append(out, run.info)
+		}
+	}
+	slices.SortFunc(out, func(a, b RunInfo) int {
+		if c := a.StartedAt.Compare(b.StartedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return out
+}
+
+type runTriggerKey struct{}
+
+// withRunTrigger records in ctx what is starting the run, e.g.
+// model.RunTriggerMessage.
+func withRunTrigger(ctx context.Context, trigger string) context.Context {
+	return context.WithValue(ctx, runTriggerKey{}, trigger)
+}
+
+func runTriggerFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(runTriggerKey{}).(string)
+	return t
+}
+
+// agentRun is the actor's side of a run in progress. ctx ends when the run
+// is cancelled or the actor stops; toolCtx only when the run is cancelled,
+// so a tool isn't cut off by a restart.
+type agentRun struct {
+	RunInfo
+	ctx     context.Context
+	toolCtx context.Context
+	cancel  context.CancelCauseFunc
+
+	// output is the latest text the model produced in the run.
+	output string
+}
+
+// startRun records and registers a run answering history in channelID.
+func (a *Actor) startRun(ctx context.Context, channelID int64, history []model.Message) *agentRun {
+	runCtx, cancelRun := context.WithCancelCause(ctx)
+	toolCtx, cancelTools := context.WithCancelCause(context.Background())
+	run := &agentRun{
+		RunInfo: RunInfo{
+			ID:        newRunID(),
+			PersonaID: a.Persona.ID,
+			ChannelID: channelID,
+			Trigger:   runTriggerFromContext(ctx),
+			StartedAt: time.Now(),
+		},
+		ctx:     runCtx,
+		toolCtx: toolCtx,
+		cancel: func(cause error) {
+			cancelRun(cause)
+			cancelTools(cause)
+		},
+	}
+	if n := len(history); n > 0 {
+		run.LastMessageID = history[n-1].ID
+	}
+
+	if err := model.CreateAgentRun(a.DB, model.AgentRun{
+		ID:            run.ID,
+		PersonaID:     run.PersonaID,
+		ChannelID:     channelID,
+		Trigger:       run.Trigger,
+		LastMessageID: run.LastMessageID,
+	}); err != nil {
+		slog.Error("actor: record run", "persona", a.Persona.Name, "run_id", run.ID, "error", err)
+	}
+	a.Runs.register(run.RunInfo, run.cancel)
+	a.broadcastRun(run, model.RunRunning, "")
+	return run
+}
+
+// finishRun records the run's outcome. A run whose context ended is recorded
+// as cancelled whatever status says.
+func (a *Actor) finishRun(run *agentRun, status, reason string) {
+	a.Runs.unregister(run.ID)
+	if run.ctx.Err() != nil {
+		status, reason = model.RunCancelled, runCancelReason(run.ctx)
+	}
+	run.cancel(nil)
+
+	if err := model.FinishAgentRun(a.DB, run.ID, status, reason, run.output); err != nil {
+		slog.Error("actor: finish run", "persona", a.Persona.Name, "run_id", run.ID, "error", err)
+	}
+	if status == model.RunCancelled {
+		slog.Info("actor: run cancelled", "persona", a.Persona.Name, "run_id", run.ID, "channel_id", run.ChannelID, "reason", reason)
+	}
+	a.broadcastRun(run, status, reason)
+	if a.Traces != nil {
+		go a.exportTrace(run.ID)
+	}
+}
+
+// TraceExporter receives the traces of finished runs, e.g. to send them to
+// an OpenTelemetry collector.
+type TraceExporter interface {
+	ExportRun(ctx context.Context, trace model.RunTrace) error
+}
+
+// traceExportTimeout bounds how long exporting one run's trace may take.
+const traceExportTimeout = 30 * time.Second
+
+// exportTrace sends the finished run's trace to a.Traces.
+func (a *Actor) exportTrace(runID string) {
+	trace, err := model.GetRunTrace(a.DB, runID)
+	if err != nil {
+		slog.Error("actor: load run trace", "persona", a.Persona.Name, "run_id", runID, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	if err := a.Traces.ExportRun(ctx, trace); err != nil {
+		slog.Error("actor: export run trace", "persona", a.Persona.Name, "run_id", runID, "error", err)
+	}
+}
+
+// runCancelReason describes why a run's context ended.
+func runCancelReason(ctx context.Context) string {
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, context.Canceled):
+		return "actor stopped"
+	case errors.Is(cause, context.DeadlineExceeded):
+		return "timed out"
+	}
+	return cause.Error()
+}
+
+// supersedeStaleRuns cancels the persona's message-triggered runs in
+// channelID that started before a human posted there, so the channel's
+// worker starts over with the new messages.
+func (a *Actor) supersedeStaleRuns(channelID int64) {
+	for _, run := range a.Runs.List(a.Persona.ID) {
+		if run.ChannelID != channelID || run.Trigger != model.RunTriggerMessage {
+			continue
+		}
+		msgs, err := model.GetMessagesSince(a.DB, channelID, run.LastMessageID)
+		if err != nil {
+			slog.Error("actor: check for newer messages", "persona", a.Persona.Name, "channel_id", channelID, "error", err)
+			return
+		}
+		if slices.ContainsFunc(msgs, func(m model.Message) bool { return m.AuthorType == "human" }) {
+			a.Runs.cancel(a.Persona.ID, run.ID, errRunSuperseded)
+		}
+	}
+}
+
+// broadcastRun sends an agent_run event via the WebSocket hub.
+func (a *Actor) broadcastRun(run *agentRun, status, reason string) {
+	a.Hub.Broadcast(ws.Event{
+		Type: "agent_run",
+		Data: map[string]any{
+			"run_id":     run.ID,
+			"persona_id": run.PersonaID,
+			"channel_id": run.ChannelID,
+			"trigger":    run.Trigger,
+			"status":     status,
+			"reason":     reason,
+			"started_at": run.StartedAt.UTC().Format(time.RFC3339),
+		},
+	})
+}
@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// waitForActiveRun waits for the persona to have exactly one run in progress and
+// returns it.
+func waitForActiveRun(t *testing.T, s *scenario) RunInfo {
+	t.Helper()
+	var runs []RunInfo
+	waitFor(t, func() bool {
+		runs = s.actor.Runs.List(s.persona.ID)
+		return len(runs) == 1
+	})
+	return runs[0]
+}
+
+func TestRunRecordedAsCompleted(t *testing.T) {
+	s := newScenario(t)
+	s.postHumanMessage("Hi")
+	s.runOnce(context.Background())
+
+	runs, err := model.ListAgentRuns(s.actor.DB, s.persona.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(runs))
+	}
+	r := runs[0]
+	if r.Status != model.RunCompleted || r.Output != "Hello!" || r.Trigger != model.RunTriggerMessage || r.FinishedAt == nil {
+		t.Errorf("run = %+v", r)
+	}
+	if len(s.actor.Runs.List(s.persona.ID)) != 0 {
+		t.Error("expected no runs in progress after the run finished")
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	s := newScenario(t)
+	s.actor.LLM = blockingLLM{}
+	s.postHumanMessage("Take your time")
+
+	done := make(chan struct{})
+	go func() {
+		s.runOnce(context.Background())
+		close(done)
+	}()
+
+	run := waitForActiveRun(t, s)
+	if s.actor.Runs.Cancel(s.persona.ID+1, run.ID) {
+		t.Error("expected another persona's cancel to be refused")
+	}
+	if !s.actor.Runs.Cancel(s.persona.ID, run.ID) {
+		t.Fatal("Cancel returned false for a run in progress")
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not stop after cancel")
+	}
+
+	got, err := model.GetAgentRun(s.actor.DB, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != model.RunCancelled || got.Reason != "cancelled by user" {
+		t.Errorf("run status = %q reason = %q, want cancelled by user", got.Status, got.Reason)
+	}
+	if s.actor.Runs.Cancel(s.persona.ID, run.ID) {
+		t.Error("expected a finished run to be uncancellable")
+	}
+	if got := s.actor.Status.GetChannel(s.persona.ID, s.channel.ID); got != StatusIdle {
+		t.Errorf("channel status = %s, want idle", got)
+	}
+}
+
+func TestCancelRunInterruptsTool(t *testing.T) {
+	s := newScenario(t)
+	registry := tools.NewRegistry()
+	registry.Register("shell_exec", func(ctx context.Context, _ json.RawMessage) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	s.actor.Tools = registry
+	s.mock.responses = []llm.Response{
+		{
+			Content:   "Let me look.",
+			ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "shell_exec", Arguments: `{"command":"sleep 100"}`}},
+		},
+		{Content: "Done!"},
+	}
+	s.postHumanMessage("Run something slow")
+
+	done := make(chan struct{})
+	go func() {
+		s.runOnce(context.Background())
+		close(done)
+	}()
+
+	run := waitForActiveRun(t, s)
+	waitFor(t, func() bool { return s.actor.Status.GetChannel(s.persona.ID, s.channel.ID) == StatusToolCall })
+	s.actor.Runs.Cancel(s.persona.ID, run.ID)
+	<-done
+
+	if n := s.mock.callCount(); n != 1 {
+		t.Errorf("LLM called %d times, want 1", n)
+	}
+	execs, err := model.ListToolExecutions(s.actor.DB, s.persona.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("list tool executions: %v", err)
+	}
+	if len(execs) != 1 || !execs[0].Cancelled {
+		t.Fatalf("tool executions = %+v, want one cancelled", execs)
+	}
+	got, _ := model.GetAgentRun(s.actor.DB, run.ID)
+	if got.Status != model.RunCancelled || got.Output != "Let me look." {
+		t.Errorf("run status = %q output = %q, want cancelled with partial output", got.Status, got.Output)
+	}
+}
+
+// restartLLM blocks its first call until the context ends and answers the
+// rest with the latest message's text.
+type restartLLM struct {
+	calls atomic.Int32
+}
+
+func (l *restartLLM) ChatCompletion(ctx context.Context, _ string, msgs []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	if l.calls.Add(1) == 1 {
+		<-ctx.Done()
+		return llm.Response{}, ctx.Err()
+	}
+	last, _ := json.Marshal(msgs[len(msgs)-1])
+	if strings.Contains(string(last), "actually") {
+		return llm.Response{Content: "fresh answer"}, nil
+	}
+	return llm.Response{Content: "stale answer"}, nil
+}
+
+func TestRestartOnNewMessage(t *testing.T) {
+	s := newScenario(t)
+	s.actor.LLM = &restartLLM{}
+	s.actor.RestartOnNewMessage = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.actor.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	s.postHumanMessage("Write me a poem")
+	s.hub.Broadcast(ws.Event{Type: "new_message"})
+	first := waitForActiveRun(t, s)
+
+	s.postHumanMessage("actually, make it a haiku")
+	s.hub.Broadcast(ws.Event{Type: "new_message"})
+
+	waitFor(t, func() bool { return hasAgentMessage(t, s, s.channel.ID, "fresh answer") })
+	if hasAgentMessage(t, s, s.channel.ID, "stale answer") {
+		t.Error("the superseded run should not have answered")
+	}
+	got, err := model.GetAgentRun(s.actor.DB, first.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != model.RunCancelled || got.Reason != "superseded by a newer message" {
+		t.Errorf("first run status = %q reason = %q, want superseded", got.Status, got.Reason)
+	}
+}
+
+func TestRestartOnNewMessageIgnoresAgentMessages(t *testing.T) {
+	s := newScenario(t)
+	s.actor.LLM = blockingLLM{}
+	s.postHumanMessage("Hello")
+
+	done := make(chan struct{})
+	go func() {
+		s.runOnce(context.Background())
+		close(done)
+	}()
+	run := waitForActiveRun(t, s)
+
+	if _, err := model.CreateMessage(s.actor.DB, s.channel.ID, 42, "agent", "otherbot", "me too"); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	s.actor.supersedeStaleRuns(s.channel.ID)
+	if runs := s.actor.Runs.List(s.persona.ID); len(runs) != 1 {
+		t.Error("an agent message should not supersede the run")
+	}
+
+	s.actor.Runs.Cancel(s.persona.ID, run.ID)
+	<-done
+}
+
+func TestStartAllFailsInterruptedRuns(t *testing.T) {
+	sup, _ := newSupervisor(t)
+	p, _ := model.CreatePersona(sup.DB, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	if err := model.CreateAgentRun(sup.DB, model.AgentRun{ID: "stale", PersonaID: p.ID}); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	if err := sup.StartAll(); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	sup.StopAll()
+
+	got, _ := model.GetAgentRun(sup.DB, "stale")
+	if got.Status != model.RunFailed || got.Reason != "interrupted by shutdown" {
+		t.Errorf("stale run status = %q reason = %q", got.Status, got.Reason)
+	}
+}
+
+type traceRecorder struct{ traces chan model.RunTrace }
+
+func (r *traceRecorder) ExportRun(_ context.Context, trace model.RunTrace) error {
+	r.traces <- trace
+	return nil
+}
+
+func TestRunTrace(t *testing.T) {
+	s := newScenario(t)
+	s.mock.responses = []llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "shell_exec", Arguments: `{"command":"ls"}`}}},
+		{Content: "Done."},
+	}
+	recorder := &traceRecorder{traces: make(chan model.RunTrace, 1)}
+	s.actor.Traces = recorder
+	trigger := s.postHumanMessage("list files")
+	s.runOnce(context.Background())
+
+	var trace model.RunTrace
+	select {
+	case trace = <-recorder.traces:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run trace was not exported")
+	}
+	var kinds []string
+	for _, ev := range trace.Events {
+		kinds = append(kinds, ev.Kind)
+	}
+	want := []string{model.TraceTrigger, model.TraceLLMCall, model.TraceToolExecution, model.TraceLLMCall, model.TraceMessage}
+	if strings.Join(kinds, ",") != strings.Join(want, ",") {
+		t.Fatalf("trace = %v, want %v", kinds, want)
+	}
+	if trace.Events[0].Message.ID != trigger.ID || trace.Events[4].Message.Content != "Done." {
+		t.Errorf("messages = %+v, %+v", trace.Events[0].Message, trace.Events[4].Message)
+	}
+	exec := trace.Events[2].ToolExecution
+	if exec.ChannelID != s.channel.ID || exec.RunID != trace.Run.ID || exec.StartedAt.IsZero() {
+		t.Errorf("tool execution = %+v", exec)
+	}
+	if call := trace.Events[1].LLMCall; call.StartedAt.IsZero() || call.RunID != trace.Run.ID {
+		t.Errorf("llm call = %+v", call)
+	}
+}
@@ -16,6 +16,7 @@ const (
 	StatusStopped
 	StatusBudgetExceeded
 	StatusContextFull
+	StatusCrashed
 )
 
 func (s Status) String() string {
@@ -34,26 +35,67 @@ func (s Status) String() string {
 		return "budget_exceeded"
 	case StatusContextFull:
 		return "context_full"
+	case StatusCrashed:
+		return "crashed"
 	default:
 		return "unknown"
 	}
 }
 
-// StatusTracker tracks the current status of each persona. Goroutine-safe.
+// rank orders statuses for summarizing a persona's channels: the most
+// pressing channel status becomes the persona's.
+func (s Status) rank() int {
+	switch s {
+	case StatusToolCall:
+		return 5
+	case StatusThinking:
+		return 4
+	case StatusError:
+		return 3
+	case StatusContextFull:
+		return 2
+	case StatusBudgetExceeded:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// StatusTracker tracks the status of each persona and of each channel it
+// works in. Goroutine-safe.
 type StatusTracker struct {
 	mu       sync.RWMutex
 	statuses map[int64]Status
+	channels map[int64]map[int64]Status
 }
 
 // NewStatusTracker creates a new StatusTracker.
 func NewStatusTracker() *StatusTracker {
-	return &StatusTracker{statuses: make(map[int64]Status)}
+	return &StatusTracker{
+		statuses: make(map[int64]Status),
+		channels: make(map[int64]map[int64]Status),
+	}
 }
 
-// Get returns the current status for a persona. Returns StatusIdle if not set.
+// Get returns the current status for a persona: the most pressing of its
+// channel statuses, or the persona-wide status when no channel has one.
+// Returns StatusIdle if not set.
 func (st *StatusTracker) Get(personaID int64) Status {
 	st.mu.RLock()
 	defer st.mu.RUnlock()
+	return st.getLocked(personaID)
+}
+
+func (st *StatusTracker) getLocked(personaID int64) Status {
+	if chans := st.channels[personaID]; len(chans) > 0 {
+		out := StatusIdle
+		for _, s := range chans {
+			if s.rank() > out.rank() {
+				out = s
+			}
+		}
+		return out
+	}
 	s, ok := st.statuses[personaID]
 	if !ok {
 		return StatusIdle
@@ -61,18 +103,58 @@ func (st *StatusTracker) Get(personaID int64) Status {
 	return s
 }
 
-// Set updates the status for a persona.
+// Set updates the persona-wide status, clearing its channel statuses. Use it
+// when the persona as a whole starts or stops.
 func (st *StatusTracker) Set(personaID int64, s Status) {
 	st.mu.Lock()
 	defer st.mu.Unlock()
 	st.statuses[personaID] = s
+	delete(st.channels, personaID)
 }
 
-// All returns a snapshot of all persona statuses.
+// GetChannel returns a persona's status in a channel. Returns StatusIdle if
+// not set.
+func (st *StatusTracker) GetChannel(personaID, channelID int64) Status {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	s, ok := st.channels[personaID][channelID]
+	if !ok {
+		return StatusIdle
+	}
+	return s
+}
+
+// SetChannel updates a persona's status in a channel.
+func (st *StatusTracker) SetChannel(personaID, channelID int64, s Status) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	chans, ok := st.channels[personaID]
+	if !ok {
+		chans = make(map[int64]Status)
+		st.channels[personaID] = chans
+	}
+	chans[channelID] = s
+}
+
+// Channels returns a snapshot of a persona's channel statuses.
+func (st *StatusTracker) Channels(personaID int64) map[int64]Status {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	out := make(map[int64]Status, len(st.channels[personaID]))
+	maps.Copy(out, st.channels[personaID])
+	return out
+}
+
+// All returns a snapshot of all persona statuses, as reported by Get.
 func (st *StatusTracker) All() map[int64]Status {
 	st.mu.RLock()
 	defer st.mu.RUnlock()
 	out := make(map[int64]Status, len(st.statuses))
-	maps.Copy(out, st.statuses)
+	for id := range st.statuses {
+		out[id] = st.getLocked(id)
+	}
+	for id := range st.channels {
+		out[id] = st.getLocked(id)
+	}
 	return out
 }
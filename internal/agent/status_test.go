@@ -65,3 +65,36 @@ func TestStatusTrackerConcurrent(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestStatusTrackerChannels(t *testing.T) {
+	st := NewStatusTracker()
+	st.Set(1, StatusIdle)
+
+	st.SetChannel(1, 10, StatusThinking)
+	st.SetChannel(1, 20, StatusError)
+	if got := st.GetChannel(1, 20); got != StatusError {
+		t.Errorf("channel 20 = %s, want error", got)
+	}
+	if got := st.GetChannel(1, 30); got != StatusIdle {
+		t.Errorf("unset channel = %s, want idle", got)
+	}
+	if got := st.Get(1); got != StatusThinking {
+		t.Errorf("persona = %s, want thinking while a channel is busy", got)
+	}
+
+	st.SetChannel(1, 10, StatusIdle)
+	if got := st.Get(1); got != StatusError {
+		t.Errorf("persona = %s, want error", got)
+	}
+	if got := st.All()[1]; got != StatusError {
+		t.Errorf("All()[1] = %s, want error", got)
+	}
+	if chans := st.Channels(1); len(chans) != 2 || chans[10] != StatusIdle {
+		t.Errorf("channels = %v", chans)
+	}
+
+	st.Set(1, StatusStopped)
+	if got := st.Get(1); got != StatusStopped || len(st.Channels(1)) != 0 {
+		t.Errorf("after stop: persona = %s, channels = %v", got, st.Channels(1))
+	}
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// summaryMessages is how many of a channel's latest messages a summary
+// covers.
+const summaryMessages = 100
+
+const summaryPrompt = `Summarize the conversation below for someone catching up on it: the main topics, ` +
+	`what was decided and what is still open. Be brief, and use a short list when it helps.`
+
+// ErrNothingToSummarize is returned by Summarize for a channel without
+// messages.
+var ErrNothingToSummarize = errors.New("nothing to summarize yet")
+
+// Summarize has the persona summarize a channel's recent messages, with the
+// persona's settings for that channel. The call counts against the persona's
+// token budget like any other.
+func (s *Supervisor) Summarize(ctx context.Context, p model.Persona, channelID int64) (string, error) {
+	msgs, err := model.GetRecentMessages(s.DB, channelID, summaryMessages)
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "", ErrNothingToSummarize
+	}
+	reverseMessages(msgs)
+
+	actor := s.newActor(p)
+	persona := actor.channelPersona(channelID)
+	ok, err := s.Budget.WithinBudget(p.ID, persona.MaxTokensPerHour)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is over its hourly token budget", p.Name)
+	}
+
+	var transcript strings.Builder
+	for _, m := range msgs {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.AuthorName, m.Content)
+	}
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(persona.SystemPrompt + "\n\n" + summaryPrompt),
+		openai.UserMessage(transcript.String()),
+	}
+	start := time.Now()
+	resp, err := s.LLM.ChatCompletion(ctx, persona.Model, messages, nil, persona.Temperature, persona.MaxTokens)
+	duration := time.Since(start)
+	observeLLMCall(persona.Name, persona.Model, start, resp, err)
+	if err != nil {
+		return "", err
+	}
+	actor.recordLLMCall("", channelID, persona.Model, messages, resp, start, duration)
+	if strings.TrimSpace(resp.Content) == "" {
+		return "", fmt.Errorf("%s did not produce a summary", p.Name)
+	}
+	return resp.Content, nil
+}
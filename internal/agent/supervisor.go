@@ -2,15 +2,25 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/events"
+	"github.com/waynenilsen/waynebot/internal/memory"
 	"github.com/waynenilsen/waynebot/internal/model"
 	"github.com/waynenilsen/waynebot/internal/tools"
 	"github.com/waynenilsen/waynebot/internal/ws"
 )
 
+// ErrActorRunning is returned by StartActor when the actor is already
+// running.
+var ErrActorRunning = errors.New("actor already running")
+
+var errPersonaDeleted = errors.New("persona deleted")
+
 // Supervisor manages actor goroutines, one per persona.
 type Supervisor struct {
 	DB       *db.DB
@@ -22,19 +32,87 @@ type Supervisor struct {
 	Decision *DecisionMaker
 	Budget   *BudgetChecker
 
+	// Worktrees enables per-persona git worktrees when non-nil.
+	Worktrees *tools.Worktrees
+
+	// StageChanges makes actors propose file changes for review instead of
+	// writing them directly.
+	StageChanges bool
+
+	// Memory, when set, is searched for memories relevant to each
+	// conversation before the LLM is called.
+	Memory *memory.Store
+
+	// MaxConcurrentChannels bounds how many channels each actor works in at
+	// once; zero means DefaultMaxConcurrentChannels.
+	MaxConcurrentChannels int
+
+	// RestartOnNewMessage makes actors abandon a reply in progress when a
+	// human posts in its channel and start over.
+	RestartOnNewMessage bool
+
+	// MaxJobAttempts and JobRetryBackoff control how actors retry failed
+	// jobs; zero values mean the Default constants.
+	MaxJobAttempts  int
+	JobRetryBackoff time.Duration
+
+	// Traces, when set, is sent the trace of every finished run.
+	Traces TraceExporter
+
+	// Archiver, when set, is the archiver purging old activity, whose
+	// archives the API browses and restores.
+	Archiver *Archiver
+
+	// Runs tracks every actor's runs in progress.
+	Runs *RunRegistry
+
+	// MaxDelegationDepth bounds how deeply delegate calls may nest; zero
+	// means DefaultMaxDelegationDepth.
+	MaxDelegationDepth int
+
+	// TemplateDir holds persona bundle files offered as templates alongside
+	// the built-in ones.
+	TemplateDir string
+
+	// Workflows runs multi-agent workflows as this supervisor's personas.
+	Workflows *WorkflowRunner
+
+	// Events carries persona lifecycle changes. While the supervisor is
+	// running it starts actors for new personas, reloads edited ones and
+	// stops deleted ones.
+	Events *events.Bus
+
+	// RestartBackoff is the delay before restarting a crashed actor,
+	// doubling with each further crash up to MaxRestartBackoff. An actor
+	// that crashes CrashLimit times within CrashWindow is left down. Zero
+	// values mean the Default constants.
+	RestartBackoff    time.Duration
+	MaxRestartBackoff time.Duration
+	CrashLimit        int
+	CrashWindow       time.Duration
+
+	healthMu sync.Mutex
+	health   map[int64]*actorHealth
+
 	mu      sync.Mutex
 	actors  map[int64]actorHandle
 	wg      sync.WaitGroup
 	running bool
+
+	runsRecovered bool
 }
 
 type actorHandle struct {
 	cancel context.CancelFunc
+
+	// reload asks the actor to drain so it can be replaced with one built
+	// from the persona's current settings.
+	reload chan struct{}
 }
 
 // NewSupervisor creates a Supervisor with all required dependencies.
 func NewSupervisor(database *db.DB, hub *ws.Hub, llmClient LLMClient, toolsRegistry *tools.Registry) *Supervisor {
-	return &Supervisor{
+	s := &Supervisor{
 		DB:       database,
 		Hub:      hub,
 		LLM:      llmClient,
@@ -43,7 +121,12 @@ func NewSupervisor(database *db.DB, hub *ws.Hub, llmClient LLMClient, toolsRegis
 		Cursors:  NewCursorStore(database),
 		Decision: NewDecisionMaker(),
 		Budget:   NewBudgetChecker(database),
+		Runs:     NewRunRegistry(),
+		Events:   events.NewBus(),
 	}
+	s.Workflows = NewWorkflowRunner(s)
+	s.Events.Subscribe(s.handlePersonaEvent)
+	return s
 }
 
 // Running returns true if the supervisor has been started.
@@ -66,6 +149,14 @@ func (s *Supervisor) StartAll() error {
 	if s.actors == nil {
 		s.actors = make(map[int64]actorHandle)
 	}
+	if !s.runsRecovered {
+		// Nothing has run yet in this process, so any run still marked
+		// running was cut short when it last stopped.
+		if err := model.FailRunningAgentRuns(s.DB, "interrupted by shutdown"); err != nil {
+			slog.Error("supervisor: fail interrupted runs", "error", err)
+		}
+		s.runsRecovered = true
+	}
 
 	for _, p := range personas {
 		if _, exists := s.actors[p.ID]; exists {
@@ -111,12 +202,125 @@ func (s *Supervisor) RestartActor(personaID int64) error {
 	return nil
 }
 
-// startActorLocked starts a goroutine for the given persona. Must be called with s.mu held.
+// StopActor stops a single actor, cancelling its restart if it crashed.
+// It reports whether the actor was running.
+func (s *Supervisor) StopActor(personaID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.actors[personaID]
+	if ok {
+		h.cancel()
+		delete(s.actors, personaID)
+	}
+	return ok
+}
+
+// StartActor starts a single persona's actor, even if the supervisor isn't
+// running. It returns ErrActorRunning if the actor is already running.
+func (s *Supervisor) StartActor(personaID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.actors[personaID]; ok {
+		return ErrActorRunning
+	}
+
+	persona, err := model.GetPersona(s.DB, personaID)
+	if err != nil {
+		return err
+	}
+
+	if s.actors == nil {
+		s.actors = make(map[int64]actorHandle)
+	}
+	s.startActorLocked(persona)
+	return nil
+}
+
+// ActorRunning reports whether the persona's actor is running, or waiting
+// to restart after a crash.
+func (s *Supervisor) ActorRunning(personaID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.actors[personaID]
+	return ok
+}
+
+// ReloadActor makes a persona's actor pick up changes to the persona. Unlike
+// RestartActor it doesn't cut off runs in progress: the actor stops taking
+// new work, and once its runs finish it is replaced by one built from the
+// persona as it is now. It reports whether the actor was running.
+func (s *Supervisor) ReloadActor(personaID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.actors[personaID]
+	if ok {
+		select {
+		case h.reload <- struct{}{}:
+		default:
+			// A reload is already pending; it will read the latest.
+		}
+	}
+	return ok
+}
+
+// handlePersonaEvent keeps the actors in step with persona changes while
+// the supervisor is running.
+func (s *Supervisor) handlePersonaEvent(e events.Event) {
+	switch e.Type {
+	case events.PersonaCreated:
+		if !s.Running() {
+			return
+		}
+		if err := s.StartActor(e.PersonaID); err != nil && !errors.Is(err, ErrActorRunning) {
+			slog.Error("supervisor: start actor for new persona", "persona_id", e.PersonaID, "error", err)
+		}
+	case events.PersonaUpdated:
+		s.ReloadActor(e.PersonaID)
+	case events.PersonaDeleted:
+		s.StopActor(e.PersonaID)
+		for _, run := range s.Runs.List(e.PersonaID) {
+			s.Runs.cancel(e.PersonaID, run.ID, errPersonaDeleted)
+		}
+		s.removeWorktrees(e.PersonaID)
+	}
+}
+
+// removeWorktrees deletes a deleted persona's worktrees. Its branches are
+// kept so its work can still be merged.
+func (s *Supervisor) removeWorktrees(personaID int64) {
+	if s.Worktrees == nil {
+		return
+	}
+	projects, err := model.ListProjects(s.DB)
+	if err != nil {
+		slog.Error("supervisor: list projects for worktree cleanup", "persona_id", personaID, "error", err)
+		return
+	}
+	for _, proj := range projects {
+		if err := s.Worktrees.Remove(context.Background(), proj.ID, proj.Path, personaID); err != nil {
+			slog.Warn("supervisor: remove worktree", "persona_id", personaID, "project", proj.Name, "error", err)
+		}
+	}
+}
+
+// startActorLocked starts a goroutine supervising the given persona's actor.
+// Must be called with s.mu held.
 func (s *Supervisor) startActorLocked(p model.Persona) {
 	ctx, cancel := context.WithCancel(context.Background())
-	s.actors[p.ID] = actorHandle{cancel: cancel}
+	reload := make(chan struct{}, 1)
+	s.actors[p.ID] = actorHandle{cancel: cancel, reload: reload}
+	s.resetCircuit(p.ID)
 
-	actor := &Actor{
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(ctx, p, reload)
+	}()
+}
+
+// newActor builds an actor for the persona from the supervisor's dependencies.
+func (s *Supervisor) newActor(p model.Persona) *Actor {
+	return &Actor{
 		Persona:  p,
 		DB:       s.DB,
 		Hub:      s.Hub,
@@ -126,13 +330,39 @@ func (s *Supervisor) startActorLocked(p model.Persona) {
 		Cursors:  s.Cursors,
 		Decision: s.Decision,
 		Budget:   s.Budget,
+
+		Worktrees:             s.Worktrees,
+		StageChanges:          s.StageChanges,
+		Memory:                s.Memory,
+		MaxConcurrentChannels: s.MaxConcurrentChannels,
+		Runs:                  s.Runs,
+		RestartOnNewMessage:   s.RestartOnNewMessage,
+		MaxJobAttempts:        s.MaxJobAttempts,
+		JobRetryBackoff:       s.JobRetryBackoff,
+		Traces:                s.Traces,
 	}
+}
 
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		slog.Info("supervisor: starting actor", "persona", p.Name, "persona_id", p.ID)
-		actor.Run(ctx)
-		slog.Info("supervisor: actor stopped", "persona", p.Name, "persona_id", p.ID)
-	}()
+// ResetContext makes the persona start afresh in a channel: it skips the
+// channel's messages so far, cancelling any jobs queued for them, clears its
+// status there and posts a notice.
+func (s *Supervisor) ResetContext(p model.Persona, channelID int64) (model.Message, error) {
+	latestID, err := model.GetLatestMessageID(s.DB, channelID)
+	if err != nil {
+		return model.Message{}, err
+	}
+	if err := model.ResetAgentCursor(s.DB, p.ID, channelID, latestID); err != nil {
+		return model.Message{}, err
+	}
+	s.Status.SetChannel(p.ID, channelID, StatusIdle)
+
+	msg, err := model.CreateMessage(s.DB, channelID, p.ID, "agent", p.Name, "Context has been reset. I'm ready to continue.")
+	if err != nil {
+		return model.Message{}, err
+	}
+	s.Hub.Broadcast(ws.Event{
+		Type: "new_message",
+		Data: msg,
+	})
+	return msg, nil
 }
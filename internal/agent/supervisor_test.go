@@ -2,10 +2,17 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/events"
 	"github.com/waynenilsen/waynebot/internal/llm"
 	"github.com/waynenilsen/waynebot/internal/model"
 	"github.com/waynenilsen/waynebot/internal/tools"
@@ -154,3 +161,189 @@ func waitFor(t *testing.T, cond func() bool) {
 	}
 	t.Fatal("waitFor timed out")
 }
+
+func TestSummarize(t *testing.T) {
+	sup, _ := newSupervisor(t)
+	mock := &mockLLM{responses: []llm.Response{{Content: "They agreed to ship on Friday.", PromptTokens: 50, CompletionTokens: 8}}}
+	sup.LLM = mock
+	p, _ := model.CreatePersona(sup.DB, "bot", "You are helpful.", "model", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(sup.DB, "general", "", 0)
+
+	if _, err := sup.Summarize(context.Background(), p, ch.ID); err != ErrNothingToSummarize {
+		t.Fatalf("empty channel: err = %v, want ErrNothingToSummarize", err)
+	}
+
+	model.CreateMessage(sup.DB, ch.ID, 1, "human", "alice", "Shall we ship on Friday?")
+	model.CreateMessage(sup.DB, ch.ID, 2, "human", "bob", "Friday works.")
+
+	summary, err := sup.Summarize(context.Background(), p, ch.ID)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if summary != "They agreed to ship on Friday." {
+		t.Errorf("summary = %q", summary)
+	}
+
+	msgs := mock.getLastMessages()
+	if len(msgs) != 2 || msgs[1].OfUser == nil || !strings.Contains(msgs[1].OfUser.Content.OfString.Value, "bob: Friday works.") {
+		t.Errorf("transcript not sent as the user message: %+v", msgs)
+	}
+	calls, _ := model.ListLLMCalls(sup.DB, p.ID, 10, 0)
+	if len(calls) != 1 {
+		t.Errorf("llm calls recorded = %d, want 1", len(calls))
+	}
+
+	// Posting nothing: the summary is only for the caller.
+	if got, _ := model.GetRecentMessages(sup.DB, ch.ID, 10); len(got) != 2 {
+		t.Errorf("messages = %d, want 2", len(got))
+	}
+}
+
+func TestSupervisorFollowsPersonaEvents(t *testing.T) {
+	sup, _ := newSupervisor(t)
+	sup.Events = events.NewBus()
+	sup.Events.Subscribe(sup.handlePersonaEvent)
+	if err := sup.StartAll(); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	t.Cleanup(sup.StopAll)
+
+	p, _ := model.CreatePersona(sup.DB, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	sup.Events.Publish(events.Event{Type: events.PersonaCreated, PersonaID: p.ID})
+	if !sup.ActorRunning(p.ID) {
+		t.Fatal("actor not started for new persona")
+	}
+	waitFor(t, func() bool { return sup.Status.Get(p.ID) == StatusIdle })
+
+	model.DeletePersona(sup.DB, p.ID)
+	sup.Events.Publish(events.Event{Type: events.PersonaDeleted, PersonaID: p.ID})
+	if sup.ActorRunning(p.ID) {
+		t.Error("actor still running for deleted persona")
+	}
+}
+
+func TestSupervisorRemovesDeletedPersonaWorktrees(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	sup, _ := newSupervisor(t)
+	sup.Worktrees = tools.NewWorktrees(t.TempDir())
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	proj, _ := model.CreateProject(sup.DB, "repo", repo, "")
+	p, _ := model.CreatePersona(sup.DB, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	dir, err := sup.Worktrees.Ensure(context.Background(), proj.ID, proj.Path, p.ID, p.Name)
+	if err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+
+	model.DeletePersona(sup.DB, p.ID)
+	sup.handlePersonaEvent(events.Event{Type: events.PersonaDeleted, PersonaID: p.ID})
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("worktree still present: %v", err)
+	}
+	if branch, _ := tools.FindPersonaBranch(context.Background(), repo, p.ID); branch != tools.PersonaBranch(p.ID, p.Name) {
+		t.Errorf("persona branch = %q, want it kept", branch)
+	}
+}
+
+func TestSupervisorIgnoresNewPersonaWhenStopped(t *testing.T) {
+	sup, _ := newSupervisor(t)
+	sup.Events = events.NewBus()
+	sup.Events.Subscribe(sup.handlePersonaEvent)
+
+	p, _ := model.CreatePersona(sup.DB, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	sup.Events.Publish(events.Event{Type: events.PersonaCreated, PersonaID: p.ID})
+	if sup.ActorRunning(p.ID) {
+		t.Error("actor started while the supervisor is stopped")
+	}
+}
+
+func TestSupervisorStartActor(t *testing.T) {
+	sup, _ := newSupervisor(t)
+	p, _ := model.CreatePersona(sup.DB, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	t.Cleanup(sup.StopAll)
+
+	if err := sup.StartActor(p.ID); err != nil {
+		t.Fatalf("StartActor: %v", err)
+	}
+	if err := sup.StartActor(p.ID); err != ErrActorRunning {
+		t.Errorf("second StartActor: err = %v, want ErrActorRunning", err)
+	}
+	if !sup.StopActor(p.ID) {
+		t.Error("StopActor reported the actor wasn't running")
+	}
+	waitFor(t, func() bool { return sup.Status.Get(p.ID) == StatusStopped })
+}
+
+// modelLLM records the model of each call and holds calls whose latest
+// message mentions "slow" until release is closed.
+type modelLLM struct {
+	release chan struct{}
+
+	mu     sync.Mutex
+	models []string
+}
+
+func (m *modelLLM) ChatCompletion(ctx context.Context, modelName string, msgs []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	m.mu.Lock()
+	m.models = append(m.models, modelName)
+	m.mu.Unlock()
+
+	last, _ := json.Marshal(msgs[len(msgs)-1])
+	if !strings.Contains(string(last), "slow") {
+		return llm.Response{Content: "quick answer"}, nil
+	}
+	select {
+	case <-m.release:
+		return llm.Response{Content: "slow answer"}, nil
+	case <-ctx.Done():
+		return llm.Response{}, ctx.Err()
+	}
+}
+
+func (m *modelLLM) calledWith(modelName string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Contains(m.models, modelName)
+}
+
+func TestSupervisorReloadKeepsRunInProgress(t *testing.T) {
+	client := &modelLLM{release: make(chan struct{})}
+	sup, p, ch := crashScenario(t, client, func(s *Supervisor) { s.Runs = NewRunRegistry() })
+
+	model.CreateMessage(sup.DB, ch.ID, 1, "human", "alice", "a slow question")
+	sup.Hub.Broadcast(ws.Event{Type: "new_message"})
+	waitFor(t, func() bool { return len(sup.Runs.List(p.ID)) == 1 })
+	run := sup.Runs.List(p.ID)[0]
+
+	if err := model.UpdatePersona(sup.DB, p.ID, p.Name, p.SystemPrompt, "new-model", p.ToolsEnabled, p.Temperature, p.MaxTokens, p.CooldownSecs, p.MaxTokensPerHour); err != nil {
+		t.Fatalf("update persona: %v", err)
+	}
+	if !sup.ReloadActor(p.ID) {
+		t.Fatal("ReloadActor reported the actor wasn't running")
+	}
+	close(client.release)
+
+	waitFor(t, func() bool {
+		r, err := model.GetAgentRun(sup.DB, run.ID)
+		return err == nil && r.Status != model.RunRunning
+	})
+	if r, _ := model.GetAgentRun(sup.DB, run.ID); r.Status != model.RunCompleted {
+		t.Fatalf("run in progress during reload ended %s (%s), want completed", r.Status, r.Reason)
+	}
+
+	waitFor(t, func() bool { return sup.Health(p.ID).Reloads == 1 })
+	poke(sup, ch)
+	waitFor(t, func() bool { return client.calledWith("new-model") })
+}
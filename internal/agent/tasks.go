@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+)
+
+// processTasks wakes the persona for changes others made to tasks assigned
+// to it since the last check, running once per changed task.
+func (a *Actor) processTasks(ctx context.Context) {
+	events, err := model.ListAssignedTaskEventsSince(a.DB, a.Persona.ID, a.taskCursor)
+	if err != nil {
+		slog.Error("actor: list task events", "persona", a.Persona.Name, "error", err)
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	// Over budget the changes are left to wake the persona later.
+	ok, err := a.Budget.WithinBudget(a.Persona.ID, a.Persona.MaxTokensPerHour)
+	if err != nil {
+		slog.Error("actor: budget check", "persona", a.Persona.Name, "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	var order []int64
+	byTask := make(map[int64][]model.TaskEvent)
+	for _, e := range events {
+		if _, seen := byTask[e.TaskID]; !seen {
+			order = append(order, e.TaskID)
+		}
+		byTask[e.TaskID] = append(byTask[e.TaskID], e)
+	}
+	for _, id := range order {
+		if ctx.Err() == nil {
+			a.respondToTask(ctx, id, byTask[id])
+		}
+		if ctx.Err() != nil {
+			// The run may have been cut short, so wake for this task and
+			// the ones after it again.
+			a.saveTaskCursor(byTask[id][0].ID - 1)
+			return
+		}
+	}
+	a.saveTaskCursor(events[len(events)-1].ID)
+}
+
+// loadTaskCursor picks up the task cursor where the persona left off. The
+// first time the persona runs, only task changes made from then on wake it.
+func (a *Actor) loadTaskCursor() {
+	id, ok, err := a.Cursors.TaskCursor(a.Persona.ID)
+	if err != nil {
+		slog.Error("actor: get task cursor", "persona", a.Persona.Name, "error", err)
+		return
+	}
+	if !ok {
+		if id, err = model.LatestTaskEventID(a.DB); err != nil {
+			slog.Error("actor: latest task event", "persona", a.Persona.Name, "error", err)
+			return
+		}
+		a.saveTaskCursor(id)
+		return
+	}
+	a.taskCursor = id
+}
+
+// saveTaskCursor moves the task cursor to the event with the given ID.
+func (a *Actor) saveTaskCursor(id int64) {
+	a.taskCursor = id
+	if err := a.Cursors.SetTaskCursor(a.Persona.ID, id); err != nil {
+		slog.Error("actor: save task cursor", "persona", a.Persona.Name, "error", err)
+	}
+}
+
+// respondToTask runs the persona on a changed task. A task linked to a
+// channel is handled there with the channel's history; otherwise the
+// persona's answer is recorded as a comment on the task.
+func (a *Actor) respondToTask(ctx context.Context, taskID int64, events []model.TaskEvent) {
+	task, err := model.GetTask(a.DB, taskID)
+	if err != nil {
+		slog.Error("actor: get task", "persona", a.Persona.Name, "task_id", taskID, "error", err)
+		return
+	}
+
+	var ch model.Channel
+	var history []model.Message
+	var projects []model.Project
+	if task.ChannelID != 0 {
+		if ch, err = model.GetChannel(a.DB, task.ChannelID); err != nil {
+			slog.Error("actor: get task channel", "persona", a.Persona.Name, "task_id", taskID, "error", err)
+			return
+		}
+		if history, err = model.GetRecentMessages(a.DB, ch.ID, 50); err != nil {
+			slog.Error("actor: get history", "persona", a.Persona.Name, "error", err)
+			return
+		}
+		reverseMessages(history)
+		projects, _ = model.ListChannelProjects(a.DB, ch.ID)
+	}
+	if task.ProjectID != 0 {
+		if p, err := model.GetProject(a.DB, task.ProjectID); err == nil {
+			projects = []model.Project{p}
+		}
+	}
+
+	var post func(string) model.Message
+	if ch.ID == 0 {
+		// Staged changesets are reviewed per channel, so a task without
+		// one gets no project tools when changes must be staged.
+		if a.StageChanges {
+			projects = nil
+		}
+		post = func(content string) model.Message {
+			a.commentOnTask(task.ID, content)
+			return model.Message{}
+		}
+	}
+
+	history = append(history, model.Message{AuthorType: "task", Content: formatTaskWake(task, events)})
+
+	defer a.beginRun(ch.ID)()
+	a.converse(withRunTrigger(ctx, model.RunTriggerTask), ch, history, projects, post)
+}
+
+// commentOnTask records the persona's answer on a task.
+func (a *Actor) commentOnTask(taskID int64, body string) {
+	by := model.TaskAuthor{Type: "agent", ID: a.Persona.ID, Name: a.Persona.Name}
+	if _, err := model.AddTaskComment(a.DB, taskID, by, body); err != nil {
+		slog.Error("actor: comment on task", "persona", a.Persona.Name, "task_id", taskID, "error", err)
+		return
+	}
+	if t, err := model.GetTask(a.DB, taskID); err == nil {
+		tools.BroadcastTask(a.Hub, "task_updated", t)
+	}
+}
+
+// formatTaskWake describes the changes to a task that woke the persona.
+func formatTaskWake(task model.Task, events []model.TaskEvent) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Task board] Task #%d assigned to you changed:\n", task.ID)
+	for _, e := range events {
+		switch e.Kind {
+		case model.TaskEventCreated:
+			fmt.Fprintf(&sb, "- %s created it\n", e.Author.Name)
+		case model.TaskEventComment:
+			fmt.Fprintf(&sb, "- %s commented: %s\n", e.Author.Name, e.Body)
+		default:
+			fmt.Fprintf(&sb, "- %s updated it: %s\n", e.Author.Name, strings.ReplaceAll(e.Body, "\n", "; "))
+		}
+	}
+	sb.WriteString("\n")
+	sb.WriteString(tools.FormatTask(task))
+	sb.WriteString("\n\nAct on the change if needed and keep the task up to date with task_update and task_comment.")
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestActorWakesForAssignedTaskChanges(t *testing.T) {
+	s := newScenario(t)
+	alice := model.TaskAuthor{Type: "human", ID: 999, Name: "alice"}
+	self := model.TaskAuthor{Type: "agent", ID: s.persona.ID, Name: s.persona.Name}
+
+	task, err := model.CreateTask(s.actor.DB, model.Task{Title: "triage bug", AssigneePersonaID: s.persona.ID}, alice)
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	model.CreateTask(s.actor.DB, model.Task{Title: "not mine"}, alice)
+
+	s.runOnce(context.Background())
+	if s.mock.callCount() != 1 {
+		t.Fatalf("expected 1 LLM call for the assigned task, got %d", s.mock.callCount())
+	}
+	sent, _ := json.Marshal(s.mock.getLastMessages())
+	if !strings.Contains(string(sent), "[Task board] Task #1 assigned to you changed") || !strings.Contains(string(sent), "alice created it") {
+		t.Errorf("task change not in prompt: %s", sent)
+	}
+
+	// Without a channel the answer is recorded as a task comment.
+	events, _ := model.ListTaskEvents(s.actor.DB, task.ID)
+	last := events[len(events)-1]
+	if last.Kind != model.TaskEventComment || last.Author.ID != s.persona.ID || last.Body != "Hello!" {
+		t.Errorf("unexpected last event: %+v", last)
+	}
+	if _, ok := s.actor.Status.Channels(s.persona.ID)[0]; ok {
+		t.Error("task without a channel tracked a status for channel 0")
+	}
+
+	// The persona's own changes don't wake it again.
+	model.AddTaskComment(s.actor.DB, task.ID, self, "note to self")
+	s.runOnce(context.Background())
+	if s.mock.callCount() != 1 {
+		t.Fatalf("own change woke the persona: %d calls", s.mock.callCount())
+	}
+
+	// A task linked to a channel is answered in the channel.
+	task.ChannelID = s.channel.ID
+	task.Status = model.TaskBlocked
+	if _, err := model.UpdateTask(s.actor.DB, task, alice); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	s.runOnce(context.Background())
+	if s.mock.callCount() != 2 {
+		t.Fatalf("expected a second LLM call, got %d", s.mock.callCount())
+	}
+	msgs, _ := model.GetRecentMessages(s.actor.DB, s.channel.ID, 10)
+	if len(msgs) != 1 || msgs[0].AuthorID != s.persona.ID {
+		t.Errorf("expected the answer in the task's channel, got %+v", msgs)
+	}
+}
+
+func TestTaskChangesWaitOutBudgetAndRestarts(t *testing.T) {
+	s := newScenario(t)
+	alice := model.TaskAuthor{Type: "human", ID: 999, Name: "alice"}
+	s.actor.loadTaskCursor() // as Run does, before any task changes
+
+	s.actor.Persona.MaxTokensPerHour = 100
+	s.actor.DB.WriteExec(
+		`INSERT INTO llm_calls (persona_id, channel_id, model, messages_json, response_json, prompt_tokens, completion_tokens)
+		 VALUES (?, ?, 'test-model', '[]', '{}', 60, 60)`,
+		s.persona.ID, s.channel.ID,
+	)
+	model.CreateTask(s.actor.DB, model.Task{Title: "triage bug", AssigneePersonaID: s.persona.ID}, alice)
+	s.runOnce(context.Background())
+	if s.mock.callCount() != 0 {
+		t.Fatalf("woken over budget: %d calls", s.mock.callCount())
+	}
+
+	// Once there is budget again, the change still wakes the persona.
+	s.actor.Persona.MaxTokensPerHour = 0
+	s.runOnce(context.Background())
+	if s.mock.callCount() != 1 {
+		t.Fatalf("expected 1 LLM call once within budget, got %d", s.mock.callCount())
+	}
+
+	// A restarted actor picks up where the last one left off.
+	task2, _ := model.CreateTask(s.actor.DB, model.Task{Title: "write docs", AssigneePersonaID: s.persona.ID}, alice)
+	s.actor.taskCursor = 0
+	s.actor.loadTaskCursor()
+	s.runOnce(context.Background())
+	if s.mock.callCount() != 2 {
+		t.Fatalf("expected only the new task to wake the restarted actor, got %d calls", s.mock.callCount())
+	}
+	sent, _ := json.Marshal(s.mock.getLastMessages())
+	if !strings.Contains(string(sent), fmt.Sprintf("Task #%d assigned", task2.ID)) {
+		t.Errorf("task change not in prompt: %s", sent)
+	}
+}
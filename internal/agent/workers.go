@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// DefaultMaxConcurrentChannels bounds how many of an actor's channels run
+// at once when Actor.MaxConcurrentChannels is zero.
+const DefaultMaxConcurrentChannels = 4
+
+// taskWorkerKey keys the worker that handles task changes among the
+// channel workers; channel IDs start at 1.
+const taskWorkerKey = 0
+
+// worker runs one channel's (or the task queue's) processing on its own
+// goroutine. Wakes that arrive during a run coalesce into one more run.
+type worker struct {
+	wake chan struct{}
+}
+
+// workerPool runs an actor's channels independently, so a long tool loop in
+// one channel doesn't hold up the others. At most limit runs proceed at once.
+type workerPool struct {
+	mu      sync.Mutex
+	workers map[int64]*worker
+	wg      sync.WaitGroup
+	slots   chan struct{}
+
+	// onPanic, if set, is called with a panic recovered from a run instead
+	// of letting it crash the process.
+	onPanic func(*PanicError)
+}
+
+func newWorkerPool(limit int) *workerPool {
+	if limit <= 0 {
+		limit = DefaultMaxConcurrentChannels
+	}
+	return &workerPool{
+		workers: make(map[int64]*worker),
+		slots:   make(chan struct{}, limit),
+	}
+}
+
+// run calls fn once a slot is free, returning false without calling it if
+// ctx ends first.
+func (p *workerPool) run(ctx context.Context, fn func()) bool {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	defer func() { <-p.slots }()
+	fn()
+	return true
+}
+
+// wake makes the worker for key run fn, starting the worker if needed.
+func (p *workerPool) wake(ctx context.Context, key int64, fn func(context.Context)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok := p.workers[key]
+	if !ok {
+		w = &worker{wake: make(chan struct{}, 1)}
+		p.workers[key] = w
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case _, open := <-w.wake:
+					if !open {
+						return
+					}
+					if !p.run(ctx, func() { p.protect(func() { fn(ctx) }) }) {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// protect calls fn, handing a panic to onPanic.
+func (p *workerPool) protect(fn func()) {
+	if p.onPanic != nil {
+		defer func() {
+			if v := recover(); v != nil {
+				p.onPanic(&PanicError{Value: v, Stack: string(debug.Stack())})
+			}
+		}()
+	}
+	fn()
+}
+
+// retain stops the workers whose keys aren't in keep once their current run
+// finishes, dropping any wake still pending.
+func (p *workerPool) retain(keep map[int64]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, w := range p.workers {
+		if !keep[key] {
+			select {
+			case <-w.wake:
+			default:
+			}
+			close(w.wake)
+			delete(p.workers, key)
+		}
+	}
+}
+
+// wait blocks until every worker has exited. Workers exit when the context
+// passed to wake ends.
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
+
+// dispatch wakes a worker for each subscribed channel and for task changes,
+// without waiting for them.
+func (a *Actor) dispatch(ctx context.Context, pool *workerPool) {
+	channels, err := model.GetSubscribedChannels(a.DB, a.Persona.ID)
+	if err != nil {
+		slog.Error("actor: get subscribed channels", "persona", a.Persona.Name, "error", err)
+		return
+	}
+
+	keep := map[int64]bool{taskWorkerKey: true}
+	for _, ch := range channels {
+		keep[ch.ID] = true
+		if a.RestartOnNewMessage {
+			a.supersedeStaleRuns(ch.ID)
+		}
+		pool.wake(ctx, ch.ID, func(ctx context.Context) { a.processChannel(ctx, ch) })
+	}
+	pool.retain(keep)
+	pool.wake(ctx, taskWorkerKey, a.processTasks)
+}
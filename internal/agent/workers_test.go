@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// gatedLLM holds calls whose latest message mentions "slow" until release
+// is closed, and answers others at once.
+type gatedLLM struct {
+	release chan struct{}
+}
+
+func (g gatedLLM) ChatCompletion(ctx context.Context, _ string, msgs []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	last, _ := json.Marshal(msgs[len(msgs)-1])
+	if !strings.Contains(string(last), "slow") {
+		return llm.Response{Content: "quick answer"}, nil
+	}
+	select {
+	case <-g.release:
+		return llm.Response{Content: "slow answer"}, nil
+	case <-ctx.Done():
+		return llm.Response{}, ctx.Err()
+	}
+}
+
+func hasAgentMessage(t *testing.T, s *scenario, channelID int64, content string) bool {
+	t.Helper()
+	msgs, err := model.GetRecentMessages(s.actor.DB, channelID, 10)
+	if err != nil {
+		t.Fatalf("get messages: %v", err)
+	}
+	for _, m := range msgs {
+		if m.AuthorType == "agent" && m.Content == content {
+			return true
+		}
+	}
+	return false
+}
+
+func TestActorProcessesChannelsIndependently(t *testing.T) {
+	s := newScenario(t)
+	release := make(chan struct{})
+	s.actor.LLM = gatedLLM{release: release}
+
+	dev, _ := model.CreateChannel(s.actor.DB, "dev", "", 0)
+	model.SubscribeChannel(s.actor.DB, s.persona.ID, dev.ID)
+	if _, err := model.CreateMessage(s.actor.DB, dev.ID, 999, "human", "alice", "a slow task"); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	s.postHumanMessage("a quick question")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.actor.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.hub.Broadcast(ws.Event{Type: "new_message"})
+
+	// #general is answered while #dev is still waiting on its LLM call.
+	waitFor(t, func() bool { return hasAgentMessage(t, s, s.channel.ID, "quick answer") })
+	waitFor(t, func() bool { return s.actor.Status.GetChannel(s.persona.ID, dev.ID) == StatusThinking })
+	waitFor(t, func() bool { return s.actor.Status.GetChannel(s.persona.ID, s.channel.ID) == StatusIdle })
+	if got := s.actor.Status.Get(s.persona.ID); got != StatusThinking {
+		t.Errorf("persona status = %s, want thinking", got)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return hasAgentMessage(t, s, dev.ID, "slow answer") })
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("actor.Run did not return after context cancel")
+	}
+}
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	pool := newWorkerPool(2)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	running := make(chan struct{}, 10)
+	block := make(chan struct{})
+	for key := int64(1); key <= 3; key++ {
+		pool.wake(ctx, key, func(context.Context) {
+			running <- struct{}{}
+			<-block
+		})
+	}
+
+	waitFor(t, func() bool { return len(running) == 2 })
+	time.Sleep(20 * time.Millisecond)
+	if len(running) != 2 {
+		t.Errorf("%d runs in flight, want 2", len(running))
+	}
+	close(block)
+	waitFor(t, func() bool { return len(running) == 3 })
+
+	cancel()
+	pool.wait()
+}
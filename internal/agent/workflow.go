@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Special stage targets for next and goto.
+const (
+	StageEnd  = "end"
+	StageFail = "fail"
+)
+
+const (
+	defaultStageMaxVisits = 3
+	defaultStageTimeout   = 10 * time.Minute
+	minScheduleInterval   = time.Minute
+)
+
+var (
+	stageNameRe   = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	commandNameRe = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+)
+
+// WorkflowDefinition is the JSON stored in a workflow. Stages run in order
+// starting with the first; a stage's branches or next can jump elsewhere,
+// including back to an earlier stage.
+//
+//	{
+//	  "triggers": {"command": "ship", "every": "24h", "webhook": true},
+//	  "channel": "engineering",
+//	  "stages": [
+//	    {"name": "design", "persona": "Code Architect", "prompt": "Design: {{.Input}}"},
+//	    {"name": "implement", "persona": "Implementer", "prompt": "Build this:\n{{.Outputs.design}}"},
+//	    {"name": "review", "persona": "Reviewer", "prompt": "Review:\n{{.Previous}}",
+//	     "branches": [{"contains": "LGTM", "goto": "end"}], "next": "implement"}
+//	  ]
+//	}
+type WorkflowDefinition struct {
+	Triggers WorkflowTriggers `json:"triggers"`
+	// Channel is where stage answers are posted when the trigger doesn't
+	// supply one. With neither, answers are only recorded on the run.
+	Channel string          `json:"channel,omitempty"`
+	Stages  []WorkflowStage `json:"stages"`
+}
+
+// WorkflowTriggers says how a workflow can be started besides the API.
+type WorkflowTriggers struct {
+	// Command starts the workflow when a message "/<command> <input>" is
+	// posted in a channel.
+	Command string `json:"command,omitempty"`
+	// Every starts the workflow on an interval, e.g. "1h" or "24h".
+	Every string `json:"every,omitempty"`
+	// Webhook allows starting the workflow with its webhook token.
+	Webhook bool `json:"webhook,omitempty"`
+}
+
+// WorkflowStage is one persona's step in a workflow. Prompt is a
+// text/template rendered with WorkflowPromptData.
+type WorkflowStage struct {
+	Name    string `json:"name"`
+	Persona string `json:"persona"`
+	Prompt  string `json:"prompt"`
+	// Branches are checked against the stage's answer in order; the first
+	// match decides the next stage.
+	Branches []WorkflowBranch `json:"branches,omitempty"`
+	// Next is the stage to run when no branch matches: a stage name,
+	// "end" or "fail". Empty means the following stage, or end after the
+	// last one.
+	Next string `json:"next,omitempty"`
+	// MaxVisits fails the run when the stage would run more often than
+	// this, bounding loops. Zero means 3.
+	MaxVisits int `json:"max_visits,omitempty"`
+	// Timeout bounds a single visit, e.g. "15m". Empty means 10 minutes.
+	Timeout string `json:"timeout,omitempty"`
+
+	prompt  *template.Template
+	timeout time.Duration
+}
+
+// WorkflowBranch routes on a stage's answer. Contains matches a substring
+// (case-insensitive) and Matches a regular expression; a branch with both
+// needs both to match.
+type WorkflowBranch struct {
+	Contains string `json:"contains,omitempty"`
+	Matches  string `json:"matches,omitempty"`
+	Goto     string `json:"goto"`
+
+	re *regexp.Regexp
+}
+
+// WorkflowPromptData is what stage prompt templates are rendered with.
+type WorkflowPromptData struct {
+	// Input is the text the workflow was triggered with.
+	Input string
+	// Previous is the answer of the stage that ran last.
+	Previous string
+	// Outputs holds the latest answer of each stage that has run, by name.
+	Outputs map[string]string
+	// Workflow is the workflow's name.
+	Workflow string
+	// RunID is the run's ID.
+	RunID int64
+}
+
+// ParseWorkflow parses and validates a workflow definition.
+func ParseWorkflow(definition string) (WorkflowDefinition, error) {
+	var def WorkflowDefinition
+	dec := json.NewDecoder(strings.NewReader(definition))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		return WorkflowDefinition{}, fmt.Errorf("invalid definition: %w", err)
+	}
+
+	if c := def.Triggers.Command; c != "" && !commandNameRe.MatchString(c) {
+		return WorkflowDefinition{}, fmt.Errorf("triggers.command %q must be lowercase letters, digits, - or _", c)
+	}
+	if def.Triggers.Every != "" {
+		every, err := time.ParseDuration(def.Triggers.Every)
+		if err != nil || every < minScheduleInterval {
+			return WorkflowDefinition{}, fmt.Errorf("triggers.every must be a duration of at least %s", minScheduleInterval)
+		}
+	}
+	if len(def.Stages) == 0 {
+		return WorkflowDefinition{}, fmt.Errorf("at least one stage is required")
+	}
+
+	names := make(map[string]bool, len(def.Stages))
+	for _, st := range def.Stages {
+		if !stageNameRe.MatchString(st.Name) || st.Name == StageEnd || st.Name == StageFail {
+			return WorkflowDefinition{}, fmt.Errorf("stage name %q must be lowercase letters, digits or _ and not end or fail", st.Name)
+		}
+		if names[st.Name] {
+			return WorkflowDefinition{}, fmt.Errorf("duplicate stage %q", st.Name)
+		}
+		names[st.Name] = true
+	}
+	target := func(stage, to string) error {
+		if to != StageEnd && to != StageFail && !names[to] {
+			return fmt.Errorf("stage %q: unknown target %q", stage, to)
+		}
+		return nil
+	}
+
+	for i := range def.Stages {
+		st := &def.Stages[i]
+		if strings.TrimSpace(st.Persona) == "" {
+			return WorkflowDefinition{}, fmt.Errorf("stage %q: persona is required", st.Name)
+		}
+		if strings.TrimSpace(st.Prompt) == "" {
+			return WorkflowDefinition{}, fmt.Errorf("stage %q: prompt is required", st.Name)
+		}
+		tmpl, err := template.New(st.Name).Option("missingkey=zero").Parse(st.Prompt)
+		if err != nil {
+			return WorkflowDefinition{}, fmt.Errorf("stage %q: prompt: %w", st.Name, err)
+		}
+		st.prompt = tmpl
+
+		st.timeout = defaultStageTimeout
+		if st.Timeout != "" {
+			if st.timeout, err = time.ParseDuration(st.Timeout); err != nil || st.timeout <= 0 {
+				return WorkflowDefinition{}, fmt.Errorf("stage %q: invalid timeout %q", st.Name, st.Timeout)
+			}
+		}
+		if st.MaxVisits < 0 {
+			return WorkflowDefinition{}, fmt.Errorf("stage %q: max_visits must not be negative", st.Name)
+		}
+		if st.Next != "" {
+			if err := target(st.Name, st.Next); err != nil {
+				return WorkflowDefinition{}, err
+			}
+		}
+		for j := range st.Branches {
+			b := &st.Branches[j]
+			if b.Contains == "" && b.Matches == "" {
+				return WorkflowDefinition{}, fmt.Errorf("stage %q: branch %d needs contains or matches", st.Name, j+1)
+			}
+			if b.Matches != "" {
+				if b.re, err = regexp.Compile(b.Matches); err != nil {
+					return WorkflowDefinition{}, fmt.Errorf("stage %q: branch %d: %w", st.Name, j+1, err)
+				}
+			}
+			if err := target(st.Name, b.Goto); err != nil {
+				return WorkflowDefinition{}, err
+			}
+		}
+	}
+	return def, nil
+}
+
+// Stage returns the stage with the given name.
+func (def WorkflowDefinition) Stage(name string) (WorkflowStage, bool) {
+	for _, st := range def.Stages {
+		if st.Name == name {
+			return st, true
+		}
+	}
+	return WorkflowStage{}, false
+}
+
+// Interval returns the schedule interval, or zero if the workflow isn't
+// scheduled.
+func (def WorkflowDefinition) Interval() time.Duration {
+	every, _ := time.ParseDuration(def.Triggers.Every)
+	return every
+}
+
+// nextStage picks the stage to run after name answered output.
+func (def WorkflowDefinition) nextStage(name, output string) string {
+	for i, st := range def.Stages {
+		if st.Name != name {
+			continue
+		}
+		for _, b := range st.Branches {
+			if b.match(output) {
+				return b.Goto
+			}
+		}
+		if st.Next != "" {
+			return st.Next
+		}
+		if i+1 < len(def.Stages) {
+			return def.Stages[i+1].Name
+		}
+	}
+	return StageEnd
+}
+
+func (b WorkflowBranch) match(output string) bool {
+	if b.Contains != "" && !strings.Contains(strings.ToLower(output), strings.ToLower(b.Contains)) {
+		return false
+	}
+	if b.re != nil && !b.re.MatchString(output) {
+		return false
+	}
+	return true
+}
+
+func (st WorkflowStage) maxVisits() int {
+	if st.MaxVisits == 0 {
+		return defaultStageMaxVisits
+	}
+	return st.MaxVisits
+}
+
+// render fills in the stage's prompt.
+func (st WorkflowStage) render(data WorkflowPromptData) (string, error) {
+	var buf bytes.Buffer
+	if err := st.prompt.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render prompt for stage %q: %w", st.Name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,470 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+const scheduleCheckInterval = 30 * time.Second
+
+var errRunCancelled = errors.New("workflow run cancelled")
+
+// WorkflowRunner executes workflow runs. Every stage is recorded as it
+// starts and finishes, so runs interrupted by a restart resume at the stage
+// they were on. It also starts scheduled workflows.
+type WorkflowRunner struct {
+	Supervisor *Supervisor
+
+	mu      sync.Mutex
+	base    context.Context
+	cancels map[int64]context.CancelCauseFunc
+	wg      sync.WaitGroup
+}
+
+// NewWorkflowRunner creates a WorkflowRunner whose stages run as the
+// supervisor's personas.
+func NewWorkflowRunner(s *Supervisor) *WorkflowRunner {
+	return &WorkflowRunner{
+		Supervisor: s,
+		cancels:    make(map[int64]context.CancelCauseFunc),
+	}
+}
+
+// Run resumes runs left running by a previous process and starts scheduled
+// workflows until ctx is cancelled. It then waits for in-flight runs to
+// stop; they stay running in the database and resume on the next Run.
+func (wr *WorkflowRunner) Run(ctx context.Context) {
+	wr.mu.Lock()
+	wr.base = ctx
+	wr.mu.Unlock()
+
+	wr.resume()
+	wr.checkSchedules(time.Now())
+
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wr.wg.Wait()
+			return
+		case now := <-ticker.C:
+			wr.checkSchedules(now)
+		}
+	}
+}
+
+// Start begins a run of wf in the background. channelID is where stage
+// answers are posted; zero falls back to the definition's channel.
+func (wr *WorkflowRunner) Start(wf model.Workflow, trigger, input string, channelID int64, startedBy string) (model.WorkflowRun, error) {
+	if !wf.Enabled {
+		return model.WorkflowRun{}, fmt.Errorf("workflow %q is disabled", wf.Name)
+	}
+	def, err := ParseWorkflow(wf.Definition)
+	if err != nil {
+		return model.WorkflowRun{}, err
+	}
+	if channelID == 0 && def.Channel != "" {
+		ch, err := model.GetChannelByName(wr.Supervisor.DB, def.Channel)
+		if err != nil {
+			return model.WorkflowRun{}, fmt.Errorf("channel %q not found", def.Channel)
+		}
+		channelID = ch.ID
+	}
+
+	run, err := model.CreateWorkflowRun(wr.Supervisor.DB, model.WorkflowRun{
+		WorkflowID:   wf.ID,
+		Definition:   wf.Definition,
+		Trigger:      trigger,
+		Input:        input,
+		ChannelID:    channelID,
+		StartedBy:    startedBy,
+		CurrentStage: def.Stages[0].Name,
+	})
+	if err != nil {
+		return model.WorkflowRun{}, fmt.Errorf("record run: %w", err)
+	}
+	slog.Info("workflow: run started", "workflow", wf.Name, "run_id", run.ID, "trigger", trigger)
+	wr.broadcastRun("workflow_run_started", run)
+	wr.launch(run, def)
+	return run, nil
+}
+
+// Cancel stops a running run. It returns false if the run wasn't running.
+func (wr *WorkflowRunner) Cancel(runID int64) (bool, error) {
+	ok, err := model.FinishWorkflowRun(wr.Supervisor.DB, runID, model.WorkflowCancelled, "cancelled")
+	if err != nil || !ok {
+		return ok, err
+	}
+	wr.mu.Lock()
+	cancel := wr.cancels[runID]
+	wr.mu.Unlock()
+	if cancel != nil {
+		cancel(errRunCancelled)
+	}
+	if run, err := model.GetWorkflowRun(wr.Supervisor.DB, runID); err == nil {
+		wr.broadcastRun("workflow_run_finished", run)
+	}
+	return true, nil
+}
+
+// FindCommand returns the enabled workflow triggered by the slash command
+// name.
+func (wr *WorkflowRunner) FindCommand(name string) (model.Workflow, bool, error) {
+	commands, err := wr.Commands()
+	if err != nil {
+		return model.Workflow{}, false, err
+	}
+	wf, ok := commands[name]
+	return wf, ok, nil
+}
+
+// Commands returns the enabled workflows that have a slash command, by
+// command name.
+func (wr *WorkflowRunner) Commands() (map[string]model.Workflow, error) {
+	workflows, err := model.ListWorkflows(wr.Supervisor.DB)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]model.Workflow)
+	for _, wf := range workflows {
+		if !wf.Enabled {
+			continue
+		}
+		if def, err := ParseWorkflow(wf.Definition); err == nil && def.Triggers.Command != "" {
+			out[def.Triggers.Command] = wf
+		}
+	}
+	return out, nil
+}
+
+// Validate checks that wf's definition parses, that its personas and
+// channel exist, and that no other workflow uses its command.
+func (wr *WorkflowRunner) Validate(wf model.Workflow) error {
+	def, err := ParseWorkflow(wf.Definition)
+	if err != nil {
+		return err
+	}
+	for _, st := range def.Stages {
+		if _, err := wr.Supervisor.lookupPersona(st.Persona); err != nil {
+			return fmt.Errorf("stage %q: %w", st.Name, err)
+		}
+	}
+	if def.Channel != "" {
+		if _, err := model.GetChannelByName(wr.Supervisor.DB, def.Channel); err != nil {
+			return fmt.Errorf("channel %q not found", def.Channel)
+		}
+	}
+	if def.Triggers.Command != "" {
+		other, ok, err := wr.FindCommand(def.Triggers.Command)
+		if err != nil {
+			return err
+		}
+		if ok && other.ID != wf.ID {
+			return fmt.Errorf("command /%s is already used by workflow %q", def.Triggers.Command, other.Name)
+		}
+	}
+	return nil
+}
+
+// launch executes run in a goroutine that stops when Run's context ends or
+// the run is cancelled.
+func (wr *WorkflowRunner) launch(run model.WorkflowRun, def WorkflowDefinition) {
+	wr.mu.Lock()
+	base := wr.base
+	if base == nil {
+		base = context.Background()
+	}
+	ctx, cancel := context.WithCancelCause(base)
+	wr.cancels[run.ID] = cancel
+	wr.wg.Add(1)
+	wr.mu.Unlock()
+
+	go func() {
+		defer wr.wg.Done()
+		defer func() {
+			wr.mu.Lock()
+			delete(wr.cancels, run.ID)
+			wr.mu.Unlock()
+			cancel(nil)
+		}()
+		defer func() {
+			if v := recover(); v != nil {
+				slog.Error("workflow: run panicked", "run_id", run.ID, "error", v, "stack", string(debug.Stack()))
+				wr.finish(run.ID, model.WorkflowFailed, fmt.Sprintf("panic: %v", v))
+			}
+		}()
+		wr.execute(ctx, run, def)
+	}()
+}
+
+// resume relaunches runs a previous process left running. A stage that was
+// mid-flight is recorded as interrupted and runs again.
+func (wr *WorkflowRunner) resume() {
+	runs, err := model.ListWorkflowRuns(wr.Supervisor.DB, model.WorkflowRunFilter{Status: model.WorkflowRunning})
+	if err != nil {
+		slog.Error("workflow: list running runs", "error", err)
+		return
+	}
+	for _, run := range runs {
+		wr.mu.Lock()
+		_, active := wr.cancels[run.ID]
+		wr.mu.Unlock()
+		if active {
+			continue
+		}
+		if err := model.FailRunningWorkflowStageRuns(wr.Supervisor.DB, run.ID, "interrupted by restart"); err != nil {
+			slog.Error("workflow: close interrupted stages", "run_id", run.ID, "error", err)
+		}
+		def, err := ParseWorkflow(run.Definition)
+		if err != nil {
+			wr.finish(run.ID, model.WorkflowFailed, err.Error())
+			continue
+		}
+		slog.Info("workflow: resuming run", "workflow", run.WorkflowName, "run_id", run.ID, "stage", run.CurrentStage)
+		wr.launch(run, def)
+	}
+}
+
+// checkSchedules starts scheduled workflows whose interval has passed since
+// their last scheduled run, or since they were created.
+func (wr *WorkflowRunner) checkSchedules(now time.Time) {
+	workflows, err := model.ListWorkflows(wr.Supervisor.DB)
+	if err != nil {
+		slog.Error("workflow: list workflows", "error", err)
+		return
+	}
+	for _, wf := range workflows {
+		if !wf.Enabled {
+			continue
+		}
+		def, err := ParseWorkflow(wf.Definition)
+		if err != nil {
+			continue
+		}
+		every := def.Interval()
+		if every == 0 {
+			continue
+		}
+		last, err := model.LastWorkflowRunAt(wr.Supervisor.DB, wf.ID, model.TriggerSchedule)
+		if err != nil {
+			slog.Error("workflow: last scheduled run", "workflow", wf.Name, "error", err)
+			continue
+		}
+		since := wf.CreatedAt
+		if last != nil {
+			since = *last
+		}
+		if now.Sub(since) < every {
+			continue
+		}
+		if _, err := wr.Start(wf, model.TriggerSchedule, "", 0, "schedule"); err != nil {
+			slog.Error("workflow: start scheduled run", "workflow", wf.Name, "error", err)
+		}
+	}
+}
+
+// execute runs stages from the run's current stage until the workflow ends,
+// fails or ctx is cancelled. Outputs of stages completed before a restart
+// are restored from the database.
+func (wr *WorkflowRunner) execute(ctx context.Context, run model.WorkflowRun, def WorkflowDefinition) {
+	d := wr.Supervisor.DB
+	data := WorkflowPromptData{
+		Input:    run.Input,
+		Outputs:  make(map[string]string),
+		Workflow: run.WorkflowName,
+		RunID:    run.ID,
+	}
+	visits := make(map[string]int)
+	done, err := model.ListWorkflowStageRuns(d, run.ID)
+	if err != nil {
+		wr.finish(run.ID, model.WorkflowFailed, fmt.Sprintf("load stages: %v", err))
+		return
+	}
+	for _, sr := range done {
+		if sr.Status == model.WorkflowCompleted {
+			data.Outputs[sr.Stage] = sr.Output
+			data.Previous = sr.Output
+			visits[sr.Stage]++
+		}
+	}
+
+	var ch model.Channel
+	if run.ChannelID != 0 {
+		if ch, err = model.GetChannel(d, run.ChannelID); err != nil {
+			wr.finish(run.ID, model.WorkflowFailed, fmt.Sprintf("load channel: %v", err))
+			return
+		}
+	}
+
+	stage, prev := run.CurrentStage, ""
+	for stage != StageEnd {
+		if ctx.Err() != nil {
+			return
+		}
+		if stage == StageFail {
+			wr.finish(run.ID, model.WorkflowFailed, fmt.Sprintf("stage %q failed the run", prev))
+			return
+		}
+		st, ok := def.Stage(stage)
+		if !ok {
+			wr.finish(run.ID, model.WorkflowFailed, fmt.Sprintf("unknown stage %q", stage))
+			return
+		}
+		if visits[stage] >= st.maxVisits() {
+			wr.finish(run.ID, model.WorkflowFailed, fmt.Sprintf("stage %q ran %d times without finishing the workflow", stage, visits[stage]))
+			return
+		}
+
+		output, err := wr.runStage(ctx, run, ch, st, data)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			wr.finish(run.ID, model.WorkflowFailed, fmt.Sprintf("stage %q: %v", stage, err))
+			return
+		}
+		visits[stage]++
+		data.Outputs[stage] = output
+		data.Previous = output
+
+		prev, stage = stage, def.nextStage(stage, output)
+		if err := model.SetWorkflowRunStage(d, run.ID, stage); err != nil {
+			slog.Error("workflow: record stage", "run_id", run.ID, "error", err)
+		}
+	}
+	wr.finish(run.ID, model.WorkflowCompleted, "")
+}
+
+// runStage has the stage's persona answer its rendered prompt and records
+// the stage. The answer is posted to ch, or only recorded when ch is the
+// zero Channel.
+func (wr *WorkflowRunner) runStage(ctx context.Context, run model.WorkflowRun, ch model.Channel, st WorkflowStage, data WorkflowPromptData) (string, error) {
+	s := wr.Supervisor
+	p, err := s.lookupPersona(st.Persona)
+	if err != nil {
+		return "", err
+	}
+	prompt, err := st.render(data)
+	if err != nil {
+		return "", err
+	}
+	ok, err := s.Budget.WithinBudget(p.ID, p.MaxTokensPerHour)
+	if err != nil {
+		return "", fmt.Errorf("budget check: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is over its hourly token budget", p.Name)
+	}
+
+	sr, err := model.CreateWorkflowStageRun(s.DB, model.WorkflowStageRun{
+		RunID:       run.ID,
+		Stage:       st.Name,
+		PersonaID:   p.ID,
+		PersonaName: p.Name,
+		Prompt:      prompt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("record stage: %w", err)
+	}
+	wr.broadcastStage("workflow_stage_started", run, sr)
+
+	var projects []model.Project
+	var post func(string) model.Message
+	if ch.ID != 0 {
+		projects, _ = model.ListChannelProjects(s.DB, ch.ID)
+	} else {
+		post = func(content string) model.Message { return model.Message{Content: content} }
+	}
+	history := []model.Message{{AuthorType: "workflow", AuthorName: run.WorkflowName, Content: prompt}}
+
+	stageCtx, cancel := context.WithTimeout(ctx, st.timeout)
+	defer cancel()
+	actor := s.newActor(p)
+	endRun := actor.beginRun(ch.ID)
+	answer, _ := actor.converse(withRunTrigger(stageCtx, model.RunTriggerWorkflow), ch, history, projects, post)
+	endRun()
+
+	status, errText := model.WorkflowCompleted, ""
+	switch {
+	case ctx.Err() != nil:
+		if !errors.Is(context.Cause(ctx), errRunCancelled) {
+			// Shutting down: leave the stage running so it's retried on resume.
+			return "", ctx.Err()
+		}
+		status, errText = model.WorkflowFailed, "cancelled"
+	case stageCtx.Err() != nil:
+		status, errText = model.WorkflowFailed, fmt.Sprintf("%s did not answer within %s", p.Name, st.timeout)
+	case answer.Content == "":
+		status, errText = model.WorkflowFailed, fmt.Sprintf("%s did not produce an answer", p.Name)
+	}
+	if err := model.FinishWorkflowStageRun(s.DB, sr.ID, status, answer.Content, errText); err != nil {
+		slog.Error("workflow: finish stage", "run_id", run.ID, "stage", st.Name, "error", err)
+	}
+	sr.Status, sr.Output, sr.Error = status, answer.Content, errText
+	wr.broadcastStage("workflow_stage_finished", run, sr)
+
+	if errText != "" {
+		return "", errors.New(errText)
+	}
+	return answer.Content, nil
+}
+
+// finish records a run's outcome unless it already finished, e.g. by being
+// cancelled.
+func (wr *WorkflowRunner) finish(runID int64, status, errText string) {
+	ok, err := model.FinishWorkflowRun(wr.Supervisor.DB, runID, status, errText)
+	if err != nil {
+		slog.Error("workflow: finish run", "run_id", runID, "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	run, err := model.GetWorkflowRun(wr.Supervisor.DB, runID)
+	if err != nil {
+		return
+	}
+	slog.Info("workflow: run finished", "workflow", run.WorkflowName, "run_id", run.ID, "status", status, "error", errText)
+	wr.broadcastRun("workflow_run_finished", run)
+}
+
+func (wr *WorkflowRunner) broadcastRun(eventType string, run model.WorkflowRun) {
+	data := map[string]any{
+		"id":            run.ID,
+		"workflow_id":   run.WorkflowID,
+		"workflow_name": run.WorkflowName,
+		"trigger":       run.Trigger,
+		"channel_id":    run.ChannelID,
+		"status":        run.Status,
+		"current_stage": run.CurrentStage,
+		"error":         run.Error,
+		"created_at":    run.CreatedAt.Format(time.RFC3339),
+	}
+	if run.FinishedAt != nil {
+		data["finished_at"] = run.FinishedAt.Format(time.RFC3339)
+	}
+	wr.Supervisor.Hub.Broadcast(ws.Event{Type: eventType, Data: data})
+}
+
+func (wr *WorkflowRunner) broadcastStage(eventType string, run model.WorkflowRun, sr model.WorkflowStageRun) {
+	wr.Supervisor.Hub.Broadcast(ws.Event{Type: eventType, Data: map[string]any{
+		"id":            sr.ID,
+		"run_id":        run.ID,
+		"workflow_id":   run.WorkflowID,
+		"workflow_name": run.WorkflowName,
+		"stage":         sr.Stage,
+		"persona_id":    sr.PersonaID,
+		"persona_name":  sr.PersonaName,
+		"status":        sr.Status,
+		"error":         sr.Error,
+	}})
+}
@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestParseWorkflow(t *testing.T) {
+	def, err := ParseWorkflow(`{
+		"triggers": {"command": "ship", "every": "1h", "webhook": true},
+		"stages": [
+			{"name": "design", "persona": "architect", "prompt": "Design {{.Input}}"},
+			{"name": "review", "persona": "reviewer", "prompt": "{{.Previous}}",
+			 "branches": [{"contains": "lgtm", "goto": "end"}, {"matches": "^REJECT", "goto": "fail"}], "next": "design"}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if def.Interval() != time.Hour {
+		t.Errorf("interval = %s", def.Interval())
+	}
+	for output, want := range map[string]string{
+		"Looks good. LGTM": StageEnd,
+		"REJECT: no":       StageFail,
+		"Needs tests":      "design",
+	} {
+		if got := def.nextStage("review", output); got != want {
+			t.Errorf("nextStage(review, %q) = %q, want %q", output, got, want)
+		}
+	}
+	if got := def.nextStage("design", "plan"); got != "review" {
+		t.Errorf("nextStage(design) = %q, want review", got)
+	}
+
+	for name, bad := range map[string]string{
+		"no stages":      `{"stages": []}`,
+		"unknown field":  `{"stages": [{"name": "a", "persona": "p", "prompt": "x", "retries": 2}]}`,
+		"bad name":       `{"stages": [{"name": "Build It", "persona": "p", "prompt": "x"}]}`,
+		"duplicate":      `{"stages": [{"name": "a", "persona": "p", "prompt": "x"}, {"name": "a", "persona": "p", "prompt": "x"}]}`,
+		"no persona":     `{"stages": [{"name": "a", "prompt": "x"}]}`,
+		"bad template":   `{"stages": [{"name": "a", "persona": "p", "prompt": "{{.Input"}]}`,
+		"unknown target": `{"stages": [{"name": "a", "persona": "p", "prompt": "x", "next": "b"}]}`,
+		"empty branch":   `{"stages": [{"name": "a", "persona": "p", "prompt": "x", "branches": [{"goto": "end"}]}]}`,
+		"bad regexp":     `{"stages": [{"name": "a", "persona": "p", "prompt": "x", "branches": [{"matches": "(", "goto": "end"}]}]}`,
+		"short schedule": `{"triggers": {"every": "5s"}, "stages": [{"name": "a", "persona": "p", "prompt": "x"}]}`,
+		"bad command":    `{"triggers": {"command": "/Ship"}, "stages": [{"name": "a", "persona": "p", "prompt": "x"}]}`,
+	} {
+		if _, err := ParseWorkflow(bad); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func newWorkflowFixture(t *testing.T, definition string, responses ...string) (*WorkflowRunner, model.Workflow, *mockLLM) {
+	t.Helper()
+	sup, _ := newSupervisor(t)
+	for _, name := range []string{"architect", "implementer", "reviewer"} {
+		if _, err := model.CreatePersona(sup.DB, name, "You are the "+name+".", "model", nil, 0.7, 100, 0, 0); err != nil {
+			t.Fatalf("create persona: %v", err)
+		}
+	}
+	if _, err := model.CreateChannel(sup.DB, "eng", "", 0); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	mock := &mockLLM{}
+	for _, r := range responses {
+		mock.responses = append(mock.responses, llm.Response{Content: r, PromptTokens: 10, CompletionTokens: 5})
+	}
+	sup.LLM = mock
+
+	wf, err := model.CreateWorkflow(sup.DB, model.Workflow{Name: "ship", Definition: definition, Enabled: true, WebhookToken: "secret"})
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	wr := NewWorkflowRunner(sup)
+	if err := wr.Validate(wf); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	return wr, wf, mock
+}
+
+const reviewLoop = `{
+	"channel": "eng",
+	"stages": [
+		{"name": "design", "persona": "architect", "prompt": "Design: {{.Input}}"},
+		{"name": "implement", "persona": "implementer", "prompt": "Build {{.Outputs.design}}. Feedback: {{.Outputs.review}}"},
+		{"name": "review", "persona": "reviewer", "prompt": "Review {{.Previous}}",
+		 "branches": [{"contains": "LGTM", "goto": "end"}], "next": "implement", "max_visits": 2}
+	]
+}`
+
+func TestWorkflowRunLoopsUntilApproved(t *testing.T) {
+	wr, wf, _ := newWorkflowFixture(t, reviewLoop, "the plan", "v1", "needs tests", "v2", "LGTM")
+
+	run, err := wr.Start(wf, model.TriggerManual, "a login page", 0, "alice")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	wr.wg.Wait()
+
+	run, _ = model.GetWorkflowRun(wr.Supervisor.DB, run.ID)
+	if run.Status != model.WorkflowCompleted || run.ChannelID == 0 {
+		t.Fatalf("run = %+v", run)
+	}
+	stages, _ := model.ListWorkflowStageRuns(wr.Supervisor.DB, run.ID)
+	var order []string
+	for _, sr := range stages {
+		order = append(order, sr.Stage)
+	}
+	if strings.Join(order, ",") != "design,implement,review,implement,review" {
+		t.Fatalf("stage order = %v", order)
+	}
+	if stages[0].Prompt != "Design: a login page" {
+		t.Errorf("design prompt = %q", stages[0].Prompt)
+	}
+	if stages[3].Prompt != "Build the plan. Feedback: needs tests" || stages[3].Output != "v2" {
+		t.Errorf("second implement = %+v", stages[3])
+	}
+
+	msgs, _ := model.GetRecentMessages(wr.Supervisor.DB, run.ChannelID, 10)
+	if len(msgs) != 5 || msgs[0].Content != "LGTM" || msgs[0].AuthorName != "reviewer" {
+		t.Errorf("stage answers not posted to the channel: %+v", msgs)
+	}
+}
+
+func TestWorkflowRunFailsWhenLoopLimitReached(t *testing.T) {
+	wr, wf, _ := newWorkflowFixture(t, reviewLoop, "the plan", "v1", "needs tests")
+
+	run, err := wr.Start(wf, model.TriggerManual, "x", 0, "alice")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	wr.wg.Wait()
+
+	run, _ = model.GetWorkflowRun(wr.Supervisor.DB, run.ID)
+	if run.Status != model.WorkflowFailed || !strings.Contains(run.Error, `stage "review" ran 2 times`) {
+		t.Errorf("run = %+v", run)
+	}
+}
+
+func TestWorkflowRunResumesAfterRestart(t *testing.T) {
+	wr, wf, mock := newWorkflowFixture(t, reviewLoop, "v1", "LGTM")
+	d := wr.Supervisor.DB
+
+	// A previous process finished design and was interrupted mid-implement.
+	run, err := model.CreateWorkflowRun(d, model.WorkflowRun{
+		WorkflowID: wf.ID, Definition: wf.Definition, Trigger: model.TriggerManual, Input: "x", CurrentStage: "design",
+	})
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	sr, _ := model.CreateWorkflowStageRun(d, model.WorkflowStageRun{RunID: run.ID, Stage: "design", PersonaName: "architect", Prompt: "Design: x"})
+	model.FinishWorkflowStageRun(d, sr.ID, model.WorkflowCompleted, "old plan", "")
+	model.SetWorkflowRunStage(d, run.ID, "implement")
+	model.CreateWorkflowStageRun(d, model.WorkflowStageRun{RunID: run.ID, Stage: "implement", PersonaName: "implementer", Prompt: "Build old plan"})
+
+	wr.resume()
+	wr.wg.Wait()
+
+	run, _ = model.GetWorkflowRun(d, run.ID)
+	if run.Status != model.WorkflowCompleted {
+		t.Fatalf("run = %+v", run)
+	}
+	if mock.callCount() != 2 {
+		t.Errorf("expected design to be skipped, got %d LLM calls", mock.callCount())
+	}
+	stages, _ := model.ListWorkflowStageRuns(d, run.ID)
+	if len(stages) != 4 || stages[1].Status != model.WorkflowFailed || stages[1].Error != "interrupted by restart" {
+		t.Fatalf("stages = %+v", stages)
+	}
+	if !strings.Contains(stages[2].Prompt, "Build old plan") {
+		t.Errorf("resumed stage lost earlier output: %q", stages[2].Prompt)
+	}
+}
+
+func TestWorkflowCancel(t *testing.T) {
+	wr, wf, _ := newWorkflowFixture(t, reviewLoop)
+	wr.Supervisor.LLM = blockingLLM{}
+
+	run, err := wr.Start(wf, model.TriggerManual, "x", 0, "alice")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stages, _ := model.ListWorkflowStageRuns(wr.Supervisor.DB, run.ID)
+		if len(stages) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stage never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if ok, err := wr.Cancel(run.ID); err != nil || !ok {
+		t.Fatalf("cancel = %v, %v", ok, err)
+	}
+	wr.wg.Wait()
+
+	run, _ = model.GetWorkflowRun(wr.Supervisor.DB, run.ID)
+	stages, _ := model.ListWorkflowStageRuns(wr.Supervisor.DB, run.ID)
+	if run.Status != model.WorkflowCancelled || stages[0].Status != model.WorkflowFailed || stages[0].Error != "cancelled" {
+		t.Errorf("run = %+v, stage = %+v", run, stages[0])
+	}
+	if ok, _ := wr.Cancel(run.ID); ok {
+		t.Error("cancelling a finished run should report false")
+	}
+}
+
+func TestWorkflowSchedule(t *testing.T) {
+	wr, wf, _ := newWorkflowFixture(t, `{
+		"triggers": {"every": "1h"},
+		"stages": [{"name": "report", "persona": "architect", "prompt": "Daily report"}]
+	}`, "all good")
+
+	wr.checkSchedules(wf.CreatedAt.Add(30 * time.Minute))
+	if runs, _ := model.ListWorkflowRuns(wr.Supervisor.DB, model.WorkflowRunFilter{}); len(runs) != 0 {
+		t.Fatalf("ran before the interval passed: %+v", runs)
+	}
+
+	wr.checkSchedules(time.Now().Add(2 * time.Hour))
+	wr.wg.Wait()
+	runs, _ := model.ListWorkflowRuns(wr.Supervisor.DB, model.WorkflowRunFilter{})
+	if len(runs) != 1 || runs[0].Trigger != model.TriggerSchedule || runs[0].Status != model.WorkflowCompleted {
+		t.Fatalf("runs = %+v", runs)
+	}
+
+	// The next check measures from the scheduled run just made.
+	wr.checkSchedules(time.Now().Add(30 * time.Minute))
+	if runs, _ := model.ListWorkflowRuns(wr.Supervisor.DB, model.WorkflowRunFilter{}); len(runs) != 1 {
+		t.Errorf("scheduled twice within the interval: %d runs", len(runs))
+	}
+}
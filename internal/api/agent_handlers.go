@@ -1,7 +1,10 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -17,10 +20,27 @@ type AgentHandler struct {
 }
 
 type agentStatusEntry struct {
-	PersonaID   int64    `json:"persona_id"`
-	PersonaName string   `json:"persona_name"`
-	Status      string   `json:"status"`
-	Channels    []string `json:"channels"`
+	PersonaID       int64                `json:"persona_id"`
+	PersonaName     string               `json:"persona_name"`
+	Status          string               `json:"status"`
+	Channels        []string             `json:"channels"`
+	ChannelStatuses []agentChannelStatus `json:"channel_statuses"`
+
+	Restarts      int     `json:"restarts"`
+	Reloads       int     `json:"reloads"`
+	Crashes       int     `json:"crashes"`
+	LastCrashAt   *string `json:"last_crash_at"`
+	LastError     string  `json:"last_error"`
+	NextRestartAt *string `json:"next_restart_at"`
+	CircuitOpen   bool    `json:"circuit_open"`
+}
+
+// agentChannelStatus is a persona's status in one channel. Status is the
+// persona's summary across them, the most pressing channel status.
+type agentChannelStatus struct {
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Status      string `json:"status"`
 }
 
 type agentStatusResponse struct {
@@ -55,11 +75,20 @@ func (h *AgentHandler) Status(w http.ResponseWriter, r *http.Request) {
 			names[i] = ch.Name
 		}
 
+		health := h.Supervisor.Health(p.ID)
 		entries = append(entries, agentStatusEntry{
-			PersonaID:   p.ID,
-			PersonaName: p.Name,
-			Status:      status.String(),
-			Channels:    names,
+			PersonaID:       p.ID,
+			PersonaName:     p.Name,
+			Status:          status.String(),
+			Channels:        names,
+			ChannelStatuses: h.channelStatuses(p.ID, status, channels),
+			Restarts:        health.Restarts,
+			Reloads:         health.Reloads,
+			Crashes:         health.Crashes,
+			LastCrashAt:     formatTimePtr(health.LastCrashAt),
+			LastError:       health.LastError,
+			NextRestartAt:   formatTimePtr(health.NextRestartAt),
+			CircuitOpen:     health.CircuitOpen,
 		})
 	}
 
@@ -69,6 +98,49 @@ func (h *AgentHandler) Status(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func formatTimePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
+
+// channelStatuses lists the persona's status in each subscribed channel,
+// followed by other channels it is active in, such as delegation threads.
+func (h *AgentHandler) channelStatuses(personaID int64, personaStatus agent.Status, subscribed []model.Channel) []agentChannelStatus {
+	tracked := h.Supervisor.Status.Channels(personaID)
+	out := make([]agentChannelStatus, 0, len(subscribed))
+	seen := make(map[int64]bool, len(subscribed))
+	for _, ch := range subscribed {
+		seen[ch.ID] = true
+		st, ok := tracked[ch.ID]
+		if !ok {
+			st = agent.StatusIdle
+			if personaStatus == agent.StatusStopped {
+				st = agent.StatusStopped
+			}
+		}
+		out = append(out, agentChannelStatus{ChannelID: ch.ID, ChannelName: ch.Name, Status: st.String()})
+	}
+
+	var extra []int64
+	for id := range tracked {
+		if !seen[id] {
+			extra = append(extra, id)
+		}
+	}
+	slices.Sort(extra)
+	for _, id := range extra {
+		ch, err := model.GetChannel(h.DB, id)
+		if err != nil {
+			continue
+		}
+		out = append(out, agentChannelStatus{ChannelID: id, ChannelName: ch.Name, Status: tracked[id].String()})
+	}
+	return out
+}
+
 // Start starts the supervisor and all persona actors.
 func (h *AgentHandler) Start(w http.ResponseWriter, r *http.Request) {
 	if h.Supervisor.Running() {
@@ -80,6 +152,7 @@ func (h *AgentHandler) Start(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "failed to start agents")
 		return
 	}
+	auditChange(r, "", map[string]bool{"running": false}, map[string]bool{"running": true})
 
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "started"})
 }
@@ -92,19 +165,85 @@ func (h *AgentHandler) Stop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.Supervisor.StopAll()
+	auditChange(r, "", map[string]bool{"running": true}, map[string]bool{"running": false})
 
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "stopped"})
 }
 
+// StartActor starts one persona's actor.
+func (h *AgentHandler) StartActor(w http.ResponseWriter, r *http.Request) {
+	personaID, ok := ParseIntParam(w, r, "persona_id")
+	if !ok {
+		return
+	}
+
+	if err := h.Supervisor.StartActor(personaID); err != nil {
+		switch {
+		case errors.Is(err, agent.ErrActorRunning):
+			ErrorResponse(w, http.StatusConflict, "agent already running")
+		case errors.Is(err, sql.ErrNoRows):
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+		default:
+			ErrorResponse(w, http.StatusInternalServerError, "failed to start agent")
+		}
+		return
+	}
+	auditChange(r, "", map[string]bool{"running": false}, map[string]bool{"running": true})
+
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "started"})
+}
+
+// StopActor stops one persona's actor, cutting off its runs in progress.
+func (h *AgentHandler) StopActor(w http.ResponseWriter, r *http.Request) {
+	personaID, ok := ParseIntParam(w, r, "persona_id")
+	if !ok {
+		return
+	}
+
+	if !h.Supervisor.StopActor(personaID) {
+		ErrorResponse(w, http.StatusConflict, "agent not running")
+		return
+	}
+	auditChange(r, "", map[string]bool{"running": true}, map[string]bool{"running": false})
+
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "stopped"})
+}
+
+// RestartActor stops one persona's actor, if it is running, and starts it
+// again. This also closes the circuit of an actor that kept crashing.
+func (h *AgentHandler) RestartActor(w http.ResponseWriter, r *http.Request) {
+	personaID, ok := ParseIntParam(w, r, "persona_id")
+	if !ok {
+		return
+	}
+
+	wasRunning := h.Supervisor.ActorRunning(personaID)
+	if err := h.Supervisor.RestartActor(personaID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "failed to restart agent")
+		return
+	}
+	auditChange(r, "", map[string]bool{"running": wasRunning}, map[string]bool{"running": true})
+
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "restarted"})
+}
+
 type llmCallJSON struct {
 	ID               int64  `json:"id"`
 	PersonaID        int64  `json:"persona_id"`
+	PersonaVersion   int    `json:"persona_version"`
+	RunID            string `json:"run_id"`
 	ChannelID        int64  `json:"channel_id"`
 	Model            string `json:"model"`
 	MessagesJSON     string `json:"messages_json"`
 	ResponseJSON     string `json:"response_json"`
 	PromptTokens     int    `json:"prompt_tokens"`
 	CompletionTokens int    `json:"completion_tokens"`
+	StartedAt        string `json:"started_at,omitempty"`
+	DurationMs       int64  `json:"duration_ms"`
 	CreatedAt        string `json:"created_at"`
 }
 
@@ -112,38 +251,69 @@ func toLLMCallJSON(c model.LLMCall) llmCallJSON {
 	return llmCallJSON{
 		ID:               c.ID,
 		PersonaID:        c.PersonaID,
+		PersonaVersion:   c.PersonaVersion,
+		RunID:            c.RunID,
 		ChannelID:        c.ChannelID,
 		Model:            c.Model,
 		MessagesJSON:     c.MessagesJSON,
 		ResponseJSON:     c.ResponseJSON,
 		PromptTokens:     c.PromptTokens,
 		CompletionTokens: c.CompletionTokens,
+		StartedAt:        formatStartedAt(c.StartedAt),
+		DurationMs:       c.DurationMs,
 		CreatedAt:        c.CreatedAt.Format(time.RFC3339),
 	}
 }
 
 type toolExecJSON struct {
-	ID         int64  `json:"id"`
-	PersonaID  int64  `json:"persona_id"`
-	ToolName   string `json:"tool_name"`
-	ArgsJSON   string `json:"args_json"`
-	OutputText string `json:"output_text"`
-	ErrorText  string `json:"error_text"`
-	DurationMs int64  `json:"duration_ms"`
-	CreatedAt  string `json:"created_at"`
+	ID             int64  `json:"id"`
+	PersonaID      int64  `json:"persona_id"`
+	PersonaVersion int    `json:"persona_version"`
+	RunID          string `json:"run_id"`
+	ChannelID      int64  `json:"channel_id"`
+	ToolName       string `json:"tool_name"`
+	ArgsJSON       string `json:"args_json"`
+	OutputText     string `json:"output_text"`
+	ErrorText      string `json:"error_text"`
+	DurationMs     int64  `json:"duration_ms"`
+	Cancelled      bool   `json:"cancelled"`
+	StartedAt      string `json:"started_at,omitempty"`
+	CreatedAt      string `json:"created_at"`
 }
 
 func toToolExecJSON(e model.ToolExecution) toolExecJSON {
 	return toolExecJSON{
-		ID:         e.ID,
-		PersonaID:  e.PersonaID,
-		ToolName:   e.ToolName,
-		ArgsJSON:   e.ArgsJSON,
-		OutputText: e.OutputText,
-		ErrorText:  e.ErrorText,
-		DurationMs: e.DurationMs,
-		CreatedAt:  e.CreatedAt.Format(time.RFC3339),
+		ID:             e.ID,
+		PersonaID:      e.PersonaID,
+		PersonaVersion: e.PersonaVersion,
+		RunID:          e.RunID,
+		ChannelID:      e.ChannelID,
+		ToolName:       e.ToolName,
+		ArgsJSON:       e.ArgsJSON,
+		OutputText:     e.OutputText,
+		ErrorText:      e.ErrorText,
+		DurationMs:     e.DurationMs,
+		Cancelled:      e.Cancelled,
+		StartedAt:      formatStartedAt(e.StartedAt),
+		CreatedAt:      e.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// formatStartedAt formats a start time to the millisecond, or "" for rows
+// recorded before start times were kept.
+func formatStartedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+type actorCrashJSON struct {
+	ID        int64  `json:"id"`
+	PersonaID int64  `json:"persona_id"`
+	Error     string `json:"error"`
+	Stack     string `json:"stack"`
+	CreatedAt string `json:"created_at"`
 }
 
 type agentStatsJSON struct {
@@ -151,6 +321,19 @@ type agentStatsJSON struct {
 	TotalTokensLastHour int64   `json:"total_tokens_last_hour"`
 	ErrorCountLastHour  int64   `json:"error_count_last_hour"`
 	AvgResponseMs       float64 `json:"avg_response_ms"`
+
+	Versions []versionStatsJSON `json:"versions,omitempty"`
+}
+
+type versionStatsJSON struct {
+	Version          int     `json:"version"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	AvgTokensPerCall float64 `json:"avg_tokens_per_call"`
+	ToolExecutions   int64   `json:"tool_executions"`
+	ToolErrors       int64   `json:"tool_errors"`
+	ErrorRate        float64 `json:"error_rate"`
 }
 
 // LLMCalls returns paginated LLM calls for a persona.
@@ -197,7 +380,9 @@ func (h *AgentHandler) ToolExecutions(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, out)
 }
 
-// Stats returns summary statistics for a persona.
+// Stats returns summary statistics for a persona. With by_version=true the
+// response also breaks token use and tool error rates down by persona
+// version, over all recorded activity, to compare configurations.
 func (h *AgentHandler) Stats(w http.ResponseWriter, r *http.Request) {
 	personaID, ok := ParseIntParam(w, r, "persona_id")
 	if !ok {
@@ -210,12 +395,33 @@ func (h *AgentHandler) Stats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, agentStatsJSON{
+	out := agentStatsJSON{
 		TotalCallsLastHour:  stats.TotalCallsLastHour,
 		TotalTokensLastHour: stats.TotalTokensLastHour,
 		ErrorCountLastHour:  stats.ErrorCountLastHour,
 		AvgResponseMs:       stats.AvgResponseMs,
-	})
+	}
+	if r.URL.Query().Get("by_version") == "true" {
+		versions, err := model.GetPersonaVersionStats(h.DB, personaID)
+		if err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		out.Versions = make([]versionStatsJSON, len(versions))
+		for i, v := range versions {
+			out.Versions[i] = versionStatsJSON{
+				Version:          v.Version,
+				Calls:            v.Calls,
+				PromptTokens:     v.PromptTokens,
+				CompletionTokens: v.CompletionTokens,
+				AvgTokensPerCall: v.AvgTokensPerCall(),
+				ToolExecutions:   v.ToolExecutions,
+				ToolErrors:       v.ToolErrors,
+				ErrorRate:        v.ErrorRate(),
+			}
+		}
+	}
+	WriteJSON(w, http.StatusOK, out)
 }
 
 // parsePagination extracts limit and offset from query params with defaults and max bounds.
@@ -236,3 +442,31 @@ func parsePagination(r *http.Request, defaultLimit, maxLimit int) (int, int) {
 
 	return limit, offset
 }
+
+// Crashes returns paginated actor crashes for a persona, with stack traces.
+func (h *AgentHandler) Crashes(w http.ResponseWriter, r *http.Request) {
+	personaID, ok := ParseIntParam(w, r, "persona_id")
+	if !ok {
+		return
+	}
+
+	limit, offset := parsePagination(r, 50, 200)
+
+	crashes, err := model.ListActorCrashes(h.DB, personaID, limit, offset)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]actorCrashJSON, len(crashes))
+	for i, c := range crashes {
+		out[i] = actorCrashJSON{
+			ID:        c.ID,
+			PersonaID: c.PersonaID,
+			Error:     c.Error,
+			Stack:     c.Stack,
+			CreatedAt: c.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
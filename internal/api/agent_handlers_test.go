@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/waynenilsen/waynebot/internal/agent"
@@ -30,7 +33,7 @@ func newTestRouterWithSupervisor(t *testing.T, d *db.DB) (http.Handler, *agent.S
 	t.Cleanup(func() { hub.Stop() })
 
 	sup := agent.NewSupervisor(d, hub, idleLLM{}, tools.NewRegistry())
-	router := api.NewRouter(d, []string{"*"}, hub, sup)
+	router := api.NewRouter(d, []string{"*"}, "", hub, sup)
 	return router, sup
 }
 
@@ -109,6 +112,58 @@ func TestAgentStatusWithPersonas(t *testing.T) {
 	}
 }
 
+func TestAgentStatusChannelStatuses(t *testing.T) {
+	d := openTestDB(t)
+	router, sup := newTestRouterWithSupervisor(t, d)
+
+	token := registerUser(t, router, "alice", "password123", "")
+
+	p, err := model.CreatePersona(d, "testbot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	if err != nil {
+		t.Fatalf("create persona: %v", err)
+	}
+	general, _ := model.CreateChannel(d, "general", "", 0)
+	dev, _ := model.CreateChannel(d, "dev", "", 0)
+	model.SubscribeChannel(d, p.ID, general.ID)
+	model.SubscribeChannel(d, p.ID, dev.ID)
+
+	sup.Status.Set(p.ID, agent.StatusIdle)
+	sup.Status.SetChannel(p.ID, dev.ID, agent.StatusThinking)
+
+	rec := doJSON(t, router, "GET", "/api/agents/status", "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Agents []struct {
+			Status          string `json:"status"`
+			ChannelStatuses []struct {
+				ChannelID   int64  `json:"channel_id"`
+				ChannelName string `json:"channel_name"`
+				Status      string `json:"status"`
+			} `json:"channel_statuses"`
+		} `json:"agents"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if len(resp.Agents) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(resp.Agents))
+	}
+	a := resp.Agents[0]
+	if a.Status != "thinking" {
+		t.Errorf("status = %q, want thinking", a.Status)
+	}
+	got := map[string]string{}
+	for _, cs := range a.ChannelStatuses {
+		got[cs.ChannelName] = cs.Status
+	}
+	if len(got) != 2 || got["general"] != "idle" || got["dev"] != "thinking" {
+		t.Errorf("channel_statuses = %v, want general idle and dev thinking", got)
+	}
+}
+
 func TestAgentStartAndStop(t *testing.T) {
 	d := openTestDB(t)
 	router, _ := newTestRouterWithSupervisor(t, d)
@@ -339,3 +394,154 @@ func TestAgentLLMCallsUnauthenticated(t *testing.T) {
 		t.Errorf("status = %d, want 401", rec.Code)
 	}
 }
+
+type panicLLM struct{}
+
+func (panicLLM) ChatCompletion(_ context.Context, _ string, _ []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	panic("boom")
+}
+
+func TestAgentStatusReportsCrash(t *testing.T) {
+	// Actors run concurrently, so use a file rather than :memory:.
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	hub := ws.NewHub()
+	go hub.Run()
+	t.Cleanup(func() { hub.Stop() })
+	sup := agent.NewSupervisor(d, hub, panicLLM{}, tools.NewRegistry())
+	sup.RestartBackoff = time.Hour
+	router := api.NewRouter(d, []string{"*"}, "", hub, sup)
+
+	token := registerUser(t, router, "alice", "password123", "")
+	chID := createChannel(t, router, token, "general", "")
+	p, _ := model.CreatePersona(d, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	model.SubscribeChannel(d, p.ID, chID)
+	if err := sup.StartAll(); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	t.Cleanup(sup.StopAll)
+
+	doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", chID), `{"content": "hi"}`, "Authorization", "Bearer "+token)
+
+	type statusEntry struct {
+		Status        string  `json:"status"`
+		Restarts      int     `json:"restarts"`
+		Crashes       int     `json:"crashes"`
+		LastError     string  `json:"last_error"`
+		NextRestartAt *string `json:"next_restart_at"`
+		CircuitOpen   bool    `json:"circuit_open"`
+	}
+	var entry statusEntry
+	deadline := time.Now().Add(2 * time.Second)
+	for entry.Status != "crashed" {
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %q, want crashed", entry.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+		rec := doJSON(t, router, "GET", "/api/agents/status", "", "Authorization", "Bearer "+token)
+		var resp struct {
+			Agents []statusEntry `json:"agents"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		entry = resp.Agents[0]
+	}
+	if entry.Crashes != 1 || entry.Restarts != 0 || entry.LastError != "actor panic: boom" || entry.NextRestartAt == nil || entry.CircuitOpen {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/agents/%d/crashes", p.ID), "", "Authorization", "Bearer "+token)
+	var crashes []struct {
+		Error string `json:"error"`
+		Stack string `json:"stack"`
+	}
+	json.NewDecoder(rec.Body).Decode(&crashes)
+	if len(crashes) != 1 || crashes[0].Error != "actor panic: boom" || !strings.Contains(crashes[0].Stack, "panicLLM") {
+		t.Errorf("crashes = %+v", crashes)
+	}
+}
+
+func TestPersonaChangesReachRunningActors(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	router, sup := newTestRouterWithSupervisor(t, d)
+	if err := sup.StartAll(); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	t.Cleanup(sup.StopAll)
+
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+	id := createPersona(t, router, token, "bot", "prompt")
+	if !sup.ActorRunning(id) {
+		t.Fatal("actor not started for new persona")
+	}
+
+	body := `{"name":"bot","system_prompt":"new prompt","model":"gpt-5","tools_enabled":[]}`
+	if rec := doJSON(t, router, "PUT", fmt.Sprintf("/api/personas/%d", id), body, auth...); rec.Code != http.StatusOK {
+		t.Fatalf("update: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for sup.Health(id).Reloads != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("actor not reloaded after update")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec := doJSON(t, router, "DELETE", fmt.Sprintf("/api/personas/%d", id), "", auth...); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status=%d", rec.Code)
+	}
+	if sup.ActorRunning(id) {
+		t.Error("actor still running after the persona was deleted")
+	}
+}
+
+func TestAgentStartStopRestartOne(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	router, sup := newTestRouterWithSupervisor(t, d)
+	t.Cleanup(sup.StopAll)
+
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+	p, _ := model.CreatePersona(d, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	base := fmt.Sprintf("/api/agents/%d", p.ID)
+
+	steps := []struct {
+		path    string
+		want    int
+		running bool
+	}{
+		{"/stop", http.StatusConflict, false},
+		{"/start", http.StatusOK, true},
+		{"/start", http.StatusConflict, true},
+		{"/restart", http.StatusOK, true},
+		{"/stop", http.StatusOK, false},
+		{"/restart", http.StatusOK, true},
+	}
+	for _, s := range steps {
+		rec := doJSON(t, router, "POST", base+s.path, "", auth...)
+		if rec.Code != s.want {
+			t.Fatalf("POST %s: status = %d, want %d (body=%s)", s.path, rec.Code, s.want, rec.Body.String())
+		}
+		if got := sup.ActorRunning(p.ID); got != s.running {
+			t.Fatalf("after POST %s: running = %v, want %v", s.path, got, s.running)
+		}
+	}
+
+	for _, path := range []string{"/start", "/restart"} {
+		if rec := doJSON(t, router, "POST", "/api/agents/999"+path, "", auth...); rec.Code != http.StatusNotFound {
+			t.Errorf("POST %s for unknown persona: status = %d, want 404", path, rec.Code)
+		}
+	}
+}
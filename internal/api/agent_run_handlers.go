@@ -0,0 +1,105 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+type agentRunJSON struct {
+	ID         string  `json:"id"`
+	PersonaID  int64   `json:"persona_id"`
+	ChannelID  int64   `json:"channel_id"`
+	Trigger    string  `json:"trigger"`
+	Status     string  `json:"status"`
+	Reason     string  `json:"reason"`
+	Output     string  `json:"output"`
+	StartedAt  string  `json:"started_at"`
+	FinishedAt *string `json:"finished_at"`
+}
+
+func toAgentRunJSON(r model.AgentRun) agentRunJSON {
+	out := agentRunJSON{
+		ID:        r.ID,
+		PersonaID: r.PersonaID,
+		ChannelID: r.ChannelID,
+		Trigger:   r.Trigger,
+		Status:    r.Status,
+		Reason:    r.Reason,
+		Output:    r.Output,
+		StartedAt: r.StartedAt.Format(time.RFC3339),
+	}
+	if r.FinishedAt != nil {
+		s := r.FinishedAt.Format(time.RFC3339)
+		out.FinishedAt = &s
+	}
+	return out
+}
+
+// Runs returns a persona's runs, newest first. With status=running only the
+// runs in progress are listed.
+func (h *AgentHandler) Runs(w http.ResponseWriter, r *http.Request) {
+	personaID, ok := ParseIntParam(w, r, "persona_id")
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("status") == model.RunRunning {
+		out := []agentRunJSON{}
+		for _, info := range h.Supervisor.Runs.List(personaID) {
+			run, err := model.GetAgentRun(h.DB, info.ID)
+			if err != nil {
+				continue
+			}
+			out = append(out, toAgentRunJSON(run))
+		}
+		WriteJSON(w, http.StatusOK, out)
+		return
+	}
+
+	limit, offset := parsePagination(r, 50, 200)
+	runs, err := model.ListAgentRuns(h.DB, personaID, limit, offset)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]agentRunJSON, len(runs))
+	for i, run := range runs {
+		out[i] = toAgentRunJSON(run)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// CancelRun cancels a persona's run in progress, interrupting its LLM or
+// tool call. The run is recorded as cancelled.
+func (h *AgentHandler) CancelRun(w http.ResponseWriter, r *http.Request) {
+	personaID, ok := ParseIntParam(w, r, "persona_id")
+	if !ok {
+		return
+	}
+	runID := chi.URLParam(r, "run_id")
+
+	if h.Supervisor.Runs.Cancel(personaID, runID) {
+		auditChange(r, "", map[string]string{"status": model.RunRunning}, map[string]string{"status": model.RunCancelled})
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	run, err := model.GetAgentRun(h.DB, runID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "run not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if run.PersonaID != personaID {
+		ErrorResponse(w, http.StatusNotFound, "run not found")
+		return
+	}
+	ErrorResponse(w, http.StatusConflict, "run is not in progress")
+}
@@ -0,0 +1,162 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/api"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+type blockingLLM struct{}
+
+func (blockingLLM) ChatCompletion(ctx context.Context, _ string, _ []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	<-ctx.Done()
+	return llm.Response{}, ctx.Err()
+}
+
+type agentRunResp struct {
+	ID        string `json:"id"`
+	PersonaID int64  `json:"persona_id"`
+	ChannelID int64  `json:"channel_id"`
+	Trigger   string `json:"trigger"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+}
+
+func TestCancelRunEndpoint(t *testing.T) {
+	// Actors run concurrently, so use a file rather than :memory:, where
+	// each pooled connection would get its own empty database.
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	hub := ws.NewHub()
+	go hub.Run()
+	t.Cleanup(func() { hub.Stop() })
+	sup := agent.NewSupervisor(d, hub, blockingLLM{}, tools.NewRegistry())
+	router := api.NewRouter(d, []string{"*"}, "", hub, sup)
+
+	token := registerUser(t, router, "alice", "password123", "")
+	chID := createChannel(t, router, token, "general", "")
+	p, _ := model.CreatePersona(d, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	model.SubscribeChannel(d, p.ID, chID)
+
+	if err := sup.StartAll(); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	t.Cleanup(sup.StopAll)
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", chID), `{"content":"hello"}`,
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("post message: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	var running []agentRunResp
+	deadline := time.Now().Add(2 * time.Second)
+	for len(running) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = doJSON(t, router, "GET", fmt.Sprintf("/api/agents/%d/runs?status=running", p.ID), "",
+			"Authorization", "Bearer "+token)
+		json.NewDecoder(rec.Body).Decode(&running)
+	}
+	if len(running) != 1 {
+		t.Fatalf("expected one run in progress, got %d", len(running))
+	}
+	run := running[0]
+	if run.ChannelID != chID || run.Trigger != "message" || run.Status != "running" {
+		t.Errorf("run = %+v", run)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/agents/%d/runs/%s/cancel", p.ID+1, run.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("cancel as another persona: status = %d, want 404", rec.Code)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/agents/%d/runs/%s/cancel", p.ID, run.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	var got model.AgentRun
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got, _ = model.GetAgentRun(d, run.ID); got.Status != model.RunRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Status != model.RunCancelled || got.Reason != "cancelled by user" {
+		t.Fatalf("run status = %q reason = %q, want cancelled by user", got.Status, got.Reason)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/agents/%d/runs/%s/cancel", p.ID, run.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("cancel finished run: status = %d, want 409", rec.Code)
+	}
+
+	var history []agentRunResp
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/agents/%d/runs", p.ID), "",
+		"Authorization", "Bearer "+token)
+	json.NewDecoder(rec.Body).Decode(&history)
+	if len(history) != 1 || history[0].Status != "cancelled" {
+		t.Errorf("runs = %+v, want the cancelled run", history)
+	}
+}
+
+func TestCancelRunNotFound(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+
+	rec := doJSON(t, router, "POST", "/api/agents/1/runs/nope/cancel", "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+
+	rec = doJSON(t, router, "POST", "/api/agents/1/runs/nope/cancel", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestToolExecutionsReportCancelled(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	p, _ := model.CreatePersona(d, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	if _, err := d.WriteExec(
+		`INSERT INTO tool_executions (persona_id, tool_name, args_json, output_text, error_text, duration_ms, cancelled)
+		 VALUES (?, 'shell_exec', '{}', '', 'context canceled', 5, 1)`, p.ID,
+	); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/agents/%d/tool-executions", p.ID), "",
+		"Authorization", "Bearer "+token)
+	var execs []struct {
+		Cancelled bool `json:"cancelled"`
+	}
+	json.NewDecoder(rec.Body).Decode(&execs)
+	if len(execs) != 1 || !execs[0].Cancelled {
+		t.Errorf("tool executions = %+v, want one cancelled", execs)
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// ArchiveHandler browses, searches and restores the LLM calls and tool
+// executions the archiver moved out of the database.
+type ArchiveHandler struct {
+	DB       *db.DB
+	Archiver *agent.Archiver
+}
+
+type archiveJSON struct {
+	ID        int64  `json:"id"`
+	PersonaID int64  `json:"persona_id"`
+	Table     string `json:"table"`
+	File      string `json:"file"`
+	RowCount  int    `json:"row_count"`
+	MinRowID  int64  `json:"min_row_id"`
+	MaxRowID  int64  `json:"max_row_id"`
+	FirstAt   string `json:"first_at"`
+	LastAt    string `json:"last_at"`
+	SizeBytes int64  `json:"size_bytes"`
+	CreatedAt string `json:"created_at"`
+}
+
+func toArchiveJSON(a model.Archive) archiveJSON {
+	return archiveJSON{
+		ID:        a.ID,
+		PersonaID: a.PersonaID,
+		Table:     a.TableName,
+		File:      a.File,
+		RowCount:  a.RowCount,
+		MinRowID:  a.MinRowID,
+		MaxRowID:  a.MaxRowID,
+		FirstAt:   formatStartedAt(a.FirstAt),
+		LastAt:    formatStartedAt(a.LastAt),
+		SizeBytes: a.SizeBytes,
+		CreatedAt: a.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+type archivedRowJSON struct {
+	ArchiveID int64          `json:"archive_id"`
+	Table     string         `json:"table"`
+	Row       map[string]any `json:"row"`
+}
+
+// parseArchiveQuery reads the persona_id, table, since, until and q query
+// parameters and the pagination, writing a 400 error on failure.
+func parseArchiveQuery(w http.ResponseWriter, r *http.Request) (agent.ArchiveQuery, bool) {
+	query := r.URL.Query()
+	q := agent.ArchiveQuery{Text: query.Get("q")}
+	q.TableName = query.Get("table")
+	if q.TableName != "" && !agent.IsArchivedTable(q.TableName) {
+		ErrorResponse(w, http.StatusBadRequest, "table must be llm_calls or tool_executions")
+		return q, false
+	}
+	if v := query.Get("persona_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "invalid persona_id")
+			return q, false
+		}
+		q.PersonaID = id
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		v := query.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "invalid "+p.name+": want an RFC 3339 time")
+			return q, false
+		}
+		*p.dst = t
+	}
+	q.Limit, q.Offset = parsePagination(r, 50, 500)
+	return q, true
+}
+
+func writeArchivedRows(w http.ResponseWriter, rows []agent.ArchivedRow) {
+	out := make([]archivedRowJSON, len(rows))
+	for i, r := range rows {
+		out[i] = archivedRowJSON{ArchiveID: r.ArchiveID, Table: r.TableName, Row: r.Row}
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+func (h *ArchiveHandler) lookupArchive(w http.ResponseWriter, r *http.Request) (model.Archive, bool) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return model.Archive{}, false
+	}
+	a, err := model.GetArchive(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "archive not found")
+			return model.Archive{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Archive{}, false
+	}
+	return a, true
+}
+
+// ListArchives handles GET /api/archives: the archives whose rows overlap
+// since and until, filtered by persona_id and table, oldest first.
+func (h *ArchiveHandler) ListArchives(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseArchiveQuery(w, r)
+	if !ok {
+		return
+	}
+	archives, err := model.ListArchives(h.DB, q.ArchiveFilter)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]archiveJSON, len(archives))
+	for i, a := range archives {
+		out[i] = toArchiveJSON(a)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// Search handles GET /api/archives/search: archived rows matching the text
+// q and created between since and until, across the archives for persona_id
+// and table.
+func (h *ArchiveHandler) Search(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseArchiveQuery(w, r)
+	if !ok {
+		return
+	}
+	rows, err := h.Archiver.Search(q)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeArchivedRows(w, rows)
+}
+
+// GetArchive handles GET /api/archives/{id}.
+func (h *ArchiveHandler) GetArchive(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.lookupArchive(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, toArchiveJSON(a))
+}
+
+// Rows handles GET /api/archives/{id}/rows: the archive's rows matching q,
+// since and until, in ID order.
+func (h *ArchiveHandler) Rows(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.lookupArchive(w, r)
+	if !ok {
+		return
+	}
+	q, ok := parseArchiveQuery(w, r)
+	if !ok {
+		return
+	}
+	rows, err := h.Archiver.Rows(a, q)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeArchivedRows(w, rows)
+}
+
+// Restore handles POST /api/archives/{id}/restore: it re-imports the
+// archive's rows and drops the archive.
+func (h *ArchiveHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.lookupArchive(w, r)
+	if !ok {
+		return
+	}
+	n, err := h.Archiver.Restore(a)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "failed to restore archive")
+		return
+	}
+	auditChange(r, "", toArchiveJSON(a), nil)
+	WriteJSON(w, http.StatusOK, map[string]int{"restored": n})
+}
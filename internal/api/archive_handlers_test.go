@@ -0,0 +1,145 @@
+package api_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/api"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// newArchiveTestRouter returns a router whose archiver has indexed one
+// archive of three LLM calls for the persona.
+func newArchiveTestRouter(t *testing.T, d *db.DB, personaID int64) http.Handler {
+	t.Helper()
+	hub := ws.NewHub()
+	go hub.Run()
+	t.Cleanup(func() { hub.Stop() })
+	sup := agent.NewSupervisor(d, hub, idleLLM{}, tools.NewRegistry())
+	sup.Archiver = newTestArchiver(t, d, personaID)
+	return api.NewRouter(d, []string{"*"}, "", hub, sup)
+}
+
+// newTestArchiver returns an archiver that has indexed one archive of three
+// LLM calls for the persona.
+func newTestArchiver(t *testing.T, d *db.DB, personaID int64) *agent.Archiver {
+	t.Helper()
+	dir := t.TempDir()
+	f, _ := os.Create(filepath.Join(dir, fmt.Sprintf("llm_calls_%d_20260101T000000Z.jsonl.gz", personaID)))
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	for i, msg := range []string{"deploy the app", "fix the bug", "deploy again"} {
+		enc.Encode(map[string]any{
+			"id": i + 1, "persona_id": personaID, "channel_id": 1, "model": "m",
+			"messages_json": fmt.Sprintf(`[{"role":"user","content":%q}]`, msg), "response_json": "{}",
+			"prompt_tokens": 10, "completion_tokens": 5,
+			"created_at": fmt.Sprintf("2026-01-01T00:0%d:00Z", i),
+		})
+	}
+	gz.Close()
+	f.Close()
+
+	archiver := &agent.Archiver{DB: d, ArchiveDir: dir}
+	if n, err := archiver.IndexExisting(); err != nil || n != 1 {
+		t.Fatalf("IndexExisting = %d, %v", n, err)
+	}
+	return archiver
+}
+
+type archivedRow struct {
+	ArchiveID int64          `json:"archive_id"`
+	Table     string         `json:"table"`
+	Row       map[string]any `json:"row"`
+}
+
+func TestArchiveBrowseAndSearch(t *testing.T) {
+	d := openTestDB(t)
+	router := newArchiveTestRouter(t, d, 4)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	rec := doJSON(t, router, "GET", "/api/archives?persona_id=4&table=llm_calls", "", auth...)
+	var archives []struct {
+		ID       int64  `json:"id"`
+		Table    string `json:"table"`
+		RowCount int    `json:"row_count"`
+		FirstAt  string `json:"first_at"`
+		LastAt   string `json:"last_at"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &archives)
+	if rec.Code != http.StatusOK || len(archives) != 1 {
+		t.Fatalf("list = %d %s", rec.Code, rec.Body.String())
+	}
+	a := archives[0]
+	if a.Table != "llm_calls" || a.RowCount != 3 || a.FirstAt != "2026-01-01T00:00:00.000Z" || a.LastAt != "2026-01-01T00:02:00.000Z" {
+		t.Errorf("archive = %+v", a)
+	}
+	rec = doJSON(t, router, "GET", "/api/archives?until=2025-12-31T00:00:00Z", "", auth...)
+	json.Unmarshal(rec.Body.Bytes(), &archives)
+	if len(archives) != 0 {
+		t.Errorf("archives before their rows = %+v", archives)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/archives/search?q=DEPLOY&persona_id=4", "", auth...)
+	var rows []archivedRow
+	json.Unmarshal(rec.Body.Bytes(), &rows)
+	if rec.Code != http.StatusOK || len(rows) != 2 || rows[0].ArchiveID != a.ID || rows[1].Row["id"] != float64(3) {
+		t.Fatalf("search = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/archives/%d/rows?since=2026-01-01T00:01:00Z&until=2026-01-01T00:02:00Z", a.ID), "", auth...)
+	json.Unmarshal(rec.Body.Bytes(), &rows)
+	if len(rows) != 1 || rows[0].Row["id"] != float64(2) || rows[0].Table != "llm_calls" {
+		t.Errorf("rows in range = %s", rec.Body.String())
+	}
+
+	if rec := doJSON(t, router, "GET", "/api/archives/999", "", auth...); rec.Code != http.StatusNotFound {
+		t.Errorf("missing archive = %d, want 404", rec.Code)
+	}
+	if rec := doJSON(t, router, "GET", "/api/archives?table=messages", "", auth...); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad table = %d, want 400", rec.Code)
+	}
+}
+
+func TestArchiveRestore(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "prompt", "m", nil, 0.7, 100, 0, 0)
+	router := newArchiveTestRouter(t, d, p.ID)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	archives, _ := model.ListArchives(d, model.ArchiveFilter{})
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/archives/%d/restore", archives[0].ID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore = %d %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Restored int `json:"restored"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if got.Restored != 3 {
+		t.Errorf("restored = %d, want 3", got.Restored)
+	}
+
+	calls, _ := model.ListLLMCalls(d, p.ID, 10, 0)
+	if len(calls) != 3 || calls[0].ID != 3 || calls[0].PromptTokens != 10 || calls[0].CreatedAt.Minute() != 2 {
+		t.Errorf("restored calls = %+v", calls)
+	}
+	if rec := doJSON(t, router, "GET", fmt.Sprintf("/api/archives/%d", archives[0].ID), "", auth...); rec.Code != http.StatusNotFound {
+		t.Errorf("restored archive still listed: %d", rec.Code)
+	}
+
+	events, _ := model.ListAuditEvents(d, model.AuditFilter{Action: "POST /api/archives/{id}/restore"})
+	if len(events) != 1 || events[0].Before == "" {
+		t.Errorf("restore audit events = %+v", events)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// unaudited are mutating routes that change nothing anyone else sees, and
+// would drown the log: read markers and WebSocket tickets.
+var unaudited = []string{
+	"POST /api/channels/{id}/read",
+	"POST /api/ws/ticket",
+}
+
+type auditKey struct{}
+
+// auditRecord collects what a handler reports about its change while the
+// request is served.
+type auditRecord struct {
+	target string
+	before any
+	after  any
+}
+
+// AuditMiddleware records an audit event for every mutating request, after
+// it is served. The action is the method and route pattern, e.g.
+// "DELETE /api/personas/{id}", and the target the path below /api, e.g.
+// "personas/3". Handlers add the target's state before and after the change
+// with auditChange.
+func AuditMiddleware(d *db.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &auditRecord{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditKey{}, rec)))
+
+			rctx := chi.RouteContext(r.Context())
+			if rctx == nil || rctx.RoutePattern() == "" {
+				return
+			}
+			action := r.Method + " " + rctx.RoutePattern()
+			if slices.Contains(unaudited, action) {
+				return
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			e := model.AuditEvent{
+				Action:     action,
+				Target:     rec.target,
+				Status:     status,
+				RemoteAddr: r.RemoteAddr,
+			}
+			if e.Target == "" {
+				e.Target = strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "api/")
+			}
+			if u := GetUser(r); u != nil {
+				e.UserID, e.Username = u.ID, u.Username
+			}
+			e.Before, e.After, e.Diff = auditJSON(rec.before, rec.after)
+			if _, err := model.CreateAuditEvent(d, e); err != nil {
+				slog.Error("audit: record event", "action", action, "target", e.Target, "err", err)
+			}
+		})
+	}
+}
+
+// auditChange reports the state of the request's target before and after
+// the change, either of which may be nil: before for creations, after for
+// deletions. A non-empty target replaces the one taken from the path, e.g.
+// to name the persona a POST /api/personas created.
+func auditChange(r *http.Request, target string, before, after any) {
+	rec, ok := r.Context().Value(auditKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	if target != "" {
+		rec.target = target
+	}
+	rec.before, rec.after = before, after
+}
+
+// auditJSON encodes before and after and diffs their fields.
+func auditJSON(before, after any) (beforeJSON, afterJSON, diffJSON string) {
+	if before == nil && after == nil {
+		return "", "", ""
+	}
+	encode := func(v any) (string, map[string]any) {
+		if v == nil {
+			return "", nil
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", nil
+		}
+		var fields map[string]any
+		json.Unmarshal(data, &fields)
+		return string(data), fields
+	}
+	beforeJSON, b := encode(before)
+	afterJSON, a := encode(after)
+	if diff := diffFields(b, a); len(diff) > 0 {
+		data, _ := json.Marshal(diff)
+		diffJSON = string(data)
+	}
+	return beforeJSON, afterJSON, diffJSON
+}
+
+// fieldChange is one field's value before and after a change; nil where the
+// field did not exist.
+type fieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// diffFields lists the top-level fields whose values differ, by name.
+func diffFields(before, after map[string]any) []fieldChange {
+	var names []string
+	for k := range before {
+		names = append(names, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var out []fieldChange
+	for _, k := range names {
+		if !reflect.DeepEqual(before[k], after[k]) {
+			out = append(out, fieldChange{Field: k, Before: before[k], After: after[k]})
+		}
+	}
+	return out
+}
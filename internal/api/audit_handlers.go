@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// AuditHandler serves the audit log AuditMiddleware writes.
+type AuditHandler struct {
+	DB *db.DB
+}
+
+type auditEventJSON struct {
+	ID         int64           `json:"id"`
+	UserID     *int64          `json:"user_id"`
+	Username   string          `json:"username"`
+	Action     string          `json:"action"`
+	Target     string          `json:"target"`
+	Status     int             `json:"status"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+	RemoteAddr string          `json:"remote_addr"`
+	CreatedAt  string          `json:"created_at"`
+}
+
+func toAuditEventJSON(e model.AuditEvent) auditEventJSON {
+	out := auditEventJSON{
+		ID:         e.ID,
+		Username:   e.Username,
+		Action:     e.Action,
+		Target:     e.Target,
+		Status:     e.Status,
+		RemoteAddr: e.RemoteAddr,
+		CreatedAt:  formatStartedAt(e.CreatedAt),
+	}
+	if e.UserID != 0 {
+		out.UserID = &e.UserID
+	}
+	if e.Before != "" {
+		out.Before = json.RawMessage(e.Before)
+	}
+	if e.After != "" {
+		out.After = json.RawMessage(e.After)
+	}
+	if e.Diff != "" {
+		out.Diff = json.RawMessage(e.Diff)
+	}
+	return out
+}
+
+// parseAuditFilter reads the user_id, action, target, since and until query
+// parameters, writing a 400 error on failure. since and until are RFC 3339
+// times; action and target match by prefix when they end in "*".
+func parseAuditFilter(w http.ResponseWriter, r *http.Request) (model.AuditFilter, bool) {
+	q := r.URL.Query()
+	f := model.AuditFilter{Action: q.Get("action"), Target: q.Get("target")}
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "invalid user_id")
+			return f, false
+		}
+		f.UserID = id
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "invalid "+name+": want an RFC 3339 time")
+			return f, false
+		}
+		*dst = t
+	}
+	return f, true
+}
+
+// ListEvents handles GET /api/audit, newest first.
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+	f.Limit, f.Offset = parsePagination(r, 50, 200)
+
+	events, err := model.ListAuditEvents(h.DB, f)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]auditEventJSON, len(events))
+	for i, e := range events {
+		out[i] = toAuditEventJSON(e)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// ExportEvents handles GET /api/audit/export: every event matching the
+// filters, newest first, one JSON object per line.
+func (h *AuditHandler) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := model.ListAuditEvents(h.DB, f)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(toAuditEventJSON(e)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/api"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+type auditEvent struct {
+	ID       int64  `json:"id"`
+	UserID   *int64 `json:"user_id"`
+	Username string `json:"username"`
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	Status   int    `json:"status"`
+	Before   map[string]any
+	After    map[string]any
+	Diff     []struct {
+		Field  string `json:"field"`
+		Before any    `json:"before"`
+		After  any    `json:"after"`
+	} `json:"diff"`
+}
+
+func TestAuditPersonaChanges(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	id := createPersona(t, router, token, "bot", "be helpful")
+	doJSON(t, router, "PUT", fmt.Sprintf("/api/personas/%d", id),
+		`{"name":"bot","system_prompt":"be brief","model":"gpt-4","temperature":0.7,"max_tokens":1000,"cooldown_secs":5,"max_tokens_per_hour":10000}`, auth...)
+	doJSON(t, router, "DELETE", fmt.Sprintf("/api/personas/%d", id), "", auth...)
+	doJSON(t, router, "DELETE", "/api/personas/999", "", auth...)
+	// Read markers are not audited.
+	chID := createChannel(t, router, token, "general", "")
+	doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/read", chID), `{"message_id":0}`, auth...)
+
+	rec := doJSON(t, router, "GET", "/api/audit?target=personas/*", "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list audit: %d %s", rec.Code, rec.Body.String())
+	}
+	var events []auditEvent
+	json.Unmarshal(rec.Body.Bytes(), &events)
+	if len(events) != 4 {
+		t.Fatalf("got %d persona events, want 4: %s", len(events), rec.Body.String())
+	}
+
+	// Newest first.
+	missing, deleted, updated, created := events[0], events[1], events[2], events[3]
+	target := fmt.Sprintf("personas/%d", id)
+	if created.Action != "POST /api/personas" || created.Target != target || created.Status != http.StatusCreated ||
+		created.Username != "alice" || created.UserID == nil || created.Before != nil || created.After["name"] != "bot" {
+		t.Errorf("create event = %+v", created)
+	}
+	if updated.Action != "PUT /api/personas/{id}" || updated.Target != target ||
+		len(updated.Diff) != 2 || updated.Diff[0].Field != "system_prompt" || updated.Diff[1].Field != "version" ||
+		updated.Diff[0].Before != "be helpful" || updated.Diff[0].After != "be brief" {
+		t.Errorf("update event = %+v", updated)
+	}
+	if deleted.Action != "DELETE /api/personas/{id}" || deleted.Before["name"] != "bot" || deleted.After != nil {
+		t.Errorf("delete event = %+v", deleted)
+	}
+	if missing.Target != "personas/999" || missing.Status != http.StatusNotFound || missing.Diff != nil {
+		t.Errorf("failed delete event = %+v", missing)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/audit", "", auth...)
+	json.Unmarshal(rec.Body.Bytes(), &events)
+	for _, e := range events {
+		if strings.HasSuffix(e.Action, "/read") {
+			t.Errorf("read marker audited: %+v", e)
+		}
+	}
+}
+
+func TestAuditSlashCommands(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+	chID := createChannel(t, router, token, "general", "")
+	p, _ := model.CreatePersona(d, "bot", "prompt", "base-model", nil, 0.7, 100, 0, 0)
+
+	runCommand(t, router, token, chID, "/invite @bot")
+	runCommand(t, router, token, chID, "/model @bot fast-model")
+	runCommand(t, router, token, chID, "/kick @bot")
+
+	events := func(target string) []auditEvent {
+		t.Helper()
+		rec := doJSON(t, router, "GET", "/api/audit?target="+target, "", auth...)
+		var out []auditEvent
+		json.Unmarshal(rec.Body.Bytes(), &out)
+		return out
+	}
+	members := events(fmt.Sprintf("channels/%d/members", chID))
+	if len(members) != 2 {
+		t.Fatalf("got %d membership events, want 2: %+v", len(members), members)
+	}
+	kick, invite := members[0], members[1]
+	if invite.Action != "POST /api/channels/{id}/messages" || invite.Before != nil || invite.After["persona_id"] != float64(p.ID) {
+		t.Errorf("invite event = %+v", invite)
+	}
+	if kick.Before["persona_id"] != float64(p.ID) || kick.After != nil {
+		t.Errorf("kick event = %+v", kick)
+	}
+
+	settings := events(fmt.Sprintf("personas/%d/channel-settings/%d", p.ID, chID))
+	if len(settings) != 1 || settings[0].Before["model"] != nil || settings[0].After["model"] != "fast-model" {
+		t.Fatalf("channel settings events = %+v", settings)
+	}
+}
+
+func TestAuditFiltersAndExport(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	alice := registerUser(t, router, "alice", "password123", "")
+	rec := doJSON(t, router, "POST", "/api/invites", "", "Authorization", "Bearer "+alice)
+	var inv struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &inv)
+	bob := registerUser(t, router, "bob", "password123", inv.Code)
+	chID := createChannel(t, router, alice, "general", "")
+	createPersona(t, router, bob, "bot", "prompt")
+	doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/members", chID), `{"user_id":2}`, "Authorization", "Bearer "+alice)
+
+	auth := []string{"Authorization", "Bearer " + alice}
+	rec = doJSON(t, router, "GET", "/api/audit?action=POST+/api/channels/{id}/members", "", auth...)
+	var events []auditEvent
+	json.Unmarshal(rec.Body.Bytes(), &events)
+	if len(events) != 1 || events[0].After["user_id"] != float64(2) || events[0].Username != "alice" {
+		t.Fatalf("member events = %+v", events)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/audit?user_id=2&action=POST+/api/personas", "", auth...)
+	json.Unmarshal(rec.Body.Bytes(), &events)
+	if len(events) != 1 || events[0].Username != "bob" {
+		t.Errorf("bob's persona events = %+v", events)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/audit?since=2999-01-01T00:00:00Z", "", auth...)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("future since = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := doJSON(t, router, "GET", "/api/audit?until=yesterday", "", auth...); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad until = %d, want 400", rec.Code)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/audit/export?target=channels/*", "", auth...)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("export = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var lines []auditEvent
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		var e auditEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("export line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, e)
+	}
+	if len(lines) != 2 || lines[0].Action != "POST /api/channels/{id}/members" || lines[1].Action != "POST /api/channels" {
+		t.Errorf("export = %+v", lines)
+	}
+
+	if rec := doJSON(t, router, "GET", "/api/audit", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated = %d, want 401", rec.Code)
+	}
+}
+
+// TestAuditRecordsEveryMutatingRoute makes a successful request to each of
+// the router's mutating routes, then walks the routes and checks each one's
+// latest audit event has the target's state before or after the change.
+func TestAuditRecordsEveryMutatingRoute(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	hub := ws.NewHub()
+	go hub.Run()
+	t.Cleanup(func() { hub.Stop() })
+	sup := agent.NewSupervisor(d, hub, blockingLLM{}, tools.NewRegistry())
+	// The archive is of persona 1, created below.
+	sup.Archiver = newTestArchiver(t, d, 1)
+	router := api.NewRouter(d, []string{"*"}, "", hub, sup)
+	t.Cleanup(sup.StopAll)
+
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+	call := func(method, path, body string, headers ...string) map[string]any {
+		t.Helper()
+		rec := doJSON(t, router, method, path, body, append(auth, headers...)...)
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s: %d %s", method, path, rec.Code, rec.Body.String())
+		}
+		var out map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &out)
+		return out
+	}
+	id := func(v map[string]any) int64 {
+		f, _ := v["id"].(float64)
+		return int64(f)
+	}
+
+	login := call("POST", "/api/auth/login", `{"username":"alice","password":"password123"}`)
+	call("POST", "/api/invites", "")
+
+	chID := createChannel(t, router, token, "general", "")
+	ch := fmt.Sprintf("/api/channels/%d", chID)
+	msg := call("POST", ch+"/messages", `{"content":"hello"}`)
+	call("PUT", fmt.Sprintf("%s/messages/%d/reactions", ch, id(msg)), `{"emoji":"+1"}`)
+	call("DELETE", fmt.Sprintf("%s/messages/%d/reactions", ch, id(msg)), `{"emoji":"+1"}`)
+
+	personaID := createPersona(t, router, token, "bot", "be helpful")
+	persona := fmt.Sprintf("/api/personas/%d", personaID)
+	call("PUT", persona, `{"name":"bot","system_prompt":"be brief","model":"gpt-4","temperature":0.7,"max_tokens":1000}`)
+	call("POST", persona+"/versions/1/rollback", "")
+	call("PUT", fmt.Sprintf("%s/channel-settings/%d", persona, chID), `{"model":"gpt-4o"}`)
+	call("DELETE", fmt.Sprintf("%s/channel-settings/%d", persona, chID), "")
+	rec := doJSON(t, router, "GET", persona+"/export", "", auth...)
+	imported := call("POST", "/api/personas/import?on_conflict=rename", rec.Body.String())
+	call("DELETE", fmt.Sprintf("/api/personas/%d", id(imported["persona"].(map[string]any))), "")
+	call("POST", ch+"/members", fmt.Sprintf(`{"persona_id":%d}`, personaID))
+	call("DELETE", ch+"/members", fmt.Sprintf(`{"persona_id":%d}`, personaID))
+	call("POST", ch+"/members", fmt.Sprintf(`{"persona_id":%d}`, personaID))
+	call("POST", "/api/dms", fmt.Sprintf(`{"persona_id":%d}`, personaID))
+
+	repo := gitRepo(t)
+	projectID := createProject(t, router, token, "repo", repo, "")
+	project := fmt.Sprintf("/api/projects/%d", projectID)
+	call("PUT", project, fmt.Sprintf(`{"name":"repo","path":%q,"description":"the repo"}`, repo))
+	call("DELETE", fmt.Sprintf("/api/projects/%d", createProject(t, router, token, "scratch", t.TempDir(), "")), "")
+	call("POST", ch+"/projects", fmt.Sprintf(`{"project_id":%d}`, projectID))
+	call("DELETE", fmt.Sprintf("%s/projects/%d", ch, projectID), "")
+	call("PUT", project+"/documents/decisions/log", `{"content":"use sqlite"}`)
+	call("POST", project+"/documents/decisions/log", `{"content":"and chi"}`)
+	call("DELETE", project+"/documents/decisions/log", "")
+
+	dir, err := tools.NewWorktrees(t.TempDir()).Ensure(context.Background(), projectID, repo, personaID, "bot")
+	if err != nil {
+		t.Fatalf("ensure worktree: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "feature.txt"), []byte("feature\n"), 0o644)
+	if _, err := tools.GitCommit("")(tools.WithProjectDir(context.Background(), dir), json.RawMessage(`{"message":"add feature"}`)); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	call("POST", fmt.Sprintf("%s/persona-branches/%d/merge", project, personaID), "")
+
+	journalDir, journalID := seedRunChanges(t, d, personaID)
+	changes, err := model.ListRunFileChanges(d, journalID, "run1")
+	if err != nil || len(changes) != 3 {
+		t.Fatalf("run changes = %d, %v", len(changes), err)
+	}
+	call("POST", fmt.Sprintf("/api/projects/%d/changes/%d/revert", journalID, changes[2].ID), "")
+	call("POST", fmt.Sprintf("/api/projects/%d/runs/run1/revert", journalID), "")
+	for i, action := range []string{"apply", "reject"} {
+		cs, err := model.CreateChangeset(d, personaID, chID, journalID, journalDir, []model.ChangesetFile{
+			{Path: fmt.Sprintf("staged%d.txt", i), NewContent: "staged\n"},
+		})
+		if err != nil {
+			t.Fatalf("create changeset: %v", err)
+		}
+		call("POST", fmt.Sprintf("%s/changesets/%d/%s", ch, cs.ID, action), "")
+	}
+
+	mem := call("POST", "/api/memories", fmt.Sprintf(`{"scope":"persona","persona_id":%d,"title":"db","content":"sqlite"}`, personaID))
+	call("PUT", fmt.Sprintf("/api/memories/%d", id(mem)), `{"content":"sqlite, WAL mode"}`)
+	call("DELETE", fmt.Sprintf("/api/memories/%d", id(mem)), "")
+
+	task := call("POST", "/api/tasks", `{"title":"ship it"}`)
+	call("PUT", fmt.Sprintf("/api/tasks/%d", id(task)), `{"status":"done"}`)
+	call("POST", fmt.Sprintf("/api/tasks/%d/comments", id(task)), `{"body":"shipped"}`)
+	call("DELETE", fmt.Sprintf("/api/tasks/%d", id(task)), "")
+
+	res, err := d.WriteExec(
+		`INSERT INTO agent_jobs (persona_id, channel_id, from_message_id, to_message_id, status, last_error)
+		 VALUES (?, ?, 0, ?, 'dead', 'llm down')`, personaID, chID, id(msg))
+	if err != nil {
+		t.Fatalf("seed job: %v", err)
+	}
+	jobID, _ := res.LastInsertId()
+	call("POST", fmt.Sprintf("/api/jobs/%d/retry", jobID), "")
+	call("POST", fmt.Sprintf("/api/agents/%d/channels/%d/reset-context", personaID, chID), "")
+
+	rec = doJSON(t, router, "GET", "/api/archives", "", auth...)
+	var archives []map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &archives)
+	if len(archives) != 1 {
+		t.Fatalf("archives = %s", rec.Body.String())
+	}
+	call("POST", fmt.Sprintf("/api/archives/%d/restore", id(archives[0])), "")
+
+	definition := `{"triggers": {"webhook": true}, "channel": "general",
+		"stages": [{"name": "review", "persona": "bot", "prompt": "Review {{.Input}}"}]}`
+	wf := call("POST", "/api/workflows", `{"name": "review", "definition": `+definition+`}`)
+	workflow := fmt.Sprintf("/api/workflows/%d", id(wf))
+	call("PUT", workflow, `{"name": "review", "description": "reviews things", "definition": `+definition+`}`)
+	run := call("POST", workflow+"/runs", `{"input":"the plan"}`)
+	call("POST", fmt.Sprintf("/api/workflow-runs/%d/cancel", id(run)), "")
+	call("POST", workflow+"/webhook", "the spec", "X-Webhook-Token", wf["webhook_token"].(string))
+	call("DELETE", workflow, "")
+
+	actor := fmt.Sprintf("/api/agents/%d", personaID)
+	call("POST", "/api/agents/start", "")
+	call("POST", ch+"/messages", `{"content":"are you there?"}`)
+	// Poll the supervisor rather than the API, which is rate limited.
+	var running []agent.RunInfo
+	for deadline := time.Now().Add(2 * time.Second); len(running) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		running = sup.Runs.List(personaID)
+	}
+	if len(running) == 0 {
+		t.Fatal("no run in progress")
+	}
+	call("POST", fmt.Sprintf("%s/runs/%s/cancel", actor, running[0].ID), "")
+	call("POST", actor+"/stop", "")
+	call("POST", actor+"/start", "")
+	call("POST", actor+"/restart", "")
+	call("POST", "/api/agents/stop", "")
+
+	call("POST", "/api/auth/logout", "", "Authorization", "Bearer "+login["token"].(string))
+
+	// Read markers and WebSocket tickets are not audited.
+	skip := []string{"POST /api/channels/{id}/read", "POST /api/ws/ticket"}
+	chi.Walk(router.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		action := method + " " + route
+		switch method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return nil
+		}
+		if slices.Contains(skip, action) {
+			return nil
+		}
+		events, err := model.ListAuditEvents(d, model.AuditFilter{Action: action, Limit: 1})
+		switch {
+		case err != nil:
+			t.Errorf("%s: list audit events: %v", action, err)
+		case len(events) == 0:
+			t.Errorf("%s: no audit event", action)
+		case events[0].Before == "" && events[0].After == "":
+			t.Errorf("%s: audit event has neither before nor after: %+v", action, events[0])
+		}
+		return nil
+	})
+}
+
+func TestAuditPersonaImportReplace(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	createPersona(t, router, token, "bot", "be helpful")
+	rec := doJSON(t, router, "POST", "/api/personas/import?on_conflict=replace",
+		`{"format":1,"name":"bot","system_prompt":"be brief"}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import replace: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "GET", "/api/audit?target=personas/*", "", auth...)
+	var events []auditEvent
+	json.Unmarshal(rec.Body.Bytes(), &events)
+	if len(events) != 2 {
+		t.Fatalf("got %d persona events, want 2: %s", len(events), rec.Body.String())
+	}
+	replaced := events[0]
+	if replaced.Action != "POST /api/personas/import" || replaced.Before["system_prompt"] != "be helpful" ||
+		replaced.After["system_prompt"] != "be brief" {
+		t.Errorf("replace event = %+v", replaced)
+	}
+}
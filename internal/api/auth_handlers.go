@@ -3,6 +3,7 @@ package api
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -48,6 +49,12 @@ func toUserJSON(u model.User) userJSON {
 	}
 }
 
+// sessionAudit is a new session as the audit log records it, without its
+// token.
+func sessionAudit(u model.User, expires time.Time) map[string]any {
+	return map[string]any{"user_id": u.ID, "expires_at": expires.Format(time.RFC3339)}
+}
+
 // Register creates a new user account.
 // If there are 0 users, registration is open (bootstrap).
 // Otherwise, a valid invite code is required.
@@ -131,6 +138,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	auth.SetSessionCookie(w, token, expires, auth.IsProduction(r))
 
+	auditChange(r, "users/"+strconv.FormatInt(user.ID, 10), nil, toUserJSON(user))
 	WriteJSON(w, http.StatusCreated, authResponse{
 		Token: token,
 		User:  toUserJSON(user),
@@ -172,6 +180,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	auth.SetSessionCookie(w, token, expires, auth.IsProduction(r))
 
+	auditChange(r, "users/"+strconv.FormatInt(user.ID, 10), nil, sessionAudit(user, expires))
 	WriteJSON(w, http.StatusOK, authResponse{
 		Token: token,
 		User:  toUserJSON(user),
@@ -195,6 +204,9 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 
 	if token != "" {
 		model.DeleteSession(h.DB, token)
+		if u := GetUser(r); u != nil {
+			auditChange(r, "users/"+strconv.FormatInt(u.ID, 10), map[string]int64{"user_id": u.ID}, nil)
+		}
 	}
 
 	auth.ClearSessionCookie(w)
@@ -29,7 +29,7 @@ func newTestRouter(t *testing.T, d *db.DB) http.Handler {
 	hub := ws.NewHub()
 	go hub.Run()
 	t.Cleanup(func() { hub.Stop() })
-	return api.NewRouter(d, []string{"*"}, hub)
+	return api.NewRouter(d, []string{"*"}, "", hub)
 }
 
 func doJSON(t *testing.T, router http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
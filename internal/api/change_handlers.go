@@ -0,0 +1,268 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// ChangeHandler serves the journal of agent file modifications and reverts
+// entries from it.
+type ChangeHandler struct {
+	DB *db.DB
+}
+
+type fileChangeJSON struct {
+	ID          int64   `json:"id"`
+	PersonaID   int64   `json:"persona_id"`
+	PersonaName string  `json:"persona_name"`
+	ChannelID   int64   `json:"channel_id"`
+	RunID       string  `json:"run_id"`
+	Path        string  `json:"path"`
+	Existed     bool    `json:"existed"`
+	Removed     bool    `json:"removed"`
+	Diff        string  `json:"diff"`
+	CreatedAt   string  `json:"created_at"`
+	RevertedAt  *string `json:"reverted_at"`
+}
+
+type revertResponse struct {
+	Reverted []int64  `json:"reverted"`
+	Files    []string `json:"files"`
+}
+
+func toFileChangeJSON(c model.FileChange) fileChangeJSON {
+	out := fileChangeJSON{
+		ID:          c.ID,
+		PersonaID:   c.PersonaID,
+		PersonaName: c.PersonaName,
+		ChannelID:   c.ChannelID,
+		RunID:       c.RunID,
+		Path:        c.Path,
+		Existed:     c.Existed,
+		Removed:     c.Removed,
+		Diff:        c.Diff(),
+		CreatedAt:   c.CreatedAt.Format(time.RFC3339),
+	}
+	if c.RevertedAt != nil {
+		s := c.RevertedAt.Format(time.RFC3339)
+		out.RevertedAt = &s
+	}
+	return out
+}
+
+// ListChanges handles GET /api/projects/{id}/changes. Results can be filtered
+// by persona_id, run_id and path.
+func (h *ChangeHandler) ListChanges(w http.ResponseWriter, r *http.Request) {
+	project, ok := lookupProject(h.DB, w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var filter model.FileChangeFilter
+	if v := q.Get("persona_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "invalid persona_id")
+			return
+		}
+		filter.PersonaID = id
+	}
+	filter.RunID = q.Get("run_id")
+	filter.Path = q.Get("path")
+	filter.Limit, filter.Offset = parsePagination(r, 50, 200)
+
+	changes, err := model.ListFileChanges(h.DB, project.ID, filter)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]fileChangeJSON, len(changes))
+	for i, c := range changes {
+		out[i] = toFileChangeJSON(c)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// RevertChange handles POST /api/projects/{id}/changes/{change_id}/revert.
+func (h *ChangeHandler) RevertChange(w http.ResponseWriter, r *http.Request) {
+	project, ok := lookupProject(h.DB, w, r)
+	if !ok {
+		return
+	}
+	changeID, ok := ParseIntParam(w, r, "change_id")
+	if !ok {
+		return
+	}
+
+	c, err := model.GetFileChange(h.DB, changeID)
+	if err != nil || c.ProjectID != project.ID {
+		if err == nil || err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "change not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if c.RevertedAt != nil {
+		ErrorResponse(w, http.StatusConflict, "change already reverted")
+		return
+	}
+
+	h.revert(w, r, []model.FileChange{c})
+}
+
+// RevertRun handles POST /api/projects/{id}/runs/{run_id}/revert, undoing
+// every unreverted change one agent run made to the project.
+func (h *ChangeHandler) RevertRun(w http.ResponseWriter, r *http.Request) {
+	project, ok := lookupProject(h.DB, w, r)
+	if !ok {
+		return
+	}
+	runID := chi.URLParam(r, "run_id")
+
+	changes, err := model.ListRunFileChanges(h.DB, project.ID, runID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if len(changes) == 0 {
+		ErrorResponse(w, http.StatusNotFound, "run has no changes in this project")
+		return
+	}
+
+	var pending []model.FileChange
+	for _, c := range changes {
+		if c.RevertedAt == nil {
+			pending = append(pending, c)
+		}
+	}
+	if len(pending) == 0 {
+		ErrorResponse(w, http.StatusConflict, "run already reverted")
+		return
+	}
+
+	h.revert(w, r, pending)
+}
+
+// revert restores the files touched by changes (oldest first) to their
+// state before the earliest change. Each file must still hold the content
+// written by its latest change, or still be gone if that change removed it;
+// otherwise the revert is refused with the
+// conflicting paths and nothing is modified. The changes are marked
+// reverted before any file is written, so two concurrent reverts can't both
+// write; if a write fails, the files already written are put back and the
+// mark is cleared. The audit log gets each file's content before and after,
+// by path.
+func (h *ChangeHandler) revert(w http.ResponseWriter, r *http.Request, changes []model.FileChange) {
+	type target struct {
+		abs, path   string
+		first, last model.FileChange
+	}
+	var order []*target
+	targets := make(map[string]*target)
+	for _, c := range changes {
+		abs, err := projectFilePath(c.RootDir, c.Path)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if t, ok := targets[abs]; ok {
+			t.last = c
+			continue
+		}
+		targets[abs] = &target{abs: abs, path: c.Path, first: c, last: c}
+		order = append(order, targets[abs])
+	}
+
+	var conflicts []string
+	for _, t := range order {
+		current, err := os.ReadFile(t.abs)
+		if err != nil && !os.IsNotExist(err) {
+			ErrorResponse(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if t.last.Removed {
+			if err == nil {
+				conflicts = append(conflicts, t.path)
+			}
+			continue
+		}
+		if err != nil || string(current) != t.last.AfterContent {
+			conflicts = append(conflicts, t.path)
+		}
+	}
+	if len(conflicts) > 0 {
+		WriteJSON(w, http.StatusConflict, map[string]any{
+			"error":     "files changed since the agent wrote them",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	resp := revertResponse{Reverted: []int64{}, Files: []string{}}
+	for _, c := range changes {
+		resp.Reverted = append(resp.Reverted, c.ID)
+	}
+	if err := model.MarkFileChangesReverted(h.DB, resp.Reverted); err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusConflict, "change already reverted")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	before, after := map[string]string{}, map[string]string{}
+	for i, t := range order {
+		var err error
+		if t.first.Existed {
+			err = writeProjectFile(t.abs, t.first.BeforeContent)
+			after[t.path] = t.first.BeforeContent
+		} else if err = os.Remove(t.abs); t.last.Removed && os.IsNotExist(err) {
+			// Created and then removed by the agent: already gone.
+			err = nil
+		}
+		if err != nil {
+			msg := err.Error() + "; no files were changed"
+			var errs []error
+			for _, done := range order[:i] {
+				var werr error
+				if done.last.Removed {
+					werr = os.Remove(done.abs)
+				} else {
+					werr = writeProjectFile(done.abs, done.last.AfterContent)
+				}
+				if werr != nil && !os.IsNotExist(werr) {
+					errs = append(errs, werr)
+				}
+			}
+			if rerr := errors.Join(errs...); rerr != nil {
+				msg = fmt.Sprintf("%s; rolling back failed, so some files were changed: %v", err, rerr)
+			} else if uerr := model.UnmarkFileChangesReverted(h.DB, resp.Reverted); uerr != nil {
+				slog.Error("changes: clear reverted mark", "error", uerr)
+			}
+			ErrorResponse(w, http.StatusInternalServerError, msg)
+			return
+		}
+		if !t.last.Removed {
+			before[t.path] = t.last.AfterContent
+		}
+		resp.Files = append(resp.Files, t.path)
+	}
+
+	auditChange(r, "", before, after)
+	WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,198 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// seedRunChanges records a run that edited a.txt twice and created b.txt, and
+// leaves the files on disk as the agent wrote them.
+func seedRunChanges(t *testing.T, d *db.DB, personaID int64) (dir string, projectID int64) {
+	t.Helper()
+	dir = t.TempDir()
+	proj, err := model.CreateProject(d, "journal", dir, "")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	entries := []model.FileChange{
+		{Path: "a.txt", Existed: true, BeforeContent: "v1\n", AfterContent: "v2\n"},
+		{Path: "a.txt", Existed: true, BeforeContent: "v2\n", AfterContent: "v3\n"},
+		{Path: "b.txt", Existed: false, AfterContent: "new\n"},
+	}
+	for _, e := range entries {
+		e.ProjectID, e.PersonaID, e.RunID, e.RootDir = proj.ID, personaID, "run1", dir
+		if _, err := model.RecordFileChange(d, e); err != nil {
+			t.Fatalf("record change: %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("v3\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("new\n"), 0o644)
+	return dir, proj.ID
+}
+
+func TestListChanges(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+	_, projectID := seedRunChanges(t, d, personaID)
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/projects/%d/changes?path=a.txt", projectID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var changes []struct {
+		Path        string `json:"path"`
+		PersonaName string `json:"persona_name"`
+		RunID       string `json:"run_id"`
+		Diff        string `json:"diff"`
+	}
+	json.NewDecoder(rec.Body).Decode(&changes)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	if changes[0].PersonaName != "Coder" || changes[0].RunID != "run1" || !strings.Contains(changes[0].Diff, "+v3") {
+		t.Errorf("unexpected newest change: %+v", changes[0])
+	}
+}
+
+func TestRevertRun(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+	dir, projectID := seedRunChanges(t, d, personaID)
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/runs/run1/revert", projectID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revert status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(data) != "v1\n" {
+		t.Errorf("a.txt = %q, want v1", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Error("expected created file to be removed")
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/runs/run1/revert", projectID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second revert status = %d, want 409", rec.Code)
+	}
+}
+
+func TestRevertChangeConflict(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+	dir, projectID := seedRunChanges(t, d, personaID)
+
+	changes, _ := model.ListFileChanges(d, projectID, model.FileChangeFilter{Path: "a.txt"})
+	older, newer := changes[1], changes[0]
+
+	// The older edit was overwritten by the newer one, so reverting it alone conflicts.
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/changes/%d/revert", projectID, older.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "a.txt") {
+		t.Fatalf("revert older status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/changes/%d/revert", projectID, newer.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revert newer status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(data) != "v2\n" {
+		t.Errorf("a.txt = %q, want v2", data)
+	}
+
+	// Once the newer edit is undone the older one can be reverted too.
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/changes/%d/revert", projectID, older.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revert older status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(data) != "v1\n" {
+		t.Errorf("a.txt = %q, want v1", data)
+	}
+}
+
+func TestRevertRollsBackOnWriteFailure(t *testing.T) {
+	// Writing to /proc/version fails with EIO, even as root.
+	procVersion, err := os.ReadFile("/proc/version")
+	if err != nil {
+		t.Skip("needs /proc/version")
+	}
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+	dir, projectID := seedRunChanges(t, d, personaID)
+
+	// The run also "wrote" version.txt, which can't be written back, after a.txt.
+	os.Symlink("/proc/version", filepath.Join(dir, "version.txt"))
+	model.RecordFileChange(d, model.FileChange{
+		ProjectID: projectID, PersonaID: personaID, RunID: "run1", RootDir: dir,
+		Path: "version.txt", Existed: true, BeforeContent: "old\n", AfterContent: string(procVersion),
+	})
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/runs/run1/revert", projectID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "no files were changed") {
+		t.Fatalf("revert = %d %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "v3\n" {
+		t.Errorf("a.txt = %q, want it put back to v3", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "b.txt")); string(data) != "new\n" {
+		t.Errorf("b.txt = %q, want it left in place", data)
+	}
+	changes, _ := model.ListRunFileChanges(d, projectID, "run1")
+	for _, c := range changes {
+		if c.RevertedAt != nil {
+			t.Errorf("change %d to %s marked reverted after a failed revert", c.ID, c.Path)
+		}
+	}
+}
+
+func TestRevertRemovedFile(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+	dir := t.TempDir()
+	proj, _ := model.CreateProject(d, "journal", dir, "")
+	model.RecordFileChange(d, model.FileChange{
+		ProjectID: proj.ID, PersonaID: personaID, RunID: "run1", RootDir: dir,
+		Path: "memories/notes.md", Existed: true, Removed: true, BeforeContent: "keep me\n",
+	})
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/projects/%d/changes", proj.ID), "", "Authorization", "Bearer "+token)
+	if !strings.Contains(rec.Body.String(), `"removed":true`) || !strings.Contains(rec.Body.String(), "+++ /dev/null") {
+		t.Errorf("list = %s", rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/runs/run1/revert", proj.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revert status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "memories", "notes.md")); string(data) != "keep me\n" {
+		t.Errorf("notes.md = %q, want it restored", data)
+	}
+}
@@ -0,0 +1,480 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/diff"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// ChangesetHandler handles review of file changes staged by agents.
+type ChangesetHandler struct {
+	DB  *db.DB
+	Hub *ws.Hub
+}
+
+type changesetHunkJSON struct {
+	Index  int    `json:"index"`
+	Header string `json:"header"`
+	Text   string `json:"text"`
+}
+
+type changesetFileJSON struct {
+	ID      int64               `json:"id"`
+	Path    string              `json:"path"`
+	Existed bool                `json:"existed"`
+	Status  string              `json:"status"`
+	Diff    string              `json:"diff"`
+	Hunks   []changesetHunkJSON `json:"hunks"`
+}
+
+type changesetJSON struct {
+	ID         int64               `json:"id"`
+	PersonaID  int64               `json:"persona_id"`
+	ChannelID  int64               `json:"channel_id"`
+	Status     string              `json:"status"`
+	CreatedAt  string              `json:"created_at"`
+	ResolvedAt *string             `json:"resolved_at"`
+	Files      []changesetFileJSON `json:"files,omitempty"`
+}
+
+// applyChangesetRequest selects what to apply. When Files is omitted every
+// hunk of every file is applied. Otherwise unlisted files are rejected, and a
+// listed file without Hunks is applied in full.
+type applyChangesetRequest struct {
+	Files []applyFileRequest `json:"files"`
+}
+
+type applyFileRequest struct {
+	Path  string `json:"path"`
+	Hunks []int  `json:"hunks"`
+}
+
+func fileHunks(f model.ChangesetFile) []diff.Hunk {
+	return diff.Hunks(diff.Lines(diff.SplitLines(f.BaseContent), diff.SplitLines(f.NewContent)), diff.DefaultContext)
+}
+
+func toChangesetJSON(c model.Changeset) changesetJSON {
+	out := changesetJSON{
+		ID:        c.ID,
+		PersonaID: c.PersonaID,
+		ChannelID: c.ChannelID,
+		Status:    c.Status,
+		CreatedAt: c.CreatedAt.Format(time.RFC3339),
+	}
+	if c.ResolvedAt != nil {
+		s := c.ResolvedAt.Format(time.RFC3339)
+		out.ResolvedAt = &s
+	}
+	for _, f := range c.Files {
+		fj := changesetFileJSON{
+			ID:      f.ID,
+			Path:    f.Path,
+			Existed: f.Existed,
+			Status:  f.Status,
+			Diff:    f.Diff(),
+			Hunks:   []changesetHunkJSON{},
+		}
+		for i, h := range fileHunks(f) {
+			fj.Hunks = append(fj.Hunks, changesetHunkJSON{Index: i, Header: h.Header(), Text: h.String()})
+		}
+		out.Files = append(out.Files, fj)
+	}
+	return out
+}
+
+// toChangesetAuditJSON is the changeset as the audit log records it: its
+// status and each file's, without the diffs.
+func toChangesetAuditJSON(c model.Changeset) map[string]any {
+	files := make(map[string]string, len(c.Files))
+	for _, f := range c.Files {
+		files[f.Path] = f.Status
+	}
+	return map[string]any{"id": c.ID, "status": c.Status, "files": files}
+}
+
+// lookupChangeset checks channel membership and loads the changeset named in
+// the URL, which must belong to that channel.
+func (h *ChangesetHandler) lookupChangeset(w http.ResponseWriter, r *http.Request) (model.Changeset, bool) {
+	channelID, ok := (&ChannelHandler{DB: h.DB}).requireChannelMember(w, r)
+	if !ok {
+		return model.Changeset{}, false
+	}
+	id, ok := ParseIntParam(w, r, "changesetID")
+	if !ok {
+		return model.Changeset{}, false
+	}
+	c, err := model.GetChangeset(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "changeset not found")
+			return model.Changeset{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Changeset{}, false
+	}
+	if c.ChannelID != channelID {
+		ErrorResponse(w, http.StatusNotFound, "changeset not found in this channel")
+		return model.Changeset{}, false
+	}
+	return c, true
+}
+
+// ListChangesets handles GET /api/channels/{id}/changesets.
+func (h *ChangesetHandler) ListChangesets(w http.ResponseWriter, r *http.Request) {
+	channelID, ok := (&ChannelHandler{DB: h.DB}).requireChannelMember(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", model.ChangesetPending, model.ChangesetApplying, model.ChangesetApplied, model.ChangesetPartial, model.ChangesetRejected:
+	default:
+		ErrorResponse(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	changesets, err := model.ListChangesets(h.DB, channelID, status)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]changesetJSON, len(changesets))
+	for i, c := range changesets {
+		out[i] = toChangesetJSON(c)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetChangeset handles GET /api/channels/{id}/changesets/{changesetID}.
+func (h *ChangesetHandler) GetChangeset(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.lookupChangeset(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, toChangesetJSON(c))
+}
+
+// plannedWrite is a file write computed while applying a changeset.
+type plannedWrite struct {
+	file    model.ChangesetFile
+	path    string
+	content string
+}
+
+// ApplyChangeset handles POST /api/channels/{id}/changesets/{changesetID}/apply.
+// The changeset is claimed before anything is written and goes back to
+// pending if the apply fails. Files whose content on disk changed since the
+// changeset was proposed are reported as conflicts and nothing is written.
+// If a write fails, the files already written are put back. The writes are
+// recorded in the project's file change journal under the run
+// "changeset-{id}", so they can be reverted together.
+func (h *ChangesetHandler) ApplyChangeset(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.lookupChangeset(w, r)
+	if !ok {
+		return
+	}
+	if c.Status != model.ChangesetPending {
+		changesetNotPending(w, c.Status)
+		return
+	}
+
+	var req applyChangesetRequest
+	if r.ContentLength > 0 {
+		if err := ReadJSON(r, &req); err != nil {
+			ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// selection maps path -> selected hunk indexes; nil means all hunks.
+	var selection map[string][]int
+	if req.Files != nil {
+		selection = make(map[string][]int, len(req.Files))
+		known := make(map[string]bool, len(c.Files))
+		for _, f := range c.Files {
+			known[f.Path] = true
+		}
+		for _, f := range req.Files {
+			if !known[f.Path] {
+				ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("file %q is not in this changeset", f.Path))
+				return
+			}
+			selection[f.Path] = f.Hunks
+		}
+	}
+
+	if !h.claim(w, c.ID) {
+		return
+	}
+	defer h.release(c.ID)
+
+	var writes []plannedWrite
+	var conflicts []string
+	fileStatus := make(map[int64]string, len(c.Files))
+	applied, rejected := 0, 0
+	for _, f := range c.Files {
+		hunks, listed := selection[f.Path]
+		if selection != nil && !listed {
+			fileStatus[f.ID] = model.ChangesetRejected
+			rejected++
+			continue
+		}
+
+		total := len(fileHunks(f))
+		keep := make(map[int]bool, total)
+		if hunks == nil {
+			for i := range total {
+				keep[i] = true
+			}
+		}
+		for _, i := range hunks {
+			if i < 0 || i >= total {
+				ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("file %q has no hunk %d", f.Path, i))
+				return
+			}
+			keep[i] = true
+		}
+		if len(keep) == 0 && total > 0 {
+			fileStatus[f.ID] = model.ChangesetRejected
+			rejected++
+			continue
+		}
+
+		abs, err := projectFilePath(c.ProjectDir, f.Path)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		current, err := os.ReadFile(abs)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			ErrorResponse(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if exists != f.Existed || string(current) != f.BaseContent {
+			conflicts = append(conflicts, f.Path)
+			continue
+		}
+
+		writes = append(writes, plannedWrite{
+			file:    f,
+			path:    abs,
+			content: diff.Apply(f.BaseContent, f.NewContent, func(i int) bool { return keep[i] }),
+		})
+		if len(keep) == total {
+			fileStatus[f.ID] = model.ChangesetApplied
+			applied++
+		} else {
+			fileStatus[f.ID] = model.ChangesetPartial
+		}
+	}
+
+	if len(conflicts) > 0 {
+		WriteJSON(w, http.StatusConflict, map[string]any{
+			"error":     "files changed since the changeset was proposed",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	for i, pw := range writes {
+		if err := writeProjectFile(pw.path, pw.content); err != nil {
+			msg := err.Error() + "; no files were changed"
+			if rerr := undoWrites(writes[:i]); rerr != nil {
+				msg = fmt.Sprintf("%s; rolling back failed, so some files were changed: %v", err, rerr)
+			}
+			ErrorResponse(w, http.StatusInternalServerError, msg)
+			return
+		}
+	}
+	h.journal(c, writes)
+
+	status := model.ChangesetPartial
+	switch {
+	case applied == len(c.Files):
+		status = model.ChangesetApplied
+	case rejected == len(c.Files):
+		status = model.ChangesetRejected
+	}
+	h.resolve(w, r, c, status, fileStatus)
+}
+
+// RejectChangeset handles POST /api/channels/{id}/changesets/{changesetID}/reject.
+func (h *ChangesetHandler) RejectChangeset(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.lookupChangeset(w, r)
+	if !ok {
+		return
+	}
+	if c.Status != model.ChangesetPending {
+		changesetNotPending(w, c.Status)
+		return
+	}
+
+	if !h.claim(w, c.ID) {
+		return
+	}
+	defer h.release(c.ID)
+
+	fileStatus := make(map[int64]string, len(c.Files))
+	for _, f := range c.Files {
+		fileStatus[f.ID] = model.ChangesetRejected
+	}
+	h.resolve(w, r, c, model.ChangesetRejected, fileStatus)
+}
+
+func changesetNotPending(w http.ResponseWriter, status string) {
+	if status == model.ChangesetApplying {
+		ErrorResponse(w, http.StatusConflict, "changeset is being applied")
+		return
+	}
+	ErrorResponse(w, http.StatusConflict, "changeset already "+status)
+}
+
+// claim moves the changeset to applying before a review touches it, so two
+// concurrent reviews can't both write its files. The loser gets 409.
+func (h *ChangesetHandler) claim(w http.ResponseWriter, id int64) bool {
+	if err := model.ClaimChangeset(h.DB, id); err != nil {
+		if err == sql.ErrNoRows {
+			c, err := model.GetChangeset(h.DB, id)
+			if err != nil {
+				ErrorResponse(w, http.StatusInternalServerError, "internal error")
+				return false
+			}
+			changesetNotPending(w, c.Status)
+			return false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return false
+	}
+	return true
+}
+
+// release puts a claimed changeset back to pending if the review failed
+// before resolving it.
+func (h *ChangesetHandler) release(id int64) {
+	if err := model.ReleaseChangeset(h.DB, id); err != nil && err != sql.ErrNoRows {
+		slog.Error("changesets: release claim", "changeset_id", id, "error", err)
+	}
+}
+
+// resolve records a review outcome, broadcasts changeset_updated and writes
+// the updated changeset.
+func (h *ChangesetHandler) resolve(w http.ResponseWriter, r *http.Request, c model.Changeset, status string, fileStatus map[int64]string) {
+	if err := model.ResolveChangeset(h.DB, c.ID, status, fileStatus); err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusConflict, "changeset already resolved")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	updated, err := model.GetChangeset(h.DB, c.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := toChangesetJSON(updated)
+	auditChange(r, "", toChangesetAuditJSON(c), toChangesetAuditJSON(updated))
+
+	if h.Hub != nil {
+		files := make([]map[string]any, len(updated.Files))
+		for i, f := range updated.Files {
+			files[i] = map[string]any{"id": f.ID, "path": f.Path, "status": f.Status}
+		}
+		h.Hub.Broadcast(ws.Event{
+			Type: "changeset_updated",
+			Data: map[string]any{
+				"id":         updated.ID,
+				"channel_id": updated.ChannelID,
+				"status":     updated.Status,
+				"files":      files,
+			},
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// undoWrites puts back the files a failed apply already wrote, returning
+// the errors from any it could not.
+func undoWrites(writes []plannedWrite) error {
+	var errs []error
+	for i := len(writes) - 1; i >= 0; i-- {
+		pw := writes[i]
+		var err error
+		if pw.file.Existed {
+			err = writeProjectFile(pw.path, pw.file.BaseContent)
+		} else {
+			err = os.Remove(pw.path)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// journal records an applied changeset's writes as file changes by the
+// persona that proposed it.
+func (h *ChangesetHandler) journal(c model.Changeset, writes []plannedWrite) {
+	if c.ProjectID == 0 {
+		return
+	}
+	for _, pw := range writes {
+		_, err := model.RecordFileChange(h.DB, model.FileChange{
+			ProjectID:     c.ProjectID,
+			PersonaID:     c.PersonaID,
+			ChannelID:     c.ChannelID,
+			RunID:         fmt.Sprintf("changeset-%d", c.ID),
+			RootDir:       c.ProjectDir,
+			Path:          pw.file.Path,
+			Existed:       pw.file.Existed,
+			BeforeContent: pw.file.BaseContent,
+			AfterContent:  pw.content,
+		})
+		if err != nil {
+			slog.Error("changesets: record file change", "changeset_id", c.ID, "path", pw.file.Path, "error", err)
+		}
+	}
+}
+
+// projectFilePath resolves a slash-separated path under the project directory,
+// rejecting paths that escape it.
+func projectFilePath(projectDir, path string) (string, error) {
+	abs := filepath.Join(projectDir, filepath.FromSlash(path))
+	rel, err := filepath.Rel(filepath.Clean(projectDir), abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path escapes project: %q", path)
+	}
+	return abs, nil
+}
+
+// writeProjectFile writes content to path, creating parent directories and
+// keeping the permissions of an existing file.
+func writeProjectFile(path, content string) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
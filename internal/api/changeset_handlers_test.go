@@ -0,0 +1,244 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// seedChangeset creates a project dir containing base.txt and a pending
+// changeset that edits it and adds sub/new.txt.
+func seedChangeset(t *testing.T, d *db.DB, router http.Handler, token string) (dir string, channelID int64, cs model.Changeset) {
+	t.Helper()
+	dir = t.TempDir()
+
+	var base, edited strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&base, "line %d\n", i)
+		switch i {
+		case 2:
+			edited.WriteString("early edit\n")
+		case 25:
+			edited.WriteString("late edit\n")
+		default:
+			fmt.Fprintf(&edited, "line %d\n", i)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "base.txt"), []byte(base.String()), 0o644)
+
+	channelID = createChannel(t, router, token, "dev", "")
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+	projectID := createProject(t, router, token, "proj", dir, "")
+	cs, err := model.CreateChangeset(d, personaID, channelID, projectID, dir, []model.ChangesetFile{
+		{Path: "base.txt", Existed: true, BaseContent: base.String(), NewContent: edited.String()},
+		{Path: "sub/new.txt", NewContent: "brand new\n"},
+	})
+	if err != nil {
+		t.Fatalf("create changeset: %v", err)
+	}
+	return dir, channelID, cs
+}
+
+func TestChangesetGetAndApplyAll(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	dir, channelID, cs := seedChangeset(t, d, router, token)
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/channels/%d/changesets/%d", channelID, cs.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Status string `json:"status"`
+		Files  []struct {
+			Path  string `json:"path"`
+			Diff  string `json:"diff"`
+			Hunks []struct {
+				Index int `json:"index"`
+			} `json:"hunks"`
+		} `json:"files"`
+	}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.Status != "pending" || len(got.Files) != 2 {
+		t.Fatalf("unexpected changeset: %+v", got)
+	}
+	if len(got.Files[0].Hunks) != 2 || !strings.Contains(got.Files[0].Diff, "+early edit") {
+		t.Fatalf("unexpected file diff: %+v", got.Files[0])
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/changesets/%d/apply", channelID, cs.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "base.txt"))
+	if string(data) != cs.Files[0].NewContent {
+		t.Errorf("base.txt not fully applied:\n%s", data)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "sub", "new.txt"))
+	if string(data) != "brand new\n" {
+		t.Errorf("new.txt = %q", data)
+	}
+
+	// The writes are journaled as one run, so they can be reverted together.
+	changes, _ := model.ListFileChanges(d, cs.ProjectID, model.FileChangeFilter{RunID: fmt.Sprintf("changeset-%d", cs.ID)})
+	if len(changes) != 2 || changes[0].PersonaID != cs.PersonaID || changes[1].AfterContent != cs.Files[0].NewContent {
+		t.Errorf("journaled changes = %+v", changes)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/changesets/%d/reject", channelID, cs.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("reject after apply status = %d, want 409", rec.Code)
+	}
+}
+
+func TestChangesetPartialApply(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	dir, channelID, cs := seedChangeset(t, d, router, token)
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/changesets/%d/apply", channelID, cs.ID),
+		`{"files":[{"path":"base.txt","hunks":[1]}]}`, "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Status string `json:"status"`
+		Files  []struct {
+			Status string `json:"status"`
+		} `json:"files"`
+	}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.Status != "partial" || got.Files[0].Status != "partial" || got.Files[1].Status != "rejected" {
+		t.Fatalf("unexpected statuses: %+v", got)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "base.txt"))
+	if strings.Contains(string(data), "early edit") || !strings.Contains(string(data), "late edit") {
+		t.Errorf("expected only the second hunk applied:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "new.txt")); !os.IsNotExist(err) {
+		t.Error("expected unselected new file not to be created")
+	}
+}
+
+func TestChangesetApplyConflict(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	dir, channelID, cs := seedChangeset(t, d, router, token)
+
+	os.WriteFile(filepath.Join(dir, "base.txt"), []byte("someone else changed this\n"), 0o644)
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/changesets/%d/apply", channelID, cs.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("apply status = %d, want 409, body: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "base.txt") {
+		t.Errorf("expected conflict to name base.txt: %s", rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "new.txt")); !os.IsNotExist(err) {
+		t.Error("expected no files written when there is a conflict")
+	}
+
+	got, _ := model.GetChangeset(d, cs.ID)
+	if got.Status != model.ChangesetPending {
+		t.Errorf("status = %q, want pending", got.Status)
+	}
+}
+
+func TestChangesetApplyRollsBackOnWriteFailure(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	dir, channelID, cs := seedChangeset(t, d, router, token)
+
+	// A dangling symlink where sub/ should be makes writing sub/new.txt
+	// fail after base.txt was written.
+	os.Symlink("nowhere", filepath.Join(dir, "sub"))
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/changesets/%d/apply", channelID, cs.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "no files were changed") {
+		t.Fatalf("apply = %d %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "base.txt")); string(data) != cs.Files[0].BaseContent {
+		t.Errorf("base.txt not rolled back:\n%s", data)
+	}
+	if changes, _ := model.ListFileChanges(d, cs.ProjectID, model.FileChangeFilter{}); len(changes) != 0 {
+		t.Errorf("failed apply journaled %d changes", len(changes))
+	}
+	if got, _ := model.GetChangeset(d, cs.ID); got.Status != model.ChangesetPending {
+		t.Errorf("status = %q, want pending", got.Status)
+	}
+}
+
+func TestChangesetApplyWhileClaimed(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	dir, channelID, cs := seedChangeset(t, d, router, token)
+
+	// Another apply holds the changeset.
+	if err := model.ClaimChangeset(d, cs.ID); err != nil {
+		t.Fatalf("ClaimChangeset: %v", err)
+	}
+
+	for _, action := range []string{"apply", "reject"} {
+		rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/changesets/%d/%s", channelID, cs.ID, action), "",
+			"Authorization", "Bearer "+token)
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "being applied") {
+			t.Fatalf("%s = %d %s", action, rec.Code, rec.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "new.txt")); !os.IsNotExist(err) {
+		t.Error("expected no files written while another apply holds the changeset")
+	}
+	if changes, _ := model.ListFileChanges(d, cs.ProjectID, model.FileChangeFilter{}); len(changes) != 0 {
+		t.Errorf("losing apply journaled %d changes", len(changes))
+	}
+	if got, _ := model.GetChangeset(d, cs.ID); got.Status != model.ChangesetApplying {
+		t.Errorf("status = %q, want applying", got.Status)
+	}
+}
+
+func TestChangesetRejectAndList(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	dir, channelID, cs := seedChangeset(t, d, router, token)
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/changesets/%d/reject", channelID, cs.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reject status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "base.txt"))
+	if string(data) != cs.Files[0].BaseContent {
+		t.Error("reject modified the project")
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/channels/%d/changesets?status=pending", channelID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d", rec.Code)
+	}
+	var list []struct{}
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("expected no pending changesets, got %d", len(list))
+	}
+
+}
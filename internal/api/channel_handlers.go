@@ -19,6 +19,7 @@ type ChannelHandler struct {
 	DB         *db.DB
 	Hub        *ws.Hub
 	Supervisor *agent.Supervisor
+	Commands   *CommandRegistry
 }
 
 type createChannelRequest struct {
@@ -136,6 +137,7 @@ func (h *ChannelHandler) CreateChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditChange(r, "channels/"+strconv.FormatInt(ch.ID, 10), nil, toChannelJSON(ch))
 	WriteJSON(w, http.StatusCreated, toChannelJSON(ch))
 }
 
@@ -270,6 +272,10 @@ func (h *ChannelHandler) PostMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.runCommand(w, r, channelID, user, req.Content) {
+		return
+	}
+
 	msg, err := model.CreateMessage(h.DB, channelID, user.ID, "human", user.Username, req.Content)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
@@ -286,6 +292,7 @@ func (h *ChannelHandler) PostMessage(w http.ResponseWriter, r *http.Request) {
 	// Auto-subscribe mentioned personas that aren't already in this channel.
 	h.autoSubscribeMentionedPersonas(channelID, req.Content)
 
+	auditChange(r, "", nil, toMessageJSON(msg))
 	WriteJSON(w, http.StatusCreated, toMessageJSON(msg))
 }
 
@@ -359,3 +366,63 @@ func (h *ChannelHandler) autoSubscribeMentionedPersonas(channelID int64, content
 		}
 	}
 }
+
+// runCommand runs a "/<command> <args>" message as a slash command instead
+// of posting it. The answer goes to the caller only: in the response and
+// over the WebSocket. It reports whether it handled the message; other
+// messages, including unknown commands, are posted as usual. Commands that
+// change something record it in the audit log against r.
+func (h *ChannelHandler) runCommand(w http.ResponseWriter, r *http.Request, channelID int64, user *model.User, content string) bool {
+	if h.Commands == nil || !strings.HasPrefix(content, "/") {
+		return false
+	}
+	name, input, _ := strings.Cut(content[1:], " ")
+	cmd, ok, err := h.Commands.Lookup(name)
+	if err != nil {
+		slog.Error("channel: look up command", "command", name, "error", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	fail := func(err error) bool {
+		status, msg := commandErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			slog.Error("channel: run command", "command", cmd.Name, "channel_id", channelID, "error", err)
+		}
+		sendCommandResponse(h.Hub, user.ID, channelID, cmd.Name, msg, true)
+		ErrorResponse(w, status, msg)
+		return true
+	}
+
+	ch, err := model.GetChannel(h.DB, channelID)
+	if err != nil {
+		return fail(err)
+	}
+	if err := authorizeCommand(h.DB, cmd, ch, user); err != nil {
+		return fail(err)
+	}
+	args, err := parseCommandArgs(h.DB, cmd, input)
+	if err != nil {
+		return fail(err)
+	}
+	res, err := cmd.Run(&CommandInvocation{User: user, Channel: ch, args: args, r: r})
+	if err != nil {
+		return fail(err)
+	}
+
+	if res.Text != "" {
+		sendCommandResponse(h.Hub, user.ID, channelID, cmd.Name, res.Text, false)
+	}
+	status := res.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if res.Body != nil {
+		WriteJSON(w, status, res.Body)
+	} else {
+		WriteJSON(w, status, map[string]string{"command": cmd.Name, "response": res.Text})
+	}
+	return true
+}
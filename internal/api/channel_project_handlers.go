@@ -86,6 +86,7 @@ func (h *ChannelProjectHandler) AddChannelProject(w http.ResponseWriter, r *http
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, "", nil, req)
 
 	w.WriteHeader(http.StatusCreated)
 }
@@ -106,6 +107,7 @@ func (h *ChannelProjectHandler) RemoveChannelProject(w http.ResponseWriter, r *h
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, "", addChannelProjectRequest{ProjectID: projectID}, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,423 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// summarizeTimeout bounds a /summarize LLM call.
+const summarizeTimeout = 2 * time.Minute
+
+// builtinCommands implements the built-in slash commands.
+type builtinCommands struct {
+	DB         *db.DB
+	Hub        *ws.Hub
+	Supervisor *agent.Supervisor
+	Commands   *CommandRegistry
+}
+
+// NewCommands creates the command registry with the built-in commands, plus
+// the workflow commands if sup runs workflows. Commands that drive agents
+// are only available with a supervisor.
+func NewCommands(d *db.DB, hub *ws.Hub, sup *agent.Supervisor) *CommandRegistry {
+	reg := NewCommandRegistry()
+	b := &builtinCommands{DB: d, Hub: hub, Supervisor: sup, Commands: reg}
+	persona := CommandArg{Name: "persona", Kind: ArgPersona}
+	optPersona := CommandArg{Name: "persona", Kind: ArgPersona, Optional: true}
+
+	reg.Register(SlashCommand{
+		Name:        "help",
+		Description: "List the slash commands, or show how to use one.",
+		Args:        []CommandArg{{Name: "command", Kind: ArgWord, Optional: true}},
+		Run:         b.help,
+	})
+	reg.Register(SlashCommand{
+		Name:        "invite",
+		Description: "Add a persona to this channel.",
+		Args:        []CommandArg{persona},
+		Run:         b.invite,
+	})
+	reg.Register(SlashCommand{
+		Name:        "kick",
+		Description: "Remove a persona from this channel, stopping what it is doing here.",
+		Args:        []CommandArg{persona},
+		Permission:  PermOwner,
+		Run:         b.kick,
+	})
+	reg.Register(SlashCommand{
+		Name:        "model",
+		Description: `Show or set the model a persona uses in this channel; "default" clears the override.`,
+		Args:        []CommandArg{persona, {Name: "model", Kind: ArgWord, Optional: true}},
+		Permission:  PermOwner,
+		Run:         b.model,
+	})
+	reg.Register(SlashCommand{
+		Name:        "remind",
+		Description: "Remind yourself of something in this channel after a while.",
+		Args:        []CommandArg{{Name: "after", Kind: ArgDuration}, {Name: "text", Kind: ArgText}},
+		Run:         b.remind,
+	})
+	if sup == nil {
+		return reg
+	}
+
+	reg.Register(SlashCommand{
+		Name:        "reset",
+		Aliases:     []string{"reset-context"},
+		Description: "Make a persona, or every persona here, forget this channel's conversation so far.",
+		Args:        []CommandArg{optPersona},
+		Run:         b.reset,
+	})
+	reg.Register(SlashCommand{
+		Name:        "stop",
+		Description: "Cancel what a persona, or every persona, is doing in this channel.",
+		Args:        []CommandArg{optPersona},
+		Run:         b.stop,
+	})
+	reg.Register(SlashCommand{
+		Name:        "summarize",
+		Description: "Have a persona summarize this channel's recent conversation for you.",
+		Args:        []CommandArg{optPersona},
+		Run:         b.summarize,
+	})
+	if sup.Workflows != nil {
+		reg.Source = func() ([]*SlashCommand, error) { return workflowCommands(sup.Workflows) }
+	}
+	return reg
+}
+
+// workflowCommands returns a command for each workflow with a command
+// trigger. The command starts the workflow with the rest of the line as its
+// input and answers 202 with the run.
+func workflowCommands(wr *agent.WorkflowRunner) ([]*SlashCommand, error) {
+	workflows, err := wr.Commands()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*SlashCommand, 0, len(workflows))
+	for name, wf := range workflows {
+		desc := wf.Description
+		if desc == "" {
+			desc = "Start the " + wf.Name + " workflow."
+		}
+		out = append(out, &SlashCommand{
+			Name:        name,
+			Description: desc,
+			Args:        []CommandArg{{Name: "input", Kind: ArgText, Optional: true}},
+			Permission:  PermMember,
+			Source:      CommandSourceWorkflow,
+			Run: func(inv *CommandInvocation) (CommandResult, error) {
+				run, err := wr.Start(wf, model.TriggerCommand, inv.String("input"), inv.Channel.ID, inv.User.Username)
+				if err != nil {
+					return CommandResult{}, commandErrorf(http.StatusBadRequest, "%s", err.Error())
+				}
+				inv.audit(fmt.Sprintf("workflow-runs/%d", run.ID), nil, toWorkflowRunJSON(run))
+				return CommandResult{
+					Text:   fmt.Sprintf("Started workflow %s (run %d).", wf.Name, run.ID),
+					Status: http.StatusAccepted,
+					Body:   toWorkflowRunJSON(run),
+				}, nil
+			},
+		})
+	}
+	return out, nil
+}
+
+func (b *builtinCommands) help(inv *CommandInvocation) (CommandResult, error) {
+	if name := strings.TrimPrefix(inv.String("command"), "/"); name != "" {
+		cmd, ok, err := b.Commands.Lookup(name)
+		if err != nil {
+			return CommandResult{}, err
+		}
+		if !ok {
+			return CommandResult{}, commandErrorf(http.StatusNotFound, "unknown command /%s", name)
+		}
+		text := cmd.Usage() + "\n" + cmd.Description
+		if len(cmd.Aliases) > 0 {
+			text += "\nAlso: /" + strings.Join(cmd.Aliases, ", /")
+		}
+		return CommandResult{Text: text}, nil
+	}
+
+	cmds, err := b.Commands.List()
+	if err != nil {
+		return CommandResult{}, err
+	}
+	lines := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		lines[i] = cmd.Usage() + " — " + cmd.Description
+	}
+	return CommandResult{Text: strings.Join(lines, "\n")}, nil
+}
+
+// channelPersonas returns the persona argument if given, otherwise every
+// persona in the channel.
+func (b *builtinCommands) channelPersonas(inv *CommandInvocation) ([]model.Persona, error) {
+	if p, ok := inv.Persona("persona"); ok {
+		return []model.Persona{p}, nil
+	}
+	members, err := model.GetChannelPersonas(b.DB, inv.Channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, commandErrorf(http.StatusBadRequest, "there are no personas in this channel")
+	}
+	out := make([]model.Persona, 0, len(members))
+	for _, m := range members {
+		p, err := model.GetPersona(b.DB, m.PersonaID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// membersTarget is the audit target for a channel's membership, as changed
+// by the members endpoints.
+func membersTarget(channelID int64) string {
+	return fmt.Sprintf("channels/%d/members", channelID)
+}
+
+func (b *builtinCommands) inChannel(personaID, channelID int64) (bool, error) {
+	members, err := model.GetChannelPersonas(b.DB, channelID)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(members, func(m model.PersonaChannelMember) bool { return m.PersonaID == personaID }), nil
+}
+
+// reloadActor makes a running persona pick up a subscription change. The
+// actor is reloaded rather than restarted so its runs in other channels
+// finish undisturbed.
+func (b *builtinCommands) reloadActor(p model.Persona) {
+	if b.Supervisor == nil || !b.Supervisor.Running() {
+		return
+	}
+	b.Supervisor.ReloadActor(p.ID)
+}
+
+func (b *builtinCommands) invite(inv *CommandInvocation) (CommandResult, error) {
+	p, _ := inv.Persona("persona")
+	in, err := b.inChannel(p.ID, inv.Channel.ID)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	if in {
+		return CommandResult{Text: fmt.Sprintf("@%s is already in this channel.", p.Name)}, nil
+	}
+	if err := model.SubscribeChannel(b.DB, p.ID, inv.Channel.ID); err != nil {
+		return CommandResult{}, err
+	}
+	inv.audit(membersTarget(inv.Channel.ID), nil, map[string]int64{"persona_id": p.ID})
+	b.reloadActor(p)
+	return CommandResult{Text: fmt.Sprintf("Invited @%s.", p.Name)}, nil
+}
+
+func (b *builtinCommands) kick(inv *CommandInvocation) (CommandResult, error) {
+	p, _ := inv.Persona("persona")
+	in, err := b.inChannel(p.ID, inv.Channel.ID)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	if !in {
+		return CommandResult{}, commandErrorf(http.StatusBadRequest, "@%s is not in this channel", p.Name)
+	}
+	if err := model.UnsubscribeChannel(b.DB, p.ID, inv.Channel.ID); err != nil {
+		return CommandResult{}, err
+	}
+	inv.audit(membersTarget(inv.Channel.ID), map[string]int64{"persona_id": p.ID}, nil)
+	if b.Supervisor != nil {
+		for _, run := range b.Supervisor.Runs.InChannel(inv.Channel.ID) {
+			if run.PersonaID == p.ID {
+				b.Supervisor.Runs.Cancel(p.ID, run.ID)
+			}
+		}
+	}
+	b.reloadActor(p)
+	return CommandResult{Text: fmt.Sprintf("Removed @%s from this channel.", p.Name)}, nil
+}
+
+func (b *builtinCommands) model(inv *CommandInvocation) (CommandResult, error) {
+	p, _ := inv.Persona("persona")
+	settings, err := model.ResolvePersonaChannelSettings(b.DB, p.ID, inv.Channel.ID)
+	if err != nil {
+		return CommandResult{}, err
+	}
+
+	settings.PersonaID, settings.ChannelID = p.ID, inv.Channel.ID
+	before := settings
+	id := inv.String("model")
+	switch id {
+	case "":
+		if settings.Model == nil {
+			return CommandResult{Text: fmt.Sprintf("@%s uses its default model %s here.", p.Name, p.Model)}, nil
+		}
+		return CommandResult{Text: fmt.Sprintf("@%s uses %s here (default %s).", p.Name, *settings.Model, p.Model)}, nil
+	case "default":
+		settings.Model = nil
+	default:
+		settings.Model = &id
+	}
+	if err := model.SetPersonaChannelSettings(b.DB, settings); err != nil {
+		return CommandResult{}, err
+	}
+	inv.audit(fmt.Sprintf("personas/%d/channel-settings/%d", p.ID, inv.Channel.ID),
+		toChannelSettingsJSON(before, p), toChannelSettingsJSON(settings, p))
+	if settings.Model == nil {
+		return CommandResult{Text: fmt.Sprintf("@%s now uses its default model %s here.", p.Name, p.Model)}, nil
+	}
+	return CommandResult{Text: fmt.Sprintf("@%s now uses %s here.", p.Name, id)}, nil
+}
+
+func (b *builtinCommands) remind(inv *CommandInvocation) (CommandResult, error) {
+	after := inv.Duration("after")
+	rem, err := model.CreateReminder(b.DB, inv.User.ID, inv.Channel.ID, inv.String("text"), time.Now().Add(after))
+	if err != nil {
+		return CommandResult{}, err
+	}
+	inv.audit(fmt.Sprintf("reminders/%d", rem.ID), nil, map[string]any{
+		"id":         rem.ID,
+		"channel_id": rem.ChannelID,
+		"text":       rem.Text,
+		"due_at":     rem.DueAt.UTC().Format(time.RFC3339),
+	})
+	return CommandResult{Text: fmt.Sprintf("I'll remind you in %s.", after)}, nil
+}
+
+func (b *builtinCommands) reset(inv *CommandInvocation) (CommandResult, error) {
+	personas, err := b.channelPersonas(inv)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	// The audit log gets each persona's cursor, by persona ID.
+	names := make([]string, len(personas))
+	before, after := map[string]int64{}, map[string]int64{}
+	for i, p := range personas {
+		key := strconv.FormatInt(p.ID, 10)
+		if before[key], err = b.Supervisor.Cursors.Get(p.ID, inv.Channel.ID); err != nil {
+			return CommandResult{}, err
+		}
+		if _, err := b.Supervisor.ResetContext(p, inv.Channel.ID); err != nil {
+			return CommandResult{}, err
+		}
+		after[key], _ = b.Supervisor.Cursors.Get(p.ID, inv.Channel.ID)
+		names[i] = "@" + p.Name
+	}
+	inv.audit(fmt.Sprintf("channels/%d/cursors", inv.Channel.ID), before, after)
+	return CommandResult{Text: "Reset the context of " + strings.Join(names, ", ") + "."}, nil
+}
+
+func (b *builtinCommands) stop(inv *CommandInvocation) (CommandResult, error) {
+	p, only := inv.Persona("persona")
+	before, after := map[string]string{}, map[string]string{}
+	for _, run := range b.Supervisor.Runs.InChannel(inv.Channel.ID) {
+		if only && run.PersonaID != p.ID {
+			continue
+		}
+		if b.Supervisor.Runs.Cancel(run.PersonaID, run.ID) {
+			before[run.ID], after[run.ID] = model.RunRunning, model.RunCancelled
+		}
+	}
+	stopped := len(after)
+	if stopped == 0 {
+		return CommandResult{Text: "Nothing is running in this channel."}, nil
+	}
+	inv.audit(fmt.Sprintf("channels/%d/runs", inv.Channel.ID), before, after)
+	return CommandResult{Text: fmt.Sprintf("Stopped %d run(s).", stopped)}, nil
+}
+
+// summarize answers 202 straight away and sends the summary to the caller
+// when the persona has written it.
+func (b *builtinCommands) summarize(inv *CommandInvocation) (CommandResult, error) {
+	p, ok := inv.Persona("persona")
+	if !ok {
+		personas, err := b.channelPersonas(inv)
+		if err != nil {
+			return CommandResult{}, err
+		}
+		p = personas[0]
+	}
+
+	user, channelID := inv.User.ID, inv.Channel.ID
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), summarizeTimeout)
+		defer cancel()
+		summary, err := b.Supervisor.Summarize(ctx, p, channelID)
+		if err != nil {
+			msg := "internal error"
+			if errors.Is(err, agent.ErrNothingToSummarize) {
+				msg = err.Error()
+			} else {
+				slog.Error("commands: summarize", "persona", p.Name, "channel_id", channelID, "error", err)
+			}
+			sendCommandResponse(b.Hub, user, channelID, "summarize", "Could not summarize: "+msg, true)
+			return
+		}
+		sendCommandResponse(b.Hub, user, channelID, "summarize", summary, false)
+	}()
+	return CommandResult{
+		Text:   fmt.Sprintf("@%s is summarizing the conversation…", p.Name),
+		Status: http.StatusAccepted,
+	}, nil
+}
+
+// sendCommandResponse sends a command's answer over the WebSocket to the
+// user who ran it, and no one else.
+func sendCommandResponse(hub *ws.Hub, userID, channelID int64, command, text string, isErr bool) {
+	if hub == nil {
+		return
+	}
+	hub.SendToUser(userID, ws.Event{
+		Type: "command_response",
+		Data: map[string]any{
+			"channel_id": channelID,
+			"command":    command,
+			"text":       text,
+			"error":      isErr,
+		},
+	})
+}
+
+// DeliverReminders sends each due reminder to its user if they are
+// connected, and marks it delivered. Reminders for users who are offline
+// wait until they connect. It returns how many reminders were delivered.
+func DeliverReminders(d *db.DB, hub *ws.Hub, now time.Time) (int, error) {
+	due, err := model.ListDueReminders(d, now)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, r := range due {
+		if !hub.UserConnected(r.UserID) {
+			continue
+		}
+		hub.SendToUser(r.UserID, ws.Event{
+			Type: "reminder",
+			Data: map[string]any{
+				"id":         r.ID,
+				"channel_id": r.ChannelID,
+				"text":       r.Text,
+				"due_at":     r.DueAt.UTC().Format(time.RFC3339),
+			},
+		})
+		if err := model.MarkReminderDelivered(d, r.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+)
+
+// CommandHandler serves the slash command list for autocomplete.
+type CommandHandler struct {
+	Commands *CommandRegistry
+}
+
+type commandArgJSON struct {
+	Name     string  `json:"name"`
+	Kind     ArgKind `json:"kind"`
+	Optional bool    `json:"optional"`
+}
+
+type commandJSON struct {
+	Name        string           `json:"name"`
+	Aliases     []string         `json:"aliases"`
+	Description string           `json:"description"`
+	Usage       string           `json:"usage"`
+	Args        []commandArgJSON `json:"args"`
+	Permission  string           `json:"permission"`
+	Source      string           `json:"source"`
+}
+
+func toCommandJSON(c *SlashCommand) commandJSON {
+	out := commandJSON{
+		Name:        c.Name,
+		Aliases:     c.Aliases,
+		Description: c.Description,
+		Usage:       c.Usage(),
+		Args:        make([]commandArgJSON, len(c.Args)),
+		Permission:  c.Permission,
+		Source:      c.Source,
+	}
+	if out.Aliases == nil {
+		out.Aliases = []string{}
+	}
+	for i, a := range c.Args {
+		out.Args[i] = commandArgJSON{Name: a.Name, Kind: a.Kind, Optional: a.Optional}
+	}
+	return out
+}
+
+// ListCommands handles GET /api/commands.
+func (h *CommandHandler) ListCommands(w http.ResponseWriter, r *http.Request) {
+	cmds, err := h.Commands.List()
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]commandJSON, len(cmds))
+	for i, c := range cmds {
+		out[i] = toCommandJSON(c)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,354 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/api"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+type commandResp struct {
+	Command  string `json:"command"`
+	Response string `json:"response"`
+}
+
+// runCommand posts a slash command to a channel.
+func runCommand(t *testing.T, router http.Handler, token string, channelID int64, content string) commandResp {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"content": content})
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", channelID), string(body), "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, want 200, body: %s", content, rec.Code, rec.Body.String())
+	}
+	var resp commandResp
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return resp
+}
+
+func userID(t *testing.T, router http.Handler, token string) int64 {
+	t.Helper()
+	rec := doJSON(t, router, "GET", "/api/auth/me", "", "Authorization", "Bearer "+token)
+	var me struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&me)
+	return me.ID
+}
+
+// addChannelMember registers a user through an invite and adds them to the
+// channel as a plain member.
+func addChannelMember(t *testing.T, router http.Handler, ownerToken string, channelID int64, username string) string {
+	t.Helper()
+	rec := doJSON(t, router, "POST", "/api/invites", `{}`, "Authorization", "Bearer "+ownerToken)
+	var inv struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(rec.Body).Decode(&inv)
+	token := registerUser(t, router, username, "password123", inv.Code)
+
+	body := fmt.Sprintf(`{"user_id":%d}`, userID(t, router, token))
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/members", channelID), body, "Authorization", "Bearer "+ownerToken)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add member: status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	return token
+}
+
+// connectClient registers a fake WebSocket client for the user.
+func connectClient(t *testing.T, hub *ws.Hub, userID int64) *ws.Client {
+	t.Helper()
+	c := ws.NewTestClient(hub, userID)
+	hub.Register(c)
+	deadline := time.Now().Add(2 * time.Second)
+	for !hub.UserConnected(userID) {
+		if time.Now().After(deadline) {
+			t.Fatal("client not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return c
+}
+
+type wsEvent struct {
+	Type string         `json:"type"`
+	Data map[string]any `json:"data"`
+}
+
+// nextEvent returns the client's next event of the given type, or fails
+// after timeout.
+func nextEvent(t *testing.T, c *ws.Client, typ string, timeout time.Duration) (wsEvent, bool) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case raw := <-c.SendChan():
+			var ev wsEvent
+			json.Unmarshal(raw, &ev)
+			if ev.Type == typ {
+				return ev, true
+			}
+		case <-deadline:
+			return wsEvent{}, false
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, token, "general", "")
+
+	resp := runCommand(t, router, token, channelID, "/help")
+	if resp.Command != "help" {
+		t.Errorf("command = %q, want help", resp.Command)
+	}
+	for _, want := range []string{"/reset [@persona]", "/remind <after> <text>", "/model <@persona> [model]"} {
+		if !strings.Contains(resp.Response, want) {
+			t.Errorf("help missing %q:\n%s", want, resp.Response)
+		}
+	}
+
+	resp = runCommand(t, router, token, channelID, "/help reset-context")
+	if !strings.Contains(resp.Response, "Also: /reset-context") {
+		t.Errorf("help for alias = %q", resp.Response)
+	}
+
+	msgs, _ := model.GetRecentMessages(d, channelID, 10)
+	if len(msgs) != 0 {
+		t.Errorf("commands were posted as %d messages", len(msgs))
+	}
+}
+
+func TestUnknownCommandIsPosted(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, token, "general", "")
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", channelID), `{"content": "/shrug ok"}`, "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201, body: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCommandResponseIsEphemeral(t *testing.T) {
+	d := openTestDB(t)
+	router, sup := newTestRouterWithSupervisor(t, d)
+	alice := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, alice, "general", "")
+	bob := addChannelMember(t, router, alice, channelID, "bob")
+
+	aliceClient := connectClient(t, sup.Hub, userID(t, router, alice))
+	bobClient := connectClient(t, sup.Hub, userID(t, router, bob))
+
+	runCommand(t, router, alice, channelID, "/help")
+
+	ev, ok := nextEvent(t, aliceClient, "command_response", 2*time.Second)
+	if !ok {
+		t.Fatal("caller got no command_response")
+	}
+	if ev.Data["command"] != "help" || ev.Data["channel_id"] != float64(channelID) || ev.Data["error"] != false {
+		t.Errorf("event = %+v", ev.Data)
+	}
+	if _, ok := nextEvent(t, bobClient, "command_response", 100*time.Millisecond); ok {
+		t.Error("another member got the command_response")
+	}
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", channelID), `{"content": "/remind soon tea"}`, "Authorization", "Bearer "+alice)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad duration: status = %d, want 400", rec.Code)
+	}
+	ev, ok = nextEvent(t, aliceClient, "command_response", 2*time.Second)
+	if !ok || ev.Data["error"] != true || !strings.Contains(ev.Data["text"].(string), "usage: /remind <after> <text>") {
+		t.Errorf("error event = %+v", ev.Data)
+	}
+}
+
+func TestInviteAndKickCommands(t *testing.T) {
+	d := openTestDB(t)
+	router, sup := newTestRouterWithSupervisor(t, d)
+	alice := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, alice, "general", "")
+	bob := addChannelMember(t, router, alice, channelID, "bob")
+	p, _ := model.CreatePersona(d, "Code Reviewer", "You review.", "model", nil, 0.7, 100, 0, 0)
+
+	resp := runCommand(t, router, bob, channelID, "/invite @code reviewer")
+	if resp.Response != "Invited @Code Reviewer." {
+		t.Errorf("invite response = %q", resp.Response)
+	}
+	members, _ := model.GetChannelPersonas(d, channelID)
+	if len(members) != 1 || members[0].PersonaID != p.ID {
+		t.Fatalf("channel personas = %+v", members)
+	}
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", channelID), `{"content": "/kick @Code Reviewer"}`, "Authorization", "Bearer "+bob)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("kick by member: status = %d, want 403", rec.Code)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", channelID), `{"content": "/kick @nobody"}`, "Authorization", "Bearer "+alice)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("kick unknown persona: status = %d, want 404", rec.Code)
+	}
+
+	runCommand(t, router, alice, channelID, "/kick @Code Reviewer")
+	members, _ = model.GetChannelPersonas(d, channelID)
+	if len(members) != 0 {
+		t.Errorf("persona still in channel after kick: %+v", members)
+	}
+	if sup.Running() {
+		t.Error("kick started the supervisor")
+	}
+}
+
+func TestModelCommand(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, token, "general", "")
+	p, _ := model.CreatePersona(d, "bot", "prompt", "base-model", nil, 0.7, 100, 0, 0)
+
+	resp := runCommand(t, router, token, channelID, "/model @bot")
+	if resp.Response != "@bot uses its default model base-model here." {
+		t.Errorf("show = %q", resp.Response)
+	}
+
+	runCommand(t, router, token, channelID, "/model @bot fast-model")
+	settings, _ := model.ResolvePersonaChannelSettings(d, p.ID, channelID)
+	if settings.Model == nil || *settings.Model != "fast-model" {
+		t.Fatalf("model override = %v, want fast-model", settings.Model)
+	}
+
+	runCommand(t, router, token, channelID, "/model @bot default")
+	settings, _ = model.ResolvePersonaChannelSettings(d, p.ID, channelID)
+	if settings.Model != nil {
+		t.Errorf("model override = %q after default, want none", *settings.Model)
+	}
+}
+
+func TestResetAndStopCommands(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, token, "general", "")
+
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", channelID), `{"content": "/reset"}`, "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("reset without personas: status = %d, want 400", rec.Code)
+	}
+
+	a, _ := model.CreatePersona(d, "alpha", "prompt", "model", nil, 0.7, 100, 0, 0)
+	b, _ := model.CreatePersona(d, "beta", "prompt", "model", nil, 0.7, 100, 0, 0)
+	model.SubscribeChannel(d, a.ID, channelID)
+	model.SubscribeChannel(d, b.ID, channelID)
+
+	resp := runCommand(t, router, token, channelID, "/reset-context")
+	if resp.Command != "reset" || resp.Response != "Reset the context of @alpha, @beta." {
+		t.Errorf("reset = %+v", resp)
+	}
+	msgs, _ := model.GetRecentMessages(d, channelID, 10)
+	if len(msgs) != 2 {
+		t.Errorf("reset notices = %d, want 2", len(msgs))
+	}
+
+	resp = runCommand(t, router, token, channelID, "/stop @alpha")
+	if resp.Response != "Nothing is running in this channel." {
+		t.Errorf("stop = %q", resp.Response)
+	}
+}
+
+func TestRemindCommand(t *testing.T) {
+	d := openTestDB(t)
+	router, sup := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, token, "general", "")
+	uid := userID(t, router, token)
+
+	resp := runCommand(t, router, token, channelID, "/remind 10m check the deploy")
+	if resp.Response != "I'll remind you in 10m0s." {
+		t.Errorf("remind = %q", resp.Response)
+	}
+
+	// Not due yet, then due but alice is offline: nothing is delivered.
+	for _, now := range []time.Time{time.Now(), time.Now().Add(time.Hour)} {
+		if n, err := api.DeliverReminders(d, sup.Hub, now); err != nil || n != 0 {
+			t.Fatalf("deliver = %d, %v; want 0", n, err)
+		}
+	}
+
+	c := connectClient(t, sup.Hub, uid)
+	if n, err := api.DeliverReminders(d, sup.Hub, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("deliver = %d, %v; want 1", n, err)
+	}
+	ev, ok := nextEvent(t, c, "reminder", 2*time.Second)
+	if !ok || ev.Data["text"] != "check the deploy" || ev.Data["channel_id"] != float64(channelID) {
+		t.Errorf("reminder event = %+v", ev.Data)
+	}
+	if n, _ := api.DeliverReminders(d, sup.Hub, time.Now().Add(time.Hour)); n != 0 {
+		t.Errorf("reminder delivered again")
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	createPersona(t, router, token, "Architect", "You design.")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	definition := `{"triggers": {"command": "design"}, "stages": [{"name": "design", "persona": "Architect", "prompt": "{{.Input}}"}]}`
+	rec := doJSON(t, router, "POST", "/api/workflows", `{"name": "design", "definition": `+definition+`}`, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create workflow: status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	clash := `{"triggers": {"command": "help"}, "stages": [{"name": "a", "persona": "Architect", "prompt": "x"}]}`
+	rec = doJSON(t, router, "POST", "/api/workflows", `{"name": "clash", "definition": `+clash+`}`, auth...)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("workflow with built-in command: status = %d, want 400", rec.Code)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/commands", "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var cmds []struct {
+		Name       string   `json:"name"`
+		Aliases    []string `json:"aliases"`
+		Usage      string   `json:"usage"`
+		Permission string   `json:"permission"`
+		Source     string   `json:"source"`
+		Args       []struct {
+			Name     string `json:"name"`
+			Kind     string `json:"kind"`
+			Optional bool   `json:"optional"`
+		} `json:"args"`
+	}
+	json.NewDecoder(rec.Body).Decode(&cmds)
+
+	byName := map[string]int{}
+	for i, c := range cmds {
+		byName[c.Name] = i
+	}
+	for _, name := range []string{"help", "reset", "invite", "kick", "model", "summarize", "stop", "remind", "design"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("missing /%s", name)
+		}
+	}
+	if c := cmds[byName["kick"]]; c.Permission != "owner" || c.Source != "builtin" || len(c.Args) != 1 || c.Args[0].Kind != "persona" {
+		t.Errorf("kick = %+v", c)
+	}
+	if c := cmds[byName["reset"]]; len(c.Aliases) != 1 || c.Aliases[0] != "reset-context" {
+		t.Errorf("reset aliases = %v", c.Aliases)
+	}
+	if c := cmds[byName["design"]]; c.Source != "workflow" || c.Usage != "/design [input]" {
+		t.Errorf("design = %+v", c)
+	}
+}
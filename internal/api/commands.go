@@ -0,0 +1,318 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// ArgKind is how a slash command argument is parsed.
+type ArgKind string
+
+// Argument kinds. A text argument takes the rest of the line, so it must be
+// the last one.
+const (
+	ArgPersona  ArgKind = "persona"  // "@name" of an existing persona
+	ArgWord     ArgKind = "word"     // a single token
+	ArgDuration ArgKind = "duration" // a positive duration such as 10m or 1h30m
+	ArgText     ArgKind = "text"     // the rest of the line
+)
+
+// Who may run a slash command. Members are any channel member; owners are
+// channel owners and DM participants.
+const (
+	PermMember = "member"
+	PermOwner  = "owner"
+)
+
+// Where a slash command comes from.
+const (
+	CommandSourceBuiltin  = "builtin"
+	CommandSourceWorkflow = "workflow"
+)
+
+// CommandArg describes one argument of a slash command.
+type CommandArg struct {
+	Name     string
+	Kind     ArgKind
+	Optional bool
+}
+
+// SlashCommand is a command run from the message box as "/<name> <args>"
+// instead of posting a message.
+type SlashCommand struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Args        []CommandArg
+	Permission  string
+	Source      string
+	Run         func(*CommandInvocation) (CommandResult, error)
+}
+
+// Usage returns the command's syntax, e.g. "/model <@persona> [model]".
+func (c *SlashCommand) Usage() string {
+	var b strings.Builder
+	b.WriteString("/" + c.Name)
+	for _, a := range c.Args {
+		name := a.Name
+		if a.Kind == ArgPersona {
+			name = "@" + name
+		}
+		if a.Optional {
+			fmt.Fprintf(&b, " [%s]", name)
+		} else {
+			fmt.Fprintf(&b, " <%s>", name)
+		}
+	}
+	return b.String()
+}
+
+// CommandInvocation is a command being run by a user in a channel, with its
+// parsed arguments and the request that ran it.
+type CommandInvocation struct {
+	User    *model.User
+	Channel model.Channel
+	args    map[string]any
+	r       *http.Request
+}
+
+// audit records the command's change to target in the audit log, as
+// auditChange does for an endpoint.
+func (inv *CommandInvocation) audit(target string, before, after any) {
+	if inv.r != nil {
+		auditChange(inv.r, target, before, after)
+	}
+}
+
+// Persona returns the persona argument name, if it was given.
+func (inv *CommandInvocation) Persona(name string) (model.Persona, bool) {
+	p, ok := inv.args[name].(model.Persona)
+	return p, ok
+}
+
+// String returns the word or text argument name, or "" if it wasn't given.
+func (inv *CommandInvocation) String(name string) string {
+	s, _ := inv.args[name].(string)
+	return s
+}
+
+// Duration returns the duration argument name, or 0 if it wasn't given.
+func (inv *CommandInvocation) Duration(name string) time.Duration {
+	d, _ := inv.args[name].(time.Duration)
+	return d
+}
+
+// CommandResult is what a command answers. Text is shown to the caller
+// only. Status and Body, when set, replace the default HTTP response.
+type CommandResult struct {
+	Text   string
+	Status int
+	Body   any
+}
+
+// commandError is a command failure shown to the caller, answered with
+// status.
+type commandError struct {
+	status int
+	msg    string
+}
+
+func (e *commandError) Error() string { return e.msg }
+
+func commandErrorf(status int, format string, args ...any) error {
+	return &commandError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// commandErrorStatus returns the HTTP status and caller-facing message for a
+// command error. Unexpected errors are reported as internal.
+func commandErrorStatus(err error) (int, string) {
+	var ce *commandError
+	if errors.As(err, &ce) {
+		return ce.status, ce.msg
+	}
+	return http.StatusInternalServerError, "internal error"
+}
+
+// CommandRegistry holds the slash commands. Built-in commands are registered
+// up front; Source, if set, supplies the rest (e.g. workflow commands) on
+// every lookup so they follow changes. Built-ins win name clashes.
+type CommandRegistry struct {
+	Source func() ([]*SlashCommand, error)
+
+	builtins []*SlashCommand
+	names    map[string]*SlashCommand
+}
+
+// NewCommandRegistry creates an empty CommandRegistry.
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{names: make(map[string]*SlashCommand)}
+}
+
+// Register adds a built-in command. It panics if the name or an alias is
+// taken, as that is a programming error.
+func (r *CommandRegistry) Register(cmd SlashCommand) {
+	cmd.Source = CommandSourceBuiltin
+	if cmd.Permission == "" {
+		cmd.Permission = PermMember
+	}
+	c := &cmd
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if _, ok := r.names[name]; ok {
+			panic("api: slash command /" + name + " registered twice")
+		}
+		r.names[name] = c
+	}
+	r.builtins = append(r.builtins, c)
+}
+
+// IsBuiltin reports whether name is a built-in command or alias.
+func (r *CommandRegistry) IsBuiltin(name string) bool {
+	_, ok := r.names[name]
+	return ok
+}
+
+// Lookup returns the command called name, by name or alias.
+func (r *CommandRegistry) Lookup(name string) (*SlashCommand, bool, error) {
+	if c, ok := r.names[name]; ok {
+		return c, true, nil
+	}
+	if r.Source == nil {
+		return nil, false, nil
+	}
+	extra, err := r.Source()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, c := range extra {
+		if c.Name == name {
+			return c, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// List returns every command: the built-ins in registration order, then
+// the others by name.
+func (r *CommandRegistry) List() ([]*SlashCommand, error) {
+	out := slices.Clone(r.builtins)
+	if r.Source == nil {
+		return out, nil
+	}
+	extra, err := r.Source()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(extra, func(a, b *SlashCommand) int { return strings.Compare(a.Name, b.Name) })
+	for _, c := range extra {
+		if !r.IsBuiltin(c.Name) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// authorizeCommand checks that user may run cmd in ch.
+func authorizeCommand(d *db.DB, cmd *SlashCommand, ch model.Channel, user *model.User) error {
+	if cmd.Permission != PermOwner || ch.IsDM {
+		return nil
+	}
+	role, err := model.GetChannelMemberRole(d, ch.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return commandErrorf(http.StatusForbidden, "/%s can only be used by channel owners", cmd.Name)
+	}
+	return nil
+}
+
+// parseCommandArgs parses input against cmd's arguments.
+func parseCommandArgs(d *db.DB, cmd *SlashCommand, input string) (map[string]any, error) {
+	usage := func(format string, args ...any) error {
+		return commandErrorf(http.StatusBadRequest, "%s (usage: %s)", fmt.Sprintf(format, args...), cmd.Usage())
+	}
+
+	args := make(map[string]any)
+	rest := strings.TrimSpace(input)
+	for _, a := range cmd.Args {
+		if rest == "" {
+			if !a.Optional {
+				return nil, usage("missing %s", a.Name)
+			}
+			continue
+		}
+		switch a.Kind {
+		case ArgText:
+			args[a.Name] = rest
+			rest = ""
+		case ArgPersona:
+			if !strings.HasPrefix(rest, "@") {
+				if a.Optional {
+					continue
+				}
+				return nil, usage("%s must be an @persona", a.Name)
+			}
+			p, after, err := parsePersonaMention(d, rest[1:])
+			if err != nil {
+				return nil, err
+			}
+			args[a.Name] = p
+			rest = strings.TrimSpace(after)
+		case ArgWord, ArgDuration:
+			word, after, _ := strings.Cut(rest, " ")
+			if a.Kind == ArgDuration {
+				dur, err := time.ParseDuration(word)
+				if err != nil || dur <= 0 {
+					return nil, usage("%s must be a duration such as 10m or 2h", a.Name)
+				}
+				args[a.Name] = dur
+			} else {
+				args[a.Name] = word
+			}
+			rest = strings.TrimSpace(after)
+		}
+	}
+	if rest != "" {
+		return nil, usage("unexpected %q", rest)
+	}
+	return args, nil
+}
+
+// parsePersonaMention matches the persona whose name starts s, ignoring
+// case, and returns it with the text after its name. Persona names may
+// contain spaces, so the longest match wins.
+func parsePersonaMention(d *db.DB, s string) (model.Persona, string, error) {
+	personas, err := model.ListPersonas(d)
+	if err != nil {
+		return model.Persona{}, "", err
+	}
+	var (
+		best  model.Persona
+		found bool
+	)
+	for _, p := range personas {
+		n := len(p.Name)
+		if n > len(s) || !strings.EqualFold(s[:n], p.Name) {
+			continue
+		}
+		if n < len(s) && !unicode.IsSpace(rune(s[n])) {
+			continue
+		}
+		if !found || n > len(best.Name) {
+			best, found = p, true
+		}
+	}
+	if !found {
+		name, _, _ := strings.Cut(s, " ")
+		return model.Persona{}, "", commandErrorf(http.StatusNotFound, "unknown persona @%s", name)
+	}
+	return best, s[len(best.Name):], nil
+}
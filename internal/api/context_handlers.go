@@ -23,6 +23,7 @@ type contextBudgetJSON struct {
 	TotalTokens     int   `json:"total_tokens"`
 	SystemTokens    int   `json:"system_tokens"`
 	ProjectTokens   int   `json:"project_tokens"`
+	MemoryTokens    int   `json:"memory_tokens"`
 	HistoryTokens   int   `json:"history_tokens"`
 	HistoryMessages int   `json:"history_messages"`
 	Exhausted       bool  `json:"exhausted"`
@@ -51,6 +52,12 @@ func (h *ContextHandler) ContextBudget(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusNotFound, "persona not found")
 		return
 	}
+	settings, err := model.ResolvePersonaChannelSettings(h.DB, personaID, channelID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	persona = settings.Apply(persona)
 
 	history, err := model.GetRecentMessages(h.DB, channelID, 50)
 	if err != nil {
@@ -68,12 +75,23 @@ func (h *ContextHandler) ContextBudget(w http.ResponseWriter, r *http.Request) {
 		projects = nil
 	}
 
+	// Estimate from the memories already indexed; a read never indexes.
+	var memories []model.Memory
+	if h.Supervisor != nil && h.Supervisor.Memory != nil {
+		v := model.MemoryVisibility{PersonaID: personaID, ChannelID: channelID}
+		if len(projects) > 0 {
+			v.ProjectID = projects[0].ID
+		}
+		memories = agent.RecallMemories(r.Context(), h.Supervisor.Memory, v, "", history)
+	}
+
 	assembler := &agent.ContextAssembler{}
 	_, budget := assembler.AssembleContext(agent.AssembleInput{
 		Persona:   persona,
 		ChannelID: channelID,
 		Projects:  projects,
 		History:   history,
+		Memories:  memories,
 	})
 
 	WriteJSON(w, http.StatusOK, contextBudgetJSON{
@@ -82,6 +100,7 @@ func (h *ContextHandler) ContextBudget(w http.ResponseWriter, r *http.Request) {
 		TotalTokens:     budget.TotalTokens,
 		SystemTokens:    budget.SystemTokens,
 		ProjectTokens:   budget.ProjectTokens,
+		MemoryTokens:    budget.MemoryTokens,
 		HistoryTokens:   budget.HistoryTokens,
 		HistoryMessages: budget.HistoryMessages,
 		Exhausted:       budget.Exhausted,
@@ -107,34 +126,17 @@ func (h *ContextHandler) ResetContext(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the latest message ID in the channel to advance cursor.
-	latestID, err := model.GetLatestMessageID(h.DB, channelID)
+	before, err := h.Supervisor.Cursors.Get(persona.ID, channelID)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
-
-	// Advance cursor to latest message.
-	if err := h.Supervisor.Cursors.Set(personaID, channelID, latestID); err != nil {
+	if _, err := h.Supervisor.ResetContext(persona, channelID); err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
-
-	// Reset status back to idle.
-	h.Supervisor.Status.Set(personaID, agent.StatusIdle)
-
-	// Post a system message.
-	ch := model.Channel{ID: channelID}
-	msg, err := model.CreateMessage(h.DB, ch.ID, personaID, "agent", persona.Name, "Context has been reset. I'm ready to continue.")
-	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "internal error")
-		return
-	}
-
-	h.Hub.Broadcast(ws.Event{
-		Type: "new_message",
-		Data: msg,
-	})
+	after, _ := h.Supervisor.Cursors.Get(persona.ID, channelID)
+	auditChange(r, "", map[string]int64{"last_seen_message_id": before}, map[string]int64{"last_seen_message_id": after})
 
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "reset"})
 }
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/memory"
 	"github.com/waynenilsen/waynebot/internal/model"
 )
 
@@ -125,6 +128,33 @@ func TestResetContextUnauthenticated(t *testing.T) {
 	}
 }
 
+func TestContextBudgetDoesNotIndexMemories(t *testing.T) {
+	d := openTestDB(t)
+	router, sup := newTestRouterWithSupervisor(t, d)
+	sup.Memory = memory.NewStore(d, memory.NewHashEmbedder())
+	token := registerUser(t, router, "alice", "password123", "")
+
+	p, _ := model.CreatePersona(d, "bot", "You are a test bot.", "model", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+	dir := t.TempDir()
+	proj, _ := model.CreateProject(d, "proj", dir, "")
+	model.SetChannelProject(d, ch.ID, proj.ID)
+	os.MkdirAll(filepath.Join(dir, memory.Dir), 0o755)
+	os.WriteFile(filepath.Join(dir, memory.Dir, "deploys.md"), []byte("Deploys happen on Tuesdays."), 0o644)
+	model.CreateMessage(d, ch.ID, 999, "human", "alice", "When do deploys happen?")
+
+	rec := doJSON(t, router, "GET",
+		fmt.Sprintf("/api/agents/%d/context-budget?channel_id=%d", p.ID, ch.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	sup.Memory.Wait()
+	if list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: proj.ID}); len(list) != 0 {
+		t.Errorf("context budget indexed %d memory files", len(list))
+	}
+}
+
 func TestContextBudgetUnauthenticated(t *testing.T) {
 	d := openTestDB(t)
 	router, _ := newTestRouterWithSupervisor(t, d)
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// DelegationHandler exposes subtasks personas delegated to each other.
+type DelegationHandler struct {
+	DB *db.DB
+}
+
+type delegationJSON struct {
+	ID                int64         `json:"id"`
+	FromPersonaID     int64         `json:"from_persona_id"`
+	FromPersonaName   string        `json:"from_persona_name"`
+	ToPersonaID       int64         `json:"to_persona_id"`
+	ToPersonaName     string        `json:"to_persona_name"`
+	OriginChannelID   int64         `json:"origin_channel_id"`
+	ThreadChannelID   int64         `json:"thread_channel_id"`
+	ProjectID         int64         `json:"project_id"`
+	Instructions      string        `json:"instructions"`
+	Status            string        `json:"status"`
+	Result            string        `json:"result"`
+	Error             string        `json:"error"`
+	Depth             int           `json:"depth"`
+	RequestMessageID  int64         `json:"request_message_id"`
+	ResponseMessageID int64         `json:"response_message_id"`
+	CreatedAt         string        `json:"created_at"`
+	FinishedAt        *string       `json:"finished_at"`
+	Messages          []messageJSON `json:"messages,omitempty"`
+}
+
+func toDelegationJSON(dl model.Delegation) delegationJSON {
+	out := delegationJSON{
+		ID:                dl.ID,
+		FromPersonaID:     dl.FromPersonaID,
+		FromPersonaName:   dl.FromPersonaName,
+		ToPersonaID:       dl.ToPersonaID,
+		ToPersonaName:     dl.ToPersonaName,
+		OriginChannelID:   dl.OriginChannelID,
+		ThreadChannelID:   dl.ThreadChannelID,
+		ProjectID:         dl.ProjectID,
+		Instructions:      dl.Instructions,
+		Status:            dl.Status,
+		Result:            dl.Result,
+		Error:             dl.Error,
+		Depth:             dl.Depth,
+		RequestMessageID:  dl.RequestMessageID,
+		ResponseMessageID: dl.ResponseMessageID,
+		CreatedAt:         dl.CreatedAt.Format(time.RFC3339),
+	}
+	if dl.FinishedAt != nil {
+		s := dl.FinishedAt.Format(time.RFC3339)
+		out.FinishedAt = &s
+	}
+	return out
+}
+
+// ListDelegations handles GET /api/delegations, newest first. It filters by
+// persona_id (delegations made by or to the persona), channel_id (the
+// channel the delegation was made from) and status.
+func (h *DelegationHandler) ListDelegations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var filter model.DelegationFilter
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"persona_id", &filter.PersonaID},
+		{"channel_id", &filter.OriginChannelID},
+	} {
+		if v := q.Get(p.name); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				ErrorResponse(w, http.StatusBadRequest, "invalid "+p.name)
+				return
+			}
+			*p.dst = id
+		}
+	}
+	filter.Status = q.Get("status")
+	filter.Limit, filter.Offset = parsePagination(r, 50, 200)
+
+	delegations, err := model.ListDelegations(h.DB, filter)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]delegationJSON, len(delegations))
+	for i, dl := range delegations {
+		out[i] = toDelegationJSON(dl)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetDelegation handles GET /api/delegations/{id}. The response includes the
+// delegation's exchange from the personas' DM thread.
+func (h *DelegationHandler) GetDelegation(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	dl, err := model.GetDelegation(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "delegation not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	// A running delegation's exchange extends to the end of the thread; a
+	// finished one ends at its answer, or at the request if there was none.
+	lastID := dl.ResponseMessageID
+	if lastID == 0 && dl.Status != model.DelegationRunning {
+		lastID = dl.RequestMessageID
+	}
+	msgs, err := model.GetMessagesBetween(h.DB, dl.ThreadChannelID, dl.RequestMessageID, lastID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := toDelegationJSON(dl)
+	out.Messages = make([]messageJSON, len(msgs))
+	for i, m := range msgs {
+		out.Messages[i] = toMessageJSON(m)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,87 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestDelegationEndpoints(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	leadID := createPersona(t, router, token, "Lead", "You lead.")
+	helperID := createPersona(t, router, token, "Helper", "You help.")
+	channelID := createChannel(t, router, token, "general", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	thread, err := model.FindOrCreatePersonaDM(d, leadID, helperID)
+	if err != nil {
+		t.Fatalf("open thread: %v", err)
+	}
+	req, _ := model.CreateMessage(d, thread.ID, leadID, "agent", "Lead", "Summarize the README.")
+	resp, _ := model.CreateMessage(d, thread.ID, helperID, "agent", "Helper", "It is a chat server.")
+	model.CreateMessage(d, thread.ID, leadID, "agent", "Lead", "A later delegation.")
+	dl, err := model.CreateDelegation(d, model.Delegation{
+		FromPersonaID:    leadID,
+		ToPersonaID:      helperID,
+		OriginChannelID:  channelID,
+		ThreadChannelID:  thread.ID,
+		Instructions:     "Summarize the README.",
+		Depth:            1,
+		RequestMessageID: req.ID,
+	})
+	if err != nil {
+		t.Fatalf("create delegation: %v", err)
+	}
+	model.FinishDelegation(d, dl.ID, model.DelegationCompleted, resp.Content, "", resp.ID)
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/delegations?channel_id=%d", channelID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var list []struct {
+		ID              int64  `json:"id"`
+		FromPersonaName string `json:"from_persona_name"`
+		Status          string `json:"status"`
+		ThreadChannelID int64  `json:"thread_channel_id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].FromPersonaName != "Lead" || list[0].Status != "completed" || list[0].ThreadChannelID != thread.ID {
+		t.Errorf("unexpected list: %+v", list)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/delegations?status=running", "", auth...)
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("status filter returned %+v", list)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/delegations/%d", dl.ID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get status = %d", rec.Code)
+	}
+	var detail struct {
+		Result   string `json:"result"`
+		Messages []struct {
+			AuthorName string `json:"author_name"`
+			Content    string `json:"content"`
+		} `json:"messages"`
+	}
+	json.NewDecoder(rec.Body).Decode(&detail)
+	if detail.Result != "It is a chat server." || len(detail.Messages) != 2 || detail.Messages[1].AuthorName != "Helper" {
+		t.Errorf("unexpected detail: %+v", detail)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/delegations/999", "", auth...)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing delegation status = %d, want 404", rec.Code)
+	}
+	rec = doJSON(t, router, "GET", "/api/delegations?persona_id=abc", "", auth...)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bad persona_id status = %d, want 400", rec.Code)
+	}
+}
@@ -137,10 +137,14 @@ func (h *DMHandler) CreateDM(w http.ResponseWriter, r *http.Request) {
 		OtherParticipant: otherParticipant,
 	}
 
+	// An existing DM comes back unchanged.
 	status := http.StatusOK
+	var before any = resp
 	if created {
 		status = http.StatusCreated
+		before = nil
 	}
+	auditChange(r, fmt.Sprintf("channels/%d", ch.ID), before, resp)
 	WriteJSON(w, status, resp)
 }
 
@@ -183,11 +183,15 @@ func (h *DocumentHandler) PutDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := os.WriteFile(filepath.Join(dir, filename), []byte(req.Content), 0o644); err != nil {
+	fp := filepath.Join(dir, filename)
+	before := documentState(fp, docType, filename)
+	if err := os.WriteFile(fp, []byte(req.Content), 0o644); err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "failed to write document")
 		return
 	}
 
+	auditChange(r, "", before, documentState(fp, docType, filename))
+
 	WriteJSON(w, http.StatusOK, documentResponse{
 		Type:     docType,
 		Filename: filename,
@@ -236,7 +240,9 @@ func (h *DocumentHandler) AppendDocument(w http.ResponseWriter, r *http.Request)
 
 	entry := fmt.Sprintf("\n## %s\n\n%s\n", time.Now().UTC().Format(time.RFC3339), req.Content)
 
-	f, err := os.OpenFile(filepath.Join(dir, filename), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	fp := filepath.Join(dir, filename)
+	before := documentState(fp, docType, filename)
+	f, err := os.OpenFile(fp, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "failed to open document")
 		return
@@ -248,6 +254,8 @@ func (h *DocumentHandler) AppendDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	auditChange(r, "", before, documentState(fp, docType, filename))
+
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
@@ -274,6 +282,7 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 	}
 
 	fp := filepath.Join(docTypeDir(project, docType), filename)
+	before := documentState(fp, docType, filename)
 	if err := os.Remove(fp); err != nil {
 		if os.IsNotExist(err) {
 			ErrorResponse(w, http.StatusNotFound, "document not found")
@@ -283,9 +292,20 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	auditChange(r, "", before, nil)
+
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// documentState reads a document for the audit log; nil if it doesn't exist.
+func documentState(path, docType, filename string) any {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return documentResponse{Type: docType, Filename: filename, Content: string(data)}
+}
+
 // lookupProject extracts the project ID from the URL, fetches it, and validates the path.
 func (h *DocumentHandler) lookupProject(w http.ResponseWriter, r *http.Request) (model.Project, bool) {
 	id, ok := ParseIntParam(w, r, "id")
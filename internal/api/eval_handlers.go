@@ -0,0 +1,148 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// EvalHandler serves the results of `waynebot eval` runs.
+type EvalHandler struct {
+	DB *db.DB
+}
+
+type evalRunJSON struct {
+	ID        int64  `json:"id"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Scenarios int    `json:"scenarios"`
+	Passed    int    `json:"passed"`
+	CreatedAt string `json:"created_at"`
+}
+
+func toEvalRunJSON(r model.EvalRun) evalRunJSON {
+	return evalRunJSON{
+		ID:        r.ID,
+		Provider:  r.Provider,
+		Model:     r.Model,
+		Scenarios: r.Scenarios,
+		Passed:    r.Passed,
+		CreatedAt: r.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+type evalResultJSON struct {
+	ID             int64           `json:"id"`
+	Scenario       string          `json:"scenario"`
+	PersonaID      int64           `json:"persona_id"`
+	PersonaName    string          `json:"persona_name"`
+	PersonaVersion int             `json:"persona_version"`
+	Model          string          `json:"model"`
+	Passed         bool            `json:"passed"`
+	Error          string          `json:"error"`
+	Output         string          `json:"output"`
+	ToolCalls      json.RawMessage `json:"tool_calls"`
+	Assertions     json.RawMessage `json:"assertions"`
+	DurationMs     int64           `json:"duration_ms"`
+}
+
+func toEvalResultJSON(r model.EvalResult) evalResultJSON {
+	return evalResultJSON{
+		ID:             r.ID,
+		Scenario:       r.Scenario,
+		PersonaID:      r.PersonaID,
+		PersonaName:    r.PersonaName,
+		PersonaVersion: r.PersonaVersion,
+		Model:          r.Model,
+		Passed:         r.Passed,
+		Error:          r.Error,
+		Output:         r.Output,
+		ToolCalls:      json.RawMessage(r.ToolCallsJSON),
+		Assertions:     json.RawMessage(r.AssertionsJSON),
+		DurationMs:     r.DurationMs,
+	}
+}
+
+type evalVersionJSON struct {
+	Version  int    `json:"version"`
+	Scenario string `json:"scenario"`
+	Runs     int    `json:"runs"`
+	Passed   int    `json:"passed"`
+}
+
+// ListEvalRuns returns eval runs, newest first.
+func (h *EvalHandler) ListEvalRuns(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r, 50, 200)
+	runs, err := model.ListEvalRuns(h.DB, limit, offset)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]evalRunJSON, len(runs))
+	for i, run := range runs {
+		out[i] = toEvalRunJSON(run)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetEvalRun returns an eval run with the result of each scenario.
+func (h *EvalHandler) GetEvalRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	run, err := model.GetEvalRun(h.DB, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ErrorResponse(w, http.StatusNotFound, "eval run not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	results, err := model.ListEvalResults(h.DB, id)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]evalResultJSON, len(results))
+	for i, res := range results {
+		out[i] = toEvalResultJSON(res)
+	}
+	WriteJSON(w, http.StatusOK, struct {
+		evalRunJSON
+		Results []evalResultJSON `json:"results"`
+	}{toEvalRunJSON(run), out})
+}
+
+// PersonaEvals returns how each of a persona's versions fared on each
+// scenario across eval runs, newest version first.
+func (h *EvalHandler) PersonaEvals(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, err := model.GetPersona(h.DB, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	summary, err := model.GetEvalVersionSummary(h.DB, id)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]evalVersionJSON, len(summary))
+	for i, s := range summary {
+		out[i] = evalVersionJSON{Version: s.Version, Scenario: s.Scenario, Runs: s.Runs, Passed: s.Passed}
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
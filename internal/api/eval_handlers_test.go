@@ -0,0 +1,70 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestEvalEndpoints(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Bot", "You help.")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	run, err := model.CreateEvalRun(d, "script", "", []model.EvalResult{{
+		Scenario: "greets", PersonaID: personaID, PersonaName: "Bot", PersonaVersion: 1, Passed: true,
+		Output: "Hi!", ToolCallsJSON: `[{"name":"file_read","arguments":{"path":"a"}}]`, AssertionsJSON: "[]",
+	}})
+	if err != nil {
+		t.Fatalf("CreateEvalRun: %v", err)
+	}
+
+	rec := doJSON(t, router, "GET", "/api/evals", "", auth...)
+	var runs []struct {
+		ID     int64 `json:"id"`
+		Passed int   `json:"passed"`
+	}
+	json.NewDecoder(rec.Body).Decode(&runs)
+	if rec.Code != http.StatusOK || len(runs) != 1 || runs[0].ID != run.ID || runs[0].Passed != 1 {
+		t.Fatalf("list = %d %+v", rec.Code, runs)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/evals/%d", run.ID), "", auth...)
+	var got struct {
+		Provider string `json:"provider"`
+		Results  []struct {
+			Scenario  string `json:"scenario"`
+			ToolCalls []struct {
+				Name string `json:"name"`
+			} `json:"tool_calls"`
+		} `json:"results"`
+	}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || got.Provider != "script" || len(got.Results) != 1 ||
+		len(got.Results[0].ToolCalls) != 1 || got.Results[0].ToolCalls[0].Name != "file_read" {
+		t.Fatalf("get = %d %+v", rec.Code, got)
+	}
+	if rec := doJSON(t, router, "GET", "/api/evals/999", "", auth...); rec.Code != http.StatusNotFound {
+		t.Errorf("missing run = %d, want 404", rec.Code)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/personas/%d/evals", personaID), "", auth...)
+	var summary []struct {
+		Version  int    `json:"version"`
+		Scenario string `json:"scenario"`
+		Runs     int    `json:"runs"`
+		Passed   int    `json:"passed"`
+	}
+	json.NewDecoder(rec.Body).Decode(&summary)
+	if rec.Code != http.StatusOK || len(summary) != 1 || summary[0].Version != 1 || summary[0].Passed != 1 {
+		t.Errorf("persona evals = %d %+v", rec.Code, summary)
+	}
+	if rec := doJSON(t, router, "GET", "/api/personas/999/evals", "", auth...); rec.Code != http.StatusNotFound {
+		t.Errorf("missing persona = %d, want 404", rec.Code)
+	}
+}
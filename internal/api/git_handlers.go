@@ -0,0 +1,172 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+)
+
+// GitHandler handles endpoints for reviewing and merging persona branches.
+type GitHandler struct {
+	DB *db.DB
+}
+
+type personaBranchJSON struct {
+	Branch      string `json:"branch"`
+	PersonaID   *int64 `json:"persona_id"`
+	PersonaName string `json:"persona_name"`
+	Commit      string `json:"commit"`
+	Subject     string `json:"subject"`
+	Ahead       int    `json:"ahead"`
+	Behind      int    `json:"behind"`
+}
+
+type mergeBranchRequest struct {
+	Message string `json:"message"`
+}
+
+// lookupProject parses the project ID and loads the project, writing an error
+// response on failure.
+func lookupProject(d *db.DB, w http.ResponseWriter, r *http.Request) (model.Project, bool) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return model.Project{}, false
+	}
+	p, err := model.GetProject(d, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "project not found")
+			return model.Project{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Project{}, false
+	}
+	return p, true
+}
+
+// lookupPersonaBranch resolves the persona_id URL param to its branch in the
+// project's repository, which may still carry a name the persona had before.
+func (h *GitHandler) lookupPersonaBranch(w http.ResponseWriter, r *http.Request, project model.Project) (string, bool) {
+	personaID, ok := ParseIntParam(w, r, "persona_id")
+	if !ok {
+		return "", false
+	}
+	p, err := model.GetPersona(h.DB, personaID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+			return "", false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return "", false
+	}
+	branch, err := tools.FindPersonaBranch(r.Context(), project.Path, p.ID)
+	if err != nil || branch == "" {
+		branch = tools.PersonaBranch(p.ID, p.Name)
+	}
+	return branch, true
+}
+
+// ListPersonaBranches returns all persona branches in a project's repository.
+func (h *GitHandler) ListPersonaBranches(w http.ResponseWriter, r *http.Request) {
+	project, ok := lookupProject(h.DB, w, r)
+	if !ok {
+		return
+	}
+
+	branches, err := tools.ListPersonaBranches(r.Context(), project.Path)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	personas, err := model.ListPersonas(h.DB)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	byID := make(map[int64]model.Persona, len(personas))
+	for _, p := range personas {
+		byID[p.ID] = p
+	}
+
+	out := make([]personaBranchJSON, len(branches))
+	for i, b := range branches {
+		out[i] = personaBranchJSON{
+			Branch:  b.Branch,
+			Commit:  b.Commit,
+			Subject: b.Subject,
+			Ahead:   b.Ahead,
+			Behind:  b.Behind,
+		}
+		if p, ok := byID[b.PersonaID]; ok {
+			id := p.ID
+			out[i].PersonaID = &id
+			out[i].PersonaName = p.Name
+		}
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// PersonaBranchDiff returns the diff a persona's branch would merge.
+func (h *GitHandler) PersonaBranchDiff(w http.ResponseWriter, r *http.Request) {
+	project, ok := lookupProject(h.DB, w, r)
+	if !ok {
+		return
+	}
+	branch, ok := h.lookupPersonaBranch(w, r, project)
+	if !ok {
+		return
+	}
+
+	diff, err := tools.BranchDiff(r.Context(), project.Path, branch)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			ErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"branch": branch, "diff": diff})
+}
+
+// MergePersonaBranch merges a persona's branch into the project's checked-out branch.
+func (h *GitHandler) MergePersonaBranch(w http.ResponseWriter, r *http.Request) {
+	project, ok := lookupProject(h.DB, w, r)
+	if !ok {
+		return
+	}
+	branch, ok := h.lookupPersonaBranch(w, r, project)
+	if !ok {
+		return
+	}
+
+	var req mergeBranchRequest
+	if r.ContentLength > 0 {
+		if err := ReadJSON(r, &req); err != nil {
+			ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	head, _ := tools.HeadCommit(r.Context(), project.Path)
+	commit, err := tools.MergeBranch(r.Context(), project.Path, branch, strings.TrimSpace(req.Message))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			ErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		ErrorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	auditChange(r, "", map[string]string{"head": head}, map[string]string{"branch": branch, "head": commit})
+
+	WriteJSON(w, http.StatusOK, map[string]string{"branch": branch, "commit": commit})
+}
@@ -0,0 +1,126 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+)
+
+// gitRepo creates a temp git repository with a single commit.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	run("init", "-q", "-b", "main")
+	run("config", "user.name", "Test")
+	run("config", "user.email", "test@example.com")
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\n"), 0o644)
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+	return dir
+}
+
+func TestPersonaBranchesListDiffMerge(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+
+	repo := gitRepo(t)
+	proj, err := model.CreateProject(d, "repo", repo, "")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+
+	wt := tools.NewWorktrees(t.TempDir())
+	dir, err := wt.Ensure(context.Background(), proj.ID, repo, personaID, "Coder")
+	if err != nil {
+		t.Fatalf("ensure worktree: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "feature.txt"), []byte("feature\n"), 0o644)
+	ctx := tools.WithProjectDir(context.Background(), dir)
+	if _, err := tools.GitCommit("")(ctx, json.RawMessage(`{"message":"add feature"}`)); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/projects/%d/persona-branches", proj.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var branches []struct {
+		Branch    string `json:"branch"`
+		PersonaID *int64 `json:"persona_id"`
+		Ahead     int    `json:"ahead"`
+	}
+	json.NewDecoder(rec.Body).Decode(&branches)
+	if len(branches) != 1 || branches[0].Branch != fmt.Sprintf("waynebot/%d-coder", personaID) {
+		t.Fatalf("unexpected branches: %+v", branches)
+	}
+	if branches[0].PersonaID == nil || *branches[0].PersonaID != personaID {
+		t.Errorf("persona_id = %v, want %d", branches[0].PersonaID, personaID)
+	}
+	if branches[0].Ahead != 1 {
+		t.Errorf("ahead = %d, want 1", branches[0].Ahead)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/projects/%d/persona-branches/%d/diff", proj.ID, personaID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("diff status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var diff struct {
+		Diff string `json:"diff"`
+	}
+	json.NewDecoder(rec.Body).Decode(&diff)
+	if !strings.Contains(diff.Diff, "+feature") {
+		t.Errorf("diff missing change: %s", diff.Diff)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/projects/%d/persona-branches/%d/merge", proj.ID, personaID),
+		`{"message":"merge coder work"}`, "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(repo, "feature.txt")); err != nil {
+		t.Errorf("expected feature.txt in project after merge: %v", err)
+	}
+}
+
+func TestPersonaBranchDiffMissingBranch(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+
+	repo := gitRepo(t)
+	proj, err := model.CreateProject(d, "repo", repo, "")
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	personaID := createPersona(t, router, token, "Idle", "You idle.")
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/projects/%d/persona-branches/%d/diff", proj.ID, personaID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/waynenilsen/waynebot/internal/auth"
@@ -52,6 +53,8 @@ func (h *InviteHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditChange(r, "invites/"+strconv.FormatInt(inv.ID, 10), nil, toInviteJSON(inv))
+
 	WriteJSON(w, http.StatusCreated, toInviteJSON(inv))
 }
 
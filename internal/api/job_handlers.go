@@ -0,0 +1,149 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// JobHandler handles inspecting and retrying agent jobs.
+type JobHandler struct {
+	DB  *db.DB
+	Hub *ws.Hub
+}
+
+type agentJobJSON struct {
+	ID            int64   `json:"id"`
+	PersonaID     int64   `json:"persona_id"`
+	ChannelID     int64   `json:"channel_id"`
+	FromMessageID int64   `json:"from_message_id"`
+	ToMessageID   int64   `json:"to_message_id"`
+	Status        string  `json:"status"`
+	Attempts      int     `json:"attempts"`
+	LastError     string  `json:"last_error"`
+	NextAttemptAt *string `json:"next_attempt_at"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
+}
+
+func toAgentJobJSON(j model.AgentJob) agentJobJSON {
+	out := agentJobJSON{
+		ID:            j.ID,
+		PersonaID:     j.PersonaID,
+		ChannelID:     j.ChannelID,
+		FromMessageID: j.FromMessageID,
+		ToMessageID:   j.ToMessageID,
+		Status:        j.Status,
+		Attempts:      j.Attempts,
+		LastError:     j.LastError,
+		CreatedAt:     j.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     j.UpdatedAt.Format(time.RFC3339),
+	}
+	if j.NextAttemptAt != nil {
+		s := j.NextAttemptAt.Format(time.RFC3339)
+		out.NextAttemptAt = &s
+	}
+	return out
+}
+
+// ListJobs returns agent jobs, newest first, optionally filtered by status,
+// persona_id and channel_id.
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := model.AgentJobFilter{Status: q.Get("status")}
+	switch f.Status {
+	case "", model.JobPending, model.JobRunning, model.JobSucceeded, model.JobFailed, model.JobDead:
+	default:
+		ErrorResponse(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"persona_id", &f.PersonaID},
+		{"channel_id", &f.ChannelID},
+	} {
+		if v := q.Get(p.name); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				ErrorResponse(w, http.StatusBadRequest, "invalid "+p.name)
+				return
+			}
+			*p.dst = id
+		}
+	}
+
+	limit, offset := parsePagination(r, 50, 200)
+	jobs, err := model.ListAgentJobs(h.DB, f, limit, offset)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]agentJobJSON, len(jobs))
+	for i, j := range jobs {
+		out[i] = toAgentJobJSON(j)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetJob returns a single agent job.
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	job, err := model.GetAgentJob(h.DB, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ErrorResponse(w, http.StatusNotFound, "job not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	WriteJSON(w, http.StatusOK, toAgentJobJSON(job))
+}
+
+// RetryJob puts a failed or dead job back in the queue with its attempts
+// reset, and wakes the actors to pick it up.
+func (h *JobHandler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	before, err := model.GetAgentJob(h.DB, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ErrorResponse(w, http.StatusNotFound, "job not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	job, err := model.RetryAgentJob(h.DB, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			ErrorResponse(w, http.StatusNotFound, "job not found")
+		case errors.Is(err, model.ErrJobNotRetryable):
+			ErrorResponse(w, http.StatusConflict, err.Error())
+		default:
+			ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	out := toAgentJobJSON(job)
+	if h.Hub != nil {
+		h.Hub.Broadcast(ws.Event{Type: "agent_job", Data: out})
+	}
+	auditChange(r, "", toAgentJobJSON(before), out)
+	WriteJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestJobEndpoints(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Bot", "You help.")
+	channelID := createChannel(t, router, token, "general", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	model.CreateMessage(d, channelID, 1, "human", "alice", "hi")
+	model.EnqueueAgentJob(d, personaID, channelID)
+	job, _, _ := model.ClaimAgentJob(d, personaID, channelID, "c1", time.Now())
+	if err := model.BuryAgentJob(d, job, "llm down"); err != nil {
+		t.Fatalf("bury: %v", err)
+	}
+
+	type jobJSON struct {
+		ID        int64  `json:"id"`
+		PersonaID int64  `json:"persona_id"`
+		Status    string `json:"status"`
+		Attempts  int    `json:"attempts"`
+		LastError string `json:"last_error"`
+	}
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/jobs?status=dead&persona_id=%d", personaID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var list []jobJSON
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].ID != job.ID || list[0].Attempts != 1 || list[0].LastError != "llm down" {
+		t.Fatalf("dead jobs = %+v", list)
+	}
+
+	rec = doJSON(t, router, "GET", "/api/jobs?status=pending", "", auth...)
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("pending jobs = %+v", list)
+	}
+	if rec := doJSON(t, router, "GET", "/api/jobs?status=bogus", "", auth...); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad status filter = %d, want 400", rec.Code)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/jobs/%d/retry", job.ID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retry status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var retried jobJSON
+	json.NewDecoder(rec.Body).Decode(&retried)
+	if retried.Status != model.JobPending || retried.Attempts != 0 {
+		t.Errorf("retried job = %+v", retried)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/jobs/%d", job.ID), "", auth...)
+	var got jobJSON
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || got.Status != model.JobPending {
+		t.Errorf("get = %d %+v", rec.Code, got)
+	}
+
+	if rec := doJSON(t, router, "POST", fmt.Sprintf("/api/jobs/%d/retry", job.ID), "", auth...); rec.Code != http.StatusConflict {
+		t.Errorf("retry pending job = %d, want 409", rec.Code)
+	}
+	if rec := doJSON(t, router, "GET", "/api/jobs/999", "", auth...); rec.Code != http.StatusNotFound {
+		t.Errorf("get missing job = %d, want 404", rec.Code)
+	}
+	if rec := doJSON(t, router, "GET", "/api/jobs", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated list = %d, want 401", rec.Code)
+	}
+}
@@ -122,6 +122,7 @@ func (h *MemberHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 				slog.Error("member: failed to restart actor", "persona_id", *req.PersonaID, "err", err)
 			}
 		}
+		auditChange(r, "", nil, req)
 		w.WriteHeader(http.StatusCreated)
 		return
 	}
@@ -130,6 +131,7 @@ func (h *MemberHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, "", nil, req)
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -160,6 +162,7 @@ func (h *MemberHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 			ErrorResponse(w, http.StatusInternalServerError, "internal error")
 			return
 		}
+		auditChange(r, "", req, nil)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -168,5 +171,6 @@ func (h *MemberHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, "", req, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// MemoryHandler lets humans browse and curate agent memories.
+type MemoryHandler struct {
+	DB    *db.DB
+	Store *memory.Store
+}
+
+type memoryJSON struct {
+	ID             int64    `json:"id"`
+	Scope          string   `json:"scope"`
+	PersonaID      int64    `json:"persona_id"`
+	ProjectID      int64    `json:"project_id"`
+	ChannelID      int64    `json:"channel_id"`
+	Title          string   `json:"title"`
+	Content        string   `json:"content"`
+	SourcePath     string   `json:"source_path"`
+	EmbeddingModel string   `json:"embedding_model"`
+	ExpiresAt      *string  `json:"expires_at"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+	Score          *float64 `json:"score,omitempty"`
+}
+
+type createMemoryRequest struct {
+	Scope     string `json:"scope"`
+	PersonaID int64  `json:"persona_id"`
+	ProjectID int64  `json:"project_id"`
+	ChannelID int64  `json:"channel_id"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// updateMemoryRequest changes only the fields that are present. An empty
+// expires_at removes the expiry.
+type updateMemoryRequest struct {
+	Scope     *string `json:"scope"`
+	PersonaID *int64  `json:"persona_id"`
+	ProjectID *int64  `json:"project_id"`
+	ChannelID *int64  `json:"channel_id"`
+	Title     *string `json:"title"`
+	Content   *string `json:"content"`
+	ExpiresAt *string `json:"expires_at"`
+}
+
+func toMemoryJSON(m model.Memory) memoryJSON {
+	out := memoryJSON{
+		ID:             m.ID,
+		Scope:          m.Scope,
+		PersonaID:      m.PersonaID,
+		ProjectID:      m.ProjectID,
+		ChannelID:      m.ChannelID,
+		Title:          m.Title,
+		Content:        m.Content,
+		SourcePath:     m.SourcePath,
+		EmbeddingModel: m.EmbeddingModel,
+		CreatedAt:      m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      m.UpdatedAt.Format(time.RFC3339),
+	}
+	if m.ExpiresAt != nil {
+		s := m.ExpiresAt.Format(time.RFC3339)
+		out.ExpiresAt = &s
+	}
+	return out
+}
+
+// parseOptionalTime parses an optional RFC 3339 time such as an expiry or
+// due date; "" means none.
+func parseOptionalTime(s string) (*time.Time, bool) {
+	if s == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+// validateMemory checks the scope, that the scope's owner is set and that
+// title and content are present, writing a 400 on failure.
+func validateMemory(w http.ResponseWriter, m model.Memory) bool {
+	switch {
+	case m.Scope == model.MemoryScopePersona && m.PersonaID == 0:
+		ErrorResponse(w, http.StatusBadRequest, "persona scope requires persona_id")
+	case m.Scope == model.MemoryScopeProject && m.ProjectID == 0:
+		ErrorResponse(w, http.StatusBadRequest, "project scope requires project_id")
+	case m.Scope == model.MemoryScopeChannel && m.ChannelID == 0:
+		ErrorResponse(w, http.StatusBadRequest, "channel scope requires channel_id")
+	case m.Scope != model.MemoryScopePersona && m.Scope != model.MemoryScopeProject && m.Scope != model.MemoryScopeChannel:
+		ErrorResponse(w, http.StatusBadRequest, "scope must be persona, project or channel")
+	case strings.TrimSpace(m.Title) == "":
+		ErrorResponse(w, http.StatusBadRequest, "title is required")
+	case strings.TrimSpace(m.Content) == "":
+		ErrorResponse(w, http.StatusBadRequest, "content is required")
+	case m.SourcePath != "" && m.Scope != model.MemoryScopeProject:
+		ErrorResponse(w, http.StatusBadRequest, "memories stored in project files must stay project-scoped")
+	default:
+		return true
+	}
+	return false
+}
+
+func (h *MemoryHandler) lookupMemory(w http.ResponseWriter, r *http.Request) (model.Memory, bool) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return model.Memory{}, false
+	}
+	m, err := model.GetMemory(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "memory not found")
+			return model.Memory{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Memory{}, false
+	}
+	return m, true
+}
+
+// ListMemories handles GET /api/memories. It filters by scope, persona_id,
+// project_id and channel_id; with q the results are ranked against the
+// query instead of listed oldest first.
+func (h *MemoryHandler) ListMemories(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var filter model.MemoryFilter
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"persona_id", &filter.PersonaID},
+		{"project_id", &filter.ProjectID},
+		{"channel_id", &filter.ChannelID},
+	} {
+		if v := q.Get(p.name); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				ErrorResponse(w, http.StatusBadRequest, "invalid "+p.name)
+				return
+			}
+			*p.dst = id
+		}
+	}
+	filter.Scope = q.Get("scope")
+	filter.IncludeExpired = q.Get("include_expired") == "true"
+	limit, offset := parsePagination(r, 50, 200)
+
+	if query := strings.TrimSpace(q.Get("q")); query != "" {
+		results, err := h.Store.Search(r.Context(), query, filter, limit)
+		if err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		out := make([]memoryJSON, len(results))
+		for i, res := range results {
+			out[i] = toMemoryJSON(res.Memory)
+			out[i].Score = &res.Score
+		}
+		WriteJSON(w, http.StatusOK, out)
+		return
+	}
+
+	filter.Limit, filter.Offset = limit, offset
+	memories, err := model.ListMemories(h.DB, filter)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]memoryJSON, len(memories))
+	for i, m := range memories {
+		out[i] = toMemoryJSON(m)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetMemory handles GET /api/memories/{id}.
+func (h *MemoryHandler) GetMemory(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.lookupMemory(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, toMemoryJSON(m))
+}
+
+// CreateMemory handles POST /api/memories.
+func (h *MemoryHandler) CreateMemory(w http.ResponseWriter, r *http.Request) {
+	var req createMemoryRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	expires, ok := parseOptionalTime(req.ExpiresAt)
+	if !ok {
+		ErrorResponse(w, http.StatusBadRequest, "expires_at must be an RFC 3339 time")
+		return
+	}
+
+	m := model.Memory{
+		Scope:     req.Scope,
+		PersonaID: req.PersonaID,
+		ProjectID: req.ProjectID,
+		ChannelID: req.ChannelID,
+		Title:     strings.TrimSpace(req.Title),
+		Content:   req.Content,
+		ExpiresAt: expires,
+	}
+	if !validateMemory(w, m) {
+		return
+	}
+
+	m, err := h.Store.Save(r.Context(), m)
+	if err != nil {
+		if strings.Contains(err.Error(), "FOREIGN KEY") {
+			ErrorResponse(w, http.StatusBadRequest, "persona, project or channel not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "memories/"+strconv.FormatInt(m.ID, 10), nil, toMemoryJSON(m))
+	WriteJSON(w, http.StatusCreated, toMemoryJSON(m))
+}
+
+// UpdateMemory handles PUT /api/memories/{id}. Editing a memory backed by a
+// markdown file rewrites the file too.
+func (h *MemoryHandler) UpdateMemory(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.lookupMemory(w, r)
+	if !ok {
+		return
+	}
+	before := m
+
+	var req updateMemoryRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Scope != nil {
+		m.Scope = *req.Scope
+	}
+	if req.PersonaID != nil {
+		m.PersonaID = *req.PersonaID
+	}
+	if req.ProjectID != nil {
+		if m.SourcePath != "" && *req.ProjectID != m.ProjectID {
+			ErrorResponse(w, http.StatusBadRequest, "memories stored in project files cannot move to another project")
+			return
+		}
+		m.ProjectID = *req.ProjectID
+	}
+	if req.ChannelID != nil {
+		m.ChannelID = *req.ChannelID
+	}
+	if req.Title != nil {
+		m.Title = strings.TrimSpace(*req.Title)
+	}
+	contentChanged := req.Content != nil && *req.Content != m.Content
+	if req.Content != nil {
+		m.Content = *req.Content
+	}
+	if req.ExpiresAt != nil {
+		expires, ok := parseOptionalTime(*req.ExpiresAt)
+		if !ok {
+			ErrorResponse(w, http.StatusBadRequest, "expires_at must be an RFC 3339 time")
+			return
+		}
+		m.ExpiresAt = expires
+	}
+	if !validateMemory(w, m) {
+		return
+	}
+
+	if contentChanged && m.SourcePath != "" {
+		path, ok := h.memoryFilePath(w, m)
+		if !ok {
+			return
+		}
+		if err := writeProjectFile(path, m.Content); err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	m, err := h.Store.Update(r.Context(), m)
+	if err != nil {
+		if strings.Contains(err.Error(), "FOREIGN KEY") {
+			ErrorResponse(w, http.StatusBadRequest, "persona, project or channel not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "", toMemoryJSON(before), toMemoryJSON(m))
+	WriteJSON(w, http.StatusOK, toMemoryJSON(m))
+}
+
+// DeleteMemory handles DELETE /api/memories/{id}, removing the memory's
+// markdown file if it has one.
+func (h *MemoryHandler) DeleteMemory(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.lookupMemory(w, r)
+	if !ok {
+		return
+	}
+
+	if m.SourcePath != "" {
+		path, ok := h.memoryFilePath(w, m)
+		if !ok {
+			return
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			ErrorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := model.DeleteMemory(h.DB, m.ID); err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "", toMemoryJSON(m), nil)
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// memoryFilePath resolves a file-backed memory's path in the directory it
+// was indexed from, or in its project for memories without one.
+func (h *MemoryHandler) memoryFilePath(w http.ResponseWriter, m model.Memory) (string, bool) {
+	dir := m.SourceDir
+	if dir == "" {
+		p, err := model.GetProject(h.DB, m.ProjectID)
+		if err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, "internal error")
+			return "", false
+		}
+		dir = p.Path
+	}
+	path, err := projectFilePath(dir, m.SourcePath)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return path, true
+}
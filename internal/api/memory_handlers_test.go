@@ -0,0 +1,112 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestMemoryCRUD(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Coder", "You code.")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	rec := doJSON(t, router, "POST", "/api/memories",
+		fmt.Sprintf(`{"scope":"persona","persona_id":%d,"title":"style","content":"Prefer table-driven tests."}`, personaID), auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID             int64  `json:"id"`
+		Scope          string `json:"scope"`
+		EmbeddingModel string `json:"embedding_model"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.Scope != "persona" || created.EmbeddingModel == "" {
+		t.Errorf("unexpected memory: %+v", created)
+	}
+
+	rec = doJSON(t, router, "POST", "/api/memories", `{"scope":"project","title":"x","content":"y"}`, auth...)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("project scope without project_id status = %d, want 400", rec.Code)
+	}
+
+	rec = doJSON(t, router, "PUT", fmt.Sprintf("/api/memories/%d", created.ID),
+		`{"content":"Prefer table-driven tests with t.Run.","expires_at":"2099-01-01T00:00:00Z"}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	got, _ := model.GetMemory(d, created.ID)
+	if got.Content != "Prefer table-driven tests with t.Run." || got.ExpiresAt == nil {
+		t.Errorf("unexpected memory after update: %+v", got)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/memories?persona_id=%d&q=table+tests", personaID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("search status = %d", rec.Code)
+	}
+	var results []struct {
+		ID    int64    `json:"id"`
+		Score *float64 `json:"score"`
+	}
+	json.NewDecoder(rec.Body).Decode(&results)
+	if len(results) != 1 || results[0].ID != created.ID || results[0].Score == nil {
+		t.Errorf("unexpected search results: %+v", results)
+	}
+
+	rec = doJSON(t, router, "DELETE", fmt.Sprintf("/api/memories/%d", created.ID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/memories/%d", created.ID), "", auth...)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete status = %d, want 404", rec.Code)
+	}
+}
+
+func TestMemoryFileBackedEdits(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	dir := t.TempDir()
+	projectID := createProject(t, router, token, "proj", dir, "")
+	os.MkdirAll(filepath.Join(dir, "memories"), 0o755)
+	path := filepath.Join(dir, "memories", "ports.md")
+	os.WriteFile(path, []byte("API listens on 8080."), 0o644)
+	m, err := model.CreateMemory(d, model.Memory{
+		ProjectID: projectID, Title: "ports", Content: "API listens on 8080.", SourcePath: "memories/ports.md",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doJSON(t, router, "PUT", fmt.Sprintf("/api/memories/%d", m.ID), `{"scope":"persona","persona_id":1}`, auth...)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("rescoping a file-backed memory status = %d, want 400", rec.Code)
+	}
+
+	rec = doJSON(t, router, "PUT", fmt.Sprintf("/api/memories/%d", m.ID), `{"content":"API listens on 9090."}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "API listens on 9090." {
+		t.Errorf("memory file = %q", data)
+	}
+
+	rec = doJSON(t, router, "DELETE", fmt.Sprintf("/api/memories/%d", m.ID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected memory file removed")
+	}
+}
@@ -0,0 +1,67 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/api"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	channelID := createChannel(t, router, token, "general", "")
+
+	doJSON(t, router, "GET", fmt.Sprintf("/api/channels/%d/messages", channelID), "", "Authorization", "Bearer "+token)
+	doJSON(t, router, "GET", "/no/such/route", "")
+
+	if rec := doJSON(t, router, "GET", "/metrics", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("metrics without auth = %d, want 401", rec.Code)
+	}
+
+	rec := doJSON(t, router, "GET", "/metrics", "", "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("metrics = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`waynebot_http_requests_total{method="GET",route="/api/channels/{id}/messages",code="200"}`,
+		`waynebot_http_requests_total{method="GET",route="unmatched",code="404"}`,
+		`waynebot_http_request_duration_seconds_bucket{method="POST",route="/api/auth/register",le="+Inf"}`,
+		`waynebot_db_write_lock_wait_seconds_count`,
+		`# TYPE waynebot_llm_call_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	d := openTestDB(t)
+	hub := ws.NewHub()
+	go hub.Run()
+	t.Cleanup(func() { hub.Stop() })
+	router := api.NewRouter(d, []string{"*"}, "scrape-secret", hub)
+
+	for _, tc := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer scrape-secret", http.StatusOK},
+	} {
+		var headers []string
+		if tc.header != "" {
+			headers = []string{"Authorization", tc.header}
+		}
+		if rec := doJSON(t, router, "GET", "/metrics", "", headers...); rec.Code != tc.want {
+			t.Errorf("metrics with %q = %d, want %d", tc.header, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/events"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// maxBundleBytes bounds an imported persona bundle, documents included.
+const maxBundleBytes = 5 << 20
+
+type personaImportJSON struct {
+	Persona         personaJSON `json:"persona"`
+	Replaced        bool        `json:"replaced"`
+	Channels        []string    `json:"channels"`
+	MissingChannels []string    `json:"missing_channels"`
+	ChannelSettings int         `json:"channel_settings"`
+	Documents       int         `json:"documents"`
+}
+
+var bundleFilenameRe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// ExportPersona returns a persona as a portable bundle.
+func (h *PersonaHandler) ExportPersona(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	b, err := model.ExportPersonaBundle(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if b.ToolsEnabled == nil {
+		b.ToolsEnabled = []string{}
+	}
+
+	filename := strings.Trim(bundleFilenameRe.ReplaceAllString(strings.ToLower(b.Name), "-"), "-")
+	if filename == "" {
+		filename = "persona"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+	WriteJSON(w, http.StatusOK, b)
+}
+
+// ImportPersona creates a persona from a bundle. The on_conflict query
+// parameter decides what happens when the name is taken: error (409, the
+// default), rename or replace.
+func (h *PersonaHandler) ImportPersona(w http.ResponseWriter, r *http.Request) {
+	onConflict := r.URL.Query().Get("on_conflict")
+	switch onConflict {
+	case "":
+		onConflict = model.ImportConflictError
+	case model.ImportConflictError, model.ImportConflictRename, model.ImportConflictReplace:
+	default:
+		ErrorResponse(w, http.StatusBadRequest, "on_conflict must be error, rename or replace")
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBundleBytes+1))
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "could not read body")
+		return
+	}
+	if len(data) > maxBundleBytes {
+		ErrorResponse(w, http.StatusRequestEntityTooLarge, "bundle too large")
+		return
+	}
+	b, err := model.ParsePersonaBundle(data)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if b.Name, err = validatePersonaRequest(b.Name, b.SystemPrompt); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, cs := range b.ChannelSettings {
+		err := validateChannelSettings(channelSettingsRequest{
+			Model:        cs.Model,
+			Temperature:  cs.Temperature,
+			MaxTokens:    cs.MaxTokens,
+			CooldownSecs: cs.CooldownSecs,
+			ReplyMode:    cs.ReplyMode,
+			ToolsEnabled: cs.ToolsEnabled,
+			ExtraPrompt:  cs.ExtraPrompt,
+		})
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("channel settings for %q: %v", cs.Channel, err))
+			return
+		}
+	}
+	for i, doc := range b.Documents {
+		if strings.TrimSpace(doc.Title) == "" || strings.TrimSpace(doc.Content) == "" {
+			ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("document %d needs a title and content", i+1))
+			return
+		}
+	}
+
+	// A replace overwrites the persona of the same name; keep its state
+	// for the audit log.
+	var existing *model.Persona
+	if onConflict == model.ImportConflictReplace {
+		p, err := model.GetPersonaByName(h.DB, b.Name)
+		switch {
+		case err == nil:
+			existing = &p
+		case !errors.Is(err, sql.ErrNoRows):
+			ErrorResponse(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+
+	res, err := model.ImportPersonaBundle(h.DB, b, onConflict)
+	if err != nil {
+		if errors.Is(err, model.ErrPersonaExists) || strings.Contains(err.Error(), "UNIQUE") {
+			ErrorResponse(w, http.StatusConflict, "persona name already taken")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if res.Replaced {
+		h.Events.Publish(events.Event{Type: events.PersonaUpdated, PersonaID: res.Persona.ID})
+	} else {
+		h.Events.Publish(events.Event{Type: events.PersonaCreated, PersonaID: res.Persona.ID})
+	}
+	var before any
+	if res.Replaced && existing != nil {
+		before = toPersonaJSON(*existing)
+	}
+	auditChange(r, fmt.Sprintf("personas/%d", res.Persona.ID), before, toPersonaJSON(res.Persona))
+
+	out := personaImportJSON{
+		Persona:         toPersonaJSON(res.Persona),
+		Replaced:        res.Replaced,
+		Channels:        res.Channels,
+		MissingChannels: res.MissingChannels,
+		ChannelSettings: res.ChannelSettings,
+		Documents:       res.Documents,
+	}
+	if out.Channels == nil {
+		out.Channels = []string{}
+	}
+	if out.MissingChannels == nil {
+		out.MissingChannels = []string{}
+	}
+	status := http.StatusCreated
+	if res.Replaced {
+		status = http.StatusOK
+	}
+	WriteJSON(w, status, out)
+}
@@ -0,0 +1,132 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/api"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+func TestPersonaExportImport(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	id := createPersona(t, router, token, "Code Reviewer", "Review code.")
+	chID := createChannel(t, router, token, "general", "")
+	rec := doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/members", chID), fmt.Sprintf(`{"persona_id":%d}`, id), auth...)
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("add member: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/personas/%d/export", id), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="code-reviewer.json"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	bundle := rec.Body.String()
+	var exported struct {
+		Format   int      `json:"format"`
+		Name     string   `json:"name"`
+		Channels []string `json:"channels"`
+	}
+	json.Unmarshal([]byte(bundle), &exported)
+	if exported.Format != 1 || exported.Name != "Code Reviewer" || len(exported.Channels) != 1 {
+		t.Fatalf("exported = %+v", exported)
+	}
+
+	rec = doJSON(t, router, "POST", "/api/personas/import", bundle, auth...)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("import duplicate: status = %d, want 409", rec.Code)
+	}
+
+	rec = doJSON(t, router, "POST", "/api/personas/import?on_conflict=rename", bundle, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("import rename: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var imported struct {
+		Persona struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"persona"`
+		Channels        []string `json:"channels"`
+		MissingChannels []string `json:"missing_channels"`
+	}
+	json.NewDecoder(rec.Body).Decode(&imported)
+	if imported.Persona.Name != "Code Reviewer (2)" || len(imported.Channels) != 1 || len(imported.MissingChannels) != 0 {
+		t.Errorf("imported = %+v", imported)
+	}
+
+	rec = doJSON(t, router, "POST", "/api/personas/import?on_conflict=replace", bundle, auth...)
+	if rec.Code != http.StatusOK {
+		t.Errorf("import replace: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPersonaImportValidation(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	cases := []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/personas/import", `{"format":2,"name":"x","system_prompt":"p"}`, http.StatusBadRequest},
+		{"/api/personas/import", `{"format":1,"name":"x","system_prompt":"p","extra":true}`, http.StatusBadRequest},
+		{"/api/personas/import", `{"format":1,"name":"","system_prompt":"p"}`, http.StatusBadRequest},
+		{"/api/personas/import", `{"format":1,"name":"x","system_prompt":"p","documents":[{"title":"","content":"c"}]}`, http.StatusBadRequest},
+		{"/api/personas/import?on_conflict=merge", `{"format":1,"name":"x","system_prompt":"p"}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		rec := doJSON(t, router, "POST", c.path, c.body, auth...)
+		if rec.Code != c.want {
+			t.Errorf("%s %s: status = %d, want %d", c.path, c.body, rec.Code, c.want)
+		}
+	}
+
+	rec := doJSON(t, router, "GET", "/api/personas/999/export", "", auth...)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("export missing: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestListPersonaTemplatesFromDir(t *testing.T) {
+	d := openTestDB(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "triager.json"),
+		[]byte(`{"format":1,"name":"Triager","description":"Sorts issues","system_prompt":"Triage.","model":"m","tools_enabled":["http_fetch"]}`), 0o644)
+
+	hub := ws.NewHub()
+	go hub.Run()
+	t.Cleanup(func() { hub.Stop() })
+	sup := agent.NewSupervisor(d, hub, idleLLM{}, tools.NewRegistry())
+	sup.TemplateDir = dir
+	router := api.NewRouter(d, []string{"*"}, "", hub, sup)
+	token := registerUser(t, router, "alice", "password123", "")
+
+	rec := doJSON(t, router, "GET", "/api/personas/templates", "", "Authorization", "Bearer "+token)
+	var templates []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	json.NewDecoder(rec.Body).Decode(&templates)
+	last := templates[len(templates)-1]
+	if last.Name != "Triager" || last.Description != "Sorts issues" {
+		t.Errorf("last template = %+v, want Triager from the template dir", last)
+	}
+	if len(templates) < 4 {
+		t.Errorf("got %d templates, want the built-ins too", len(templates))
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+type channelSettingsRequest struct {
+	Model        *string  `json:"model"`
+	Temperature  *float64 `json:"temperature"`
+	MaxTokens    *int     `json:"max_tokens"`
+	CooldownSecs *int     `json:"cooldown_secs"`
+	ReplyMode    string   `json:"reply_mode"`
+	ToolsEnabled []string `json:"tools_enabled"`
+	ExtraPrompt  string   `json:"extra_prompt"`
+}
+
+type effectiveSettingsJSON struct {
+	Model        string   `json:"model"`
+	Temperature  float64  `json:"temperature"`
+	MaxTokens    int      `json:"max_tokens"`
+	CooldownSecs int      `json:"cooldown_secs"`
+	ReplyMode    string   `json:"reply_mode"`
+	ToolsEnabled []string `json:"tools_enabled"`
+	SystemPrompt string   `json:"system_prompt"`
+}
+
+// channelSettingsJSON is a persona's overrides for a channel; null fields
+// inherit the persona's settings. Effective is the persona as it runs there.
+type channelSettingsJSON struct {
+	PersonaID    int64                 `json:"persona_id"`
+	ChannelID    int64                 `json:"channel_id"`
+	Model        *string               `json:"model"`
+	Temperature  *float64              `json:"temperature"`
+	MaxTokens    *int                  `json:"max_tokens"`
+	CooldownSecs *int                  `json:"cooldown_secs"`
+	ReplyMode    string                `json:"reply_mode"`
+	ToolsEnabled []string              `json:"tools_enabled"`
+	ExtraPrompt  string                `json:"extra_prompt"`
+	UpdatedAt    string                `json:"updated_at,omitempty"`
+	Effective    effectiveSettingsJSON `json:"effective"`
+}
+
+func toChannelSettingsJSON(s model.PersonaChannelSettings, p model.Persona) channelSettingsJSON {
+	eff := s.Apply(p)
+	tools := eff.ToolsEnabled
+	if tools == nil {
+		tools = []string{}
+	}
+	out := channelSettingsJSON{
+		PersonaID:    s.PersonaID,
+		ChannelID:    s.ChannelID,
+		Model:        s.Model,
+		Temperature:  s.Temperature,
+		MaxTokens:    s.MaxTokens,
+		CooldownSecs: s.CooldownSecs,
+		ReplyMode:    s.ReplyMode,
+		ToolsEnabled: s.ToolsEnabled,
+		ExtraPrompt:  s.ExtraPrompt,
+		Effective: effectiveSettingsJSON{
+			Model:        eff.Model,
+			Temperature:  eff.Temperature,
+			MaxTokens:    eff.MaxTokens,
+			CooldownSecs: eff.CooldownSecs,
+			ReplyMode:    s.EffectiveReplyMode(),
+			ToolsEnabled: tools,
+			SystemPrompt: eff.SystemPrompt,
+		},
+	}
+	if !s.UpdatedAt.IsZero() {
+		out.UpdatedAt = s.UpdatedAt.Format(time.RFC3339)
+	}
+	return out
+}
+
+func validateChannelSettings(req channelSettingsRequest) error {
+	if req.Model != nil && strings.TrimSpace(*req.Model) == "" {
+		return &validationError{"model must not be empty; use null to inherit"}
+	}
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		return &validationError{"temperature must be between 0 and 2"}
+	}
+	if req.MaxTokens != nil && *req.MaxTokens < 1 {
+		return &validationError{"max_tokens must be positive"}
+	}
+	if req.CooldownSecs != nil && *req.CooldownSecs < 0 {
+		return &validationError{"cooldown_secs must not be negative"}
+	}
+	if req.ReplyMode != "" && !model.ValidReplyMode(req.ReplyMode) {
+		return &validationError{"reply_mode must be always, mention_only or never"}
+	}
+	if len(req.ExtraPrompt) > 10000 {
+		return &validationError{"extra_prompt must be at most 10000 characters"}
+	}
+	return nil
+}
+
+// personaAndChannel loads the persona and channel named by the request,
+// writing a 404 if either doesn't exist.
+func (h *PersonaHandler) personaAndChannel(w http.ResponseWriter, r *http.Request) (model.Persona, model.Channel, bool) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return model.Persona{}, model.Channel{}, false
+	}
+	channelID, ok := ParseIntParam(w, r, "channel_id")
+	if !ok {
+		return model.Persona{}, model.Channel{}, false
+	}
+	p, err := model.GetPersona(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+			return model.Persona{}, model.Channel{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Persona{}, model.Channel{}, false
+	}
+	ch, err := model.GetChannel(h.DB, channelID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "channel not found")
+			return model.Persona{}, model.Channel{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Persona{}, model.Channel{}, false
+	}
+	return p, ch, true
+}
+
+// ListChannelSettings returns a persona's overrides for every channel that
+// has them.
+func (h *PersonaHandler) ListChannelSettings(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	p, err := model.GetPersona(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	settings, err := model.ListPersonaChannelSettings(h.DB, id)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]channelSettingsJSON, len(settings))
+	for i, s := range settings {
+		out[i] = toChannelSettingsJSON(s, p)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetChannelSettings returns a persona's overrides for a channel. A channel
+// without overrides returns null fields and the persona's own settings.
+func (h *PersonaHandler) GetChannelSettings(w http.ResponseWriter, r *http.Request) {
+	p, ch, ok := h.personaAndChannel(w, r)
+	if !ok {
+		return
+	}
+	s, err := model.ResolvePersonaChannelSettings(h.DB, p.ID, ch.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	WriteJSON(w, http.StatusOK, toChannelSettingsJSON(s, p))
+}
+
+// SetChannelSettings replaces a persona's overrides for a channel.
+func (h *PersonaHandler) SetChannelSettings(w http.ResponseWriter, r *http.Request) {
+	p, ch, ok := h.personaAndChannel(w, r)
+	if !ok {
+		return
+	}
+
+	var req channelSettingsRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateChannelSettings(req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	before, err := model.ResolvePersonaChannelSettings(h.DB, p.ID, ch.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := model.SetPersonaChannelSettings(h.DB, model.PersonaChannelSettings{
+		PersonaID:    p.ID,
+		ChannelID:    ch.ID,
+		Model:        req.Model,
+		Temperature:  req.Temperature,
+		MaxTokens:    req.MaxTokens,
+		CooldownSecs: req.CooldownSecs,
+		ReplyMode:    req.ReplyMode,
+		ToolsEnabled: req.ToolsEnabled,
+		ExtraPrompt:  req.ExtraPrompt,
+	}); err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	s, err := model.GetPersonaChannelSettings(h.DB, p.ID, ch.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "", toChannelSettingsJSON(before, p), toChannelSettingsJSON(s, p))
+	WriteJSON(w, http.StatusOK, toChannelSettingsJSON(s, p))
+}
+
+// DeleteChannelSettings removes a persona's overrides for a channel.
+func (h *PersonaHandler) DeleteChannelSettings(w http.ResponseWriter, r *http.Request) {
+	p, ch, ok := h.personaAndChannel(w, r)
+	if !ok {
+		return
+	}
+	before, err := model.ResolvePersonaChannelSettings(h.DB, p.ID, ch.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := model.DeletePersonaChannelSettings(h.DB, p.ID, ch.ID); err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "", toChannelSettingsJSON(before, p), nil)
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
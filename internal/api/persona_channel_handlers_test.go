@@ -0,0 +1,109 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestPersonaChannelSettingsEndpoints(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	id := createPersona(t, router, token, "Reviewer", "Review code.")
+	chID := createChannel(t, router, token, "alerts", "")
+	path := fmt.Sprintf("/api/personas/%d/channel-settings/%d", id, chID)
+
+	type settings struct {
+		ChannelID    int64    `json:"channel_id"`
+		Model        *string  `json:"model"`
+		MaxTokens    *int     `json:"max_tokens"`
+		ReplyMode    string   `json:"reply_mode"`
+		ToolsEnabled []string `json:"tools_enabled"`
+		Effective    struct {
+			Model        string `json:"model"`
+			MaxTokens    int    `json:"max_tokens"`
+			ReplyMode    string `json:"reply_mode"`
+			SystemPrompt string `json:"system_prompt"`
+		} `json:"effective"`
+	}
+
+	rec := doJSON(t, router, "GET", path, "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var got settings
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.Model != nil || got.Effective.Model != "gpt-4" || got.Effective.ReplyMode != "always" {
+		t.Errorf("defaults = %+v", got)
+	}
+
+	rec = doJSON(t, router, "PUT", path, `{"max_tokens":200,"reply_mode":"mention_only","extra_prompt":"Be terse."}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	got = settings{}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.MaxTokens == nil || *got.MaxTokens != 200 || got.ToolsEnabled != nil {
+		t.Errorf("stored = %+v", got)
+	}
+	if got.Effective.MaxTokens != 200 || got.Effective.ReplyMode != "mention_only" || got.Effective.SystemPrompt != "Review code.\n\nBe terse." {
+		t.Errorf("effective = %+v", got.Effective)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/personas/%d/channel-settings", id), "", auth...)
+	var list []settings
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].ChannelID != chID {
+		t.Errorf("list = %+v", list)
+	}
+
+	rec = doJSON(t, router, "DELETE", path, "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Errorf("delete: status = %d", rec.Code)
+	}
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/personas/%d/channel-settings", id), "", auth...)
+	list = nil
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("after delete: %d settings", len(list))
+	}
+}
+
+func TestPersonaChannelSettingsValidation(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	id := createPersona(t, router, token, "Reviewer", "Review code.")
+	chID := createChannel(t, router, token, "alerts", "")
+	path := fmt.Sprintf("/api/personas/%d/channel-settings/%d", id, chID)
+
+	for _, body := range []string{
+		`{"reply_mode":"sometimes"}`,
+		`{"temperature":3}`,
+		`{"max_tokens":0}`,
+		`{"cooldown_secs":-1}`,
+		`{"model":" "}`,
+		`{"unknown":1}`,
+	} {
+		rec := doJSON(t, router, "PUT", path, body, auth...)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	for _, p := range []string{
+		fmt.Sprintf("/api/personas/999/channel-settings/%d", chID),
+		fmt.Sprintf("/api/personas/%d/channel-settings/999", id),
+	} {
+		rec := doJSON(t, router, "GET", p, "", auth...)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want 404", p, rec.Code)
+		}
+	}
+}
@@ -2,17 +2,26 @@ package api
 
 import (
 	"database/sql"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/events"
 	"github.com/waynenilsen/waynebot/internal/model"
 )
 
 // PersonaHandler handles persona HTTP endpoints.
 type PersonaHandler struct {
 	DB *db.DB
+	// Events, when set, is told about personas being created, changed and
+	// deleted, so running actors follow.
+	Events *events.Bus
+	// TemplateDir, when set, holds persona bundles listed as templates
+	// after the built-ins.
+	TemplateDir string
 }
 
 type createPersonaRequest struct {
@@ -36,6 +45,7 @@ type personaJSON struct {
 	MaxTokens        int      `json:"max_tokens"`
 	CooldownSecs     int      `json:"cooldown_secs"`
 	MaxTokensPerHour int      `json:"max_tokens_per_hour"`
+	Version          int      `json:"version"`
 	CreatedAt        string   `json:"created_at"`
 }
 
@@ -54,6 +64,7 @@ func toPersonaJSON(p model.Persona) personaJSON {
 		MaxTokens:        p.MaxTokens,
 		CooldownSecs:     p.CooldownSecs,
 		MaxTokensPerHour: p.MaxTokensPerHour,
+		Version:          p.Version,
 		CreatedAt:        p.CreatedAt.Format(time.RFC3339),
 	}
 }
@@ -75,9 +86,21 @@ type validationError struct {
 
 func (e *validationError) Error() string { return e.msg }
 
-// ListTemplates returns the built-in persona templates.
+// ListTemplates returns the built-in persona templates followed by those in
+// the template directory. The directory is read on every request so new
+// files show up without a restart.
 func (h *PersonaHandler) ListTemplates(w http.ResponseWriter, _ *http.Request) {
-	WriteJSON(w, http.StatusOK, model.PersonaTemplates())
+	templates := model.PersonaTemplates()
+	if h.TemplateDir != "" {
+		bundles, err := model.LoadPersonaTemplates(h.TemplateDir)
+		if err != nil {
+			slog.Error("persona: load templates", "dir", h.TemplateDir, "error", err)
+		}
+		for _, b := range bundles {
+			templates = append(templates, b.Template())
+		}
+	}
+	WriteJSON(w, http.StatusOK, templates)
 }
 
 // ListPersonas returns all personas.
@@ -121,6 +144,8 @@ func (h *PersonaHandler) CreatePersona(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	h.Events.Publish(events.Event{Type: events.PersonaCreated, PersonaID: p.ID})
+	auditChange(r, fmt.Sprintf("personas/%d", p.ID), nil, toPersonaJSON(p))
 
 	WriteJSON(w, http.StatusCreated, toPersonaJSON(p))
 }
@@ -132,8 +157,8 @@ func (h *PersonaHandler) UpdatePersona(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify persona exists.
-	if _, err := model.GetPersona(h.DB, id); err != nil {
+	before, err := model.GetPersona(h.DB, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			ErrorResponse(w, http.StatusNotFound, "persona not found")
 			return
@@ -167,11 +192,14 @@ func (h *PersonaHandler) UpdatePersona(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.Events.Publish(events.Event{Type: events.PersonaUpdated, PersonaID: id})
+
 	p, err := model.GetPersona(h.DB, id)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, "", toPersonaJSON(before), toPersonaJSON(p))
 
 	WriteJSON(w, http.StatusOK, toPersonaJSON(p))
 }
@@ -183,7 +211,8 @@ func (h *PersonaHandler) DeletePersona(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := model.GetPersona(h.DB, id); err != nil {
+	p, err := model.GetPersona(h.DB, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			ErrorResponse(w, http.StatusNotFound, "persona not found")
 			return
@@ -196,6 +225,8 @@ func (h *PersonaHandler) DeletePersona(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	h.Events.Publish(events.Event{Type: events.PersonaDeleted, PersonaID: id})
+	auditChange(r, "", toPersonaJSON(p), nil)
 
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/waynenilsen/waynebot/internal/events"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+type personaVersionJSON struct {
+	PersonaID        int64    `json:"persona_id"`
+	Version          int      `json:"version"`
+	Name             string   `json:"name"`
+	SystemPrompt     string   `json:"system_prompt"`
+	Model            string   `json:"model"`
+	ToolsEnabled     []string `json:"tools_enabled"`
+	Temperature      float64  `json:"temperature"`
+	MaxTokens        int      `json:"max_tokens"`
+	CooldownSecs     int      `json:"cooldown_secs"`
+	MaxTokensPerHour int      `json:"max_tokens_per_hour"`
+	CreatedAt        string   `json:"created_at"`
+}
+
+func toPersonaVersionJSON(v model.PersonaVersion) personaVersionJSON {
+	tools := v.ToolsEnabled
+	if tools == nil {
+		tools = []string{}
+	}
+	return personaVersionJSON{
+		PersonaID:        v.PersonaID,
+		Version:          v.Version,
+		Name:             v.Name,
+		SystemPrompt:     v.SystemPrompt,
+		Model:            v.Model,
+		ToolsEnabled:     tools,
+		Temperature:      v.Temperature,
+		MaxTokens:        v.MaxTokens,
+		CooldownSecs:     v.CooldownSecs,
+		MaxTokensPerHour: v.MaxTokensPerHour,
+		CreatedAt:        v.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+type personaFieldChangeJSON struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type personaVersionDiffJSON struct {
+	PersonaID        int64                    `json:"persona_id"`
+	From             int                      `json:"from"`
+	To               int                      `json:"to"`
+	Changes          []personaFieldChangeJSON `json:"changes"`
+	SystemPromptDiff string                   `json:"system_prompt_diff"`
+}
+
+// personaVersion loads one version named by the request, writing a 404 if
+// it doesn't exist.
+func (h *PersonaHandler) personaVersion(w http.ResponseWriter, personaID int64, raw string) (model.PersonaVersion, bool) {
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 1 {
+		ErrorResponse(w, http.StatusBadRequest, "invalid version")
+		return model.PersonaVersion{}, false
+	}
+	v, err := model.GetPersonaVersion(h.DB, personaID, version)
+	if err == sql.ErrNoRows {
+		ErrorResponse(w, http.StatusNotFound, "version not found")
+		return model.PersonaVersion{}, false
+	}
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.PersonaVersion{}, false
+	}
+	return v, true
+}
+
+// ListVersions returns a persona's saved versions, newest first.
+func (h *PersonaHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, err := model.GetPersona(h.DB, id); err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "persona not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	versions, err := model.ListPersonaVersions(h.DB, id)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]personaVersionJSON, len(versions))
+	for i, v := range versions {
+		out[i] = toPersonaVersionJSON(v)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetVersion returns one saved version of a persona.
+func (h *PersonaHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	v, ok := h.personaVersion(w, id, chi.URLParam(r, "version"))
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, toPersonaVersionJSON(v))
+}
+
+// DiffVersions compares two versions of a persona given by the from and to
+// query parameters.
+func (h *PersonaHandler) DiffVersions(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	from, ok := h.personaVersion(w, id, r.URL.Query().Get("from"))
+	if !ok {
+		return
+	}
+	to, ok := h.personaVersion(w, id, r.URL.Query().Get("to"))
+	if !ok {
+		return
+	}
+
+	changes, promptDiff := model.DiffPersonaVersions(from, to)
+	out := personaVersionDiffJSON{
+		PersonaID:        id,
+		From:             from.Version,
+		To:               to.Version,
+		Changes:          make([]personaFieldChangeJSON, len(changes)),
+		SystemPromptDiff: promptDiff,
+	}
+	for i, c := range changes {
+		out.Changes[i] = personaFieldChangeJSON{Field: c.Field, From: c.From, To: c.To}
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// RollbackVersion restores a persona to an earlier version. The restored
+// configuration becomes a new version.
+func (h *PersonaHandler) RollbackVersion(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	v, ok := h.personaVersion(w, id, chi.URLParam(r, "version"))
+	if !ok {
+		return
+	}
+
+	before, err := model.GetPersona(h.DB, id)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	p, err := model.RollbackPersona(h.DB, id, v.Version)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			ErrorResponse(w, http.StatusConflict, "persona name already taken")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	h.Events.Publish(events.Event{Type: events.PersonaUpdated, PersonaID: id})
+	auditChange(r, "personas/"+strconv.FormatInt(id, 10), toPersonaJSON(before), toPersonaJSON(p))
+	WriteJSON(w, http.StatusOK, toPersonaJSON(p))
+}
@@ -0,0 +1,151 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestPersonaVersionEndpoints(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	id := createPersona(t, router, token, "helper", "Be brief.")
+	rec := doJSON(t, router, "PUT", fmt.Sprintf("/api/personas/%d", id),
+		`{"name":"helper","system_prompt":"Be thorough.","model":"gpt-4o","tools_enabled":[],"temperature":0.7,"max_tokens":1000,"cooldown_secs":5,"max_tokens_per_hour":10000}`,
+		auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var updated struct {
+		Version int `json:"version"`
+	}
+	json.NewDecoder(rec.Body).Decode(&updated)
+	if updated.Version != 2 {
+		t.Errorf("version after update = %d, want 2", updated.Version)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/personas/%d/versions", id), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var versions []struct {
+		Version      int    `json:"version"`
+		SystemPrompt string `json:"system_prompt"`
+		Model        string `json:"model"`
+	}
+	json.NewDecoder(rec.Body).Decode(&versions)
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Model != "gpt-4" {
+		t.Fatalf("versions = %+v", versions)
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/personas/%d/versions/1", id), "", auth...)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Be brief.") {
+		t.Errorf("get version 1: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/personas/%d/versions/diff?from=1&to=2", id), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("diff: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var diff struct {
+		Changes []struct {
+			Field string `json:"field"`
+			From  any    `json:"from"`
+			To    any    `json:"to"`
+		} `json:"changes"`
+		SystemPromptDiff string `json:"system_prompt_diff"`
+	}
+	json.NewDecoder(rec.Body).Decode(&diff)
+	if len(diff.Changes) != 2 || diff.Changes[0].Field != "model" || diff.Changes[0].To != "gpt-4o" {
+		t.Errorf("changes = %+v", diff.Changes)
+	}
+	if !strings.Contains(diff.SystemPromptDiff, "+Be thorough.") {
+		t.Errorf("system_prompt_diff = %q", diff.SystemPromptDiff)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/personas/%d/versions/1/rollback", id), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rollback: status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var rolled struct {
+		Version      int    `json:"version"`
+		SystemPrompt string `json:"system_prompt"`
+		Model        string `json:"model"`
+	}
+	json.NewDecoder(rec.Body).Decode(&rolled)
+	if rolled.Version != 3 || rolled.SystemPrompt != "Be brief." || rolled.Model != "gpt-4" {
+		t.Errorf("after rollback = %+v", rolled)
+	}
+}
+
+func TestPersonaVersionErrors(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+	id := createPersona(t, router, token, "helper", "prompt")
+
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/personas/999/versions", http.StatusNotFound},
+		{"GET", fmt.Sprintf("/api/personas/%d/versions/5", id), http.StatusNotFound},
+		{"GET", fmt.Sprintf("/api/personas/%d/versions/abc", id), http.StatusBadRequest},
+		{"GET", fmt.Sprintf("/api/personas/%d/versions/diff?from=1", id), http.StatusBadRequest},
+		{"GET", fmt.Sprintf("/api/personas/%d/versions/diff?from=1&to=4", id), http.StatusNotFound},
+		{"POST", fmt.Sprintf("/api/personas/%d/versions/7/rollback", id), http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rec := doJSON(t, router, c.method, c.path, "", auth...)
+		if rec.Code != c.want {
+			t.Errorf("%s %s: status = %d, want %d", c.method, c.path, rec.Code, c.want)
+		}
+	}
+}
+
+func TestAgentStatsByVersion(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+
+	p, _ := model.CreatePersona(d, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+	for _, v := range []int{1, 2, 2} {
+		if _, err := d.WriteExec(
+			`INSERT INTO llm_calls (persona_id, channel_id, persona_version, model, messages_json, response_json, prompt_tokens, completion_tokens)
+			 VALUES (?, ?, ?, 'model', '[]', '{}', 100, 50)`, p.ID, ch.ID, v); err != nil {
+			t.Fatalf("seed llm call: %v", err)
+		}
+	}
+
+	rec := doJSON(t, router, "GET", fmt.Sprintf("/api/agents/%d/stats?by_version=true", p.ID), "",
+		"Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var stats struct {
+		Versions []struct {
+			Version          int     `json:"version"`
+			Calls            int64   `json:"calls"`
+			AvgTokensPerCall float64 `json:"avg_tokens_per_call"`
+		} `json:"versions"`
+	}
+	json.NewDecoder(rec.Body).Decode(&stats)
+	if len(stats.Versions) != 2 {
+		t.Fatalf("versions = %+v, want 2", stats.Versions)
+	}
+	if stats.Versions[0].Version != 1 || stats.Versions[0].Calls != 1 {
+		t.Errorf("v1 = %+v", stats.Versions[0])
+	}
+	if stats.Versions[1].Version != 2 || stats.Versions[1].Calls != 2 || stats.Versions[1].AvgTokensPerCall != 150 {
+		t.Errorf("v2 = %+v", stats.Versions[1])
+	}
+}
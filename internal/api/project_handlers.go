@@ -2,6 +2,7 @@ package api
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -86,6 +87,7 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, fmt.Sprintf("projects/%d", p.ID), nil, toProjectJSON(p))
 
 	WriteJSON(w, http.StatusCreated, toProjectJSON(p))
 }
@@ -97,7 +99,8 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := model.GetProject(h.DB, id); err != nil {
+	before, err := model.GetProject(h.DB, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			ErrorResponse(w, http.StatusNotFound, "project not found")
 			return
@@ -142,6 +145,7 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, "", toProjectJSON(before), toProjectJSON(p))
 
 	WriteJSON(w, http.StatusOK, toProjectJSON(p))
 }
@@ -153,7 +157,8 @@ func (h *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := model.GetProject(h.DB, id); err != nil {
+	p, err := model.GetProject(h.DB, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			ErrorResponse(w, http.StatusNotFound, "project not found")
 			return
@@ -166,6 +171,7 @@ func (h *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	auditChange(r, "", toProjectJSON(p), nil)
 
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
@@ -76,6 +76,12 @@ func (h *ReactionHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	counts, _ := model.GetReactionCounts(h.DB, messageID, user.ID, "human")
+	// Adding a reaction twice changes nothing.
+	var before any = req
+	if added {
+		before = nil
+	}
+	auditChange(r, "", before, req)
 
 	if added && h.Hub != nil {
 		h.Hub.Broadcast(ws.Event{
@@ -126,6 +132,9 @@ func (h *ReactionHandler) RemoveReaction(w http.ResponseWriter, r *http.Request)
 	}
 
 	counts, _ := model.GetReactionCounts(h.DB, messageID, user.ID, "human")
+	if removed {
+		auditChange(r, "", req, nil)
+	}
 
 	if removed && h.Hub != nil {
 		h.Hub.Broadcast(ws.Event{
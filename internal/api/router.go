@@ -1,8 +1,10 @@
 package api
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,19 +13,24 @@ import (
 	"github.com/waynenilsen/waynebot/internal/agent"
 	"github.com/waynenilsen/waynebot/internal/auth"
 	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/metrics"
 	"github.com/waynenilsen/waynebot/internal/ws"
 )
 
 // NewRouter creates the main Chi router with all middleware and route groups.
-func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ...*agent.Supervisor) http.Handler {
+// metricsToken, if not empty, is accepted as a bearer token for /metrics in
+// place of a session.
+func NewRouter(database *db.DB, corsOrigins []string, metricsToken string, hub *ws.Hub, supervisor ...*agent.Supervisor) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RealIP)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   corsOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Webhook-Token"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -37,14 +44,21 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, "ok")
 	})
+	r.With(requireMetricsAuth(metricsToken)).Method(http.MethodGet, "/metrics", metrics.Handler())
 
 	ah := &AuthHandler{DB: database}
 	var sup *agent.Supervisor
 	if len(supervisor) > 0 {
 		sup = supervisor[0]
 	}
-	ch := &ChannelHandler{DB: database, Hub: hub, Supervisor: sup}
+	cmds := NewCommands(database, hub, sup)
+	ch := &ChannelHandler{DB: database, Hub: hub, Supervisor: sup, Commands: cmds}
+	cmdh := &CommandHandler{Commands: cmds}
 	ph := &PersonaHandler{DB: database}
+	if sup != nil {
+		ph.TemplateDir = sup.TemplateDir
+		ph.Events = sup.Events
+	}
 	ih := &InviteHandler{DB: database}
 	wh := &WsHandler{DB: database, Hub: hub}
 
@@ -53,6 +67,8 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 	uh := &UserHandler{DB: database}
 
 	r.Route("/api", func(r chi.Router) {
+		r.Use(AuditMiddleware(database))
+
 		r.Post("/auth/register", ah.Register)
 		r.Post("/auth/login", ah.Login)
 		r.With(auth.RequireAuth).Post("/auth/logout", ah.Logout)
@@ -64,6 +80,8 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 		r.With(auth.RequireAuth).Post("/channels/{id}/messages", ch.PostMessage)
 		r.With(auth.RequireAuth).Post("/channels/{id}/read", ch.MarkRead)
 
+		r.With(auth.RequireAuth).Get("/commands", cmdh.ListCommands)
+
 		r.With(auth.RequireAuth).Get("/channels/{id}/members", mh.ListMembers)
 		r.With(auth.RequireAuth).Post("/channels/{id}/members", mh.AddMember)
 		r.With(auth.RequireAuth).Delete("/channels/{id}/members", mh.RemoveMember)
@@ -73,6 +91,12 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 		r.With(auth.RequireAuth).Post("/channels/{id}/projects", cph.AddChannelProject)
 		r.With(auth.RequireAuth).Delete("/channels/{id}/projects/{projectID}", cph.RemoveChannelProject)
 
+		csh := &ChangesetHandler{DB: database, Hub: hub}
+		r.With(auth.RequireAuth).Get("/channels/{id}/changesets", csh.ListChangesets)
+		r.With(auth.RequireAuth).Get("/channels/{id}/changesets/{changesetID}", csh.GetChangeset)
+		r.With(auth.RequireAuth).Post("/channels/{id}/changesets/{changesetID}/apply", csh.ApplyChangeset)
+		r.With(auth.RequireAuth).Post("/channels/{id}/changesets/{changesetID}/reject", csh.RejectChangeset)
+
 		rh := &ReactionHandler{DB: database, Hub: hub}
 		r.With(auth.RequireAuth).Put("/channels/{id}/messages/{messageID}/reactions", rh.AddReaction)
 		r.With(auth.RequireAuth).Delete("/channels/{id}/messages/{messageID}/reactions", rh.RemoveReaction)
@@ -80,8 +104,23 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 		r.With(auth.RequireAuth).Get("/personas/templates", ph.ListTemplates)
 		r.With(auth.RequireAuth).Get("/personas", ph.ListPersonas)
 		r.With(auth.RequireAuth).Post("/personas", ph.CreatePersona)
+		r.With(auth.RequireAuth).Post("/personas/import", ph.ImportPersona)
 		r.With(auth.RequireAuth).Put("/personas/{id}", ph.UpdatePersona)
 		r.With(auth.RequireAuth).Delete("/personas/{id}", ph.DeletePersona)
+		r.With(auth.RequireAuth).Get("/personas/{id}/export", ph.ExportPersona)
+		r.With(auth.RequireAuth).Get("/personas/{id}/channel-settings", ph.ListChannelSettings)
+		r.With(auth.RequireAuth).Get("/personas/{id}/channel-settings/{channel_id}", ph.GetChannelSettings)
+		r.With(auth.RequireAuth).Put("/personas/{id}/channel-settings/{channel_id}", ph.SetChannelSettings)
+		r.With(auth.RequireAuth).Delete("/personas/{id}/channel-settings/{channel_id}", ph.DeleteChannelSettings)
+		r.With(auth.RequireAuth).Get("/personas/{id}/versions", ph.ListVersions)
+		r.With(auth.RequireAuth).Get("/personas/{id}/versions/diff", ph.DiffVersions)
+		r.With(auth.RequireAuth).Get("/personas/{id}/versions/{version}", ph.GetVersion)
+		r.With(auth.RequireAuth).Post("/personas/{id}/versions/{version}/rollback", ph.RollbackVersion)
+
+		evh := &EvalHandler{DB: database}
+		r.With(auth.RequireAuth).Get("/personas/{id}/evals", evh.PersonaEvals)
+		r.With(auth.RequireAuth).Get("/evals", evh.ListEvalRuns)
+		r.With(auth.RequireAuth).Get("/evals/{id}", evh.GetEvalRun)
 
 		prh := &ProjectHandler{DB: database}
 		r.With(auth.RequireAuth).Get("/projects", prh.ListProjects)
@@ -97,6 +136,51 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 		r.With(auth.RequireAuth).Post("/projects/{id}/documents/{type}/{filename}", doch.AppendDocument)
 		r.With(auth.RequireAuth).Delete("/projects/{id}/documents/{type}/{filename}", doch.DeleteDocument)
 
+		gith := &GitHandler{DB: database}
+		r.With(auth.RequireAuth).Get("/projects/{id}/persona-branches", gith.ListPersonaBranches)
+		r.With(auth.RequireAuth).Get("/projects/{id}/persona-branches/{persona_id}/diff", gith.PersonaBranchDiff)
+		r.With(auth.RequireAuth).Post("/projects/{id}/persona-branches/{persona_id}/merge", gith.MergePersonaBranch)
+
+		chgh := &ChangeHandler{DB: database}
+		r.With(auth.RequireAuth).Get("/projects/{id}/changes", chgh.ListChanges)
+		r.With(auth.RequireAuth).Post("/projects/{id}/changes/{change_id}/revert", chgh.RevertChange)
+		r.With(auth.RequireAuth).Post("/projects/{id}/runs/{run_id}/revert", chgh.RevertRun)
+
+		memStore := memory.NewStore(database, memory.NewHashEmbedder())
+		if sup != nil && sup.Memory != nil {
+			memStore = sup.Memory
+		}
+		memh := &MemoryHandler{DB: database, Store: memStore}
+		r.With(auth.RequireAuth).Get("/memories", memh.ListMemories)
+		r.With(auth.RequireAuth).Post("/memories", memh.CreateMemory)
+		r.With(auth.RequireAuth).Get("/memories/{id}", memh.GetMemory)
+		r.With(auth.RequireAuth).Put("/memories/{id}", memh.UpdateMemory)
+		r.With(auth.RequireAuth).Delete("/memories/{id}", memh.DeleteMemory)
+
+		th := &TaskHandler{DB: database, Hub: hub}
+		r.With(auth.RequireAuth).Get("/tasks", th.ListTasks)
+		r.With(auth.RequireAuth).Post("/tasks", th.CreateTask)
+		r.With(auth.RequireAuth).Get("/tasks/{id}", th.GetTask)
+		r.With(auth.RequireAuth).Put("/tasks/{id}", th.UpdateTask)
+		r.With(auth.RequireAuth).Delete("/tasks/{id}", th.DeleteTask)
+		r.With(auth.RequireAuth).Post("/tasks/{id}/comments", th.CreateComment)
+
+		dlh := &DelegationHandler{DB: database}
+		r.With(auth.RequireAuth).Get("/delegations", dlh.ListDelegations)
+		r.With(auth.RequireAuth).Get("/delegations/{id}", dlh.GetDelegation)
+
+		jh := &JobHandler{DB: database, Hub: hub}
+		r.With(auth.RequireAuth).Get("/jobs", jh.ListJobs)
+		r.With(auth.RequireAuth).Get("/jobs/{id}", jh.GetJob)
+		r.With(auth.RequireAuth).Post("/jobs/{id}/retry", jh.RetryJob)
+
+		runh := &RunHandler{DB: database}
+		r.With(auth.RequireAuth).Get("/runs/{id}", runh.GetRun)
+
+		audh := &AuditHandler{DB: database}
+		r.With(auth.RequireAuth).Get("/audit", audh.ListEvents)
+		r.With(auth.RequireAuth).Get("/audit/export", audh.ExportEvents)
+
 		r.With(auth.RequireAuth).Post("/invites", ih.CreateInvite)
 		r.With(auth.RequireAuth).Get("/invites", ih.ListInvites)
 
@@ -115,13 +199,42 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 			r.With(auth.RequireAuth).Get("/agents/status", agh.Status)
 			r.With(auth.RequireAuth).Post("/agents/start", agh.Start)
 			r.With(auth.RequireAuth).Post("/agents/stop", agh.Stop)
+			r.With(auth.RequireAuth).Post("/agents/{persona_id}/start", agh.StartActor)
+			r.With(auth.RequireAuth).Post("/agents/{persona_id}/stop", agh.StopActor)
+			r.With(auth.RequireAuth).Post("/agents/{persona_id}/restart", agh.RestartActor)
 			r.With(auth.RequireAuth).Get("/agents/{persona_id}/llm-calls", agh.LLMCalls)
 			r.With(auth.RequireAuth).Get("/agents/{persona_id}/tool-executions", agh.ToolExecutions)
 			r.With(auth.RequireAuth).Get("/agents/{persona_id}/stats", agh.Stats)
+			r.With(auth.RequireAuth).Get("/agents/{persona_id}/crashes", agh.Crashes)
+			r.With(auth.RequireAuth).Get("/agents/{persona_id}/runs", agh.Runs)
+			r.With(auth.RequireAuth).Post("/agents/{persona_id}/runs/{run_id}/cancel", agh.CancelRun)
 
 			ctxh := &ContextHandler{DB: database, Hub: hub, Supervisor: supervisor[0]}
 			r.With(auth.RequireAuth).Get("/agents/{persona_id}/context-budget", ctxh.ContextBudget)
 			r.With(auth.RequireAuth).Post("/agents/{persona_id}/channels/{channel_id}/reset-context", ctxh.ResetContext)
+
+			if supervisor[0].Archiver != nil {
+				arch := &ArchiveHandler{DB: database, Archiver: supervisor[0].Archiver}
+				r.With(auth.RequireAuth).Get("/archives", arch.ListArchives)
+				r.With(auth.RequireAuth).Get("/archives/search", arch.Search)
+				r.With(auth.RequireAuth).Get("/archives/{id}", arch.GetArchive)
+				r.With(auth.RequireAuth).Get("/archives/{id}/rows", arch.Rows)
+				r.With(auth.RequireAuth).Post("/archives/{id}/restore", arch.Restore)
+			}
+
+			if supervisor[0].Workflows != nil {
+				wfh := &WorkflowHandler{DB: database, Runner: supervisor[0].Workflows, Commands: cmds}
+				r.With(auth.RequireAuth).Get("/workflows", wfh.ListWorkflows)
+				r.With(auth.RequireAuth).Post("/workflows", wfh.CreateWorkflow)
+				r.With(auth.RequireAuth).Get("/workflows/{id}", wfh.GetWorkflow)
+				r.With(auth.RequireAuth).Put("/workflows/{id}", wfh.UpdateWorkflow)
+				r.With(auth.RequireAuth).Delete("/workflows/{id}", wfh.DeleteWorkflow)
+				r.With(auth.RequireAuth).Get("/workflows/{id}/runs", wfh.ListRuns)
+				r.With(auth.RequireAuth).Post("/workflows/{id}/runs", wfh.StartRun)
+				r.Post("/workflows/{id}/webhook", wfh.Webhook)
+				r.With(auth.RequireAuth).Get("/workflow-runs/{id}", wfh.GetRun)
+				r.With(auth.RequireAuth).Post("/workflow-runs/{id}/cancel", wfh.CancelRun)
+			}
 		}
 	})
 
@@ -129,3 +242,22 @@ func NewRouter(database *db.DB, corsOrigins []string, hub *ws.Hub, supervisor ..
 
 	return r
 }
+
+// requireMetricsAuth lets a request through if it has a signed-in user or,
+// when token is set, carries it as a bearer token.
+func requireMetricsAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.UserFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if ok && token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ErrorResponse(w, http.StatusUnauthorized, "unauthorized")
+		})
+	}
+}
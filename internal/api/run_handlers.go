@@ -0,0 +1,61 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// RunHandler serves agent run traces.
+type RunHandler struct {
+	DB *db.DB
+}
+
+type runEventJSON struct {
+	Type          string        `json:"type"`
+	At            string        `json:"at"`
+	Message       *messageJSON  `json:"message,omitempty"`
+	LLMCall       *llmCallJSON  `json:"llm_call,omitempty"`
+	ToolExecution *toolExecJSON `json:"tool_execution,omitempty"`
+}
+
+// GetRun returns a run with its full trace: the triggering message, each
+// LLM call and tool execution in order, and the messages the run posted.
+func (h *RunHandler) GetRun(w http.ResponseWriter, r *http.Request) {
+	trace, err := model.GetRunTrace(h.DB, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ErrorResponse(w, http.StatusNotFound, "run not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	events := make([]runEventJSON, len(trace.Events))
+	for i, ev := range trace.Events {
+		out := runEventJSON{Type: ev.Kind, At: formatStartedAt(ev.At)}
+		switch {
+		case ev.Message != nil:
+			m := toMessageJSON(*ev.Message)
+			m.Reactions = []model.ReactionCount{}
+			out.Message = &m
+		case ev.LLMCall != nil:
+			c := toLLMCallJSON(*ev.LLMCall)
+			out.LLMCall = &c
+		case ev.ToolExecution != nil:
+			e := toToolExecJSON(*ev.ToolExecution)
+			out.ToolExecution = &e
+		}
+		events[i] = out
+	}
+	WriteJSON(w, http.StatusOK, struct {
+		agentRunJSON
+		LastMessageID int64          `json:"last_message_id"`
+		Events        []runEventJSON `json:"events"`
+	}{toAgentRunJSON(trace.Run), trace.Run.LastMessageID, events})
+}
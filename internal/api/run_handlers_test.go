@@ -0,0 +1,87 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestGetRunTrace(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	auth := []string{"Authorization", "Bearer " + token}
+	p, _ := model.CreatePersona(d, "bot", "prompt", "model", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+	trigger, _ := model.CreateMessage(d, ch.ID, 1, "human", "alice", "run ls")
+
+	if err := model.CreateAgentRun(d, model.AgentRun{ID: "run1", PersonaID: p.ID, ChannelID: ch.ID,
+		Trigger: model.RunTriggerMessage, LastMessageID: trigger.ID}); err != nil {
+		t.Fatalf("CreateAgentRun: %v", err)
+	}
+	start := time.Now().UTC()
+	seed := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO llm_calls (persona_id, run_id, channel_id, model, messages_json, response_json, prompt_tokens, completion_tokens, started_at, duration_ms)
+		  VALUES (?, 'run1', ?, 'model', '[]', '{}', 10, 5, ?, 20)`, []any{p.ID, ch.ID, start}},
+		{`INSERT INTO tool_executions (persona_id, run_id, channel_id, tool_name, args_json, output_text, duration_ms, started_at)
+		  VALUES (?, 'run1', ?, 'shell_exec', '{}', 'ok', 5, ?)`, []any{p.ID, ch.ID, start.Add(30 * time.Millisecond)}},
+		{`INSERT INTO llm_calls (persona_id, run_id, channel_id, model, messages_json, response_json, prompt_tokens, completion_tokens, started_at, duration_ms)
+		  VALUES (?, 'run1', ?, 'model', '[]', '{}', 20, 2, ?, 20)`, []any{p.ID, ch.ID, start.Add(40 * time.Millisecond)}},
+	}
+	for _, s := range seed {
+		if _, err := d.WriteExec(s.query, s.args...); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	reply, _ := model.CreateMessage(d, ch.ID, p.ID, "agent", "bot", "Done.")
+	model.SetMessageRunID(d, reply.ID, "run1")
+	model.FinishAgentRun(d, "run1", model.RunCompleted, "", "Done.")
+
+	rec := doJSON(t, router, "GET", "/api/runs/run1", "", auth...)
+	var got struct {
+		ID            string `json:"id"`
+		Status        string `json:"status"`
+		LastMessageID int64  `json:"last_message_id"`
+		Events        []struct {
+			Type    string `json:"type"`
+			Message *struct {
+				ID int64 `json:"id"`
+			} `json:"message"`
+			LLMCall *struct {
+				PromptTokens int   `json:"prompt_tokens"`
+				DurationMs   int64 `json:"duration_ms"`
+			} `json:"llm_call"`
+			ToolExecution *struct {
+				ChannelID int64  `json:"channel_id"`
+				ToolName  string `json:"tool_name"`
+			} `json:"tool_execution"`
+		} `json:"events"`
+	}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || got.ID != "run1" || got.Status != model.RunCompleted || got.LastMessageID != trigger.ID {
+		t.Fatalf("run = %d %+v", rec.Code, got)
+	}
+	want := []string{"trigger", "llm_call", "tool_execution", "llm_call", "message"}
+	if len(got.Events) != len(want) {
+		t.Fatalf("events = %+v", got.Events)
+	}
+	for i, typ := range want {
+		if got.Events[i].Type != typ {
+			t.Errorf("event %d = %s, want %s", i, got.Events[i].Type, typ)
+		}
+	}
+	if got.Events[0].Message.ID != trigger.ID || got.Events[1].LLMCall.PromptTokens != 10 || got.Events[1].LLMCall.DurationMs != 20 ||
+		got.Events[2].ToolExecution.ChannelID != ch.ID || got.Events[4].Message.ID != reply.ID {
+		t.Errorf("events = %+v", got.Events)
+	}
+
+	if rec := doJSON(t, router, "GET", "/api/runs/nope", "", auth...); rec.Code != http.StatusNotFound {
+		t.Errorf("missing run = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,378 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// TaskHandler serves the task board shared by humans and agents.
+type TaskHandler struct {
+	DB  *db.DB
+	Hub *ws.Hub
+}
+
+type taskJSON struct {
+	ID                int64           `json:"id"`
+	Title             string          `json:"title"`
+	Description       string          `json:"description"`
+	Status            string          `json:"status"`
+	AssigneeUserID    int64           `json:"assignee_user_id"`
+	AssigneePersonaID int64           `json:"assignee_persona_id"`
+	AssigneeName      string          `json:"assignee_name"`
+	ProjectID         int64           `json:"project_id"`
+	ChannelID         int64           `json:"channel_id"`
+	ParentID          int64           `json:"parent_id"`
+	DueAt             *string         `json:"due_at"`
+	CreatedByType     string          `json:"created_by_type"`
+	CreatedByID       int64           `json:"created_by_id"`
+	CreatedByName     string          `json:"created_by_name"`
+	CreatedAt         string          `json:"created_at"`
+	UpdatedAt         string          `json:"updated_at"`
+	Events            []taskEventJSON `json:"events,omitempty"`
+}
+
+type taskEventJSON struct {
+	ID         int64  `json:"id"`
+	Kind       string `json:"kind"`
+	AuthorType string `json:"author_type"`
+	AuthorID   int64  `json:"author_id"`
+	AuthorName string `json:"author_name"`
+	Body       string `json:"body"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type createTaskRequest struct {
+	Title             string `json:"title"`
+	Description       string `json:"description"`
+	Status            string `json:"status"`
+	AssigneeUserID    int64  `json:"assignee_user_id"`
+	AssigneePersonaID int64  `json:"assignee_persona_id"`
+	ProjectID         int64  `json:"project_id"`
+	ChannelID         int64  `json:"channel_id"`
+	ParentID          int64  `json:"parent_id"`
+	DueAt             string `json:"due_at"`
+}
+
+// updateTaskRequest changes only the fields that are present. A zero ID
+// clears the field and an empty due_at removes the due date.
+type updateTaskRequest struct {
+	Title             *string `json:"title"`
+	Description       *string `json:"description"`
+	Status            *string `json:"status"`
+	AssigneeUserID    *int64  `json:"assignee_user_id"`
+	AssigneePersonaID *int64  `json:"assignee_persona_id"`
+	ProjectID         *int64  `json:"project_id"`
+	ChannelID         *int64  `json:"channel_id"`
+	ParentID          *int64  `json:"parent_id"`
+	DueAt             *string `json:"due_at"`
+}
+
+type taskCommentRequest struct {
+	Body string `json:"body"`
+}
+
+func toTaskJSON(t model.Task) taskJSON {
+	out := taskJSON{
+		ID:                t.ID,
+		Title:             t.Title,
+		Description:       t.Description,
+		Status:            t.Status,
+		AssigneeUserID:    t.AssigneeUserID,
+		AssigneePersonaID: t.AssigneePersonaID,
+		AssigneeName:      t.AssigneeName,
+		ProjectID:         t.ProjectID,
+		ChannelID:         t.ChannelID,
+		ParentID:          t.ParentID,
+		CreatedByType:     t.CreatedBy.Type,
+		CreatedByID:       t.CreatedBy.ID,
+		CreatedByName:     t.CreatedBy.Name,
+		CreatedAt:         t.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         t.UpdatedAt.Format(time.RFC3339),
+	}
+	if t.DueAt != nil {
+		s := t.DueAt.Format(time.RFC3339)
+		out.DueAt = &s
+	}
+	return out
+}
+
+func toTaskEventJSON(e model.TaskEvent) taskEventJSON {
+	return taskEventJSON{
+		ID:         e.ID,
+		Kind:       e.Kind,
+		AuthorType: e.Author.Type,
+		AuthorID:   e.Author.ID,
+		AuthorName: e.Author.Name,
+		Body:       e.Body,
+		CreatedAt:  e.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func humanAuthor(u *model.User) model.TaskAuthor {
+	return model.TaskAuthor{Type: "human", ID: u.ID, Name: u.Username}
+}
+
+// validateTask checks the title, status and assignment, writing a 400 on failure.
+func validateTask(w http.ResponseWriter, t model.Task) bool {
+	switch {
+	case strings.TrimSpace(t.Title) == "":
+		ErrorResponse(w, http.StatusBadRequest, "title is required")
+	case t.Status != "" && !model.ValidTaskStatus(t.Status):
+		ErrorResponse(w, http.StatusBadRequest, "status must be todo, in_progress, blocked, done or cancelled")
+	case t.AssigneeUserID != 0 && t.AssigneePersonaID != 0:
+		ErrorResponse(w, http.StatusBadRequest, "assign a user or a persona, not both")
+	case t.ParentID != 0 && t.ParentID == t.ID:
+		ErrorResponse(w, http.StatusBadRequest, "a task cannot be its own parent")
+	default:
+		return true
+	}
+	return false
+}
+
+func (h *TaskHandler) lookupTask(w http.ResponseWriter, r *http.Request) (model.Task, bool) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return model.Task{}, false
+	}
+	t, err := model.GetTask(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "task not found")
+			return model.Task{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Task{}, false
+	}
+	return t, true
+}
+
+// saveTaskError writes the response for a failed task write.
+func saveTaskError(w http.ResponseWriter, err error) {
+	if strings.Contains(err.Error(), "FOREIGN KEY") {
+		ErrorResponse(w, http.StatusBadRequest, "assignee, project, channel or parent task not found")
+		return
+	}
+	ErrorResponse(w, http.StatusInternalServerError, "internal error")
+}
+
+func (h *TaskHandler) broadcast(eventType string, t model.Task) {
+	h.Hub.Broadcast(ws.Event{Type: eventType, Data: toTaskJSON(t)})
+}
+
+// ListTasks handles GET /api/tasks, most recently updated first. It filters
+// by status, assignee_user_id, assignee_persona_id, project_id, channel_id
+// and parent_id; unassigned=true lists only tasks nobody is assigned to.
+func (h *TaskHandler) ListTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var filter model.TaskFilter
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"assignee_user_id", &filter.AssigneeUserID},
+		{"assignee_persona_id", &filter.AssigneePersonaID},
+		{"project_id", &filter.ProjectID},
+		{"channel_id", &filter.ChannelID},
+		{"parent_id", &filter.ParentID},
+	} {
+		if v := q.Get(p.name); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				ErrorResponse(w, http.StatusBadRequest, "invalid "+p.name)
+				return
+			}
+			*p.dst = id
+		}
+	}
+	filter.Status = q.Get("status")
+	filter.Unassigned = q.Get("unassigned") == "true"
+	filter.Limit, filter.Offset = parsePagination(r, 50, 200)
+
+	tasks, err := model.ListTasks(h.DB, filter)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]taskJSON, len(tasks))
+	for i, t := range tasks {
+		out[i] = toTaskJSON(t)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetTask handles GET /api/tasks/{id}, including the task's history.
+func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.lookupTask(w, r)
+	if !ok {
+		return
+	}
+	events, err := model.ListTaskEvents(h.DB, t.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := toTaskJSON(t)
+	out.Events = make([]taskEventJSON, len(events))
+	for i, e := range events {
+		out.Events[i] = toTaskEventJSON(e)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// CreateTask handles POST /api/tasks.
+func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+	var req createTaskRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	due, ok := parseOptionalTime(req.DueAt)
+	if !ok {
+		ErrorResponse(w, http.StatusBadRequest, "due_at must be an RFC 3339 time")
+		return
+	}
+
+	t := model.Task{
+		Title:             strings.TrimSpace(req.Title),
+		Description:       req.Description,
+		Status:            req.Status,
+		AssigneeUserID:    req.AssigneeUserID,
+		AssigneePersonaID: req.AssigneePersonaID,
+		ProjectID:         req.ProjectID,
+		ChannelID:         req.ChannelID,
+		ParentID:          req.ParentID,
+		DueAt:             due,
+	}
+	if !validateTask(w, t) {
+		return
+	}
+
+	t, err := model.CreateTask(h.DB, t, humanAuthor(GetUser(r)))
+	if err != nil {
+		saveTaskError(w, err)
+		return
+	}
+	h.broadcast("task_created", t)
+	auditChange(r, "tasks/"+strconv.FormatInt(t.ID, 10), nil, toTaskJSON(t))
+	WriteJSON(w, http.StatusCreated, toTaskJSON(t))
+}
+
+// UpdateTask handles PUT /api/tasks/{id}.
+func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.lookupTask(w, r)
+	if !ok {
+		return
+	}
+	before := t
+
+	var req updateTaskRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Title != nil {
+		t.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Description != nil {
+		t.Description = *req.Description
+	}
+	if req.Status != nil {
+		t.Status = *req.Status
+	}
+	// Assigning one kind of assignee replaces the other.
+	if req.AssigneeUserID != nil {
+		t.AssigneeUserID = *req.AssigneeUserID
+		if req.AssigneePersonaID == nil && t.AssigneeUserID != 0 {
+			t.AssigneePersonaID = 0
+		}
+	}
+	if req.AssigneePersonaID != nil {
+		t.AssigneePersonaID = *req.AssigneePersonaID
+		if req.AssigneeUserID == nil && t.AssigneePersonaID != 0 {
+			t.AssigneeUserID = 0
+		}
+	}
+	if req.ProjectID != nil {
+		t.ProjectID = *req.ProjectID
+	}
+	if req.ChannelID != nil {
+		t.ChannelID = *req.ChannelID
+	}
+	if req.ParentID != nil {
+		t.ParentID = *req.ParentID
+	}
+	if req.DueAt != nil {
+		due, ok := parseOptionalTime(*req.DueAt)
+		if !ok {
+			ErrorResponse(w, http.StatusBadRequest, "due_at must be an RFC 3339 time")
+			return
+		}
+		t.DueAt = due
+	}
+	if t.Status == "" {
+		ErrorResponse(w, http.StatusBadRequest, "status is required")
+		return
+	}
+	if !validateTask(w, t) {
+		return
+	}
+
+	t, err := model.UpdateTask(h.DB, t, humanAuthor(GetUser(r)))
+	if err != nil {
+		saveTaskError(w, err)
+		return
+	}
+	h.broadcast("task_updated", t)
+	auditChange(r, "", toTaskJSON(before), toTaskJSON(t))
+	WriteJSON(w, http.StatusOK, toTaskJSON(t))
+}
+
+// DeleteTask handles DELETE /api/tasks/{id}.
+func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.lookupTask(w, r)
+	if !ok {
+		return
+	}
+	if err := model.DeleteTask(h.DB, t.ID); err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	h.Hub.Broadcast(ws.Event{Type: "task_deleted", Data: map[string]int64{"id": t.ID}})
+	auditChange(r, "", toTaskJSON(t), nil)
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// CreateComment handles POST /api/tasks/{id}/comments.
+func (h *TaskHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.lookupTask(w, r)
+	if !ok {
+		return
+	}
+	var req taskCommentRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		ErrorResponse(w, http.StatusBadRequest, "body is required")
+		return
+	}
+
+	e, err := model.AddTaskComment(h.DB, t.ID, humanAuthor(GetUser(r)), req.Body)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if updated, err := model.GetTask(h.DB, t.ID); err == nil {
+		h.broadcast("task_updated", updated)
+	}
+	auditChange(r, "", nil, toTaskEventJSON(e))
+	WriteJSON(w, http.StatusCreated, toTaskEventJSON(e))
+}
@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type taskResp struct {
+	ID                int64   `json:"id"`
+	Title             string  `json:"title"`
+	Status            string  `json:"status"`
+	AssigneeUserID    int64   `json:"assignee_user_id"`
+	AssigneePersonaID int64   `json:"assignee_persona_id"`
+	AssigneeName      string  `json:"assignee_name"`
+	DueAt             *string `json:"due_at"`
+	CreatedByName     string  `json:"created_by_name"`
+	Events            []struct {
+		Kind       string `json:"kind"`
+		AuthorName string `json:"author_name"`
+		Body       string `json:"body"`
+	} `json:"events"`
+}
+
+func TestTaskEndpoints(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Helper", "You help.")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	rec := doJSON(t, router, "POST", "/api/tasks",
+		fmt.Sprintf(`{"title":"Write docs","assignee_persona_id":%d,"due_at":"2026-11-01T00:00:00Z"}`, personaID), auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var task taskResp
+	json.NewDecoder(rec.Body).Decode(&task)
+	if task.Status != "todo" || task.AssigneeName != "Helper" || task.CreatedByName != "alice" || task.DueAt == nil {
+		t.Errorf("unexpected task: %+v", task)
+	}
+	doJSON(t, router, "POST", "/api/tasks", `{"title":"Unowned"}`, auth...)
+
+	rec = doJSON(t, router, "GET", "/api/tasks?unassigned=true", "", auth...)
+	var list []taskResp
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].Title != "Unowned" {
+		t.Errorf("unassigned filter returned %+v", list)
+	}
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/tasks?assignee_persona_id=%d", personaID), "", auth...)
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].ID != task.ID {
+		t.Errorf("assignee filter returned %+v", list)
+	}
+
+	// Assigning a user replaces the persona.
+	rec = doJSON(t, router, "PUT", fmt.Sprintf("/api/tasks/%d", task.ID), `{"status":"in_progress","assignee_user_id":1}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	json.NewDecoder(rec.Body).Decode(&task)
+	if task.Status != "in_progress" || task.AssigneeUserID != 1 || task.AssigneePersonaID != 0 || task.AssigneeName != "alice" {
+		t.Errorf("unexpected update: %+v", task)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/tasks/%d/comments", task.ID), `{"body":"halfway there"}`, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("comment status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/tasks/%d", task.ID), "", auth...)
+	task = taskResp{}
+	json.NewDecoder(rec.Body).Decode(&task)
+	if len(task.Events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", task.Events)
+	}
+	if task.Events[0].Kind != "created" || task.Events[1].Kind != "updated" || task.Events[2].Body != "halfway there" {
+		t.Errorf("unexpected events: %+v", task.Events)
+	}
+
+	rec = doJSON(t, router, "DELETE", fmt.Sprintf("/api/tasks/%d", task.ID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/tasks/%d", task.ID), "", auth...)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted status = %d, want 404", rec.Code)
+	}
+}
+
+func TestTaskValidation(t *testing.T) {
+	d := openTestDB(t)
+	router := newTestRouter(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	personaID := createPersona(t, router, token, "Helper", "You help.")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	for _, body := range []string{
+		`{"title":""}`,
+		`{"title":"x","status":"someday"}`,
+		fmt.Sprintf(`{"title":"x","assignee_user_id":1,"assignee_persona_id":%d}`, personaID),
+		`{"title":"x","project_id":999}`,
+		`{"title":"x","due_at":"tomorrow"}`,
+	} {
+		rec := doJSON(t, router, "POST", "/api/tasks", body, auth...)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	rec := doJSON(t, router, "PUT", "/api/tasks/999", `{"status":"done"}`, auth...)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("update missing status = %d, want 404", rec.Code)
+	}
+	rec = doJSON(t, router, "POST", "/api/tasks/999/comments", `{"body":"hi"}`, auth...)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("comment missing status = %d, want 404", rec.Code)
+	}
+}
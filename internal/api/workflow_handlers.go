@@ -0,0 +1,448 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/auth"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// maxWebhookInput bounds the request body a webhook passes to a workflow.
+const maxWebhookInput = 64 << 10
+
+// WorkflowHandler manages multi-agent workflows and their runs.
+type WorkflowHandler struct {
+	DB     *db.DB
+	Runner *agent.WorkflowRunner
+
+	// Commands, if set, is checked so a workflow can't take a built-in
+	// command's name.
+	Commands *CommandRegistry
+}
+
+type workflowJSON struct {
+	ID           int64           `json:"id"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	Definition   json.RawMessage `json:"definition"`
+	Enabled      bool            `json:"enabled"`
+	WebhookToken string          `json:"webhook_token"`
+	CreatedAt    string          `json:"created_at"`
+	UpdatedAt    string          `json:"updated_at"`
+}
+
+type workflowRunJSON struct {
+	ID           int64                  `json:"id"`
+	WorkflowID   int64                  `json:"workflow_id"`
+	WorkflowName string                 `json:"workflow_name"`
+	Trigger      string                 `json:"trigger"`
+	Input        string                 `json:"input"`
+	ChannelID    int64                  `json:"channel_id"`
+	StartedBy    string                 `json:"started_by"`
+	Status       string                 `json:"status"`
+	CurrentStage string                 `json:"current_stage"`
+	Error        string                 `json:"error"`
+	CreatedAt    string                 `json:"created_at"`
+	UpdatedAt    string                 `json:"updated_at"`
+	FinishedAt   *string                `json:"finished_at"`
+	Stages       []workflowStageRunJSON `json:"stages,omitempty"`
+}
+
+type workflowStageRunJSON struct {
+	ID          int64   `json:"id"`
+	Stage       string  `json:"stage"`
+	PersonaID   int64   `json:"persona_id"`
+	PersonaName string  `json:"persona_name"`
+	Prompt      string  `json:"prompt"`
+	Output      string  `json:"output"`
+	Status      string  `json:"status"`
+	Error       string  `json:"error"`
+	StartedAt   string  `json:"started_at"`
+	FinishedAt  *string `json:"finished_at"`
+}
+
+type workflowRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Definition  json.RawMessage `json:"definition"`
+	Enabled     *bool           `json:"enabled"`
+}
+
+type startWorkflowRequest struct {
+	Input     string `json:"input"`
+	ChannelID int64  `json:"channel_id"`
+}
+
+func toWorkflowJSON(wf model.Workflow) workflowJSON {
+	return workflowJSON{
+		ID:           wf.ID,
+		Name:         wf.Name,
+		Description:  wf.Description,
+		Definition:   json.RawMessage(wf.Definition),
+		Enabled:      wf.Enabled,
+		WebhookToken: wf.WebhookToken,
+		CreatedAt:    wf.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    wf.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toWorkflowAuditJSON is the workflow as the audit log records it, without
+// its webhook token.
+func toWorkflowAuditJSON(wf model.Workflow) workflowJSON {
+	out := toWorkflowJSON(wf)
+	out.WebhookToken = ""
+	return out
+}
+
+func toWorkflowRunJSON(run model.WorkflowRun) workflowRunJSON {
+	out := workflowRunJSON{
+		ID:           run.ID,
+		WorkflowID:   run.WorkflowID,
+		WorkflowName: run.WorkflowName,
+		Trigger:      run.Trigger,
+		Input:        run.Input,
+		ChannelID:    run.ChannelID,
+		StartedBy:    run.StartedBy,
+		Status:       run.Status,
+		CurrentStage: run.CurrentStage,
+		Error:        run.Error,
+		CreatedAt:    run.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    run.UpdatedAt.Format(time.RFC3339),
+	}
+	if run.FinishedAt != nil {
+		s := run.FinishedAt.Format(time.RFC3339)
+		out.FinishedAt = &s
+	}
+	return out
+}
+
+func toWorkflowStageRunJSON(sr model.WorkflowStageRun) workflowStageRunJSON {
+	out := workflowStageRunJSON{
+		ID:          sr.ID,
+		Stage:       sr.Stage,
+		PersonaID:   sr.PersonaID,
+		PersonaName: sr.PersonaName,
+		Prompt:      sr.Prompt,
+		Output:      sr.Output,
+		Status:      sr.Status,
+		Error:       sr.Error,
+		StartedAt:   sr.StartedAt.Format(time.RFC3339),
+	}
+	if sr.FinishedAt != nil {
+		s := sr.FinishedAt.Format(time.RFC3339)
+		out.FinishedAt = &s
+	}
+	return out
+}
+
+func (h *WorkflowHandler) lookupWorkflow(w http.ResponseWriter, r *http.Request) (model.Workflow, bool) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return model.Workflow{}, false
+	}
+	wf, err := model.GetWorkflow(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "workflow not found")
+			return model.Workflow{}, false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return model.Workflow{}, false
+	}
+	return wf, true
+}
+
+// applyWorkflowRequest copies req onto wf and validates the result, writing
+// a 400 on failure.
+func (h *WorkflowHandler) applyWorkflowRequest(w http.ResponseWriter, wf *model.Workflow, req workflowRequest) bool {
+	wf.Name = strings.TrimSpace(req.Name)
+	wf.Description = req.Description
+	wf.Definition = string(req.Definition)
+	if req.Enabled != nil {
+		wf.Enabled = *req.Enabled
+	}
+	if wf.Name == "" || len(wf.Name) > 100 {
+		ErrorResponse(w, http.StatusBadRequest, "name must be 1-100 characters")
+		return false
+	}
+	if len(req.Definition) == 0 {
+		ErrorResponse(w, http.StatusBadRequest, "definition is required")
+		return false
+	}
+	if err := h.Runner.Validate(*wf); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if def, _ := agent.ParseWorkflow(wf.Definition); h.Commands != nil && h.Commands.IsBuiltin(def.Triggers.Command) {
+		ErrorResponse(w, http.StatusBadRequest, "command /"+def.Triggers.Command+" is a built-in command")
+		return false
+	}
+	return true
+}
+
+// ListWorkflows handles GET /api/workflows.
+func (h *WorkflowHandler) ListWorkflows(w http.ResponseWriter, r *http.Request) {
+	workflows, err := model.ListWorkflows(h.DB)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]workflowJSON, len(workflows))
+	for i, wf := range workflows {
+		out[i] = toWorkflowJSON(wf)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetWorkflow handles GET /api/workflows/{id}.
+func (h *WorkflowHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	wf, ok := h.lookupWorkflow(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, toWorkflowJSON(wf))
+}
+
+// CreateWorkflow handles POST /api/workflows. New workflows are enabled
+// unless the request says otherwise, and get a fresh webhook token.
+func (h *WorkflowHandler) CreateWorkflow(w http.ResponseWriter, r *http.Request) {
+	var req workflowRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	wf := model.Workflow{Enabled: true}
+	if !h.applyWorkflowRequest(w, &wf, req) {
+		return
+	}
+	token, err := auth.GenerateToken()
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	wf.WebhookToken = token
+
+	wf, err = model.CreateWorkflow(h.DB, wf)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			ErrorResponse(w, http.StatusConflict, "workflow name already taken")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "workflows/"+strconv.FormatInt(wf.ID, 10), nil, toWorkflowAuditJSON(wf))
+	WriteJSON(w, http.StatusCreated, toWorkflowJSON(wf))
+}
+
+// UpdateWorkflow handles PUT /api/workflows/{id}. Runs already in flight
+// keep the definition they started with.
+func (h *WorkflowHandler) UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	wf, ok := h.lookupWorkflow(w, r)
+	if !ok {
+		return
+	}
+	before := wf
+	var req workflowRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.applyWorkflowRequest(w, &wf, req) {
+		return
+	}
+	if err := model.UpdateWorkflow(h.DB, wf); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			ErrorResponse(w, http.StatusConflict, "workflow name already taken")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	wf, err := model.GetWorkflow(h.DB, wf.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "", toWorkflowAuditJSON(before), toWorkflowAuditJSON(wf))
+	WriteJSON(w, http.StatusOK, toWorkflowJSON(wf))
+}
+
+// DeleteWorkflow handles DELETE /api/workflows/{id}, cancelling its running
+// runs first.
+func (h *WorkflowHandler) DeleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	wf, ok := h.lookupWorkflow(w, r)
+	if !ok {
+		return
+	}
+	runs, err := model.ListWorkflowRuns(h.DB, model.WorkflowRunFilter{WorkflowID: wf.ID, Status: model.WorkflowRunning})
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	for _, run := range runs {
+		h.Runner.Cancel(run.ID)
+	}
+	if err := model.DeleteWorkflow(h.DB, wf.ID); err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	auditChange(r, "", toWorkflowAuditJSON(wf), nil)
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// StartRun handles POST /api/workflows/{id}/runs. Stage answers go to
+// channel_id when given, otherwise to the definition's channel.
+func (h *WorkflowHandler) StartRun(w http.ResponseWriter, r *http.Request) {
+	wf, ok := h.lookupWorkflow(w, r)
+	if !ok {
+		return
+	}
+	var req startWorkflowRequest
+	if err := ReadJSON(r, &req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ChannelID != 0 {
+		if _, err := model.GetChannel(h.DB, req.ChannelID); err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "channel not found")
+			return
+		}
+	}
+	h.start(w, r, wf, model.TriggerManual, req.Input, req.ChannelID, GetUser(r).Username)
+}
+
+// Webhook handles POST /api/workflows/{id}/webhook. It needs no session:
+// the caller authenticates with the workflow's webhook token in the
+// X-Webhook-Token header or the token query parameter, and the request body
+// becomes the run's input.
+func (h *WorkflowHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	wf, err := model.GetWorkflow(h.DB, id)
+	token := r.Header.Get("X-Webhook-Token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	// Unknown workflows and bad tokens look the same to the caller.
+	if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(wf.WebhookToken)) != 1 {
+		ErrorResponse(w, http.StatusNotFound, "workflow not found")
+		return
+	}
+	def, err := agent.ParseWorkflow(wf.Definition)
+	if err != nil || !def.Triggers.Webhook {
+		ErrorResponse(w, http.StatusForbidden, "workflow has no webhook trigger")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookInput+1))
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "read body")
+		return
+	}
+	if len(body) > maxWebhookInput {
+		ErrorResponse(w, http.StatusRequestEntityTooLarge, "body too large")
+		return
+	}
+	h.start(w, r, wf, model.TriggerWebhook, string(body), 0, "webhook")
+}
+
+func (h *WorkflowHandler) start(w http.ResponseWriter, r *http.Request, wf model.Workflow, trigger, input string, channelID int64, startedBy string) {
+	run, err := h.Runner.Start(wf, trigger, input, channelID, startedBy)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	auditChange(r, "workflow-runs/"+strconv.FormatInt(run.ID, 10), nil, toWorkflowRunJSON(run))
+	WriteJSON(w, http.StatusAccepted, toWorkflowRunJSON(run))
+}
+
+// ListRuns handles GET /api/workflows/{id}/runs, newest first, optionally
+// filtered by status.
+func (h *WorkflowHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	wf, ok := h.lookupWorkflow(w, r)
+	if !ok {
+		return
+	}
+	filter := model.WorkflowRunFilter{WorkflowID: wf.ID, Status: r.URL.Query().Get("status")}
+	filter.Limit, filter.Offset = parsePagination(r, 50, 200)
+	runs, err := model.ListWorkflowRuns(h.DB, filter)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]workflowRunJSON, len(runs))
+	for i, run := range runs {
+		out[i] = toWorkflowRunJSON(run)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GetRun handles GET /api/workflow-runs/{id}, including its stages.
+func (h *WorkflowHandler) GetRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	run, err := model.GetWorkflowRun(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "workflow run not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	stages, err := model.ListWorkflowStageRuns(h.DB, run.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := toWorkflowRunJSON(run)
+	out.Stages = make([]workflowStageRunJSON, len(stages))
+	for i, sr := range stages {
+		out.Stages[i] = toWorkflowStageRunJSON(sr)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// CancelRun handles POST /api/workflow-runs/{id}/cancel.
+func (h *WorkflowHandler) CancelRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := ParseIntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	run, err := model.GetWorkflowRun(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ErrorResponse(w, http.StatusNotFound, "workflow run not found")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	cancelled, err := h.Runner.Cancel(id)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !cancelled {
+		ErrorResponse(w, http.StatusConflict, "workflow run is not running")
+		return
+	}
+	if after, err := model.GetWorkflowRun(h.DB, id); err == nil {
+		auditChange(r, "", toWorkflowRunJSON(run), toWorkflowRunJSON(after))
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,196 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type workflowRunResp struct {
+	ID        int64  `json:"id"`
+	Trigger   string `json:"trigger"`
+	Input     string `json:"input"`
+	ChannelID int64  `json:"channel_id"`
+	StartedBy string `json:"started_by"`
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+	Stages    []struct {
+		Stage       string `json:"stage"`
+		PersonaName string `json:"persona_name"`
+		Prompt      string `json:"prompt"`
+		Status      string `json:"status"`
+	} `json:"stages"`
+}
+
+// waitForRun polls a workflow run until it stops running.
+func waitForRun(t *testing.T, router http.Handler, token string, id int64) workflowRunResp {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := doJSON(t, router, "GET", fmt.Sprintf("/api/workflow-runs/%d", id), "", "Authorization", "Bearer "+token)
+		var run workflowRunResp
+		json.NewDecoder(rec.Body).Decode(&run)
+		if run.Status != "running" {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %d still running", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWorkflowEndpoints(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	createPersona(t, router, token, "Architect", "You design.")
+	channelID := createChannel(t, router, token, "eng", "")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	definition := `{"triggers": {"command": "design", "webhook": true}, "channel": "eng",
+		"stages": [{"name": "design", "persona": "Architect", "prompt": "Design {{.Input}}"}]}`
+	rec := doJSON(t, router, "POST", "/api/workflows", `{"name": "design", "definition": `+definition+`}`, auth...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var wf struct {
+		ID           int64  `json:"id"`
+		Enabled      bool   `json:"enabled"`
+		WebhookToken string `json:"webhook_token"`
+		Definition   struct {
+			Channel string `json:"channel"`
+		} `json:"definition"`
+	}
+	json.NewDecoder(rec.Body).Decode(&wf)
+	if !wf.Enabled || wf.WebhookToken == "" || wf.Definition.Channel != "eng" {
+		t.Errorf("unexpected workflow: %+v", wf)
+	}
+
+	for _, body := range []string{
+		`{"name": "x", "definition": {"stages": [{"name": "a", "persona": "Nobody", "prompt": "x"}]}}`,
+		`{"name": "x", "definition": {"stages": [{"name": "a", "persona": "Architect", "prompt": "x"}], "channel": "missing"}}`,
+		`{"name": "x", "definition": {"triggers": {"command": "design"}, "stages": [{"name": "a", "persona": "Architect", "prompt": "x"}]}}`,
+		`{"name": "x", "definition": {"stages": []}}`,
+		`{"name": "x"}`,
+	} {
+		rec := doJSON(t, router, "POST", "/api/workflows", body, auth...)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+	rec = doJSON(t, router, "POST", "/api/workflows", `{"name": "design", "definition": {"stages": [{"name": "a", "persona": "Architect", "prompt": "x"}]}}`, auth...)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("duplicate name status = %d, want 409", rec.Code)
+	}
+
+	// Disabled workflows can't be started.
+	rec = doJSON(t, router, "PUT", fmt.Sprintf("/api/workflows/%d", wf.ID), `{"name": "design", "enabled": false, "definition": `+definition+`}`, auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/workflows/%d/runs", wf.ID), `{"input": "x"}`, auth...)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("start disabled status = %d, want 400", rec.Code)
+	}
+	doJSON(t, router, "PUT", fmt.Sprintf("/api/workflows/%d", wf.ID), `{"name": "design", "enabled": true, "definition": `+definition+`}`, auth...)
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/workflows/%d/runs", wf.ID), `{"input": "a cache"}`, auth...)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("start status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var run workflowRunResp
+	json.NewDecoder(rec.Body).Decode(&run)
+	if run.Trigger != "manual" || run.StartedBy != "alice" || run.ChannelID != channelID {
+		t.Errorf("unexpected run: %+v", run)
+	}
+	// The test LLM answers with nothing, so the stage fails.
+	run = waitForRun(t, router, token, run.ID)
+	if run.Status != "failed" || len(run.Stages) != 1 || run.Stages[0].Prompt != "Design a cache" || run.Stages[0].PersonaName != "Architect" {
+		t.Errorf("unexpected finished run: %+v", run)
+	}
+
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/workflow-runs/%d/cancel", run.ID), "", auth...)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("cancel finished run status = %d, want 409", rec.Code)
+	}
+
+	// A slash command starts the workflow instead of posting a message.
+	rec = doJSON(t, router, "POST", fmt.Sprintf("/api/channels/%d/messages", channelID), `{"content": "/design a queue"}`, auth...)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("slash command status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	json.NewDecoder(rec.Body).Decode(&run)
+	if run.Trigger != "command" || run.Input != "a queue" {
+		t.Errorf("unexpected command run: %+v", run)
+	}
+	waitForRun(t, router, token, run.ID)
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/channels/%d/messages", channelID), "", auth...)
+	if strings.Contains(rec.Body.String(), "/design") {
+		t.Errorf("slash command was posted as a message: %s", rec.Body.String())
+	}
+
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/workflows/%d/runs", wf.ID), "", auth...)
+	var runs []workflowRunResp
+	json.NewDecoder(rec.Body).Decode(&runs)
+	if len(runs) != 2 || runs[0].Trigger != "command" {
+		t.Errorf("unexpected runs: %+v", runs)
+	}
+
+	rec = doJSON(t, router, "DELETE", fmt.Sprintf("/api/workflows/%d", wf.ID), "", auth...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	rec = doJSON(t, router, "GET", fmt.Sprintf("/api/workflow-runs/%d", run.ID), "", auth...)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("run of deleted workflow status = %d, want 404", rec.Code)
+	}
+}
+
+func TestWorkflowWebhook(t *testing.T) {
+	d := openTestDB(t)
+	router, _ := newTestRouterWithSupervisor(t, d)
+	token := registerUser(t, router, "alice", "password123", "")
+	createPersona(t, router, token, "Architect", "You design.")
+	auth := []string{"Authorization", "Bearer " + token}
+
+	var hooked, plain struct {
+		ID           int64  `json:"id"`
+		WebhookToken string `json:"webhook_token"`
+	}
+	rec := doJSON(t, router, "POST", "/api/workflows", `{"name": "hooked", "definition": {"triggers": {"webhook": true},
+		"stages": [{"name": "a", "persona": "Architect", "prompt": "{{.Input}}"}]}}`, auth...)
+	json.NewDecoder(rec.Body).Decode(&hooked)
+	rec = doJSON(t, router, "POST", "/api/workflows", `{"name": "plain", "definition": {
+		"stages": [{"name": "a", "persona": "Architect", "prompt": "{{.Input}}"}]}}`, auth...)
+	json.NewDecoder(rec.Body).Decode(&plain)
+
+	webhook := func(id int64, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", fmt.Sprintf("/api/workflows/%d/webhook", id), strings.NewReader(body))
+		req.Header.Set("X-Webhook-Token", token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := webhook(hooked.ID, "wrong", "{}"); rec.Code != http.StatusNotFound {
+		t.Errorf("wrong token status = %d, want 404", rec.Code)
+	}
+	if rec := webhook(plain.ID, plain.WebhookToken, "{}"); rec.Code != http.StatusForbidden {
+		t.Errorf("no webhook trigger status = %d, want 403", rec.Code)
+	}
+	rec = webhook(hooked.ID, hooked.WebhookToken, `{"event": "push"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("webhook status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var run workflowRunResp
+	json.NewDecoder(rec.Body).Decode(&run)
+	if run.Trigger != "webhook" || run.Input != `{"event": "push"}` {
+		t.Errorf("unexpected webhook run: %+v", run)
+	}
+	waitForRun(t, router, token, run.ID)
+}
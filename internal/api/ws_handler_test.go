@@ -261,5 +261,5 @@ func TestWebSocketBroadcastOnPostMessage(t *testing.T) {
 // newTestRouterWithHub creates a test router with a specific hub instance.
 func newTestRouterWithHub(t *testing.T, d *db.DB, hub *ws.Hub) http.Handler {
 	t.Helper()
-	return api.NewRouter(d, []string{"*"}, hub)
+	return api.NewRouter(d, []string{"*"}, "", hub)
 }
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds all application configuration, loaded from environment variables.
@@ -13,6 +14,10 @@ type Config struct {
 
 	CORSOrigins []string
 
+	// MetricsToken, when set, lets a scraper read /metrics with it as a
+	// bearer token. Otherwise /metrics needs a signed-in user.
+	MetricsToken string
+
 	IMAPHost    string
 	IMAPPort    int
 	IMAPUser    string
@@ -21,7 +26,53 @@ type Config struct {
 
 	OpenRouterKey string
 
+	// LLMProvider is "openrouter" or "fake". With "fake" every persona is
+	// answered by the scripted fake provider; otherwise only personas whose
+	// model is "fake" or "fake/...".
+	LLMProvider string
+	// FakeLLMScript is the JSON rule file the fake provider follows. It
+	// echoes messages back when empty.
+	FakeLLMScript string
+
 	ArchiveDir string
+	// ArchiveMaxEvents, ArchiveMaxAge and ArchiveMaxBytes are the retention
+	// limits for each persona's LLM calls and tool executions; rows beyond
+	// any of them are moved to ArchiveDir. A negative ArchiveMaxEvents and
+	// zero ArchiveMaxAge or ArchiveMaxBytes mean no limit.
+	ArchiveMaxEvents int
+	ArchiveMaxAge    time.Duration
+	ArchiveMaxBytes  int64
+
+	// WorktreeDir enables per-persona git worktrees when set.
+	WorktreeDir string
+
+	// StageChanges holds agent file writes for human review instead of
+	// writing them to the project directory.
+	StageChanges bool
+
+	// EmbeddingsURL selects an OpenAI-compatible embeddings endpoint for
+	// memory search. The local hashing embedder is used when empty.
+	EmbeddingsURL   string
+	EmbeddingsKey   string
+	EmbeddingsModel string
+
+	// MaxConcurrentChannels bounds how many channels each persona works in
+	// at once.
+	MaxConcurrentChannels int
+
+	// RestartOnNewMessage abandons a persona's reply in progress when a human
+	// posts in the channel, and starts over with the new messages.
+	RestartOnNewMessage bool
+
+	// TemplateDir holds persona bundle JSON files offered as templates in
+	// addition to the built-ins.
+	TemplateDir string
+
+	// OTelFile and OTelEndpoint export each agent run as OpenTelemetry
+	// spans: appended as OTLP/JSON lines to a file, or posted to an
+	// OTLP/HTTP collector such as http://localhost:4318.
+	OTelFile     string
+	OTelEndpoint string
 }
 
 // Load reads configuration from environment variables with sensible defaults.
@@ -30,7 +81,8 @@ func Load() Config {
 		Port:   envInt("WAYNEBOT_PORT", 59731),
 		DBPath: envStr("WAYNEBOT_DB_PATH", "waynebot.db"),
 
-		CORSOrigins: envList("WAYNEBOT_CORS_ORIGINS", []string{"http://localhost:5173"}),
+		CORSOrigins:  envList("WAYNEBOT_CORS_ORIGINS", []string{"http://localhost:5173"}),
+		MetricsToken: envStr("WAYNEBOT_METRICS_TOKEN", ""),
 
 		IMAPHost:    envStr("WAYNEBOT_IMAP_HOST", ""),
 		IMAPPort:    envInt("WAYNEBOT_IMAP_PORT", 993),
@@ -39,8 +91,28 @@ func Load() Config {
 		IMAPChannel: envStr("WAYNEBOT_IMAP_CHANNEL", "email"),
 
 		OpenRouterKey: envStr("WAYNEBOT_OPENROUTER_KEY", ""),
+		LLMProvider:   envStr("WAYNEBOT_LLM_PROVIDER", "openrouter"),
+		FakeLLMScript: envStr("WAYNEBOT_FAKE_LLM_SCRIPT", ""),
+
+		ArchiveDir:       envStr("WAYNEBOT_ARCHIVE_DIR", "./archives"),
+		ArchiveMaxEvents: envInt("WAYNEBOT_ARCHIVE_MAX_EVENTS", 10_000),
+		ArchiveMaxAge:    envDuration("WAYNEBOT_ARCHIVE_MAX_AGE", 0),
+		ArchiveMaxBytes:  int64(envInt("WAYNEBOT_ARCHIVE_MAX_BYTES", 0)),
+
+		WorktreeDir:  envStr("WAYNEBOT_WORKTREE_DIR", ""),
+		StageChanges: envBool("WAYNEBOT_STAGE_CHANGES", false),
+
+		EmbeddingsURL:   envStr("WAYNEBOT_EMBEDDINGS_URL", ""),
+		EmbeddingsKey:   envStr("WAYNEBOT_EMBEDDINGS_KEY", ""),
+		EmbeddingsModel: envStr("WAYNEBOT_EMBEDDINGS_MODEL", "text-embedding-3-small"),
+
+		MaxConcurrentChannels: envInt("WAYNEBOT_MAX_CONCURRENT_CHANNELS", 4),
+		RestartOnNewMessage:   envBool("WAYNEBOT_RESTART_ON_NEW_MESSAGE", false),
 
-		ArchiveDir: envStr("WAYNEBOT_ARCHIVE_DIR", "./archives"),
+		TemplateDir: envStr("WAYNEBOT_TEMPLATE_DIR", ""),
+
+		OTelFile:     envStr("WAYNEBOT_OTEL_FILE", ""),
+		OTelEndpoint: envStr("WAYNEBOT_OTEL_ENDPOINT", ""),
 	}
 	return c
 }
@@ -61,6 +133,24 @@ func envInt(key string, fallback int) int {
 	return fallback
 }
 
+func envBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
 func envList(key string, fallback []string) []string {
 	if v := os.Getenv(key); v != "" {
 		parts := strings.Split(v, ",")
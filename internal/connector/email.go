@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/metrics"
 	"github.com/waynenilsen/waynebot/internal/model"
 	"github.com/waynenilsen/waynebot/internal/ws"
 )
@@ -74,6 +75,7 @@ func (e *EmailConnector) Run(ctx context.Context) {
 	for {
 		if err := e.client.Connect(e.cfg.Host, e.cfg.Port, e.cfg.User, e.cfg.Pass); err != nil {
 			slog.Error("email connector: connect failed", "error", err)
+			metrics.ConnectorPolls.Inc("email", "connect_error")
 			if !sleepCtx(ctx, 30*time.Second) {
 				return
 			}
@@ -98,8 +100,10 @@ func (e *EmailConnector) pollLoop(ctx context.Context) {
 		msgs, err := e.client.FetchUnseen()
 		if err != nil {
 			slog.Error("email connector: fetch unseen", "error", err)
+			metrics.ConnectorPolls.Inc("email", "error")
 			return // reconnect
 		}
+		metrics.ConnectorPolls.Inc("email", "ok")
 
 		if len(msgs) > 0 {
 			e.postMessages(msgs)
@@ -128,6 +132,7 @@ func (e *EmailConnector) postMessages(msgs []EmailMessage) {
 			slog.Error("email connector: create message", "error", err)
 			continue
 		}
+		metrics.ConnectorMessages.Inc("email")
 		e.hub.Broadcast(ws.Event{
 			Type: "new_message",
 			Data: msg,
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/metrics"
 
 	_ "modernc.org/sqlite"
 )
@@ -52,14 +55,14 @@ func (d *DB) Close() error {
 
 // WriteExec executes a write statement under the write mutex.
 func (d *DB) WriteExec(query string, args ...any) (sql.Result, error) {
-	d.writeMu.Lock()
+	d.lockWrites()
 	defer d.writeMu.Unlock()
 	return d.SQL.Exec(query, args...)
 }
 
 // WriteTx runs fn inside a transaction under the write mutex.
 func (d *DB) WriteTx(fn func(tx *sql.Tx) error) error {
-	d.writeMu.Lock()
+	d.lockWrites()
 	defer d.writeMu.Unlock()
 
 	tx, err := d.SQL.Begin()
@@ -72,3 +75,10 @@ func (d *DB) WriteTx(fn func(tx *sql.Tx) error) error {
 	}
 	return tx.Commit()
 }
+
+// lockWrites takes the write mutex, recording how long it waited.
+func (d *DB) lockWrites() {
+	start := time.Now()
+	d.writeMu.Lock()
+	metrics.DBWriteLockWait.Observe(time.Since(start).Seconds())
+}
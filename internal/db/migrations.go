@@ -253,6 +253,492 @@ CREATE INDEX idx_memories_kind ON memories(kind);
 		Version: 11,
 		SQL:     `DROP TABLE IF EXISTS memories;`,
 	},
+	{
+		Version: 12,
+		SQL: `
+CREATE TABLE changesets (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    persona_id  INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    channel_id  INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    project_dir TEXT NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'applied', 'partial', 'rejected')),
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at DATETIME
+);
+CREATE INDEX idx_changesets_channel ON changesets(channel_id, created_at);
+
+CREATE TABLE changeset_files (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    changeset_id INTEGER NOT NULL REFERENCES changesets(id) ON DELETE CASCADE,
+    path         TEXT NOT NULL,
+    existed      INTEGER NOT NULL DEFAULT 1,
+    base_content TEXT NOT NULL,
+    new_content  TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'applied', 'partial', 'rejected')),
+    UNIQUE (changeset_id, path)
+);
+`,
+	},
+	{
+		Version: 13,
+		SQL: `
+CREATE TABLE file_changes (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id     INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    persona_id     INTEGER REFERENCES personas(id) ON DELETE SET NULL,
+    channel_id     INTEGER REFERENCES channels(id) ON DELETE SET NULL,
+    run_id         TEXT NOT NULL,
+    root_dir       TEXT NOT NULL,
+    path           TEXT NOT NULL,
+    existed        INTEGER NOT NULL,
+    before_content TEXT NOT NULL,
+    after_content  TEXT NOT NULL,
+    created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reverted_at    DATETIME
+);
+CREATE INDEX idx_file_changes_project ON file_changes(project_id, id);
+CREATE INDEX idx_file_changes_run ON file_changes(run_id);
+`,
+	},
+	{
+		Version: 14,
+		SQL: `
+CREATE TABLE memories (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    persona_id      INTEGER REFERENCES personas(id) ON DELETE SET NULL,
+    project_id      INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+    channel_id      INTEGER REFERENCES channels(id) ON DELETE SET NULL,
+    title           TEXT NOT NULL,
+    content         TEXT NOT NULL,
+    source_path     TEXT NOT NULL DEFAULT '',
+    embedding       BLOB,
+    embedding_model TEXT NOT NULL DEFAULT '',
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_memories_project ON memories(project_id);
+CREATE INDEX idx_memories_persona ON memories(persona_id);
+CREATE UNIQUE INDEX idx_memories_source ON memories(project_id, source_path) WHERE source_path != '';
+`,
+	},
+	{
+		Version: 15,
+		SQL: `
+ALTER TABLE memories ADD COLUMN scope TEXT NOT NULL DEFAULT 'project' CHECK(scope IN ('persona', 'project', 'channel'));
+ALTER TABLE memories ADD COLUMN expires_at DATETIME;
+UPDATE memories SET scope = 'persona' WHERE project_id IS NULL;
+CREATE INDEX idx_memories_channel ON memories(channel_id);
+`,
+	},
+	{
+		Version: 16,
+		SQL: `
+CREATE TABLE delegations (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_persona_id     INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    to_persona_id       INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    origin_channel_id   INTEGER REFERENCES channels(id) ON DELETE SET NULL,
+    thread_channel_id   INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    project_id          INTEGER REFERENCES projects(id) ON DELETE SET NULL,
+    instructions        TEXT NOT NULL,
+    status              TEXT NOT NULL DEFAULT 'running' CHECK(status IN ('running', 'completed', 'failed', 'timed_out')),
+    result              TEXT NOT NULL DEFAULT '',
+    error               TEXT NOT NULL DEFAULT '',
+    depth               INTEGER NOT NULL DEFAULT 1,
+    request_message_id  INTEGER,
+    response_message_id INTEGER,
+    created_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at         DATETIME
+);
+CREATE INDEX idx_delegations_from ON delegations(from_persona_id, id);
+CREATE INDEX idx_delegations_to ON delegations(to_persona_id, id);
+CREATE INDEX idx_delegations_origin ON delegations(origin_channel_id);
+`,
+	},
+	{
+		Version: 17,
+		SQL: `
+CREATE TABLE tasks (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    title               TEXT NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    status              TEXT NOT NULL DEFAULT 'todo' CHECK(status IN ('todo', 'in_progress', 'blocked', 'done', 'cancelled')),
+    assignee_user_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    assignee_persona_id INTEGER REFERENCES personas(id) ON DELETE SET NULL,
+    project_id          INTEGER REFERENCES projects(id) ON DELETE SET NULL,
+    channel_id          INTEGER REFERENCES channels(id) ON DELETE SET NULL,
+    parent_id           INTEGER REFERENCES tasks(id) ON DELETE SET NULL,
+    due_at              DATETIME,
+    created_by_type     TEXT NOT NULL CHECK(created_by_type IN ('human', 'agent')),
+    created_by_id       INTEGER NOT NULL,
+    created_by_name     TEXT NOT NULL,
+    created_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK(assignee_user_id IS NULL OR assignee_persona_id IS NULL)
+);
+CREATE INDEX idx_tasks_status ON tasks(status);
+CREATE INDEX idx_tasks_assignee_persona ON tasks(assignee_persona_id);
+CREATE INDEX idx_tasks_assignee_user ON tasks(assignee_user_id);
+CREATE INDEX idx_tasks_project ON tasks(project_id);
+CREATE INDEX idx_tasks_channel ON tasks(channel_id);
+CREATE INDEX idx_tasks_parent ON tasks(parent_id);
+
+CREATE TABLE task_events (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id     INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    kind        TEXT NOT NULL CHECK(kind IN ('created', 'updated', 'comment')),
+    author_type TEXT NOT NULL CHECK(author_type IN ('human', 'agent')),
+    author_id   INTEGER NOT NULL,
+    author_name TEXT NOT NULL,
+    body        TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_task_events_task ON task_events(task_id, id);
+`,
+	},
+	{
+		Version: 18,
+		SQL: `
+CREATE TABLE workflows (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          TEXT NOT NULL UNIQUE,
+    description   TEXT NOT NULL DEFAULT '',
+    definition    TEXT NOT NULL,
+    enabled       INTEGER NOT NULL DEFAULT 1,
+    webhook_token TEXT NOT NULL,
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE workflow_runs (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    workflow_id   INTEGER NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    definition    TEXT NOT NULL,
+    trigger       TEXT NOT NULL CHECK(trigger IN ('manual', 'command', 'schedule', 'webhook')),
+    input         TEXT NOT NULL DEFAULT '',
+    channel_id    INTEGER REFERENCES channels(id) ON DELETE SET NULL,
+    started_by    TEXT NOT NULL DEFAULT '',
+    status        TEXT NOT NULL DEFAULT 'running' CHECK(status IN ('running', 'completed', 'failed', 'cancelled')),
+    current_stage TEXT NOT NULL DEFAULT '',
+    error         TEXT NOT NULL DEFAULT '',
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at   DATETIME
+);
+CREATE INDEX idx_workflow_runs_workflow ON workflow_runs(workflow_id, id);
+CREATE INDEX idx_workflow_runs_status ON workflow_runs(status);
+
+CREATE TABLE workflow_stage_runs (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id       INTEGER NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+    stage        TEXT NOT NULL,
+    persona_id   INTEGER REFERENCES personas(id) ON DELETE SET NULL,
+    persona_name TEXT NOT NULL,
+    prompt       TEXT NOT NULL,
+    output       TEXT NOT NULL DEFAULT '',
+    status       TEXT NOT NULL DEFAULT 'running' CHECK(status IN ('running', 'completed', 'failed')),
+    error        TEXT NOT NULL DEFAULT '',
+    started_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at  DATETIME
+);
+CREATE INDEX idx_workflow_stage_runs_run ON workflow_stage_runs(run_id, id);
+`,
+	},
+	{
+		Version: 19,
+		SQL: `
+ALTER TABLE personas ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE persona_versions (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    persona_id          INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    version             INTEGER NOT NULL,
+    name                TEXT NOT NULL,
+    system_prompt       TEXT NOT NULL,
+    model               TEXT NOT NULL,
+    tools_enabled       TEXT NOT NULL,
+    temperature         REAL NOT NULL,
+    max_tokens          INTEGER NOT NULL,
+    cooldown_secs       INTEGER NOT NULL,
+    max_tokens_per_hour INTEGER NOT NULL,
+    created_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(persona_id, version)
+);
+INSERT INTO persona_versions (persona_id, version, name, system_prompt, model, tools_enabled, temperature,
+    max_tokens, cooldown_secs, max_tokens_per_hour, created_at)
+SELECT id, 1, name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs,
+    max_tokens_per_hour, COALESCE(created_at, CURRENT_TIMESTAMP)
+FROM personas;
+
+ALTER TABLE llm_calls ADD COLUMN persona_version INTEGER;
+ALTER TABLE tool_executions ADD COLUMN persona_version INTEGER;
+CREATE INDEX idx_llm_calls_persona_version ON llm_calls(persona_id, persona_version);
+CREATE INDEX idx_tool_executions_persona_version ON tool_executions(persona_id, persona_version);
+`,
+	},
+	{
+		Version: 20,
+		SQL: `
+CREATE TABLE persona_channel_settings (
+    persona_id    INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    channel_id    INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    model         TEXT,
+    temperature   REAL,
+    max_tokens    INTEGER,
+    cooldown_secs INTEGER,
+    reply_mode    TEXT NOT NULL DEFAULT '',
+    tools_enabled TEXT,
+    extra_prompt  TEXT NOT NULL DEFAULT '',
+    updated_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (persona_id, channel_id)
+);
+CREATE INDEX idx_persona_channel_settings_channel ON persona_channel_settings(channel_id);
+`,
+	},
+	{
+		Version: 21,
+		SQL: `
+CREATE TABLE agent_runs (
+    id          TEXT PRIMARY KEY,
+    persona_id  INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    channel_id  INTEGER REFERENCES channels(id) ON DELETE SET NULL,
+    trigger     TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL DEFAULT 'running' CHECK(status IN ('running', 'completed', 'failed', 'cancelled')),
+    reason      TEXT NOT NULL DEFAULT '',
+    output      TEXT NOT NULL DEFAULT '',
+    started_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME
+);
+CREATE INDEX idx_agent_runs_persona ON agent_runs(persona_id, started_at);
+CREATE INDEX idx_agent_runs_status ON agent_runs(status);
+
+ALTER TABLE tool_executions ADD COLUMN cancelled INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		Version: 22,
+		SQL: `
+CREATE TABLE reminders (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel_id   INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    text         TEXT NOT NULL,
+    due_at       DATETIME NOT NULL,
+    delivered_at DATETIME,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_reminders_due ON reminders(delivered_at, due_at);
+`,
+	},
+	{
+		Version: 23,
+		SQL: `
+CREATE TABLE actor_crashes (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    persona_id INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    error      TEXT NOT NULL,
+    stack      TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_actor_crashes_persona ON actor_crashes(persona_id, created_at);
+`,
+	},
+	{
+		Version: 24,
+		SQL: `
+CREATE TABLE agent_jobs (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    persona_id      INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    channel_id      INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    from_message_id INTEGER NOT NULL,
+    to_message_id   INTEGER NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'running', 'succeeded', 'failed', 'dead')),
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    claim_id        TEXT NOT NULL DEFAULT '',
+    next_attempt_at DATETIME,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_agent_jobs_queue ON agent_jobs(persona_id, channel_id, status);
+CREATE INDEX idx_agent_jobs_status ON agent_jobs(status, updated_at);
+`,
+	},
+	{
+		Version: 25,
+		SQL: `
+ALTER TABLE llm_calls ADD COLUMN run_id TEXT;
+ALTER TABLE tool_executions ADD COLUMN run_id TEXT;
+ALTER TABLE agent_runs ADD COLUMN last_message_id INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_llm_calls_run ON llm_calls(run_id);
+CREATE INDEX idx_tool_executions_run ON tool_executions(run_id);
+`,
+	},
+	{
+		Version: 26,
+		SQL: `
+CREATE TABLE eval_runs (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    provider   TEXT NOT NULL,
+    model      TEXT NOT NULL DEFAULT '',
+    scenarios  INTEGER NOT NULL DEFAULT 0,
+    passed     INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE eval_results (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    eval_run_id     INTEGER NOT NULL REFERENCES eval_runs(id) ON DELETE CASCADE,
+    scenario        TEXT NOT NULL,
+    persona_id      INTEGER REFERENCES personas(id) ON DELETE SET NULL,
+    persona_name    TEXT NOT NULL,
+    persona_version INTEGER NOT NULL DEFAULT 0,
+    model           TEXT NOT NULL DEFAULT '',
+    passed          INTEGER NOT NULL DEFAULT 0,
+    error           TEXT NOT NULL DEFAULT '',
+    output          TEXT NOT NULL DEFAULT '',
+    tool_calls_json TEXT NOT NULL DEFAULT '[]',
+    assertions_json TEXT NOT NULL DEFAULT '[]',
+    duration_ms     INTEGER NOT NULL DEFAULT 0,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_eval_results_run ON eval_results(eval_run_id);
+CREATE INDEX idx_eval_results_persona ON eval_results(persona_id, persona_version);
+`,
+	},
+	{
+		Version: 27,
+		SQL: `
+ALTER TABLE messages ADD COLUMN run_id TEXT;
+ALTER TABLE tool_executions ADD COLUMN channel_id INTEGER;
+ALTER TABLE tool_executions ADD COLUMN started_at DATETIME;
+ALTER TABLE llm_calls ADD COLUMN started_at DATETIME;
+ALTER TABLE llm_calls ADD COLUMN duration_ms INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_messages_run ON messages(run_id);
+`,
+	},
+	{
+		Version: 28,
+		SQL: `
+CREATE TABLE audit_events (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER,
+    username    TEXT NOT NULL DEFAULT '',
+    action      TEXT NOT NULL,
+    target      TEXT NOT NULL DEFAULT '',
+    status      INTEGER NOT NULL DEFAULT 0,
+    before_json TEXT,
+    after_json  TEXT,
+    diff        TEXT,
+    remote_addr TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_audit_events_created ON audit_events(created_at);
+CREATE INDEX idx_audit_events_user ON audit_events(user_id, created_at);
+CREATE INDEX idx_audit_events_target ON audit_events(target);
+`,
+	},
+	{
+		Version: 29,
+		SQL: `
+CREATE TABLE archives (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    persona_id INTEGER NOT NULL,
+    table_name TEXT NOT NULL,
+    file       TEXT NOT NULL UNIQUE,
+    row_count  INTEGER NOT NULL DEFAULT 0,
+    min_row_id INTEGER NOT NULL DEFAULT 0,
+    max_row_id INTEGER NOT NULL DEFAULT 0,
+    first_at   DATETIME,
+    last_at    DATETIME,
+    size_bytes INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_archives_persona ON archives(persona_id, table_name);
+`,
+	},
+	{
+		Version: 30,
+		SQL: `
+ALTER TABLE llm_calls ADD COLUMN restored_at DATETIME;
+ALTER TABLE tool_executions ADD COLUMN restored_at DATETIME;
+`,
+	},
+	{
+		Version: 31,
+		SQL: `
+ALTER TABLE changesets ADD COLUMN project_id INTEGER REFERENCES projects(id) ON DELETE SET NULL;
+`,
+	},
+	{
+		Version: 32,
+		SQL: `
+-- Widen the changeset status CHECK to include 'applying'. changeset_files is
+-- rebuilt against the new table first, since dropping changesets while it
+-- still references them would cascade-delete its rows.
+CREATE TABLE changesets_new (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    persona_id  INTEGER NOT NULL REFERENCES personas(id) ON DELETE CASCADE,
+    channel_id  INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    project_dir TEXT NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'applying', 'applied', 'partial', 'rejected')),
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at DATETIME,
+    project_id  INTEGER REFERENCES projects(id) ON DELETE SET NULL
+);
+INSERT INTO changesets_new (id, persona_id, channel_id, project_dir, status, created_at, resolved_at, project_id)
+    SELECT id, persona_id, channel_id, project_dir, status, created_at, resolved_at, project_id FROM changesets;
+
+CREATE TABLE changeset_files_new (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    changeset_id INTEGER NOT NULL REFERENCES changesets_new(id) ON DELETE CASCADE,
+    path         TEXT NOT NULL,
+    existed      INTEGER NOT NULL DEFAULT 1,
+    base_content TEXT NOT NULL,
+    new_content  TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'applied', 'partial', 'rejected')),
+    UNIQUE (changeset_id, path)
+);
+INSERT INTO changeset_files_new SELECT * FROM changeset_files;
+
+DROP TABLE changeset_files;
+DROP TABLE changesets;
+ALTER TABLE changesets_new RENAME TO changesets;
+ALTER TABLE changeset_files_new RENAME TO changeset_files;
+CREATE INDEX idx_changesets_channel ON changesets(channel_id, created_at);
+`,
+	},
+	{
+		Version: 33,
+		SQL: `
+-- Task event cursors were kept in actor_cursors under channel 0.
+CREATE TABLE actor_task_cursors (
+    persona_id         INTEGER PRIMARY KEY REFERENCES personas(id) ON DELETE CASCADE,
+    last_seen_event_id INTEGER NOT NULL DEFAULT 0,
+    updated_at         DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO actor_task_cursors (persona_id, last_seen_event_id, updated_at)
+    SELECT persona_id, last_seen_message_id, updated_at FROM actor_cursors
+    WHERE channel_id = 0 AND persona_id IN (SELECT id FROM personas);
+DELETE FROM actor_cursors WHERE channel_id = 0;
+`,
+	},
+	{
+		Version: 34,
+		SQL: `
+-- File-backed memories are keyed on the directory they were indexed from
+-- as well as the file, so each persona worktree keeps its own.
+ALTER TABLE memories ADD COLUMN source_dir TEXT NOT NULL DEFAULT '';
+UPDATE memories SET source_dir = COALESCE((SELECT path FROM projects WHERE projects.id = memories.project_id), '')
+    WHERE source_path != '';
+DROP INDEX idx_memories_source;
+CREATE UNIQUE INDEX idx_memories_source ON memories(project_id, source_dir, source_path) WHERE source_path != '';
+`,
+	},
+	{
+		Version: 35,
+		SQL:     `ALTER TABLE file_changes ADD COLUMN removed INTEGER NOT NULL DEFAULT 0;`,
+	},
 }
 
 // migrate runs all pending migrations inside a transaction.
@@ -0,0 +1,312 @@
+// Package diff computes line-based differences between texts and renders
+// them as unified diffs.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around each hunk.
+const DefaultContext = 3
+
+// Kind identifies how a line differs between the old and new text.
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Line is a single line of an edit script. Text includes its trailing
+// newline, if any.
+type Line struct {
+	Kind Kind
+	Text string
+}
+
+// Hunk is a contiguous group of changes with surrounding context. Start
+// positions are 1-based, matching unified diff headers.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// SplitLines splits s into lines, keeping each line's trailing newline so a
+// missing newline at end of file is preserved.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines returns the edit script that turns a into b.
+func Lines(a, b []string) []Line {
+	// Trim the common prefix and suffix so the quadratic part only sees the
+	// region that actually changed.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	out := make([]Line, 0, len(a)+len(b))
+	for _, l := range a[:pre] {
+		out = append(out, Line{Equal, l})
+	}
+	out = append(out, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		out = append(out, Line{Equal, l})
+	}
+	return out
+}
+
+// myers implements the O(ND) shortest edit script algorithm.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	total := n + m
+	offset := total + 1
+	v := make([]int, 2*total+3)
+	var trace [][]int
+
+	for d := 0; d <= total; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, offset, d)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(a, b []string, trace [][]int, offset, d int) []Line {
+	x, y := len(a), len(b)
+	var rev []Line
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, Line{Equal, a[x]})
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, Line{Insert, b[y]})
+		} else {
+			x--
+			rev = append(rev, Line{Delete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, Line{Equal, a[x]})
+	}
+
+	out := make([]Line, len(rev))
+	for i, l := range rev {
+		out[len(rev)-1-i] = l
+	}
+	return out
+}
+
+// Hunks groups an edit script into hunks with up to context unchanged lines
+// on either side of each change. Changes separated by no more than
+// 2*context unchanged lines share a hunk.
+func Hunks(lines []Line, context int) []Hunk {
+	n := len(lines)
+
+	// Line numbers in the old and new text at each script position.
+	oldAt := make([]int, n+1)
+	newAt := make([]int, n+1)
+	o, nw := 1, 1
+	for i, l := range lines {
+		oldAt[i], newAt[i] = o, nw
+		if l.Kind != Insert {
+			o++
+		}
+		if l.Kind != Delete {
+			nw++
+		}
+	}
+	oldAt[n], newAt[n] = o, nw
+
+	var hunks []Hunk
+	for _, sp := range spans(lines, context) {
+		h := Hunk{
+			OldStart: oldAt[sp[0]],
+			NewStart: newAt[sp[0]],
+			Lines:    append([]Line(nil), lines[sp[0]:sp[1]]...),
+		}
+		for _, l := range h.Lines {
+			if l.Kind != Insert {
+				h.OldLines++
+			}
+			if l.Kind != Delete {
+				h.NewLines++
+			}
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// spans returns the [start, end) script positions of each hunk.
+func spans(lines []Line, context int) [][2]int {
+	n := len(lines)
+	var out [][2]int
+	i := 0
+	for i < n {
+		if lines[i].Kind == Equal {
+			i++
+			continue
+		}
+
+		last := i
+		j := i + 1
+		for j < n {
+			if lines[j].Kind != Equal {
+				last = j
+				j++
+				continue
+			}
+			k := j
+			for k < n && lines[k].Kind == Equal {
+				k++
+			}
+			if k == n || k-j > 2*context {
+				break
+			}
+			j = k
+		}
+
+		start := max(i-context, 0)
+		end := min(last+1+context, n)
+		out = append(out, [2]int{start, end})
+		i = end
+	}
+	return out
+}
+
+// Apply returns a with only some of the changes that turn it into b applied.
+// Hunks are numbered from 0 in the order Unified prints them, using
+// DefaultContext; keep reports whether hunk i should be applied.
+func Apply(a, b string, keep func(i int) bool) string {
+	lines := Lines(SplitLines(a), SplitLines(b))
+	hunkAt := make([]int, len(lines))
+	for i := range hunkAt {
+		hunkAt[i] = -1
+	}
+	for h, sp := range spans(lines, DefaultContext) {
+		for i := sp[0]; i < sp[1]; i++ {
+			hunkAt[i] = h
+		}
+	}
+
+	var sb strings.Builder
+	for i, l := range lines {
+		switch {
+		case l.Kind == Equal:
+			sb.WriteString(l.Text)
+		case keep(hunkAt[i]):
+			if l.Kind == Insert {
+				sb.WriteString(l.Text)
+			}
+		case l.Kind == Delete:
+			sb.WriteString(l.Text)
+		}
+	}
+	return sb.String()
+}
+
+// Header returns the "@@ -a,b +c,d @@" line for a hunk.
+func (h Hunk) Header() string {
+	oldStart, newStart := h.OldStart, h.NewStart
+	if h.OldLines == 0 {
+		oldStart--
+	}
+	if h.NewLines == 0 {
+		newStart--
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, h.OldLines, newStart, h.NewLines)
+}
+
+// String renders the hunk in unified diff format.
+func (h Hunk) String() string {
+	var sb strings.Builder
+	sb.WriteString(h.Header())
+	sb.WriteString("\n")
+	for _, l := range h.Lines {
+		switch l.Kind {
+		case Equal:
+			sb.WriteString(" ")
+		case Delete:
+			sb.WriteString("-")
+		case Insert:
+			sb.WriteString("+")
+		}
+		sb.WriteString(l.Text)
+		if !strings.HasSuffix(l.Text, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
+
+// Unified returns a unified diff turning a into b, labelled with the given
+// file names. It returns "" when the texts are identical.
+func Unified(oldName, newName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	hunks := Hunks(Lines(SplitLines(a), SplitLines(b)), DefaultContext)
+	if len(hunks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		sb.WriteString(h.String())
+	}
+	return sb.String()
+}
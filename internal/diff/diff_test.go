@@ -0,0 +1,146 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// reconstruct rebuilds the old and new texts from an edit script.
+func reconstruct(lines []Line) (string, string) {
+	var a, b strings.Builder
+	for _, l := range lines {
+		if l.Kind != Insert {
+			a.WriteString(l.Text)
+		}
+		if l.Kind != Delete {
+			b.WriteString(l.Text)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func TestLinesRoundTrip(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\n", "x\na\nb\ny\nc\nz\n"},
+		{"one\ntwo\nthree", "one\n2\nthree"},
+		{"a\nb\nc\nd\ne\n", "e\nd\nc\nb\na\n"},
+	}
+	for _, tt := range tests {
+		a, b := reconstruct(Lines(SplitLines(tt.a), SplitLines(tt.b)))
+		if a != tt.a || b != tt.b {
+			t.Errorf("round trip %q -> %q gave %q -> %q", tt.a, tt.b, a, b)
+		}
+	}
+}
+
+func TestLinesMinimal(t *testing.T) {
+	script := Lines(SplitLines("a\nb\nc\n"), SplitLines("a\nB\nc\n"))
+	changes := 0
+	for _, l := range script {
+		if l.Kind != Equal {
+			changes++
+		}
+	}
+	if changes != 2 {
+		t.Errorf("expected 1 delete + 1 insert, got %d changes: %+v", changes, script)
+	}
+}
+
+func TestUnifiedSingleHunk(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n"
+
+	got := Unified("a/f.txt", "b/f.txt", a, b)
+	want := `--- a/f.txt
++++ b/f.txt
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`
+	if got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 30; i++ {
+		line := string(rune('a'+i%26)) + "\n"
+		a = append(a, line)
+		b = append(b, line)
+	}
+	b[2] = "changed\n"
+	b[25] = "changed too\n"
+
+	hunks := Hunks(Lines(a, b), DefaultContext)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(hunks))
+	}
+	if hunks[0].OldStart != 1 || hunks[1].OldStart != 23 {
+		t.Errorf("hunk starts = %d, %d", hunks[0].OldStart, hunks[1].OldStart)
+	}
+}
+
+func TestUnifiedIdentical(t *testing.T) {
+	if got := Unified("a", "b", "same\n", "same\n"); got != "" {
+		t.Errorf("expected empty diff, got %q", got)
+	}
+}
+
+func TestUnifiedNoTrailingNewline(t *testing.T) {
+	got := Unified("a", "b", "x\n", "x\ny")
+	if !strings.Contains(got, "+y\n\\ No newline at end of file\n") {
+		t.Errorf("missing no-newline marker:\n%s", got)
+	}
+}
+
+func TestUnifiedNewFile(t *testing.T) {
+	got := Unified("/dev/null", "b/new.txt", "", "hello\n")
+	if !strings.Contains(got, "@@ -0,0 +1,1 @@") {
+		t.Errorf("unexpected header for new file:\n%s", got)
+	}
+}
+
+func TestApplySelectedHunks(t *testing.T) {
+	var a, b strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&a, "line %d\n", i)
+		switch i {
+		case 2:
+			b.WriteString("first change\n")
+		case 25:
+			b.WriteString("second change\n")
+		default:
+			fmt.Fprintf(&b, "line %d\n", i)
+		}
+	}
+	before, after := a.String(), b.String()
+	if n := len(Hunks(Lines(SplitLines(before), SplitLines(after)), DefaultContext)); n != 2 {
+		t.Fatalf("got %d hunks, want 2", n)
+	}
+
+	if got := Apply(before, after, func(int) bool { return true }); got != after {
+		t.Errorf("applying all hunks:\n%s", got)
+	}
+	if got := Apply(before, after, func(int) bool { return false }); got != before {
+		t.Errorf("applying no hunks:\n%s", got)
+	}
+
+	got := Apply(before, after, func(i int) bool { return i == 1 })
+	if strings.Contains(got, "first change") || !strings.Contains(got, "second change") || !strings.Contains(got, "line 2\n") {
+		t.Errorf("applying second hunk only:\n%s", got)
+	}
+}
@@ -0,0 +1,137 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/agent"
+)
+
+// AssertionResult is the outcome of one assertion. A skipped assertion,
+// such as a rubric with no grader configured, doesn't fail the scenario.
+type AssertionResult struct {
+	Assertion
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Grader judges outputs against rubrics with an LLM.
+type Grader struct {
+	LLM   agent.LLMClient
+	Model string
+}
+
+const graderPrompt = `You grade the replies of a chat assistant. You are given the conversation, the assistant's reply and a rubric. Decide whether the reply meets the rubric.
+
+Answer with PASS or FAIL on the first line, then one sentence saying why.`
+
+// grade asks the grader whether output meets rubric.
+func (g *Grader) grade(ctx context.Context, s Scenario, output, rubric string) (bool, string, error) {
+	var convo strings.Builder
+	for _, m := range s.History {
+		fmt.Fprintf(&convo, "%s: %s\n", m.author(), m.Content)
+	}
+	prompt := fmt.Sprintf("Conversation:\n%s\nReply:\n%s\n\nRubric:\n%s", convo.String(), output, rubric)
+
+	resp, err := g.LLM.ChatCompletion(ctx, g.Model, []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(graderPrompt),
+		openai.UserMessage(prompt),
+	}, nil, 0, 200)
+	if err != nil {
+		return false, "", fmt.Errorf("grade: %w", err)
+	}
+	verdict, reason, _ := strings.Cut(strings.TrimSpace(resp.Content), "\n")
+	verdict = strings.ToUpper(strings.TrimSpace(verdict))
+	switch {
+	case strings.HasPrefix(verdict, "PASS"):
+		return true, strings.TrimSpace(reason), nil
+	case strings.HasPrefix(verdict, "FAIL"):
+		return false, strings.TrimSpace(reason), nil
+	}
+	return false, "", fmt.Errorf("grade: unexpected verdict %q", resp.Content)
+}
+
+// check evaluates the scenario's assertions against the persona's output
+// and tool calls.
+func check(ctx context.Context, s Scenario, output string, calls []ToolCall, grader *Grader) []AssertionResult {
+	results := make([]AssertionResult, len(s.Assertions))
+	for i, a := range s.Assertions {
+		r := AssertionResult{Assertion: a}
+		switch a.Type {
+		case AssertContains:
+			r.Passed = strings.Contains(output, a.Value)
+		case AssertNotContains:
+			r.Passed = !strings.Contains(output, a.Value)
+		case AssertRegex:
+			r.Passed = regexp.MustCompile(a.Pattern).MatchString(output)
+		case AssertToolCalled:
+			r.Passed, r.Detail = toolCalled(calls, a.Tool, a.Args)
+		case AssertRubric:
+			if grader == nil || grader.LLM == nil {
+				r.Skipped, r.Detail = true, "no grader configured"
+				break
+			}
+			passed, reason, err := grader.grade(ctx, s, output, a.Rubric)
+			if err != nil {
+				r.Detail = err.Error()
+				break
+			}
+			r.Passed, r.Detail = passed, reason
+		}
+		results[i] = r
+	}
+	return results
+}
+
+// toolCalled reports whether one of calls is to tool with args among its
+// arguments, describing the calls made otherwise.
+func toolCalled(calls []ToolCall, tool string, args map[string]any) (bool, string) {
+	var made []string
+	for _, c := range calls {
+		if c.Name != tool {
+			continue
+		}
+		var got map[string]any
+		if err := json.Unmarshal(c.Arguments, &got); err != nil && len(args) > 0 {
+			made = append(made, string(c.Arguments))
+			continue
+		}
+		if argsMatch(got, args) {
+			return true, ""
+		}
+		made = append(made, string(c.Arguments))
+	}
+	if len(made) == 0 {
+		return false, fmt.Sprintf("%s was not called", tool)
+	}
+	return false, fmt.Sprintf("%s was called with %s", tool, strings.Join(made, ", "))
+}
+
+// argsMatch reports whether got has every key in want with an equal value.
+func argsMatch(got, want map[string]any) bool {
+	for k, w := range want {
+		g, ok := got[k]
+		if !ok || !reflect.DeepEqual(normalizeJSON(g), normalizeJSON(w)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeJSON round-trips v through JSON so values written in Go and
+// decoded from JSON compare equal.
+func normalizeJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	json.Unmarshal(data, &out)
+	return out
+}
@@ -0,0 +1,168 @@
+package eval_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/eval"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func openTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+const readmeScenario = `{
+  "name": "reads the readme",
+  "persona": "helper",
+  "history": [{"author": "alice", "content": "What does the README say?"}],
+  "project": {"files": {"README.md": "hello world"}},
+  "script": [
+    {"tool_calls": [{"name": "file_read", "arguments": {"path": "README.md"}}]},
+    {"content": "It says hello world."}
+  ],
+  "assertions": [
+    {"type": "contains", "value": "hello world"},
+    {"type": "regex", "pattern": "(?i)^it says"},
+    {"type": "tool_called", "tool": "file_read", "args": {"path": "README.md"}},
+    {"type": "rubric", "rubric": "Quotes the README."}
+  ]
+}`
+
+const rudeScenario = `{
+  "name": "stays polite",
+  "persona": "helper",
+  "history": [{"content": "Hi"}],
+  "script": [{"content": "Go away."}],
+  "assertions": [
+    {"type": "not_contains", "value": "Go away"},
+    {"type": "tool_called", "tool": "shell_exec"}
+  ]
+}`
+
+func writeScenarios(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadScenarios(t *testing.T) {
+	dir := writeScenarios(t, map[string]string{"a.json": readmeScenario, "b.json": rudeScenario, "notes.txt": "ignored"})
+	scenarios, err := eval.LoadScenarios(dir)
+	if err != nil {
+		t.Fatalf("LoadScenarios: %v", err)
+	}
+	if len(scenarios) != 2 || scenarios[0].Name != "reads the readme" || scenarios[1].Name != "stays polite" {
+		t.Fatalf("scenarios = %+v", scenarios)
+	}
+
+	for name, bad := range map[string]string{
+		"unknown type":  `{"name": "x", "history": [{"content": "hi"}], "assertions": [{"type": "smells_like"}]}`,
+		"bad regex":     `{"name": "x", "history": [{"content": "hi"}], "assertions": [{"type": "regex", "pattern": "("}]}`,
+		"no history":    `{"name": "x", "assertions": [{"type": "contains", "value": "a"}]}`,
+		"no assertions": `{"name": "x", "history": [{"content": "hi"}]}`,
+	} {
+		dir := writeScenarios(t, map[string]string{"bad.json": bad})
+		if _, err := eval.LoadScenarios(dir); err == nil {
+			t.Errorf("%s: loaded without error", name)
+		}
+	}
+}
+
+func TestRunScriptedScenarios(t *testing.T) {
+	d := openTestDB(t)
+	p, err := model.CreatePersona(d, "helper", "You help.", "test-model", []string{"file_read", "shell_exec"}, 0.7, 100, 0, 0)
+	if err != nil {
+		t.Fatalf("create persona: %v", err)
+	}
+	scenarios, err := eval.LoadScenarios(writeScenarios(t, map[string]string{"a.json": readmeScenario, "b.json": rudeScenario}))
+	if err != nil {
+		t.Fatalf("LoadScenarios: %v", err)
+	}
+
+	runner := &eval.Runner{DB: d, Parallel: 2}
+	results := runner.Run(context.Background(), scenarios)
+
+	readme := results[0]
+	if !readme.Passed || readme.Error != "" {
+		t.Fatalf("readme scenario failed: %+v", readme)
+	}
+	if readme.Output != "It says hello world." || readme.PersonaID != p.ID || readme.PersonaVersion != 1 {
+		t.Errorf("readme result = %+v", readme)
+	}
+	if len(readme.ToolCalls) != 1 || readme.ToolCalls[0].Name != "file_read" {
+		t.Errorf("tool calls = %+v", readme.ToolCalls)
+	}
+	if rubric := readme.Assertions[3]; !rubric.Skipped {
+		t.Errorf("rubric without a grader = %+v, want skipped", rubric)
+	}
+
+	rude := results[1]
+	if rude.Passed {
+		t.Fatal("rude scenario passed")
+	}
+	for i, a := range rude.Assertions {
+		if a.Passed {
+			t.Errorf("assertion %d passed: %+v", i, a)
+		}
+	}
+	if !strings.Contains(rude.Assertions[1].Detail, "not called") {
+		t.Errorf("tool_called detail = %q", rude.Assertions[1].Detail)
+	}
+
+	report := eval.NewReport("script", "", results)
+	if md := report.Markdown(); !strings.Contains(md, "1 passed, 1 failed") || !strings.Contains(md, "## stays polite") {
+		t.Errorf("markdown report:\n%s", md)
+	}
+	run, err := report.Store(d)
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if run.Scenarios != 2 || run.Passed != 1 {
+		t.Errorf("stored run = %+v", run)
+	}
+	stored, _ := model.ListEvalResults(d, run.ID)
+	var assertions []eval.AssertionResult
+	if len(stored) != 2 || json.Unmarshal([]byte(stored[0].AssertionsJSON), &assertions) != nil || len(assertions) != 4 {
+		t.Errorf("stored results = %+v", stored)
+	}
+}
+
+// graderLLM grades every reply with verdict.
+type graderLLM struct{ verdict string }
+
+func (g graderLLM) ChatCompletion(_ context.Context, _ string, _ []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (llm.Response, error) {
+	return llm.Response{Content: g.verdict}, nil
+}
+
+func TestRubricGrading(t *testing.T) {
+	d := openTestDB(t)
+	model.CreatePersona(d, "helper", "You help.", "test-model", []string{"file_read"}, 0.7, 100, 0, 0)
+	scenarios, _ := eval.LoadScenarios(writeScenarios(t, map[string]string{"a.json": readmeScenario}))
+
+	for verdict, want := range map[string]bool{"PASS\nIt quotes it.": true, "FAIL\nIt doesn't.": false} {
+		runner := &eval.Runner{DB: d, Grader: &eval.Grader{LLM: graderLLM{verdict}, Model: "grader"}}
+		res := runner.Run(context.Background(), scenarios)[0]
+		if rubric := res.Assertions[3]; rubric.Passed != want || rubric.Skipped || res.Passed != want {
+			t.Errorf("verdict %q: rubric = %+v, passed = %v", verdict, rubric, res.Passed)
+		}
+	}
+}
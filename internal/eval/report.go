@@ -0,0 +1,132 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// Report summarizes an eval run. Provider names what the personas ran
+// against, e.g. "openrouter" or "script".
+type Report struct {
+	Provider string   `json:"provider"`
+	Model    string   `json:"model,omitempty"`
+	Passed   int      `json:"passed"`
+	Failed   int      `json:"failed"`
+	Results  []Result `json:"results"`
+}
+
+// NewReport summarizes results.
+func NewReport(provider, llmModel string, results []Result) Report {
+	r := Report{Provider: provider, Model: llmModel, Results: results}
+	for _, res := range results {
+		if res.Passed {
+			r.Passed++
+		} else {
+			r.Failed++
+		}
+	}
+	return r
+}
+
+// Markdown renders the report as a summary table followed by the details
+// of each failed scenario.
+func (r Report) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Eval report\n\nProvider: %s", r.Provider)
+	if r.Model != "" {
+		fmt.Fprintf(&sb, " (model %s)", r.Model)
+	}
+	fmt.Fprintf(&sb, "\n\n%d passed, %d failed\n\n", r.Passed, r.Failed)
+
+	sb.WriteString("| Scenario | Persona | Version | Result | Time |\n|---|---|---|---|---|\n")
+	for _, res := range r.Results {
+		fmt.Fprintf(&sb, "| %s | %s | %d | %s | %dms |\n",
+			res.Scenario, res.PersonaName, res.PersonaVersion, passFail(res.Passed), res.DurationMs)
+	}
+
+	for _, res := range r.Results {
+		if res.Passed {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n", res.Scenario)
+		if res.Error != "" {
+			fmt.Fprintf(&sb, "Error: %s\n\n", res.Error)
+		}
+		for _, a := range res.Assertions {
+			if a.Passed {
+				continue
+			}
+			status := "FAIL"
+			if a.Skipped {
+				status = "SKIP"
+			}
+			fmt.Fprintf(&sb, "- %s %s", status, describe(a.Assertion))
+			if a.Detail != "" {
+				fmt.Fprintf(&sb, ": %s", a.Detail)
+			}
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "\nOutput:\n\n```\n%s\n```\n", res.Output)
+	}
+	return sb.String()
+}
+
+func passFail(passed bool) string {
+	if passed {
+		return "pass"
+	}
+	return "FAIL"
+}
+
+// describe summarizes an assertion for the report.
+func describe(a Assertion) string {
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		return fmt.Sprintf("%s %q", a.Type, a.Value)
+	case AssertRegex:
+		return fmt.Sprintf("regex %q", a.Pattern)
+	case AssertToolCalled:
+		if len(a.Args) == 0 {
+			return "tool_called " + a.Tool
+		}
+		args, _ := json.Marshal(a.Args)
+		return fmt.Sprintf("tool_called %s with %s", a.Tool, args)
+	case AssertRubric:
+		return fmt.Sprintf("rubric %q", a.Rubric)
+	}
+	return a.Type
+}
+
+// Store saves the report as an eval run, so persona versions can be
+// compared across runs.
+func (r Report) Store(d *db.DB) (model.EvalRun, error) {
+	results := make([]model.EvalResult, len(r.Results))
+	for i, res := range r.Results {
+		calls, err := json.Marshal(res.ToolCalls)
+		if err != nil {
+			return model.EvalRun{}, err
+		}
+		assertions, err := json.Marshal(res.Assertions)
+		if err != nil {
+			return model.EvalRun{}, err
+		}
+		results[i] = model.EvalResult{
+			Scenario:       res.Scenario,
+			PersonaID:      res.PersonaID,
+			PersonaName:    res.PersonaName,
+			PersonaVersion: res.PersonaVersion,
+			Model:          res.Model,
+			Passed:         res.Passed,
+			Error:          res.Error,
+			Output:         res.Output,
+			ToolCallsJSON:  string(calls),
+			AssertionsJSON: string(assertions),
+			DurationMs:     res.DurationMs,
+		}
+	}
+	return model.CreateEvalRun(d, r.Provider, r.Model, results)
+}
@@ -0,0 +1,287 @@
+package eval
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/waynenilsen/waynebot/internal/agent"
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/llm"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/tools"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// DefaultParallel is how many scenarios run at once when Runner.Parallel
+// is zero.
+const DefaultParallel = 4
+
+// Runner puts personas through scenarios. Each scenario runs in a scratch
+// database of its own; the personas are read from DB, which is not written
+// to.
+type Runner struct {
+	DB *db.DB
+
+	// LLM is the provider the personas run against. When nil, each
+	// scenario's Script answers instead.
+	LLM agent.LLMClient
+
+	// Model and Persona, when set, replace the persona's model and the
+	// scenarios' persona.
+	Model   string
+	Persona string
+
+	// Grader grades rubric assertions; without one they are skipped.
+	Grader *Grader
+
+	Parallel int
+}
+
+// Result is the outcome of one scenario.
+type Result struct {
+	Scenario       string            `json:"scenario"`
+	Path           string            `json:"path,omitempty"`
+	PersonaID      int64             `json:"persona_id"`
+	PersonaName    string            `json:"persona_name"`
+	PersonaVersion int               `json:"persona_version"`
+	Model          string            `json:"model"`
+	Passed         bool              `json:"passed"`
+	Error          string            `json:"error,omitempty"`
+	Output         string            `json:"output"`
+	ToolCalls      []ToolCall        `json:"tool_calls"`
+	Assertions     []AssertionResult `json:"assertions"`
+	DurationMs     int64             `json:"duration_ms"`
+}
+
+// Run runs the scenarios, Parallel at a time, and returns their results in
+// the scenarios' order.
+func (r *Runner) Run(ctx context.Context, scenarios []Scenario) []Result {
+	parallel := r.Parallel
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+
+	hub := ws.NewHub()
+	go hub.Run()
+	defer hub.Stop()
+
+	results := make([]Result, len(scenarios))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, s := range scenarios {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = r.runScenario(ctx, hub, s)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Runner) runScenario(ctx context.Context, hub *ws.Hub, s Scenario) Result {
+	start := time.Now()
+	res := Result{Scenario: s.Name, Path: s.Path, ToolCalls: []ToolCall{}}
+	err := r.converse(ctx, hub, s, &res)
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if ctx.Err() == nil {
+		res.Assertions = check(ctx, s, res.Output, res.ToolCalls, r.Grader)
+	}
+	res.Passed = err == nil && ctx.Err() == nil
+	for _, a := range res.Assertions {
+		if !a.Passed && !a.Skipped {
+			res.Passed = false
+		}
+	}
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res
+}
+
+// converse sets up the scenario in a scratch database, has the persona
+// answer it and fills in res with what it said and did.
+func (r *Runner) converse(ctx context.Context, hub *ws.Hub, s Scenario, res *Result) error {
+	name := s.Persona
+	if r.Persona != "" {
+		name = r.Persona
+	}
+	if name == "" {
+		return errors.New("no persona to evaluate")
+	}
+	p, err := model.GetPersonaByName(r.DB, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("persona %q not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("persona %q: %w", name, err)
+	}
+	if r.Model != "" {
+		p.Model = r.Model
+	}
+	res.PersonaID, res.PersonaName, res.PersonaVersion, res.Model = p.ID, p.Name, p.Version, p.Model
+
+	dir, err := os.MkdirTemp("", "waynebot-eval-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	scratch, err := db.Open(filepath.Join(dir, "eval.db"))
+	if err != nil {
+		return err
+	}
+	defer scratch.Close()
+
+	persona, ch, baseDir, err := setUp(scratch, dir, p, s)
+	if err != nil {
+		return fmt.Errorf("set up scenario: %w", err)
+	}
+	lastID, err := model.GetLatestMessageID(scratch, ch.ID)
+	if err != nil {
+		return err
+	}
+
+	registry := tools.NewRegistry()
+	for tool, result := range s.ToolResults {
+		registry.Register(tool, func(context.Context, json.RawMessage) (string, error) { return result, nil })
+	}
+	registry.RegisterDefaults(baseDir)
+
+	client := r.LLM
+	if client == nil {
+		client = &scriptLLM{replies: s.Script}
+	}
+	a := &agent.Actor{
+		Persona:  persona,
+		DB:       scratch,
+		Hub:      hub,
+		LLM:      client,
+		Tools:    registry,
+		Status:   agent.NewStatusTracker(),
+		Cursors:  agent.NewCursorStore(scratch),
+		Decision: agent.NewDecisionMaker(),
+		Budget:   agent.NewBudgetChecker(scratch),
+	}
+	runErr := a.Respond(ctx, ch)
+
+	replies, err := model.GetMessagesSince(scratch, ch.ID, lastID)
+	if err != nil {
+		return err
+	}
+	var out []string
+	for _, m := range replies {
+		if m.AuthorType == "agent" && m.AuthorID == persona.ID {
+			out = append(out, m.Content)
+		}
+	}
+	res.Output = strings.Join(out, "\n\n")
+
+	execs, err := model.ListToolExecutions(scratch, persona.ID, 1000, 0)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(execs)
+	for _, e := range execs {
+		args := json.RawMessage(e.ArgsJSON)
+		if !json.Valid(args) {
+			args, _ = json.Marshal(e.ArgsJSON)
+		}
+		res.ToolCalls = append(res.ToolCalls, ToolCall{Name: e.ToolName, Arguments: args})
+	}
+	return runErr
+}
+
+// setUp creates the scenario's persona, channel, history and project in
+// scratch, returning the directory tools should work in.
+func setUp(scratch *db.DB, dir string, p model.Persona, s Scenario) (model.Persona, model.Channel, string, error) {
+	persona, err := model.CreatePersona(scratch, p.Name, p.SystemPrompt, p.Model, p.ToolsEnabled,
+		p.Temperature, p.MaxTokens, 0, 0)
+	if err != nil {
+		return model.Persona{}, model.Channel{}, "", err
+	}
+	persona.Version = p.Version
+
+	ch, err := model.CreateChannel(scratch, "eval", s.Description, 0)
+	if err != nil {
+		return model.Persona{}, model.Channel{}, "", err
+	}
+	for _, m := range s.History {
+		var authorID int64
+		if m.authorType() == "agent" && m.author() == persona.Name {
+			authorID = persona.ID
+		}
+		if _, err := model.CreateMessage(scratch, ch.ID, authorID, m.authorType(), m.author(), m.Content); err != nil {
+			return model.Persona{}, model.Channel{}, "", err
+		}
+	}
+
+	baseDir := filepath.Join(dir, "project")
+	if err := os.Mkdir(baseDir, 0o755); err != nil {
+		return model.Persona{}, model.Channel{}, "", err
+	}
+	if s.Project != nil {
+		for rel, content := range s.Project.Files {
+			path := filepath.Join(baseDir, filepath.FromSlash(rel))
+			if !strings.HasPrefix(path, baseDir+string(filepath.Separator)) {
+				return model.Persona{}, model.Channel{}, "", fmt.Errorf("project file %q is outside the project", rel)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return model.Persona{}, model.Channel{}, "", err
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return model.Persona{}, model.Channel{}, "", err
+			}
+		}
+		name := s.Project.Name
+		if name == "" {
+			name = "project"
+		}
+		proj, err := model.CreateProject(scratch, name, baseDir, "")
+		if err != nil {
+			return model.Persona{}, model.Channel{}, "", err
+		}
+		if err := model.SetChannelProject(scratch, ch.ID, proj.ID); err != nil {
+			return model.Persona{}, model.Channel{}, "", err
+		}
+	}
+	return persona, ch, baseDir, nil
+}
+
+// scriptLLM answers with a scenario's scripted replies in order.
+type scriptLLM struct {
+	mu      sync.Mutex
+	replies []Reply
+	next    int
+}
+
+func (l *scriptLLM) ChatCompletion(context.Context, string, []openai.ChatCompletionMessageParamUnion, []openai.ChatCompletionToolParam, float64, int) (llm.Response, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next >= len(l.replies) {
+		return llm.Response{}, fmt.Errorf("script has no reply for LLM call %d", l.next+1)
+	}
+	reply := l.replies[l.next]
+	l.next++
+
+	resp := llm.Response{Content: reply.Content}
+	for i, tc := range reply.ToolCalls {
+		resp.ToolCalls = append(resp.ToolCalls, llm.ToolCall{
+			ID:        fmt.Sprintf("call_%d_%d", l.next, i+1),
+			Name:      tc.Name,
+			Arguments: string(tc.Arguments),
+		})
+	}
+	return resp, nil
+}
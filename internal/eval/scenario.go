@@ -0,0 +1,189 @@
+// Package eval runs personas through scripted conversations and checks what
+// they answer and which tools they call, so prompt and context changes can
+// be measured instead of made blind.
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Assertion types.
+const (
+	AssertContains    = "contains"     // the output contains Value
+	AssertNotContains = "not_contains" // the output doesn't contain Value
+	AssertRegex       = "regex"        // the output matches Pattern
+	AssertToolCalled  = "tool_called"  // Tool was called, with Args among its arguments
+	AssertRubric      = "rubric"       // a grader model judges the output meets Rubric
+)
+
+// Scenario is a conversation to put a persona through, read from a JSON
+// file, and what its answer must satisfy.
+type Scenario struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Persona names the persona to evaluate; the eval command can
+	// override it.
+	Persona string `json:"persona"`
+
+	// History is the conversation the persona answers, oldest first.
+	History []Message `json:"history"`
+
+	// Project, when set, is written to a scratch directory and attached to
+	// the channel, so the persona's tools work on it.
+	Project *Project `json:"project,omitempty"`
+
+	// ToolResults stubs tools by name with a fixed result, e.g. to keep
+	// http_fetch offline. Other tools run for real against Project.
+	ToolResults map[string]string `json:"tool_results,omitempty"`
+
+	// Script is what the scripted provider answers, one reply per LLM call.
+	Script []Reply `json:"script,omitempty"`
+
+	Assertions []Assertion `json:"assertions"`
+
+	// Path is the file the scenario was read from.
+	Path string `json:"-"`
+}
+
+// Message is one message of a scenario's history. Author defaults to
+// "user" and AuthorType to "human".
+type Message struct {
+	Author     string `json:"author,omitempty"`
+	AuthorType string `json:"author_type,omitempty"`
+	Content    string `json:"content"`
+}
+
+func (m Message) author() string {
+	if m.Author == "" {
+		return "user"
+	}
+	return m.Author
+}
+
+func (m Message) authorType() string {
+	if m.AuthorType == "" {
+		return "human"
+	}
+	return m.AuthorType
+}
+
+// Project is a scenario's project fixture: file contents by relative path.
+type Project struct {
+	Name  string            `json:"name,omitempty"`
+	Files map[string]string `json:"files"`
+}
+
+// Reply is one scripted LLM reply: text, tool calls, or both.
+type Reply struct {
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// ToolCall is a tool the persona called, or is scripted to call.
+type ToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Assertion is a check on the persona's answer. Which fields apply depends
+// on Type.
+type Assertion struct {
+	Type    string         `json:"type"`
+	Value   string         `json:"value,omitempty"`
+	Pattern string         `json:"pattern,omitempty"`
+	Tool    string         `json:"tool,omitempty"`
+	Args    map[string]any `json:"args,omitempty"`
+	Rubric  string         `json:"rubric,omitempty"`
+}
+
+// Validate reports the first problem with the scenario, if any.
+func (s Scenario) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(s.History) == 0 {
+		return errors.New("history is empty")
+	}
+	if len(s.Assertions) == 0 {
+		return errors.New("no assertions")
+	}
+	for i, a := range s.Assertions {
+		if err := a.validate(); err != nil {
+			return fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (a Assertion) validate() error {
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		if a.Value == "" {
+			return fmt.Errorf("%s needs a value", a.Type)
+		}
+	case AssertRegex:
+		if _, err := regexp.Compile(a.Pattern); err != nil || a.Pattern == "" {
+			return fmt.Errorf("invalid pattern %q", a.Pattern)
+		}
+	case AssertToolCalled:
+		if a.Tool == "" {
+			return errors.New("tool_called needs a tool")
+		}
+	case AssertRubric:
+		if strings.TrimSpace(a.Rubric) == "" {
+			return errors.New("rubric needs a rubric")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", a.Type)
+	}
+	return nil
+}
+
+// LoadScenarios reads scenarios from the given files and directories; a
+// directory contributes its .json files. Scenarios are returned in path
+// order and validated.
+func LoadScenarios(paths ...string) ([]Scenario, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	scenarios := make([]Scenario, 0, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var s Scenario
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		s.Path = f
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
@@ -0,0 +1,73 @@
+// Package events is an in-process publish/subscribe bus for changes that
+// other parts of the server react to, such as personas being edited.
+package events
+
+import (
+	"slices"
+	"sync"
+)
+
+// Event types.
+const (
+	PersonaCreated = "persona.created"
+	PersonaUpdated = "persona.updated"
+	PersonaDeleted = "persona.deleted"
+)
+
+// Event is something that happened, identified by Type.
+type Event struct {
+	Type      string
+	PersonaID int64
+}
+
+// Bus delivers published events to its subscribers. A nil Bus drops them.
+// Goroutine-safe.
+type Bus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]func(Event)
+}
+
+// NewBus creates a Bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[int]func(Event))}
+}
+
+// Subscribe calls fn with every event published from now on, until the
+// returned function is called. Handlers run on the publisher's goroutine, so
+// they must not block for long.
+func (b *Bus) Subscribe(fn func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// Publish delivers e to every subscriber in the order they subscribed, and
+// returns once they have all handled it.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	ids := make([]int, 0, len(b.subs))
+	for id := range b.subs {
+		ids = append(ids, id)
+	}
+	fns := make([]func(Event), 0, len(ids))
+	slices.Sort(ids)
+	for _, id := range ids {
+		fns = append(fns, b.subs[id])
+	}
+	b.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(e)
+	}
+}
@@ -0,0 +1,40 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/events"
+)
+
+func TestBusDeliversInSubscriptionOrder(t *testing.T) {
+	bus := events.NewBus()
+	var got []string
+	bus.Subscribe(func(e events.Event) { got = append(got, "a:"+e.Type) })
+	bus.Subscribe(func(e events.Event) { got = append(got, "b:"+e.Type) })
+
+	bus.Publish(events.Event{Type: events.PersonaCreated, PersonaID: 1})
+
+	want := []string{"a:persona.created", "b:persona.created"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestBusUnsubscribe(t *testing.T) {
+	bus := events.NewBus()
+	var n int
+	unsubscribe := bus.Subscribe(func(events.Event) { n++ })
+
+	bus.Publish(events.Event{Type: events.PersonaUpdated})
+	unsubscribe()
+	bus.Publish(events.Event{Type: events.PersonaUpdated})
+
+	if n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+}
+
+func TestNilBusDropsEvents(t *testing.T) {
+	var bus *events.Bus
+	bus.Publish(events.Event{Type: events.PersonaDeleted, PersonaID: 1})
+}
@@ -3,6 +3,7 @@ package llm
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -21,6 +22,9 @@ type Response struct {
 	ToolCalls        []ToolCall
 	PromptTokens     int
 	CompletionTokens int
+	// Cost is what the call cost in US dollars, when the provider reports
+	// it.
+	Cost float64 `json:",omitempty"`
 }
 
 // ToolCall represents a single tool invocation requested by the model.
@@ -63,6 +67,8 @@ func (c *Client) ChatCompletion(
 	if len(tools) > 0 {
 		params.Tools = tools
 	}
+	// Ask OpenRouter to report what the call cost.
+	params.SetExtraFields(map[string]any{"usage": map[string]any{"include": true}})
 
 	completion, err := c.client.Chat.Completions.New(ctx, params)
 	if err != nil {
@@ -79,6 +85,9 @@ func (c *Client) ChatCompletion(
 		PromptTokens:     int(completion.Usage.PromptTokens),
 		CompletionTokens: int(completion.Usage.CompletionTokens),
 	}
+	if cost, ok := completion.Usage.JSON.ExtraFields["cost"]; ok {
+		resp.Cost, _ = strconv.ParseFloat(cost.Raw(), 64)
+	}
 
 	for _, tc := range choice.Message.ToolCalls {
 		resp.ToolCalls = append(resp.ToolCalls, ToolCall{
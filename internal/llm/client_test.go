@@ -26,6 +26,9 @@ func TestChatCompletionTextResponse(t *testing.T) {
 		if body["model"] != "test-model" {
 			t.Fatalf("unexpected model: %v", body["model"])
 		}
+		if usage, _ := body["usage"].(map[string]any); usage["include"] != true {
+			t.Fatalf("usage accounting not requested: %v", body["usage"])
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
@@ -47,6 +50,7 @@ func TestChatCompletionTextResponse(t *testing.T) {
 				"prompt_tokens":     10,
 				"completion_tokens": 5,
 				"total_tokens":      15,
+				"cost":              0.0042,
 			},
 		})
 	}))
@@ -77,6 +81,9 @@ func TestChatCompletionTextResponse(t *testing.T) {
 	if resp.PromptTokens != 10 {
 		t.Fatalf("got prompt tokens %d, want 10", resp.PromptTokens)
 	}
+	if resp.Cost != 0.0042 {
+		t.Fatalf("got cost %v, want 0.0042", resp.Cost)
+	}
 	if resp.CompletionTokens != 5 {
 		t.Fatalf("got completion tokens %d, want 5", resp.CompletionTokens)
 	}
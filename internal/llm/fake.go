@@ -0,0 +1,292 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// FakeModelPrefix marks persona models answered by the fake provider, e.g.
+// "fake" or "fake/reviewer".
+const FakeModelPrefix = "fake"
+
+// Completer is anything that answers chat completions. Client and Fake both
+// are.
+type Completer interface {
+	ChatCompletion(ctx context.Context, model string, messages []openai.ChatCompletionMessageParamUnion, tools []openai.ChatCompletionToolParam, temperature float64, maxTokens int) (Response, error)
+}
+
+// IsFakeModel reports whether model should be answered by the fake provider.
+func IsFakeModel(model string) bool {
+	return model == FakeModelPrefix || strings.HasPrefix(model, FakeModelPrefix+"/")
+}
+
+// FakeRule is one scripted answer. A rule applies when every condition it
+// sets holds; rules are tried in order and the first that applies answers.
+type FakeRule struct {
+	Name string `json:"name,omitempty"`
+
+	// Match is a case-insensitive substring of the last message's content.
+	Match string `json:"match,omitempty"`
+	// Regex is matched against the last message's content. Its submatches
+	// can be used in Content as $1, ${name} and so on.
+	Regex string `json:"regex,omitempty"`
+	// Role is the last message's role: system, user, assistant or tool.
+	Role string `json:"role,omitempty"`
+	// Model is the exact model asked for, e.g. "fake/reviewer".
+	Model string `json:"model,omitempty"`
+	// Times limits how often the rule answers; zero means no limit.
+	Times int `json:"times,omitempty"`
+
+	Content   string         `json:"content,omitempty"`
+	ToolCalls []FakeToolCall `json:"tool_calls,omitempty"`
+	// Error, when set, fails the call with this message instead.
+	Error string `json:"error,omitempty"`
+
+	LatencyMs        int     `json:"latency_ms,omitempty"`
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	Cost             float64 `json:"cost,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// FakeToolCall is a tool call a rule answers with.
+type FakeToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// FakeScript is the file format of a fake provider script.
+type FakeScript struct {
+	Rules []FakeRule `json:"rules"`
+	// Default answers when no rule applies. Without one the fake echoes the
+	// last message back.
+	Default *FakeRule `json:"default,omitempty"`
+}
+
+// Fake is an LLM provider that answers from a script instead of a model, for
+// working and testing offline.
+type Fake struct {
+	mu     sync.Mutex
+	script FakeScript
+	used   []int
+	calls  int
+}
+
+// NewFake returns a fake provider following script.
+func NewFake(script FakeScript) (*Fake, error) {
+	rules := append([]FakeRule(nil), script.Rules...)
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	script.Rules = rules
+	if script.Default != nil {
+		def := *script.Default
+		if err := def.compile(); err != nil {
+			return nil, fmt.Errorf("default rule: %w", err)
+		}
+		script.Default = &def
+	}
+	return &Fake{script: script, used: make([]int, len(rules))}, nil
+}
+
+// LoadFake reads a fake provider script from a JSON file. An empty path gives
+// a fake that echoes every last message back.
+func LoadFake(path string) (*Fake, error) {
+	var script FakeScript
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &script); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	return NewFake(script)
+}
+
+func (r *FakeRule) compile() error {
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return err
+		}
+		r.re = re
+	}
+	for _, tc := range r.ToolCalls {
+		if tc.Name == "" {
+			return errors.New("tool call without a name")
+		}
+		if len(tc.Arguments) > 0 && !json.Valid(tc.Arguments) {
+			return fmt.Errorf("tool call %s: arguments are not valid JSON", tc.Name)
+		}
+	}
+	return nil
+}
+
+// ChatCompletion answers with the first rule that applies to the last
+// message, after the rule's latency.
+func (f *Fake) ChatCompletion(ctx context.Context, model string, messages []openai.ChatCompletionMessageParamUnion, _ []openai.ChatCompletionToolParam, _ float64, _ int) (Response, error) {
+	role, last := lastMessage(messages)
+
+	f.mu.Lock()
+	f.calls++
+	call := f.calls
+	rule, match := f.pick(model, role, last)
+	f.mu.Unlock()
+
+	if rule == nil {
+		rule = &FakeRule{Content: "fake reply to: " + last}
+	}
+	if rule.LatencyMs > 0 {
+		t := time.NewTimer(time.Duration(rule.LatencyMs) * time.Millisecond)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return Response{}, ctx.Err()
+		case <-t.C:
+		}
+	}
+	if rule.Error != "" {
+		return Response{}, fmt.Errorf("chat completion: %s", rule.Error)
+	}
+
+	resp := Response{
+		Content:          rule.Content,
+		PromptTokens:     rule.PromptTokens,
+		CompletionTokens: rule.CompletionTokens,
+		Cost:             rule.Cost,
+	}
+	if rule.re != nil && match != nil {
+		resp.Content = string(rule.re.ExpandString(nil, rule.Content, last, match))
+	}
+	for i, tc := range rule.ToolCalls {
+		args := string(tc.Arguments)
+		if args == "" {
+			args = "{}"
+		}
+		resp.ToolCalls = append(resp.ToolCalls, ToolCall{
+			ID:        fmt.Sprintf("fake_%d_%d", call, i+1),
+			Name:      tc.Name,
+			Arguments: args,
+		})
+	}
+	if resp.PromptTokens == 0 {
+		resp.PromptTokens = estimateTokens(messages)
+	}
+	if resp.CompletionTokens == 0 {
+		resp.CompletionTokens = len(resp.Content)/4 + 1
+	}
+	return resp, nil
+}
+
+// pick returns the rule answering the call, and the regex submatch indexes
+// when the rule has a regex. f.mu must be held.
+func (f *Fake) pick(model, role, last string) (*FakeRule, []int) {
+	for i := range f.script.Rules {
+		r := &f.script.Rules[i]
+		if r.Times > 0 && f.used[i] >= r.Times {
+			continue
+		}
+		match, ok := r.applies(model, role, last)
+		if ok {
+			f.used[i]++
+			return r, match
+		}
+	}
+	if d := f.script.Default; d != nil {
+		match, _ := d.applies(model, role, last)
+		return d, match
+	}
+	return nil, nil
+}
+
+func (r *FakeRule) applies(model, role, last string) ([]int, bool) {
+	if r.Model != "" && r.Model != model {
+		return nil, false
+	}
+	if r.Role != "" && r.Role != role {
+		return nil, false
+	}
+	if r.Match != "" && !strings.Contains(strings.ToLower(last), strings.ToLower(r.Match)) {
+		return nil, false
+	}
+	if r.re == nil {
+		return nil, true
+	}
+	match := r.re.FindStringSubmatchIndex(last)
+	return match, match != nil
+}
+
+// lastMessage returns the role and text content of the last message.
+func lastMessage(messages []openai.ChatCompletionMessageParamUnion) (role, content string) {
+	if len(messages) == 0 {
+		return "", ""
+	}
+	return messageText(messages[len(messages)-1])
+}
+
+// messageText flattens a message to its role and text, whether its content
+// is a string or a list of parts.
+func messageText(m openai.ChatCompletionMessageParamUnion) (role, content string) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", ""
+	}
+	var msg struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if json.Unmarshal(data, &msg) != nil {
+		return "", ""
+	}
+	if json.Unmarshal(msg.Content, &content) == nil {
+		return msg.Role, content
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(msg.Content, &parts)
+	texts := make([]string, len(parts))
+	for i, p := range parts {
+		texts[i] = p.Text
+	}
+	return msg.Role, strings.Join(texts, "")
+}
+
+// estimateTokens guesses a prompt's token count at four characters a token.
+func estimateTokens(messages []openai.ChatCompletionMessageParamUnion) int {
+	n := 0
+	for _, m := range messages {
+		_, content := messageText(m)
+		n += len(content)/4 + 1
+	}
+	return n
+}
+
+// Router sends fake models to Fake and everything else to Default, so single
+// personas can be switched to the fake provider by their model.
+type Router struct {
+	Default Completer
+	Fake    *Fake
+}
+
+// ChatCompletion answers with Fake when model is a fake model.
+func (r *Router) ChatCompletion(ctx context.Context, model string, messages []openai.ChatCompletionMessageParamUnion, tools []openai.ChatCompletionToolParam, temperature float64, maxTokens int) (Response, error) {
+	if IsFakeModel(model) {
+		return r.Fake.ChatCompletion(ctx, model, messages, tools, temperature, maxTokens)
+	}
+	return r.Default.ChatCompletion(ctx, model, messages, tools, temperature, maxTokens)
+}
@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func TestFakeRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.json")
+	os.WriteFile(path, []byte(`{
+		"rules": [
+			{"name": "read", "match": "README", "role": "user",
+			 "tool_calls": [{"name": "file_read", "arguments": {"path": "README.md"}}]},
+			{"role": "tool", "regex": "^(?P<first>\\w+)", "content": "The file starts with ${first}.", "completion_tokens": 7},
+			{"match": "flaky", "times": 1, "error": "rate limited"},
+			{"model": "fake/reviewer", "content": "LGTM", "prompt_tokens": 100}
+		],
+		"default": {"content": "I don't know."}
+	}`), 0o644)
+	f, err := LoadFake(path)
+	if err != nil {
+		t.Fatalf("LoadFake: %v", err)
+	}
+	ctx := context.Background()
+	ask := func(model string, msgs ...openai.ChatCompletionMessageParamUnion) (Response, error) {
+		return f.ChatCompletion(ctx, model, msgs, nil, 0.7, 100)
+	}
+
+	resp, err := ask("fake", openai.SystemMessage("be brief"), openai.UserMessage("alice: what's in the readme?"))
+	if err != nil || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "file_read" {
+		t.Fatalf("read = %+v %v", resp, err)
+	}
+	var args map[string]string
+	json.Unmarshal([]byte(resp.ToolCalls[0].Arguments), &args)
+	if args["path"] != "README.md" || resp.ToolCalls[0].ID == "" || resp.PromptTokens == 0 {
+		t.Errorf("read = %+v", resp)
+	}
+
+	resp, _ = ask("fake", openai.UserMessage("readme"), openai.ToolMessage("Hello world", resp.ToolCalls[0].ID))
+	if resp.Content != "The file starts with Hello." || resp.CompletionTokens != 7 {
+		t.Errorf("tool result = %+v", resp)
+	}
+
+	if _, err := ask("fake", openai.UserMessage("bob: flaky?")); err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("first flaky = %v, want rate limited", err)
+	}
+	if resp, err := ask("fake", openai.UserMessage("bob: flaky?")); err != nil || resp.Content != "I don't know." {
+		t.Errorf("second flaky = %+v %v, want default", resp, err)
+	}
+
+	if resp, _ := ask("fake/reviewer", openai.UserMessage("bob: review this")); resp.Content != "LGTM" || resp.PromptTokens != 100 {
+		t.Errorf("reviewer = %+v", resp)
+	}
+}
+
+func TestFakeEchoAndLatency(t *testing.T) {
+	f, err := LoadFake("")
+	if err != nil {
+		t.Fatalf("LoadFake: %v", err)
+	}
+	resp, err := f.ChatCompletion(context.Background(), "fake", []openai.ChatCompletionMessageParamUnion{openai.UserMessage("alice: hi")}, nil, 0, 0)
+	if err != nil || resp.Content != "fake reply to: alice: hi" {
+		t.Errorf("echo = %+v %v", resp, err)
+	}
+
+	slow, _ := NewFake(FakeScript{Rules: []FakeRule{{Content: "late", LatencyMs: 50}}})
+	start := time.Now()
+	if resp, _ := slow.ChatCompletion(context.Background(), "fake", nil, nil, 0, 0); resp.Content != "late" || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("latency = %+v after %v", resp, time.Since(start))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := slow.ChatCompletion(ctx, "fake", nil, nil, 0, 0); err != context.Canceled {
+		t.Errorf("cancelled = %v", err)
+	}
+
+	if _, err := NewFake(FakeScript{Rules: []FakeRule{{Regex: "("}}}); err == nil {
+		t.Error("bad regex accepted")
+	}
+}
+
+func TestRouter(t *testing.T) {
+	fake, _ := NewFake(FakeScript{Default: &FakeRule{Content: "fake"}})
+	real, _ := NewFake(FakeScript{Default: &FakeRule{Content: "real"}})
+	r := &Router{Default: real, Fake: fake}
+	for model, want := range map[string]string{"fake": "fake", "fake/x": "fake", "fakeish": "real", "openai/gpt-4o": "real"} {
+		if resp, _ := r.ChatCompletion(context.Background(), model, nil, nil, 0, 0); resp.Content != want {
+			t.Errorf("%s answered by %q, want %q", model, resp.Content, want)
+		}
+	}
+}
@@ -32,7 +32,7 @@ var allTools = map[string]openai.ChatCompletionToolParam{
 	"file_read": {
 		Function: shared.FunctionDefinitionParam{
 			Name:        "file_read",
-			Description: param.NewOpt("Read the contents of a file in the project directory."),
+			Description: param.NewOpt("Read the contents of a file in the project directory, optionally limited to a range of lines."),
 			Parameters: shared.FunctionParameters{
 				"type": "object",
 				"properties": map[string]any{
@@ -40,6 +40,14 @@ var allTools = map[string]openai.ChatCompletionToolParam{
 						"type":        "string",
 						"description": "Relative path to the file to read.",
 					},
+					"start_line": map[string]any{
+						"type":        "integer",
+						"description": "First line to read (1-based, inclusive). Defaults to the start of the file.",
+					},
+					"end_line": map[string]any{
+						"type":        "integer",
+						"description": "Last line to read (1-based, inclusive). Defaults to the end of the file.",
+					},
 				},
 				"required": []string{"path"},
 			},
@@ -65,6 +73,93 @@ var allTools = map[string]openai.ChatCompletionToolParam{
 			},
 		},
 	},
+	"file_edit": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "file_edit",
+			Description: param.NewOpt("Replace an exact string in a file in the project directory and return a unified diff of the change. old_string must match exactly once unless replace_all is set."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Relative path to the file to edit.",
+					},
+					"old_string": map[string]any{
+						"type":        "string",
+						"description": "Exact text to replace, including whitespace. Include enough surrounding lines to make it unique.",
+					},
+					"new_string": map[string]any{
+						"type":        "string",
+						"description": "Replacement text.",
+					},
+					"replace_all": map[string]any{
+						"type":        "boolean",
+						"description": "Replace every occurrence instead of requiring a unique match.",
+					},
+				},
+				"required": []string{"path", "old_string", "new_string"},
+			},
+		},
+	},
+	"file_list": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "file_list",
+			Description: param.NewOpt("List files in the project directory, skipping .git, node_modules and .gitignore'd paths."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Glob to filter paths, e.g. \"*.go\" or \"internal/**/*_test.go\". A pattern without a slash matches file names at any depth.",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Relative directory to list. Defaults to the project root.",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of files to return (default 500).",
+					},
+				},
+			},
+		},
+	},
+	"file_grep": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "file_grep",
+			Description: param.NewOpt("Search files in the project directory for a regular expression. Results are formatted as path:line:text."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Regular expression (Go RE2 syntax) to search for.",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Relative file or directory to search. Defaults to the project root.",
+					},
+					"glob": map[string]any{
+						"type":        "string",
+						"description": "Only search files matching this glob, e.g. \"*.go\".",
+					},
+					"context": map[string]any{
+						"type":        "integer",
+						"description": "Lines of context to show around each match (max 10).",
+					},
+					"ignore_case": map[string]any{
+						"type":        "boolean",
+						"description": "Match case-insensitively.",
+					},
+					"max_results": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of matching lines to return (default 200).",
+					},
+				},
+				"required": []string{"pattern"},
+			},
+		},
+	},
 	"http_fetch": {
 		Function: shared.FunctionDefinitionParam{
 			Name:        "http_fetch",
@@ -122,21 +217,159 @@ var allTools = map[string]openai.ChatCompletionToolParam{
 			},
 		},
 	},
+	"git_status": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "git_status",
+			Description: param.NewOpt("Show the git working tree status (current branch and changed files) of the project repository."),
+			Parameters: shared.FunctionParameters{
+				"type":       "object",
+				"properties": map[string]any{},
+			},
+		},
+	},
+	"git_diff": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "git_diff",
+			Description: param.NewOpt("Show changes in the project repository as a unified diff. By default shows unstaged changes."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"staged": map[string]any{
+						"type":        "boolean",
+						"description": "If true, show staged changes instead of unstaged ones.",
+					},
+					"ref": map[string]any{
+						"type":        "string",
+						"description": "Optional commit or branch to diff the working tree against.",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Optional relative path to limit the diff to.",
+					},
+				},
+			},
+		},
+	},
+	"git_log": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "git_log",
+			Description: param.NewOpt("List recent commits in the project repository, newest first."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of commits to return. Defaults to 20.",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Optional relative path to limit the history to.",
+					},
+				},
+			},
+		},
+	},
+	"git_commit": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "git_commit",
+			Description: param.NewOpt("Stage and commit changes in the project repository. Stages the given paths, or all changes if no paths are given."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"message": map[string]any{
+						"type":        "string",
+						"description": "The commit message.",
+					},
+					"paths": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Relative paths to stage. Omit to stage everything.",
+					},
+				},
+				"required": []string{"message"},
+			},
+		},
+	},
+	"git_branch": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "git_branch",
+			Description: param.NewOpt("List, create, or switch branches in the project repository."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"action": map[string]any{
+						"type":        "string",
+						"enum":        []string{"list", "create", "switch"},
+						"description": "The action to perform. Defaults to list.",
+					},
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Branch name (required for create and switch).",
+					},
+				},
+			},
+		},
+	},
+	"memory_forget": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "memory_forget",
+			Description: param.NewOpt("Delete a memory that is wrong or no longer useful, including its markdown file if it has one."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "integer",
+						"description": "The memory ID (shown as #id by memory_list and memory_search).",
+					},
+				},
+				"required": []string{"id"},
+			},
+		},
+	},
+	"memory_list": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "memory_list",
+			Description: param.NewOpt("List the memories you can see: your private memories, the current project's memories and the current channel's memories."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"scope": map[string]any{
+						"type":        "string",
+						"enum":        []string{"persona", "project", "channel"},
+						"description": "Only list memories with this scope.",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of memories to list (default 50, max 200).",
+					},
+				},
+			},
+		},
+	},
 	"memory_save": {
 		Function: shared.FunctionDefinitionParam{
 			Name:        "memory_save",
-			Description: param.NewOpt("Save a memory to a markdown file in the project's ./memories/ directory. Use this to persist important facts, decisions, or preferences for future reference. The filename is auto-generated from the current date and a kebab-case title you provide."),
+			Description: param.NewOpt("Save a memory for future reference. Use this to persist important facts, decisions, or preferences. Project memories are also written to a markdown file in ./memories/, named from the current date and a kebab-case title you provide. Saving something nearly identical to an existing memory updates that memory instead."),
 			Parameters: shared.FunctionParameters{
 				"type": "object",
 				"properties": map[string]any{
 					"title": map[string]any{
 						"type":        "string",
-						"description": "Short kebab-case title for the memory file (e.g. 'user-prefers-go', 'db-migration-plan').",
+						"description": "Short kebab-case title for the memory (e.g. 'user-prefers-go', 'db-migration-plan').",
 					},
 					"content": map[string]any{
 						"type":        "string",
 						"description": "The memory content to save (markdown).",
 					},
+					"scope": map[string]any{
+						"type":        "string",
+						"enum":        []string{"persona", "project", "channel"},
+						"description": "Who can see the memory: only you (persona), everyone working in the project (project), or everyone in this channel (channel). Defaults to project when the channel has a project, otherwise persona.",
+					},
+					"ttl_days": map[string]any{
+						"type":        "integer",
+						"description": "Forget the memory after this many days. Omit for memories that stay relevant.",
+					},
 				},
 				"required": []string{"title", "content"},
 			},
@@ -145,19 +378,51 @@ var allTools = map[string]openai.ChatCompletionToolParam{
 	"memory_search": {
 		Function: shared.FunctionDefinitionParam{
 			Name:        "memory_search",
-			Description: param.NewOpt("Search memory files in the project's ./memories/ directory using keyword grep. Returns matching lines with filenames. Use this to recall past decisions, facts, or context."),
+			Description: param.NewOpt("Search saved memories, including markdown files in the project's ./memories/ directory, ranked by keyword and semantic similarity. Returns the best matches with their content. Use this to recall past decisions, facts, or context."),
 			Parameters: shared.FunctionParameters{
 				"type": "object",
 				"properties": map[string]any{
 					"query": map[string]any{
 						"type":        "string",
-						"description": "Keywords to search for in memory files.",
+						"description": "What to recall, as keywords or a natural-language question.",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of memories to return (default 5, max 20).",
 					},
 				},
 				"required": []string{"query"},
 			},
 		},
 	},
+	"memory_update": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "memory_update",
+			Description: param.NewOpt("Correct or refresh an existing memory. Omitted fields are left unchanged."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "integer",
+						"description": "The memory ID (shown as #id by memory_list and memory_search).",
+					},
+					"title": map[string]any{
+						"type":        "string",
+						"description": "New title.",
+					},
+					"content": map[string]any{
+						"type":        "string",
+						"description": "New content (markdown), replacing the old content.",
+					},
+					"ttl_days": map[string]any{
+						"type":        "integer",
+						"description": "Forget the memory this many days from now; 0 removes any expiry.",
+					},
+				},
+				"required": []string{"id"},
+			},
+		},
+	},
 	"message_react": {
 		Function: shared.FunctionDefinitionParam{
 			Name:        "message_react",
@@ -182,6 +447,175 @@ var allTools = map[string]openai.ChatCompletionToolParam{
 			},
 		},
 	},
+	"task_create": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "task_create",
+			Description: param.NewOpt("Add a task to the shared task board. It is linked to the current channel and project."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"title": map[string]any{
+						"type":        "string",
+						"description": "Short title of the task.",
+					},
+					"description": map[string]any{
+						"type":        "string",
+						"description": "What needs to be done and how to tell it is finished.",
+					},
+					"assignee": map[string]any{
+						"type":        "string",
+						"description": "Persona name or username to assign. Leave empty to leave it for someone to claim.",
+					},
+					"parent_id": map[string]any{
+						"type":        "integer",
+						"description": "ID of the task this is a subtask of.",
+					},
+					"project_id": map[string]any{
+						"type":        "integer",
+						"description": "Project the task belongs to. Defaults to the current project.",
+					},
+					"due": map[string]any{
+						"type":        "string",
+						"description": "Due date as YYYY-MM-DD or an RFC 3339 time.",
+					},
+				},
+				"required": []string{"title"},
+			},
+		},
+	},
+	"task_list": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "task_list",
+			Description: param.NewOpt("List tasks on the shared task board, most recently updated first."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"status": map[string]any{
+						"type":        "string",
+						"enum":        []string{"todo", "in_progress", "blocked", "done", "cancelled"},
+						"description": "Only list tasks with this status.",
+					},
+					"mine": map[string]any{
+						"type":        "boolean",
+						"description": "Only list tasks assigned to you.",
+					},
+					"unassigned": map[string]any{
+						"type":        "boolean",
+						"description": "Only list tasks nobody is assigned to.",
+					},
+					"parent_id": map[string]any{
+						"type":        "integer",
+						"description": "Only list subtasks of this task.",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of tasks to list. Defaults to 20.",
+					},
+				},
+			},
+		},
+	},
+	"task_claim": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "task_claim",
+			Description: param.NewOpt("Assign an unassigned task to yourself and start it."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "integer",
+						"description": "The task ID.",
+					},
+				},
+				"required": []string{"id"},
+			},
+		},
+	},
+	"task_update": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "task_update",
+			Description: param.NewOpt("Change a task's status, assignee, title, description or due date. Only the fields given are changed."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "integer",
+						"description": "The task ID.",
+					},
+					"status": map[string]any{
+						"type":        "string",
+						"enum":        []string{"todo", "in_progress", "blocked", "done", "cancelled"},
+						"description": "New status.",
+					},
+					"assignee": map[string]any{
+						"type":        "string",
+						"description": "Persona name or username to assign; empty to unassign.",
+					},
+					"title": map[string]any{
+						"type":        "string",
+						"description": "New title.",
+					},
+					"description": map[string]any{
+						"type":        "string",
+						"description": "New description.",
+					},
+					"due": map[string]any{
+						"type":        "string",
+						"description": "New due date as YYYY-MM-DD or an RFC 3339 time; empty to clear it.",
+					},
+				},
+				"required": []string{"id"},
+			},
+		},
+	},
+	"task_comment": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "task_comment",
+			Description: param.NewOpt("Comment on a task, e.g. to report progress or ask a question."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "integer",
+						"description": "The task ID.",
+					},
+					"body": map[string]any{
+						"type":        "string",
+						"description": "The comment.",
+					},
+				},
+				"required": []string{"id", "body"},
+			},
+		},
+	},
+	"delegate": {
+		Function: shared.FunctionDefinitionParam{
+			Name:        "delegate",
+			Description: param.NewOpt("Hand a subtask to another persona and wait for its answer. The exchange is kept in a DM thread between the two of you."),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"persona": map[string]any{
+						"type":        "string",
+						"description": "Name (or ID) of the persona to delegate to.",
+					},
+					"instructions": map[string]any{
+						"type":        "string",
+						"description": "What the persona should do and what to report back. It sees only these instructions, not this conversation.",
+					},
+					"project_id": map[string]any{
+						"type":        "integer",
+						"description": "Project the persona should work in. Defaults to the current project.",
+					},
+					"timeout_secs": map[string]any{
+						"type":        "integer",
+						"description": "Seconds to wait for the answer. Defaults to 300, at most 1800.",
+					},
+				},
+				"required": []string{"persona", "instructions"},
+			},
+		},
+	},
 }
 
 // ToolsForPersona returns the openai tool params for tools enabled on the given persona.
@@ -53,12 +53,17 @@ func TestToolsForPersonaUnknownTool(t *testing.T) {
 
 func TestAllToolNames(t *testing.T) {
 	names := AllToolNames()
-	if len(names) != 8 {
-		t.Fatalf("got %d tool names, want 8", len(names))
+	expected := []string{
+		"delegate", "file_edit", "file_grep", "file_list", "file_read", "file_write",
+		"git_branch", "git_commit", "git_diff", "git_log", "git_status",
+		"http_fetch", "memory_forget", "memory_list", "memory_save", "memory_search", "memory_update", "message_react", "project_docs", "shell_exec",
+		"task_claim", "task_comment", "task_create", "task_list", "task_update",
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("got %d tool names, want %d", len(names), len(expected))
 	}
 
 	sort.Strings(names)
-	expected := []string{"file_read", "file_write", "http_fetch", "memory_save", "memory_search", "message_react", "project_docs", "shell_exec"}
 	for i, name := range names {
 		if name != expected[i] {
 			t.Fatalf("got name %q at index %d, want %q", name, i, expected[i])
@@ -0,0 +1,127 @@
+// Package memory stores agent memories with vector embeddings and ranks
+// them against a query by combining keyword and semantic similarity.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Embedder turns texts into fixed-length vectors. Name identifies the
+// embedding space so vectors from different embedders are never compared.
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// DefaultHashDims is the vector size used by NewHashEmbedder.
+const DefaultHashDims = 512
+
+// HashEmbedder is a local embedder that needs no network or model files. It
+// hashes word and character-trigram features into a fixed number of
+// dimensions with sublinear term-frequency weighting, so texts sharing
+// vocabulary (including word stems) land close together.
+type HashEmbedder struct {
+	Dims int
+}
+
+// NewHashEmbedder returns a HashEmbedder with DefaultHashDims dimensions.
+func NewHashEmbedder() *HashEmbedder {
+	return &HashEmbedder{Dims: DefaultHashDims}
+}
+
+// Name implements Embedder.
+func (h *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", h.Dims)
+}
+
+// Embed implements Embedder.
+func (h *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i] = h.embed(t)
+	}
+	return out, nil
+}
+
+func (h *HashEmbedder) embed(text string) []float32 {
+	features := make(map[string]float64)
+	for _, w := range tokenize(text) {
+		if stopwords[w] {
+			continue
+		}
+		features["w:"+w]++
+		padded := "^" + w + "$"
+		runes := []rune(padded)
+		for i := 0; i+3 <= len(runes); i++ {
+			features["c:"+string(runes[i:i+3])] += 0.25
+		}
+	}
+
+	v := make([]float32, h.Dims)
+	for f, tf := range features {
+		hash := fnv.New64a()
+		hash.Write([]byte(f))
+		sum := hash.Sum64()
+		weight := 1 + math.Log(tf)
+		if tf < 1 {
+			weight = tf
+		}
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		v[sum%uint64(h.Dims)] += float32(weight)
+	}
+	normalize(v)
+	return v
+}
+
+// tokenize lowercases text and splits it into letter/digit runs.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "in": true, "is": true, "it": true, "of": true,
+	"on": true, "or": true, "that": true, "the": true, "this": true, "to": true, "was": true,
+	"we": true, "with": true,
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// cosine returns the cosine similarity of a and b, or 0 if their lengths
+// differ or either is zero.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
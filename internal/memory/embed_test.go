@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHashEmbedderSimilarity(t *testing.T) {
+	e := NewHashEmbedder()
+	vecs, err := e.Embed(context.Background(), []string{
+		"The database migration plan uses versioned SQL files",
+		"How do we migrate the database schema?",
+		"Alice prefers dark roast coffee in the morning",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range vecs {
+		if len(v) != DefaultHashDims {
+			t.Fatalf("vector %d has %d dims", i, len(v))
+		}
+		var sum float64
+		for _, x := range v {
+			sum += float64(x) * float64(x)
+		}
+		if math.Abs(sum-1) > 1e-4 {
+			t.Errorf("vector %d norm² = %f, want 1", i, sum)
+		}
+	}
+
+	related, unrelated := cosine(vecs[0], vecs[1]), cosine(vecs[0], vecs[2])
+	if related <= unrelated {
+		t.Errorf("related similarity %.3f <= unrelated %.3f", related, unrelated)
+	}
+
+	again, _ := e.Embed(context.Background(), []string{"The database migration plan uses versioned SQL files"})
+	if cosine(vecs[0], again[0]) < 0.9999 {
+		t.Error("embedding is not deterministic")
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	var gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		gotModel = req.Model
+		// Return the vectors out of order to check they are placed by index.
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","model":"m","data":[
+			{"object":"embedding","index":1,"embedding":[0,1]},
+			{"object":"embedding","index":0,"embedding":[1,0]}
+		],"usage":{"prompt_tokens":2,"total_tokens":2}}`))
+	}))
+	defer srv.Close()
+
+	e := NewOpenAIEmbedder(srv.URL+"/v1", "key", "test-embed")
+	vecs, err := e.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotModel != "test-embed" || e.Name() != "test-embed" {
+		t.Errorf("model = %q, name = %q", gotModel, e.Name())
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][1] != 1 {
+		t.Errorf("unexpected vectors: %v", vecs)
+	}
+}
@@ -0,0 +1,445 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// Ranking weights. A result's score is VectorWeight times its cosine
+// similarity plus the remainder times its normalized BM25 keyword score.
+const (
+	VectorWeight = 0.6
+	MinScore     = 0.1
+
+	// DuplicateThreshold is the cosine similarity above which a new memory
+	// is treated as a restatement of an existing one in the same scope.
+	DuplicateThreshold = 0.9
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Dir is the project subdirectory holding markdown memories.
+const Dir = "memories"
+
+// backgroundIndexTimeout bounds an IndexDir run started by IndexInBackground.
+const backgroundIndexTimeout = 2 * time.Minute
+
+// Store saves memories to the database and searches them.
+type Store struct {
+	DB       *db.DB
+	Embedder Embedder
+
+	// mu serializes writes so file indexing and saves don't race on the
+	// unique source path, and re-embedding doesn't overwrite an edit.
+	mu sync.Mutex
+
+	// bgMu guards indexing and indexed. indexing holds the project
+	// directories being indexed in the background, true once another run
+	// has been asked for; indexed the directories indexed since the store
+	// was created.
+	bgMu     sync.Mutex
+	indexing map[indexKey]bool
+	indexed  map[indexKey]bool
+	bg       sync.WaitGroup
+}
+
+// indexKey identifies one directory of a project: its main checkout or a
+// persona's worktree.
+type indexKey struct {
+	projectID int64
+	dir       string
+}
+
+// NewStore returns a Store using the given embedder.
+func NewStore(d *db.DB, e Embedder) *Store {
+	return &Store{DB: d, Embedder: e}
+}
+
+// Result is a memory ranked against a query.
+type Result struct {
+	Memory  model.Memory
+	Score   float64
+	Keyword float64
+	Vector  float64
+}
+
+// Save embeds and stores a memory. A memory with a SourcePath replaces any
+// existing memory for the same file in the same SourceDir.
+func (s *Store) Save(ctx context.Context, m model.Memory) (model.Memory, error) {
+	vecs, err := s.Embedder.Embed(ctx, []string{embedText(m)})
+	if err != nil {
+		return model.Memory{}, err
+	}
+	m.Embedding, m.EmbeddingModel = vecs[0], s.Embedder.Name()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.SourcePath != "" {
+		existing, err := model.GetMemoryBySource(s.DB, m.ProjectID, m.SourceDir, m.SourcePath)
+		if err == nil {
+			if err := model.UpdateMemoryContent(s.DB, existing.ID, m.Title, m.Content, m.Embedding, m.EmbeddingModel); err != nil {
+				return model.Memory{}, err
+			}
+			return model.GetMemory(s.DB, existing.ID)
+		}
+		if err != sql.ErrNoRows {
+			return model.Memory{}, err
+		}
+	}
+	return model.CreateMemory(s.DB, m)
+}
+
+// Update re-embeds and saves a memory's editable fields.
+func (s *Store) Update(ctx context.Context, m model.Memory) (model.Memory, error) {
+	vecs, err := s.Embedder.Embed(ctx, []string{embedText(m)})
+	if err != nil {
+		return model.Memory{}, err
+	}
+	m.Embedding, m.EmbeddingModel = vecs[0], s.Embedder.Name()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := model.UpdateMemory(s.DB, m); err != nil {
+		return model.Memory{}, err
+	}
+	return model.GetMemory(s.DB, m.ID)
+}
+
+// FindDuplicate returns the existing memory in m's scope most similar to m,
+// if any is at least DuplicateThreshold similar.
+func (s *Store) FindDuplicate(ctx context.Context, m model.Memory) (model.Memory, bool, error) {
+	filter := model.MemoryFilter{Scope: m.Scope}
+	switch m.Scope {
+	case model.MemoryScopePersona:
+		filter.PersonaID = m.PersonaID
+	case model.MemoryScopeProject:
+		filter.ProjectID = m.ProjectID
+	case model.MemoryScopeChannel:
+		filter.ChannelID = m.ChannelID
+	}
+	candidates, err := model.ListMemories(s.DB, filter)
+	if err != nil || len(candidates) == 0 {
+		return model.Memory{}, false, err
+	}
+	if err := s.reembed(ctx, candidates); err != nil {
+		return model.Memory{}, false, err
+	}
+	vecs, err := s.Embedder.Embed(ctx, []string{embedText(m)})
+	if err != nil {
+		return model.Memory{}, false, err
+	}
+
+	best, bestScore := -1, DuplicateThreshold
+	for i, c := range candidates {
+		if score := cosine(vecs[0], c.Embedding); score >= bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return model.Memory{}, false, nil
+	}
+	return candidates[best], true, nil
+}
+
+// Search ranks the memories matching filter against query and returns at
+// most limit results scoring at least MinScore, best first. Memories without
+// an embedding from the current embedder are embedded first.
+func (s *Store) Search(ctx context.Context, query string, filter model.MemoryFilter, limit int) ([]Result, error) {
+	memories, err := model.ListMemories(s.DB, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(memories) == 0 {
+		return nil, nil
+	}
+	if err := s.reembed(ctx, memories); err != nil {
+		return nil, err
+	}
+	vecs, err := s.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	keyword := bm25(query, memories)
+	maxKeyword := 0.0
+	for _, k := range keyword {
+		maxKeyword = math.Max(maxKeyword, k)
+	}
+
+	var results []Result
+	for i, m := range memories {
+		r := Result{Memory: m, Vector: math.Max(cosine(vecs[0], m.Embedding), 0)}
+		if maxKeyword > 0 {
+			r.Keyword = keyword[i] / maxKeyword
+		}
+		r.Score = VectorWeight*r.Vector + (1-VectorWeight)*r.Keyword
+		if r.Score >= MinScore {
+			results = append(results, r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// reembed embeds memories whose vectors are missing or came from another
+// embedder, updating them in place and in the database. A memory edited
+// while it was being embedded keeps the embedding its edit saved.
+func (s *Store) reembed(ctx context.Context, memories []model.Memory) error {
+	var idx []int
+	var texts []string
+	for i, m := range memories {
+		if m.Embedding == nil || m.EmbeddingModel != s.Embedder.Name() {
+			idx = append(idx, i)
+			texts = append(texts, embedText(m))
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+	vecs, err := s.Embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for j, i := range idx {
+		memories[i].Embedding, memories[i].EmbeddingModel = vecs[j], s.Embedder.Name()
+		current, err := model.GetMemory(s.DB, memories[i].ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if embedText(current) != texts[j] {
+			continue
+		}
+		if err := model.SetMemoryEmbedding(s.DB, memories[i].ID, vecs[j], s.Embedder.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timestampPrefix matches the date prefix memory_save puts on filenames.
+var timestampPrefix = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-`)
+
+// TitleFromFilename derives a memory title from a markdown filename.
+func TitleFromFilename(name string) string {
+	return timestampPrefix.ReplaceAllString(strings.TrimSuffix(name, ".md"), "")
+}
+
+// IndexDir syncs the memories/*.md files in one of the project's
+// directories into the store: new files are added, changed files
+// re-embedded and memories whose file was deleted removed. Memories from the
+// project's other directories, such as another persona's worktree, are left
+// alone.
+func (s *Store) IndexDir(ctx context.Context, projectID int64, projectDir string) error {
+	projectDir = filepath.Clean(projectDir)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	memories, err := model.ListMemories(s.DB, model.MemoryFilter{ProjectID: projectID, IncludeExpired: true})
+	if err != nil {
+		return err
+	}
+	bySource := make(map[string]model.Memory)
+	for _, m := range memories {
+		if m.SourceDir == projectDir && strings.HasPrefix(m.SourcePath, Dir+"/") {
+			bySource[m.SourcePath] = m
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(projectDir, Dir, "*.md"))
+	if err != nil {
+		return err
+	}
+	var pending []model.Memory
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read memory file: %w", err)
+		}
+		rel := Dir + "/" + filepath.Base(p)
+		seen[rel] = true
+		existing, ok := bySource[rel]
+		if ok && existing.Content == string(data) {
+			continue
+		}
+		existing.ProjectID = projectID
+		existing.SourcePath = rel
+		existing.SourceDir = projectDir
+		existing.Title = TitleFromFilename(filepath.Base(p))
+		existing.Content = string(data)
+		pending = append(pending, existing)
+	}
+
+	if len(pending) > 0 {
+		texts := make([]string, len(pending))
+		for i, m := range pending {
+			texts[i] = embedText(m)
+		}
+		vecs, err := s.Embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for i, m := range pending {
+			m.Embedding, m.EmbeddingModel = vecs[i], s.Embedder.Name()
+			if m.ID != 0 {
+				err = model.UpdateMemoryContent(s.DB, m.ID, m.Title, m.Content, m.Embedding, m.EmbeddingModel)
+			} else {
+				_, err = model.CreateMemory(s.DB, m)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for path, m := range bySource {
+		if !seen[path] {
+			if err := model.DeleteMemory(s.DB, m.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.bgMu.Lock()
+	if s.indexed == nil {
+		s.indexed = make(map[indexKey]bool)
+	}
+	s.indexed[indexKey{projectID, projectDir}] = true
+	s.bgMu.Unlock()
+	return nil
+}
+
+// IndexInBackground runs IndexDir for the project directory on its own
+// goroutine, e.g. after one of its memory files changed. Calls while a run
+// is in progress for the directory are folded into a single run after it.
+func (s *Store) IndexInBackground(projectID int64, projectDir string) {
+	key := indexKey{projectID, filepath.Clean(projectDir)}
+	s.bgMu.Lock()
+	defer s.bgMu.Unlock()
+	if _, running := s.indexing[key]; running {
+		s.indexing[key] = true
+		return
+	}
+	if s.indexing == nil {
+		s.indexing = make(map[indexKey]bool)
+	}
+	s.indexing[key] = false
+
+	s.bg.Add(1)
+	go func() {
+		defer s.bg.Done()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), backgroundIndexTimeout)
+			if err := s.IndexDir(ctx, projectID, projectDir); err != nil {
+				slog.Warn("memory: index project memories", "project_id", projectID, "dir", projectDir, "error", err)
+			}
+			cancel()
+
+			s.bgMu.Lock()
+			again := s.indexing[key]
+			if !again {
+				delete(s.indexing, key)
+			} else {
+				s.indexing[key] = false
+			}
+			s.bgMu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// EnsureIndexed starts indexing the project directory in the background
+// unless it has been indexed since the store was created.
+func (s *Store) EnsureIndexed(projectID int64, projectDir string) {
+	s.bgMu.Lock()
+	done := s.indexed[indexKey{projectID, filepath.Clean(projectDir)}]
+	s.bgMu.Unlock()
+	if !done {
+		s.IndexInBackground(projectID, projectDir)
+	}
+}
+
+// Wait blocks until background indexing has finished.
+func (s *Store) Wait() {
+	s.bg.Wait()
+}
+
+func embedText(m model.Memory) string {
+	return m.Title + "\n" + m.Content
+}
+
+// bm25 scores each memory's title and content against the query terms using
+// document frequencies from the memories themselves.
+func bm25(query string, memories []model.Memory) []float64 {
+	terms := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if !stopwords[t] {
+			terms[t] = true
+		}
+	}
+	scores := make([]float64, len(memories))
+	if len(terms) == 0 {
+		return scores
+	}
+
+	docs := make([]map[string]int, len(memories))
+	lengths := make([]int, len(memories))
+	total := 0
+	df := make(map[string]int)
+	for i, m := range memories {
+		tf := make(map[string]int)
+		for _, t := range tokenize(embedText(m)) {
+			tf[t]++
+			lengths[i]++
+		}
+		for t := range terms {
+			if tf[t] > 0 {
+				df[t]++
+			}
+		}
+		docs[i] = tf
+		total += lengths[i]
+	}
+	avg := float64(total) / float64(len(memories))
+	if avg == 0 {
+		return scores
+	}
+
+	n := float64(len(memories))
+	for i, tf := range docs {
+		for t := range terms {
+			f := float64(tf[t])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			scores[i] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/avg))
+		}
+	}
+	return scores
+}
@@ -0,0 +1,221 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func openTestStore(t *testing.T) (*Store, *db.DB) {
+	t.Helper()
+	d, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return NewStore(d, NewHashEmbedder()), d
+}
+
+func TestStoreSearchRanksRelevantFirst(t *testing.T) {
+	s, d := openTestStore(t)
+	ctx := context.Background()
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+
+	for _, m := range []model.Memory{
+		{Title: "coffee", Content: "Alice prefers dark roast coffee."},
+		{Title: "db-migrations", Content: "Schema migrations are versioned Go structs applied at startup."},
+		{Title: "deploys", Content: "Deploys go out on Tuesdays after the release review."},
+	} {
+		m.PersonaID = p.ID
+		if _, err := s.Save(ctx, m); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	results, err := s.Search(ctx, "how are database migrations applied", model.MemoryFilter{PersonaID: p.ID}, 5)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) == 0 || results[0].Memory.Title != "db-migrations" {
+		t.Fatalf("expected db-migrations first, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Memory.Title == "coffee" {
+			t.Errorf("unrelated memory returned with score %.3f", r.Score)
+		}
+	}
+}
+
+func TestStoreReembedsOnEmbedderChange(t *testing.T) {
+	s, _ := openTestStore(t)
+	ctx := context.Background()
+	m, err := s.Save(ctx, model.Memory{Title: "t", Content: "release checklist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Embedder = &HashEmbedder{Dims: 64}
+	results, err := s.Search(ctx, "release checklist", model.MemoryFilter{}, 5)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search = %v, %v", results, err)
+	}
+	got, _ := model.GetMemory(s.DB, m.ID)
+	if got.EmbeddingModel != "hash-64" || len(got.Embedding) != 64 {
+		t.Errorf("memory not re-embedded: model %q, %d dims", got.EmbeddingModel, len(got.Embedding))
+	}
+}
+
+// editingEmbedder runs edit, once, in the middle of an Embed call.
+type editingEmbedder struct {
+	*HashEmbedder
+	edit func()
+}
+
+func (e *editingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if edit := e.edit; edit != nil {
+		e.edit = nil
+		edit()
+	}
+	return e.HashEmbedder.Embed(ctx, texts)
+}
+
+func TestStoreReembedKeepsConcurrentEdit(t *testing.T) {
+	s, d := openTestStore(t)
+	ctx := context.Background()
+	m, err := s.Save(ctx, model.Memory{Title: "t", Content: "release checklist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := &HashEmbedder{Dims: 64}
+	edited, _ := hash.Embed(ctx, []string{"t\nrelease checklist v2"})
+	s.Embedder = &editingEmbedder{HashEmbedder: hash, edit: func() {
+		if err := model.UpdateMemoryContent(d, m.ID, "t", "release checklist v2", edited[0], hash.Name()); err != nil {
+			t.Errorf("UpdateMemoryContent: %v", err)
+		}
+	}}
+	if _, err := s.Search(ctx, "release checklist", model.MemoryFilter{}, 5); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	got, _ := model.GetMemory(d, m.ID)
+	if !slices.Equal(got.Embedding, edited[0]) {
+		t.Error("re-embedding overwrote the embedding saved by a concurrent edit")
+	}
+}
+
+func TestStoreIndexDir(t *testing.T) {
+	s, d := openTestStore(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	p, err := model.CreateProject(d, "proj", dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memDir := filepath.Join(dir, Dir)
+	os.MkdirAll(memDir, 0o755)
+	os.WriteFile(filepath.Join(memDir, "2024-01-02-10-30-user-prefers-go.md"), []byte("The user prefers Go."), 0o644)
+	os.WriteFile(filepath.Join(memDir, "notes.md"), []byte("Staging runs on port 8080."), 0o644)
+
+	if err := s.IndexDir(ctx, p.ID, dir); err != nil {
+		t.Fatalf("IndexDir: %v", err)
+	}
+	list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID})
+	if len(list) != 2 || list[0].Title != "user-prefers-go" || list[0].SourcePath != "memories/2024-01-02-10-30-user-prefers-go.md" {
+		t.Fatalf("unexpected memories: %+v", list)
+	}
+
+	os.WriteFile(filepath.Join(memDir, "notes.md"), []byte("Staging runs on port 9090."), 0o644)
+	os.Remove(filepath.Join(memDir, "2024-01-02-10-30-user-prefers-go.md"))
+	if err := s.IndexDir(ctx, p.ID, dir); err != nil {
+		t.Fatalf("IndexDir: %v", err)
+	}
+	list, _ = model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID})
+	if len(list) != 1 || list[0].Content != "Staging runs on port 9090." {
+		t.Fatalf("unexpected memories after reindex: %+v", list)
+	}
+
+	results, err := s.Search(ctx, "what port does staging use", model.MemoryFilter{ProjectID: p.ID}, 5)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search = %+v, %v", results, err)
+	}
+}
+
+func TestStoreIndexDirKeepsOtherWorktrees(t *testing.T) {
+	s, d := openTestStore(t)
+	ctx := context.Background()
+	p, _ := model.CreateProject(d, "proj", t.TempDir(), "")
+	treeA, treeB := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(treeA, Dir), 0o755)
+	os.MkdirAll(filepath.Join(treeB, Dir), 0o755)
+	os.WriteFile(filepath.Join(treeA, Dir, "notes.md"), []byte("Staging runs on port 8080."), 0o644)
+	os.WriteFile(filepath.Join(treeB, Dir, "notes.md"), []byte("Deploys happen on Tuesdays."), 0o644)
+	os.WriteFile(filepath.Join(treeB, Dir, "ports.md"), []byte("The API listens on 9090."), 0o644)
+
+	if err := s.IndexDir(ctx, p.ID, treeB); err != nil {
+		t.Fatalf("IndexDir B: %v", err)
+	}
+	if err := s.IndexDir(ctx, p.ID, treeA); err != nil {
+		t.Fatalf("IndexDir A: %v", err)
+	}
+	list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID})
+	if len(list) != 3 {
+		t.Fatalf("got %d memories after indexing both worktrees, want 3: %+v", len(list), list)
+	}
+	for _, m := range list {
+		if m.SourceDir != treeA && m.SourceDir != treeB {
+			t.Errorf("memory %q has source dir %q", m.SourcePath, m.SourceDir)
+		}
+	}
+
+	// Indexing one worktree is not a reason to skip the other.
+	s2 := NewStore(d, NewHashEmbedder())
+	os.Remove(filepath.Join(treeB, Dir, "ports.md"))
+	s2.EnsureIndexed(p.ID, treeA)
+	s2.EnsureIndexed(p.ID, treeB)
+	s2.Wait()
+	list, _ = model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID})
+	if len(list) != 2 {
+		t.Fatalf("got %d memories after removing a file in B, want 2: %+v", len(list), list)
+	}
+	for _, m := range list {
+		if m.SourcePath == "memories/ports.md" {
+			t.Error("memory whose file was removed from B was kept")
+		}
+	}
+}
+
+func TestStoreIndexInBackground(t *testing.T) {
+	s, d := openTestStore(t)
+	dir := t.TempDir()
+	p, _ := model.CreateProject(d, "proj", dir, "")
+	memDir := filepath.Join(dir, Dir)
+	os.MkdirAll(memDir, 0o755)
+	os.WriteFile(filepath.Join(memDir, "notes.md"), []byte("Staging runs on port 8080."), 0o644)
+
+	s.EnsureIndexed(p.ID, dir)
+	s.Wait()
+	if list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID}); len(list) != 1 {
+		t.Fatalf("got %d memories after first use, want 1", len(list))
+	}
+
+	// Once indexed, only a change reindexes the project.
+	os.WriteFile(filepath.Join(memDir, "more.md"), []byte("Deploys happen on Tuesdays."), 0o644)
+	s.EnsureIndexed(p.ID, dir)
+	s.Wait()
+	if list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID}); len(list) != 1 {
+		t.Fatalf("reindexed an indexed project: %d memories", len(list))
+	}
+	s.IndexInBackground(p.ID, dir)
+	s.IndexInBackground(p.ID, dir)
+	s.Wait()
+	if list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID}); len(list) != 2 {
+		t.Fatalf("got %d memories after the change, want 2", len(list))
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var (
+	// LLMCallDuration is labelled persona, model and outcome (ok or error).
+	LLMCallDuration = NewHistogram("waynebot_llm_call_duration_seconds",
+		"LLM chat completion latency.",
+		[]float64{0.25, 0.5, 1, 2, 5, 10, 20, 40, 80, 160}, "persona", "model", "outcome")
+	// LLMTokens is labelled persona, model and kind (prompt or completion).
+	LLMTokens = NewCounter("waynebot_llm_tokens_total",
+		"Tokens used by LLM calls.", "persona", "model", "kind")
+	// LLMCost is labelled persona and model.
+	LLMCost = NewCounter("waynebot_llm_cost_dollars_total",
+		"Cost of LLM calls in US dollars, as reported by the provider.", "persona", "model")
+
+	// ToolExecutions and ToolDuration are labelled tool and outcome (ok,
+	// error or cancelled).
+	ToolExecutions = NewCounter("waynebot_tool_executions_total",
+		"Tool executions.", "tool", "outcome")
+	ToolDuration = NewHistogram("waynebot_tool_execution_duration_seconds",
+		"Tool execution duration.",
+		[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120}, "tool", "outcome")
+
+	// WSDroppedBroadcasts counts events dropped because the hub's broadcast
+	// channel was full.
+	WSDroppedBroadcasts = NewCounter("waynebot_ws_dropped_broadcasts_total",
+		"WebSocket events dropped because the hub's broadcast channel was full.")
+	// WSSlowClientDisconnects counts clients disconnected because their send
+	// buffer was full.
+	WSSlowClientDisconnects = NewCounter("waynebot_ws_slow_client_disconnects_total",
+		"WebSocket clients disconnected for not keeping up.")
+
+	// DBWriteLockWait is how long writes waited for the database write lock.
+	DBWriteLockWait = NewHistogram("waynebot_db_write_lock_wait_seconds",
+		"Time spent waiting for the database write lock.",
+		[]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5})
+
+	// ConnectorPolls is labelled connector and result (ok, error or
+	// connect_error).
+	ConnectorPolls = NewCounter("waynebot_connector_polls_total",
+		"Connector polls by result.", "connector", "result")
+	// ConnectorMessages is labelled connector.
+	ConnectorMessages = NewCounter("waynebot_connector_messages_total",
+		"Messages posted by connectors.", "connector")
+
+	// HTTPRequests is labelled method, route and code; HTTPDuration method
+	// and route.
+	HTTPRequests = NewCounter("waynebot_http_requests_total",
+		"HTTP requests by route and status code.", "method", "route", "code")
+	HTTPDuration = NewHistogram("waynebot_http_request_duration_seconds",
+		"HTTP request duration by route.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "method", "route")
+)
+
+// Outcome labels a result as "ok" or "error".
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Middleware records HTTP request metrics under the chi route pattern, so
+// /api/channels/1/messages and /api/channels/2/messages share a series.
+// Requests that match no route are recorded as "unmatched".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		HTTPRequests.Inc(r.Method, route, strconv.Itoa(code))
+		HTTPDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
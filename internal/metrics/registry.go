@@ -0,0 +1,271 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes
+// them in the Prometheus text exposition format for GET /metrics.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metric families by name.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Default is the registry the package-level constructors register with and
+// Handler serves.
+var Default = NewRegistry()
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+
+	// collect, for gauge funcs, reports the current values at scrape time.
+	collect func(emit func(v float64, labelValues ...string))
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+}
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cur, ok := r.families[f.name]; ok && f.collect == nil {
+		return cur
+	}
+	f.series = make(map[string]*series)
+	r.families[f.name] = f
+	return f
+}
+
+// get returns the series for labelValues, creating it. f.mu must be held.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic("metrics: " + f.name + " wants " + strconv.Itoa(len(f.labels)) + " label values")
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only goes up, one per combination of label values.
+type Counter struct{ f *family }
+
+// NewCounter registers a counter with r. Registering a name twice returns
+// the first counter.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(&family{name: name, help: help, typ: "counter", labels: labels})}
+}
+
+// Inc adds one.
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add adds v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.mu.Lock()
+	c.f.get(labelValues).value += v
+	c.f.mu.Unlock()
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct{ f *family }
+
+// NewGauge registers a gauge with r.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(&family{name: name, help: help, typ: "gauge", labels: labels})}
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	g.f.get(labelValues).value = v
+	g.f.mu.Unlock()
+}
+
+// Add adds v, which may be negative.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	g.f.get(labelValues).value += v
+	g.f.mu.Unlock()
+}
+
+// NewGaugeFunc registers a gauge whose values collect reports at each
+// scrape, calling emit once per combination of label values. Registering a
+// name again replaces the earlier func.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit func(v float64, labelValues ...string))) {
+	r.register(&family{name: name, help: help, typ: "gauge", labels: labels, collect: collect})
+}
+
+// Histogram counts observations into buckets.
+type Histogram struct{ f *family }
+
+// NewHistogram registers a histogram with r. buckets are the upper bounds,
+// in increasing order; +Inf is implied.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(&family{name: name, help: help, typ: "histogram", labels: labels, buckets: buckets})}
+}
+
+// Observe records v.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(labelValues)
+	s.value += v
+	s.count++
+	if i := sort.SearchFloat64s(h.f.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+}
+
+// NewCounter, NewGauge, NewGaugeFunc and NewHistogram register with Default.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+func NewGaugeFunc(name, help string, labels []string, collect func(emit func(v float64, labelValues ...string))) {
+	Default.NewGaugeFunc(name, help, labels, collect)
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// WriteText writes every metric in the Prometheus text format, sorted by
+// name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	slices.SortFunc(families, func(a, b *family) int { return strings.Compare(a.name, b.name) })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	var all []*series
+	if f.collect != nil {
+		f.collect(func(v float64, labelValues ...string) {
+			if len(labelValues) == len(f.labels) {
+				all = append(all, &series{labelValues: labelValues, value: v})
+			}
+		})
+	} else {
+		f.mu.Lock()
+		for _, s := range f.series {
+			c := *s
+			c.counts = slices.Clone(s.counts)
+			all = append(all, &c)
+		}
+		f.mu.Unlock()
+	}
+	slices.SortFunc(all, func(a, b *series) int { return slices.Compare(a.labelValues, b.labelValues) })
+
+	w.WriteString("# HELP " + f.name + " " + strings.ReplaceAll(f.help, "\n", " ") + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+	for _, s := range all {
+		if f.typ != "histogram" {
+			w.WriteString(f.name + labelText(f.labels, s.labelValues, "") + " " + formatFloat(s.value) + "\n")
+			continue
+		}
+		var cumulative uint64
+		for i, le := range f.buckets {
+			cumulative += s.counts[i]
+			w.WriteString(f.name + "_bucket" + labelText(f.labels, s.labelValues, formatFloat(le)) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString(f.name + "_bucket" + labelText(f.labels, s.labelValues, "+Inf") + " " + strconv.FormatUint(s.count, 10) + "\n")
+		w.WriteString(f.name + "_sum" + labelText(f.labels, s.labelValues, "") + " " + formatFloat(s.value) + "\n")
+		w.WriteString(f.name + "_count" + labelText(f.labels, s.labelValues, "") + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+// labelText renders {name="value",...}, with an le label appended when le
+// is set.
+func labelText(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name + `="` + escapeLabel(values[i]) + `"`)
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`le="` + le + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.WriteText(w)
+	})
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_requests_total", "Requests.", "route", "code")
+	c.Inc("/a", "200")
+	c.Add(2, "/a", "200")
+	c.Inc(`/b"\`, "500")
+	c.Add(-1, "/a", "200")
+	if again := r.NewCounter("test_requests_total", "Requests.", "route", "code"); again.f != c.f {
+		t.Error("registering a name twice made a second counter")
+	}
+
+	g := r.NewGauge("test_temperature", "Temperature.")
+	g.Set(20)
+	g.Add(-1.5)
+
+	h := r.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "read")
+	h.Observe(0.1, "read")
+	h.Observe(3, "read")
+
+	n := 1.0
+	r.NewGaugeFunc("test_clients", "Clients.", nil, func(emit func(float64, ...string)) { emit(n) })
+	r.NewGaugeFunc("test_clients", "Clients.", nil, func(emit func(float64, ...string)) { emit(n + 1) })
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	want := `# HELP test_clients Clients.
+# TYPE test_clients gauge
+test_clients 2
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{op="read",le="0.1"} 2
+test_latency_seconds_bucket{op="read",le="1"} 2
+test_latency_seconds_bucket{op="read",le="+Inf"} 3
+test_latency_seconds_sum{op="read"} 3.15
+test_latency_seconds_count{op="read"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",code="200"} 3
+test_requests_total{route="/b\"\\",code="500"} 1
+# HELP test_temperature Temperature.
+# TYPE test_temperature gauge
+test_temperature 18.5
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
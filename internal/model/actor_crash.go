@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// ActorCrash records a panic recovered from a persona's actor.
+type ActorCrash struct {
+	ID        int64
+	PersonaID int64
+	Error     string
+	Stack     string
+	CreatedAt time.Time
+}
+
+// CreateActorCrash records a crash.
+func CreateActorCrash(d *db.DB, personaID int64, errText, stack string) error {
+	_, err := d.WriteExec(
+		"INSERT INTO actor_crashes (persona_id, error, stack) VALUES (?, ?, ?)",
+		personaID, errText, stack,
+	)
+	return err
+}
+
+// ListActorCrashes returns a persona's crashes, newest first.
+func ListActorCrashes(d *db.DB, personaID int64, limit, offset int) ([]ActorCrash, error) {
+	rows, err := d.SQL.Query(
+		`SELECT id, persona_id, error, stack, created_at FROM actor_crashes
+		 WHERE persona_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		personaID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ActorCrash
+	for rows.Next() {
+		var c ActorCrash
+		if err := rows.Scan(&c.ID, &c.PersonaID, &c.Error, &c.Stack, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,30 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestActorCrashes(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+
+	if err := model.CreateActorCrash(d, p.ID, "actor panic: boom", "goroutine 1 [running]:"); err != nil {
+		t.Fatalf("CreateActorCrash: %v", err)
+	}
+	model.CreateActorCrash(d, p.ID, "actor panic: again", "")
+
+	crashes, err := model.ListActorCrashes(d, p.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListActorCrashes: %v", err)
+	}
+	if len(crashes) != 2 || crashes[0].Error != "actor panic: again" || crashes[1].Stack != "goroutine 1 [running]:" {
+		t.Errorf("crashes = %+v", crashes)
+	}
+
+	model.DeletePersona(d, p.ID)
+	if crashes, _ := model.ListActorCrashes(d, p.ID, 10, 0); len(crashes) != 0 {
+		t.Errorf("crashes kept after persona deleted: %d", len(crashes))
+	}
+}
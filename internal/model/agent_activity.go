@@ -1,6 +1,7 @@
 package model
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/waynenilsen/waynebot/internal/db"
@@ -10,25 +11,36 @@ import (
 type LLMCall struct {
 	ID               int64
 	PersonaID        int64
+	PersonaVersion   int
+	RunID            string
 	ChannelID        int64
 	Model            string
 	MessagesJSON     string
 	ResponseJSON     string
 	PromptTokens     int
 	CompletionTokens int
-	CreatedAt        time.Time
+	// StartedAt and DurationMs are zero for calls recorded before they were
+	// tracked.
+	StartedAt  time.Time
+	DurationMs int64
+	CreatedAt  time.Time
 }
 
 // ToolExecution represents a recorded tool execution from the tool_executions table.
 type ToolExecution struct {
-	ID         int64
-	PersonaID  int64
-	ToolName   string
-	ArgsJSON   string
-	OutputText string
-	ErrorText  string
-	DurationMs int64
-	CreatedAt  time.Time
+	ID             int64
+	PersonaID      int64
+	PersonaVersion int
+	RunID          string
+	ChannelID      int64
+	ToolName       string
+	ArgsJSON       string
+	OutputText     string
+	ErrorText      string
+	DurationMs     int64
+	Cancelled      bool
+	StartedAt      time.Time
+	CreatedAt      time.Time
 }
 
 // AgentStats holds summary statistics for an agent.
@@ -41,14 +53,24 @@ type AgentStats struct {
 
 // ListLLMCalls returns paginated LLM calls for a persona, newest first.
 func ListLLMCalls(d *db.DB, personaID int64, limit, offset int) ([]LLMCall, error) {
-	rows, err := d.SQL.Query(
-		`SELECT id, persona_id, channel_id, model, messages_json, response_json, prompt_tokens, completion_tokens, created_at
-		 FROM llm_calls
-		 WHERE persona_id = ?
-		 ORDER BY created_at DESC
-		 LIMIT ? OFFSET ?`,
+	return queryLLMCalls(d,
+		"WHERE persona_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?",
 		personaID, limit, offset,
 	)
+}
+
+// ListRunLLMCalls returns the LLM calls made in a run, in the order they
+// were made.
+func ListRunLLMCalls(d *db.DB, runID string) ([]LLMCall, error) {
+	return queryLLMCalls(d, "WHERE run_id = ? ORDER BY id", runID)
+}
+
+func queryLLMCalls(d *db.DB, where string, args ...any) ([]LLMCall, error) {
+	rows, err := d.SQL.Query(
+		`SELECT id, persona_id, COALESCE(persona_version, 0), COALESCE(run_id, ''), channel_id, model, messages_json, response_json, prompt_tokens, completion_tokens, started_at, duration_ms, created_at
+		 FROM llm_calls `+where,
+		args...,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +79,11 @@ func ListLLMCalls(d *db.DB, personaID int64, limit, offset int) ([]LLMCall, erro
 	var calls []LLMCall
 	for rows.Next() {
 		var c LLMCall
-		if err := rows.Scan(&c.ID, &c.PersonaID, &c.ChannelID, &c.Model, &c.MessagesJSON, &c.ResponseJSON, &c.PromptTokens, &c.CompletionTokens, &c.CreatedAt); err != nil {
+		var started sql.NullTime
+		if err := rows.Scan(&c.ID, &c.PersonaID, &c.PersonaVersion, &c.RunID, &c.ChannelID, &c.Model, &c.MessagesJSON, &c.ResponseJSON, &c.PromptTokens, &c.CompletionTokens, &started, &c.DurationMs, &c.CreatedAt); err != nil {
 			return nil, err
 		}
+		c.StartedAt = started.Time
 		calls = append(calls, c)
 	}
 	return calls, rows.Err()
@@ -67,14 +91,24 @@ func ListLLMCalls(d *db.DB, personaID int64, limit, offset int) ([]LLMCall, erro
 
 // ListToolExecutions returns paginated tool executions for a persona, newest first.
 func ListToolExecutions(d *db.DB, personaID int64, limit, offset int) ([]ToolExecution, error) {
-	rows, err := d.SQL.Query(
-		`SELECT id, persona_id, tool_name, args_json, COALESCE(output_text, ''), COALESCE(error_text, ''), COALESCE(duration_ms, 0), created_at
-		 FROM tool_executions
-		 WHERE persona_id = ?
-		 ORDER BY created_at DESC
-		 LIMIT ? OFFSET ?`,
+	return queryToolExecutions(d,
+		"WHERE persona_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?",
 		personaID, limit, offset,
 	)
+}
+
+// ListRunToolExecutions returns the tool executions made in a run, in the
+// order they were made.
+func ListRunToolExecutions(d *db.DB, runID string) ([]ToolExecution, error) {
+	return queryToolExecutions(d, "WHERE run_id = ? ORDER BY id", runID)
+}
+
+func queryToolExecutions(d *db.DB, where string, args ...any) ([]ToolExecution, error) {
+	rows, err := d.SQL.Query(
+		`SELECT id, persona_id, COALESCE(persona_version, 0), COALESCE(run_id, ''), COALESCE(channel_id, 0), tool_name, args_json, COALESCE(output_text, ''), COALESCE(error_text, ''), COALESCE(duration_ms, 0), cancelled, started_at, created_at
+		 FROM tool_executions `+where,
+		args...,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -83,9 +117,11 @@ func ListToolExecutions(d *db.DB, personaID int64, limit, offset int) ([]ToolExe
 	var execs []ToolExecution
 	for rows.Next() {
 		var e ToolExecution
-		if err := rows.Scan(&e.ID, &e.PersonaID, &e.ToolName, &e.ArgsJSON, &e.OutputText, &e.ErrorText, &e.DurationMs, &e.CreatedAt); err != nil {
+		var started sql.NullTime
+		if err := rows.Scan(&e.ID, &e.PersonaID, &e.PersonaVersion, &e.RunID, &e.ChannelID, &e.ToolName, &e.ArgsJSON, &e.OutputText, &e.ErrorText, &e.DurationMs, &e.Cancelled, &started, &e.CreatedAt); err != nil {
 			return nil, err
 		}
+		e.StartedAt = started.Time
 		execs = append(execs, e)
 	}
 	return execs, rows.Err()
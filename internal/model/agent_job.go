@@ -0,0 +1,332 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Agent job statuses. A failed job is retried at NextAttemptAt; a dead one
+// has used up its attempts, or was cancelled, and waits to be retried by
+// hand.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobDead      = "dead"
+)
+
+// ErrJobNotRetryable is returned by RetryAgentJob for a job that is neither
+// failed nor dead.
+var ErrJobNotRetryable = errors.New("job is not failed or dead")
+
+// AgentJob is a persona's work answering a channel's messages after
+// FromMessageID up to and including ToMessageID. Jobs are persisted so
+// work survives restarts: the persona's cursor in the channel only moves
+// past a job's messages once the job succeeds.
+type AgentJob struct {
+	ID            int64
+	PersonaID     int64
+	ChannelID     int64
+	FromMessageID int64
+	ToMessageID   int64
+	Status        string
+
+	// Attempts counts the failed attempts.
+	Attempts      int
+	LastError     string
+	NextAttemptAt *time.Time
+
+	// ClaimID identifies the attempt holding a running job; only it may
+	// finish the job.
+	ClaimID   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const agentJobCols = "id, persona_id, channel_id, from_message_id, to_message_id, status, attempts, last_error, next_attempt_at, claim_id, created_at, updated_at"
+
+func scanAgentJob(s interface{ Scan(...any) error }) (AgentJob, error) {
+	var j AgentJob
+	var next sql.NullTime
+	err := s.Scan(&j.ID, &j.PersonaID, &j.ChannelID, &j.FromMessageID, &j.ToMessageID, &j.Status,
+		&j.Attempts, &j.LastError, &next, &j.ClaimID, &j.CreatedAt, &j.UpdatedAt)
+	if next.Valid {
+		j.NextAttemptAt = &next.Time
+	}
+	return j, err
+}
+
+// EnqueueAgentJob queues the persona's unanswered messages in a channel:
+// those after both its cursor and every job so far. They are added to the
+// newest job still waiting to run, if there is one, keeping its status and
+// retry time so a failed or deferred job still waits out its backoff;
+// otherwise they become a new pending job.
+func EnqueueAgentJob(d *db.DB, personaID, channelID int64) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		var from, latest int64
+		err := tx.QueryRow(
+			`SELECT MAX(
+			     COALESCE((SELECT last_seen_message_id FROM actor_cursors WHERE persona_id = ? AND channel_id = ?), 0),
+			     COALESCE((SELECT MAX(to_message_id) FROM agent_jobs WHERE persona_id = ? AND channel_id = ?), 0)),
+			   COALESCE((SELECT MAX(id) FROM messages WHERE channel_id = ?), 0)`,
+			personaID, channelID, personaID, channelID, channelID,
+		).Scan(&from, &latest)
+		if err != nil || latest <= from {
+			return err
+		}
+
+		var openID int64
+		err = tx.QueryRow(
+			`SELECT id FROM agent_jobs WHERE persona_id = ? AND channel_id = ? AND status IN ('pending', 'failed')
+			 ORDER BY id DESC LIMIT 1`,
+			personaID, channelID,
+		).Scan(&openID)
+		switch {
+		case err == nil:
+			_, err = tx.Exec(
+				`UPDATE agent_jobs SET to_message_id = ?, updated_at = CURRENT_TIMESTAMP
+				 WHERE id = ?`,
+				latest, openID,
+			)
+			return err
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = tx.Exec(
+				"INSERT INTO agent_jobs (persona_id, channel_id, from_message_id, to_message_id) VALUES (?, ?, ?, ?)",
+				personaID, channelID, from, latest,
+			)
+			return err
+		default:
+			return err
+		}
+	})
+}
+
+// ClaimAgentJob marks the persona's oldest waiting job in a channel as
+// running under claimID and returns it. Jobs run in order, so it returns
+// false while that job is a failed one not yet due to retry at now.
+func ClaimAgentJob(d *db.DB, personaID, channelID int64, claimID string, now time.Time) (AgentJob, bool, error) {
+	var (
+		job   AgentJob
+		found bool
+	)
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		j, err := scanAgentJob(tx.QueryRow(
+			"SELECT "+agentJobCols+` FROM agent_jobs
+			 WHERE persona_id = ? AND channel_id = ? AND status IN ('pending', 'failed')
+			 ORDER BY id LIMIT 1`,
+			personaID, channelID,
+		))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if j.Status == JobFailed && j.NextAttemptAt != nil && j.NextAttemptAt.After(now) {
+			return nil
+		}
+		if _, err := tx.Exec(
+			"UPDATE agent_jobs SET status = 'running', claim_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			claimID, j.ID,
+		); err != nil {
+			return err
+		}
+		j.Status, j.ClaimID = JobRunning, claimID
+		job, found = j, true
+		return nil
+	})
+	return job, found, err
+}
+
+// finishAgentJob updates the job if it is still running under its claim,
+// returning sql.ErrNoRows if it isn't.
+func finishAgentJob(tx *sql.Tx, j AgentJob, set string, args ...any) error {
+	res, err := tx.Exec(
+		"UPDATE agent_jobs SET "+set+", updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'running' AND claim_id = ?",
+		append(args, j.ID, j.ClaimID)...,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CompleteAgentJob marks a running job succeeded and moves the persona's
+// cursor in the channel up to the job's last message.
+func CompleteAgentJob(d *db.DB, j AgentJob) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		if err := finishAgentJob(tx, j, "status = 'succeeded', claim_id = ''"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`INSERT INTO actor_cursors (persona_id, channel_id, last_seen_message_id, updated_at)
+			 VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			 ON CONFLICT(persona_id, channel_id) DO UPDATE SET
+			     last_seen_message_id = MAX(last_seen_message_id, excluded.last_seen_message_id),
+			     updated_at = CURRENT_TIMESTAMP`,
+			j.PersonaID, j.ChannelID, j.ToMessageID,
+		)
+		return err
+	})
+}
+
+// RequeueAgentJob puts a running job back to pending without counting an
+// attempt, e.g. when it was interrupted by the actor stopping.
+func RequeueAgentJob(d *db.DB, j AgentJob) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		return finishAgentJob(tx, j, "status = 'pending', claim_id = ''")
+	})
+}
+
+// FailAgentJob records a failed attempt at a running job, to be retried at
+// retryAt.
+func FailAgentJob(d *db.DB, j AgentJob, errText string, retryAt time.Time) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		return finishAgentJob(tx, j,
+			"status = 'failed', attempts = attempts + 1, last_error = ?, next_attempt_at = ?, claim_id = ''",
+			errText, retryAt.UTC())
+	})
+}
+
+// DeferAgentJob puts a running job off until retryAt without counting an
+// attempt, e.g. while the persona is over its token budget.
+func DeferAgentJob(d *db.DB, j AgentJob, reason string, retryAt time.Time) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		return finishAgentJob(tx, j,
+			"status = 'failed', last_error = ?, next_attempt_at = ?, claim_id = ''",
+			reason, retryAt.UTC())
+	})
+}
+
+// BuryAgentJob marks a running job dead: it is not retried until
+// RetryAgentJob is called.
+func BuryAgentJob(d *db.DB, j AgentJob, errText string) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		return finishAgentJob(tx, j,
+			"status = 'dead', attempts = attempts + 1, last_error = ?, next_attempt_at = NULL, claim_id = ''",
+			errText)
+	})
+}
+
+// RequeueRunningAgentJobs puts the persona's running jobs back to pending.
+// Call it before the persona's actor starts: any job still running was cut
+// short when the actor last stopped.
+func RequeueRunningAgentJobs(d *db.DB, personaID int64) error {
+	_, err := d.WriteExec(
+		`UPDATE agent_jobs SET status = 'pending', claim_id = '', updated_at = CURRENT_TIMESTAMP
+		 WHERE persona_id = ? AND status = 'running'`,
+		personaID,
+	)
+	return err
+}
+
+// RetryAgentJob makes a failed or dead job pending again with its attempts
+// reset. It returns ErrJobNotRetryable for other jobs.
+func RetryAgentJob(d *db.DB, id int64) (AgentJob, error) {
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		var status string
+		if err := tx.QueryRow("SELECT status FROM agent_jobs WHERE id = ?", id).Scan(&status); err != nil {
+			return err
+		}
+		if status != JobFailed && status != JobDead {
+			return ErrJobNotRetryable
+		}
+		_, err := tx.Exec(
+			`UPDATE agent_jobs SET status = 'pending', attempts = 0, next_attempt_at = NULL, updated_at = CURRENT_TIMESTAMP
+			 WHERE id = ?`,
+			id,
+		)
+		return err
+	})
+	if err != nil {
+		return AgentJob{}, err
+	}
+	return GetAgentJob(d, id)
+}
+
+// ResetAgentCursor moves the persona's cursor in a channel to messageID and
+// cancels its jobs there still waiting to run, marking them dead, so the
+// messages it was told to forget aren't answered. A job already running is
+// left to finish.
+func ResetAgentCursor(d *db.DB, personaID, channelID, messageID int64) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(
+			`INSERT INTO actor_cursors (persona_id, channel_id, last_seen_message_id, updated_at)
+			 VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			 ON CONFLICT(persona_id, channel_id) DO UPDATE SET
+			     last_seen_message_id = excluded.last_seen_message_id,
+			     updated_at = CURRENT_TIMESTAMP`,
+			personaID, channelID, messageID,
+		); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`UPDATE agent_jobs SET status = 'dead', last_error = 'context reset', next_attempt_at = NULL, updated_at = CURRENT_TIMESTAMP
+			 WHERE persona_id = ? AND channel_id = ? AND status IN ('pending', 'failed') AND to_message_id <= ?`,
+			personaID, channelID, messageID,
+		)
+		return err
+	})
+}
+
+// GetAgentJob returns a single job.
+func GetAgentJob(d *db.DB, id int64) (AgentJob, error) {
+	return scanAgentJob(d.SQL.QueryRow("SELECT "+agentJobCols+" FROM agent_jobs WHERE id = ?", id))
+}
+
+// AgentJobFilter narrows ListAgentJobs. Zero fields match everything.
+type AgentJobFilter struct {
+	Status    string
+	PersonaID int64
+	ChannelID int64
+}
+
+// ListAgentJobs returns the jobs matching f, newest first.
+func ListAgentJobs(d *db.DB, f AgentJobFilter, limit, offset int) ([]AgentJob, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.PersonaID != 0 {
+		where = append(where, "persona_id = ?")
+		args = append(args, f.PersonaID)
+	}
+	if f.ChannelID != 0 {
+		where = append(where, "channel_id = ?")
+		args = append(args, f.ChannelID)
+	}
+	args = append(args, limit, offset)
+
+	rows, err := d.SQL.Query(
+		"SELECT "+agentJobCols+" FROM agent_jobs WHERE "+strings.Join(where, " AND ")+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AgentJob
+	for rows.Next() {
+		j, err := scanAgentJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
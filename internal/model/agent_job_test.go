@@ -0,0 +1,143 @@
+package model_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestAgentJobLifecycle(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+	now := time.Now()
+
+	if err := model.EnqueueAgentJob(d, p.ID, ch.ID); err != nil {
+		t.Fatalf("enqueue empty channel: %v", err)
+	}
+	if _, ok, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c0", now); ok {
+		t.Fatal("claimed a job in an empty channel")
+	}
+
+	m1, _ := model.CreateMessage(d, ch.ID, 1, "human", "alice", "one")
+	model.EnqueueAgentJob(d, p.ID, ch.ID)
+	m2, _ := model.CreateMessage(d, ch.ID, 1, "human", "alice", "two")
+	model.EnqueueAgentJob(d, p.ID, ch.ID)
+
+	// Both messages go into the one pending job.
+	job, ok, err := model.ClaimAgentJob(d, p.ID, ch.ID, "c1", now)
+	if err != nil || !ok {
+		t.Fatalf("claim: ok=%v err=%v", ok, err)
+	}
+	if job.FromMessageID != m1.ID-1 || job.ToMessageID != m2.ID || job.Status != model.JobRunning {
+		t.Fatalf("claimed job = %+v", job)
+	}
+
+	// A failed attempt isn't retried before it is due, and doesn't move
+	// the cursor.
+	if err := model.FailAgentJob(d, job, "llm down", now.Add(time.Minute)); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if _, ok, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c2", now); ok {
+		t.Fatal("claimed a failed job before it was due")
+	}
+	job, ok, _ = model.ClaimAgentJob(d, p.ID, ch.ID, "c3", now.Add(2*time.Minute))
+	if !ok || job.Attempts != 1 || job.LastError != "llm down" {
+		t.Fatalf("retried job = %+v, ok=%v", job, ok)
+	}
+	var cursor int64
+	d.SQL.QueryRow("SELECT COUNT(*) FROM actor_cursors").Scan(&cursor)
+	if cursor != 0 {
+		t.Fatal("cursor moved by a failed job")
+	}
+
+	// Only the current claim may finish the job.
+	stale := job
+	stale.ClaimID = "c1"
+	if err := model.CompleteAgentJob(d, stale); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("complete with stale claim: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := model.CompleteAgentJob(d, job); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	d.SQL.QueryRow("SELECT last_seen_message_id FROM actor_cursors WHERE persona_id = ? AND channel_id = ?", p.ID, ch.ID).Scan(&cursor)
+	if cursor != m2.ID {
+		t.Errorf("cursor = %d, want %d", cursor, m2.ID)
+	}
+
+	// New messages start a new job after the finished one.
+	m3, _ := model.CreateMessage(d, ch.ID, 1, "human", "alice", "three")
+	model.EnqueueAgentJob(d, p.ID, ch.ID)
+	next, ok, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c4", now)
+	if !ok || next.ID == job.ID || next.FromMessageID != m2.ID || next.ToMessageID != m3.ID {
+		t.Fatalf("next job = %+v, ok=%v", next, ok)
+	}
+}
+
+func TestAgentJobRequeueAndRetry(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+	model.CreateMessage(d, ch.ID, 1, "human", "alice", "hi")
+	model.EnqueueAgentJob(d, p.ID, ch.ID)
+	now := time.Now()
+
+	// A job left running by a stopped actor is picked up again.
+	job, _, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c1", now)
+	if err := model.RequeueRunningAgentJobs(d, p.ID); err != nil {
+		t.Fatalf("RequeueRunningAgentJobs: %v", err)
+	}
+	job, ok, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c2", now)
+	if !ok || job.Attempts != 0 {
+		t.Fatalf("requeued job = %+v, ok=%v", job, ok)
+	}
+
+	if _, err := model.RetryAgentJob(d, job.ID); !errors.Is(err, model.ErrJobNotRetryable) {
+		t.Fatalf("retry running job: err = %v, want ErrJobNotRetryable", err)
+	}
+	if err := model.BuryAgentJob(d, job, "cancelled by user"); err != nil {
+		t.Fatalf("bury: %v", err)
+	}
+	if _, ok, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c3", now); ok {
+		t.Fatal("claimed a dead job")
+	}
+
+	dead, _ := model.ListAgentJobs(d, model.AgentJobFilter{Status: model.JobDead}, 10, 0)
+	if len(dead) != 1 || dead[0].ID != job.ID || dead[0].LastError != "cancelled by user" {
+		t.Fatalf("dead jobs = %+v", dead)
+	}
+
+	retried, err := model.RetryAgentJob(d, job.ID)
+	if err != nil || retried.Status != model.JobPending || retried.Attempts != 0 {
+		t.Fatalf("retry: job = %+v, err = %v", retried, err)
+	}
+	if _, ok, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c4", now); !ok {
+		t.Error("retried job not claimable")
+	}
+}
+
+func TestEnqueueKeepsFailedJobBackoff(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+	model.CreateMessage(d, ch.ID, 1, "human", "alice", "hi")
+	model.EnqueueAgentJob(d, p.ID, ch.ID)
+	now := time.Now()
+
+	job, _, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c1", now)
+	model.FailAgentJob(d, job, "llm down", now.Add(time.Minute))
+
+	// A new message joins the failed job without making it due early.
+	m2, _ := model.CreateMessage(d, ch.ID, 1, "human", "alice", "still there?")
+	model.EnqueueAgentJob(d, p.ID, ch.ID)
+	if _, ok, _ := model.ClaimAgentJob(d, p.ID, ch.ID, "c2", now); ok {
+		t.Fatal("claimed a failed job before its retry time")
+	}
+	got, _ := model.GetAgentJob(d, job.ID)
+	if got.Status != model.JobFailed || got.NextAttemptAt == nil || got.ToMessageID != m2.ID {
+		t.Errorf("job = %+v", got)
+	}
+}
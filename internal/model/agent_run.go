@@ -0,0 +1,112 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Agent run statuses.
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
+// What started an agent run.
+const (
+	RunTriggerMessage    = "message"
+	RunTriggerTask       = "task"
+	RunTriggerDelegation = "delegation"
+	RunTriggerWorkflow   = "workflow"
+)
+
+// AgentRun is one pass of a persona answering a conversation: the LLM and
+// tool call loop up to the posted response. Reason explains a failed or
+// cancelled run; Output is the response, or for a cancelled run whatever
+// text the model had produced so far. LastMessageID is the newest message
+// the run was answering.
+type AgentRun struct {
+	ID            string
+	PersonaID     int64
+	ChannelID     int64
+	Trigger       string
+	Status        string
+	Reason        string
+	Output        string
+	LastMessageID int64
+	StartedAt     time.Time
+	FinishedAt    *time.Time
+}
+
+const agentRunCols = "id, persona_id, COALESCE(channel_id, 0), trigger, status, reason, output, last_message_id, started_at, finished_at"
+
+func scanAgentRun(s interface{ Scan(...any) error }) (AgentRun, error) {
+	var r AgentRun
+	var finished sql.NullTime
+	err := s.Scan(&r.ID, &r.PersonaID, &r.ChannelID, &r.Trigger, &r.Status, &r.Reason, &r.Output, &r.LastMessageID, &r.StartedAt, &finished)
+	if finished.Valid {
+		r.FinishedAt = &finished.Time
+	}
+	return r, err
+}
+
+// CreateAgentRun records a run starting.
+func CreateAgentRun(d *db.DB, r AgentRun) error {
+	_, err := d.WriteExec(
+		"INSERT INTO agent_runs (id, persona_id, channel_id, trigger, last_message_id) VALUES (?, ?, ?, ?, ?)",
+		r.ID, r.PersonaID, nullID(r.ChannelID), r.Trigger, r.LastMessageID,
+	)
+	return err
+}
+
+// GetAgentRun returns a single run.
+func GetAgentRun(d *db.DB, id string) (AgentRun, error) {
+	return scanAgentRun(d.SQL.QueryRow("SELECT "+agentRunCols+" FROM agent_runs WHERE id = ?", id))
+}
+
+// ListAgentRuns returns a persona's runs, newest first.
+func ListAgentRuns(d *db.DB, personaID int64, limit, offset int) ([]AgentRun, error) {
+	rows, err := d.SQL.Query(
+		"SELECT "+agentRunCols+" FROM agent_runs WHERE persona_id = ? ORDER BY started_at DESC, rowid DESC LIMIT ? OFFSET ?",
+		personaID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AgentRun
+	for rows.Next() {
+		r, err := scanAgentRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// FinishAgentRun records a run's outcome. Runs that already finished are
+// left alone.
+func FinishAgentRun(d *db.DB, id, status, reason, output string) error {
+	_, err := d.WriteExec(
+		`UPDATE agent_runs SET status = ?, reason = ?, output = ?, finished_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status = 'running'`,
+		status, reason, output, id,
+	)
+	return err
+}
+
+// FailRunningAgentRuns marks every unfinished run as failed with reason,
+// e.g. runs cut short when the process last stopped.
+func FailRunningAgentRuns(d *db.DB, reason string) error {
+	_, err := d.WriteExec(
+		`UPDATE agent_runs SET status = 'failed', reason = ?, finished_at = CURRENT_TIMESTAMP
+		 WHERE status = 'running'`,
+		reason,
+	)
+	return err
+}
@@ -0,0 +1,54 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestAgentRunLifecycle(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+
+	if err := model.CreateAgentRun(d, model.AgentRun{ID: "r1", PersonaID: p.ID, ChannelID: ch.ID, Trigger: model.RunTriggerMessage}); err != nil {
+		t.Fatalf("CreateAgentRun: %v", err)
+	}
+	if err := model.CreateAgentRun(d, model.AgentRun{ID: "r2", PersonaID: p.ID, Trigger: model.RunTriggerWorkflow}); err != nil {
+		t.Fatalf("CreateAgentRun without channel: %v", err)
+	}
+
+	r, err := model.GetAgentRun(d, "r1")
+	if err != nil {
+		t.Fatalf("GetAgentRun: %v", err)
+	}
+	if r.Status != model.RunRunning || r.ChannelID != ch.ID || r.FinishedAt != nil {
+		t.Errorf("run = %+v", r)
+	}
+
+	if err := model.FinishAgentRun(d, "r1", model.RunCancelled, "cancelled by user", "half a thought"); err != nil {
+		t.Fatalf("FinishAgentRun: %v", err)
+	}
+	// A finished run keeps its outcome.
+	model.FinishAgentRun(d, "r1", model.RunCompleted, "", "")
+	r, _ = model.GetAgentRun(d, "r1")
+	if r.Status != model.RunCancelled || r.Reason != "cancelled by user" || r.Output != "half a thought" || r.FinishedAt == nil {
+		t.Errorf("finished run = %+v", r)
+	}
+
+	if err := model.FailRunningAgentRuns(d, "interrupted"); err != nil {
+		t.Fatalf("FailRunningAgentRuns: %v", err)
+	}
+	r, _ = model.GetAgentRun(d, "r2")
+	if r.Status != model.RunFailed || r.Reason != "interrupted" {
+		t.Errorf("interrupted run = %+v", r)
+	}
+
+	runs, err := model.ListAgentRuns(d, p.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListAgentRuns: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != "r2" {
+		t.Errorf("runs = %+v, want newest first", runs)
+	}
+}
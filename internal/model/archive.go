@@ -0,0 +1,129 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Archive indexes one gzip archive of llm_calls or tool_executions rows
+// that the archiver purged from the database. File is relative to the
+// archive directory. FirstAt and LastAt span the rows' created_at times.
+type Archive struct {
+	ID        int64
+	PersonaID int64
+	TableName string
+	File      string
+	RowCount  int
+	MinRowID  int64
+	MaxRowID  int64
+	FirstAt   time.Time
+	LastAt    time.Time
+	SizeBytes int64
+	CreatedAt time.Time
+}
+
+// ArchiveFilter narrows ListArchives. Zero values match everything. Since
+// and Until select archives whose rows overlap that time range.
+type ArchiveFilter struct {
+	PersonaID int64
+	TableName string
+	Since     time.Time
+	Until     time.Time
+}
+
+const archiveCols = `id, persona_id, table_name, file, row_count, min_row_id, max_row_id,
+	first_at, last_at, size_bytes, created_at`
+
+func scanArchive(s interface{ Scan(...any) error }) (Archive, error) {
+	var a Archive
+	var first, last sql.NullTime
+	err := s.Scan(&a.ID, &a.PersonaID, &a.TableName, &a.File, &a.RowCount, &a.MinRowID, &a.MaxRowID,
+		&first, &last, &a.SizeBytes, &a.CreatedAt)
+	a.FirstAt, a.LastAt = first.Time, last.Time
+	return a, err
+}
+
+// CreateArchive adds an archive to the index.
+func CreateArchive(d *db.DB, a Archive) (Archive, error) {
+	res, err := d.WriteExec(
+		`INSERT INTO archives (persona_id, table_name, file, row_count, min_row_id, max_row_id, first_at, last_at, size_bytes)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.PersonaID, a.TableName, a.File, a.RowCount, a.MinRowID, a.MaxRowID,
+		nullTime(timePtr(a.FirstAt)), nullTime(timePtr(a.LastAt)), a.SizeBytes,
+	)
+	if err != nil {
+		return Archive{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Archive{}, err
+	}
+	return GetArchive(d, id)
+}
+
+// GetArchive returns a single archive.
+func GetArchive(d *db.DB, id int64) (Archive, error) {
+	return scanArchive(d.SQL.QueryRow("SELECT "+archiveCols+" FROM archives WHERE id = ?", id))
+}
+
+// GetArchiveByFile returns the archive indexed under file.
+func GetArchiveByFile(d *db.DB, file string) (Archive, error) {
+	return scanArchive(d.SQL.QueryRow("SELECT "+archiveCols+" FROM archives WHERE file = ?", file))
+}
+
+// ListArchives returns the archives matching f, oldest rows first.
+func ListArchives(d *db.DB, f ArchiveFilter) ([]Archive, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if f.PersonaID != 0 {
+		where = append(where, "persona_id = ?")
+		args = append(args, f.PersonaID)
+	}
+	if f.TableName != "" {
+		where = append(where, "table_name = ?")
+		args = append(args, f.TableName)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "(last_at IS NULL OR last_at >= ?)")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "(first_at IS NULL OR first_at < ?)")
+		args = append(args, f.Until.UTC())
+	}
+
+	rows, err := d.SQL.Query(
+		"SELECT "+archiveCols+" FROM archives WHERE "+strings.Join(where, " AND ")+" ORDER BY first_at, id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Archive
+	for rows.Next() {
+		a, err := scanArchive(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// DeleteArchive removes an archive from the index.
+func DeleteArchive(d *db.DB, id int64) error {
+	_, err := d.WriteExec("DELETE FROM archives WHERE id = ?", id)
+	return err
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,52 @@
+package model_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestArchiveIndex(t *testing.T) {
+	d := openTestDB(t)
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := model.CreateArchive(d, model.Archive{PersonaID: 1, TableName: "llm_calls", File: "llm_calls_1_a.jsonl.gz",
+		RowCount: 3, MinRowID: 1, MaxRowID: 3, FirstAt: jan, LastAt: jan.Add(time.Hour), SizeBytes: 120})
+	if err != nil {
+		t.Fatalf("CreateArchive: %v", err)
+	}
+	if !a.FirstAt.Equal(jan) || a.RowCount != 3 || a.CreatedAt.IsZero() {
+		t.Errorf("archive = %+v", a)
+	}
+	model.CreateArchive(d, model.Archive{PersonaID: 2, TableName: "tool_executions", File: "tool_executions_2_a.jsonl.gz",
+		FirstAt: jan.Add(48 * time.Hour), LastAt: jan.Add(49 * time.Hour)})
+	if _, err := model.CreateArchive(d, model.Archive{PersonaID: 1, TableName: "llm_calls", File: a.File}); err == nil {
+		t.Error("indexed the same file twice")
+	}
+
+	cases := []struct {
+		name string
+		f    model.ArchiveFilter
+		want int
+	}{
+		{"all", model.ArchiveFilter{}, 2},
+		{"persona", model.ArchiveFilter{PersonaID: 1}, 1},
+		{"table", model.ArchiveFilter{TableName: "tool_executions"}, 1},
+		{"overlapping", model.ArchiveFilter{Since: jan.Add(30 * time.Minute), Until: jan.Add(24 * time.Hour)}, 1},
+		{"between", model.ArchiveFilter{Since: jan.Add(2 * time.Hour), Until: jan.Add(24 * time.Hour)}, 0},
+	}
+	for _, c := range cases {
+		if got, err := model.ListArchives(d, c.f); err != nil || len(got) != c.want {
+			t.Errorf("%s: got %d archives (%v), want %d", c.name, len(got), err, c.want)
+		}
+	}
+
+	if got, err := model.GetArchiveByFile(d, a.File); err != nil || got.ID != a.ID {
+		t.Errorf("GetArchiveByFile = %+v, %v", got, err)
+	}
+	model.DeleteArchive(d, a.ID)
+	if _, err := model.GetArchive(d, a.ID); err != sql.ErrNoRows {
+		t.Errorf("GetArchive after delete = %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// AuditEvent records one mutating API request: who made it, what it did,
+// what it touched and, where the handler reported them, the target's state
+// before and after. Before, After and Diff are JSON, empty when unknown.
+type AuditEvent struct {
+	ID         int64
+	UserID     int64
+	Username   string
+	Action     string
+	Target     string
+	Status     int
+	Before     string
+	After      string
+	Diff       string
+	RemoteAddr string
+	CreatedAt  time.Time
+}
+
+// AuditFilter narrows ListAuditEvents. Zero values match everything. Action
+// and Target match exactly or, when they end in "*", by prefix.
+type AuditFilter struct {
+	UserID int64
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+const auditEventCols = `id, COALESCE(user_id, 0), username, action, target, status,
+	COALESCE(before_json, ''), COALESCE(after_json, ''), COALESCE(diff, ''), remote_addr, created_at`
+
+func scanAuditEvent(s interface{ Scan(...any) error }) (AuditEvent, error) {
+	var e AuditEvent
+	err := s.Scan(&e.ID, &e.UserID, &e.Username, &e.Action, &e.Target, &e.Status,
+		&e.Before, &e.After, &e.Diff, &e.RemoteAddr, &e.CreatedAt)
+	return e, err
+}
+
+// CreateAuditEvent records e, stamping it with the current time.
+func CreateAuditEvent(d *db.DB, e AuditEvent) (AuditEvent, error) {
+	e.CreatedAt = time.Now().UTC()
+	res, err := d.WriteExec(
+		`INSERT INTO audit_events (user_id, username, action, target, status, before_json, after_json, diff, remote_addr, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullID(e.UserID), e.Username, e.Action, e.Target, e.Status,
+		nullString(e.Before), nullString(e.After), nullString(e.Diff), e.RemoteAddr, e.CreatedAt,
+	)
+	if err != nil {
+		return AuditEvent{}, err
+	}
+	e.ID, err = res.LastInsertId()
+	return e, err
+}
+
+// ListAuditEvents returns the events matching f, newest first.
+func ListAuditEvents(d *db.DB, f AuditFilter) ([]AuditEvent, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if f.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.Action != "" {
+		w, a := matchOrPrefix("action", f.Action)
+		where, args = append(where, w), append(args, a...)
+	}
+	if f.Target != "" {
+		w, a := matchOrPrefix("target", f.Target)
+		where, args = append(where, w), append(args, a...)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+	query := "SELECT " + auditEventCols + " FROM audit_events WHERE " + strings.Join(where, " AND ") + " ORDER BY created_at DESC, id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := d.SQL.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditEvent
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// matchOrPrefix compares col with v, or with v's prefix when v ends in "*".
+func matchOrPrefix(col, v string) (string, []any) {
+	if prefix, ok := strings.CutSuffix(v, "*"); ok {
+		return "substr(" + col + ", 1, ?) = ?", []any{len(prefix), prefix}
+	}
+	return col + " = ?", []any{v}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
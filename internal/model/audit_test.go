@@ -0,0 +1,52 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestAuditEvents(t *testing.T) {
+	d := openTestDB(t)
+	u, _ := model.CreateUser(d, "alice", "hash")
+
+	for _, e := range []model.AuditEvent{
+		{UserID: u.ID, Username: "alice", Action: "POST /api/personas", Target: "personas/1", Status: 201, After: `{"name":"bot"}`},
+		{UserID: u.ID, Username: "alice", Action: "DELETE /api/personas/{id}", Target: "personas/1", Status: 200, Before: `{"name":"bot"}`},
+		{Action: "POST /api/auth/login", Target: "auth/login", Status: 401},
+	} {
+		if _, err := model.CreateAuditEvent(d, e); err != nil {
+			t.Fatalf("CreateAuditEvent: %v", err)
+		}
+	}
+
+	all, err := model.ListAuditEvents(d, model.AuditFilter{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("ListAuditEvents = %d, %v", len(all), err)
+	}
+	if all[0].Target != "auth/login" || all[0].UserID != 0 || all[2].After != `{"name":"bot"}` || all[2].Before != "" {
+		t.Errorf("unexpected events: %+v", all)
+	}
+
+	cases := []struct {
+		name string
+		f    model.AuditFilter
+		want int
+	}{
+		{"user", model.AuditFilter{UserID: u.ID}, 2},
+		{"action", model.AuditFilter{Action: "POST /api/personas"}, 1},
+		{"action prefix", model.AuditFilter{Action: "POST *"}, 2},
+		{"target prefix", model.AuditFilter{Target: "personas/*"}, 2},
+		{"target prefix with LIKE characters", model.AuditFilter{Target: "person_s/*"}, 0},
+		{"since", model.AuditFilter{Since: time.Now().Add(-time.Minute)}, 3},
+		{"until", model.AuditFilter{Until: time.Now().Add(-time.Minute)}, 0},
+		{"page", model.AuditFilter{Limit: 2, Offset: 2}, 1},
+	}
+	for _, c := range cases {
+		got, err := model.ListAuditEvents(d, c.f)
+		if err != nil || len(got) != c.want {
+			t.Errorf("%s: got %d events (%v), want %d", c.name, len(got), err, c.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/diff"
+)
+
+// Changeset statuses. A changeset is applying while a review holds it, and
+// partial when only some of its hunks were applied.
+const (
+	ChangesetPending  = "pending"
+	ChangesetApplying = "applying"
+	ChangesetApplied  = "applied"
+	ChangesetPartial  = "partial"
+	ChangesetRejected = "rejected"
+)
+
+// Changeset is a group of file changes staged by an agent run and awaiting
+// human review.
+type Changeset struct {
+	ID         int64
+	PersonaID  int64
+	ChannelID  int64
+	ProjectID  int64 // 0 for changesets proposed before it was recorded
+	ProjectDir string
+	Status     string
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
+	Files      []ChangesetFile
+}
+
+// ChangesetFile is one file within a changeset. BaseContent is the file as
+// it was on disk when the change was staged.
+type ChangesetFile struct {
+	ID          int64
+	ChangesetID int64
+	Path        string
+	Existed     bool
+	BaseContent string
+	NewContent  string
+	Status      string
+}
+
+// Diff returns the file's change as a unified diff.
+func (f ChangesetFile) Diff() string {
+	oldName := "a/" + f.Path
+	if !f.Existed {
+		oldName = "/dev/null"
+	}
+	return diff.Unified(oldName, "b/"+f.Path, f.BaseContent, f.NewContent)
+}
+
+const changesetCols = "id, persona_id, channel_id, COALESCE(project_id, 0), project_dir, status, created_at, resolved_at"
+
+func scanChangeset(s interface{ Scan(...any) error }) (Changeset, error) {
+	var c Changeset
+	var resolved sql.NullTime
+	err := s.Scan(&c.ID, &c.PersonaID, &c.ChannelID, &c.ProjectID, &c.ProjectDir, &c.Status, &c.CreatedAt, &resolved)
+	if resolved.Valid {
+		c.ResolvedAt = &resolved.Time
+	}
+	return c, err
+}
+
+// CreateChangeset stores a pending changeset with its files. projectDir is
+// the directory of the project's files the changes were staged against.
+func CreateChangeset(d *db.DB, personaID, channelID, projectID int64, projectDir string, files []ChangesetFile) (Changeset, error) {
+	var c Changeset
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			"INSERT INTO changesets (persona_id, channel_id, project_id, project_dir) VALUES (?, ?, ?, ?)",
+			personaID, channelID, nullID(projectID), projectDir,
+		)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if _, err := tx.Exec(
+				`INSERT INTO changeset_files (changeset_id, path, existed, base_content, new_content)
+				 VALUES (?, ?, ?, ?, ?)`,
+				id, f.Path, f.Existed, f.BaseContent, f.NewContent,
+			); err != nil {
+				return err
+			}
+		}
+		c, err = scanChangeset(tx.QueryRow("SELECT "+changesetCols+" FROM changesets WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+		c.Files, err = listChangesetFiles(tx, id)
+		return err
+	})
+	return c, err
+}
+
+// GetChangeset returns a changeset with its files.
+func GetChangeset(d *db.DB, id int64) (Changeset, error) {
+	c, err := scanChangeset(d.SQL.QueryRow("SELECT "+changesetCols+" FROM changesets WHERE id = ?", id))
+	if err != nil {
+		return Changeset{}, err
+	}
+	c.Files, err = listChangesetFiles(d.SQL, id)
+	return c, err
+}
+
+// ListChangesets returns a channel's changesets, newest first, without their
+// files. An empty status matches all changesets.
+func ListChangesets(d *db.DB, channelID int64, status string) ([]Changeset, error) {
+	rows, err := d.SQL.Query(
+		`SELECT `+changesetCols+` FROM changesets
+		 WHERE channel_id = ? AND (? = '' OR status = ?)
+		 ORDER BY id DESC`,
+		channelID, status, status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Changeset
+	for rows.Next() {
+		c, err := scanChangeset(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ClaimChangeset moves a pending changeset to applying, so that only one
+// review at a time can write its files or resolve it. It returns
+// sql.ErrNoRows if the changeset is not pending.
+func ClaimChangeset(d *db.DB, id int64) error {
+	return setChangesetStatus(d, id, ChangesetPending, ChangesetApplying)
+}
+
+// ReleaseChangeset puts a claimed changeset back to pending after a review
+// that failed before resolving it.
+func ReleaseChangeset(d *db.DB, id int64) error {
+	return setChangesetStatus(d, id, ChangesetApplying, ChangesetPending)
+}
+
+func setChangesetStatus(d *db.DB, id int64, from, to string) error {
+	res, err := d.WriteExec("UPDATE changesets SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveChangeset records the outcome of a review: the changeset's status
+// and the status of each file by file ID. The changeset must have been
+// claimed with ClaimChangeset; otherwise it returns sql.ErrNoRows.
+func ResolveChangeset(d *db.DB, id int64, status string, fileStatus map[int64]string) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			"UPDATE changesets SET status = ?, resolved_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'applying'",
+			status, id,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		for fileID, s := range fileStatus {
+			if _, err := tx.Exec(
+				"UPDATE changeset_files SET status = ? WHERE id = ? AND changeset_id = ?",
+				s, fileID, id,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func listChangesetFiles(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}, changesetID int64) ([]ChangesetFile, error) {
+	rows, err := q.Query(
+		`SELECT id, changeset_id, path, existed, base_content, new_content, status
+		 FROM changeset_files WHERE changeset_id = ? ORDER BY path`,
+		changesetID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []ChangesetFile
+	for rows.Next() {
+		var f ChangesetFile
+		if err := rows.Scan(&f.ID, &f.ChangesetID, &f.Path, &f.Existed, &f.BaseContent, &f.NewContent, &f.Status); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
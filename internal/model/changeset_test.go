@@ -0,0 +1,82 @@
+package model_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestChangesetLifecycle(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "coder", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "dev", "", 0)
+
+	cs, err := model.CreateChangeset(d, p.ID, ch.ID, 0, "/tmp/proj", []model.ChangesetFile{
+		{Path: "b.txt", Existed: false, NewContent: "new\n"},
+		{Path: "a.txt", Existed: true, BaseContent: "old\n", NewContent: "changed\n"},
+	})
+	if err != nil {
+		t.Fatalf("CreateChangeset: %v", err)
+	}
+	if cs.Status != model.ChangesetPending || cs.ResolvedAt != nil {
+		t.Errorf("status = %q, resolved_at = %v", cs.Status, cs.ResolvedAt)
+	}
+	if len(cs.Files) != 2 || cs.Files[0].Path != "a.txt" || !cs.Files[0].Existed || cs.Files[1].Existed {
+		t.Fatalf("unexpected files: %+v", cs.Files)
+	}
+
+	pending, err := model.ListChangesets(d, ch.ID, model.ChangesetPending)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("ListChangesets pending = %d, %v", len(pending), err)
+	}
+
+	if err := model.ResolveChangeset(d, cs.ID, model.ChangesetRejected, nil); err != sql.ErrNoRows {
+		t.Errorf("resolve before claim err = %v, want sql.ErrNoRows", err)
+	}
+	if err := model.ClaimChangeset(d, cs.ID); err != nil {
+		t.Fatalf("ClaimChangeset: %v", err)
+	}
+	if err := model.ClaimChangeset(d, cs.ID); err != sql.ErrNoRows {
+		t.Errorf("second claim err = %v, want sql.ErrNoRows", err)
+	}
+	if err := model.ReleaseChangeset(d, cs.ID); err != nil {
+		t.Fatalf("ReleaseChangeset: %v", err)
+	}
+	if got, _ := model.GetChangeset(d, cs.ID); got.Status != model.ChangesetPending {
+		t.Errorf("status after release = %q, want pending", got.Status)
+	}
+	if err := model.ClaimChangeset(d, cs.ID); err != nil {
+		t.Fatalf("ClaimChangeset after release: %v", err)
+	}
+
+	err = model.ResolveChangeset(d, cs.ID, model.ChangesetPartial, map[int64]string{
+		cs.Files[0].ID: model.ChangesetApplied,
+		cs.Files[1].ID: model.ChangesetRejected,
+	})
+	if err != nil {
+		t.Fatalf("ResolveChangeset: %v", err)
+	}
+
+	got, err := model.GetChangeset(d, cs.ID)
+	if err != nil {
+		t.Fatalf("GetChangeset: %v", err)
+	}
+	if got.Status != model.ChangesetPartial || got.ResolvedAt == nil {
+		t.Errorf("status = %q, resolved_at = %v", got.Status, got.ResolvedAt)
+	}
+	if got.Files[0].Status != model.ChangesetApplied || got.Files[1].Status != model.ChangesetRejected {
+		t.Errorf("file statuses = %q, %q", got.Files[0].Status, got.Files[1].Status)
+	}
+
+	if err := model.ClaimChangeset(d, cs.ID); err != sql.ErrNoRows {
+		t.Errorf("claim after resolve err = %v, want sql.ErrNoRows", err)
+	}
+	if err := model.ResolveChangeset(d, cs.ID, model.ChangesetRejected, nil); err != sql.ErrNoRows {
+		t.Errorf("second resolve err = %v, want sql.ErrNoRows", err)
+	}
+	pending, _ = model.ListChangesets(d, ch.ID, model.ChangesetPending)
+	if len(pending) != 0 {
+		t.Errorf("expected no pending changesets, got %d", len(pending))
+	}
+}
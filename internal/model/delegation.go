@@ -0,0 +1,198 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Delegation statuses.
+const (
+	DelegationRunning   = "running"
+	DelegationCompleted = "completed"
+	DelegationFailed    = "failed"
+	DelegationTimedOut  = "timed_out"
+)
+
+// Delegation is a subtask one persona handed to another with the delegate
+// tool. The exchange happens in ThreadChannelID, a DM between the two
+// personas; OriginChannelID is where the delegating persona was working.
+type Delegation struct {
+	ID                int64
+	FromPersonaID     int64
+	FromPersonaName   string
+	ToPersonaID       int64
+	ToPersonaName     string
+	OriginChannelID   int64
+	ThreadChannelID   int64
+	ProjectID         int64
+	Instructions      string
+	Status            string
+	Result            string
+	Error             string
+	Depth             int
+	RequestMessageID  int64
+	ResponseMessageID int64
+	CreatedAt         time.Time
+	FinishedAt        *time.Time
+}
+
+// DelegationFilter narrows ListDelegations. PersonaID matches delegations
+// made by or to the persona.
+type DelegationFilter struct {
+	PersonaID       int64
+	OriginChannelID int64
+	Status          string
+	Limit           int
+	Offset          int
+}
+
+const delegationCols = `dl.id, dl.from_persona_id, COALESCE(fp.name, ''), dl.to_persona_id, COALESCE(tp.name, ''),
+	COALESCE(dl.origin_channel_id, 0), dl.thread_channel_id, COALESCE(dl.project_id, 0), dl.instructions,
+	dl.status, dl.result, dl.error, dl.depth, COALESCE(dl.request_message_id, 0), COALESCE(dl.response_message_id, 0),
+	dl.created_at, dl.finished_at`
+
+const delegationFrom = ` FROM delegations dl
+	LEFT JOIN personas fp ON fp.id = dl.from_persona_id
+	LEFT JOIN personas tp ON tp.id = dl.to_persona_id`
+
+func scanDelegation(s interface{ Scan(...any) error }) (Delegation, error) {
+	var dl Delegation
+	var finished sql.NullTime
+	err := s.Scan(&dl.ID, &dl.FromPersonaID, &dl.FromPersonaName, &dl.ToPersonaID, &dl.ToPersonaName,
+		&dl.OriginChannelID, &dl.ThreadChannelID, &dl.ProjectID, &dl.Instructions,
+		&dl.Status, &dl.Result, &dl.Error, &dl.Depth, &dl.RequestMessageID, &dl.ResponseMessageID,
+		&dl.CreatedAt, &finished)
+	if finished.Valid {
+		dl.FinishedAt = &finished.Time
+	}
+	return dl, err
+}
+
+// CreateDelegation records a running delegation.
+func CreateDelegation(d *db.DB, dl Delegation) (Delegation, error) {
+	res, err := d.WriteExec(
+		`INSERT INTO delegations (from_persona_id, to_persona_id, origin_channel_id, thread_channel_id, project_id,
+		 instructions, depth, request_message_id)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		dl.FromPersonaID, dl.ToPersonaID, nullID(dl.OriginChannelID), dl.ThreadChannelID, nullID(dl.ProjectID),
+		dl.Instructions, dl.Depth, nullID(dl.RequestMessageID),
+	)
+	if err != nil {
+		return Delegation{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Delegation{}, err
+	}
+	return GetDelegation(d, id)
+}
+
+// GetDelegation returns a single delegation.
+func GetDelegation(d *db.DB, id int64) (Delegation, error) {
+	return scanDelegation(d.SQL.QueryRow("SELECT "+delegationCols+delegationFrom+" WHERE dl.id = ?", id))
+}
+
+// FinishDelegation records a delegation's outcome.
+func FinishDelegation(d *db.DB, id int64, status, result, errText string, responseMessageID int64) error {
+	_, err := d.WriteExec(
+		`UPDATE delegations SET status = ?, result = ?, error = ?, response_message_id = ?, finished_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`,
+		status, result, errText, nullID(responseMessageID), id,
+	)
+	return err
+}
+
+// ListDelegations returns the delegations matching f, newest first.
+func ListDelegations(d *db.DB, f DelegationFilter) ([]Delegation, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if f.PersonaID != 0 {
+		where = append(where, "(dl.from_persona_id = ? OR dl.to_persona_id = ?)")
+		args = append(args, f.PersonaID, f.PersonaID)
+	}
+	if f.OriginChannelID != 0 {
+		where = append(where, "dl.origin_channel_id = ?")
+		args = append(args, f.OriginChannelID)
+	}
+	if f.Status != "" {
+		where = append(where, "dl.status = ?")
+		args = append(args, f.Status)
+	}
+	query := "SELECT " + delegationCols + delegationFrom + " WHERE " + strings.Join(where, " AND ") + " ORDER BY dl.id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := d.SQL.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Delegation
+	for rows.Next() {
+		dl, err := scanDelegation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+// FailRunningDelegations marks delegations left running by a previous
+// process as failed. Returns the number of delegations updated.
+func FailRunningDelegations(d *db.DB) (int64, error) {
+	res, err := d.WriteExec(
+		`UPDATE delegations SET status = 'failed', error = 'interrupted by restart', finished_at = CURRENT_TIMESTAMP
+		 WHERE status = 'running'`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// FindOrCreatePersonaDM returns the DM channel between two personas,
+// creating it if needed. Unlike CreateDMChannel the personas are not
+// subscribed, so their actors only act in it when driven by a delegation.
+func FindOrCreatePersonaDM(d *db.DB, personaA, personaB int64) (Channel, error) {
+	if personaA > personaB {
+		personaA, personaB = personaB, personaA
+	}
+	a, b := DMParticipant{PersonaID: &personaA}, DMParticipant{PersonaID: &personaB}
+	ch, err := FindDMChannel(d, a, b)
+	if err != sql.ErrNoRows {
+		return ch, err
+	}
+
+	err = d.WriteTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			"INSERT INTO channels (name, description, is_dm) VALUES (?, 'Delegations between personas', 1)",
+			fmt.Sprintf("dm-p%d-p%d", personaA, personaB),
+		)
+		if err != nil {
+			return fmt.Errorf("insert channel: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, p := range []DMParticipant{a, b} {
+			if _, err := tx.Exec(
+				"INSERT INTO dm_participants (channel_id, persona_id) VALUES (?, ?)",
+				id, p.PersonaID,
+			); err != nil {
+				return fmt.Errorf("insert dm_participant: %w", err)
+			}
+		}
+		ch, err = scanChannel(tx.QueryRow("SELECT "+channelCols+" FROM channels WHERE id = ?", id))
+		return err
+	})
+	return ch, err
+}
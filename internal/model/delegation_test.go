@@ -0,0 +1,71 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestDelegationLifecycle(t *testing.T) {
+	d := openTestDB(t)
+	lead, _ := model.CreatePersona(d, "lead", "", "m", nil, 0.7, 100, 0, 0)
+	helper, _ := model.CreatePersona(d, "helper", "", "m", nil, 0.7, 100, 0, 0)
+
+	thread, err := model.FindOrCreatePersonaDM(d, helper.ID, lead.ID)
+	if err != nil {
+		t.Fatalf("FindOrCreatePersonaDM: %v", err)
+	}
+	again, err := model.FindOrCreatePersonaDM(d, lead.ID, helper.ID)
+	if err != nil || again.ID != thread.ID || !thread.IsDM {
+		t.Fatalf("thread not reused: %+v, %+v, %v", thread, again, err)
+	}
+	if chans, _ := model.GetSubscribedChannels(d, lead.ID); len(chans) != 0 {
+		t.Errorf("persona subscribed to delegation thread: %+v", chans)
+	}
+
+	req, _ := model.CreateMessage(d, thread.ID, lead.ID, "agent", "lead", "do it")
+	dl, err := model.CreateDelegation(d, model.Delegation{
+		FromPersonaID:    lead.ID,
+		ToPersonaID:      helper.ID,
+		ThreadChannelID:  thread.ID,
+		Instructions:     "do it",
+		Depth:            1,
+		RequestMessageID: req.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateDelegation: %v", err)
+	}
+	if dl.Status != model.DelegationRunning || dl.FromPersonaName != "lead" || dl.ToPersonaName != "helper" || dl.FinishedAt != nil {
+		t.Errorf("unexpected delegation: %+v", dl)
+	}
+
+	resp, _ := model.CreateMessage(d, thread.ID, helper.ID, "agent", "helper", "done")
+	if err := model.FinishDelegation(d, dl.ID, model.DelegationCompleted, "done", "", resp.ID); err != nil {
+		t.Fatalf("FinishDelegation: %v", err)
+	}
+	got, _ := model.GetDelegation(d, dl.ID)
+	if got.Status != model.DelegationCompleted || got.Result != "done" || got.ResponseMessageID != resp.ID || got.FinishedAt == nil {
+		t.Errorf("unexpected finished delegation: %+v", got)
+	}
+
+	msgs, err := model.GetMessagesBetween(d, thread.ID, got.RequestMessageID, got.ResponseMessageID)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("GetMessagesBetween = %d, %v", len(msgs), err)
+	}
+
+	running, _ := model.CreateDelegation(d, model.Delegation{
+		FromPersonaID: helper.ID, ToPersonaID: lead.ID, ThreadChannelID: thread.ID, Instructions: "x", Depth: 1,
+	})
+	if n, err := model.FailRunningDelegations(d); err != nil || n != 1 {
+		t.Fatalf("FailRunningDelegations = %d, %v", n, err)
+	}
+	got, _ = model.GetDelegation(d, running.ID)
+	if got.Status != model.DelegationFailed || got.Error == "" {
+		t.Errorf("running delegation not failed: %+v", got)
+	}
+
+	list, err := model.ListDelegations(d, model.DelegationFilter{PersonaID: lead.ID, Status: model.DelegationCompleted})
+	if err != nil || len(list) != 1 || list[0].ID != dl.ID {
+		t.Errorf("ListDelegations = %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// EvalRun is one run of the persona evaluation harness over a set of
+// scenarios. Provider is the LLM provider the personas ran against, and
+// Model the model override, if any.
+type EvalRun struct {
+	ID        int64
+	Provider  string
+	Model     string
+	Scenarios int
+	Passed    int
+	CreatedAt time.Time
+}
+
+// EvalResult is the outcome of one scenario in an eval run. ToolCallsJSON
+// and AssertionsJSON hold the tool calls the persona made and the checked
+// assertions, as the harness reported them.
+type EvalResult struct {
+	ID             int64
+	EvalRunID      int64
+	Scenario       string
+	PersonaID      int64
+	PersonaName    string
+	PersonaVersion int
+	Model          string
+	Passed         bool
+	Error          string
+	Output         string
+	ToolCallsJSON  string
+	AssertionsJSON string
+	DurationMs     int64
+	CreatedAt      time.Time
+}
+
+// EvalVersionSummary is how a persona version fared on a scenario across
+// every eval run.
+type EvalVersionSummary struct {
+	Version  int
+	Scenario string
+	Runs     int
+	Passed   int
+}
+
+const evalRunCols = "id, provider, model, scenarios, passed, created_at"
+
+const evalResultCols = `id, eval_run_id, scenario, COALESCE(persona_id, 0), persona_name, persona_version, model,
+	passed, error, output, tool_calls_json, assertions_json, duration_ms, created_at`
+
+func scanEvalRun(s interface{ Scan(...any) error }) (EvalRun, error) {
+	var r EvalRun
+	err := s.Scan(&r.ID, &r.Provider, &r.Model, &r.Scenarios, &r.Passed, &r.CreatedAt)
+	return r, err
+}
+
+func scanEvalResult(s interface{ Scan(...any) error }) (EvalResult, error) {
+	var r EvalResult
+	err := s.Scan(&r.ID, &r.EvalRunID, &r.Scenario, &r.PersonaID, &r.PersonaName, &r.PersonaVersion, &r.Model,
+		&r.Passed, &r.Error, &r.Output, &r.ToolCallsJSON, &r.AssertionsJSON, &r.DurationMs, &r.CreatedAt)
+	return r, err
+}
+
+// CreateEvalRun stores an eval run with its results, counting the scenarios
+// and passes from results.
+func CreateEvalRun(d *db.DB, provider, llmModel string, results []EvalResult) (EvalRun, error) {
+	passed := 0
+	for _, r := range results {
+		if r.Passed {
+			passed++
+		}
+	}
+
+	var id int64
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			"INSERT INTO eval_runs (provider, model, scenarios, passed) VALUES (?, ?, ?, ?)",
+			provider, llmModel, len(results), passed,
+		)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			if _, err := tx.Exec(
+				`INSERT INTO eval_results (eval_run_id, scenario, persona_id, persona_name, persona_version, model,
+				     passed, error, output, tool_calls_json, assertions_json, duration_ms)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				id, r.Scenario, nullID(r.PersonaID), r.PersonaName, r.PersonaVersion, r.Model,
+				r.Passed, r.Error, r.Output, r.ToolCallsJSON, r.AssertionsJSON, r.DurationMs,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return EvalRun{}, err
+	}
+	return GetEvalRun(d, id)
+}
+
+// GetEvalRun returns a single eval run.
+func GetEvalRun(d *db.DB, id int64) (EvalRun, error) {
+	return scanEvalRun(d.SQL.QueryRow("SELECT "+evalRunCols+" FROM eval_runs WHERE id = ?", id))
+}
+
+// ListEvalRuns returns eval runs, newest first.
+func ListEvalRuns(d *db.DB, limit, offset int) ([]EvalRun, error) {
+	rows, err := d.SQL.Query("SELECT "+evalRunCols+" FROM eval_runs ORDER BY id DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EvalRun
+	for rows.Next() {
+		r, err := scanEvalRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ListEvalResults returns an eval run's results in the order they were
+// stored.
+func ListEvalResults(d *db.DB, evalRunID int64) ([]EvalResult, error) {
+	rows, err := d.SQL.Query("SELECT "+evalResultCols+" FROM eval_results WHERE eval_run_id = ? ORDER BY id", evalRunID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EvalResult
+	for rows.Next() {
+		r, err := scanEvalResult(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// GetEvalVersionSummary returns a persona's eval results per version and
+// scenario, newest version first.
+func GetEvalVersionSummary(d *db.DB, personaID int64) ([]EvalVersionSummary, error) {
+	rows, err := d.SQL.Query(
+		`SELECT persona_version, scenario, COUNT(*), SUM(passed)
+		 FROM eval_results
+		 WHERE persona_id = ?
+		 GROUP BY persona_version, scenario
+		 ORDER BY persona_version DESC, scenario`,
+		personaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EvalVersionSummary
+	for rows.Next() {
+		var s EvalVersionSummary
+		if err := rows.Scan(&s.Version, &s.Scenario, &s.Runs, &s.Passed); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,54 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestEvalRunsByVersion(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+
+	result := func(scenario string, version int, passed bool) model.EvalResult {
+		return model.EvalResult{Scenario: scenario, PersonaID: p.ID, PersonaName: p.Name, PersonaVersion: version,
+			Model: "m", Passed: passed, ToolCallsJSON: "[]", AssertionsJSON: "[]"}
+	}
+	first, err := model.CreateEvalRun(d, "script", "", []model.EvalResult{result("greets", 1, true), result("reads", 1, false)})
+	if err != nil {
+		t.Fatalf("CreateEvalRun: %v", err)
+	}
+	if first.Scenarios != 2 || first.Passed != 1 || first.Provider != "script" {
+		t.Errorf("first run = %+v", first)
+	}
+	model.CreateEvalRun(d, "script", "", []model.EvalResult{result("greets", 2, true), result("reads", 2, true)})
+	model.CreateEvalRun(d, "script", "", []model.EvalResult{result("reads", 2, false)})
+
+	runs, _ := model.ListEvalRuns(d, 10, 0)
+	if len(runs) != 3 || runs[2].ID != first.ID {
+		t.Errorf("runs = %+v", runs)
+	}
+	results, _ := model.ListEvalResults(d, first.ID)
+	if len(results) != 2 || results[0].Scenario != "greets" || !results[0].Passed || results[1].Passed {
+		t.Errorf("results = %+v", results)
+	}
+
+	summary, err := model.GetEvalVersionSummary(d, p.ID)
+	if err != nil {
+		t.Fatalf("GetEvalVersionSummary: %v", err)
+	}
+	want := []model.EvalVersionSummary{
+		{Version: 2, Scenario: "greets", Runs: 1, Passed: 1},
+		{Version: 2, Scenario: "reads", Runs: 2, Passed: 1},
+		{Version: 1, Scenario: "greets", Runs: 1, Passed: 1},
+		{Version: 1, Scenario: "reads", Runs: 1, Passed: 0},
+	}
+	if len(summary) != len(want) {
+		t.Fatalf("summary = %+v", summary)
+	}
+	for i := range want {
+		if summary[i] != want[i] {
+			t.Errorf("summary[%d] = %+v, want %+v", i, summary[i], want[i])
+		}
+	}
+}
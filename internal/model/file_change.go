@@ -0,0 +1,185 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/diff"
+)
+
+// FileChange is a journal entry for one agent write to a project file.
+// RootDir is the directory the agent worked in (the project path or the
+// persona's worktree) and Path is relative to it. Removed marks an entry
+// for a file the agent deleted; its AfterContent is empty. PersonaID and
+// ChannelID are 0 once the persona or channel has been deleted.
+type FileChange struct {
+	ID            int64
+	ProjectID     int64
+	PersonaID     int64
+	PersonaName   string
+	ChannelID     int64
+	RunID         string
+	RootDir       string
+	Path          string
+	Existed       bool
+	Removed       bool
+	BeforeContent string
+	AfterContent  string
+	CreatedAt     time.Time
+	RevertedAt    *time.Time
+}
+
+// Diff returns the change as a unified diff.
+func (c FileChange) Diff() string {
+	oldName := "a/" + c.Path
+	if !c.Existed {
+		oldName = "/dev/null"
+	}
+	newName := "b/" + c.Path
+	if c.Removed {
+		newName = "/dev/null"
+	}
+	return diff.Unified(oldName, newName, c.BeforeContent, c.AfterContent)
+}
+
+// FileChangeFilter narrows ListFileChanges. Zero values match everything.
+type FileChangeFilter struct {
+	PersonaID int64
+	RunID     string
+	Path      string
+	Limit     int
+	Offset    int
+}
+
+const fileChangeCols = `fc.id, fc.project_id, COALESCE(fc.persona_id, 0), COALESCE(p.name, ''), COALESCE(fc.channel_id, 0),
+	fc.run_id, fc.root_dir, fc.path, fc.existed, fc.removed, fc.before_content, fc.after_content, fc.created_at, fc.reverted_at`
+
+const fileChangeFrom = ` FROM file_changes fc LEFT JOIN personas p ON p.id = fc.persona_id`
+
+func scanFileChange(s interface{ Scan(...any) error }) (FileChange, error) {
+	var c FileChange
+	var reverted sql.NullTime
+	err := s.Scan(&c.ID, &c.ProjectID, &c.PersonaID, &c.PersonaName, &c.ChannelID,
+		&c.RunID, &c.RootDir, &c.Path, &c.Existed, &c.Removed, &c.BeforeContent, &c.AfterContent, &c.CreatedAt, &reverted)
+	if reverted.Valid {
+		c.RevertedAt = &reverted.Time
+	}
+	return c, err
+}
+
+// RecordFileChange appends an entry to the file-change journal.
+func RecordFileChange(d *db.DB, c FileChange) (int64, error) {
+	res, err := d.WriteExec(
+		`INSERT INTO file_changes (project_id, persona_id, channel_id, run_id, root_dir, path, existed, removed, before_content, after_content)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ProjectID, nullID(c.PersonaID), nullID(c.ChannelID), c.RunID, c.RootDir, c.Path, c.Existed, c.Removed, c.BeforeContent, c.AfterContent,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetFileChange returns a single journal entry.
+func GetFileChange(d *db.DB, id int64) (FileChange, error) {
+	return scanFileChange(d.SQL.QueryRow("SELECT "+fileChangeCols+fileChangeFrom+" WHERE fc.id = ?", id))
+}
+
+// ListFileChanges returns a project's journal entries, newest first.
+func ListFileChanges(d *db.DB, projectID int64, f FileChangeFilter) ([]FileChange, error) {
+	where := []string{"fc.project_id = ?"}
+	args := []any{projectID}
+	if f.PersonaID != 0 {
+		where = append(where, "fc.persona_id = ?")
+		args = append(args, f.PersonaID)
+	}
+	if f.RunID != "" {
+		where = append(where, "fc.run_id = ?")
+		args = append(args, f.RunID)
+	}
+	if f.Path != "" {
+		where = append(where, "fc.path = ?")
+		args = append(args, f.Path)
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, f.Offset)
+
+	return queryFileChanges(d,
+		"SELECT "+fileChangeCols+fileChangeFrom+" WHERE "+strings.Join(where, " AND ")+" ORDER BY fc.id DESC LIMIT ? OFFSET ?",
+		args...)
+}
+
+// ListRunFileChanges returns every journal entry from one agent run in a
+// project, oldest first.
+func ListRunFileChanges(d *db.DB, projectID int64, runID string) ([]FileChange, error) {
+	return queryFileChanges(d,
+		"SELECT "+fileChangeCols+fileChangeFrom+" WHERE fc.project_id = ? AND fc.run_id = ? ORDER BY fc.id",
+		projectID, runID)
+}
+
+// MarkFileChangesReverted records that the given entries were reverted. It
+// returns sql.ErrNoRows, and marks nothing, if any of them already was.
+func MarkFileChangesReverted(d *db.DB, ids []int64) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			res, err := tx.Exec(
+				"UPDATE file_changes SET reverted_at = CURRENT_TIMESTAMP WHERE id = ? AND reverted_at IS NULL", id,
+			)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+		}
+		return nil
+	})
+}
+
+// UnmarkFileChangesReverted clears the reverted mark on the given entries,
+// e.g. after a revert that claimed them failed to write the files.
+func UnmarkFileChangesReverted(d *db.DB, ids []int64) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("UPDATE file_changes SET reverted_at = NULL WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func queryFileChanges(d *db.DB, query string, args ...any) ([]FileChange, error) {
+	rows, err := d.SQL.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FileChange
+	for rows.Next() {
+		c, err := scanFileChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// nullID maps a zero ID to NULL for nullable foreign keys.
+func nullID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -74,6 +74,17 @@ func IsChannelMember(d *db.DB, channelID, userID int64) (bool, error) {
 	return count > 0, nil
 }
 
+// GetChannelMemberRole returns a user's role in a channel, or sql.ErrNoRows
+// if they aren't a member.
+func GetChannelMemberRole(d *db.DB, channelID, userID int64) (string, error) {
+	var role string
+	err := d.SQL.QueryRow(
+		"SELECT role FROM channel_members WHERE channel_id = ? AND user_id = ?",
+		channelID, userID,
+	).Scan(&role)
+	return role, err
+}
+
 // ListChannelsForUser returns all non-DM channels where the user is a member.
 func ListChannelsForUser(d *db.DB, userID int64) ([]Channel, error) {
 	rows, err := d.SQL.Query(
@@ -0,0 +1,276 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Memory scopes. A persona memory is private to the persona that saved it; a
+// project memory is shared by every persona working in the project; a
+// channel memory is shared by every persona in the channel.
+const (
+	MemoryScopePersona = "persona"
+	MemoryScopeProject = "project"
+	MemoryScopeChannel = "channel"
+)
+
+// Memory is a piece of long-term knowledge saved by an agent. SourcePath is
+// the project-relative markdown file the memory mirrors, or "" for memories
+// that only live in the database; SourceDir is the project directory or
+// persona worktree the file is in. Embedding is nil until the memory has been
+// embedded; EmbeddingModel names the embedder that produced it. A memory is
+// hidden once ExpiresAt has passed.
+type Memory struct {
+	ID             int64
+	PersonaID      int64
+	ProjectID      int64
+	ChannelID      int64
+	Scope          string
+	Title          string
+	Content        string
+	SourcePath     string
+	SourceDir      string
+	Embedding      []float32
+	EmbeddingModel string
+	ExpiresAt      *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// MemoryVisibility describes who is looking at memories: a persona working
+// in a channel and, optionally, a project.
+type MemoryVisibility struct {
+	PersonaID int64
+	ProjectID int64
+	ChannelID int64
+}
+
+// VisibleTo reports whether v may see the memory.
+func (m Memory) VisibleTo(v MemoryVisibility) bool {
+	switch m.Scope {
+	case MemoryScopePersona:
+		return v.PersonaID != 0 && m.PersonaID == v.PersonaID
+	case MemoryScopeProject:
+		return v.ProjectID != 0 && m.ProjectID == v.ProjectID
+	case MemoryScopeChannel:
+		return v.ChannelID != 0 && m.ChannelID == v.ChannelID
+	}
+	return false
+}
+
+// MemoryFilter narrows ListMemories. Zero values match everything. When
+// VisibleTo is set, only memories visible to it are returned. Expired
+// memories are excluded unless IncludeExpired is set.
+type MemoryFilter struct {
+	PersonaID      int64
+	ProjectID      int64
+	ChannelID      int64
+	Scope          string
+	VisibleTo      *MemoryVisibility
+	IncludeExpired bool
+	Limit          int
+	Offset         int
+}
+
+const memoryCols = `id, COALESCE(persona_id, 0), COALESCE(project_id, 0), COALESCE(channel_id, 0), scope,
+	title, content, source_path, source_dir, embedding, embedding_model, expires_at, created_at, updated_at`
+
+func scanMemory(s interface{ Scan(...any) error }) (Memory, error) {
+	var m Memory
+	var emb []byte
+	var expires sql.NullTime
+	err := s.Scan(&m.ID, &m.PersonaID, &m.ProjectID, &m.ChannelID, &m.Scope,
+		&m.Title, &m.Content, &m.SourcePath, &m.SourceDir, &emb, &m.EmbeddingModel, &expires, &m.CreatedAt, &m.UpdatedAt)
+	m.Embedding = decodeEmbedding(emb)
+	if expires.Valid {
+		m.ExpiresAt = &expires.Time
+	}
+	return m, err
+}
+
+// CreateMemory stores a new memory. An empty Scope defaults to project for
+// memories with a project and persona otherwise.
+func CreateMemory(d *db.DB, m Memory) (Memory, error) {
+	if m.Scope == "" {
+		m.Scope = MemoryScopePersona
+		if m.ProjectID != 0 {
+			m.Scope = MemoryScopeProject
+		}
+	}
+	id, err := insertMemory(d.WriteExec, m)
+	if err != nil {
+		return Memory{}, err
+	}
+	return GetMemory(d, id)
+}
+
+// insertMemory inserts m with exec, which is either the database's
+// WriteExec or a transaction's Exec, and returns its ID.
+func insertMemory(exec func(string, ...any) (sql.Result, error), m Memory) (int64, error) {
+	res, err := exec(
+		`INSERT INTO memories (persona_id, project_id, channel_id, scope, title, content, source_path, source_dir, embedding, embedding_model, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullID(m.PersonaID), nullID(m.ProjectID), nullID(m.ChannelID), m.Scope,
+		m.Title, m.Content, m.SourcePath, m.SourceDir, encodeEmbedding(m.Embedding), m.EmbeddingModel, nullTime(m.ExpiresAt),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetMemory returns a single memory.
+func GetMemory(d *db.DB, id int64) (Memory, error) {
+	return scanMemory(d.SQL.QueryRow("SELECT "+memoryCols+" FROM memories WHERE id = ?", id))
+}
+
+// GetMemoryBySource returns the memory mirroring a markdown file in one of
+// a project's directories.
+func GetMemoryBySource(d *db.DB, projectID int64, sourceDir, sourcePath string) (Memory, error) {
+	return scanMemory(d.SQL.QueryRow(
+		"SELECT "+memoryCols+" FROM memories WHERE project_id = ? AND source_dir = ? AND source_path = ?",
+		projectID, sourceDir, sourcePath,
+	))
+}
+
+// ListMemories returns the memories matching f, oldest first.
+func ListMemories(d *db.DB, f MemoryFilter) ([]Memory, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if f.PersonaID != 0 {
+		where = append(where, "persona_id = ?")
+		args = append(args, f.PersonaID)
+	}
+	if f.ProjectID != 0 {
+		where = append(where, "project_id = ?")
+		args = append(args, f.ProjectID)
+	}
+	if f.ChannelID != 0 {
+		where = append(where, "channel_id = ?")
+		args = append(args, f.ChannelID)
+	}
+	if f.Scope != "" {
+		where = append(where, "scope = ?")
+		args = append(args, f.Scope)
+	}
+	if v := f.VisibleTo; v != nil {
+		where = append(where, `((scope = 'persona' AND persona_id = ?)
+			OR (scope = 'project' AND project_id = ?)
+			OR (scope = 'channel' AND channel_id = ?))`)
+		args = append(args, v.PersonaID, v.ProjectID, v.ChannelID)
+	}
+	if !f.IncludeExpired {
+		where = append(where, "(expires_at IS NULL OR expires_at > ?)")
+		args = append(args, time.Now().UTC())
+	}
+	query := "SELECT " + memoryCols + " FROM memories WHERE " + strings.Join(where, " AND ") + " ORDER BY id"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := d.SQL.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Memory
+	for rows.Next() {
+		m, err := scanMemory(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// UpdateMemory saves a memory's editable fields: scope, owners, title,
+// content, expiry and embedding.
+func UpdateMemory(d *db.DB, m Memory) error {
+	_, err := d.WriteExec(
+		`UPDATE memories SET persona_id = ?, project_id = ?, channel_id = ?, scope = ?, title = ?, content = ?,
+		 embedding = ?, embedding_model = ?, expires_at = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`,
+		nullID(m.PersonaID), nullID(m.ProjectID), nullID(m.ChannelID), m.Scope, m.Title, m.Content,
+		encodeEmbedding(m.Embedding), m.EmbeddingModel, nullTime(m.ExpiresAt), m.ID,
+	)
+	return err
+}
+
+// UpdateMemoryContent replaces a memory's title, content and embedding.
+func UpdateMemoryContent(d *db.DB, id int64, title, content string, embedding []float32, embeddingModel string) error {
+	_, err := d.WriteExec(
+		`UPDATE memories SET title = ?, content = ?, embedding = ?, embedding_model = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`,
+		title, content, encodeEmbedding(embedding), embeddingModel, id,
+	)
+	return err
+}
+
+// SetMemoryEmbedding replaces a memory's embedding without touching its
+// content or updated_at.
+func SetMemoryEmbedding(d *db.DB, id int64, embedding []float32, embeddingModel string) error {
+	_, err := d.WriteExec(
+		"UPDATE memories SET embedding = ?, embedding_model = ? WHERE id = ?",
+		encodeEmbedding(embedding), embeddingModel, id,
+	)
+	return err
+}
+
+// DeleteMemory removes a memory.
+func DeleteMemory(d *db.DB, id int64) error {
+	_, err := d.WriteExec("DELETE FROM memories WHERE id = ?", id)
+	return err
+}
+
+// DeleteExpiredMemories removes expired memories that only live in the
+// database. Expired file-backed memories are kept, and stay hidden, so
+// re-indexing the file does not bring them back.
+func DeleteExpiredMemories(d *db.DB) (int64, error) {
+	res, err := d.WriteExec(
+		"DELETE FROM memories WHERE expires_at IS NOT NULL AND expires_at <= ? AND source_path = ''",
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// nullTime maps a nil time to NULL.
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// encodeEmbedding packs a vector as little-endian float32s.
+func encodeEmbedding(v []float32) []byte {
+	if v == nil {
+		return nil
+	}
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func decodeEmbedding(b []byte) []float32 {
+	if len(b) == 0 {
+		return nil
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
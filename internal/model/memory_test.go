@@ -0,0 +1,95 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestMemoryCRUD(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+
+	m, err := model.CreateMemory(d, model.Memory{
+		PersonaID:      p.ID,
+		Title:          "prefs",
+		Content:        "likes tabs",
+		Embedding:      []float32{0.5, -0.25, 1},
+		EmbeddingModel: "test",
+	})
+	if err != nil {
+		t.Fatalf("CreateMemory: %v", err)
+	}
+	if m.PersonaID != p.ID || m.ProjectID != 0 || len(m.Embedding) != 3 || m.Embedding[1] != -0.25 {
+		t.Errorf("unexpected memory: %+v", m)
+	}
+
+	if err := model.UpdateMemoryContent(d, m.ID, "prefs", "likes spaces", nil, ""); err != nil {
+		t.Fatalf("UpdateMemoryContent: %v", err)
+	}
+	got, _ := model.GetMemory(d, m.ID)
+	if got.Content != "likes spaces" || got.Embedding != nil {
+		t.Errorf("unexpected memory after update: %+v", got)
+	}
+
+	list, err := model.ListMemories(d, model.MemoryFilter{PersonaID: p.ID})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListMemories = %d, %v", len(list), err)
+	}
+
+	if err := model.DeleteMemory(d, m.ID); err != nil {
+		t.Fatalf("DeleteMemory: %v", err)
+	}
+	list, _ = model.ListMemories(d, model.MemoryFilter{})
+	if len(list) != 0 {
+		t.Errorf("expected no memories, got %d", len(list))
+	}
+}
+
+func TestMemoryScopesAndExpiry(t *testing.T) {
+	d := openTestDB(t)
+	alice, _ := model.CreatePersona(d, "alice", "", "m", nil, 0.7, 100, 0, 0)
+	bob, _ := model.CreatePersona(d, "bob", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "dev", "", 0)
+	proj, _ := model.CreateProject(d, "proj", t.TempDir(), "")
+
+	past := time.Now().Add(-time.Hour)
+	for _, m := range []model.Memory{
+		{PersonaID: alice.ID, Scope: model.MemoryScopePersona, Title: "alice-private", Content: "x"},
+		{PersonaID: bob.ID, Scope: model.MemoryScopePersona, Title: "bob-private", Content: "x"},
+		{PersonaID: bob.ID, ProjectID: proj.ID, Scope: model.MemoryScopeProject, Title: "project", Content: "x"},
+		{PersonaID: bob.ID, ChannelID: ch.ID, Scope: model.MemoryScopeChannel, Title: "channel", Content: "x"},
+		{PersonaID: alice.ID, Scope: model.MemoryScopePersona, Title: "expired", Content: "x", ExpiresAt: &past},
+	} {
+		if _, err := model.CreateMemory(d, m); err != nil {
+			t.Fatalf("CreateMemory %s: %v", m.Title, err)
+		}
+	}
+
+	v := model.MemoryVisibility{PersonaID: alice.ID, ProjectID: proj.ID, ChannelID: ch.ID}
+	visible, err := model.ListMemories(d, model.MemoryFilter{VisibleTo: &v})
+	if err != nil {
+		t.Fatalf("ListMemories: %v", err)
+	}
+	var titles []string
+	for _, m := range visible {
+		titles = append(titles, m.Title)
+		if !m.VisibleTo(v) {
+			t.Errorf("%s listed but VisibleTo = false", m.Title)
+		}
+	}
+	if strings.Join(titles, ",") != "alice-private,project,channel" {
+		t.Errorf("visible = %v", titles)
+	}
+
+	n, err := model.DeleteExpiredMemories(d)
+	if err != nil || n != 1 {
+		t.Errorf("DeleteExpiredMemories = %d, %v; want 1", n, err)
+	}
+	all, _ := model.ListMemories(d, model.MemoryFilter{IncludeExpired: true})
+	if len(all) != 4 {
+		t.Errorf("expected 4 memories after cleanup, got %d", len(all))
+	}
+}
@@ -78,6 +78,40 @@ func GetRecentMessages(d *db.DB, channelID int64, limit int) ([]Message, error)
 	return scanMessages(rows)
 }
 
+// GetMessagesBetween returns a channel's messages with firstID <= id <= lastID,
+// oldest first. A zero lastID means no upper bound.
+func GetMessagesBetween(d *db.DB, channelID, firstID, lastID int64) ([]Message, error) {
+	rows, err := d.SQL.Query(
+		`SELECT id, channel_id, author_id, author_type, author_name, content, created_at FROM messages
+		 WHERE channel_id = ? AND id >= ? AND (? = 0 OR id <= ?) ORDER BY id ASC`,
+		channelID, firstID, lastID, lastID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMessages(rows)
+}
+
+// SetMessageRunID records that a message was posted by an agent run.
+func SetMessageRunID(d *db.DB, messageID int64, runID string) error {
+	_, err := d.WriteExec("UPDATE messages SET run_id = ? WHERE id = ?", runID, messageID)
+	return err
+}
+
+// ListRunMessages returns the messages an agent run posted, oldest first.
+func ListRunMessages(d *db.DB, runID string) ([]Message, error) {
+	rows, err := d.SQL.Query(
+		"SELECT id, channel_id, author_id, author_type, author_name, content, created_at FROM messages WHERE run_id = ? ORDER BY id ASC",
+		runID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMessages(rows)
+}
+
 func scanMessages(rows *sql.Rows) ([]Message, error) {
 	var msgs []Message
 	for rows.Next() {
@@ -18,62 +18,103 @@ type Persona struct {
 	MaxTokens        int
 	CooldownSecs     int
 	MaxTokensPerHour int
-	CreatedAt        time.Time
+	// Version counts the persona's saved configurations, starting at 1.
+	Version   int
+	CreatedAt time.Time
 }
 
+const personaCols = "id, name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs, max_tokens_per_hour, version, created_at"
+
 func CreatePersona(d *db.DB, name, systemPrompt, model string, toolsEnabled []string, temperature float64, maxTokens, cooldownSecs, maxTokensPerHour int) (Persona, error) {
+	var p Persona
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		var err error
+		p, err = createPersona(tx, name, systemPrompt, model, toolsEnabled, temperature, maxTokens, cooldownSecs, maxTokensPerHour)
+		return err
+	})
+	return p, err
+}
+
+func createPersona(tx *sql.Tx, name, systemPrompt, model string, toolsEnabled []string, temperature float64, maxTokens, cooldownSecs, maxTokensPerHour int) (Persona, error) {
 	toolsJSON, err := json.Marshal(toolsEnabled)
 	if err != nil {
 		return Persona{}, err
 	}
-
+	res, err := tx.Exec(
+		`INSERT INTO personas (name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs, max_tokens_per_hour)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		name, systemPrompt, model, string(toolsJSON), temperature, maxTokens, cooldownSecs, maxTokensPerHour,
+	)
+	if err != nil {
+		return Persona{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Persona{}, err
+	}
+	if err := insertPersonaVersion(tx, id); err != nil {
+		return Persona{}, err
+	}
 	var p Persona
-	err = d.WriteTx(func(tx *sql.Tx) error {
-		res, err := tx.Exec(
-			`INSERT INTO personas (name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs, max_tokens_per_hour)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			name, systemPrompt, model, string(toolsJSON), temperature, maxTokens, cooldownSecs, maxTokensPerHour,
-		)
-		if err != nil {
-			return err
-		}
-		id, err := res.LastInsertId()
-		if err != nil {
-			return err
-		}
-		return scanPersona(tx.QueryRow(
-			"SELECT id, name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs, max_tokens_per_hour, created_at FROM personas WHERE id = ?", id,
-		), &p)
-	})
+	err = scanPersona(tx.QueryRow(
+		"SELECT "+personaCols+" FROM personas WHERE id = ?", id,
+	), &p)
 	return p, err
 }
 
 func GetPersona(d *db.DB, id int64) (Persona, error) {
 	var p Persona
 	err := scanPersona(d.SQL.QueryRow(
-		"SELECT id, name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs, max_tokens_per_hour, created_at FROM personas WHERE id = ?", id,
+		"SELECT "+personaCols+" FROM personas WHERE id = ?", id,
 	), &p)
 	return p, err
 }
 
 func GetPersonaByName(d *db.DB, name string) (Persona, error) {
+	return getPersonaByName(d.SQL, name)
+}
+
+func getPersonaByName(q interface {
+	QueryRow(string, ...any) *sql.Row
+}, name string) (Persona, error) {
 	var p Persona
-	err := scanPersona(d.SQL.QueryRow(
-		"SELECT id, name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs, max_tokens_per_hour, created_at FROM personas WHERE name = ?", name,
+	err := scanPersona(q.QueryRow(
+		"SELECT "+personaCols+" FROM personas WHERE name = ?", name,
 	), &p)
 	return p, err
 }
 
+// UpdatePersona saves a persona's configuration as a new version. Saving an
+// unchanged configuration is a no-op and doesn't add a version.
 func UpdatePersona(d *db.DB, id int64, name, systemPrompt, model string, toolsEnabled []string, temperature float64, maxTokens, cooldownSecs, maxTokensPerHour int) error {
+	return d.WriteTx(func(tx *sql.Tx) error {
+		return updatePersona(tx, id, name, systemPrompt, model, toolsEnabled, temperature, maxTokens, cooldownSecs, maxTokensPerHour)
+	})
+}
+
+func updatePersona(tx *sql.Tx, id int64, name, systemPrompt, model string, toolsEnabled []string, temperature float64, maxTokens, cooldownSecs, maxTokensPerHour int) error {
 	toolsJSON, err := json.Marshal(toolsEnabled)
 	if err != nil {
 		return err
 	}
-	_, err = d.WriteExec(
-		`UPDATE personas SET name = ?, system_prompt = ?, model = ?, tools_enabled = ?, temperature = ?, max_tokens = ?, cooldown_secs = ?, max_tokens_per_hour = ? WHERE id = ?`,
+	var cur Persona
+	if err := scanPersona(tx.QueryRow("SELECT "+personaCols+" FROM personas WHERE id = ?", id), &cur); err != nil {
+		return err
+	}
+	curTools, _ := json.Marshal(cur.ToolsEnabled)
+	if cur.Name == name && cur.SystemPrompt == systemPrompt && cur.Model == model && string(curTools) == string(toolsJSON) &&
+		cur.Temperature == temperature && cur.MaxTokens == maxTokens && cur.CooldownSecs == cooldownSecs &&
+		cur.MaxTokensPerHour == maxTokensPerHour {
+		return nil
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE personas SET name = ?, system_prompt = ?, model = ?, tools_enabled = ?, temperature = ?, max_tokens = ?, cooldown_secs = ?, max_tokens_per_hour = ?, version = version + 1 WHERE id = ?`,
 		name, systemPrompt, model, string(toolsJSON), temperature, maxTokens, cooldownSecs, maxTokensPerHour, id,
-	)
-	return err
+	); err != nil {
+		return err
+	}
+	return insertPersonaVersion(tx, id)
 }
 
 func DeletePersona(d *db.DB, id int64) error {
@@ -83,7 +124,7 @@ func DeletePersona(d *db.DB, id int64) error {
 
 func ListPersonas(d *db.DB) ([]Persona, error) {
 	rows, err := d.SQL.Query(
-		"SELECT id, name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs, max_tokens_per_hour, created_at FROM personas ORDER BY id",
+		"SELECT " + personaCols + " FROM personas ORDER BY id",
 	)
 	if err != nil {
 		return nil, err
@@ -94,7 +135,7 @@ func ListPersonas(d *db.DB) ([]Persona, error) {
 	for rows.Next() {
 		var p Persona
 		var toolsJSON string
-		if err := rows.Scan(&p.ID, &p.Name, &p.SystemPrompt, &p.Model, &toolsJSON, &p.Temperature, &p.MaxTokens, &p.CooldownSecs, &p.MaxTokensPerHour, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.SystemPrompt, &p.Model, &toolsJSON, &p.Temperature, &p.MaxTokens, &p.CooldownSecs, &p.MaxTokensPerHour, &p.Version, &p.CreatedAt); err != nil {
 			return nil, err
 		}
 		if err := json.Unmarshal([]byte(toolsJSON), &p.ToolsEnabled); err != nil {
@@ -184,7 +225,7 @@ func GetChannelPersonas(d *db.DB, channelID int64) ([]PersonaChannelMember, erro
 // scanPersona scans a single persona row, handling JSON deserialization of tools_enabled.
 func scanPersona(row *sql.Row, p *Persona) error {
 	var toolsJSON string
-	if err := row.Scan(&p.ID, &p.Name, &p.SystemPrompt, &p.Model, &toolsJSON, &p.Temperature, &p.MaxTokens, &p.CooldownSecs, &p.MaxTokensPerHour, &p.CreatedAt); err != nil {
+	if err := row.Scan(&p.ID, &p.Name, &p.SystemPrompt, &p.Model, &toolsJSON, &p.Temperature, &p.MaxTokens, &p.CooldownSecs, &p.MaxTokensPerHour, &p.Version, &p.CreatedAt); err != nil {
 		return err
 	}
 	return json.Unmarshal([]byte(toolsJSON), &p.ToolsEnabled)
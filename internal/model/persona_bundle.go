@@ -0,0 +1,385 @@
+package model
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// PersonaBundleFormat is the bundle format version written by
+// ExportPersonaBundle.
+const PersonaBundleFormat = 1
+
+// How ImportPersonaBundle handles a persona with the bundle's name already
+// existing: fail, import under a new name, or overwrite the existing
+// persona's configuration (which saves a new version of it).
+const (
+	ImportConflictError   = "error"
+	ImportConflictRename  = "rename"
+	ImportConflictReplace = "replace"
+)
+
+// ErrPersonaExists is returned when importing a bundle whose persona name is
+// taken and conflicts are not resolved.
+var ErrPersonaExists = errors.New("persona already exists")
+
+// PersonaBundle is a portable persona: its configuration, the channels it
+// subscribes to by name, its per-channel overrides and its reference
+// documents. Bundles are JSON so they can be shared between installs and
+// dropped into a template directory.
+type PersonaBundle struct {
+	Format           int                            `json:"format"`
+	Name             string                         `json:"name"`
+	Description      string                         `json:"description,omitempty"`
+	SystemPrompt     string                         `json:"system_prompt"`
+	Model            string                         `json:"model"`
+	ToolsEnabled     []string                       `json:"tools_enabled"`
+	Temperature      float64                        `json:"temperature"`
+	MaxTokens        int                            `json:"max_tokens"`
+	CooldownSecs     int                            `json:"cooldown_secs"`
+	MaxTokensPerHour int                            `json:"max_tokens_per_hour"`
+	Channels         []string                       `json:"channels,omitempty"`
+	ChannelSettings  []PersonaBundleChannelSettings `json:"channel_settings,omitempty"`
+	Documents        []PersonaBundleDocument        `json:"documents,omitempty"`
+}
+
+// PersonaBundleChannelSettings is the persona's overrides for a channel,
+// named rather than referenced by ID. Nil fields inherit as in
+// PersonaChannelSettings; a non-nil ToolsEnabled is the channel's tool
+// allowlist.
+type PersonaBundleChannelSettings struct {
+	Channel      string   `json:"channel"`
+	Model        *string  `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    *int     `json:"max_tokens,omitempty"`
+	CooldownSecs *int     `json:"cooldown_secs,omitempty"`
+	ReplyMode    string   `json:"reply_mode,omitempty"`
+	ToolsEnabled []string `json:"tools_enabled,omitempty"`
+	ExtraPrompt  string   `json:"extra_prompt,omitempty"`
+}
+
+// PersonaBundleDocument is reference material shipped with a bundle. It is
+// imported as a persona-scoped memory.
+type PersonaBundleDocument struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// PersonaImport reports what ImportPersonaBundle did.
+type PersonaImport struct {
+	Persona Persona
+	// Replaced is set when an existing persona was overwritten.
+	Replaced bool
+	// Channels are the bundle's channels the persona was subscribed to;
+	// MissingChannels don't exist in this install and were skipped, along
+	// with any channel settings for them.
+	Channels        []string
+	MissingChannels []string
+	// ChannelSettings counts the channels whose overrides were applied.
+	ChannelSettings int
+	// Documents counts the documents added as memories. Documents whose
+	// title the persona already has a memory for are skipped.
+	Documents int
+}
+
+// Template converts the bundle to a persona template.
+func (b PersonaBundle) Template() PersonaTemplate {
+	tools := b.ToolsEnabled
+	if tools == nil {
+		tools = []string{}
+	}
+	return PersonaTemplate{
+		Name:         b.Name,
+		Description:  b.Description,
+		SystemPrompt: b.SystemPrompt,
+		Model:        b.Model,
+		ToolsEnabled: tools,
+		Temperature:  b.Temperature,
+		MaxTokens:    b.MaxTokens,
+		CooldownSecs: b.CooldownSecs,
+	}
+}
+
+// ParsePersonaBundle decodes a bundle, rejecting unknown fields and formats.
+func ParsePersonaBundle(data []byte) (PersonaBundle, error) {
+	var b PersonaBundle
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return PersonaBundle{}, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if b.Format != PersonaBundleFormat {
+		return PersonaBundle{}, fmt.Errorf("unsupported bundle format %d", b.Format)
+	}
+	return b, nil
+}
+
+// ExportPersonaBundle builds a bundle from a persona, its channel
+// subscriptions and overrides and its unexpired persona-scoped memories.
+// DM channels are left out.
+func ExportPersonaBundle(d *db.DB, personaID int64) (PersonaBundle, error) {
+	p, err := GetPersona(d, personaID)
+	if err != nil {
+		return PersonaBundle{}, err
+	}
+	b := PersonaBundle{
+		Format:           PersonaBundleFormat,
+		Name:             p.Name,
+		SystemPrompt:     p.SystemPrompt,
+		Model:            p.Model,
+		ToolsEnabled:     p.ToolsEnabled,
+		Temperature:      p.Temperature,
+		MaxTokens:        p.MaxTokens,
+		CooldownSecs:     p.CooldownSecs,
+		MaxTokensPerHour: p.MaxTokensPerHour,
+	}
+
+	channels, err := GetSubscribedChannels(d, personaID)
+	if err != nil {
+		return PersonaBundle{}, err
+	}
+	for _, ch := range channels {
+		if !ch.IsDM {
+			b.Channels = append(b.Channels, ch.Name)
+		}
+	}
+
+	settings, err := ListPersonaChannelSettings(d, personaID)
+	if err != nil {
+		return PersonaBundle{}, err
+	}
+	for _, cs := range settings {
+		ch, err := GetChannel(d, cs.ChannelID)
+		if err != nil {
+			return PersonaBundle{}, err
+		}
+		if ch.IsDM {
+			continue
+		}
+		b.ChannelSettings = append(b.ChannelSettings, PersonaBundleChannelSettings{
+			Channel:      ch.Name,
+			Model:        cs.Model,
+			Temperature:  cs.Temperature,
+			MaxTokens:    cs.MaxTokens,
+			CooldownSecs: cs.CooldownSecs,
+			ReplyMode:    cs.ReplyMode,
+			ToolsEnabled: cs.ToolsEnabled,
+			ExtraPrompt:  cs.ExtraPrompt,
+		})
+	}
+
+	memories, err := ListMemories(d, MemoryFilter{PersonaID: personaID, Scope: MemoryScopePersona})
+	if err != nil {
+		return PersonaBundle{}, err
+	}
+	for _, m := range memories {
+		b.Documents = append(b.Documents, PersonaBundleDocument{Title: m.Title, Content: m.Content})
+	}
+	return b, nil
+}
+
+// ImportPersonaBundle creates a persona from a bundle, subscribes it to the
+// bundle's channels that exist here, applies its channel settings and stores
+// its documents as memories, all in one transaction: a failure part way
+// leaves nothing behind. onConflict is one of the ImportConflict modes;
+// empty means error.
+func ImportPersonaBundle(d *db.DB, b PersonaBundle, onConflict string) (PersonaImport, error) {
+	for _, cs := range b.ChannelSettings {
+		if cs.ReplyMode != "" && !ValidReplyMode(cs.ReplyMode) {
+			return PersonaImport{}, fmt.Errorf("channel %q: invalid reply mode %q", cs.Channel, cs.ReplyMode)
+		}
+	}
+	tools := b.ToolsEnabled
+	if tools == nil {
+		tools = []string{}
+	}
+
+	var out PersonaImport
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		out = PersonaImport{}
+		existing, err := getPersonaByName(tx, b.Name)
+		switch {
+		case err == sql.ErrNoRows:
+			out.Persona, err = createPersona(tx, b.Name, b.SystemPrompt, b.Model, tools, b.Temperature, b.MaxTokens, b.CooldownSecs, b.MaxTokensPerHour)
+		case err != nil:
+			return err
+		case onConflict == ImportConflictReplace:
+			out.Replaced = true
+			if err = updatePersona(tx, existing.ID, b.Name, b.SystemPrompt, b.Model, tools, b.Temperature, b.MaxTokens, b.CooldownSecs, b.MaxTokensPerHour); err == nil {
+				err = scanPersona(tx.QueryRow("SELECT "+personaCols+" FROM personas WHERE id = ?", existing.ID), &out.Persona)
+			}
+		case onConflict == ImportConflictRename:
+			var name string
+			if name, err = freePersonaName(tx, b.Name); err == nil {
+				out.Persona, err = createPersona(tx, name, b.SystemPrompt, b.Model, tools, b.Temperature, b.MaxTokens, b.CooldownSecs, b.MaxTokensPerHour)
+			}
+		default:
+			return ErrPersonaExists
+		}
+		if err != nil {
+			return err
+		}
+
+		channelIDs := make(map[string]int64)
+		lookup := func(name string) (int64, bool, error) {
+			if id, ok := channelIDs[name]; ok {
+				return id, id != 0, nil
+			}
+			ch, err := scanChannel(tx.QueryRow("SELECT "+channelCols+" FROM channels WHERE name = ?", name))
+			if err == sql.ErrNoRows {
+				channelIDs[name] = 0
+				out.MissingChannels = append(out.MissingChannels, name)
+				return 0, false, nil
+			}
+			if err != nil {
+				return 0, false, err
+			}
+			channelIDs[name] = ch.ID
+			return ch.ID, true, nil
+		}
+
+		for _, name := range b.Channels {
+			id, ok, err := lookup(name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if _, err := tx.Exec(
+				"INSERT OR IGNORE INTO persona_channels (persona_id, channel_id) VALUES (?, ?)",
+				out.Persona.ID, id,
+			); err != nil {
+				return err
+			}
+			out.Channels = append(out.Channels, name)
+		}
+
+		for _, cs := range b.ChannelSettings {
+			id, ok, err := lookup(cs.Channel)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := setPersonaChannelSettings(tx.Exec, PersonaChannelSettings{
+				PersonaID:    out.Persona.ID,
+				ChannelID:    id,
+				Model:        cs.Model,
+				Temperature:  cs.Temperature,
+				MaxTokens:    cs.MaxTokens,
+				CooldownSecs: cs.CooldownSecs,
+				ReplyMode:    cs.ReplyMode,
+				ToolsEnabled: cs.ToolsEnabled,
+				ExtraPrompt:  cs.ExtraPrompt,
+			}); err != nil {
+				return err
+			}
+			out.ChannelSettings++
+		}
+
+		have := make(map[string]bool)
+		if out.Replaced {
+			rows, err := tx.Query("SELECT title FROM memories WHERE persona_id = ? AND scope = ?", out.Persona.ID, MemoryScopePersona)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var title string
+				if err := rows.Scan(&title); err != nil {
+					return err
+				}
+				have[title] = true
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+		for _, doc := range b.Documents {
+			if have[doc.Title] {
+				continue
+			}
+			if _, err := insertMemory(tx.Exec, Memory{PersonaID: out.Persona.ID, Scope: MemoryScopePersona, Title: doc.Title, Content: doc.Content}); err != nil {
+				return err
+			}
+			have[doc.Title] = true
+			out.Documents++
+		}
+		return nil
+	})
+	if err != nil {
+		return PersonaImport{}, err
+	}
+	return out, nil
+}
+
+// freePersonaName returns name with the lowest " (n)" suffix that no
+// persona uses yet.
+func freePersonaName(q interface {
+	QueryRow(string, ...any) *sql.Row
+}, name string) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		_, err := getPersonaByName(q, candidate)
+		if err == sql.ErrNoRows {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// LoadPersonaTemplates reads the persona bundles in dir's *.json files, in
+// file name order. A file holds one bundle or an array of them. Files that
+// can't be read or parsed are skipped and reported in the returned error.
+func LoadPersonaTemplates(dir string) ([]PersonaBundle, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var out []PersonaBundle
+	var errs []error
+	for _, path := range paths {
+		bundles, err := readPersonaBundles(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(path), err))
+			continue
+		}
+		out = append(out, bundles...)
+	}
+	return out, errors.Join(errs...)
+}
+
+func readPersonaBundles(path string) ([]PersonaBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := []json.RawMessage{data}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]PersonaBundle, 0, len(raw))
+	for _, r := range raw {
+		b, err := ParsePersonaBundle(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
@@ -0,0 +1,130 @@
+package model_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestPersonaBundleRoundTrip(t *testing.T) {
+	d := openTestDB(t)
+
+	p, _ := model.CreatePersona(d, "reviewer", "Review code.", "gpt-4", []string{"file_read"}, 0.3, 2048, 5, 1000)
+	general, _ := model.CreateChannel(d, "general", "", 0)
+	model.SubscribeChannel(d, p.ID, general.ID)
+	mode, temp := model.ReplyMentionOnly, 0.1
+	model.SetPersonaChannelSettings(d, model.PersonaChannelSettings{PersonaID: p.ID, ChannelID: general.ID, Temperature: &temp, ReplyMode: mode, ToolsEnabled: []string{}})
+	model.CreateMemory(d, model.Memory{PersonaID: p.ID, Scope: model.MemoryScopePersona, Title: "style", Content: "Prefer small diffs."})
+
+	b, err := model.ExportPersonaBundle(d, p.ID)
+	if err != nil {
+		t.Fatalf("ExportPersonaBundle: %v", err)
+	}
+	if b.Format != model.PersonaBundleFormat || b.Name != "reviewer" || b.MaxTokensPerHour != 1000 {
+		t.Errorf("bundle = %+v", b)
+	}
+	if len(b.Channels) != 1 || b.Channels[0] != "general" {
+		t.Errorf("channels = %v, want [general]", b.Channels)
+	}
+	if len(b.Documents) != 1 || b.Documents[0].Content != "Prefer small diffs." {
+		t.Errorf("documents = %+v", b.Documents)
+	}
+	if len(b.ChannelSettings) != 1 || b.ChannelSettings[0].Channel != "general" || b.ChannelSettings[0].ToolsEnabled == nil {
+		t.Errorf("channel settings = %+v", b.ChannelSettings)
+	}
+
+	if _, err := model.ImportPersonaBundle(d, b, model.ImportConflictError); !errors.Is(err, model.ErrPersonaExists) {
+		t.Fatalf("import over existing name: err = %v, want ErrPersonaExists", err)
+	}
+
+	b.Channels = append(b.Channels, "elsewhere")
+	res, err := model.ImportPersonaBundle(d, b, model.ImportConflictRename)
+	if err != nil {
+		t.Fatalf("import with rename: %v", err)
+	}
+	if res.Persona.Name != "reviewer (2)" || res.Replaced {
+		t.Errorf("renamed import = %+v", res)
+	}
+	if strings.Join(res.Channels, ",") != "general" || strings.Join(res.MissingChannels, ",") != "elsewhere" {
+		t.Errorf("channels = %v, missing = %v", res.Channels, res.MissingChannels)
+	}
+	if res.Documents != 1 {
+		t.Errorf("documents = %d, want 1", res.Documents)
+	}
+	cs, err := model.GetPersonaChannelSettings(d, res.Persona.ID, general.ID)
+	if err != nil || cs.ReplyMode != model.ReplyMentionOnly || cs.Temperature == nil || *cs.Temperature != 0.1 || cs.ToolsEnabled == nil || len(cs.ToolsEnabled) != 0 {
+		t.Errorf("imported channel settings = %+v, err = %v", cs, err)
+	}
+	mems, _ := model.ListMemories(d, model.MemoryFilter{PersonaID: res.Persona.ID})
+	if len(mems) != 1 || mems[0].Title != "style" || mems[0].Scope != model.MemoryScopePersona {
+		t.Errorf("imported memories = %+v", mems)
+	}
+
+	b.SystemPrompt = "Review code carefully."
+	b.Documents = append(b.Documents, model.PersonaBundleDocument{Title: "checklist", Content: "Tests first."})
+	res, err = model.ImportPersonaBundle(d, b, model.ImportConflictReplace)
+	if err != nil {
+		t.Fatalf("import with replace: %v", err)
+	}
+	if !res.Replaced || res.Persona.ID != p.ID || res.Persona.SystemPrompt != "Review code carefully." || res.Persona.Version != 2 {
+		t.Errorf("replaced import = %+v", res.Persona)
+	}
+	if res.Documents != 1 {
+		t.Errorf("documents = %d, want only the new one", res.Documents)
+	}
+}
+
+func TestImportPersonaBundleIsAtomic(t *testing.T) {
+	d := openTestDB(t)
+	model.CreateChannel(d, "general", "", 0)
+	if _, err := d.SQL.Exec(`CREATE TRIGGER no_memories BEFORE INSERT ON memories BEGIN SELECT RAISE(ABORT, 'no memories'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	b := model.PersonaBundle{
+		Format: model.PersonaBundleFormat, Name: "reviewer", SystemPrompt: "p", Model: "m",
+		Channels:  []string{"general"},
+		Documents: []model.PersonaBundleDocument{{Title: "style", Content: "Prefer small diffs."}},
+	}
+	if _, err := model.ImportPersonaBundle(d, b, model.ImportConflictError); err == nil {
+		t.Fatal("import succeeded despite the failing document")
+	}
+	if _, err := model.GetPersonaByName(d, "reviewer"); err != sql.ErrNoRows {
+		t.Errorf("persona left behind after a failed import: err = %v", err)
+	}
+
+	b.ChannelSettings = []model.PersonaBundleChannelSettings{{Channel: "general", ReplyMode: "sometimes"}}
+	b.Documents = nil
+	if _, err := model.ImportPersonaBundle(d, b, model.ImportConflictError); err == nil || !strings.Contains(err.Error(), "reply mode") {
+		t.Errorf("err = %v, want an invalid reply mode", err)
+	}
+}
+
+func TestLoadPersonaTemplates(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"format":1,"name":"Solo","system_prompt":"p","model":"m","tools_enabled":[]}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.json"), []byte(`[{"format":1,"name":"One","system_prompt":"p","model":"m"},
+		{"format":1,"name":"Two","description":"second","system_prompt":"p","model":"m"}]`), 0o644)
+	os.WriteFile(filepath.Join(dir, "c.json"), []byte(`{"format":9,"name":"Future"}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(`ignored`), 0o644)
+
+	bundles, err := model.LoadPersonaTemplates(dir)
+	if err == nil || !strings.Contains(err.Error(), "c.json") {
+		t.Errorf("err = %v, want one mentioning c.json", err)
+	}
+	var names []string
+	for _, b := range bundles {
+		names = append(names, b.Name)
+	}
+	if strings.Join(names, ",") != "Solo,One,Two" {
+		t.Errorf("names = %v, want Solo,One,Two", names)
+	}
+	if tmpl := bundles[2].Template(); tmpl.Description != "second" || tmpl.ToolsEnabled == nil {
+		t.Errorf("template = %+v", tmpl)
+	}
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Reply modes control when a persona answers in a channel. Always replies
+// whenever the cooldown allows, MentionOnly only when @mentioned, and Never
+// stays silent in the channel.
+const (
+	ReplyAlways      = "always"
+	ReplyMentionOnly = "mention_only"
+	ReplyNever       = "never"
+)
+
+// ValidReplyMode reports whether m is a reply mode.
+func ValidReplyMode(m string) bool {
+	switch m {
+	case ReplyAlways, ReplyMentionOnly, ReplyNever:
+		return true
+	}
+	return false
+}
+
+// PersonaChannelSettings overrides a persona's configuration in one channel.
+// Nil fields, a nil ToolsEnabled and an empty ReplyMode inherit the
+// persona's own settings; ExtraPrompt is appended to its system prompt.
+type PersonaChannelSettings struct {
+	PersonaID    int64
+	ChannelID    int64
+	Model        *string
+	Temperature  *float64
+	MaxTokens    *int
+	CooldownSecs *int
+	ReplyMode    string
+	ToolsEnabled []string
+	ExtraPrompt  string
+	UpdatedAt    time.Time
+}
+
+// Apply returns p as configured for the settings' channel.
+func (s PersonaChannelSettings) Apply(p Persona) Persona {
+	if s.Model != nil {
+		p.Model = *s.Model
+	}
+	if s.Temperature != nil {
+		p.Temperature = *s.Temperature
+	}
+	if s.MaxTokens != nil {
+		p.MaxTokens = *s.MaxTokens
+	}
+	if s.CooldownSecs != nil {
+		p.CooldownSecs = *s.CooldownSecs
+	}
+	if s.ToolsEnabled != nil {
+		p.ToolsEnabled = s.ToolsEnabled
+	}
+	if s.ExtraPrompt != "" {
+		p.SystemPrompt += "\n\n" + s.ExtraPrompt
+	}
+	return p
+}
+
+// EffectiveReplyMode returns the reply mode, defaulting to always.
+func (s PersonaChannelSettings) EffectiveReplyMode() string {
+	if s.ReplyMode == "" {
+		return ReplyAlways
+	}
+	return s.ReplyMode
+}
+
+const personaChannelSettingsCols = `persona_id, channel_id, model, temperature, max_tokens, cooldown_secs, reply_mode,
+	tools_enabled, extra_prompt, updated_at`
+
+func scanPersonaChannelSettings(s interface{ Scan(...any) error }) (PersonaChannelSettings, error) {
+	var cs PersonaChannelSettings
+	var model sql.NullString
+	var temperature sql.NullFloat64
+	var maxTokens, cooldown sql.NullInt64
+	var tools sql.NullString
+	if err := s.Scan(&cs.PersonaID, &cs.ChannelID, &model, &temperature, &maxTokens, &cooldown, &cs.ReplyMode,
+		&tools, &cs.ExtraPrompt, &cs.UpdatedAt); err != nil {
+		return cs, err
+	}
+	if model.Valid {
+		cs.Model = &model.String
+	}
+	if temperature.Valid {
+		cs.Temperature = &temperature.Float64
+	}
+	if maxTokens.Valid {
+		n := int(maxTokens.Int64)
+		cs.MaxTokens = &n
+	}
+	if cooldown.Valid {
+		n := int(cooldown.Int64)
+		cs.CooldownSecs = &n
+	}
+	if tools.Valid {
+		cs.ToolsEnabled = []string{}
+		if err := json.Unmarshal([]byte(tools.String), &cs.ToolsEnabled); err != nil {
+			return cs, err
+		}
+	}
+	return cs, nil
+}
+
+// GetPersonaChannelSettings returns a persona's overrides for a channel.
+func GetPersonaChannelSettings(d *db.DB, personaID, channelID int64) (PersonaChannelSettings, error) {
+	return scanPersonaChannelSettings(d.SQL.QueryRow(
+		"SELECT "+personaChannelSettingsCols+" FROM persona_channel_settings WHERE persona_id = ? AND channel_id = ?",
+		personaID, channelID,
+	))
+}
+
+// ResolvePersonaChannelSettings returns a persona's overrides for a channel,
+// or empty settings (inheriting everything) when it has none.
+func ResolvePersonaChannelSettings(d *db.DB, personaID, channelID int64) (PersonaChannelSettings, error) {
+	s, err := GetPersonaChannelSettings(d, personaID, channelID)
+	if err == sql.ErrNoRows {
+		return PersonaChannelSettings{PersonaID: personaID, ChannelID: channelID}, nil
+	}
+	return s, err
+}
+
+// ListPersonaChannelSettings returns a persona's overrides for every channel
+// that has them, ordered by channel.
+func ListPersonaChannelSettings(d *db.DB, personaID int64) ([]PersonaChannelSettings, error) {
+	rows, err := d.SQL.Query(
+		"SELECT "+personaChannelSettingsCols+" FROM persona_channel_settings WHERE persona_id = ? ORDER BY channel_id",
+		personaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PersonaChannelSettings
+	for rows.Next() {
+		s, err := scanPersonaChannelSettings(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// SetPersonaChannelSettings creates or replaces a persona's overrides for a
+// channel.
+func SetPersonaChannelSettings(d *db.DB, s PersonaChannelSettings) error {
+	return setPersonaChannelSettings(d.WriteExec, s)
+}
+
+func setPersonaChannelSettings(exec func(string, ...any) (sql.Result, error), s PersonaChannelSettings) error {
+	var tools any
+	if s.ToolsEnabled != nil {
+		b, err := json.Marshal(s.ToolsEnabled)
+		if err != nil {
+			return err
+		}
+		tools = string(b)
+	}
+	_, err := exec(
+		`INSERT INTO persona_channel_settings (persona_id, channel_id, model, temperature, max_tokens, cooldown_secs,
+		 reply_mode, tools_enabled, extra_prompt)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(persona_id, channel_id) DO UPDATE SET
+		 model = excluded.model, temperature = excluded.temperature, max_tokens = excluded.max_tokens,
+		 cooldown_secs = excluded.cooldown_secs, reply_mode = excluded.reply_mode,
+		 tools_enabled = excluded.tools_enabled, extra_prompt = excluded.extra_prompt,
+		 updated_at = CURRENT_TIMESTAMP`,
+		s.PersonaID, s.ChannelID, s.Model, s.Temperature, s.MaxTokens, s.CooldownSecs,
+		s.ReplyMode, tools, s.ExtraPrompt,
+	)
+	return err
+}
+
+// DeletePersonaChannelSettings removes a persona's overrides for a channel.
+func DeletePersonaChannelSettings(d *db.DB, personaID, channelID int64) error {
+	_, err := d.WriteExec(
+		"DELETE FROM persona_channel_settings WHERE persona_id = ? AND channel_id = ?",
+		personaID, channelID,
+	)
+	return err
+}
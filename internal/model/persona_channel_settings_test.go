@@ -0,0 +1,76 @@
+package model_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestPersonaChannelSettings(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "reviewer", "Review code.", "gpt-4", []string{"file_read", "shell_exec"}, 0.7, 4096, 30, 0)
+	alerts, _ := model.CreateChannel(d, "alerts", "", 0)
+	design, _ := model.CreateChannel(d, "design", "", 0)
+
+	if _, err := model.GetPersonaChannelSettings(d, p.ID, alerts.ID); err != sql.ErrNoRows {
+		t.Fatalf("get before set: err = %v, want sql.ErrNoRows", err)
+	}
+	s, err := model.ResolvePersonaChannelSettings(d, p.ID, alerts.ID)
+	if err != nil {
+		t.Fatalf("ResolvePersonaChannelSettings: %v", err)
+	}
+	if got := s.Apply(p); got.Model != "gpt-4" || got.SystemPrompt != "Review code." || s.EffectiveReplyMode() != model.ReplyAlways {
+		t.Errorf("empty settings changed persona: %+v", got)
+	}
+
+	maxTokens := 256
+	temp := 0.0
+	err = model.SetPersonaChannelSettings(d, model.PersonaChannelSettings{
+		PersonaID:    p.ID,
+		ChannelID:    alerts.ID,
+		Temperature:  &temp,
+		MaxTokens:    &maxTokens,
+		ReplyMode:    model.ReplyMentionOnly,
+		ToolsEnabled: []string{},
+		ExtraPrompt:  "Be terse.",
+	})
+	if err != nil {
+		t.Fatalf("SetPersonaChannelSettings: %v", err)
+	}
+	model.SetPersonaChannelSettings(d, model.PersonaChannelSettings{PersonaID: p.ID, ChannelID: design.ID, ExtraPrompt: "Be thorough."})
+
+	s, err = model.GetPersonaChannelSettings(d, p.ID, alerts.ID)
+	if err != nil {
+		t.Fatalf("GetPersonaChannelSettings: %v", err)
+	}
+	if s.Model != nil || s.Temperature == nil || *s.Temperature != 0 || s.ToolsEnabled == nil || len(s.ToolsEnabled) != 0 {
+		t.Errorf("settings = %+v", s)
+	}
+	got := s.Apply(p)
+	if got.Model != "gpt-4" || got.Temperature != 0 || got.MaxTokens != 256 || got.CooldownSecs != 30 || len(got.ToolsEnabled) != 0 {
+		t.Errorf("effective persona = %+v", got)
+	}
+	if got.SystemPrompt != "Review code.\n\nBe terse." {
+		t.Errorf("system prompt = %q", got.SystemPrompt)
+	}
+
+	// Setting again replaces every override.
+	model.SetPersonaChannelSettings(d, model.PersonaChannelSettings{PersonaID: p.ID, ChannelID: alerts.ID, ReplyMode: model.ReplyNever})
+	s, _ = model.GetPersonaChannelSettings(d, p.ID, alerts.ID)
+	if s.Temperature != nil || s.ToolsEnabled != nil || s.ExtraPrompt != "" || s.EffectiveReplyMode() != model.ReplyNever {
+		t.Errorf("replaced settings = %+v", s)
+	}
+
+	list, err := model.ListPersonaChannelSettings(d, p.ID)
+	if err != nil || len(list) != 2 || list[0].ChannelID != alerts.ID || list[1].ExtraPrompt != "Be thorough." {
+		t.Errorf("list = %+v, err = %v", list, err)
+	}
+
+	if err := model.DeletePersonaChannelSettings(d, p.ID, design.ID); err != nil {
+		t.Fatalf("DeletePersonaChannelSettings: %v", err)
+	}
+	if list, _ := model.ListPersonaChannelSettings(d, p.ID); len(list) != 1 {
+		t.Errorf("after delete: %d settings, want 1", len(list))
+	}
+}
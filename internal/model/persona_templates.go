@@ -4,6 +4,7 @@ package model
 // when creating a new persona.
 type PersonaTemplate struct {
 	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
 	SystemPrompt string   `json:"system_prompt"`
 	Model        string   `json:"model"`
 	ToolsEnabled []string `json:"tools_enabled"`
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/diff"
+)
+
+// PersonaVersion is a saved configuration of a persona. A version is
+// written when the persona is created and every time it changes.
+type PersonaVersion struct {
+	ID               int64
+	PersonaID        int64
+	Version          int
+	Name             string
+	SystemPrompt     string
+	Model            string
+	ToolsEnabled     []string
+	Temperature      float64
+	MaxTokens        int
+	CooldownSecs     int
+	MaxTokensPerHour int
+	CreatedAt        time.Time
+}
+
+// PersonaVersionStats summarizes the LLM calls and tool executions made
+// while a persona ran a given version.
+type PersonaVersionStats struct {
+	Version          int
+	Calls            int64
+	PromptTokens     int64
+	CompletionTokens int64
+	ToolExecutions   int64
+	ToolErrors       int64
+}
+
+// AvgTokensPerCall returns the mean prompt plus completion tokens per call.
+func (s PersonaVersionStats) AvgTokensPerCall() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.PromptTokens+s.CompletionTokens) / float64(s.Calls)
+}
+
+// ErrorRate returns the fraction of tool executions that failed.
+func (s PersonaVersionStats) ErrorRate() float64 {
+	if s.ToolExecutions == 0 {
+		return 0
+	}
+	return float64(s.ToolErrors) / float64(s.ToolExecutions)
+}
+
+// PersonaFieldChange is a setting that differs between two versions.
+type PersonaFieldChange struct {
+	Field string
+	From  any
+	To    any
+}
+
+// DiffPersonaVersions lists the settings that differ from a to b, and
+// returns a unified diff of the system prompt ("" when it's unchanged).
+func DiffPersonaVersions(a, b PersonaVersion) ([]PersonaFieldChange, string) {
+	var changes []PersonaFieldChange
+	add := func(field string, from, to any, differ bool) {
+		if differ {
+			changes = append(changes, PersonaFieldChange{Field: field, From: from, To: to})
+		}
+	}
+	add("name", a.Name, b.Name, a.Name != b.Name)
+	add("model", a.Model, b.Model, a.Model != b.Model)
+	add("tools_enabled", a.ToolsEnabled, b.ToolsEnabled, !slices.Equal(a.ToolsEnabled, b.ToolsEnabled))
+	add("temperature", a.Temperature, b.Temperature, a.Temperature != b.Temperature)
+	add("max_tokens", a.MaxTokens, b.MaxTokens, a.MaxTokens != b.MaxTokens)
+	add("cooldown_secs", a.CooldownSecs, b.CooldownSecs, a.CooldownSecs != b.CooldownSecs)
+	add("max_tokens_per_hour", a.MaxTokensPerHour, b.MaxTokensPerHour, a.MaxTokensPerHour != b.MaxTokensPerHour)
+
+	promptDiff := diff.Unified(fmt.Sprintf("v%d/system_prompt", a.Version), fmt.Sprintf("v%d/system_prompt", b.Version), a.SystemPrompt, b.SystemPrompt)
+	if promptDiff != "" {
+		changes = append(changes, PersonaFieldChange{Field: "system_prompt", From: a.SystemPrompt, To: b.SystemPrompt})
+	}
+	return changes, promptDiff
+}
+
+const personaVersionCols = `id, persona_id, version, name, system_prompt, model, tools_enabled, temperature, max_tokens,
+	cooldown_secs, max_tokens_per_hour, created_at`
+
+func scanPersonaVersion(s interface{ Scan(...any) error }) (PersonaVersion, error) {
+	var v PersonaVersion
+	var toolsJSON string
+	if err := s.Scan(&v.ID, &v.PersonaID, &v.Version, &v.Name, &v.SystemPrompt, &v.Model, &toolsJSON, &v.Temperature,
+		&v.MaxTokens, &v.CooldownSecs, &v.MaxTokensPerHour, &v.CreatedAt); err != nil {
+		return v, err
+	}
+	return v, json.Unmarshal([]byte(toolsJSON), &v.ToolsEnabled)
+}
+
+// insertPersonaVersion snapshots the persona's current row as a version.
+func insertPersonaVersion(tx *sql.Tx, personaID int64) error {
+	_, err := tx.Exec(
+		`INSERT INTO persona_versions (persona_id, version, name, system_prompt, model, tools_enabled, temperature,
+		 max_tokens, cooldown_secs, max_tokens_per_hour)
+		 SELECT id, version, name, system_prompt, model, tools_enabled, temperature, max_tokens, cooldown_secs,
+		 max_tokens_per_hour FROM personas WHERE id = ?`,
+		personaID,
+	)
+	return err
+}
+
+// ListPersonaVersions returns a persona's versions, newest first.
+func ListPersonaVersions(d *db.DB, personaID int64) ([]PersonaVersion, error) {
+	rows, err := d.SQL.Query(
+		"SELECT "+personaVersionCols+" FROM persona_versions WHERE persona_id = ? ORDER BY version DESC",
+		personaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PersonaVersion
+	for rows.Next() {
+		v, err := scanPersonaVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// GetPersonaVersion returns one version of a persona.
+func GetPersonaVersion(d *db.DB, personaID int64, version int) (PersonaVersion, error) {
+	return scanPersonaVersion(d.SQL.QueryRow(
+		"SELECT "+personaVersionCols+" FROM persona_versions WHERE persona_id = ? AND version = ?",
+		personaID, version,
+	))
+}
+
+// RollbackPersona restores a persona to an earlier version's configuration.
+// The restored configuration is saved as a new version, so the versions in
+// between stay in the history.
+func RollbackPersona(d *db.DB, personaID int64, version int) (Persona, error) {
+	v, err := GetPersonaVersion(d, personaID, version)
+	if err != nil {
+		return Persona{}, err
+	}
+	if err := UpdatePersona(d, personaID, v.Name, v.SystemPrompt, v.Model, v.ToolsEnabled, v.Temperature,
+		v.MaxTokens, v.CooldownSecs, v.MaxTokensPerHour); err != nil {
+		return Persona{}, err
+	}
+	return GetPersona(d, personaID)
+}
+
+// GetPersonaVersionStats returns usage per persona version, oldest version
+// first. Calls recorded before versioning existed are not counted.
+func GetPersonaVersionStats(d *db.DB, personaID int64) ([]PersonaVersionStats, error) {
+	byVersion := make(map[int]*PersonaVersionStats)
+	var order []int
+	get := func(v int) *PersonaVersionStats {
+		s, ok := byVersion[v]
+		if !ok {
+			s = &PersonaVersionStats{Version: v}
+			byVersion[v] = s
+			order = append(order, v)
+		}
+		return s
+	}
+
+	rows, err := d.SQL.Query(
+		`SELECT persona_version, COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0)
+		 FROM llm_calls
+		 WHERE persona_id = ? AND persona_version IS NOT NULL
+		 GROUP BY persona_version`,
+		personaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		var calls, prompt, completion int64
+		if err := rows.Scan(&v, &calls, &prompt, &completion); err != nil {
+			return nil, err
+		}
+		s := get(v)
+		s.Calls, s.PromptTokens, s.CompletionTokens = calls, prompt, completion
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.SQL.Query(
+		`SELECT persona_version, COUNT(*), COALESCE(SUM(CASE WHEN error_text != '' THEN 1 ELSE 0 END), 0)
+		 FROM tool_executions
+		 WHERE persona_id = ? AND persona_version IS NOT NULL
+		 GROUP BY persona_version`,
+		personaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		var execs, errs int64
+		if err := rows.Scan(&v, &execs, &errs); err != nil {
+			return nil, err
+		}
+		s := get(v)
+		s.ToolExecutions, s.ToolErrors = execs, errs
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Ints(order)
+	out := make([]PersonaVersionStats, len(order))
+	for i, v := range order {
+		out[i] = *byVersion[v]
+	}
+	return out, nil
+}
@@ -0,0 +1,108 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestPersonaVersions(t *testing.T) {
+	d := openTestDB(t)
+
+	p, err := model.CreatePersona(d, "helper", "Be brief.", "gpt-4", []string{"a"}, 0.5, 1024, 10, 50000)
+	if err != nil {
+		t.Fatalf("CreatePersona: %v", err)
+	}
+	if p.Version != 1 {
+		t.Fatalf("version = %d, want 1", p.Version)
+	}
+
+	if err := model.UpdatePersona(d, p.ID, "helper", "Be thorough.", "gpt-4", []string{"a", "b"}, 0.5, 1024, 10, 50000); err != nil {
+		t.Fatalf("UpdatePersona: %v", err)
+	}
+	// Saving the same configuration again is not a new version.
+	if err := model.UpdatePersona(d, p.ID, "helper", "Be thorough.", "gpt-4", []string{"a", "b"}, 0.5, 1024, 10, 50000); err != nil {
+		t.Fatalf("UpdatePersona: %v", err)
+	}
+
+	versions, err := model.ListPersonaVersions(d, p.ID)
+	if err != nil {
+		t.Fatalf("ListPersonaVersions: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 {
+		t.Fatalf("versions = %+v, want 2 then 1", versions)
+	}
+	if versions[0].SystemPrompt != "Be thorough." || versions[1].SystemPrompt != "Be brief." {
+		t.Errorf("prompts = %q, %q", versions[0].SystemPrompt, versions[1].SystemPrompt)
+	}
+
+	changes, promptDiff := model.DiffPersonaVersions(versions[1], versions[0])
+	var fields []string
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	if strings.Join(fields, ",") != "tools_enabled,system_prompt" {
+		t.Errorf("changed fields = %v, want tools_enabled,system_prompt", fields)
+	}
+	if !strings.Contains(promptDiff, "-Be brief.") || !strings.Contains(promptDiff, "+Be thorough.") {
+		t.Errorf("prompt diff = %q", promptDiff)
+	}
+}
+
+func TestRollbackPersona(t *testing.T) {
+	d := openTestDB(t)
+
+	p, _ := model.CreatePersona(d, "helper", "v1 prompt", "gpt-4", []string{}, 0.5, 1024, 10, 50000)
+	model.UpdatePersona(d, p.ID, "helper", "v2 prompt", "gpt-4o", []string{}, 0.9, 1024, 10, 50000)
+
+	got, err := model.RollbackPersona(d, p.ID, 1)
+	if err != nil {
+		t.Fatalf("RollbackPersona: %v", err)
+	}
+	if got.Version != 3 {
+		t.Errorf("version = %d, want 3", got.Version)
+	}
+	if got.SystemPrompt != "v1 prompt" || got.Model != "gpt-4" || got.Temperature != 0.5 {
+		t.Errorf("persona = %+v, want version 1 settings", got)
+	}
+
+	if _, err := model.RollbackPersona(d, p.ID, 9); err == nil {
+		t.Error("expected error rolling back to a missing version")
+	}
+}
+
+func TestPersonaVersionStats(t *testing.T) {
+	d := openTestDB(t)
+
+	p, _ := model.CreatePersona(d, "helper", "p", "m", []string{}, 0.5, 1024, 10, 50000)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+	for _, v := range []any{1, 1, 2, nil} {
+		if _, err := d.WriteExec(
+			`INSERT INTO llm_calls (persona_id, channel_id, persona_version, model, messages_json, response_json, prompt_tokens, completion_tokens)
+			 VALUES (?, ?, ?, 'm', '[]', '{}', 100, 50)`, p.ID, ch.ID, v); err != nil {
+			t.Fatalf("insert llm call: %v", err)
+		}
+	}
+	for _, errText := range []string{"", "boom"} {
+		if _, err := d.WriteExec(
+			`INSERT INTO tool_executions (persona_id, persona_version, tool_name, args_json, output_text, error_text, duration_ms)
+			 VALUES (?, 2, 'shell_exec', '{}', '', ?, 1)`, p.ID, errText); err != nil {
+			t.Fatalf("insert tool execution: %v", err)
+		}
+	}
+
+	stats, err := model.GetPersonaVersionStats(d, p.ID)
+	if err != nil {
+		t.Fatalf("GetPersonaVersionStats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("stats = %+v, want 2 versions", stats)
+	}
+	if stats[0].Version != 1 || stats[0].Calls != 2 || stats[0].AvgTokensPerCall() != 150 {
+		t.Errorf("v1 = %+v", stats[0])
+	}
+	if stats[1].Version != 2 || stats[1].Calls != 1 || stats[1].ToolExecutions != 2 || stats[1].ErrorRate() != 0.5 {
+		t.Errorf("v2 = %+v", stats[1])
+	}
+}
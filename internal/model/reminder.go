@@ -0,0 +1,76 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Reminder is a note a user asked to be shown again in a channel at DueAt.
+type Reminder struct {
+	ID          int64
+	UserID      int64
+	ChannelID   int64
+	Text        string
+	DueAt       time.Time
+	DeliveredAt *time.Time
+	CreatedAt   time.Time
+}
+
+const reminderCols = "id, user_id, channel_id, text, due_at, delivered_at, created_at"
+
+func scanReminder(s interface{ Scan(...any) error }) (Reminder, error) {
+	var r Reminder
+	var delivered sql.NullTime
+	err := s.Scan(&r.ID, &r.UserID, &r.ChannelID, &r.Text, &r.DueAt, &delivered, &r.CreatedAt)
+	if delivered.Valid {
+		r.DeliveredAt = &delivered.Time
+	}
+	return r, err
+}
+
+// CreateReminder schedules a reminder.
+func CreateReminder(d *db.DB, userID, channelID int64, text string, dueAt time.Time) (Reminder, error) {
+	res, err := d.WriteExec(
+		"INSERT INTO reminders (user_id, channel_id, text, due_at) VALUES (?, ?, ?, ?)",
+		userID, channelID, text, dueAt.UTC(),
+	)
+	if err != nil {
+		return Reminder{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Reminder{}, err
+	}
+	return scanReminder(d.SQL.QueryRow("SELECT "+reminderCols+" FROM reminders WHERE id = ?", id))
+}
+
+// ListDueReminders returns the undelivered reminders due by now, oldest
+// first.
+func ListDueReminders(d *db.DB, now time.Time) ([]Reminder, error) {
+	rows, err := d.SQL.Query(
+		"SELECT "+reminderCols+" FROM reminders WHERE delivered_at IS NULL AND due_at <= ? ORDER BY due_at, id",
+		now.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Reminder
+	for rows.Next() {
+		r, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// MarkReminderDelivered records that a reminder was shown.
+func MarkReminderDelivered(d *db.DB, id int64) error {
+	_, err := d.WriteExec("UPDATE reminders SET delivered_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,40 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestReminders(t *testing.T) {
+	d := openTestDB(t)
+	u, _ := model.CreateUser(d, "alice", "hash")
+	ch, _ := model.CreateChannel(d, "general", "", u.ID)
+	now := time.Now()
+
+	soon, err := model.CreateReminder(d, u.ID, ch.ID, "stand up", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("CreateReminder: %v", err)
+	}
+	if _, err := model.CreateReminder(d, u.ID, ch.ID, "go home", now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreateReminder: %v", err)
+	}
+
+	due, err := model.ListDueReminders(d, now)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("due now = %v, %v; want none", due, err)
+	}
+	due, _ = model.ListDueReminders(d, now.Add(2*time.Minute))
+	if len(due) != 1 || due[0].ID != soon.ID || due[0].Text != "stand up" {
+		t.Fatalf("due in 2m = %+v", due)
+	}
+
+	if err := model.MarkReminderDelivered(d, soon.ID); err != nil {
+		t.Fatalf("MarkReminderDelivered: %v", err)
+	}
+	due, _ = model.ListDueReminders(d, now.Add(2*time.Hour))
+	if len(due) != 1 || due[0].Text != "go home" {
+		t.Errorf("due in 2h = %+v, want only the undelivered reminder", due)
+	}
+}
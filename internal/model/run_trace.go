@@ -0,0 +1,93 @@
+package model
+
+import (
+	"slices"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Kinds of run trace events.
+const (
+	TraceTrigger       = "trigger"
+	TraceLLMCall       = "llm_call"
+	TraceToolExecution = "tool_execution"
+	TraceMessage       = "message"
+)
+
+// RunTraceEvent is one step of a run. Exactly one of Message, LLMCall and
+// ToolExecution is set, according to Kind. At is when the step started.
+type RunTraceEvent struct {
+	Kind          string
+	At            time.Time
+	Message       *Message
+	LLMCall       *LLMCall
+	ToolExecution *ToolExecution
+}
+
+// RunTrace is a run with everything it did, in order.
+type RunTrace struct {
+	Run    AgentRun
+	Events []RunTraceEvent
+}
+
+// GetRunTrace returns a run's trace: the message that triggered it, its LLM
+// calls and tool executions in the order they started, and the messages it
+// posted, which a run only does once it is done calling the LLM.
+func GetRunTrace(d *db.DB, runID string) (RunTrace, error) {
+	run, err := GetAgentRun(d, runID)
+	if err != nil {
+		return RunTrace{}, err
+	}
+	trace := RunTrace{Run: run, Events: []RunTraceEvent{}}
+
+	if run.LastMessageID != 0 && run.ChannelID != 0 {
+		msgs, err := GetMessagesBetween(d, run.ChannelID, run.LastMessageID, run.LastMessageID)
+		if err != nil {
+			return RunTrace{}, err
+		}
+		for i := range msgs {
+			trace.Events = append(trace.Events, RunTraceEvent{Kind: TraceTrigger, At: msgs[i].CreatedAt, Message: &msgs[i]})
+		}
+	}
+
+	calls, err := ListRunLLMCalls(d, runID)
+	if err != nil {
+		return RunTrace{}, err
+	}
+	execs, err := ListRunToolExecutions(d, runID)
+	if err != nil {
+		return RunTrace{}, err
+	}
+	var steps []RunTraceEvent
+	for i := range calls {
+		c := &calls[i]
+		steps = append(steps, RunTraceEvent{Kind: TraceLLMCall, At: startedAt(c.StartedAt, c.CreatedAt, c.DurationMs), LLMCall: c})
+	}
+	for i := range execs {
+		e := &execs[i]
+		steps = append(steps, RunTraceEvent{Kind: TraceToolExecution, At: startedAt(e.StartedAt, e.CreatedAt, e.DurationMs), ToolExecution: e})
+	}
+	// Stable, so that an LLM call stays ahead of the tool calls it asked
+	// for when their times can't tell them apart.
+	slices.SortStableFunc(steps, func(a, b RunTraceEvent) int { return a.At.Compare(b.At) })
+	trace.Events = append(trace.Events, steps...)
+
+	posted, err := ListRunMessages(d, runID)
+	if err != nil {
+		return RunTrace{}, err
+	}
+	for i := range posted {
+		trace.Events = append(trace.Events, RunTraceEvent{Kind: TraceMessage, At: posted[i].CreatedAt, Message: &posted[i]})
+	}
+	return trace, nil
+}
+
+// startedAt returns started, or for rows recorded before start times were
+// kept, an estimate from when the row was written.
+func startedAt(started, created time.Time, durationMs int64) time.Time {
+	if !started.IsZero() {
+		return started
+	}
+	return created.Add(-time.Duration(durationMs) * time.Millisecond)
+}
@@ -0,0 +1,410 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Task statuses.
+const (
+	TaskTodo       = "todo"
+	TaskInProgress = "in_progress"
+	TaskBlocked    = "blocked"
+	TaskDone       = "done"
+	TaskCancelled  = "cancelled"
+)
+
+// ValidTaskStatus reports whether s is a task status.
+func ValidTaskStatus(s string) bool {
+	switch s {
+	case TaskTodo, TaskInProgress, TaskBlocked, TaskDone, TaskCancelled:
+		return true
+	}
+	return false
+}
+
+// Task event kinds. Every change to a task is recorded as an event; comments
+// are events too.
+const (
+	TaskEventCreated = "created"
+	TaskEventUpdated = "updated"
+	TaskEventComment = "comment"
+)
+
+// ErrTaskClaimed is returned by ClaimTask when someone else is assigned.
+var ErrTaskClaimed = errors.New("task is already assigned")
+
+// TaskAuthor identifies the human or persona making a change.
+type TaskAuthor struct {
+	Type string // "human" or "agent"
+	ID   int64
+	Name string
+}
+
+// Task is a work item on the shared task board. At most one of
+// AssigneeUserID and AssigneePersonaID is set.
+type Task struct {
+	ID                int64
+	Title             string
+	Description       string
+	Status            string
+	AssigneeUserID    int64
+	AssigneePersonaID int64
+	AssigneeName      string
+	ProjectID         int64
+	ChannelID         int64
+	ParentID          int64
+	DueAt             *time.Time
+	CreatedBy         TaskAuthor
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// TaskEvent is one entry in a task's history.
+type TaskEvent struct {
+	ID        int64
+	TaskID    int64
+	Kind      string
+	Author    TaskAuthor
+	Body      string
+	CreatedAt time.Time
+}
+
+// TaskFilter narrows ListTasks. Zero fields match everything; Unassigned
+// matches only tasks with no assignee.
+type TaskFilter struct {
+	Status            string
+	AssigneeUserID    int64
+	AssigneePersonaID int64
+	Unassigned        bool
+	ProjectID         int64
+	ChannelID         int64
+	ParentID          int64
+	Limit             int
+	Offset            int
+}
+
+const taskCols = `t.id, t.title, t.description, t.status, COALESCE(t.assignee_user_id, 0), COALESCE(t.assignee_persona_id, 0),
+	COALESCE(u.username, ap.name, ''), COALESCE(t.project_id, 0), COALESCE(t.channel_id, 0), COALESCE(t.parent_id, 0),
+	t.due_at, t.created_by_type, t.created_by_id, t.created_by_name, t.created_at, t.updated_at`
+
+const taskFrom = ` FROM tasks t
+	LEFT JOIN users u ON u.id = t.assignee_user_id
+	LEFT JOIN personas ap ON ap.id = t.assignee_persona_id`
+
+func scanTask(s interface{ Scan(...any) error }) (Task, error) {
+	var t Task
+	var due sql.NullTime
+	err := s.Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.AssigneeUserID, &t.AssigneePersonaID,
+		&t.AssigneeName, &t.ProjectID, &t.ChannelID, &t.ParentID,
+		&due, &t.CreatedBy.Type, &t.CreatedBy.ID, &t.CreatedBy.Name, &t.CreatedAt, &t.UpdatedAt)
+	if due.Valid {
+		t.DueAt = &due.Time
+	}
+	return t, err
+}
+
+const taskEventCols = "id, task_id, kind, author_type, author_id, author_name, body, created_at"
+
+func scanTaskEvent(s interface{ Scan(...any) error }) (TaskEvent, error) {
+	var e TaskEvent
+	err := s.Scan(&e.ID, &e.TaskID, &e.Kind, &e.Author.Type, &e.Author.ID, &e.Author.Name, &e.Body, &e.CreatedAt)
+	return e, err
+}
+
+func getTask(q interface {
+	QueryRow(string, ...any) *sql.Row
+}, id int64) (Task, error) {
+	return scanTask(q.QueryRow("SELECT "+taskCols+taskFrom+" WHERE t.id = ?", id))
+}
+
+func insertTaskEvent(tx *sql.Tx, taskID int64, kind string, by TaskAuthor, body string) (int64, error) {
+	res, err := tx.Exec(
+		`INSERT INTO task_events (task_id, kind, author_type, author_id, author_name, body) VALUES (?, ?, ?, ?, ?, ?)`,
+		taskID, kind, by.Type, by.ID, by.Name, body,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// CreateTask stores a new task created by by. An empty Status means todo.
+func CreateTask(d *db.DB, t Task, by TaskAuthor) (Task, error) {
+	if t.Status == "" {
+		t.Status = TaskTodo
+	}
+	var out Task
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`INSERT INTO tasks (title, description, status, assignee_user_id, assignee_persona_id, project_id, channel_id,
+			 parent_id, due_at, created_by_type, created_by_id, created_by_name)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			t.Title, t.Description, t.Status, nullID(t.AssigneeUserID), nullID(t.AssigneePersonaID),
+			nullID(t.ProjectID), nullID(t.ChannelID), nullID(t.ParentID), nullTime(t.DueAt), by.Type, by.ID, by.Name,
+		)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if _, err := insertTaskEvent(tx, id, TaskEventCreated, by, ""); err != nil {
+			return err
+		}
+		out, err = getTask(tx, id)
+		return err
+	})
+	return out, err
+}
+
+// GetTask returns a single task.
+func GetTask(d *db.DB, id int64) (Task, error) {
+	return getTask(d.SQL, id)
+}
+
+// ListTasks returns the tasks matching f, most recently updated first.
+func ListTasks(d *db.DB, f TaskFilter) ([]Task, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	for _, c := range []struct {
+		col string
+		val int64
+	}{
+		{"t.assignee_user_id", f.AssigneeUserID},
+		{"t.assignee_persona_id", f.AssigneePersonaID},
+		{"t.project_id", f.ProjectID},
+		{"t.channel_id", f.ChannelID},
+		{"t.parent_id", f.ParentID},
+	} {
+		if c.val != 0 {
+			where = append(where, c.col+" = ?")
+			args = append(args, c.val)
+		}
+	}
+	if f.Unassigned {
+		where = append(where, "t.assignee_user_id IS NULL AND t.assignee_persona_id IS NULL")
+	}
+	if f.Status != "" {
+		where = append(where, "t.status = ?")
+		args = append(args, f.Status)
+	}
+	query := "SELECT " + taskCols + taskFrom + " WHERE " + strings.Join(where, " AND ") + " ORDER BY t.updated_at DESC, t.id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := d.SQL.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// UpdateTask saves a task's editable fields and records what changed as an
+// event by by. Nothing is recorded if nothing changed.
+func UpdateTask(d *db.DB, t Task, by TaskAuthor) (Task, error) {
+	var out Task
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		old, err := getTask(tx, t.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`UPDATE tasks SET title = ?, description = ?, status = ?, assignee_user_id = ?, assignee_persona_id = ?,
+			 project_id = ?, channel_id = ?, parent_id = ?, due_at = ?
+			 WHERE id = ?`,
+			t.Title, t.Description, t.Status, nullID(t.AssigneeUserID), nullID(t.AssigneePersonaID),
+			nullID(t.ProjectID), nullID(t.ChannelID), nullID(t.ParentID), nullTime(t.DueAt), t.ID,
+		); err != nil {
+			return err
+		}
+		out, err = getTask(tx, t.ID)
+		if err != nil {
+			return err
+		}
+		changes := describeTaskChanges(old, out)
+		if changes == "" {
+			return nil
+		}
+		if _, err := insertTaskEvent(tx, t.ID, TaskEventUpdated, by, changes); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE tasks SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", t.ID); err != nil {
+			return err
+		}
+		out, err = getTask(tx, t.ID)
+		return err
+	})
+	return out, err
+}
+
+// ClaimTask assigns an unassigned task to a persona, moving it to
+// in_progress if it was todo. It returns ErrTaskClaimed if someone else is
+// already assigned; claiming a task the persona already holds is a no-op.
+func ClaimTask(d *db.DB, id, personaID int64, by TaskAuthor) (Task, error) {
+	var out Task
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		t, err := getTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if t.AssigneePersonaID == personaID {
+			out = t
+			return nil
+		}
+		if t.AssigneeUserID != 0 || t.AssigneePersonaID != 0 {
+			return fmt.Errorf("%w to %s", ErrTaskClaimed, t.AssigneeName)
+		}
+		if _, err := tx.Exec(
+			`UPDATE tasks SET assignee_persona_id = ?,
+			 status = CASE WHEN status = 'todo' THEN 'in_progress' ELSE status END,
+			 updated_at = CURRENT_TIMESTAMP
+			 WHERE id = ?`,
+			personaID, id,
+		); err != nil {
+			return err
+		}
+		if _, err := insertTaskEvent(tx, id, TaskEventUpdated, by, "claimed by "+by.Name); err != nil {
+			return err
+		}
+		out, err = getTask(tx, id)
+		return err
+	})
+	return out, err
+}
+
+// AddTaskComment records a comment on a task.
+func AddTaskComment(d *db.DB, taskID int64, by TaskAuthor, body string) (TaskEvent, error) {
+	var e TaskEvent
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		id, err := insertTaskEvent(tx, taskID, TaskEventComment, by, body)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE tasks SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", taskID); err != nil {
+			return err
+		}
+		e, err = scanTaskEvent(tx.QueryRow("SELECT "+taskEventCols+" FROM task_events WHERE id = ?", id))
+		return err
+	})
+	return e, err
+}
+
+// DeleteTask deletes a task and its history. Subtasks are kept without a parent.
+func DeleteTask(d *db.DB, id int64) error {
+	_, err := d.WriteExec("DELETE FROM tasks WHERE id = ?", id)
+	return err
+}
+
+// ListTaskEvents returns a task's history, oldest first.
+func ListTaskEvents(d *db.DB, taskID int64) ([]TaskEvent, error) {
+	return queryTaskEvents(d, "SELECT "+taskEventCols+" FROM task_events WHERE task_id = ? ORDER BY id", taskID)
+}
+
+// ListAssignedTaskEventsSince returns events after afterID on tasks currently
+// assigned to the persona, excluding the persona's own changes, oldest first.
+func ListAssignedTaskEventsSince(d *db.DB, personaID, afterID int64) ([]TaskEvent, error) {
+	return queryTaskEvents(d,
+		`SELECT e.id, e.task_id, e.kind, e.author_type, e.author_id, e.author_name, e.body, e.created_at
+		 FROM task_events e JOIN tasks t ON t.id = e.task_id
+		 WHERE t.assignee_persona_id = ? AND e.id > ?
+		   AND NOT (e.author_type = 'agent' AND e.author_id = ?)
+		 ORDER BY e.id`,
+		personaID, afterID, personaID,
+	)
+}
+
+// LatestTaskEventID returns the highest task event ID, or 0 if there are none.
+func LatestTaskEventID(d *db.DB) (int64, error) {
+	var id int64
+	err := d.SQL.QueryRow("SELECT COALESCE(MAX(id), 0) FROM task_events").Scan(&id)
+	return id, err
+}
+
+func queryTaskEvents(d *db.DB, query string, args ...any) ([]TaskEvent, error) {
+	rows, err := d.SQL.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TaskEvent
+	for rows.Next() {
+		e, err := scanTaskEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// describeTaskChanges summarizes the differences between two versions of a
+// task, one change per line.
+func describeTaskChanges(old, cur Task) string {
+	var lines []string
+	if old.Title != cur.Title {
+		lines = append(lines, fmt.Sprintf("title: %q → %q", old.Title, cur.Title))
+	}
+	if old.Description != cur.Description {
+		lines = append(lines, "description changed")
+	}
+	if old.Status != cur.Status {
+		lines = append(lines, fmt.Sprintf("status: %s → %s", old.Status, cur.Status))
+	}
+	if old.AssigneeUserID != cur.AssigneeUserID || old.AssigneePersonaID != cur.AssigneePersonaID {
+		lines = append(lines, fmt.Sprintf("assignee: %s → %s", orNone(old.AssigneeName), orNone(cur.AssigneeName)))
+	}
+	if old.ProjectID != cur.ProjectID {
+		lines = append(lines, fmt.Sprintf("project: %d → %d", old.ProjectID, cur.ProjectID))
+	}
+	if old.ChannelID != cur.ChannelID {
+		lines = append(lines, fmt.Sprintf("channel: %d → %d", old.ChannelID, cur.ChannelID))
+	}
+	if old.ParentID != cur.ParentID {
+		lines = append(lines, fmt.Sprintf("parent: %d → %d", old.ParentID, cur.ParentID))
+	}
+	if !sameTime(old.DueAt, cur.DueAt) {
+		lines = append(lines, fmt.Sprintf("due: %s → %s", formatDue(old.DueAt), formatDue(cur.DueAt)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func formatDue(t *time.Time) string {
+	if t == nil {
+		return "none"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,119 @@
+package model_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestTaskLifecycle(t *testing.T) {
+	d := openTestDB(t)
+	u, _ := model.CreateUser(d, "alice", "hash")
+	bot, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	alice := model.TaskAuthor{Type: "human", ID: u.ID, Name: "alice"}
+	botAuthor := model.TaskAuthor{Type: "agent", ID: bot.ID, Name: "bot"}
+
+	parent, err := model.CreateTask(d, model.Task{Title: "ship v2"}, alice)
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if parent.Status != model.TaskTodo || parent.CreatedBy != alice {
+		t.Errorf("unexpected task: %+v", parent)
+	}
+
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	task, err := model.CreateTask(d, model.Task{Title: "write docs", ParentID: parent.ID, DueAt: &due}, alice)
+	if err != nil {
+		t.Fatalf("CreateTask subtask: %v", err)
+	}
+
+	claimed, err := model.ClaimTask(d, task.ID, bot.ID, botAuthor)
+	if err != nil {
+		t.Fatalf("ClaimTask: %v", err)
+	}
+	if claimed.AssigneePersonaID != bot.ID || claimed.AssigneeName != "bot" || claimed.Status != model.TaskInProgress {
+		t.Errorf("unexpected claimed task: %+v", claimed)
+	}
+	if _, err := model.ClaimTask(d, task.ID, bot.ID, botAuthor); err != nil {
+		t.Errorf("reclaiming own task: %v", err)
+	}
+
+	claimed.AssigneePersonaID, claimed.AssigneeUserID = 0, u.ID
+	claimed.Status = model.TaskBlocked
+	updated, err := model.UpdateTask(d, claimed, alice)
+	if err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	if updated.AssigneeName != "alice" || updated.Status != model.TaskBlocked {
+		t.Errorf("unexpected updated task: %+v", updated)
+	}
+	if _, err := model.ClaimTask(d, task.ID, bot.ID, botAuthor); !errors.Is(err, model.ErrTaskClaimed) {
+		t.Errorf("claiming assigned task err = %v, want ErrTaskClaimed", err)
+	}
+
+	// An update that changes nothing records no event.
+	if _, err := model.UpdateTask(d, updated, alice); err != nil {
+		t.Fatalf("UpdateTask no-op: %v", err)
+	}
+	if _, err := model.AddTaskComment(d, task.ID, botAuthor, "need access"); err != nil {
+		t.Fatalf("AddTaskComment: %v", err)
+	}
+
+	events, err := model.ListTaskEvents(d, task.ID)
+	if err != nil || len(events) != 4 {
+		t.Fatalf("ListTaskEvents = %+v, %v", events, err)
+	}
+	kinds := []string{events[0].Kind, events[1].Kind, events[2].Kind, events[3].Kind}
+	if strings.Join(kinds, ",") != "created,updated,updated,comment" {
+		t.Errorf("event kinds = %v", kinds)
+	}
+	if !strings.Contains(events[2].Body, "status: in_progress → blocked") || !strings.Contains(events[2].Body, "assignee: bot → alice") {
+		t.Errorf("update event body = %q", events[2].Body)
+	}
+
+	subtasks, err := model.ListTasks(d, model.TaskFilter{ParentID: parent.ID})
+	if err != nil || len(subtasks) != 1 || subtasks[0].DueAt == nil || !subtasks[0].DueAt.Equal(due) {
+		t.Errorf("ListTasks by parent = %+v, %v", subtasks, err)
+	}
+	unassigned, _ := model.ListTasks(d, model.TaskFilter{Unassigned: true})
+	if len(unassigned) != 1 || unassigned[0].ID != parent.ID {
+		t.Errorf("unassigned tasks = %+v", unassigned)
+	}
+
+	if err := model.DeleteTask(d, parent.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	orphan, _ := model.GetTask(d, task.ID)
+	if orphan.ParentID != 0 {
+		t.Errorf("subtask parent = %d after parent deleted", orphan.ParentID)
+	}
+}
+
+func TestListAssignedTaskEventsSince(t *testing.T) {
+	d := openTestDB(t)
+	u, _ := model.CreateUser(d, "alice", "hash")
+	bot, _ := model.CreatePersona(d, "bot", "", "m", nil, 0.7, 100, 0, 0)
+	alice := model.TaskAuthor{Type: "human", ID: u.ID, Name: "alice"}
+	botAuthor := model.TaskAuthor{Type: "agent", ID: bot.ID, Name: "bot"}
+
+	model.CreateTask(d, model.Task{Title: "someone else's"}, alice)
+	task, _ := model.CreateTask(d, model.Task{Title: "mine", AssigneePersonaID: bot.ID}, alice)
+	model.AddTaskComment(d, task.ID, botAuthor, "on it")
+	model.AddTaskComment(d, task.ID, alice, "thanks")
+
+	events, err := model.ListAssignedTaskEventsSince(d, bot.ID, 0)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("events = %+v, %v", events, err)
+	}
+	if events[0].Kind != model.TaskEventCreated || events[1].Body != "thanks" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+
+	latest, _ := model.LatestTaskEventID(d)
+	if rest, _ := model.ListAssignedTaskEventsSince(d, bot.ID, latest); len(rest) != 0 {
+		t.Errorf("events after latest = %+v", rest)
+	}
+}
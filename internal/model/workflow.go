@@ -0,0 +1,333 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+)
+
+// Workflow run statuses.
+const (
+	WorkflowRunning   = "running"
+	WorkflowCompleted = "completed"
+	WorkflowFailed    = "failed"
+	WorkflowCancelled = "cancelled"
+)
+
+// Workflow triggers.
+const (
+	TriggerManual   = "manual"
+	TriggerCommand  = "command"
+	TriggerSchedule = "schedule"
+	TriggerWebhook  = "webhook"
+)
+
+// Workflow is a stored multi-agent workflow. Definition holds the JSON
+// stages and triggers; the agent package parses and runs it.
+type Workflow struct {
+	ID           int64
+	Name         string
+	Description  string
+	Definition   string
+	Enabled      bool
+	WebhookToken string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// WorkflowRun is one execution of a workflow. Definition is a snapshot taken
+// when the run started, so editing the workflow doesn't change runs in
+// flight. CurrentStage is the stage running or about to run.
+type WorkflowRun struct {
+	ID           int64
+	WorkflowID   int64
+	WorkflowName string
+	Definition   string
+	Trigger      string
+	Input        string
+	ChannelID    int64
+	StartedBy    string
+	Status       string
+	CurrentStage string
+	Error        string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	FinishedAt   *time.Time
+}
+
+// WorkflowStageRun is one persona's turn at a stage of a run. A stage that
+// is looped back to gets a row per visit.
+type WorkflowStageRun struct {
+	ID          int64
+	RunID       int64
+	Stage       string
+	PersonaID   int64
+	PersonaName string
+	Prompt      string
+	Output      string
+	Status      string
+	Error       string
+	StartedAt   time.Time
+	FinishedAt  *time.Time
+}
+
+// WorkflowRunFilter narrows ListWorkflowRuns.
+type WorkflowRunFilter struct {
+	WorkflowID int64
+	Status     string
+	Limit      int
+	Offset     int
+}
+
+const workflowCols = "id, name, description, definition, enabled, webhook_token, created_at, updated_at"
+
+func scanWorkflow(s interface{ Scan(...any) error }) (Workflow, error) {
+	var w Workflow
+	err := s.Scan(&w.ID, &w.Name, &w.Description, &w.Definition, &w.Enabled, &w.WebhookToken, &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+// CreateWorkflow stores a new workflow.
+func CreateWorkflow(d *db.DB, w Workflow) (Workflow, error) {
+	res, err := d.WriteExec(
+		"INSERT INTO workflows (name, description, definition, enabled, webhook_token) VALUES (?, ?, ?, ?, ?)",
+		w.Name, w.Description, w.Definition, w.Enabled, w.WebhookToken,
+	)
+	if err != nil {
+		return Workflow{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Workflow{}, err
+	}
+	return GetWorkflow(d, id)
+}
+
+// GetWorkflow returns a single workflow.
+func GetWorkflow(d *db.DB, id int64) (Workflow, error) {
+	return scanWorkflow(d.SQL.QueryRow("SELECT "+workflowCols+" FROM workflows WHERE id = ?", id))
+}
+
+// ListWorkflows returns all workflows ordered by name.
+func ListWorkflows(d *db.DB) ([]Workflow, error) {
+	rows, err := d.SQL.Query("SELECT " + workflowCols + " FROM workflows ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Workflow
+	for rows.Next() {
+		w, err := scanWorkflow(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// UpdateWorkflow saves a workflow's name, description, definition and
+// enabled flag.
+func UpdateWorkflow(d *db.DB, w Workflow) error {
+	_, err := d.WriteExec(
+		`UPDATE workflows SET name = ?, description = ?, definition = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`,
+		w.Name, w.Description, w.Definition, w.Enabled, w.ID,
+	)
+	return err
+}
+
+// DeleteWorkflow removes a workflow and its runs.
+func DeleteWorkflow(d *db.DB, id int64) error {
+	_, err := d.WriteExec("DELETE FROM workflows WHERE id = ?", id)
+	return err
+}
+
+const workflowRunCols = `r.id, r.workflow_id, COALESCE(w.name, ''), r.definition, r.trigger, r.input,
+	COALESCE(r.channel_id, 0), r.started_by, r.status, r.current_stage, r.error,
+	r.created_at, r.updated_at, r.finished_at`
+
+const workflowRunFrom = " FROM workflow_runs r LEFT JOIN workflows w ON w.id = r.workflow_id"
+
+func scanWorkflowRun(s interface{ Scan(...any) error }) (WorkflowRun, error) {
+	var r WorkflowRun
+	var finished sql.NullTime
+	err := s.Scan(&r.ID, &r.WorkflowID, &r.WorkflowName, &r.Definition, &r.Trigger, &r.Input,
+		&r.ChannelID, &r.StartedBy, &r.Status, &r.CurrentStage, &r.Error,
+		&r.CreatedAt, &r.UpdatedAt, &finished)
+	if finished.Valid {
+		r.FinishedAt = &finished.Time
+	}
+	return r, err
+}
+
+// CreateWorkflowRun records a running workflow run.
+func CreateWorkflowRun(d *db.DB, r WorkflowRun) (WorkflowRun, error) {
+	res, err := d.WriteExec(
+		`INSERT INTO workflow_runs (workflow_id, definition, trigger, input, channel_id, started_by, current_stage)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.WorkflowID, r.Definition, r.Trigger, r.Input, nullID(r.ChannelID), r.StartedBy, r.CurrentStage,
+	)
+	if err != nil {
+		return WorkflowRun{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return WorkflowRun{}, err
+	}
+	return GetWorkflowRun(d, id)
+}
+
+// GetWorkflowRun returns a single workflow run.
+func GetWorkflowRun(d *db.DB, id int64) (WorkflowRun, error) {
+	return scanWorkflowRun(d.SQL.QueryRow("SELECT "+workflowRunCols+workflowRunFrom+" WHERE r.id = ?", id))
+}
+
+// ListWorkflowRuns returns the runs matching f, newest first.
+func ListWorkflowRuns(d *db.DB, f WorkflowRunFilter) ([]WorkflowRun, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if f.WorkflowID != 0 {
+		where = append(where, "r.workflow_id = ?")
+		args = append(args, f.WorkflowID)
+	}
+	if f.Status != "" {
+		where = append(where, "r.status = ?")
+		args = append(args, f.Status)
+	}
+	query := "SELECT " + workflowRunCols + workflowRunFrom + " WHERE " + strings.Join(where, " AND ") + " ORDER BY r.id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := d.SQL.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WorkflowRun
+	for rows.Next() {
+		r, err := scanWorkflowRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SetWorkflowRunStage records the stage a run is at.
+func SetWorkflowRunStage(d *db.DB, id int64, stage string) error {
+	_, err := d.WriteExec(
+		"UPDATE workflow_runs SET current_stage = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		stage, id,
+	)
+	return err
+}
+
+// FinishWorkflowRun records a run's outcome. It only changes running runs,
+// so a run cancelled while its stage finishes stays cancelled; it reports
+// whether the run was updated.
+func FinishWorkflowRun(d *db.DB, id int64, status, errText string) (bool, error) {
+	res, err := d.WriteExec(
+		`UPDATE workflow_runs SET status = ?, error = ?, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status = 'running'`,
+		status, errText, id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// LastWorkflowRunAt returns when the workflow was last run by trigger, or
+// nil if it never was.
+func LastWorkflowRunAt(d *db.DB, workflowID int64, trigger string) (*time.Time, error) {
+	var t time.Time
+	err := d.SQL.QueryRow(
+		"SELECT created_at FROM workflow_runs WHERE workflow_id = ? AND trigger = ? ORDER BY id DESC LIMIT 1",
+		workflowID, trigger,
+	).Scan(&t)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+const workflowStageRunCols = `id, run_id, stage, COALESCE(persona_id, 0), persona_name, prompt, output, status, error,
+	started_at, finished_at`
+
+func scanWorkflowStageRun(s interface{ Scan(...any) error }) (WorkflowStageRun, error) {
+	var sr WorkflowStageRun
+	var finished sql.NullTime
+	err := s.Scan(&sr.ID, &sr.RunID, &sr.Stage, &sr.PersonaID, &sr.PersonaName, &sr.Prompt, &sr.Output,
+		&sr.Status, &sr.Error, &sr.StartedAt, &finished)
+	if finished.Valid {
+		sr.FinishedAt = &finished.Time
+	}
+	return sr, err
+}
+
+// CreateWorkflowStageRun records a stage starting.
+func CreateWorkflowStageRun(d *db.DB, sr WorkflowStageRun) (WorkflowStageRun, error) {
+	res, err := d.WriteExec(
+		"INSERT INTO workflow_stage_runs (run_id, stage, persona_id, persona_name, prompt) VALUES (?, ?, ?, ?, ?)",
+		sr.RunID, sr.Stage, nullID(sr.PersonaID), sr.PersonaName, sr.Prompt,
+	)
+	if err != nil {
+		return WorkflowStageRun{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return WorkflowStageRun{}, err
+	}
+	return scanWorkflowStageRun(d.SQL.QueryRow("SELECT "+workflowStageRunCols+" FROM workflow_stage_runs WHERE id = ?", id))
+}
+
+// FinishWorkflowStageRun records a stage's output or error.
+func FinishWorkflowStageRun(d *db.DB, id int64, status, output, errText string) error {
+	_, err := d.WriteExec(
+		"UPDATE workflow_stage_runs SET status = ?, output = ?, error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?",
+		status, output, errText, id,
+	)
+	return err
+}
+
+// FailRunningWorkflowStageRuns marks a run's unfinished stages as failed
+// with errText, e.g. when the process stopped mid-stage.
+func FailRunningWorkflowStageRuns(d *db.DB, runID int64, errText string) error {
+	_, err := d.WriteExec(
+		`UPDATE workflow_stage_runs SET status = 'failed', error = ?, finished_at = CURRENT_TIMESTAMP
+		 WHERE run_id = ? AND status = 'running'`,
+		errText, runID,
+	)
+	return err
+}
+
+// ListWorkflowStageRuns returns a run's stages in the order they ran.
+func ListWorkflowStageRuns(d *db.DB, runID int64) ([]WorkflowStageRun, error) {
+	rows, err := d.SQL.Query("SELECT "+workflowStageRunCols+" FROM workflow_stage_runs WHERE run_id = ? ORDER BY id", runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WorkflowStageRun
+	for rows.Next() {
+		sr, err := scanWorkflowStageRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sr)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,72 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestWorkflowRunLifecycle(t *testing.T) {
+	d := openTestDB(t)
+	p, _ := model.CreatePersona(d, "architect", "", "m", nil, 0.7, 100, 0, 0)
+	wf, err := model.CreateWorkflow(d, model.Workflow{Name: "ship", Definition: `{"stages": []}`, Enabled: true, WebhookToken: "t"})
+	if err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	if !wf.Enabled || wf.WebhookToken != "t" {
+		t.Errorf("workflow = %+v", wf)
+	}
+
+	if last, err := model.LastWorkflowRunAt(d, wf.ID, model.TriggerSchedule); err != nil || last != nil {
+		t.Fatalf("LastWorkflowRunAt before any run = %v, %v", last, err)
+	}
+	run, err := model.CreateWorkflowRun(d, model.WorkflowRun{
+		WorkflowID: wf.ID, Definition: wf.Definition, Trigger: model.TriggerSchedule, CurrentStage: "design",
+	})
+	if err != nil {
+		t.Fatalf("CreateWorkflowRun: %v", err)
+	}
+	if run.Status != model.WorkflowRunning || run.WorkflowName != "ship" || run.ChannelID != 0 {
+		t.Errorf("run = %+v", run)
+	}
+	if last, _ := model.LastWorkflowRunAt(d, wf.ID, model.TriggerSchedule); last == nil {
+		t.Error("LastWorkflowRunAt missed the scheduled run")
+	}
+	if last, _ := model.LastWorkflowRunAt(d, wf.ID, model.TriggerWebhook); last != nil {
+		t.Error("LastWorkflowRunAt matched another trigger")
+	}
+
+	sr, err := model.CreateWorkflowStageRun(d, model.WorkflowStageRun{RunID: run.ID, Stage: "design", PersonaID: p.ID, PersonaName: p.Name, Prompt: "go"})
+	if err != nil {
+		t.Fatalf("CreateWorkflowStageRun: %v", err)
+	}
+	model.CreateWorkflowStageRun(d, model.WorkflowStageRun{RunID: run.ID, Stage: "review", PersonaName: "gone", Prompt: "check"})
+	model.FinishWorkflowStageRun(d, sr.ID, model.WorkflowCompleted, "plan", "")
+	model.FailRunningWorkflowStageRuns(d, run.ID, "interrupted")
+	stages, _ := model.ListWorkflowStageRuns(d, run.ID)
+	if len(stages) != 2 || stages[0].Output != "plan" || stages[0].FinishedAt == nil || stages[1].Status != model.WorkflowFailed || stages[1].Error != "interrupted" {
+		t.Errorf("stages = %+v", stages)
+	}
+
+	if ok, err := model.FinishWorkflowRun(d, run.ID, model.WorkflowCancelled, "cancelled"); err != nil || !ok {
+		t.Fatalf("FinishWorkflowRun = %v, %v", ok, err)
+	}
+	// A finished run keeps its outcome.
+	if ok, _ := model.FinishWorkflowRun(d, run.ID, model.WorkflowCompleted, ""); ok {
+		t.Error("FinishWorkflowRun overwrote a finished run")
+	}
+	run, _ = model.GetWorkflowRun(d, run.ID)
+	if run.Status != model.WorkflowCancelled || run.FinishedAt == nil {
+		t.Errorf("run = %+v", run)
+	}
+
+	if running, _ := model.ListWorkflowRuns(d, model.WorkflowRunFilter{Status: model.WorkflowRunning}); len(running) != 0 {
+		t.Errorf("running runs = %+v", running)
+	}
+	if err := model.DeleteWorkflow(d, wf.ID); err != nil {
+		t.Fatalf("DeleteWorkflow: %v", err)
+	}
+	if runs, _ := model.ListWorkflowRuns(d, model.WorkflowRunFilter{}); len(runs) != 0 {
+		t.Errorf("runs survived workflow deletion: %+v", runs)
+	}
+}
@@ -14,3 +14,45 @@ func ProjectDirFromContext(ctx context.Context) string {
 	dir, _ := ctx.Value(projectDirKey).(string)
 	return dir
 }
+
+const projectIDKey contextKey = "project_id"
+
+// WithProjectID returns a context carrying the ID of the project whose
+// directory is set by WithProjectDir.
+func WithProjectID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, projectIDKey, id)
+}
+
+// ProjectIDFromContext retrieves the project ID from a context, or 0 if not set.
+func ProjectIDFromContext(ctx context.Context) int64 {
+	id, _ := ctx.Value(projectIDKey).(int64)
+	return id
+}
+
+const channelIDKey contextKey = "channel_id"
+
+// WithChannelID returns a context carrying the ID of the channel a tool call
+// is made from.
+func WithChannelID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, channelIDKey, id)
+}
+
+// ChannelIDFromContext retrieves the channel ID from a context, or 0 if not set.
+func ChannelIDFromContext(ctx context.Context) int64 {
+	id, _ := ctx.Value(channelIDKey).(int64)
+	return id
+}
+
+const delegationDepthKey contextKey = "delegation_depth"
+
+// WithDelegationDepth returns a context marking a run as nested depth
+// delegations deep. Top-level runs have depth 0.
+func WithDelegationDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, delegationDepthKey, depth)
+}
+
+// DelegationDepthFromContext retrieves the delegation depth from a context, or 0 if not set.
+func DelegationDepthFromContext(ctx context.Context) int {
+	depth, _ := ctx.Value(delegationDepthKey).(int)
+	return depth
+}
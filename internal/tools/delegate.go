@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Delegation timeouts. A delegate call without timeout_secs waits
+// DefaultDelegateTimeout for the answer.
+const (
+	DefaultDelegateTimeout = 5 * time.Minute
+	MaxDelegateTimeout     = 30 * time.Minute
+)
+
+// DelegateRequest asks another persona to carry out a subtask.
+type DelegateRequest struct {
+	FromPersonaID   int64
+	OriginChannelID int64
+	Persona         string // target persona name or numeric ID
+	Instructions    string
+	ProjectID       int64
+	Timeout         time.Duration
+	Depth           int // delegation depth of the calling run
+}
+
+// Delegator runs a delegated subtask to completion and returns the target
+// persona's final answer.
+type Delegator interface {
+	Delegate(ctx context.Context, req DelegateRequest) (string, error)
+}
+
+type delegateArgs struct {
+	Persona      string `json:"persona"`
+	Instructions string `json:"instructions"`
+	ProjectID    int64  `json:"project_id"`
+	TimeoutSecs  int    `json:"timeout_secs"`
+}
+
+// Delegate returns a ToolFunc that hands a subtask to another persona and
+// returns its answer. The project defaults to the caller's current project.
+func Delegate(d Delegator) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args delegateArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		if strings.TrimSpace(args.Persona) == "" {
+			return "", fmt.Errorf("persona is required")
+		}
+		if strings.TrimSpace(args.Instructions) == "" {
+			return "", fmt.Errorf("instructions are required")
+		}
+		personaID := PersonaIDFromContext(ctx)
+		if personaID == 0 {
+			return "", fmt.Errorf("persona_id not set in context")
+		}
+
+		timeout := DefaultDelegateTimeout
+		if args.TimeoutSecs < 0 {
+			return "", fmt.Errorf("timeout_secs must not be negative")
+		}
+		if args.TimeoutSecs > 0 {
+			timeout = min(time.Duration(args.TimeoutSecs)*time.Second, MaxDelegateTimeout)
+		}
+		projectID := args.ProjectID
+		if projectID == 0 {
+			projectID = ProjectIDFromContext(ctx)
+		}
+
+		return d.Delegate(ctx, DelegateRequest{
+			FromPersonaID:   personaID,
+			OriginChannelID: ChannelIDFromContext(ctx),
+			Persona:         strings.TrimSpace(args.Persona),
+			Instructions:    args.Instructions,
+			ProjectID:       projectID,
+			Timeout:         timeout,
+			Depth:           DelegationDepthFromContext(ctx),
+		})
+	}
+}
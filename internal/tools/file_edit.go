@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/waynenilsen/waynebot/internal/diff"
+)
+
+type fileEditArgs struct {
+	Path       string `json:"path"`
+	OldString  string `json:"old_string"`
+	NewString  string `json:"new_string"`
+	ReplaceAll bool   `json:"replace_all"`
+}
+
+// FileEdit returns a ToolFunc that replaces an exact string in a file within
+// the project directory. The old string must match exactly once unless
+// replace_all is set. The result is a unified diff of the change. Like
+// FileWrite, the edit is staged when the context carries a Staging overlay.
+func FileEdit(baseDir string) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args fileEditArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("invalid args: %w", err)
+		}
+		if args.Path == "" {
+			return "", fmt.Errorf("path is required")
+		}
+		if args.OldString == "" {
+			return "", fmt.Errorf("old_string is required")
+		}
+		if args.OldString == args.NewString {
+			return "", fmt.Errorf("old_string and new_string are identical")
+		}
+
+		dir := baseDir
+		if d := ProjectDirFromContext(ctx); d != "" {
+			dir = d
+		}
+
+		resolved, err := securePath(dir, args.Path)
+		if err != nil {
+			return "", err
+		}
+
+		size, isDir, err := statFile(ctx, resolved)
+		if err != nil {
+			return "", fmt.Errorf("stat: %w", err)
+		}
+		if isDir {
+			return "", fmt.Errorf("path is a directory")
+		}
+		if size > maxFileWriteSize {
+			return "", fmt.Errorf("file too large: %d bytes (max %d)", size, maxFileWriteSize)
+		}
+
+		data, err := readFile(ctx, resolved)
+		if err != nil {
+			return "", fmt.Errorf("read: %w", err)
+		}
+		before := string(data)
+
+		count := strings.Count(before, args.OldString)
+		switch {
+		case count == 0:
+			return "", fmt.Errorf("old_string not found in %s", args.Path)
+		case count > 1 && !args.ReplaceAll:
+			return "", fmt.Errorf("old_string matches %d times in %s; include more surrounding context or set replace_all", count, args.Path)
+		}
+
+		var after string
+		if args.ReplaceAll {
+			after = strings.ReplaceAll(before, args.OldString, args.NewString)
+		} else {
+			after = strings.Replace(before, args.OldString, args.NewString, 1)
+		}
+		if len(after) > maxFileWriteSize {
+			return "", fmt.Errorf("content too large: %d bytes (max %d)", len(after), maxFileWriteSize)
+		}
+
+		if err := writeFile(ctx, resolved, []byte(after), 0o644); err != nil {
+			return "", fmt.Errorf("write: %w", err)
+		}
+
+		return diff.Unified("a/"+args.Path, "b/"+args.Path, before, after), nil
+	}
+}
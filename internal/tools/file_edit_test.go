@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileEditReplacesUniqueMatch(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc a() {}\n\nfunc b() {}\n"), 0o644)
+
+	args, _ := json.Marshal(fileEditArgs{Path: "main.go", OldString: "func b() {}", NewString: "func c() {}"})
+	out, err := FileEdit(dir)(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "--- a/main.go") || !strings.Contains(out, "-func b() {}") || !strings.Contains(out, "+func c() {}") {
+		t.Fatalf("unexpected diff: %s", out)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "main.go"))
+	if string(data) != "package main\n\nfunc a() {}\n\nfunc c() {}\n" {
+		t.Fatalf("file content = %q", data)
+	}
+}
+
+func TestFileEditAmbiguousMatch(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "f.txt"), []byte("x\nx\n"), 0o644)
+	fn := FileEdit(dir)
+
+	_, err := fn(context.Background(), json.RawMessage(`{"path":"f.txt","old_string":"x","new_string":"y"}`))
+	if err == nil || !strings.Contains(err.Error(), "matches 2 times") {
+		t.Fatalf("expected ambiguity error, got %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "f.txt"))
+	if string(data) != "x\nx\n" {
+		t.Fatalf("file modified on error: %q", data)
+	}
+
+	if _, err := fn(context.Background(), json.RawMessage(`{"path":"f.txt","old_string":"x","new_string":"y","replace_all":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "f.txt"))
+	if string(data) != "y\ny\n" {
+		t.Fatalf("file content = %q", data)
+	}
+}
+
+func TestFileEditNotFound(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "f.txt"), []byte("hello\n"), 0o644)
+
+	_, err := FileEdit(dir)(context.Background(), json.RawMessage(`{"path":"f.txt","old_string":"bye","new_string":"hi"}`))
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestFileEditPathTraversal(t *testing.T) {
+	fn := FileEdit(t.TempDir())
+
+	_, err := fn(context.Background(), json.RawMessage(`{"path":"../../etc/passwd","old_string":"root","new_string":"x"}`))
+	if err == nil || !strings.Contains(err.Error(), "escape") {
+		t.Fatalf("expected sandbox error, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultGrepResults = 200
+	maxGrepResults     = 2000
+	maxGrepContext     = 10
+	maxGrepFileSize    = 1 << 20 // 1MB
+	maxGrepOutput      = 50 * 1024
+)
+
+type fileGrepArgs struct {
+	Pattern    string `json:"pattern"`
+	Path       string `json:"path"`
+	Glob       string `json:"glob"`
+	Context    int    `json:"context"`
+	IgnoreCase bool   `json:"ignore_case"`
+	MaxResults int    `json:"max_results"`
+}
+
+// FileGrep returns a ToolFunc that searches files within the project
+// directory for a regular expression. Matches are reported grep-style as
+// "path:line:text" with context lines as "path-line-text". Binary files,
+// files over 1MB and ignored paths (see FileList) are skipped.
+func FileGrep(baseDir string) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args fileGrepArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("invalid args: %w", err)
+		}
+		if args.Pattern == "" {
+			return "", fmt.Errorf("pattern is required")
+		}
+		expr := args.Pattern
+		if args.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+		contextLines := min(max(args.Context, 0), maxGrepContext)
+		maxResults := args.MaxResults
+		if maxResults <= 0 {
+			maxResults = defaultGrepResults
+		}
+		maxResults = min(maxResults, maxGrepResults)
+
+		dir := baseDir
+		if d := ProjectDirFromContext(ctx); d != "" {
+			dir = d
+		}
+
+		root, err := securePath(dir, args.Path)
+		if err != nil {
+			return "", err
+		}
+
+		var sb strings.Builder
+		matches := 0
+		truncated := false
+		err = walkProject(ctx, dir, root, func(rel string) bool {
+			if args.Glob != "" && !matchGlob(args.Glob, rel) {
+				return true
+			}
+			data, err := readFile(ctx, filepath.Join(dir, filepath.FromSlash(rel)))
+			if err != nil || len(data) > maxGrepFileSize || bytes.IndexByte(data, 0) >= 0 {
+				return true
+			}
+			n := grepFile(&sb, rel, string(data), re, contextLines, maxResults-matches)
+			matches += n
+			if matches >= maxResults || sb.Len() > maxGrepOutput {
+				truncated = true
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if matches == 0 {
+			return "no matches found", nil
+		}
+		out := sb.String()
+		if len(out) > maxGrepOutput {
+			out = out[:maxGrepOutput]
+		}
+		if truncated {
+			out += fmt.Sprintf("... (stopped after %d matches)\n", matches)
+		}
+		return out, nil
+	}
+}
+
+// grepFile writes up to limit matching lines of content to sb, with
+// surrounding context, and returns the number of matches written.
+func grepFile(sb *strings.Builder, rel, content string, re *regexp.Regexp, contextLines, limit int) int {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	matches := 0
+	printed := -1 // index of the last line written
+	for i, line := range lines {
+		if matches >= limit {
+			break
+		}
+		if !re.MatchString(line) {
+			continue
+		}
+		start := max(i-contextLines, printed+1)
+		if printed >= 0 && start > printed+1 {
+			sb.WriteString("--\n")
+		}
+		for j := start; j < i; j++ {
+			fmt.Fprintf(sb, "%s-%d-%s\n", rel, j+1, lines[j])
+		}
+		fmt.Fprintf(sb, "%s:%d:%s\n", rel, i+1, line)
+		matches++
+		printed = i
+
+		// Trailing context stops at the next match so it is reported as a
+		// match rather than as context.
+		end := min(i+contextLines, len(lines)-1)
+		for j := i + 1; j <= end && !re.MatchString(lines[j]); j++ {
+			fmt.Fprintf(sb, "%s-%d-%s\n", rel, j+1, lines[j])
+			printed = j
+		}
+	}
+	if matches > 0 && contextLines > 0 {
+		sb.WriteString("--\n")
+	}
+	return matches
+}
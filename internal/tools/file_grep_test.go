@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFileGrepMatchesWithContext(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.go":              "package a\n\nfunc Hello() {}\n\nfunc other() {}\n",
+		"b.txt":             "hello there\n",
+		"node_modules/m.go": "func Hello() {}\n",
+		"bin/blob":          "Hello\x00",
+	})
+
+	out, err := FileGrep(dir)(context.Background(), json.RawMessage(`{"pattern":"func Hello","context":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a.go-2-\na.go:3:func Hello() {}\na.go-4-\n--\n"
+	if out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestFileGrepIgnoreCaseAndGlob(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.go":  "Hello\n",
+		"b.txt": "hello there\n",
+	})
+	fn := FileGrep(dir)
+
+	out, err := fn(context.Background(), json.RawMessage(`{"pattern":"hello","ignore_case":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "a.go:1:Hello") || !strings.Contains(out, "b.txt:1:hello there") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	out, err = fn(context.Background(), json.RawMessage(`{"pattern":"hello","ignore_case":true,"glob":"*.txt"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "b.txt:1:hello there\n" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestFileGrepMaxResults(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "x\nx\nx\n"})
+
+	out, err := FileGrep(dir)(context.Background(), json.RawMessage(`{"pattern":"x","max_results":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, "a.txt:") != 2 || !strings.Contains(out, "stopped after 2 matches") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestFileGrepInvalidPattern(t *testing.T) {
+	_, err := FileGrep(t.TempDir())(context.Background(), json.RawMessage(`{"pattern":"("}`))
+	if err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Fatalf("expected invalid pattern error, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultFileListLimit = 500
+	maxFileListLimit     = 5000
+)
+
+// alwaysIgnored are directory names skipped by file_list and file_grep
+// regardless of .gitignore.
+var alwaysIgnored = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+}
+
+type fileListArgs struct {
+	Pattern string `json:"pattern"`
+	Path    string `json:"path"`
+	Limit   int    `json:"limit"`
+}
+
+// FileList returns a ToolFunc that lists files within the project directory,
+// optionally filtered by a glob pattern. Patterns support "**" to match any
+// number of directories; a pattern without a slash matches file names at any
+// depth. .git, node_modules and entries matched by the project's root
+// .gitignore are skipped.
+func FileList(baseDir string) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args fileListArgs
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", fmt.Errorf("invalid args: %w", err)
+			}
+		}
+		if args.Pattern != "" {
+			if _, err := path.Match(strings.ReplaceAll(args.Pattern, "**", "*"), ""); err != nil {
+				return "", fmt.Errorf("invalid pattern: %w", err)
+			}
+		}
+		limit := args.Limit
+		if limit <= 0 {
+			limit = defaultFileListLimit
+		}
+		limit = min(limit, maxFileListLimit)
+
+		dir := baseDir
+		if d := ProjectDirFromContext(ctx); d != "" {
+			dir = d
+		}
+
+		root, err := securePath(dir, args.Path)
+		if err != nil {
+			return "", err
+		}
+
+		var files []string
+		truncated := false
+		err = walkProject(ctx, dir, root, func(rel string) bool {
+			if args.Pattern != "" && !matchGlob(args.Pattern, rel) {
+				return true
+			}
+			if len(files) >= limit {
+				truncated = true
+				return false
+			}
+			files = append(files, rel)
+			return true
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if len(files) == 0 {
+			return "no files found", nil
+		}
+		out := strings.Join(files, "\n")
+		if truncated {
+			out += fmt.Sprintf("\n... (truncated at %d files)", limit)
+		}
+		return out, nil
+	}
+}
+
+// walkProject calls fn with the slash-separated path (relative to base) of
+// every regular file under root, skipping ignored entries and including new
+// files staged in ctx. Walking stops when fn returns false.
+func walkProject(ctx context.Context, base, root string, fn func(rel string) bool) error {
+	ignore := loadGitignore(base)
+	stopped := false
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if p != root && (alwaysIgnored[d.Name()] || ignore.match(rel, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || ignore.match(rel, false) {
+			return nil
+		}
+		if !fn(rel) {
+			stopped = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil && !stopped {
+		return fmt.Errorf("walk: %w", err)
+	}
+	if stopped {
+		return nil
+	}
+
+	// Files created in a staging overlay don't exist on disk yet.
+	if s := StagingFromContext(ctx); s != nil {
+		for _, f := range s.Files() {
+			if f.Existed {
+				continue
+			}
+			abs := filepath.Join(s.Dir, filepath.FromSlash(f.Path))
+			if r, err := filepath.Rel(root, abs); err != nil || r == ".." || strings.HasPrefix(r, "../") {
+				continue
+			}
+			rel, err := filepath.Rel(base, abs)
+			if err != nil || ignore.match(filepath.ToSlash(rel), false) {
+				continue
+			}
+			if !fn(filepath.ToSlash(rel)) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether the slash-separated path rel matches pattern.
+// "**" matches zero or more path segments. A pattern without a slash is
+// matched against the file name only.
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// gitignore holds the patterns from a project's root .gitignore. Only the
+// common subset of the format is supported: comments, blank lines, anchored
+// patterns, directory-only patterns and "**". Negations are ignored.
+type gitignore struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	glob     string
+	anchored bool
+	dirOnly  bool
+}
+
+func loadGitignore(base string) gitignore {
+	f, err := os.Open(filepath.Join(base, ".gitignore"))
+	if err != nil {
+		return gitignore{}
+	}
+	defer f.Close()
+
+	var g gitignore
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.glob = line
+		g.patterns = append(g.patterns, p)
+	}
+	return g
+}
+
+func (g gitignore) match(rel string, isDir bool) bool {
+	for _, p := range g.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.anchored {
+			if matchSegments(strings.Split(p.glob, "/"), strings.Split(rel, "/")) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p.glob, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files (slash-separated relative paths) under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileListGlobAndIgnores(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":           "# build output\n/dist/\n*.log\n",
+		"main.go":              "",
+		"internal/a/a.go":      "",
+		"internal/a/a_test.go": "",
+		"README.md":            "",
+		"debug.log":            "",
+		"dist/out.go":          "",
+		"node_modules/x/x.go":  "",
+		".git/config":          "",
+	})
+	fn := FileList(dir)
+
+	out, err := fn(context.Background(), json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"main.go", "internal/a/a.go", "README.md"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in %s", want, out)
+		}
+	}
+	for _, skip := range []string{"debug.log", "dist/", "node_modules", ".git/"} {
+		if strings.Contains(out, skip) {
+			t.Errorf("expected %s to be ignored: %s", skip, out)
+		}
+	}
+
+	out, err = fn(context.Background(), json.RawMessage(`{"pattern":"internal/**/*_test.go"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "internal/a/a_test.go" {
+		t.Fatalf("got %q", out)
+	}
+
+	out, err = fn(context.Background(), json.RawMessage(`{"pattern":"*.go","path":"internal"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "internal/a/a.go\ninternal/a/a_test.go" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestFileListLimit(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "", "b.txt": "", "c.txt": ""})
+
+	out, err := FileList(dir)(context.Background(), json.RawMessage(`{"limit":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "truncated at 2 files") {
+		t.Fatalf("expected truncation note: %s", out)
+	}
+}
+
+func TestFileListPathTraversal(t *testing.T) {
+	_, err := FileList(t.TempDir())(context.Background(), json.RawMessage(`{"path":"../.."}`))
+	if err == nil || !strings.Contains(err.Error(), "escape") {
+		t.Fatalf("expected sandbox error, got %v", err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.go", "a/b/c.go", true},
+		{"**/*.go", "c.go", true},
+		{"a/**/c.go", "a/c.go", true},
+		{"a/**/c.go", "a/x/y/c.go", true},
+		{"a/*.go", "a/b/c.go", false},
+		{"b/*.go", "a/b/c.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package tools
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
 	"strings"
 )
@@ -12,11 +13,14 @@ import (
 const maxFileReadSize = 1 << 20 // 1MB
 
 type fileReadArgs struct {
-	Path string `json:"path"`
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
 }
 
 // FileRead returns a ToolFunc that reads files within the project directory.
-// Path traversal is rejected and files larger than 1MB are refused.
+// Path traversal is rejected. Whole-file reads of files larger than 1MB are
+// refused; a line range (1-based, inclusive) may be read from any file.
 func FileRead(baseDir string) ToolFunc {
 	return func(ctx context.Context, raw json.RawMessage) (string, error) {
 		var args fileReadArgs
@@ -37,18 +41,26 @@ func FileRead(baseDir string) ToolFunc {
 			return "", err
 		}
 
-		info, err := os.Stat(resolved)
+		size, isDir, err := statFile(ctx, resolved)
 		if err != nil {
 			return "", fmt.Errorf("stat: %w", err)
 		}
-		if info.IsDir() {
+		if isDir {
 			return "", fmt.Errorf("path is a directory")
 		}
-		if info.Size() > maxFileReadSize {
-			return "", fmt.Errorf("file too large: %d bytes (max %d)", info.Size(), maxFileReadSize)
+		if args.StartLine > 0 || args.EndLine > 0 {
+			f, err := openFile(ctx, resolved)
+			if err != nil {
+				return "", fmt.Errorf("read: %w", err)
+			}
+			defer f.Close()
+			return readLineRange(f, args.StartLine, args.EndLine)
+		}
+		if size > maxFileReadSize {
+			return "", fmt.Errorf("file too large: %d bytes (max %d)", size, maxFileReadSize)
 		}
 
-		data, err := os.ReadFile(resolved)
+		data, err := readFile(ctx, resolved)
 		if err != nil {
 			return "", fmt.Errorf("read: %w", err)
 		}
@@ -56,6 +68,44 @@ func FileRead(baseDir string) ToolFunc {
 	}
 }
 
+// readLineRange returns lines start..end (1-based, inclusive) read from f.
+// A zero start means the first line and a zero end means the last.
+func readLineRange(f io.Reader, start, end int) (string, error) {
+	if start <= 0 {
+		start = 1
+	}
+	if end > 0 && end < start {
+		return "", fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+
+	r := bufio.NewReader(f)
+	var sb strings.Builder
+	for n := 1; end <= 0 || n <= end; n++ {
+		line, err := r.ReadString('\n')
+		if n >= start {
+			if sb.Len()+len(line) > maxFileReadSize {
+				return "", fmt.Errorf("line range too large (max %d bytes)", maxFileReadSize)
+			}
+			sb.WriteString(line)
+		}
+		if err != nil {
+			if n < start || line == "" && n == start {
+				lines := n
+				if line == "" {
+					lines--
+				}
+				if start == 1 && lines == 0 {
+					// An empty file has nothing to read, not a line 1 missing.
+					return "", nil
+				}
+				return "", fmt.Errorf("start_line %d is past end of file (%d lines)", start, lines)
+			}
+			break
+		}
+	}
+	return sb.String(), nil
+}
+
 // securePath resolves path under baseDir and ensures it doesn't escape.
 func securePath(baseDir, path string) (string, error) {
 	cleaned := filepath.Clean(filepath.Join(baseDir, path))
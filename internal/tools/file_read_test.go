@@ -75,3 +75,59 @@ func TestFileReadTooLarge(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestFileReadLineRange(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "f.txt"), []byte("one\ntwo\nthree\nfour\n"), 0o644)
+	fn := FileRead(dir)
+
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{2, 3, "two\nthree\n"},
+		{3, 0, "three\nfour\n"},
+		{0, 1, "one\n"},
+		{4, 10, "four\n"},
+	}
+	for _, tt := range tests {
+		args, _ := json.Marshal(fileReadArgs{Path: "f.txt", StartLine: tt.start, EndLine: tt.end})
+		out, err := fn(context.Background(), args)
+		if err != nil {
+			t.Fatalf("range %d-%d: %v", tt.start, tt.end, err)
+		}
+		if out != tt.want {
+			t.Errorf("range %d-%d = %q, want %q", tt.start, tt.end, out, tt.want)
+		}
+	}
+}
+
+func TestFileReadLineRangeEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "empty.txt"), nil, 0o644)
+	fn := FileRead(dir)
+
+	out, err := fn(context.Background(), json.RawMessage(`{"path":"empty.txt","start_line":1,"end_line":5}`))
+	if err != nil || out != "" {
+		t.Fatalf("ranged read of empty file = %q, %v; want empty content", out, err)
+	}
+	_, err = fn(context.Background(), json.RawMessage(`{"path":"empty.txt","start_line":2}`))
+	if err == nil || !strings.Contains(err.Error(), "(0 lines)") {
+		t.Fatalf("expected past-EOF error for line 2, got %v", err)
+	}
+}
+
+func TestFileReadLineRangeErrors(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "f.txt"), []byte("one\ntwo\n"), 0o644)
+	fn := FileRead(dir)
+
+	_, err := fn(context.Background(), json.RawMessage(`{"path":"f.txt","start_line":5}`))
+	if err == nil || !strings.Contains(err.Error(), "(2 lines)") {
+		t.Fatalf("expected past-EOF error, got %v", err)
+	}
+	_, err = fn(context.Background(), json.RawMessage(`{"path":"f.txt","start_line":2,"end_line":1}`))
+	if err == nil {
+		t.Fatal("expected error for end before start")
+	}
+}
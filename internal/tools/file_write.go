@@ -4,8 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 )
 
 const maxFileWriteSize = 1 << 20 // 1MB
@@ -16,7 +14,8 @@ type fileWriteArgs struct {
 }
 
 // FileWrite returns a ToolFunc that writes files within the project directory.
-// Path traversal is rejected and content larger than 1MB is refused.
+// Path traversal is rejected and content larger than 1MB is refused. When the
+// context carries a Staging overlay the write is staged instead.
 func FileWrite(baseDir string) ToolFunc {
 	return func(ctx context.Context, raw json.RawMessage) (string, error) {
 		var args fileWriteArgs
@@ -40,12 +39,14 @@ func FileWrite(baseDir string) ToolFunc {
 			return "", err
 		}
 
-		parent := filepath.Dir(resolved)
-		if err := os.MkdirAll(parent, 0o755); err != nil {
-			return "", fmt.Errorf("mkdir: %w", err)
+		if s := StagingFromContext(ctx); s != nil {
+			if err := s.Write(resolved, args.Content); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("staged %d bytes to %s for review", len(args.Content), args.Path), nil
 		}
 
-		if err := os.WriteFile(resolved, []byte(args.Content), 0o644); err != nil {
+		if err := writeFile(ctx, resolved, []byte(args.Content), 0o644); err != nil {
 			return "", fmt.Errorf("write: %w", err)
 		}
 		return fmt.Sprintf("wrote %d bytes to %s", len(args.Content), args.Path), nil
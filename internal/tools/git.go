@@ -0,0 +1,268 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gitTimeout     = 30 * time.Second
+	gitOutputCap   = 20 * 1024 // 20KB
+	gitLogDefault  = 20
+	gitLogMaxLimit = 200
+)
+
+// runGit runs git with the given arguments inside dir and returns combined
+// stdout. On failure the error includes git's stderr.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+	}
+	return stdout.String(), nil
+}
+
+// capGitOutput truncates long git output so it fits in a tool result.
+func capGitOutput(out string) string {
+	if len(out) > gitOutputCap {
+		return out[:gitOutputCap] + "\n... output truncated"
+	}
+	return out
+}
+
+// gitDir returns the project directory from ctx, falling back to baseDir.
+func gitDir(ctx context.Context, baseDir string) string {
+	if d := ProjectDirFromContext(ctx); d != "" {
+		return d
+	}
+	return baseDir
+}
+
+// GitStatus returns a ToolFunc that reports the working tree status of the
+// project repository.
+func GitStatus(baseDir string) ToolFunc {
+	return func(ctx context.Context, _ json.RawMessage) (string, error) {
+		out, err := runGit(ctx, gitDir(ctx, baseDir), "status", "--short", "--branch")
+		if err != nil {
+			return "", err
+		}
+		return capGitOutput(out), nil
+	}
+}
+
+type gitDiffArgs struct {
+	Staged bool   `json:"staged"`
+	Ref    string `json:"ref"`
+	Path   string `json:"path"`
+}
+
+// GitDiff returns a ToolFunc that shows unstaged, staged, or ref-relative
+// changes, optionally limited to a single path.
+func GitDiff(baseDir string) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args gitDiffArgs
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", fmt.Errorf("invalid args: %w", err)
+			}
+		}
+		dir := gitDir(ctx, baseDir)
+
+		gitArgs := []string{"diff"}
+		if args.Staged {
+			gitArgs = append(gitArgs, "--cached")
+		}
+		if args.Ref != "" {
+			if strings.HasPrefix(args.Ref, "-") {
+				return "", fmt.Errorf("invalid ref %q", args.Ref)
+			}
+			gitArgs = append(gitArgs, args.Ref)
+		}
+		if args.Path != "" {
+			if _, err := securePath(dir, args.Path); err != nil {
+				return "", err
+			}
+			gitArgs = append(gitArgs, "--", args.Path)
+		}
+
+		out, err := runGit(ctx, dir, gitArgs...)
+		if err != nil {
+			return "", err
+		}
+		if out == "" {
+			return "no changes", nil
+		}
+		return capGitOutput(out), nil
+	}
+}
+
+type gitLogArgs struct {
+	Limit int    `json:"limit"`
+	Path  string `json:"path"`
+}
+
+// GitLog returns a ToolFunc that lists recent commits, newest first.
+func GitLog(baseDir string) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args gitLogArgs
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", fmt.Errorf("invalid args: %w", err)
+			}
+		}
+		if args.Limit <= 0 {
+			args.Limit = gitLogDefault
+		}
+		if args.Limit > gitLogMaxLimit {
+			args.Limit = gitLogMaxLimit
+		}
+		dir := gitDir(ctx, baseDir)
+
+		gitArgs := []string{"log", "-n", strconv.Itoa(args.Limit), "--date=short", "--pretty=format:%h %ad %an: %s"}
+		if args.Path != "" {
+			if _, err := securePath(dir, args.Path); err != nil {
+				return "", err
+			}
+			gitArgs = append(gitArgs, "--", args.Path)
+		}
+
+		out, err := runGit(ctx, dir, gitArgs...)
+		if err != nil {
+			return "", err
+		}
+		if out == "" {
+			return "no commits", nil
+		}
+		return capGitOutput(out), nil
+	}
+}
+
+type gitCommitArgs struct {
+	Message string   `json:"message"`
+	Paths   []string `json:"paths"`
+}
+
+// GitCommit returns a ToolFunc that stages the given paths (or every change
+// when none are given) and commits them with the supplied message. It is
+// refused while changes are staged for review.
+func GitCommit(baseDir string) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		if err := refuseWhileStaging(ctx, "git_commit"); err != nil {
+			return "", err
+		}
+		var args gitCommitArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("invalid args: %w", err)
+		}
+		if strings.TrimSpace(args.Message) == "" {
+			return "", fmt.Errorf("message is required")
+		}
+		dir := gitDir(ctx, baseDir)
+
+		addArgs := []string{"add", "-A", "--"}
+		if len(args.Paths) == 0 {
+			addArgs = append(addArgs, ".")
+		}
+		for _, p := range args.Paths {
+			if _, err := securePath(dir, p); err != nil {
+				return "", err
+			}
+			addArgs = append(addArgs, p)
+		}
+		if _, err := runGit(ctx, dir, addArgs...); err != nil {
+			return "", err
+		}
+
+		staged, err := runGit(ctx, dir, "diff", "--cached", "--name-only")
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(staged) == "" {
+			return "nothing to commit", nil
+		}
+
+		if _, err := runGit(ctx, dir, "commit", "-m", args.Message); err != nil {
+			return "", err
+		}
+		out, err := runGit(ctx, dir, "log", "-1", "--pretty=format:%h %s")
+		if err != nil {
+			return "", err
+		}
+		return "committed " + out, nil
+	}
+}
+
+type gitBranchArgs struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+}
+
+// GitBranch returns a ToolFunc that lists, creates, or switches branches.
+// Switching, which changes the files on disk, is refused while changes are
+// staged for review. Another persona's waynebot/ branches are off limits.
+func GitBranch(baseDir string) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args gitBranchArgs
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", fmt.Errorf("invalid args: %w", err)
+			}
+		}
+		dir := gitDir(ctx, baseDir)
+
+		if args.Action != "" && args.Action != "list" {
+			if args.Name == "" {
+				return "", fmt.Errorf("name is required for %s", args.Action)
+			}
+			if strings.HasPrefix(args.Name, "-") {
+				return "", fmt.Errorf("invalid branch name %q", args.Name)
+			}
+			if err := checkBranchOwner(ctx, args.Name); err != nil {
+				return "", err
+			}
+		}
+
+		switch args.Action {
+		case "", "list":
+			out, err := runGit(ctx, dir, "branch", "--list")
+			if err != nil {
+				return "", err
+			}
+			return capGitOutput(out), nil
+		case "create":
+			if _, err := runGit(ctx, dir, "branch", args.Name); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("created branch %s", args.Name), nil
+		case "switch":
+			if err := refuseWhileStaging(ctx, "git_branch switch"); err != nil {
+				return "", err
+			}
+			if _, err := runGit(ctx, dir, "switch", args.Name); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("switched to branch %s", args.Name), nil
+		default:
+			return "", fmt.Errorf("unknown action %q: must be list, create, or switch", args.Action)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initRepo creates a temp git repository with one commit containing README.md.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+	} {
+		if _, err := runGit(context.Background(), dir, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\n"), 0o644)
+	if _, err := runGit(context.Background(), dir, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(context.Background(), dir, "commit", "-q", "-m", "initial"); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGitStatusShowsChanges(t *testing.T) {
+	dir := initRepo(t)
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("x"), 0o644)
+
+	out, err := GitStatus(dir)(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "main") || !strings.Contains(out, "new.txt") {
+		t.Fatalf("unexpected status: %s", out)
+	}
+}
+
+func TestGitDiffAndCommit(t *testing.T) {
+	dir := initRepo(t)
+	ctx := WithProjectDir(context.Background(), dir)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\nworld\n"), 0o644)
+
+	out, err := GitDiff("/nonexistent")(ctx, json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "+world") {
+		t.Fatalf("diff missing change: %s", out)
+	}
+
+	args, _ := json.Marshal(gitCommitArgs{Message: "add world"})
+	out, err = GitCommit("/nonexistent")(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "add world") {
+		t.Fatalf("unexpected commit result: %s", out)
+	}
+
+	out, err = GitLog(dir)(context.Background(), json.RawMessage(`{"limit":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "add world") || strings.Contains(out, "initial") {
+		t.Fatalf("unexpected log: %s", out)
+	}
+}
+
+func TestGitCommitNothingToCommit(t *testing.T) {
+	dir := initRepo(t)
+
+	out, err := GitCommit(dir)(context.Background(), json.RawMessage(`{"message":"noop"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "nothing to commit" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestGitCommitRequiresMessage(t *testing.T) {
+	dir := initRepo(t)
+
+	_, err := GitCommit(dir)(context.Background(), json.RawMessage(`{}`))
+	if err == nil {
+		t.Fatal("expected error for missing message")
+	}
+}
+
+func TestGitPathTraversalRejected(t *testing.T) {
+	dir := initRepo(t)
+
+	_, err := GitDiff(dir)(context.Background(), json.RawMessage(`{"path":"../../etc/passwd"}`))
+	if err == nil || !strings.Contains(err.Error(), "escape") {
+		t.Fatalf("expected sandbox error, got %v", err)
+	}
+}
+
+func TestGitBranchCreateAndSwitch(t *testing.T) {
+	dir := initRepo(t)
+	fn := GitBranch(dir)
+
+	if _, err := fn(context.Background(), json.RawMessage(`{"action":"create","name":"feature"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fn(context.Background(), json.RawMessage(`{"action":"switch","name":"feature"}`)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := fn(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "* feature") {
+		t.Fatalf("expected feature to be current branch: %s", out)
+	}
+
+	if _, err := fn(context.Background(), json.RawMessage(`{"action":"create","name":"--force"}`)); err == nil {
+		t.Fatal("expected error for option-like branch name")
+	}
+}
+
+func TestGitBranchRefusesOtherPersonasBranches(t *testing.T) {
+	dir := initRepo(t)
+	fn := GitBranch(dir)
+	ctx := WithPersonaID(context.Background(), 7)
+
+	if _, err := fn(ctx, json.RawMessage(`{"action":"create","name":"waynebot/7-coder"}`)); err != nil {
+		t.Fatalf("create own branch: %v", err)
+	}
+	if _, err := fn(WithPersonaID(context.Background(), 8), json.RawMessage(`{"action":"create","name":"waynebot/8-other"}`)); err != nil {
+		t.Fatalf("create other persona's own branch: %v", err)
+	}
+	for _, args := range []string{
+		`{"action":"create","name":"waynebot/8-other-too"}`,
+		`{"action":"switch","name":"waynebot/8-other"}`,
+		`{"action":"switch","name":"refs/heads/waynebot/8-other"}`,
+		`{"action":"create","name":"waynebot/70-coder"}`,
+		`{"action":"create","name":"waynebot/shared"}`,
+	} {
+		if _, err := fn(ctx, json.RawMessage(args)); err == nil || !strings.Contains(err.Error(), "not yours") {
+			t.Errorf("%s: err = %v, want refusal", args, err)
+		}
+	}
+	if _, err := fn(ctx, json.RawMessage(`{"action":"switch","name":"waynebot/7-coder"}`)); err != nil {
+		t.Fatalf("switch to own branch: %v", err)
+	}
+}
+
+func TestPersonaBranch(t *testing.T) {
+	tests := []struct {
+		id   int64
+		name string
+		want string
+	}{
+		{1, "Code Architect", "waynebot/1-code-architect"},
+		{2, "bot_1", "waynebot/2-bot-1"},
+		{3, "!!!", "waynebot/3-persona"},
+	}
+	for _, tt := range tests {
+		got := PersonaBranch(tt.id, tt.name)
+		if got != tt.want {
+			t.Errorf("PersonaBranch(%d, %q) = %q, want %q", tt.id, tt.name, got, tt.want)
+		}
+		if id, ok := PersonaBranchID(got); !ok || id != tt.id {
+			t.Errorf("PersonaBranchID(%q) = %d, %v", got, id, ok)
+		}
+	}
+	if _, ok := PersonaBranchID("main"); ok {
+		t.Error("main parsed as a persona branch")
+	}
+}
+
+func TestWorktreesIsolatePersonas(t *testing.T) {
+	repo := initRepo(t)
+	wt := NewWorktrees(t.TempDir())
+	ctx := context.Background()
+
+	aliceDir, err := wt.Ensure(ctx, 1, repo, 1, "alice")
+	if err != nil {
+		t.Fatalf("ensure alice: %v", err)
+	}
+	bobDir, err := wt.Ensure(ctx, 1, repo, 2, "bob")
+	if err != nil {
+		t.Fatalf("ensure bob: %v", err)
+	}
+	if aliceDir == bobDir {
+		t.Fatal("expected distinct worktrees")
+	}
+
+	// Ensure is idempotent.
+	again, err := wt.Ensure(ctx, 1, repo, 1, "alice")
+	if err != nil || again != aliceDir {
+		t.Fatalf("second ensure = %q, %v", again, err)
+	}
+
+	os.WriteFile(filepath.Join(aliceDir, "README.md"), []byte("alice was here\n"), 0o644)
+	wctx := WithProjectDir(ctx, aliceDir)
+	if _, err := GitCommit(repo)(wctx, json.RawMessage(`{"message":"alice edit"}`)); err != nil {
+		t.Fatalf("commit in worktree: %v", err)
+	}
+
+	bobData, _ := os.ReadFile(filepath.Join(bobDir, "README.md"))
+	if string(bobData) != "hello\n" {
+		t.Fatalf("bob's worktree was modified: %q", bobData)
+	}
+
+	branches, err := ListPersonaBranches(ctx, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 2 {
+		t.Fatalf("got %d branches, want 2", len(branches))
+	}
+	for _, b := range branches {
+		if b.Branch == "waynebot/1-alice" && b.Ahead != 1 {
+			t.Errorf("alice ahead = %d, want 1", b.Ahead)
+		}
+	}
+
+	diff, err := BranchDiff(ctx, repo, "waynebot/1-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+alice was here") {
+		t.Fatalf("unexpected branch diff: %s", diff)
+	}
+
+	if _, err := MergeBranch(ctx, repo, "waynebot/1-alice", ""); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(repo, "README.md"))
+	if string(data) != "alice was here\n" {
+		t.Fatalf("merge did not apply: %q", data)
+	}
+
+	if err := wt.Remove(ctx, 1, repo, 2); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(bobDir); !os.IsNotExist(err) {
+		t.Fatal("expected bob's worktree to be removed")
+	}
+}
+
+func TestWorktreesFollowPersonaIDs(t *testing.T) {
+	repo := initRepo(t)
+	wt := NewWorktrees(t.TempDir())
+	ctx := context.Background()
+
+	// Names that slug alike still get separate worktrees and branches.
+	first, err := wt.Ensure(ctx, 1, repo, 1, "Code Bot")
+	if err != nil {
+		t.Fatalf("ensure first: %v", err)
+	}
+	second, err := wt.Ensure(ctx, 1, repo, 2, "code-bot")
+	if err != nil {
+		t.Fatalf("ensure second: %v", err)
+	}
+	if first == second {
+		t.Fatal("personas with the same slug share a worktree")
+	}
+
+	// A renamed persona keeps its worktree, and its branch follows the name.
+	renamed, err := wt.Ensure(ctx, 1, repo, 1, "Reviewer")
+	if err != nil || renamed != first {
+		t.Fatalf("ensure after rename = %q, %v; want %q", renamed, err, first)
+	}
+	if branch, _ := FindPersonaBranch(ctx, repo, 1); branch != "waynebot/1-reviewer" {
+		t.Errorf("branch after rename = %q", branch)
+	}
+
+	// So does a branch whose worktree was removed.
+	if err := wt.Remove(ctx, 1, repo, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Ensure(ctx, 1, repo, 2, "Tester"); err != nil {
+		t.Fatalf("ensure after remove and rename: %v", err)
+	}
+	branches, _ := ListPersonaBranches(ctx, repo)
+	var names []string
+	for _, b := range branches {
+		names = append(names, fmt.Sprintf("%s=%d", b.Branch, b.PersonaID))
+	}
+	if strings.Join(names, ",") != "waynebot/1-reviewer=1,waynebot/2-tester=2" {
+		t.Errorf("branches = %v", names)
+	}
+}
+
+func TestWorktreesRequireRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	wt := NewWorktrees(t.TempDir())
+	if _, err := wt.Ensure(context.Background(), 1, t.TempDir(), 1, "alice"); err == nil {
+		t.Fatal("expected error for non-repository project")
+	}
+}
@@ -0,0 +1,238 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// personaBranchPrefix is the namespace for branches owned by personas.
+const personaBranchPrefix = "waynebot/"
+
+var branchSlugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// PersonaBranch returns the branch name a persona works on in worktree mode:
+// its ID, so personas whose names slug alike get their own branches, then
+// its name for readability.
+func PersonaBranch(personaID int64, personaName string) string {
+	slug := strings.Trim(branchSlugRe.ReplaceAllString(strings.ToLower(personaName), "-"), "-")
+	if slug == "" {
+		slug = "persona"
+	}
+	return personaBranchPrefix + strconv.FormatInt(personaID, 10) + "-" + slug
+}
+
+// PersonaBranchID returns the ID of the persona a branch belongs to, or false
+// if it isn't a persona branch.
+func PersonaBranchID(branch string) (int64, bool) {
+	rest, ok := strings.CutPrefix(branch, personaBranchPrefix)
+	if !ok {
+		return 0, false
+	}
+	idStr, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	return id, err == nil
+}
+
+// checkBranchOwner refuses a persona branch that isn't the calling persona's
+// own, so one persona can't create or switch to another's waynebot/<id>-*
+// branch.
+func checkBranchOwner(ctx context.Context, name string) error {
+	branch := strings.TrimPrefix(strings.TrimPrefix(name, "refs/"), "heads/")
+	if !strings.HasPrefix(branch, personaBranchPrefix) {
+		return nil
+	}
+	personaID := PersonaIDFromContext(ctx)
+	if id, ok := PersonaBranchID(branch); ok && personaID != 0 && id == personaID {
+		return nil
+	}
+	return fmt.Errorf("branch %q is not yours: %s branches must start with %s%d-", name, personaBranchPrefix, personaBranchPrefix, personaID)
+}
+
+// FindPersonaBranch returns the persona's branch in a repository whatever
+// name the persona had when it was created, or "" if there is none.
+func FindPersonaBranch(ctx context.Context, repoPath string, personaID int64) (string, error) {
+	out, err := runGit(ctx, repoPath, "for-each-ref", "--format=%(refname:short)",
+		"refs/heads/"+personaBranchPrefix+strconv.FormatInt(personaID, 10)+"-*")
+	if err != nil {
+		return "", err
+	}
+	branch, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	return branch, nil
+}
+
+// Worktrees manages one git worktree per (project, persona) so personas can
+// edit the same project without clobbering each other's changes.
+type Worktrees struct {
+	Root string
+
+	mu sync.Mutex
+}
+
+// NewWorktrees creates a Worktrees manager that places worktrees under root.
+func NewWorktrees(root string) *Worktrees {
+	return &Worktrees{Root: root}
+}
+
+// Path returns where the persona's worktree for a project lives.
+func (w *Worktrees) Path(projectID, personaID int64) string {
+	return filepath.Join(w.Root, strconv.FormatInt(projectID, 10), strconv.FormatInt(personaID, 10))
+}
+
+// Ensure returns the persona's worktree directory for a project, creating the
+// worktree and its persona branch from the project's HEAD if needed. A branch
+// made under the persona's old name is renamed to match its current one.
+func (w *Worktrees) Ensure(ctx context.Context, projectID int64, projectPath string, personaID int64, personaName string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	path, err := filepath.Abs(w.Path(projectID, personaID))
+	if err != nil {
+		return "", err
+	}
+	branch := PersonaBranch(personaID, personaName)
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		if _, err := renamePersonaBranch(ctx, projectPath, personaID, branch); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+
+	if _, err := runGit(ctx, projectPath, "rev-parse", "--verify", "HEAD"); err != nil {
+		return "", fmt.Errorf("project is not a git repository with commits: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("create worktree dir: %w", err)
+	}
+
+	exists, err := renamePersonaBranch(ctx, projectPath, personaID, branch)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		_, err = runGit(ctx, projectPath, "worktree", "add", path, branch)
+	} else {
+		_, err = runGit(ctx, projectPath, "worktree", "add", "-b", branch, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// renamePersonaBranch renames the persona's branch to branch if it has
+// another name, reporting whether the persona has a branch at all.
+func renamePersonaBranch(ctx context.Context, repoPath string, personaID int64, branch string) (bool, error) {
+	cur, err := FindPersonaBranch(ctx, repoPath, personaID)
+	if err != nil || cur == "" {
+		return false, err
+	}
+	if cur != branch {
+		if _, err := runGit(ctx, repoPath, "branch", "-m", cur, branch); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Remove deletes the persona's worktree for a project. The branch is kept.
+func (w *Worktrees) Remove(ctx context.Context, projectID int64, projectPath string, personaID int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	path, err := filepath.Abs(w.Path(projectID, personaID))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	_, err = runGit(ctx, projectPath, "worktree", "remove", "--force", path)
+	return err
+}
+
+func branchExists(ctx context.Context, repoPath, branch string) bool {
+	_, err := runGit(ctx, repoPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+// PersonaBranchInfo summarizes a persona branch relative to the project's HEAD.
+type PersonaBranchInfo struct {
+	Branch    string
+	PersonaID int64
+	Commit    string
+	Subject   string
+	Ahead     int
+	Behind    int
+}
+
+// ListPersonaBranches returns every persona branch in the repository.
+func ListPersonaBranches(ctx context.Context, repoPath string) ([]PersonaBranchInfo, error) {
+	out, err := runGit(ctx, repoPath, "for-each-ref",
+		"--format=%(refname:short)%09%(objectname:short)%09%(contents:subject)",
+		"refs/heads/"+personaBranchPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []PersonaBranchInfo
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 3)
+		info := PersonaBranchInfo{Branch: parts[0]}
+		info.PersonaID, _ = PersonaBranchID(info.Branch)
+		if len(parts) > 1 {
+			info.Commit = parts[1]
+		}
+		if len(parts) > 2 {
+			info.Subject = parts[2]
+		}
+		counts, err := runGit(ctx, repoPath, "rev-list", "--left-right", "--count", "HEAD..."+info.Branch)
+		if err == nil {
+			fmt.Sscanf(strings.TrimSpace(counts), "%d %d", &info.Behind, &info.Ahead)
+		}
+		branches = append(branches, info)
+	}
+	return branches, nil
+}
+
+// BranchDiff returns the changes a branch introduces since it diverged from HEAD.
+func BranchDiff(ctx context.Context, repoPath, branch string) (string, error) {
+	if !branchExists(ctx, repoPath, branch) {
+		return "", fmt.Errorf("branch %q not found", branch)
+	}
+	return runGit(ctx, repoPath, "diff", "HEAD..."+branch)
+}
+
+// MergeBranch merges branch into the repository's checked-out branch. A
+// conflicting merge is aborted and reported as an error, leaving the working
+// tree untouched.
+func MergeBranch(ctx context.Context, repoPath, branch, message string) (string, error) {
+	if !branchExists(ctx, repoPath, branch) {
+		return "", fmt.Errorf("branch %q not found", branch)
+	}
+	if message == "" {
+		message = "Merge " + branch
+	}
+	if _, err := runGit(ctx, repoPath, "merge", "--no-ff", "-m", message, branch); err != nil {
+		runGit(ctx, repoPath, "merge", "--abort")
+		return "", err
+	}
+	return HeadCommit(ctx, repoPath)
+}
+
+// HeadCommit returns the short hash of the repository's HEAD.
+func HeadCommit(ctx context.Context, repoPath string) (string, error) {
+	out, err := runGit(ctx, repoPath, "rev-parse", "--short", "HEAD")
+	return strings.TrimSpace(out), err
+}
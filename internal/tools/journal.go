@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const journalKey contextKey = "journal"
+
+// FileChange describes one write an agent made to a file.
+type FileChange struct {
+	Path    string // absolute
+	Existed bool   // whether the file existed before the write
+	Removed bool   // whether the write deleted the file
+	Before  string
+	After   string
+}
+
+// JournalFunc records a file change after it has been written.
+type JournalFunc func(FileChange)
+
+// WithJournal returns a context whose file writes are recorded by fn.
+func WithJournal(ctx context.Context, fn JournalFunc) context.Context {
+	return context.WithValue(ctx, journalKey, fn)
+}
+
+// JournalFromContext retrieves the journal from a context, or nil if writes
+// are not journaled.
+func JournalFromContext(ctx context.Context) JournalFunc {
+	fn, _ := ctx.Value(journalKey).(JournalFunc)
+	return fn
+}
+
+// writeFile writes data to path on behalf of an agent and records the change
+// in the journal carried by ctx, creating parent directories. An existing
+// file keeps its permissions; a new file is created with perm. When ctx
+// carries a Staging overlay the write is staged instead.
+func writeFile(ctx context.Context, path string, data []byte, perm os.FileMode) error {
+	if s := StagingFromContext(ctx); s != nil {
+		return s.Write(path, string(data))
+	}
+
+	change := FileChange{Path: path, After: string(data)}
+	before, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		change.Existed = true
+		change.Before = string(before)
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	if j := JournalFromContext(ctx); j != nil {
+		j(change)
+	}
+	return nil
+}
+
+// removeFile deletes path on behalf of an agent and records the removal in
+// the journal carried by ctx, so it can be reverted. A missing file is left
+// alone.
+func removeFile(ctx context.Context, path string) error {
+	before, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if j := JournalFromContext(ctx); j != nil {
+		j(FileChange{Path: path, Existed: true, Removed: true, Before: string(before)})
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalRecordsWrites(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o600)
+
+	var changes []FileChange
+	ctx := WithJournal(WithProjectDir(context.Background(), dir), func(c FileChange) {
+		changes = append(changes, c)
+	})
+
+	if _, err := FileEdit("")(ctx, json.RawMessage(`{"path":"a.txt","old_string":"one","new_string":"two"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FileWrite("")(ctx, json.RawMessage(`{"path":"b.txt","content":"new"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProjectDocs("")(ctx, json.RawMessage(`{"action":"append","doc_type":"decisions","filename":"log","content":"chose x"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 3 {
+		t.Fatalf("got %d journal entries, want 3", len(changes))
+	}
+	if c := changes[0]; c.Path != filepath.Join(dir, "a.txt") || !c.Existed || c.Before != "one\n" || c.After != "two\n" {
+		t.Errorf("unexpected edit entry: %+v", c)
+	}
+	if c := changes[1]; c.Existed || c.Before != "" || c.After != "new" {
+		t.Errorf("unexpected write entry: %+v", c)
+	}
+	if c := changes[2]; c.Existed || c.After == "" {
+		t.Errorf("unexpected append entry: %+v", c)
+	}
+
+	info, _ := os.Stat(filepath.Join(dir, "a.txt"))
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("edit changed permissions to %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,393 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// memoryVisibility returns who is calling a memory tool.
+func memoryVisibility(ctx context.Context) model.MemoryVisibility {
+	return model.MemoryVisibility{
+		PersonaID: PersonaIDFromContext(ctx),
+		ProjectID: ProjectIDFromContext(ctx),
+		ChannelID: ChannelIDFromContext(ctx),
+	}
+}
+
+// lookupMemory loads a memory the caller is allowed to see.
+func lookupMemory(ctx context.Context, store *memory.Store, id int64) (model.Memory, error) {
+	if id == 0 {
+		return model.Memory{}, fmt.Errorf("id is required")
+	}
+	m, err := model.GetMemory(store.DB, id)
+	if err == sql.ErrNoRows || (err == nil && !m.VisibleTo(memoryVisibility(ctx))) {
+		return model.Memory{}, fmt.Errorf("memory #%d not found", id)
+	}
+	return m, err
+}
+
+// expiryFromTTL converts a ttl_days argument to an expiry time. Zero means
+// the memory never expires.
+func expiryFromTTL(days int) (*time.Time, error) {
+	if days < 0 {
+		return nil, fmt.Errorf("ttl_days must not be negative")
+	}
+	if days == 0 {
+		return nil, nil
+	}
+	t := time.Now().UTC().AddDate(0, 0, days)
+	return &t, nil
+}
+
+type memorySaveArgs struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Scope   string `json:"scope"`
+	TTLDays int    `json:"ttl_days"`
+}
+
+// MemorySave returns a ToolFunc that saves a memory to the memory store.
+// Project-scoped memories are also written to a markdown file in the
+// project's ./memories/ directory, unless changes are staged for review. A
+// memory that restates an existing one in the same scope updates it instead
+// of adding a duplicate.
+func MemorySave(store *memory.Store) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args memorySaveArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		if strings.TrimSpace(args.Title) == "" {
+			return "", fmt.Errorf("title is required")
+		}
+		if strings.TrimSpace(args.Content) == "" {
+			return "", fmt.Errorf("content is required")
+		}
+		expires, err := expiryFromTTL(args.TTLDays)
+		if err != nil {
+			return "", err
+		}
+
+		v := memoryVisibility(ctx)
+		m := model.Memory{
+			PersonaID: v.PersonaID,
+			ProjectID: v.ProjectID,
+			ChannelID: v.ChannelID,
+			Scope:     args.Scope,
+			Title:     args.Title,
+			Content:   args.Content,
+			ExpiresAt: expires,
+		}
+		if m.Scope == "" {
+			m.Scope = model.MemoryScopePersona
+			if v.ProjectID != 0 {
+				m.Scope = model.MemoryScopeProject
+			}
+		}
+		switch {
+		case m.Scope == model.MemoryScopeProject && v.ProjectID == 0:
+			return "", fmt.Errorf("scope project requires a channel with a project")
+		case m.Scope == model.MemoryScopeChannel && v.ChannelID == 0:
+			return "", fmt.Errorf("scope channel requires a channel")
+		case m.Scope == model.MemoryScopePersona && v.PersonaID == 0:
+			return "", fmt.Errorf("persona_id not set in context")
+		case m.Scope != model.MemoryScopeProject && m.Scope != model.MemoryScopeChannel && m.Scope != model.MemoryScopePersona:
+			return "", fmt.Errorf("invalid scope %q (want persona, project or channel)", m.Scope)
+		}
+
+		dup, found, err := store.FindDuplicate(ctx, m)
+		if err != nil {
+			return "", fmt.Errorf("check duplicates: %w", err)
+		}
+		if found && dup.SourcePath != "" && dup.SourceDir != filepath.Clean(ProjectDirFromContext(ctx)) {
+			// The near-duplicate is a file in another directory of the
+			// project, such as another persona's worktree; leave it be.
+			found = false
+		}
+		if found {
+			dup.Title, dup.Content, dup.ExpiresAt = m.Title, m.Content, m.ExpiresAt
+			if err := writeMemoryFile(ctx, dup); err != nil {
+				return "", err
+			}
+			if _, err := store.Update(ctx, dup); err != nil {
+				return "", fmt.Errorf("update memory: %w", err)
+			}
+			return fmt.Sprintf("Updated existing memory #%d (%s), which said nearly the same thing", dup.ID, dup.Title), nil
+		}
+
+		projectDir := ProjectDirFromContext(ctx)
+		if m.Scope == model.MemoryScopeProject && projectDir != "" && StagingFromContext(ctx) == nil {
+			title := strings.NewReplacer("/", "-", `\`, "-").Replace(args.Title)
+			m.SourcePath = fmt.Sprintf("%s/%s-%s.md", memory.Dir, time.Now().Format("2006-01-02-15-04"), title)
+			m.SourceDir = filepath.Clean(projectDir)
+			if err := writeMemoryFile(ctx, m); err != nil {
+				return "", err
+			}
+		}
+
+		saved, err := store.Save(ctx, m)
+		if err != nil {
+			return "", fmt.Errorf("save memory: %w", err)
+		}
+		if saved.SourcePath != "" {
+			return fmt.Sprintf("Memory #%d saved to %s", saved.ID, saved.SourcePath), nil
+		}
+		return fmt.Sprintf("Memory #%d saved (%s scope)", saved.ID, saved.Scope), nil
+	}
+}
+
+// writeMemoryFile writes a file-backed memory's content to its markdown
+// file. Memories without a SourcePath are left alone.
+func writeMemoryFile(ctx context.Context, m model.Memory) error {
+	if m.SourcePath == "" {
+		return nil
+	}
+	if err := refuseMemoryFileWhileStaging(ctx); err != nil {
+		return err
+	}
+	projectDir, err := memoryFileDir(ctx, m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(projectDir, filepath.FromSlash(m.SourcePath))
+	if err := writeFile(ctx, path, []byte(m.Content), 0644); err != nil {
+		return fmt.Errorf("write memory file: %w", err)
+	}
+	return nil
+}
+
+// memoryFileDir returns the caller's project directory for changing a
+// file-backed memory, refusing memories whose file is in another of the
+// project's directories, such as another persona's worktree.
+func memoryFileDir(ctx context.Context, m model.Memory) (string, error) {
+	projectDir := ProjectDirFromContext(ctx)
+	if projectDir == "" {
+		return "", fmt.Errorf("memory #%d is stored in %s but no project directory is available", m.ID, m.SourcePath)
+	}
+	projectDir = filepath.Clean(projectDir)
+	if m.SourceDir != "" && m.SourceDir != projectDir {
+		return "", fmt.Errorf("memory #%d is stored in %s under %s, not in this project directory", m.ID, m.SourcePath, m.SourceDir)
+	}
+	return projectDir, nil
+}
+
+type memorySearchArgs struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+// refuseMemoryFileWhileStaging refuses changes to project memory files
+// while changes are staged for review: the memory would be indexed from a
+// file that is not on disk yet.
+func refuseMemoryFileWhileStaging(ctx context.Context) error {
+	if StagingFromContext(ctx) != nil {
+		return fmt.Errorf("project memories are files in the project and cannot be changed while file changes are staged for review; save it with scope persona or channel instead")
+	}
+	return nil
+}
+
+// MemorySearch returns a ToolFunc that ranks the memories visible to the
+// caller against a query by keyword and semantic similarity. Within a
+// project, the project's memories/*.md files are indexed first so
+// hand-written notes are found too.
+func MemorySearch(store *memory.Store) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args memorySearchArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		if strings.TrimSpace(args.Query) == "" {
+			return "", fmt.Errorf("query is required")
+		}
+		if args.Limit <= 0 {
+			args.Limit = 5
+		}
+		if args.Limit > 20 {
+			args.Limit = 20
+		}
+
+		v := memoryVisibility(ctx)
+		if projectDir := ProjectDirFromContext(ctx); v.ProjectID != 0 && projectDir != "" {
+			if err := store.IndexDir(ctx, v.ProjectID, projectDir); err != nil {
+				return "", fmt.Errorf("index memories: %w", err)
+			}
+		}
+
+		results, err := store.Search(ctx, args.Query, model.MemoryFilter{VisibleTo: &v}, args.Limit)
+		if err != nil {
+			return "", fmt.Errorf("search memories: %w", err)
+		}
+		if len(results) == 0 {
+			return "No matching memories found.", nil
+		}
+
+		var b strings.Builder
+		for i, r := range results {
+			if i > 0 {
+				b.WriteString("\n\n")
+			}
+			fmt.Fprintf(&b, "#%d [%s] %s", r.Memory.ID, r.Memory.Scope, r.Memory.Title)
+			if r.Memory.SourcePath != "" {
+				fmt.Fprintf(&b, " (%s)", r.Memory.SourcePath)
+			}
+			fmt.Fprintf(&b, " score=%.2f\n", r.Score)
+			content := strings.TrimSpace(r.Memory.Content)
+			if len(content) > 1000 {
+				content = content[:1000] + "..."
+			}
+			b.WriteString(content)
+		}
+
+		result := b.String()
+		if len(result) > 4000 {
+			result = result[:4000] + "\n... (truncated)"
+		}
+		return result, nil
+	}
+}
+
+type memoryListArgs struct {
+	Scope string `json:"scope"`
+	Limit int    `json:"limit"`
+}
+
+// MemoryList returns a ToolFunc that lists the memories visible to the
+// caller, oldest first, optionally restricted to one scope.
+func MemoryList(store *memory.Store) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args memoryListArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		if args.Limit <= 0 {
+			args.Limit = 50
+		}
+		if args.Limit > 200 {
+			args.Limit = 200
+		}
+
+		v := memoryVisibility(ctx)
+		if projectDir := ProjectDirFromContext(ctx); v.ProjectID != 0 && projectDir != "" {
+			if err := store.IndexDir(ctx, v.ProjectID, projectDir); err != nil {
+				return "", fmt.Errorf("index memories: %w", err)
+			}
+		}
+
+		memories, err := model.ListMemories(store.DB, model.MemoryFilter{VisibleTo: &v, Scope: args.Scope, Limit: args.Limit})
+		if err != nil {
+			return "", fmt.Errorf("list memories: %w", err)
+		}
+		if len(memories) == 0 {
+			return "No memories saved yet.", nil
+		}
+
+		var b strings.Builder
+		for _, m := range memories {
+			summary, _, _ := strings.Cut(strings.TrimSpace(m.Content), "\n")
+			if len(summary) > 120 {
+				summary = summary[:120] + "..."
+			}
+			fmt.Fprintf(&b, "#%d [%s] %s: %s", m.ID, m.Scope, m.Title, summary)
+			if m.ExpiresAt != nil {
+				fmt.Fprintf(&b, " (expires %s)", m.ExpiresAt.Format("2006-01-02"))
+			}
+			b.WriteString("\n")
+		}
+		return strings.TrimRight(b.String(), "\n"), nil
+	}
+}
+
+type memoryUpdateArgs struct {
+	ID      int64   `json:"id"`
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+	TTLDays *int    `json:"ttl_days"`
+}
+
+// MemoryUpdate returns a ToolFunc that edits a memory visible to the caller.
+// Omitted fields are left unchanged; ttl_days 0 removes the expiry.
+func MemoryUpdate(store *memory.Store) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args memoryUpdateArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		m, err := lookupMemory(ctx, store, args.ID)
+		if err != nil {
+			return "", err
+		}
+
+		if args.Title != nil {
+			if strings.TrimSpace(*args.Title) == "" {
+				return "", fmt.Errorf("title must not be empty")
+			}
+			m.Title = *args.Title
+		}
+		if args.Content != nil {
+			if strings.TrimSpace(*args.Content) == "" {
+				return "", fmt.Errorf("content must not be empty; use memory_forget to delete a memory")
+			}
+			m.Content = *args.Content
+		}
+		if args.TTLDays != nil {
+			if m.ExpiresAt, err = expiryFromTTL(*args.TTLDays); err != nil {
+				return "", err
+			}
+		}
+
+		if err := writeMemoryFile(ctx, m); err != nil {
+			return "", err
+		}
+		if _, err := store.Update(ctx, m); err != nil {
+			return "", fmt.Errorf("update memory: %w", err)
+		}
+		return fmt.Sprintf("Memory #%d updated", m.ID), nil
+	}
+}
+
+type memoryForgetArgs struct {
+	ID int64 `json:"id"`
+}
+
+// MemoryForget returns a ToolFunc that deletes a memory visible to the
+// caller, including its markdown file if it has one. The file's removal is
+// journaled like any other agent write, so it can be reverted.
+func MemoryForget(store *memory.Store) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args memoryForgetArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		m, err := lookupMemory(ctx, store, args.ID)
+		if err != nil {
+			return "", err
+		}
+
+		if m.SourcePath != "" {
+			if err := refuseMemoryFileWhileStaging(ctx); err != nil {
+				return "", err
+			}
+			// Without its file removed, the memory would be indexed again.
+			projectDir, err := memoryFileDir(ctx, m)
+			if err != nil {
+				return "", err
+			}
+			path := filepath.Join(projectDir, filepath.FromSlash(m.SourcePath))
+			if err := removeFile(ctx, path); err != nil {
+				return "", fmt.Errorf("remove memory file: %w", err)
+			}
+		}
+		if err := model.DeleteMemory(store.DB, m.ID); err != nil {
+			return "", fmt.Errorf("delete memory: %w", err)
+		}
+		return fmt.Sprintf("Memory #%d (%s) forgotten", m.ID, m.Title), nil
+	}
+}
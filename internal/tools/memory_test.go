@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/memory"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestMemorySaveAndSearch(t *testing.T) {
+	d, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	store := memory.NewStore(d, memory.NewHashEmbedder())
+
+	dir := t.TempDir()
+	p, err := model.CreateProject(d, "proj", dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithProjectID(WithProjectDir(context.Background(), dir), p.ID)
+
+	out, err := MemorySave(store)(ctx, json.RawMessage(`{"title":"release-process","content":"Releases are cut from main every Friday."}`))
+	if err != nil {
+		t.Fatalf("memory_save: %v", err)
+	}
+	if !strings.Contains(out, "memories/") {
+		t.Errorf("unexpected save output: %s", out)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "memories", "*-release-process.md"))
+	if len(files) != 1 {
+		t.Fatalf("expected one memory file, got %v", files)
+	}
+
+	// A hand-written note is picked up by search without being saved.
+	os.WriteFile(filepath.Join(dir, "memories", "oncall.md"), []byte("Bob is on call this week."), 0o644)
+
+	out, err = MemorySearch(store)(ctx, json.RawMessage(`{"query":"when do we cut a release"}`))
+	if err != nil {
+		t.Fatalf("memory_search: %v", err)
+	}
+	if !strings.Contains(out, "Releases are cut from main") {
+		t.Errorf("expected saved memory in results: %s", out)
+	}
+
+	out, _ = MemorySearch(store)(ctx, json.RawMessage(`{"query":"who is on call"}`))
+	if !strings.Contains(out, "Bob is on call") {
+		t.Errorf("expected indexed file in results: %s", out)
+	}
+
+	list, _ := model.ListMemories(d, model.MemoryFilter{ProjectID: p.ID})
+	if len(list) != 2 {
+		t.Errorf("expected 2 memories (no duplicate for the saved file), got %d", len(list))
+	}
+}
+
+func TestMemoryLifecycleTools(t *testing.T) {
+	d, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	store := memory.NewStore(d, memory.NewHashEmbedder())
+
+	alice, _ := model.CreatePersona(d, "alice", "", "m", nil, 0.7, 100, 0, 0)
+	bob, _ := model.CreatePersona(d, "bob", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "dev", "", 0)
+	dir := t.TempDir()
+	p, _ := model.CreateProject(d, "proj", dir, "")
+
+	aliceCtx := WithChannelID(WithProjectID(WithProjectDir(WithPersonaID(context.Background(), alice.ID), dir), p.ID), ch.ID)
+	bobCtx := WithChannelID(WithPersonaID(context.Background(), bob.ID), ch.ID)
+
+	if _, err := MemorySave(store)(aliceCtx, json.RawMessage(`{"title":"private-note","content":"Alice's scratch notes about the parser rewrite.","scope":"persona"}`)); err != nil {
+		t.Fatalf("save persona memory: %v", err)
+	}
+	if _, err := MemorySave(store)(aliceCtx, json.RawMessage(`{"title":"standup","content":"Standup is at 9:30 in this channel.","scope":"channel"}`)); err != nil {
+		t.Fatalf("save channel memory: %v", err)
+	}
+	out, err := MemorySave(store)(aliceCtx, json.RawMessage(`{"title":"build","content":"Run make build before pushing."}`))
+	if err != nil || !strings.Contains(out, "memories/") {
+		t.Fatalf("save project memory: %q, %v", out, err)
+	}
+
+	// Saving the same fact again updates the existing memory.
+	out, err = MemorySave(store)(aliceCtx, json.RawMessage(`{"title":"build","content":"Run make build before pushing!"}`))
+	if err != nil || !strings.Contains(out, "Updated existing memory") {
+		t.Fatalf("duplicate save: %q, %v", out, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "memories", "*.md")); len(files) != 1 {
+		t.Errorf("expected one memory file after duplicate save, got %v", files)
+	}
+
+	out, _ = MemoryList(store)(aliceCtx, json.RawMessage(`{}`))
+	if !strings.Contains(out, "private-note") || !strings.Contains(out, "standup") || !strings.Contains(out, "build") {
+		t.Errorf("alice's list missing memories:\n%s", out)
+	}
+	out, _ = MemoryList(store)(bobCtx, json.RawMessage(`{}`))
+	if strings.Contains(out, "private-note") || strings.Contains(out, "build") || !strings.Contains(out, "standup") {
+		t.Errorf("bob should only see the channel memory:\n%s", out)
+	}
+
+	private, _ := model.ListMemories(d, model.MemoryFilter{Scope: model.MemoryScopePersona})
+	id := private[0].ID
+	if _, err := MemoryForget(store)(bobCtx, json.RawMessage(fmt.Sprintf(`{"id":%d}`, id))); err == nil {
+		t.Error("bob forgot alice's private memory")
+	}
+
+	if _, err := MemoryUpdate(store)(aliceCtx, json.RawMessage(fmt.Sprintf(`{"id":%d,"content":"Parser rewrite is done.","ttl_days":7}`, id))); err != nil {
+		t.Fatalf("memory_update: %v", err)
+	}
+	got, _ := model.GetMemory(d, id)
+	if got.Content != "Parser rewrite is done." || got.ExpiresAt == nil {
+		t.Errorf("unexpected memory after update: %+v", got)
+	}
+
+	project, _ := model.ListMemories(d, model.MemoryFilter{Scope: model.MemoryScopeProject})
+	forget := json.RawMessage(fmt.Sprintf(`{"id":%d}`, project[0].ID))
+	noDir := WithChannelID(WithProjectID(WithPersonaID(context.Background(), alice.ID), p.ID), ch.ID)
+	if _, err := MemoryForget(store)(noDir, forget); err == nil {
+		t.Error("forgot a file-backed memory without a project directory to remove its file from")
+	}
+
+	var journaled []FileChange
+	journalCtx := WithJournal(aliceCtx, func(c FileChange) { journaled = append(journaled, c) })
+	if _, err := MemoryForget(store)(journalCtx, forget); err != nil {
+		t.Fatalf("memory_forget: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "memories", "*.md")); len(files) != 0 {
+		t.Errorf("expected memory file removed, got %v", files)
+	}
+	if len(journaled) != 1 || !journaled[0].Removed || !strings.HasPrefix(journaled[0].Before, "Run make build") {
+		t.Errorf("journaled = %+v, want the file's removal", journaled)
+	}
+}
+
+func TestMemoryFilesUntouchedWhileStaging(t *testing.T) {
+	d, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	store := memory.NewStore(d, memory.NewHashEmbedder())
+	dir := t.TempDir()
+	p, _ := model.CreateProject(d, "proj", dir, "")
+	ctx := WithProjectID(WithProjectDir(context.Background(), dir), p.ID)
+
+	out, err := MemorySave(store)(ctx, json.RawMessage(`{"title":"oncall","content":"Bob is on call this week."}`))
+	if err != nil {
+		t.Fatalf("memory_save: %v", err)
+	}
+	var id int64
+	fmt.Sscanf(out, "Memory #%d", &id)
+
+	staged := WithStaging(ctx, NewStaging(dir))
+	out, err = MemorySave(store)(staged, json.RawMessage(`{"title":"release","content":"Releases are cut on Fridays."}`))
+	if err != nil || strings.Contains(out, "memories/") {
+		t.Fatalf("memory_save while staging = %q, %v", out, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "memories", "*.md")); len(files) != 1 {
+		t.Errorf("memory files = %v, want only the first", files)
+	}
+	for name, fn := range map[string]ToolFunc{"memory_update": MemoryUpdate(store), "memory_forget": MemoryForget(store)} {
+		args := fmt.Sprintf(`{"id":%d,"content":"Alice is on call."}`, id)
+		if _, err := fn(staged, json.RawMessage(args)); err == nil || !strings.Contains(err.Error(), "staged for review") {
+			t.Errorf("%s of a file-backed memory while staging: %v", name, err)
+		}
+	}
+}
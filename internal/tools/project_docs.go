@@ -41,11 +41,11 @@ func ProjectDocs(baseDir string) ToolFunc {
 		case "list":
 			return projectDocsList(dir, args.DocType)
 		case "read":
-			return projectDocsRead(dir, args.DocType, args.Filename)
+			return projectDocsRead(ctx, dir, args.DocType, args.Filename)
 		case "write":
-			return projectDocsWrite(dir, args.DocType, args.Filename, args.Content)
+			return projectDocsWrite(ctx, dir, args.DocType, args.Filename, args.Content)
 		case "append":
-			return projectDocsAppend(dir, args.DocType, args.Filename, args.Content)
+			return projectDocsAppend(ctx, dir, args.DocType, args.Filename, args.Content)
 		default:
 			return "", fmt.Errorf("unknown action %q: must be list, read, write, or append", args.Action)
 		}
@@ -113,14 +113,14 @@ func projectDocsList(baseDir, docType string) (string, error) {
 	return fmt.Sprintf("%s: %s", docType, strings.Join(files, ", ")), nil
 }
 
-func projectDocsRead(baseDir, docType, filename string) (string, error) {
+func projectDocsRead(ctx context.Context, baseDir, docType, filename string) (string, error) {
 	if !knownDocTypes[docType] {
 		return "", fmt.Errorf("unknown doc_type %q: must be erd, prd, or decisions", docType)
 	}
 	if filename == "" {
 		return "", fmt.Errorf("filename is required for read")
 	}
-	data, err := os.ReadFile(docFilePath(baseDir, docType, filename))
+	data, err := readFile(ctx, docFilePath(baseDir, docType, filename))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return "", fmt.Errorf("document %s/%s does not exist", docType, filename)
@@ -130,7 +130,7 @@ func projectDocsRead(baseDir, docType, filename string) (string, error) {
 	return string(data), nil
 }
 
-func projectDocsWrite(baseDir, docType, filename, content string) (string, error) {
+func projectDocsWrite(ctx context.Context, baseDir, docType, filename, content string) (string, error) {
 	if !knownDocTypes[docType] {
 		return "", fmt.Errorf("unknown doc_type %q: must be erd, prd, or decisions", docType)
 	}
@@ -138,19 +138,14 @@ func projectDocsWrite(baseDir, docType, filename, content string) (string, error
 		return "", fmt.Errorf("filename is required for write")
 	}
 
-	dir := docTypeDir(baseDir, docType)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", fmt.Errorf("mkdir: %w", err)
-	}
-
 	fp := docFilePath(baseDir, docType, filename)
-	if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+	if err := writeFile(ctx, fp, []byte(content), 0o644); err != nil {
 		return "", fmt.Errorf("write: %w", err)
 	}
 	return fmt.Sprintf("wrote %d bytes to %s/%s", len(content), docType, filepath.Base(fp)), nil
 }
 
-func projectDocsAppend(baseDir, docType, filename, content string) (string, error) {
+func projectDocsAppend(ctx context.Context, baseDir, docType, filename, content string) (string, error) {
 	if !knownDocTypes[docType] {
 		return "", fmt.Errorf("unknown doc_type %q: must be erd, prd, or decisions", docType)
 	}
@@ -161,21 +156,14 @@ func projectDocsAppend(baseDir, docType, filename, content string) (string, erro
 		return "", fmt.Errorf("content is required for append")
 	}
 
-	dir := docTypeDir(baseDir, docType)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", fmt.Errorf("mkdir: %w", err)
-	}
-
 	entry := fmt.Sprintf("\n## %s\n\n%s\n", time.Now().UTC().Format(time.RFC3339), content)
 
 	fp := docFilePath(baseDir, docType, filename)
-	f, err := os.OpenFile(fp, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return "", fmt.Errorf("open: %w", err)
+	existing, err := readFile(ctx, fp)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("read: %w", err)
 	}
-	defer f.Close()
-
-	if _, err := f.WriteString(entry); err != nil {
+	if err := writeFile(ctx, fp, append(existing, entry...), 0o644); err != nil {
 		return "", fmt.Errorf("append: %w", err)
 	}
 	return fmt.Sprintf("appended entry to %s/%s", docType, filepath.Base(fp)), nil
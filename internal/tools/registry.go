@@ -49,8 +49,16 @@ func (r *Registry) RegisterDefaults(baseDir string) {
 	r.Register("shell_exec", ShellExec(baseDir))
 	r.Register("file_read", FileRead(baseDir))
 	r.Register("file_write", FileWrite(baseDir))
+	r.Register("file_edit", FileEdit(baseDir))
+	r.Register("file_list", FileList(baseDir))
+	r.Register("file_grep", FileGrep(baseDir))
 	r.Register("http_fetch", HTTPFetch())
 	r.Register("project_docs", ProjectDocs(baseDir))
+	r.Register("git_status", GitStatus(baseDir))
+	r.Register("git_diff", GitDiff(baseDir))
+	r.Register("git_log", GitLog(baseDir))
+	r.Register("git_commit", GitCommit(baseDir))
+	r.Register("git_branch", GitBranch(baseDir))
 }
 
 // Names returns the sorted list of registered tool names.
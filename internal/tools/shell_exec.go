@@ -21,8 +21,12 @@ type shellExecArgs struct {
 
 // ShellExec returns a ToolFunc that executes shell commands within the project
 // directory. Any command may be run; only timeout and output cap are enforced.
+// It is refused while changes are staged for review.
 func ShellExec(baseDir string) ToolFunc {
 	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		if err := refuseWhileStaging(ctx, "shell_exec"); err != nil {
+			return "", err
+		}
 		var args shellExecArgs
 		if err := json.Unmarshal(raw, &args); err != nil {
 			return "", fmt.Errorf("invalid args: %w", err)
@@ -0,0 +1,164 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const stagingKey contextKey = "staging"
+
+// Staging is a per-run overlay that holds file writes in memory instead of
+// applying them to the project directory. File tools read through it, so a
+// run sees its own staged edits layered over the real files.
+type Staging struct {
+	// Dir is the project directory the overlay sits on top of.
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]*StagedFile
+}
+
+// StagedFile is one file changed within a staging overlay. Base is the file's
+// content on disk when it was first staged, so the change can later be
+// applied as a diff and checked for conflicts.
+type StagedFile struct {
+	Path    string // slash-separated, relative to Staging.Dir
+	Base    string
+	Existed bool
+	Content string
+}
+
+// NewStaging creates an empty overlay on top of dir.
+func NewStaging(dir string) *Staging {
+	return &Staging{Dir: dir, files: make(map[string]*StagedFile)}
+}
+
+// WithStaging returns a context carrying the given staging overlay.
+func WithStaging(ctx context.Context, s *Staging) context.Context {
+	return context.WithValue(ctx, stagingKey, s)
+}
+
+// StagingFromContext retrieves the staging overlay from a context, or nil if
+// changes are written directly to disk.
+func StagingFromContext(ctx context.Context) *Staging {
+	s, _ := ctx.Value(stagingKey).(*Staging)
+	return s
+}
+
+// rel converts an absolute path inside the overlay's directory to the key
+// used for staged files.
+func (s *Staging) rel(abs string) (string, error) {
+	rel, err := filepath.Rel(s.Dir, abs)
+	if err != nil {
+		return "", fmt.Errorf("path not allowed: %w", err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Read returns the staged content for the file at abs, if any.
+func (s *Staging) Read(abs string) (string, bool) {
+	rel, err := s.rel(abs)
+	if err != nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[rel]
+	if !ok {
+		return "", false
+	}
+	return f.Content, true
+}
+
+// Write stages content for the file at abs, snapshotting the file's current
+// content on disk the first time it is staged.
+func (s *Staging) Write(abs, content string) error {
+	rel, err := s.rel(abs)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[rel]; ok {
+		f.Content = content
+		return nil
+	}
+
+	f := &StagedFile{Path: rel, Content: content}
+	data, err := os.ReadFile(abs)
+	switch {
+	case err == nil:
+		f.Base = string(data)
+		f.Existed = true
+	case !os.IsNotExist(err):
+		return fmt.Errorf("read: %w", err)
+	}
+	s.files[rel] = f
+	return nil
+}
+
+// Files returns the staged files that differ from their base, sorted by path.
+func (s *Staging) Files() []StagedFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]StagedFile, 0, len(s.files))
+	for _, f := range s.files {
+		if f.Existed && f.Content == f.Base {
+			continue
+		}
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// refuseWhileStaging returns an error when ctx stages changes for review,
+// for tools whose changes to the project could not be reviewed.
+func refuseWhileStaging(ctx context.Context, tool string) error {
+	if StagingFromContext(ctx) != nil {
+		return fmt.Errorf("%s is not available while file changes are staged for review", tool)
+	}
+	return nil
+}
+
+// readFile reads the file at abs, preferring content staged in ctx.
+func readFile(ctx context.Context, abs string) ([]byte, error) {
+	if s := StagingFromContext(ctx); s != nil {
+		if content, ok := s.Read(abs); ok {
+			return []byte(content), nil
+		}
+	}
+	return os.ReadFile(abs)
+}
+
+// openFile opens the file at abs for reading, preferring content staged in
+// ctx.
+func openFile(ctx context.Context, abs string) (io.ReadCloser, error) {
+	if s := StagingFromContext(ctx); s != nil {
+		if content, ok := s.Read(abs); ok {
+			return io.NopCloser(strings.NewReader(content)), nil
+		}
+	}
+	return os.Open(abs)
+}
+
+// statFile returns the size of the file at abs and whether it is a
+// directory, taking staged content in ctx into account.
+func statFile(ctx context.Context, abs string) (size int64, isDir bool, err error) {
+	if s := StagingFromContext(ctx); s != nil {
+		if content, ok := s.Read(abs); ok {
+			return int64(len(content)), false, nil
+		}
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return 0, false, err
+	}
+	return info.Size(), info.IsDir(), nil
+}
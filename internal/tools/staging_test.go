@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStagingKeepsWritesOffDisk(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello\n"), 0o644)
+	s := NewStaging(dir)
+	ctx := WithStaging(WithProjectDir(context.Background(), dir), s)
+
+	if _, err := FileEdit("")(ctx, json.RawMessage(`{"path":"a.txt","old_string":"hello","new_string":"goodbye"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FileWrite("")(ctx, json.RawMessage(`{"path":"sub/b.txt","content":"new file\n"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(data) != "hello\n" {
+		t.Fatalf("a.txt modified on disk: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "b.txt")); !os.IsNotExist(err) {
+		t.Fatal("b.txt written to disk")
+	}
+
+	// Reads see the staged content.
+	out, err := FileRead("")(ctx, json.RawMessage(`{"path":"a.txt"}`))
+	if err != nil || out != "goodbye\n" {
+		t.Fatalf("staged read = %q, %v", out, err)
+	}
+	out, err = FileGrep("")(ctx, json.RawMessage(`{"pattern":"new file"}`))
+	if err != nil || !strings.Contains(out, "sub/b.txt:1:new file") {
+		t.Fatalf("staged grep = %q, %v", out, err)
+	}
+	out, err = FileList("")(ctx, json.RawMessage(`{}`))
+	if err != nil || !strings.Contains(out, "sub/b.txt") {
+		t.Fatalf("staged list = %q, %v", out, err)
+	}
+
+	files := s.Files()
+	if len(files) != 2 {
+		t.Fatalf("got %d staged files, want 2", len(files))
+	}
+	if files[0].Path != "a.txt" || !files[0].Existed || files[0].Base != "hello\n" || files[0].Content != "goodbye\n" {
+		t.Errorf("unexpected a.txt: %+v", files[0])
+	}
+	if files[1].Path != "sub/b.txt" || files[1].Existed {
+		t.Errorf("unexpected b.txt: %+v", files[1])
+	}
+}
+
+func TestStagingOmitsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("same"), 0o644)
+	s := NewStaging(dir)
+	ctx := WithStaging(context.Background(), s)
+
+	if _, err := FileWrite(dir)(ctx, json.RawMessage(`{"path":"a.txt","content":"same"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if files := s.Files(); len(files) != 0 {
+		t.Fatalf("expected no changes, got %+v", files)
+	}
+}
+
+func TestStagingCoversOtherProjectWrites(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStaging(dir)
+	ctx := WithStaging(WithProjectDir(context.Background(), dir), s)
+
+	// Project docs are staged like file writes.
+	if _, err := ProjectDocs("")(ctx, json.RawMessage(`{"action":"write","doc_type":"prd","filename":"plan","content":"v1\n"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProjectDocs("")(ctx, json.RawMessage(`{"action":"append","doc_type":"prd","filename":"plan","content":"more"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prd")); !os.IsNotExist(err) {
+		t.Fatal("project docs written to disk")
+	}
+	out, err := ProjectDocs("")(ctx, json.RawMessage(`{"action":"read","doc_type":"prd","filename":"plan"}`))
+	if err != nil || !strings.HasPrefix(out, "v1\n") || !strings.Contains(out, "more") {
+		t.Fatalf("staged doc = %q, %v", out, err)
+	}
+	if files := s.Files(); len(files) != 1 || files[0].Path != "prd/plan.md" {
+		t.Errorf("staged files = %+v", files)
+	}
+
+	// Tools whose changes could not be reviewed are refused.
+	for name, call := range map[string]func() (string, error){
+		"shell_exec": func() (string, error) {
+			return ShellExec(dir)(ctx, json.RawMessage(`{"command":"touch","args":["x"]}`))
+		},
+		"git_commit": func() (string, error) { return GitCommit(dir)(ctx, json.RawMessage(`{"message":"m"}`)) },
+		"git_branch": func() (string, error) {
+			return GitBranch(dir)(ctx, json.RawMessage(`{"action":"switch","name":"main"}`))
+		},
+	} {
+		if _, err := call(); err == nil || !strings.Contains(err.Error(), "staged for review") {
+			t.Errorf("%s while staging: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x")); !os.IsNotExist(err) {
+		t.Error("shell_exec ran while staging")
+	}
+}
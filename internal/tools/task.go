@@ -0,0 +1,360 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+	"github.com/waynenilsen/waynebot/internal/ws"
+)
+
+// BroadcastTask sends a task event ("task_created" or "task_updated") for t.
+func BroadcastTask(hub *ws.Hub, eventType string, t model.Task) {
+	if hub == nil {
+		return
+	}
+	data := map[string]any{
+		"id":                  t.ID,
+		"title":               t.Title,
+		"description":         t.Description,
+		"status":              t.Status,
+		"assignee_user_id":    t.AssigneeUserID,
+		"assignee_persona_id": t.AssigneePersonaID,
+		"assignee_name":       t.AssigneeName,
+		"project_id":          t.ProjectID,
+		"channel_id":          t.ChannelID,
+		"parent_id":           t.ParentID,
+		"due_at":              nil,
+		"created_by_type":     t.CreatedBy.Type,
+		"created_by_id":       t.CreatedBy.ID,
+		"created_by_name":     t.CreatedBy.Name,
+		"created_at":          t.CreatedAt.Format(time.RFC3339),
+		"updated_at":          t.UpdatedAt.Format(time.RFC3339),
+	}
+	if t.DueAt != nil {
+		data["due_at"] = t.DueAt.Format(time.RFC3339)
+	}
+	hub.Broadcast(ws.Event{Type: eventType, Data: data})
+}
+
+// FormatTask renders a task for a tool result or prompt.
+func FormatTask(t model.Task) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Task #%d: %s\nStatus: %s\nAssignee: %s", t.ID, t.Title, t.Status, orUnassigned(t.AssigneeName))
+	if t.ParentID != 0 {
+		fmt.Fprintf(&sb, "\nParent: #%d", t.ParentID)
+	}
+	if t.ProjectID != 0 {
+		fmt.Fprintf(&sb, "\nProject: %d", t.ProjectID)
+	}
+	if t.DueAt != nil {
+		fmt.Fprintf(&sb, "\nDue: %s", t.DueAt.UTC().Format(time.RFC3339))
+	}
+	if t.Description != "" {
+		fmt.Fprintf(&sb, "\n\n%s", t.Description)
+	}
+	return sb.String()
+}
+
+func orUnassigned(name string) string {
+	if name == "" {
+		return "unassigned"
+	}
+	return name
+}
+
+// taskAuthor returns the calling persona as a task author.
+func taskAuthor(ctx context.Context, database *db.DB) (model.TaskAuthor, error) {
+	personaID := PersonaIDFromContext(ctx)
+	if personaID == 0 {
+		return model.TaskAuthor{}, fmt.Errorf("persona_id not set in context")
+	}
+	p, err := model.GetPersona(database, personaID)
+	if err != nil {
+		return model.TaskAuthor{}, fmt.Errorf("get persona: %w", err)
+	}
+	return model.TaskAuthor{Type: "agent", ID: p.ID, Name: p.Name}, nil
+}
+
+// lookupTask loads a task by ID for a tool call.
+func lookupTask(database *db.DB, id int64) (model.Task, error) {
+	if id == 0 {
+		return model.Task{}, fmt.Errorf("id is required")
+	}
+	t, err := model.GetTask(database, id)
+	if err == sql.ErrNoRows {
+		return model.Task{}, fmt.Errorf("task #%d not found", id)
+	}
+	return t, err
+}
+
+// setAssignee points t at the persona or user named by name; "" unassigns.
+// Persona names take precedence over usernames.
+func setAssignee(database *db.DB, t *model.Task, name string) error {
+	t.AssigneeUserID, t.AssigneePersonaID = 0, 0
+	name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+	if name == "" {
+		return nil
+	}
+	if p, err := model.GetPersonaByName(database, name); err == nil {
+		t.AssigneePersonaID = p.ID
+		return nil
+	}
+	if u, err := model.GetUserByUsername(database, name); err == nil {
+		t.AssigneeUserID = u.ID
+		return nil
+	}
+	return fmt.Errorf("no persona or user named %q", name)
+}
+
+// parseDue parses a due date given as RFC 3339 or YYYY-MM-DD; "" means none.
+func parseDue(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("due must be RFC 3339 or YYYY-MM-DD")
+}
+
+type taskCreateArgs struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Assignee    string `json:"assignee"`
+	ParentID    int64  `json:"parent_id"`
+	ProjectID   int64  `json:"project_id"`
+	Due         string `json:"due"`
+}
+
+// TaskCreate returns a ToolFunc that adds a task to the board. The task's
+// channel and project default to the caller's.
+func TaskCreate(database *db.DB, hub *ws.Hub) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args taskCreateArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		if strings.TrimSpace(args.Title) == "" {
+			return "", fmt.Errorf("title is required")
+		}
+		by, err := taskAuthor(ctx, database)
+		if err != nil {
+			return "", err
+		}
+		due, err := parseDue(args.Due)
+		if err != nil {
+			return "", err
+		}
+
+		t := model.Task{
+			Title:       strings.TrimSpace(args.Title),
+			Description: args.Description,
+			ParentID:    args.ParentID,
+			ProjectID:   args.ProjectID,
+			ChannelID:   ChannelIDFromContext(ctx),
+			DueAt:       due,
+		}
+		if t.ProjectID == 0 {
+			t.ProjectID = ProjectIDFromContext(ctx)
+		}
+		if t.ParentID != 0 {
+			if _, err := lookupTask(database, t.ParentID); err != nil {
+				return "", err
+			}
+		}
+		if err := setAssignee(database, &t, args.Assignee); err != nil {
+			return "", err
+		}
+
+		t, err = model.CreateTask(database, t, by)
+		if err != nil {
+			return "", fmt.Errorf("create task: %w", err)
+		}
+		BroadcastTask(hub, "task_created", t)
+		return "Created " + FormatTask(t), nil
+	}
+}
+
+type taskListArgs struct {
+	Status     string `json:"status"`
+	Mine       bool   `json:"mine"`
+	Unassigned bool   `json:"unassigned"`
+	ParentID   int64  `json:"parent_id"`
+	Limit      int    `json:"limit"`
+}
+
+// TaskList returns a ToolFunc that lists tasks on the board, most recently
+// updated first.
+func TaskList(database *db.DB) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args taskListArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		if args.Status != "" && !model.ValidTaskStatus(args.Status) {
+			return "", fmt.Errorf("unknown status %q", args.Status)
+		}
+		filter := model.TaskFilter{
+			Status:     args.Status,
+			Unassigned: args.Unassigned,
+			ParentID:   args.ParentID,
+			Limit:      args.Limit,
+		}
+		if filter.Limit <= 0 || filter.Limit > 50 {
+			filter.Limit = 20
+		}
+		if args.Mine {
+			filter.AssigneePersonaID = PersonaIDFromContext(ctx)
+		}
+
+		tasks, err := model.ListTasks(database, filter)
+		if err != nil {
+			return "", fmt.Errorf("list tasks: %w", err)
+		}
+		if len(tasks) == 0 {
+			return "no tasks found", nil
+		}
+		var sb strings.Builder
+		for _, t := range tasks {
+			fmt.Fprintf(&sb, "#%d [%s] %s (%s)", t.ID, t.Status, t.Title, orUnassigned(t.AssigneeName))
+			if t.DueAt != nil {
+				fmt.Fprintf(&sb, " due %s", t.DueAt.UTC().Format(time.DateOnly))
+			}
+			sb.WriteString("\n")
+		}
+		return sb.String(), nil
+	}
+}
+
+type taskIDArgs struct {
+	ID int64 `json:"id"`
+}
+
+// TaskClaim returns a ToolFunc that assigns an unassigned task to the caller.
+func TaskClaim(database *db.DB, hub *ws.Hub) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args taskIDArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		by, err := taskAuthor(ctx, database)
+		if err != nil {
+			return "", err
+		}
+		if _, err := lookupTask(database, args.ID); err != nil {
+			return "", err
+		}
+
+		t, err := model.ClaimTask(database, args.ID, by.ID, by)
+		if err != nil {
+			return "", err
+		}
+		BroadcastTask(hub, "task_updated", t)
+		return "Claimed " + FormatTask(t), nil
+	}
+}
+
+// taskUpdateArgs uses pointers so only the fields present are changed. An
+// empty assignee unassigns the task and an empty due clears the due date.
+type taskUpdateArgs struct {
+	ID          int64   `json:"id"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Status      *string `json:"status"`
+	Assignee    *string `json:"assignee"`
+	Due         *string `json:"due"`
+}
+
+// TaskUpdate returns a ToolFunc that changes a task's fields.
+func TaskUpdate(database *db.DB, hub *ws.Hub) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args taskUpdateArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		by, err := taskAuthor(ctx, database)
+		if err != nil {
+			return "", err
+		}
+		t, err := lookupTask(database, args.ID)
+		if err != nil {
+			return "", err
+		}
+
+		if args.Title != nil {
+			if strings.TrimSpace(*args.Title) == "" {
+				return "", fmt.Errorf("title must not be empty")
+			}
+			t.Title = strings.TrimSpace(*args.Title)
+		}
+		if args.Description != nil {
+			t.Description = *args.Description
+		}
+		if args.Status != nil {
+			if !model.ValidTaskStatus(*args.Status) {
+				return "", fmt.Errorf("unknown status %q", *args.Status)
+			}
+			t.Status = *args.Status
+		}
+		if args.Assignee != nil {
+			if err := setAssignee(database, &t, *args.Assignee); err != nil {
+				return "", err
+			}
+		}
+		if args.Due != nil {
+			if t.DueAt, err = parseDue(*args.Due); err != nil {
+				return "", err
+			}
+		}
+
+		t, err = model.UpdateTask(database, t, by)
+		if err != nil {
+			return "", fmt.Errorf("update task: %w", err)
+		}
+		BroadcastTask(hub, "task_updated", t)
+		return "Updated " + FormatTask(t), nil
+	}
+}
+
+type taskCommentArgs struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+// TaskComment returns a ToolFunc that comments on a task.
+func TaskComment(database *db.DB, hub *ws.Hub) ToolFunc {
+	return func(ctx context.Context, raw json.RawMessage) (string, error) {
+		var args taskCommentArgs
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+		if strings.TrimSpace(args.Body) == "" {
+			return "", fmt.Errorf("body is required")
+		}
+		by, err := taskAuthor(ctx, database)
+		if err != nil {
+			return "", err
+		}
+		if _, err := lookupTask(database, args.ID); err != nil {
+			return "", err
+		}
+
+		if _, err := model.AddTaskComment(database, args.ID, by, args.Body); err != nil {
+			return "", fmt.Errorf("add comment: %w", err)
+		}
+		t, err := model.GetTask(database, args.ID)
+		if err != nil {
+			return "", err
+		}
+		BroadcastTask(hub, "task_updated", t)
+		return fmt.Sprintf("commented on task #%d", args.ID), nil
+	}
+}
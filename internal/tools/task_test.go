@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/waynenilsen/waynebot/internal/db"
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func TestTaskTools(t *testing.T) {
+	d, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	lead, _ := model.CreatePersona(d, "lead", "", "m", nil, 0.7, 100, 0, 0)
+	coder, _ := model.CreatePersona(d, "coder", "", "m", nil, 0.7, 100, 0, 0)
+	ch, _ := model.CreateChannel(d, "general", "", 0)
+
+	leadCtx := WithChannelID(WithPersonaID(context.Background(), lead.ID), ch.ID)
+	coderCtx := WithPersonaID(context.Background(), coder.ID)
+	call := func(ctx context.Context, fn ToolFunc, args string) string {
+		t.Helper()
+		out, err := fn(ctx, json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("%s: %v", args, err)
+		}
+		return out
+	}
+
+	out := call(leadCtx, TaskCreate(d, nil), `{"title":"Fix login","description":"Sessions expire too early.","due":"2030-01-02"}`)
+	if !strings.Contains(out, "Task #1: Fix login") || !strings.Contains(out, "unassigned") {
+		t.Errorf("unexpected create output: %s", out)
+	}
+	task, _ := model.GetTask(d, 1)
+	if task.ChannelID != ch.ID || task.CreatedBy.Name != "lead" || task.DueAt == nil {
+		t.Errorf("unexpected task: %+v", task)
+	}
+
+	out = call(coderCtx, TaskList(d), `{"unassigned":true}`)
+	if !strings.Contains(out, "#1 [todo] Fix login (unassigned) due 2030-01-02") {
+		t.Errorf("unexpected list output: %s", out)
+	}
+
+	out = call(coderCtx, TaskClaim(d, nil), `{"id":1}`)
+	if !strings.Contains(out, "Status: in_progress") || !strings.Contains(out, "Assignee: coder") {
+		t.Errorf("unexpected claim output: %s", out)
+	}
+	if _, err := TaskClaim(d, nil)(leadCtx, json.RawMessage(`{"id":1}`)); err == nil {
+		t.Error("expected error claiming a task assigned to someone else")
+	}
+
+	call(coderCtx, TaskComment(d, nil), `{"id":1,"body":"Found the bug."}`)
+	out = call(coderCtx, TaskUpdate(d, nil), `{"id":1,"status":"done","assignee":"lead","due":""}`)
+	if !strings.Contains(out, "Status: done") || !strings.Contains(out, "Assignee: lead") || strings.Contains(out, "Due:") {
+		t.Errorf("unexpected update output: %s", out)
+	}
+
+	out = call(leadCtx, TaskList(d), `{"mine":true,"status":"done"}`)
+	if !strings.Contains(out, "#1 [done]") {
+		t.Errorf("unexpected mine output: %s", out)
+	}
+
+	for _, c := range []struct {
+		fn   ToolFunc
+		args string
+	}{
+		{TaskCreate(d, nil), `{"title":" "}`},
+		{TaskCreate(d, nil), `{"title":"x","assignee":"nobody"}`},
+		{TaskCreate(d, nil), `{"title":"x","parent_id":99}`},
+		{TaskUpdate(d, nil), `{"id":1,"status":"finished"}`},
+		{TaskUpdate(d, nil), `{"id":99,"title":"x"}`},
+		{TaskComment(d, nil), `{"id":1,"body":""}`},
+	} {
+		if _, err := c.fn(leadCtx, json.RawMessage(c.args)); err == nil {
+			t.Errorf("%s: expected error", c.args)
+		}
+	}
+
+	events, _ := model.ListTaskEvents(d, 1)
+	if len(events) != 4 {
+		t.Errorf("got %d task events, want 4", len(events))
+	}
+}
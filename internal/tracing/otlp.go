@@ -0,0 +1,299 @@
+// Package tracing exports agent run traces as OpenTelemetry spans, encoded
+// as OTLP/JSON, to a file or an OTLP/HTTP collector.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+// Exporter sends run traces to File, Endpoint or both.
+type Exporter struct {
+	// File, when set, gets one OTLP/JSON ExportTraceServiceRequest per line.
+	File string
+	// Endpoint, when set, is the base URL of an OTLP/HTTP collector, e.g.
+	// http://localhost:4318; traces are POSTed to its /v1/traces.
+	Endpoint string
+	// Service is the service.name resource attribute; "waynebot" when
+	// empty.
+	Service string
+	// Client posts to Endpoint; http.DefaultClient when nil.
+	Client *http.Client
+
+	mu sync.Mutex
+}
+
+// ExportRun exports a run's trace.
+func (e *Exporter) ExportRun(ctx context.Context, trace model.RunTrace) error {
+	body, err := json.Marshal(e.request(trace))
+	if err != nil {
+		return err
+	}
+	if e.File != "" {
+		if err := e.appendFile(body); err != nil {
+			return fmt.Errorf("write %s: %w", e.File, err)
+		}
+	}
+	if e.Endpoint != "" {
+		if err := e.post(ctx, body); err != nil {
+			return fmt.Errorf("post to %s: %w", e.Endpoint, err)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) appendFile(body []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f, err := os.OpenFile(e.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(body, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (e *Exporter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// OTLP/JSON types, as far as waynebot needs them.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []attribute `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes,omitempty"`
+	Events            []event     `json:"events,omitempty"`
+	Status            status      `json:"status"`
+}
+
+type event struct {
+	TimeUnixNano string      `json:"timeUnixNano"`
+	Name         string      `json:"name"`
+	Attributes   []attribute `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+type attributeValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func str(key, v string) attribute {
+	return attribute{Key: key, Value: attributeValue{StringValue: &v}}
+}
+
+func num(key string, v int64) attribute {
+	s := strconv.FormatInt(v, 10)
+	return attribute{Key: key, Value: attributeValue{IntValue: &s}}
+}
+
+func flag(key string, v bool) attribute {
+	return attribute{Key: key, Value: attributeValue{BoolValue: &v}}
+}
+
+// Span kinds and status codes from the OTLP protocol.
+const (
+	kindInternal = 1
+	kindClient   = 3
+
+	statusOK    = 1
+	statusError = 2
+)
+
+// request turns a run's trace into a root span for the run with a child
+// span for each LLM call and tool execution, and span events for the
+// triggering and posted messages.
+func (e *Exporter) request(trace model.RunTrace) exportRequest {
+	run := trace.Run
+	traceID := hashID(run.ID, 16)
+	rootID := hashID(run.ID+"/run", 8)
+
+	start, end := run.StartedAt, time.Now()
+	if run.FinishedAt != nil {
+		end = *run.FinishedAt
+	}
+	cover := func(from time.Time, durationMs int64) time.Time {
+		to := from.Add(time.Duration(durationMs) * time.Millisecond)
+		if from.Before(start) {
+			start = from
+		}
+		if to.After(end) {
+			end = to
+		}
+		return to
+	}
+	root := span{
+		TraceID: traceID,
+		SpanID:  rootID,
+		Name:    "agent.run",
+		Kind:    kindInternal,
+		Attributes: []attribute{
+			str("waynebot.run.id", run.ID),
+			str("waynebot.run.trigger", run.Trigger),
+			str("waynebot.run.status", run.Status),
+			num("waynebot.persona.id", run.PersonaID),
+			num("waynebot.channel.id", run.ChannelID),
+		},
+		Status: status{Code: statusOK},
+	}
+	if run.Status == model.RunFailed || run.Status == model.RunCancelled {
+		root.Status = status{Code: statusError, Message: run.Reason}
+	}
+
+	spans := []span{}
+	for _, ev := range trace.Events {
+		switch ev.Kind {
+		case model.TraceTrigger, model.TraceMessage:
+			name := "message.received"
+			if ev.Kind == model.TraceMessage {
+				name = "message.posted"
+			}
+			root.Events = append(root.Events, event{
+				TimeUnixNano: unixNano(ev.At),
+				Name:         name,
+				Attributes: []attribute{
+					num("waynebot.message.id", ev.Message.ID),
+					str("waynebot.message.author", ev.Message.AuthorName),
+				},
+			})
+		case model.TraceLLMCall:
+			c := ev.LLMCall
+			spans = append(spans, span{
+				TraceID:           traceID,
+				SpanID:            hashID(fmt.Sprintf("%s/llm/%d", run.ID, c.ID), 8),
+				ParentSpanID:      rootID,
+				Name:              "chat " + c.Model,
+				Kind:              kindClient,
+				StartTimeUnixNano: unixNano(ev.At),
+				EndTimeUnixNano:   unixNano(cover(ev.At, c.DurationMs)),
+				Attributes: []attribute{
+					str("gen_ai.operation.name", "chat"),
+					str("gen_ai.request.model", c.Model),
+					num("gen_ai.usage.input_tokens", int64(c.PromptTokens)),
+					num("gen_ai.usage.output_tokens", int64(c.CompletionTokens)),
+					num("waynebot.llm_call.id", c.ID),
+				},
+				Status: status{Code: statusOK},
+			})
+		case model.TraceToolExecution:
+			x := ev.ToolExecution
+			s := span{
+				TraceID:           traceID,
+				SpanID:            hashID(fmt.Sprintf("%s/tool/%d", run.ID, x.ID), 8),
+				ParentSpanID:      rootID,
+				Name:              "execute_tool " + x.ToolName,
+				Kind:              kindInternal,
+				StartTimeUnixNano: unixNano(ev.At),
+				EndTimeUnixNano:   unixNano(cover(ev.At, x.DurationMs)),
+				Attributes: []attribute{
+					str("gen_ai.operation.name", "execute_tool"),
+					str("gen_ai.tool.name", x.ToolName),
+					num("waynebot.tool_execution.id", x.ID),
+					flag("waynebot.tool_execution.cancelled", x.Cancelled),
+				},
+				Status: status{Code: statusOK},
+			}
+			if x.ErrorText != "" {
+				s.Status = status{Code: statusError, Message: x.ErrorText}
+			}
+			spans = append(spans, s)
+		}
+	}
+
+	// agent_runs times are to the second; widen the run to cover its steps.
+	root.StartTimeUnixNano, root.EndTimeUnixNano = unixNano(start), unixNano(end)
+
+	service := e.Service
+	if service == "" {
+		service = "waynebot"
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: resource{Attributes: []attribute{str("service.name", service)}},
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: "github.com/waynenilsen/waynebot/internal/agent"},
+			Spans: append([]span{root}, spans...),
+		}},
+	}}}
+}
+
+// hashID derives a stable n-byte trace or span ID, hex encoded.
+func hashID(s string, n int) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:n])
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
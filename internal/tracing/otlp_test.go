@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynenilsen/waynebot/internal/model"
+)
+
+func testTrace() model.RunTrace {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	finish := start.Add(3 * time.Second)
+	return model.RunTrace{
+		Run: model.AgentRun{ID: "0123456789abcdef", PersonaID: 1, ChannelID: 2, Trigger: model.RunTriggerMessage,
+			Status: model.RunCompleted, StartedAt: start, FinishedAt: &finish},
+		Events: []model.RunTraceEvent{
+			{Kind: model.TraceTrigger, At: start, Message: &model.Message{ID: 7, AuthorName: "alice"}},
+			{Kind: model.TraceLLMCall, At: start.Add(-100 * time.Millisecond), LLMCall: &model.LLMCall{ID: 1, Model: "m", PromptTokens: 10, CompletionTokens: 2, DurationMs: 500}},
+			{Kind: model.TraceToolExecution, At: start.Add(time.Second), ToolExecution: &model.ToolExecution{ID: 1, ToolName: "shell_exec", ErrorText: "exit 1", DurationMs: 2500}},
+			{Kind: model.TraceMessage, At: finish, Message: &model.Message{ID: 8, AuthorName: "bot"}},
+		},
+	}
+}
+
+func TestExportRun(t *testing.T) {
+	var posted []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		posted, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	e := &Exporter{File: file, Endpoint: srv.URL + "/"}
+	if err := e.ExportRun(context.Background(), testTrace()); err != nil {
+		t.Fatalf("ExportRun: %v", err)
+	}
+	e.ExportRun(context.Background(), testTrace())
+
+	data, _ := os.ReadFile(file)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || lines[0] != string(posted) {
+		t.Fatalf("file has %d lines; first matches posted body: %v", len(lines), lines[0] == string(posted))
+	}
+
+	var req exportRequest
+	if err := json.Unmarshal(posted, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	root, llmSpan, tool := spans[0], spans[1], spans[2]
+	if len(root.TraceID) != 32 || len(root.SpanID) != 16 || root.ParentSpanID != "" || len(root.Events) != 2 {
+		t.Errorf("root = %+v", root)
+	}
+	if llmSpan.ParentSpanID != root.SpanID || llmSpan.TraceID != root.TraceID || llmSpan.Name != "chat m" || llmSpan.Kind != kindClient {
+		t.Errorf("llm span = %+v", llmSpan)
+	}
+	if tool.Status.Code != statusError || tool.Status.Message != "exit 1" {
+		t.Errorf("tool span = %+v", tool)
+	}
+	// The run is widened to cover the LLM call that started before it and
+	// the tool call that ended after it.
+	if root.StartTimeUnixNano != llmSpan.StartTimeUnixNano || root.EndTimeUnixNano != tool.EndTimeUnixNano {
+		t.Errorf("root spans %s-%s", root.StartTimeUnixNano, root.EndTimeUnixNano)
+	}
+}
+
+func TestExportRunCollectorError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad trace", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	err := (&Exporter{Endpoint: srv.URL}).ExportRun(context.Background(), testTrace())
+	if err == nil || !strings.Contains(err.Error(), "bad trace") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -30,6 +30,10 @@ type Client struct {
 	conn   *websocket.Conn
 	send   chan []byte
 	UserID int64
+
+	// evicted is set by the hub's event loop once it has decided to drop
+	// the client for falling behind.
+	evicted bool
 }
 
 // NewClient creates a new Client for the given connection.
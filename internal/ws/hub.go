@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log/slog"
 	"sync"
+
+	"github.com/waynenilsen/waynebot/internal/metrics"
 )
 
 // Event is the JSON envelope sent to WebSocket clients.
@@ -12,6 +14,13 @@ type Event struct {
 	Data any    `json:"data"`
 }
 
+// delivery is an event on its way to clients: every client, or only those
+// of userID when it is non-zero.
+type delivery struct {
+	event  Event
+	userID int64
+}
+
 // Hub maintains the set of active clients and broadcasts events to them.
 type Hub struct {
 	// NotifyChan receives a signal every time a message is broadcast.
@@ -22,7 +31,7 @@ type Hub struct {
 	clients    map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
-	broadcast  chan Event
+	broadcast  chan delivery
 	done       chan struct{}
 }
 
@@ -33,7 +42,7 @@ func NewHub() *Hub {
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		broadcast:  make(chan Event, 256),
+		broadcast:  make(chan delivery, 256),
 		done:       make(chan struct{}),
 	}
 }
@@ -55,8 +64,8 @@ func (h *Hub) Run() {
 			}
 			h.mu.Unlock()
 
-		case event := <-h.broadcast:
-			data, err := json.Marshal(event)
+		case d := <-h.broadcast:
+			data, err := json.Marshal(d.event)
 			if err != nil {
 				slog.Error("ws hub: marshal event", "error", err)
 				continue
@@ -64,19 +73,29 @@ func (h *Hub) Run() {
 
 			h.mu.RLock()
 			for client := range h.clients {
+				if d.userID != 0 && client.UserID != d.userID {
+					continue
+				}
 				select {
 				case client.send <- data:
 				default:
 					// Client buffer full — drop and disconnect.
-					go h.removeClient(client)
+					if !client.evicted {
+						client.evicted = true
+						metrics.WSSlowClientDisconnects.Inc()
+						go h.removeClient(client)
+					}
 				}
 			}
 			h.mu.RUnlock()
 
-			// Signal NotifyChan (non-blocking).
-			select {
-			case h.NotifyChan <- struct{}{}:
-			default:
+			// Signal NotifyChan (non-blocking). Events for one user are
+			// of no interest to agents.
+			if d.userID == 0 {
+				select {
+				case h.NotifyChan <- struct{}{}:
+				default:
+				}
 			}
 
 		case <-h.done:
@@ -108,13 +127,36 @@ func (h *Hub) Unregister(c *Client) {
 
 // Broadcast sends an event to all connected clients.
 func (h *Hub) Broadcast(event Event) {
+	h.send(delivery{event: event})
+}
+
+// SendToUser sends an event only to the given user's connected clients. It
+// does not signal NotifyChan.
+func (h *Hub) SendToUser(userID int64, event Event) {
+	h.send(delivery{event: event, userID: userID})
+}
+
+func (h *Hub) send(d delivery) {
 	select {
-	case h.broadcast <- event:
+	case h.broadcast <- d:
 	default:
+		metrics.WSDroppedBroadcasts.Inc()
 		slog.Warn("ws hub: broadcast channel full, dropping event")
 	}
 }
 
+// UserConnected reports whether the user has a connected client.
+func (h *Hub) UserConnected(userID int64) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
 // ClientCount returns the number of connected clients.
 func (h *Hub) ClientCount() int {
 	h.mu.RLock()
@@ -78,6 +78,45 @@ func TestHubNotifyChan(t *testing.T) {
 	recvFrom(t, c)
 }
 
+func TestHubSendToUser(t *testing.T) {
+	hub := ws.NewHub()
+	go hub.Run()
+	defer hub.Stop()
+
+	alice := ws.NewTestClient(hub, 1)
+	bob := ws.NewTestClient(hub, 2)
+	hub.Register(alice)
+	hub.Register(bob)
+	waitFor(t, func() bool { return hub.ClientCount() == 2 })
+
+	if !hub.UserConnected(1) || hub.UserConnected(3) {
+		t.Error("UserConnected should report only registered users")
+	}
+
+	select {
+	case <-hub.NotifyChan:
+	default:
+	}
+
+	hub.SendToUser(1, ws.Event{Type: "private", Data: "psst"})
+
+	var ev ws.Event
+	json.Unmarshal(recvFrom(t, alice), &ev)
+	if ev.Type != "private" {
+		t.Errorf("alice event type = %q, want private", ev.Type)
+	}
+	select {
+	case msg := <-bob.SendChan():
+		t.Errorf("bob received %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	select {
+	case <-hub.NotifyChan:
+		t.Error("a user event should not signal NotifyChan")
+	default:
+	}
+}
+
 func TestHubClientCount(t *testing.T) {
 	hub := ws.NewHub()
 	go hub.Run()